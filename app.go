@@ -2,16 +2,26 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	goruntime "runtime"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/ebob10000/2c1f/cache"
+	"github.com/ebob10000/2c1f/contacts"
+	"github.com/ebob10000/2c1f/events"
+	"github.com/ebob10000/2c1f/history"
+	"github.com/ebob10000/2c1f/hooks"
+	"github.com/ebob10000/2c1f/i18n"
 	"github.com/ebob10000/2c1f/p2p"
 	"github.com/ebob10000/2c1f/settings"
+	"github.com/ebob10000/2c1f/thumbnail"
 	"github.com/ebob10000/2c1f/transfer"
 	"github.com/ebob10000/2c1f/updater"
 	"github.com/ebob10000/2c1f/version"
@@ -21,46 +31,53 @@ import (
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
-// TransferRecord stores info about a completed transfer
-type TransferRecord struct {
-	Timestamp time.Time `json:"timestamp"`
-	Path      string    `json:"path"`
-	FullPath  string    `json:"fullPath"`
-	Size      int64     `json:"size"`
-	Direction string    `json:"direction"`
-	Status    string    `json:"status"`
-}
-
 type App struct {
 	ctx             context.Context
+	events          events.Emitter // Frontend notifications, Wails unless set before startup
 	settings        settings.AppSettings
 	activeNode      *p2p.Node
+	withdrawCode    func() // Withdraws the code activeNode advertises, once it did
+	cancelTransfer  context.CancelFunc
 	nodeMu          sync.Mutex
-	transferHistory []TransferRecord
+	transferHistory []history.Record
 	isPaused        bool
 	pauseMu         sync.Mutex
+	insecureUpdate  bool                // Allow installing updates without a valid signature
+	rollbackOffered bool                // The GUI is asking whether to roll back a crashing update
+	peerConfirm     chan bool           // Receives the user's answer while a verification code is shown in strict mode
+	peerChoice      chan string         // Receives the user's pick while senders with the same code are shown
+	transferConfirm chan transferChoice // Receives the user's answer while an incoming transfer is shown
+	transferActive  bool                // A transfer was started and has not completed, failed or been cancelled
+	quitWhenIdle    bool                // The window was closed in background mode, exit when the transfer ends
+	background      bool                // Transfers are throttled while the window is in the background
+	discoveryNode   *p2p.Node           // Finds senders on the local network, started on first use
+	inbox           *p2p.Node           // Uses the permanent identity for transfers with contacts
+	inboxMu         sync.Mutex
+	profile         string // Profile applied to transfers, none if empty
 }
 
 // progressTracker handles progress tracking for transfers
 type progressTracker struct {
-	ctx          context.Context
+	events       events.Emitter
 	globalSent   int64
 	globalTotal  int64
 	lastUpdate   time.Time
 	fileProgress map[string]int64
+	monitor      *p2p.Monitor
+	localPath    func(filename string) string // Where a received file was saved, nil when sending
 	mu           sync.Mutex
 }
 
-func newProgressTracker(ctx context.Context, totalSize int64) *progressTracker {
+func newProgressTracker(emitter events.Emitter, totalSize int64) *progressTracker {
 	return &progressTracker{
-		ctx:          ctx,
+		events:       emitter,
 		globalTotal:  totalSize,
 		fileProgress: make(map[string]int64),
 	}
 }
 
 func (pt *progressTracker) onStartFile(filename string, index, total int) {
-	runtime.EventsEmit(pt.ctx, "transfer_start_file", map[string]interface{}{
+	pt.events.Emit(events.StartFile, map[string]interface{}{
 		"filename": filename,
 		"index":    index,
 		"total":    total,
@@ -75,16 +92,19 @@ func (pt *progressTracker) onProgress(filename string, sent, total int64) {
 	delta := sent - prevSent
 	pt.fileProgress[filename] = sent
 	pt.globalSent += delta
+	if pt.monitor != nil && delta > 0 {
+		pt.monitor.AddBytes(delta)
+	}
 
 	now := time.Now()
 	if sent == total || now.Sub(pt.lastUpdate) > 500*time.Millisecond {
-		runtime.EventsEmit(pt.ctx, "transfer_file_progress", map[string]interface{}{
+		pt.events.Emit(events.FileProgress, map[string]interface{}{
 			"filename": filename,
 			"sent":     sent,
 			"total":    total,
 			"percent":  float64(sent) / float64(total) * 100,
 		})
-		runtime.EventsEmit(pt.ctx, "transfer_global_progress", map[string]interface{}{
+		pt.events.Emit("transfer_global_progress", map[string]interface{}{
 			"sent":    pt.globalSent,
 			"total":   pt.globalTotal,
 			"percent": float64(pt.globalSent) / float64(pt.globalTotal) * 100,
@@ -93,12 +113,29 @@ func (pt *progressTracker) onProgress(filename string, sent, total int64) {
 	}
 }
 
+// onFileComplete reports a saved or failed file, and for receivers where it
+// was saved, so the GUI can show a preview of it
+func (pt *progressTracker) onFileComplete(filename string, verified bool, err error) {
+	data := map[string]interface{}{
+		"filename": filename,
+		"verified": verified,
+		"type":     transfer.MIMEType(filename, nil),
+	}
+	if err != nil {
+		data["error"] = err.Error()
+	}
+	if pt.localPath != nil {
+		data["localPath"] = pt.localPath(filename)
+	}
+	pt.events.Emit(events.FileComplete, data)
+}
+
 // simulateFileTransfer simulates transferring files with progress updates
 // Returns true if transfer completed, false if cancelled
 func (a *App) simulateFileTransfer(files []transfer.FileEntry, totalSize int64, direction string, checkCancel bool) bool {
 	var globalSent int64 = 0
 	for i, file := range files {
-		runtime.EventsEmit(a.ctx, "transfer_start_file", map[string]interface{}{
+		a.events.Emit(events.StartFile, map[string]interface{}{
 			"filename": file.Path,
 			"index":    i + 1,
 			"total":    len(files),
@@ -130,14 +167,14 @@ func (a *App) simulateFileTransfer(files []transfer.FileEntry, totalSize int64,
 			globalSent += chunkSize
 			time.Sleep(50 * time.Millisecond) // Simulate network delay
 
-			runtime.EventsEmit(a.ctx, "transfer_file_progress", map[string]interface{}{
+			a.events.Emit(events.FileProgress, map[string]interface{}{
 				"filename": file.Path,
 				"sent":     sent,
 				"total":    file.Size,
 				"percent":  float64(sent) / float64(file.Size) * 100,
 			})
 
-			runtime.EventsEmit(a.ctx, "transfer_global_progress", map[string]interface{}{
+			a.events.Emit("transfer_global_progress", map[string]interface{}{
 				"sent":    globalSent,
 				"total":   totalSize,
 				"percent": float64(globalSent) / float64(totalSize) * 100,
@@ -146,32 +183,55 @@ func (a *App) simulateFileTransfer(files []transfer.FileEntry, totalSize int64,
 	}
 
 	statusMsg := fmt.Sprintf("%s successfully (Simulation)", map[bool]string{true: "Sent", false: "Received"}[direction == "send"])
-	runtime.EventsEmit(a.ctx, "transfer_complete", statusMsg)
+	a.emitComplete(statusMsg, transfer.Summary{})
 	a.AddTransferRecord("Simulation Transfer", totalSize, direction, "complete")
 	return true
 }
 
 func (a *App) loadSettings() {
 	a.settings = settings.LoadSettings()
+	a.configureUpdater()
+	i18n.SetLanguage(a.settings.Language)
+}
+
+// configureUpdater applies the user's proxy and timeout to update checks and downloads
+func (a *App) configureUpdater() {
+	updater.Proxy = a.settings.UpdateProxy
+	if a.settings.UpdateTimeout > 0 {
+		updater.Timeout = time.Duration(a.settings.UpdateTimeout) * time.Second
+	}
 }
 
 func (a *App) GetSettings() settings.AppSettings {
+	a.nodeMu.Lock()
+	defer a.nodeMu.Unlock()
 	return a.settings
 }
 
 func (a *App) SaveSettings(s settings.AppSettings) {
+	a.nodeMu.Lock()
 	a.settings = s
-	path := settings.GetSettingsPath()
-	data, err := json.Marshal(s)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: failed to marshal settings: %v\n", err)
-		return
-	}
-	if err := os.WriteFile(path, data, 0600); err != nil {
+	a.nodeMu.Unlock()
+	a.configureUpdater()
+	a.applyThrottle()
+	a.loadHistory()
+	i18n.SetLanguage(s.Language)
+	if err := settings.Save(s); err != nil {
 		fmt.Fprintf(os.Stderr, "Warning: failed to save settings: %v\n", err)
 	}
 }
 
+// GetLanguages returns the languages the interface can be shown in
+func (a *App) GetLanguages() []i18n.Language {
+	return i18n.Languages
+}
+
+// GetMessages returns the translations of the current language, keyed by
+// their English text, for the frontend to look up its labels
+func (a *App) GetMessages() map[string]string {
+	return i18n.Messages()
+}
+
 // NewApp creates a new App application struct
 func NewApp() *App {
 	a := &App{}
@@ -182,32 +242,384 @@ func NewApp() *App {
 
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
+	if a.events == nil {
+		a.events = events.NewWails(ctx)
+	}
+	a.events = transferWatcher{Emitter: a.events, onEnd: a.transferEnded}
+
+	// Contacts can send to this device while the app is open
+	if len(contacts.Load()) > 0 {
+		go a.startInbox()
+	}
+
+	// Offer a rollback if this version keeps failing to start after an update
+	state, needsRollback := updater.CheckStartup(version.Version)
+	a.rollbackOffered = needsRollback
+	go func() {
+		if needsRollback {
+			// Give the frontend time to register its listeners
+			time.Sleep(2 * time.Second)
+			a.events.Emit("update_rollback_available", map[string]string{
+				"version":         version.Version,
+				"previousVersion": state.PreviousVersion,
+			})
+			return
+		}
+		time.Sleep(updater.StableAfter)
+		updater.ConfirmStartup(version.Version)
+	}()
+
+	// Previews and cached manifests are bounded like in the CLI
+	go cache.Trim(int64(a.settings.MaxCacheMB) << 20)
 
 	// Check for updates in background (non-blocking)
 	go func() {
 		// Wait a bit before checking to not slow down app startup
 		time.Sleep(2 * time.Second)
 
-		updateInfo, err := updater.CheckForUpdates("ebob10000/2c1f", version.Version)
+		updateInfo, err := updater.CheckForUpdates("ebob10000/2c1f", version.Version, a.settings.UpdateChannel)
 		if err != nil {
 			// Log error but don't notify user (fail silently)
 			return
 		}
 		if updateInfo != nil {
-			runtime.EventsEmit(a.ctx, "update_available", updateInfo)
+			a.events.Emit("update_available", updateInfo)
 		}
 	}()
 }
 
+func (a *App) shutdown(ctx context.Context) {
+	// A clean exit is not a crash
+	if !a.rollbackOffered {
+		updater.ConfirmStartup(version.Version)
+	}
+	a.closeDiscovery()
+	a.closeInbox()
+}
+
+// RollbackUpdate restores the previous version and restarts into it
+func (a *App) RollbackUpdate() error {
+	exePath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to get executable path: %w", err)
+	}
+	if _, err := updater.Rollback(exePath); err != nil {
+		return err
+	}
+	return updater.Restart(exePath)
+}
+
+// DismissRollback keeps the current version and stops offering a rollback
+func (a *App) DismissRollback() {
+	a.rollbackOffered = false
+	updater.ConfirmStartup(version.Version)
+}
+
+// sleepContext waits for d and reports false if ctx was cancelled first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// emitTransferError reports a failed transfer to the frontend. Besides the
+// plain "error" message, it emits the error category so the UI can tell a
+// rejection or cancellation apart from a dropped connection.
+func (a *App) emitTransferError(prefix string, err error) {
+	msg := fmt.Sprintf("%s: %v", prefix, err)
+	a.events.Emit("error", msg)
+	a.events.Emit("transfer_error", map[string]interface{}{
+		"message":   msg,
+		"category":  transfer.CategoryOf(err).String(),
+		"retryable": transfer.IsRetryableError(err),
+	})
+}
+
+// emitComplete reports a finished transfer to the frontend with message, its
+// summary unless that is empty, and how well compression did if it was on
+func (a *App) emitComplete(message string, summary transfer.Summary) {
+	data := map[string]interface{}{"message": message}
+	if summary.Direction != "" {
+		data["summary"] = summary
+	}
+	if compression := summary.Compression; compression != nil {
+		data["compression"] = map[string]interface{}{
+			"logical":    compression.Logical,
+			"wire":       compression.Wire,
+			"ratio":      compression.Ratio(),
+			"saved":      compression.Saved(),
+			"cpuSeconds": compression.CPUTime.Seconds(),
+		}
+	}
+	a.events.Emit("transfer_complete", data)
+}
+
+// runHook runs the user's OnComplete command, if any, for a transfer that
+// ended with err. It runs in the background so the UI does not wait for it.
+func (a *App) runHook(command, direction, path string, size int64, peerID peer.ID, err error) {
+	if command == "" {
+		return
+	}
+	t := hooks.Transfer{Direction: direction, Path: path, Size: size, Status: hooks.Status(err), Peer: peerID.String()}
+	go func() {
+		if err := hooks.Run(context.Background(), command, t); err != nil {
+			a.events.Emit("log", err.Error())
+		}
+	}()
+}
+
+// nodeConfig returns the network settings for transfer nodes. Other nodes
+// run next to them and take a random port.
+func (a *App) nodeConfig(fixedPort bool) p2p.Config {
+	opts := a.transferSettings()
+	cfg := p2p.Config{
+		Proxy:     opts.Proxy,
+		NoPortMap: opts.NoUPnP,
+		Access:    p2p.ParseAccessList(opts.AllowPeers, opts.DenyPeers),
+	}
+	for _, addr := range strings.Split(opts.ListenAddrs, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			cfg.Listen = append(cfg.Listen, addr)
+		}
+	}
+	if fixedPort {
+		cfg.Port = opts.Port
+	}
+	return cfg
+}
+
+// configureNode applies the user's network timeouts to a freshly created node
+func (a *App) configureNode(node *p2p.Node) {
+	node.BootstrapTimeout = time.Duration(a.settings.BootstrapTimeout) * time.Second
+	node.FindTimeout = time.Duration(a.settings.FindTimeout) * time.Second
+	node.OnBootstrap = func(set string, err error) {
+		if err != nil {
+			a.events.Emit("log", i18n.T("Could not reach the %s bootstrap peers: %v", set, err))
+			return
+		}
+		a.events.Emit("log", i18n.T("Connected through the %s bootstrap peers", set))
+	}
+}
+
+// verifyPeer shows the short authentication string for the connection to the
+// frontend. In strict mode it waits for the user to confirm that the other
+// device shows the same string before any data is exchanged.
+func (a *App) verifyPeer(ctx context.Context, sas string) bool {
+	strict := a.transferSettings().StrictVerify
+	a.events.Emit("peer_verification", map[string]interface{}{
+		"sas":    sas,
+		"strict": strict,
+	})
+	if !strict {
+		return true
+	}
+
+	answer := make(chan bool, 1)
+	a.nodeMu.Lock()
+	a.peerConfirm = answer
+	a.nodeMu.Unlock()
+
+	select {
+	case ok := <-answer:
+		return ok
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// ConfirmPeer answers a pending strict-mode verification
+func (a *App) ConfirmPeer(matches bool) {
+	a.nodeMu.Lock()
+	answer := a.peerConfirm
+	a.peerConfirm = nil
+	a.nodeMu.Unlock()
+
+	if answer != nil {
+		answer <- matches
+	}
+}
+
+// choosePeer lists the senders found for the same code to the frontend
+// with their verification codes and waits for the user to pick one
+func (a *App) choosePeer(ctx context.Context, node *p2p.Node, code string) func([]peer.AddrInfo) (peer.ID, error) {
+	return func(candidates []peer.AddrInfo) (peer.ID, error) {
+		list := make([]map[string]string, len(candidates))
+		for i, c := range candidates {
+			list[i] = map[string]string{
+				"peerId": c.ID.String(),
+				"sas":    node.ShortAuthString(c.ID, code),
+			}
+		}
+		answer := make(chan string, 1)
+		a.nodeMu.Lock()
+		a.peerChoice = answer
+		a.nodeMu.Unlock()
+		a.events.Emit("duplicate_senders", list)
+
+		select {
+		case id := <-answer:
+			if id == "" {
+				return "", p2p.ErrDuplicatePeers
+			}
+			return peer.Decode(id)
+		case <-ctx.Done():
+			return "", p2p.ErrDuplicatePeers
+		}
+	}
+}
+
+// ChoosePeer answers a pending choice between senders with the same code,
+// an empty peerID aborts the transfer
+func (a *App) ChoosePeer(peerID string) {
+	a.nodeMu.Lock()
+	answer := a.peerChoice
+	a.peerChoice = nil
+	a.nodeMu.Unlock()
+
+	if answer != nil {
+		answer <- peerID
+	}
+}
+
+// transferChoice is the user's answer to an incoming transfer
+type transferChoice struct {
+	accept     bool
+	skip       []string // Deselected manifest paths
+	folderName string   // Replaces the manifest's folder name if set
+}
+
+// awaitTransferConfirmation shows the manifest of an incoming transfer and
+// waits until the user approves or rejects it with AnswerTransferConfirmation
+func (a *App) awaitTransferConfirmation(ctx context.Context, m *transfer.Manifest) transferChoice {
+	answer := make(chan transferChoice, 1)
+	a.nodeMu.Lock()
+	a.transferConfirm = answer
+	a.nodeMu.Unlock()
+
+	types := transfer.ManifestTypes(m)
+	a.events.Emit("transfer_confirmation", map[string]interface{}{
+		"folderName":  m.FolderName,
+		"totalSize":   m.TotalSize,
+		"files":       m.Files,
+		"fingerprint": transfer.Fingerprint(m.Root),
+		"types":       types,
+		"kinds":       transfer.CountKinds(types),
+	})
+	select {
+	case choice := <-answer:
+		return choice
+	case <-ctx.Done():
+		return transferChoice{}
+	}
+}
+
+// selectedFiles returns the files of m not in skip, their types and their
+// total size
+func selectedFiles(m *transfer.Manifest, skip map[string]bool) (files []transfer.FileEntry, types []string, size int64) {
+	files, types = []transfer.FileEntry{}, []string{}
+	for _, f := range m.Files {
+		if !skip[f.Path] {
+			files = append(files, f)
+			types = append(types, transfer.MIMEType(f.Path, nil))
+			size += f.Size
+		}
+	}
+	return files, types, size
+}
+
+// AnswerTransferConfirmation answers a pending incoming transfer. skip lists
+// the files not to receive and folderName renames the destination folder,
+// the sender's name is kept if empty.
+func (a *App) AnswerTransferConfirmation(accept bool, skip []string, folderName string) {
+	a.nodeMu.Lock()
+	answer := a.transferConfirm
+	a.transferConfirm = nil
+	a.nodeMu.Unlock()
+
+	if answer != nil {
+		answer <- transferChoice{accept: accept, skip: skip, folderName: folderName}
+	}
+}
+
+// transferSettings returns the settings with the selected profile applied
+func (a *App) transferSettings() settings.AppSettings {
+	if a.profile == "" {
+		return a.settings
+	}
+	s, err := a.settings.WithProfile(a.profile)
+	if err != nil {
+		return a.settings
+	}
+	return s
+}
+
+// SelectProfile uses the named profile for the following transfers, or
+// none if name is empty. It returns the settings the transfers then use.
+func (a *App) SelectProfile(name string) (settings.AppSettings, error) {
+	if name != "" {
+		if _, err := a.settings.WithProfile(name); err != nil {
+			return a.settings, err
+		}
+	}
+	a.profile = name
+	return a.transferSettings(), nil
+}
+
+// newTransferContext returns a context for a new transfer that CancelTransfer
+// aborts. The caller cancels it once the transfer is over.
+func (a *App) newTransferContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(a.ctx)
+	a.nodeMu.Lock()
+	a.cancelTransfer = cancel
+	a.transferActive = true
+	a.nodeMu.Unlock()
+	return ctx, cancel
+}
+
+// claimTransfer is newTransferContext for transfers that must not replace
+// one in progress. ok is false if a transfer is active, nothing is claimed
+// then.
+func (a *App) claimTransfer() (ctx context.Context, cancel context.CancelFunc, ok bool) {
+	a.nodeMu.Lock()
+	defer a.nodeMu.Unlock()
+	if a.transferActive {
+		return nil, nil, false
+	}
+	ctx, cancel = context.WithCancel(a.ctx)
+	a.cancelTransfer = cancel
+	a.transferActive = true
+	return ctx, cancel, true
+}
+
 func (a *App) CancelTransfer() {
 	a.nodeMu.Lock()
 	node := a.activeNode
 	a.activeNode = nil
+	withdraw := a.withdrawCode
+	a.withdrawCode = nil
+	cancel := a.cancelTransfer
+	a.cancelTransfer = nil
 	a.nodeMu.Unlock()
 
+	if cancel != nil {
+		cancel()
+	}
 	if node != nil {
-		node.Close()
+		if withdraw != nil {
+			// The node outlives the transfer until receivers can learn
+			// that the code is gone
+			go func() {
+				withdraw()
+				node.Close()
+			}()
+		} else {
+			node.Close()
+		}
 	}
+	a.transferEnded()
 }
 
 func (a *App) CopyToClipboard(text string) error {
@@ -221,107 +633,118 @@ func (a *App) GetVersion() string {
 
 // DownloadAndInstallUpdate downloads and installs a new version
 func (a *App) DownloadAndInstallUpdate(releaseVersion string) error {
+	exePath, err := os.Executable()
+	if err != nil {
+		a.events.Emit("update_error", map[string]string{"error": fmt.Sprintf("Failed to get executable path: %v", err)})
+		return err
+	}
+	installation := updater.DetectInstallation(exePath)
+	if err := installation.CanSelfUpdate(); err != nil {
+		a.events.Emit("update_error", map[string]string{"error": err.Error()})
+		return err
+	}
+
 	// Fetch release info
-	release, err := updater.FetchLatestRelease("ebob10000/2c1f")
+	release, err := updater.FetchRelease("ebob10000/2c1f", releaseVersion, a.settings.UpdateChannel)
 	if err != nil {
-		runtime.EventsEmit(a.ctx, "update_error", map[string]string{"error": err.Error()})
+		a.events.Emit("update_error", map[string]string{"error": err.Error()})
 		return err
 	}
 
 	// Find correct asset for platform
 	asset, err := updater.GetAssetForPlatform(release, goruntime.GOOS, goruntime.GOARCH)
 	if err != nil {
-		runtime.EventsEmit(a.ctx, "update_error", map[string]string{"error": err.Error()})
+		a.events.Emit("update_error", map[string]string{"error": err.Error()})
 		return err
 	}
 
 	// Download with progress callback
-	tempPath, err := updater.DownloadUpdate(asset, func(downloaded, total int64) {
+	tempPath, err := updater.DownloadUpdate(asset, a.insecureUpdate, func(downloaded, total int64) {
 		percent := float64(downloaded) / float64(total) * 100
-		runtime.EventsEmit(a.ctx, "update_download_progress", map[string]interface{}{
+		a.events.Emit("update_download_progress", map[string]interface{}{
 			"downloaded": downloaded,
 			"total":      total,
 			"percent":    percent,
 		})
 	})
 	if err != nil {
-		runtime.EventsEmit(a.ctx, "update_error", map[string]string{"error": err.Error()})
+		a.events.Emit("update_error", map[string]string{"error": err.Error()})
 		return err
 	}
 
 	// Notify that download is complete and ready to install
-	runtime.EventsEmit(a.ctx, "update_ready", map[string]string{"version": releaseVersion})
+	a.events.Emit("update_ready", map[string]string{"version": releaseVersion})
 
 	// Replace and restart
-	exePath, err := os.Executable()
-	if err != nil {
-		runtime.EventsEmit(a.ctx, "update_error", map[string]string{"error": fmt.Sprintf("Failed to get executable path: %v", err)})
-		return err
+	if err := updater.RecordUpdate(version.Version, releaseVersion, installation.ExePath); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record update state: %v\n", err)
 	}
 	if err := updater.ReplaceAndRestart(tempPath, exePath); err != nil {
-		runtime.EventsEmit(a.ctx, "update_error", map[string]string{"error": err.Error()})
+		a.events.Emit("update_error", map[string]string{"error": err.Error()})
 		return err
 	}
 
 	return nil
 }
 
-func (a *App) getHistoryPath() string {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		// Fallback to current directory if home dir can't be determined
-		return ".2c1f-history.json"
+func (a *App) loadHistory() {
+	a.transferHistory = history.Prune(history.Load(), a.settings.HistoryRetentionDays, time.Now())
+}
+
+func (a *App) saveHistory() {
+	if err := history.Save(a.transferHistory); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
 	}
-	return filepath.Join(home, ".2c1f-history.json")
 }
 
-func (a *App) loadHistory() {
-	path := a.getHistoryPath()
-	data, err := os.ReadFile(path)
+func (a *App) GetTransferHistory() []history.Record {
+	return a.transferHistory
+}
+
+// GetTransferStats sums up the transfer history for the statistics page
+func (a *App) GetTransferStats() history.Stats {
+	return history.Summarize(a.transferHistory, time.Local)
+}
+
+// GetThumbnail returns a preview of the received image at path, no larger
+// than maxSize pixels, as a data URL. Previews are cached.
+func (a *App) GetThumbnail(path string, maxSize int) (string, error) {
+	data, err := thumbnail.Get(path, maxSize)
 	if err != nil {
-		// File doesn't exist or can't be read - start with empty history
-		return
-	}
-	if err := json.Unmarshal(data, &a.transferHistory); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: failed to parse history file, starting fresh: %v\n", err)
-		a.transferHistory = []TransferRecord{}
+		return "", err
 	}
+	return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(data), nil
 }
 
-func (a *App) saveHistory() {
-	path := a.getHistoryPath()
-	data, err := json.Marshal(a.transferHistory)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: failed to marshal history: %v\n", err)
-		return
+// ResumeFromHistory starts the receive of a failed or cancelled transfer
+// again with its code and folder. Files that arrived are kept and resumed.
+func (a *App) ResumeFromHistory(recordID string) error {
+	record, ok := history.Find(a.transferHistory, recordID)
+	if !ok {
+		return fmt.Errorf("no transfer %s in the history", recordID)
 	}
-	if err := os.WriteFile(path, data, 0600); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: failed to save history: %v\n", err)
+	if !record.Resumable() {
+		return fmt.Errorf("transfer %s cannot be resumed", record.Path)
 	}
+	return a.StartReceiver(record.Code, record.Dest, false, "")
 }
 
-func (a *App) GetTransferHistory() []TransferRecord {
-	return a.transferHistory
+func (a *App) AddTransferRecord(path string, size int64, direction, status string) {
+	a.addRecord(history.NewRecord(path, size, direction, status))
 }
 
-func (a *App) AddTransferRecord(path string, size int64, direction, status string) {
-	record := TransferRecord{
-		Timestamp: time.Now(),
-		Path:      filepath.Base(path),
-		FullPath:  path,
-		Size:      size,
-		Direction: direction,
-		Status:    status,
-	}
-	a.transferHistory = append([]TransferRecord{record}, a.transferHistory...)
-	if len(a.transferHistory) > 50 {
-		a.transferHistory = a.transferHistory[:50]
+// addRecord adds a transfer to the history unless the settings turned it
+// off, dropping transfers older than the retention
+func (a *App) addRecord(record history.Record) {
+	if !a.settings.HistoryEnabled {
+		return
 	}
+	a.transferHistory = history.Prune(history.Prepend(a.transferHistory, record), a.settings.HistoryRetentionDays, time.Now())
 	a.saveHistory()
 }
 
 func (a *App) ClearHistory() {
-	a.transferHistory = []TransferRecord{}
+	a.transferHistory = []history.Record{}
 	a.saveHistory()
 }
 
@@ -349,74 +772,166 @@ func (a *App) SelectSaveDirectory() (string, error) {
 	})
 }
 
-func (a *App) StartSender(path string, compress bool, skipHash bool, cacheManifest bool) (string, error) {
+func (a *App) StartSender(path string, compress bool, skipHash bool, cacheManifest bool, password string) (string, error) {
+	return a.startSender(path, compress, skipHash, cacheManifest, password, time.Time{})
+}
+
+// ScheduleSend prepares and advertises the transfer right away but holds
+// connected receivers until startAt, given as HH:MM or RFC 3339
+func (a *App) ScheduleSend(path, startAt string, compress bool, skipHash bool, cacheManifest bool, password string) (string, error) {
+	start, err := transfer.ParseStartTime(startAt, time.Now())
+	if err != nil {
+		return "", err
+	}
+	return a.startSender(path, compress, skipHash, cacheManifest, password, start)
+}
+
+func (a *App) startSender(path string, compress bool, skipHash bool, cacheManifest bool, password string, startAt time.Time) (string, error) {
 	if isDevMode() {
 		return a.startSimulatedSender(path)
 	}
 
+	ctx, cancel := a.newTransferContext()
+
 	go func() {
-		runtime.EventsEmit(a.ctx, "sender_status", "Initializing...")
+		// Once the stream handler is set, the transfer ends in it
+		serving := false
+		defer func() {
+			if !serving {
+				cancel()
+			}
+		}()
+		a.events.Emit("sender_status", i18n.T("Initializing..."))
 
 		onHashProgress := func(path string, size int64) {
-			runtime.EventsEmit(a.ctx, "hashing_progress", map[string]interface{}{
+			a.events.Emit("hashing_progress", map[string]interface{}{
 				"filename": path,
 				"size":     size,
 			})
 		}
 
-		sender, err := transfer.NewSender(path, cacheManifest, skipHash, onHashProgress)
+		opts := a.transferSettings()
+		sender, err := transfer.NewSenderLimited(ctx, path, cacheManifest, skipHash, transfer.SourceLimit(path, opts.SourceLimit), onHashProgress)
 		if err != nil {
-			runtime.EventsEmit(a.ctx, "error", fmt.Sprintf("Failed to prepare files: %v", err))
+			if transfer.CategoryOf(err) == transfer.CategoryCancelled {
+				return
+			}
+			a.events.Emit("error", i18n.T("Failed to prepare files: %v", err))
 			return
 		}
 		sender.Compress = compress
+		sender.CompressLevel = opts.CompressLevel
+		sender.Timeout = time.Duration(opts.Timeout) * time.Second
+		sender.StartAt = startAt
+		// An explicit choice overrides the automatic one
+		autoCompress := !compress && opts.AutoCompress
+		if !startAt.IsZero() {
+			a.events.Emit("log", i18n.T("Transfer scheduled for %s", startAt.Format("2006-01-02 15:04")))
+		}
+		for _, warning := range transfer.PortabilityWarnings(sender.Manifest) {
+			a.events.Emit("log", i18n.T("Warning: %s", warning))
+		}
 
-		runtime.EventsEmit(a.ctx, "transfer_manifest", map[string]interface{}{
-			"folderName": sender.Manifest.FolderName,
-			"files":      sender.Manifest.Files,
-			"totalSize":  sender.Manifest.TotalSize,
+		types := sender.FileTypes()
+		a.events.Emit("transfer_manifest", map[string]interface{}{
+			"folderName":  sender.Manifest.FolderName,
+			"files":       sender.Manifest.Files,
+			"totalSize":   sender.Manifest.TotalSize,
+			"fingerprint": transfer.Fingerprint(sender.Manifest.MerkleRoot()),
+			"types":       types,
+			"kinds":       transfer.CountKinds(types),
 		})
 
 		code, err := words.Generate()
 		if err != nil {
-			runtime.EventsEmit(a.ctx, "error", fmt.Sprintf("Failed to generate code: %v", err))
+			a.events.Emit("error", i18n.T("Failed to generate code: %v", err))
 			return
 		}
 		sender.Code = code
+		sender.Password = password
 
-		runtime.EventsEmit(a.ctx, "sender_ready", code)
+		a.events.Emit("sender_ready", code)
 
 		// Setup progress tracking
-		progress := newProgressTracker(a.ctx, sender.Manifest.TotalSize)
+		progress := newProgressTracker(a.events, sender.Manifest.TotalSize)
 		sender.OnStartFile = progress.onStartFile
 		sender.OnProgress = progress.onProgress
+		sender.OnFileComplete = progress.onFileComplete
+
+		// ended records a transfer that did not finish, after sent bytes,
+		// and runs the OnComplete command
+		ended := func(peerID peer.ID, sent int64, err error) {
+			if err != nil {
+				record := history.NewRecord(path, sender.Manifest.TotalSize, "send", history.FailureStatus(err))
+				record.Transferred = sent
+				record.Code = code
+				record.Peer = peerID.String()
+				a.addRecord(record)
+			}
+			a.runHook(opts.OnComplete, "send", path, sender.Manifest.TotalSize, peerID, err)
+		}
 
-		runtime.EventsEmit(a.ctx, "sender_status", "Starting P2P node...")
+		a.events.Emit("sender_status", i18n.T("Starting P2P node..."))
+		a.emitStage(p2p.StageStarting)
 
-		node, err := p2p.NewNode(a.ctx)
+		// CancelTransfer closes the node, after withdrawing the code if it
+		// was advertised
+		node, err := p2p.NewNodeWithConfig(a.ctx, a.nodeConfig(true))
 		if err != nil {
-			runtime.EventsEmit(a.ctx, "error", fmt.Sprintf("Failed to start p2p node: %v", err))
+			a.events.Emit("error", i18n.T("Failed to start p2p node: %v", err))
 			return
 		}
+		a.configureNode(node)
+		if a.settings.LanVisible {
+			node.OfferLocally(a.deviceName(), code)
+		}
+		node.SetProbeCode(code)
+		node.OnProbe = func(_ peer.ID, probe p2p.Probe) {
+			a.events.Emit("link_probe", probe)
+		}
+		a.watchConnections(node)
+		if err := node.WatchAddrs(func(addrs []string) {
+			a.events.Emit("sender_addresses", addrs)
+		}); err != nil {
+			a.events.Emit("log", i18n.T("Warning: %s", err))
+		}
 
 		a.nodeMu.Lock()
 		a.activeNode = node
 		a.nodeMu.Unlock()
 
 		go func() {
-			runtime.EventsEmit(a.ctx, "log", "Bootstrapping network...")
-			if err := node.Bootstrap(); err != nil {
-				runtime.EventsEmit(a.ctx, "error", fmt.Sprintf("Bootstrap failed: %v", err))
+			a.events.Emit("log", i18n.T("Bootstrapping network..."))
+			// Receivers only find the code once it is advertised, so the
+			// frontend waits for the ready stage before showing it
+			if err := node.Announce(code, func(stage string) {
+				if stage == p2p.StageAdvertising {
+					a.events.Emit("log", i18n.T("Network ready. Advertising code..."))
+					a.nodeMu.Lock()
+					if a.activeNode == node {
+						a.withdrawCode = func() {
+							sender.Withdraw()
+							node.Withdraw(code)
+						}
+					}
+					a.nodeMu.Unlock()
+				}
+				a.emitStage(stage)
+			}); err != nil {
+				if ctx.Err() == nil {
+					a.events.Emit("error", i18n.T("Bootstrap failed: %v", err))
+				}
 				return
 			}
-			runtime.EventsEmit(a.ctx, "log", "Network ready. Advertising code...")
+			a.events.Emit("sender_status", i18n.T("Waiting for connection..."))
 
 			ticker := time.NewTicker(30 * time.Second)
 			defer ticker.Stop()
-			node.Advertise(code)
 
 			for {
 				select {
+				case <-ctx.Done():
+					return
 				case <-node.Ctx.Done():
 					return
 				case <-ticker.C:
@@ -425,170 +940,429 @@ func (a *App) StartSender(path string, compress bool, skipHash bool, cacheManife
 			}
 		}()
 
-		runtime.EventsEmit(a.ctx, "sender_status", "Waiting for connection...")
-
+		// Streams are handled concurrently, one confirmation at a time
+		serving = true
+		var verifyMu sync.Mutex
+		var verifiedPeer peer.ID
 		node.SetStreamHandler(func(stream network.Stream) {
 			defer stream.Close()
+
+			// The receiver reconnects on interruptions and when migrating from a
+			// relayed to a direct connection, so keep the node alive in that case
+			keepNode := false
 			defer func() {
+				if keepNode {
+					return
+				}
 				a.nodeMu.Lock()
 				cleanupNode := a.activeNode
 				a.activeNode = nil
+				a.withdrawCode = nil
 				a.nodeMu.Unlock()
 
+				cancel()
 				if cleanupNode != nil {
 					cleanupNode.Close()
 				}
 			}()
 
 			peerID := stream.Conn().RemotePeer()
-			runtime.EventsEmit(a.ctx, "log", fmt.Sprintf("Peer connected: %s", peerID.String()[:12]))
+			a.events.Emit("log", i18n.T("Peer connected: %s", peerID.String()[:12]))
+
+			// The receiver measured the link before opening the stream
+			streamOpts := transfer.StreamOptions{
+				Compress: sender.Compress,
+				DataStream: func(ctx context.Context, token []byte) (io.ReadWriteCloser, error) {
+					return node.AcceptDataStream(ctx, peerID, token)
+				},
+			}
+			if autoCompress {
+				if probe, ok := node.PeerProbe(peerID); ok {
+					var reason string
+					streamOpts.Compress, reason = transfer.AutoCompress(sender.Manifest, probe.Throughput)
+					a.events.Emit("log", reason)
+				}
+			}
 
-			err := sender.Handshake(stream)
+			err := sender.HandshakeWith(stream, streamOpts)
+			if errors.Is(err, transfer.ErrTooManyHandshakes) {
+				// Others are still in the handshake, one of them may be the receiver
+				keepNode = true
+				stream.Reset()
+				return
+			}
 			if err != nil {
-				runtime.EventsEmit(a.ctx, "error", fmt.Sprintf("Handshake failed: %v", err))
+				a.emitTransferError(i18n.T("Handshake failed"), err)
+				stream.Reset()
 				return
 			}
 
-			if sender.Compress {
-				compressed, err := transfer.NewCompressedStream(stream)
+			verifyMu.Lock()
+			verified := peerID == verifiedPeer || a.verifyPeer(ctx, node.ShortAuthString(peerID, code))
+			if verified {
+				verifiedPeer = peerID
+			}
+			verifyMu.Unlock()
+			if !verified {
+				transfer.WriteMessage(stream, &transfer.Message{Type: transfer.MsgError, Payload: []byte("Verification rejected by sender")})
+				a.events.Emit("error", i18n.T("Verification codes did not match. Connection rejected."))
+				return
+			}
+
+			started := time.Now()
+
+			var dataStream io.ReadWriter = stream
+			if streamOpts.Compress {
+				compressed, err := transfer.NewCompressedStreamLevel(stream, sender.CompressLevel)
 				if err != nil {
-					runtime.EventsEmit(a.ctx, "error", fmt.Sprintf("Compression init failed: %v", err))
+					a.emitTransferError(i18n.T("Compression init failed"), err)
+					ended(peerID, 0, err)
 					return
 				}
 				defer compressed.Close()
-				if err := sender.Send(compressed); err != nil {
-					runtime.EventsEmit(a.ctx, "error", fmt.Sprintf("Transfer failed: %v", err))
+				dataStream = compressed
+			}
+
+			delivery, err := sender.SendWith(ctx, dataStream, streamOpts)
+			if err != nil {
+				if transfer.CategoryOf(err) == transfer.CategoryCancelled {
+					ended(peerID, delivery.Sent(), err)
 					return
 				}
-			} else {
-				if err := sender.Send(stream); err != nil {
-					runtime.EventsEmit(a.ctx, "error", fmt.Sprintf("Transfer failed: %v", err))
+				if transfer.IsRetryableError(err) {
+					a.events.Emit("log", i18n.T("Connection interrupted: %v. Waiting for receiver to reconnect...", err))
+					keepNode = true
 					return
 				}
+				a.emitTransferError(i18n.T("Transfer failed"), err)
+				ended(peerID, delivery.Sent(), err)
+				return
 			}
 
-			runtime.EventsEmit(a.ctx, "transfer_complete", "Sent successfully")
-			a.AddTransferRecord(path, sender.Manifest.TotalSize, "send", "complete")
+			a.emitComplete("Sent successfully", delivery.Summary())
+			ended(peerID, delivery.Sent(), nil)
+			record := history.NewRecord(path, sender.Manifest.TotalSize, "send", history.SendStatus(delivery.Confirmed))
+			record.SetCompression(delivery.Compression)
+			record.Root = delivery.Root()
+			record.Peer = peerID.String()
+			record.Duration = time.Since(started)
+			if !delivery.Confirmed {
+				a.events.Emit("log", i18n.T("Receiver did not confirm the transfer"))
+			}
+			if receipt := delivery.Receipt; receipt != nil {
+				if receipt.PeerID == peerID.String() {
+					record.Receipt = receipt
+					a.events.Emit("log", i18n.T("Delivery receipt verified"))
+				} else {
+					a.events.Emit("log", i18n.T("Ignoring receipt signed by a different peer"))
+				}
+			}
+			a.addRecord(record)
 		})
 	}()
 
 	return "", nil
 }
 
-func (a *App) StartReceiver(code, destPath string, fastResume bool) error {
+func (a *App) StartReceiver(code, destPath string, fastResume bool, password string) error {
 	if isDevMode() {
 		return a.startSimulatedReceiver(code, destPath)
 	}
+	ctx, cancel := a.newTransferContext()
+
 	receiver := transfer.NewReceiver(destPath)
 	receiver.Code = code
+	receiver.Password = password
 	receiver.FastResume = fastResume
+	receiver.RenameExisting = true
+	opts := a.transferSettings()
+	receiver.Timeout = time.Duration(opts.Timeout) * time.Second
+	receiver.Quarantine = !opts.NoQuarantine
+	if opts.ScanCommand != "" {
+		// The GUI matches the result to the file by its localPath
+		receiver.Scan = func(path string) error {
+			a.events.Emit("transfer_file_scan", map[string]interface{}{"localPath": path, "status": "scanning"})
+			err := hooks.Scan(ctx, opts.ScanCommand, path)
+			data := map[string]interface{}{"localPath": path, "status": "clean"}
+			if err != nil {
+				data["status"] = "rejected"
+				data["error"] = err.Error()
+			}
+			a.events.Emit("transfer_file_scan", data)
+			return err
+		}
+		if opts.KeepRejected {
+			receiver.RejectedDir = hooks.RejectedDir()
+		}
+	}
 
 	// Progress will be initialized after manifest is received
 	var progress *progressTracker
+	var monitor *p2p.Monitor
+
+	var waitingUntil time.Time
+	receiver.OnWait = func(until time.Time) {
+		if !until.Equal(waitingUntil) {
+			waitingUntil = until
+			a.events.Emit("transfer_waiting", until.Format(time.RFC3339))
+			a.events.Emit("log", i18n.T("Sender scheduled the transfer for %s", until.Local().Format("2006-01-02 15:04")))
+		}
+	}
 
+	confirmed := false
 	receiver.OnConfirmation = func(m *transfer.Manifest) bool {
-		// Initialize progress tracking with manifest total size
-		progress = newProgressTracker(a.ctx, m.TotalSize)
+		// Reconnections continue with the user's first answer
+		if !confirmed {
+			choice := a.awaitTransferConfirmation(ctx, m)
+			if !choice.accept {
+				return false
+			}
+			confirmed = true
+			receiver.FolderName = choice.folderName
+			receiver.Skip = make(map[string]bool, len(choice.skip))
+			for _, path := range choice.skip {
+				receiver.Skip[path] = true
+			}
+		}
+
+		files, types, totalSize := selectedFiles(m, receiver.Skip)
+
+		// Initialize progress tracking with the size of the selected files
+		progress = newProgressTracker(a.events, totalSize)
+		progress.monitor = monitor
 		receiver.OnStartFile = progress.onStartFile
 		receiver.OnProgress = progress.onProgress
-		runtime.EventsEmit(a.ctx, "transfer_manifest", map[string]interface{}{
-			"folderName": m.FolderName,
-			"totalSize":  m.TotalSize,
-			"fileCount":  len(m.Files),
-			"files":      m.Files,
+		progress.localPath = receiver.LocalPath
+		receiver.OnFileComplete = progress.onFileComplete
+		a.events.Emit("transfer_manifest", map[string]interface{}{
+			"folderName":  filepath.Base(receiver.LocalFolder()),
+			"totalSize":   totalSize,
+			"fileCount":   len(files),
+			"files":       files,
+			"fingerprint": transfer.Fingerprint(m.Root),
+			"types":       types,
+			"kinds":       transfer.CountKinds(types),
 		})
 		return true
 	}
 
 	go func() {
-		node, err := p2p.NewNode(a.ctx)
+		defer cancel()
+		node, err := p2p.NewNodeWithConfig(ctx, a.nodeConfig(true))
 		if err != nil {
-			runtime.EventsEmit(a.ctx, "error", fmt.Sprintf("Failed to start node: %v", err))
+			a.events.Emit("error", i18n.T("Failed to start node: %v", err))
 			return
 		}
 		defer node.Close()
+		a.configureNode(node)
+		a.watchConnections(node)
+		node.ChoosePeer = a.choosePeer(ctx, node, code)
+		receiver.Identity = node.PrivateKey()
 
-		runtime.EventsEmit(a.ctx, "log", "Bootstrapping...")
+		a.events.Emit("log", i18n.T("Bootstrapping..."))
 		if err := node.Bootstrap(); err != nil {
-			runtime.EventsEmit(a.ctx, "error", fmt.Sprintf("Bootstrap failed: %v", err))
+			a.events.Emit("error", i18n.T("Bootstrap failed: %v", err))
 			return
 		}
 
-		runtime.EventsEmit(a.ctx, "log", "Finding peer...")
+		a.events.Emit("log", i18n.T("Finding peer..."))
 
 		var peerID peer.ID
+		// ended records a transfer that did not finish, so it can be
+		// resumed from the history, and runs the OnComplete command
+		ended := func(err error) {
+			if err != nil {
+				record := history.NewRecord(receiver.LocalFolder(), receivedSize(receiver), "receive", history.FailureStatus(err))
+				record.Transferred = receiver.Received()
+				record.Code = code
+				record.Peer = peerID.String()
+				record.Dest = destPath
+				a.addRecord(record)
+			}
+			a.runHook(opts.OnComplete, "receive", receiver.LocalFolder(), receivedSize(receiver), peerID, err)
+		}
 		for i := 0; i < 60; i++ {
+			if ctx.Err() != nil {
+				return
+			}
 			p, err := node.FindPeer(code)
 			if err == nil {
 				peerID = p
 				break
 			}
+			if errors.Is(err, p2p.ErrWithdrawn) {
+				a.events.Emit("error", i18n.T("The sender cancelled this transfer."))
+				return
+			}
+			if errors.Is(err, p2p.ErrDuplicatePeers) {
+				if ctx.Err() == nil {
+					a.events.Emit("error", i18n.T("More than one sender uses this code. Ask for a new one."))
+				}
+				return
+			}
 			if i < 59 {
 				if i%2 == 0 {
-					runtime.EventsEmit(a.ctx, "log", fmt.Sprintf("Searching for sender... (%ds)", (i+1)/2))
+					a.events.Emit("log", i18n.T("Searching for sender... (%ds)", (i+1)/2))
 				}
-				time.Sleep(500 * time.Millisecond)
+				sleepContext(ctx, 500*time.Millisecond)
 			}
 		}
 
+		if ctx.Err() != nil {
+			return
+		}
 		if peerID == "" {
-			runtime.EventsEmit(a.ctx, "error", "Peer not found. Make sure the sender is online and the code is correct.")
+			a.events.Emit("error", i18n.T("Peer not found. Make sure the sender is online and the code is correct."))
 			return
 		}
 
-		runtime.EventsEmit(a.ctx, "log", "Connecting...")
+		if !a.verifyPeer(ctx, node.ShortAuthString(peerID, code)) {
+			if ctx.Err() == nil {
+				a.events.Emit("error", i18n.T("Verification codes did not match. Transfer aborted."))
+			}
+			return
+		}
+		verifiedPeer := peerID
+
+		a.events.Emit("log", i18n.T("Connecting..."))
+
+		monitor = node.NewMonitor(peerID)
+		monitor.OnUpdate = func(q p2p.ConnQuality) {
+			a.events.Emit("connection_quality", q)
+		}
+		monitor.OnMigrate = func() {
+			a.events.Emit("log", i18n.T("Direct connection established, migrating transfer..."))
+		}
+		monitor.Start()
+		defer monitor.Stop()
+
+		// The estimate is shown with the files to confirm. Older senders do
+		// not answer probes.
+		if probe, err := node.ProbeThroughput(ctx, peerID, code); err == nil {
+			a.events.Emit("link_probe", probe)
+		}
+
+		receiver.DataStream = func(ctx context.Context, token []byte) (io.ReadWriteCloser, error) {
+			s, err := node.NewDataStream(ctx, peerID, token)
+			if err != nil {
+				return nil, err
+			}
+			monitor.Track(s)
+			return s, nil
+		}
 
-		maxRetries := 5
+		maxRetries := opts.Retries
 		var lastErr error
+		migrating := false
+		started := time.Now()
 
 		for attempt := 0; attempt <= maxRetries; attempt++ {
-			if attempt > 0 {
-				runtime.EventsEmit(a.ctx, "log", fmt.Sprintf("Retrying transfer (attempt %d/%d)...", attempt, maxRetries))
+			if migrating {
+				migrating = false
+			} else if attempt > 0 {
+				a.events.Emit("log", i18n.T("Retrying transfer (attempt %d/%d)...", attempt, maxRetries))
 				p, err := node.FindPeer(code)
+				if errors.Is(err, p2p.ErrWithdrawn) {
+					lastErr = err
+					break
+				}
 				if err != nil {
 					lastErr = fmt.Errorf("failed to find peer during retry: %w", err)
-					time.Sleep(2 * time.Second)
+					if !sleepContext(ctx, 2*time.Second) {
+						return
+					}
 					continue
 				}
 				peerID = p
+				if peerID != verifiedPeer {
+					if !a.verifyPeer(ctx, node.ShortAuthString(peerID, code)) {
+						if ctx.Err() == nil {
+							a.events.Emit("error", i18n.T("Verification codes did not match. Transfer aborted."))
+						}
+						return
+					}
+					verifiedPeer = peerID
+				}
 			}
 
 			stream, err := node.NewStream(peerID)
 			if err != nil {
 				lastErr = fmt.Errorf("connection failed: %w", err)
 				if attempt < maxRetries {
-					time.Sleep(2 * time.Second)
+					if !sleepContext(ctx, 2*time.Second) {
+						return
+					}
 					continue
 				}
 				break
 			}
 
-			err = receiver.Receive(stream)
+			monitor.Track(stream)
+			err = receiver.Receive(ctx, stream)
 			stream.Close()
 
+			if transfer.CategoryOf(err) == transfer.CategoryCancelled {
+				a.events.Emit("log", i18n.T("Transfer cancelled"))
+				ended(err)
+				return
+			}
+
 			if err == nil {
-				runtime.EventsEmit(a.ctx, "transfer_complete", filepath.Join(destPath, receiver.Manifest.FolderName))
-				a.AddTransferRecord(receiver.Manifest.FolderName, receiver.Manifest.TotalSize, "receive", "complete")
+				for name, local := range receiver.Renamed {
+					a.events.Emit("log", i18n.T("Saved %s as %s, the name is not valid on this system", name, local))
+				}
+				if receiver.Verified {
+					a.events.Emit("log", i18n.T("Fingerprint verified: %s", transfer.Fingerprint(receiver.Manifest.Root)))
+				}
+				a.emitComplete(receiver.LocalFolder(), receiver.Summary())
+				status := history.StatusComplete
+				if len(receiver.Skip) > 0 {
+					status = history.StatusPartial
+				}
+				record := history.NewRecord(receiver.Manifest.FolderName, receiver.Manifest.TotalSize, "receive", status)
+				record.SetCompression(receiver.Compression)
+				record.Root = receiver.Root()
+				record.Peer = peerID.String()
+				record.Duration = time.Since(started)
+				a.addRecord(record)
+				ended(nil)
 				return
 			}
 
 			lastErr = err
+			if monitor.TakeMigration() {
+				migrating = true
+				attempt--
+				continue
+			}
 			if !transfer.IsRetryableError(err) {
 				break
 			}
 
-			time.Sleep(time.Duration(1<<attempt) * time.Second)
+			if !sleepContext(ctx, time.Duration(1<<attempt)*time.Second) {
+				ended(ctx.Err())
+				return
+			}
 		}
 
-		runtime.EventsEmit(a.ctx, "error", fmt.Sprintf("Receive failed after retries: %v", lastErr))
+		a.emitTransferError(i18n.T("Receive failed after retries"), lastErr)
+		ended(lastErr)
 	}()
 
 	return nil
 }
 
+// receivedSize returns the size of the transfer, 0 before the manifest arrived
+func receivedSize(r *transfer.Receiver) int64 {
+	if r.Manifest == nil {
+		return 0
+	}
+	return r.Manifest.TotalSize
+}
+
 func (a *App) startSimulatedSender(path string) (string, error) {
 	go func() {
-		runtime.EventsEmit(a.ctx, "sender_status", "Initializing Simulation...")
+		a.events.Emit("sender_status", i18n.T("Initializing Simulation..."))
 		time.Sleep(1 * time.Second)
 
 		// Fake Manifest
@@ -598,18 +1372,19 @@ func (a *App) startSimulatedSender(path string) (string, error) {
 		}
 		var totalSize int64 = 505 * 1024 * 1024
 
-		runtime.EventsEmit(a.ctx, "transfer_manifest", map[string]interface{}{
+		a.events.Emit("transfer_manifest", map[string]interface{}{
 			"folderName": "Simulation Transfer",
 			"files":      fakeFiles,
 			"totalSize":  totalSize,
 		})
 
 		code := "DEV-SIM-123"
-		runtime.EventsEmit(a.ctx, "sender_ready", code)
-		runtime.EventsEmit(a.ctx, "sender_status", "Waiting for connection (Simulation)...")
+		a.events.Emit("sender_ready", code)
+		a.emitStage(p2p.StageReady)
+		a.events.Emit("sender_status", i18n.T("Waiting for connection (Simulation)..."))
 
 		time.Sleep(2 * time.Second)
-		runtime.EventsEmit(a.ctx, "log", "Peer connected: SIMULATOR")
+		a.events.Emit("log", i18n.T("Peer connected: SIMULATOR"))
 
 		a.simulateFileTransfer(fakeFiles, totalSize, "send", true)
 	}()
@@ -618,11 +1393,11 @@ func (a *App) startSimulatedSender(path string) (string, error) {
 
 func (a *App) startSimulatedReceiver(code, destPath string) error {
 	go func() {
-		runtime.EventsEmit(a.ctx, "log", "Bootstrapping Simulation...")
+		a.events.Emit("log", i18n.T("Bootstrapping Simulation..."))
 		time.Sleep(1 * time.Second)
-		runtime.EventsEmit(a.ctx, "log", "Finding peer...")
+		a.events.Emit("log", i18n.T("Finding peer..."))
 		time.Sleep(1 * time.Second)
-		runtime.EventsEmit(a.ctx, "log", "Connecting...")
+		a.events.Emit("log", i18n.T("Connecting..."))
 		time.Sleep(1 * time.Second)
 
 		// Fake Manifest
@@ -632,7 +1407,7 @@ func (a *App) startSimulatedReceiver(code, destPath string) error {
 		}
 		var totalSize int64 = 505 * 1024 * 1024
 
-		runtime.EventsEmit(a.ctx, "transfer_manifest", map[string]interface{}{
+		a.events.Emit("transfer_manifest", map[string]interface{}{
 			"folderName": "Simulation Transfer",
 			"totalSize":  totalSize,
 			"fileCount":  len(fakeFiles),
@@ -641,7 +1416,7 @@ func (a *App) startSimulatedReceiver(code, destPath string) error {
 
 		if a.simulateFileTransfer(fakeFiles, totalSize, "receive", false) {
 			// Transfer completed successfully
-			runtime.EventsEmit(a.ctx, "transfer_complete", filepath.Join(destPath, "Simulation Transfer"))
+			a.emitComplete(filepath.Join(destPath, "Simulation Transfer"), transfer.Summary{})
 		}
 	}()
 	return nil
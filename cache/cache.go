@@ -0,0 +1,228 @@
+// Package cache keeps the cache folder, see paths.CacheDir, within a size:
+// the block store of received files, cached manifests of sent folders and
+// image previews. All of it is rebuilt when needed.
+package cache
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ebob10000/2c1f/paths"
+)
+
+// staleAfter is when files left behind by an interrupted write, whose names
+// start with a dot, are removed
+const staleAfter = time.Hour
+
+// claimsDir is the folder of the cache with the files each transfer claimed,
+// which are not trimmed until the transfer releases them. Claims of a
+// transfer that ended without releasing them go after claimExpiry.
+const claimsDir = "claims"
+
+const claimExpiry = 24 * time.Hour
+
+// Folder is the usage of a folder of the cache, such as "blocks"
+type Folder struct {
+	Name  string `json:"name"`
+	Files int    `json:"files"`
+	Size  int64  `json:"size"`
+}
+
+// Result is what Trim or Clear removed
+type Result struct {
+	Files int   `json:"files"`
+	Freed int64 `json:"freed"`
+}
+
+type cached struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// Usage returns the usage of each folder of the cache, by name
+func Usage() ([]Folder, error) {
+	return usageOf(paths.CacheDir())
+}
+
+// Trim removes the files least recently stored or used until the cache
+// holds at most maxSize bytes, and files left by interrupted writes. Only
+// those are removed if maxSize is zero or less.
+func Trim(maxSize int64) (Result, error) {
+	return trimDir(paths.CacheDir(), maxSize, time.Now())
+}
+
+// Clear removes everything in the cache
+func Clear() (Result, error) {
+	return trimDir(paths.CacheDir(), 0, time.Time{})
+}
+
+// Claim keeps files in the cache from being trimmed or cleared, also by
+// other processes, until release is called. Files outside the cache are
+// never trimmed and not claimed.
+func Claim(files []string) (release func(), err error) {
+	dir := paths.CacheDir()
+	var inCache []string
+	for _, p := range files {
+		if rel, err := filepath.Rel(dir, p); dir != "" && err == nil && filepath.IsLocal(rel) {
+			inCache = append(inCache, p)
+		}
+	}
+	if len(inCache) == 0 {
+		return func() {}, nil
+	}
+	return claimIn(dir, inCache)
+}
+
+func usageOf(dir string) ([]Folder, error) {
+	files, err := walk(dir)
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string]int)
+	var folders []Folder
+	for _, f := range files {
+		rel, _ := filepath.Rel(dir, f.path)
+		name, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+		i, ok := index[name]
+		if !ok {
+			i = len(folders)
+			index[name] = i
+			folders = append(folders, Folder{Name: name})
+		}
+		folders[i].Files++
+		folders[i].Size += f.size
+	}
+	sort.Slice(folders, func(i, j int) bool { return folders[i].Name < folders[j].Name })
+	return folders, nil
+}
+
+// claimIn records the claim of files in the cache in dir
+func claimIn(dir string, files []string) (release func(), err error) {
+	if err := os.MkdirAll(filepath.Join(dir, claimsDir), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(filepath.Join(dir, claimsDir), "claim-*")
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	for _, p := range files {
+		w.WriteString(filepath.Clean(p) + "\n")
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return func() { os.Remove(f.Name()) }, nil
+}
+
+// claimedIn returns the files claimed in the cache in dir, removing claims
+// older than claimExpiry
+func claimedIn(dir string, now time.Time) map[string]bool {
+	entries, _ := os.ReadDir(filepath.Join(dir, claimsDir))
+	claimed := make(map[string]bool)
+	for _, e := range entries {
+		p := filepath.Join(dir, claimsDir, e.Name())
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if !now.IsZero() && now.Sub(info.ModTime()) > claimExpiry {
+			os.Remove(p)
+			continue
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line != "" {
+				claimed[line] = true
+			}
+		}
+	}
+	return claimed
+}
+
+// trimDir trims the cache in dir like Trim. With a zero now everything is
+// removed but claimed files.
+func trimDir(dir string, maxSize int64, now time.Time) (Result, error) {
+	files, err := walk(dir)
+	if err != nil {
+		return Result{}, err
+	}
+	// Read after the walk, so files claimed before they were listed are kept
+	claimed := claimedIn(dir, now)
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	var result Result
+	remove := func(f cached) {
+		if err := os.Remove(f.path); err == nil {
+			result.Files++
+			result.Freed += f.size
+			total -= f.size
+		}
+	}
+	var kept []cached
+	for _, f := range files {
+		if claimed[filepath.Clean(f.path)] {
+			continue
+		}
+		if now.IsZero() || (strings.HasPrefix(filepath.Base(f.path), ".") && now.Sub(f.modTime) > staleAfter) {
+			remove(f)
+		} else {
+			kept = append(kept, f)
+		}
+	}
+	for _, f := range kept {
+		if maxSize <= 0 || total <= maxSize {
+			break
+		}
+		remove(f)
+	}
+	return result, nil
+}
+
+// walk returns the files in dir but the claims, none if it does not exist
+func walk(dir string) ([]cached, error) {
+	var files []cached
+	if dir == "" {
+		return nil, nil
+	}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == dir && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() && p == filepath.Join(dir, claimsDir) {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, cached{path: p, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	return files, err
+}
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeCached(t *testing.T, dir, name string, size int, age time.Duration) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, make([]byte, size), 0600); err != nil {
+		t.Fatal(err)
+	}
+	mod := time.Now().Add(-age)
+	if err := os.Chtimes(p, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestTrim(t *testing.T) {
+	dir := t.TempDir()
+	oldest := writeCached(t, dir, "blocks/ab/old", 100, 3*time.Hour)
+	older := writeCached(t, dir, "manifests/a.json", 100, 2*time.Hour)
+	recent := writeCached(t, dir, "thumbnails/b.jpg", 100, time.Minute)
+	stale := writeCached(t, dir, "blocks/ab/.block-1", 10, 2*time.Hour)
+	writing := writeCached(t, dir, "blocks/cd/.block-2", 10, time.Minute)
+
+	folders, err := usageOf(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(folders) != 3 || folders[0] != (Folder{Name: "blocks", Files: 3, Size: 120}) {
+		t.Errorf("usageOf() = %+v", folders)
+	}
+
+	// Without a size only leftovers of interrupted writes go
+	result, err := trimDir(dir, 0, time.Now())
+	if err != nil || result != (Result{Files: 1, Freed: 10}) {
+		t.Fatalf("trimDir() without a size = %+v, %v", result, err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("stale temporary file kept")
+	}
+
+	result, err = trimDir(dir, 150, time.Now())
+	if err != nil || result != (Result{Files: 2, Freed: 200}) {
+		t.Fatalf("trimDir() = %+v, %v", result, err)
+	}
+	for _, p := range []string{oldest, older} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s kept, want the oldest files removed", p)
+		}
+	}
+	for _, p := range []string{recent, writing} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("%s removed, want it kept: %v", p, err)
+		}
+	}
+
+	if result, err := trimDir(dir, 0, time.Time{}); err != nil || result.Files != 2 {
+		t.Errorf("clearing = %+v, %v", result, err)
+	}
+}
+
+func TestTrimMissing(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "missing")
+	if result, err := trimDir(dir, 1, time.Now()); err != nil || result.Files != 0 {
+		t.Errorf("trimDir() of a missing folder = %+v, %v", result, err)
+	}
+	if folders, err := usageOf(dir); err != nil || len(folders) != 0 {
+		t.Errorf("usageOf() of a missing folder = %+v, %v", folders, err)
+	}
+}
+
+func TestTrimClaimed(t *testing.T) {
+	dir := t.TempDir()
+	claimed := writeCached(t, dir, "blocks/ab/claimed", 100, 3*time.Hour)
+	other := writeCached(t, dir, "blocks/cd/other", 100, 2*time.Hour)
+
+	release, err := claimIn(dir, []string{claimed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, err := trimDir(dir, 100, time.Now()); err != nil || result != (Result{Files: 1, Freed: 100}) {
+		t.Fatalf("trimDir() = %+v, %v", result, err)
+	}
+	if _, err := os.Stat(claimed); err != nil {
+		t.Errorf("claimed file removed: %v", err)
+	}
+	if _, err := os.Stat(other); !os.IsNotExist(err) {
+		t.Error("unclaimed file kept")
+	}
+	if result, err := trimDir(dir, 0, time.Time{}); err != nil || result.Files != 0 {
+		t.Errorf("clearing with a claim = %+v, %v", result, err)
+	}
+
+	// Claims of transfers that did not release them expire
+	if _, err := trimDir(dir, 0, time.Now().Add(claimExpiry+time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, claimsDir)); len(entries) != 0 {
+		t.Errorf("%d expired claims kept", len(entries))
+	}
+
+	release()
+	if result, err := trimDir(dir, 0, time.Time{}); err != nil || result.Files != 1 {
+		t.Errorf("clearing after the release = %+v, %v", result, err)
+	}
+}
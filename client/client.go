@@ -0,0 +1,319 @@
+// Package client embeds 2c1f transfers in other Go programs.
+//
+// Send and Receive start a transfer in the background and report its progress
+// on an event channel. The channel must be drained until it is closed; the
+// last event is always EventComplete or EventError. Cancel ctx to abort.
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ebob10000/2c1f/p2p"
+	"github.com/ebob10000/2c1f/transfer"
+	"github.com/ebob10000/2c1f/words"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Code is the connection code the receiver needs
+type Code string
+
+// Options configure a transfer. The zero value uses the defaults.
+type Options struct {
+	Compress         bool            // Send only
+	CompressLevel    int             // Send only, gzip level from 1 to 9, transfer.DefaultCompressLevel if zero
+	SkipHash         bool            // Send only, faster start but no integrity check
+	CacheManifest    bool            // Send only
+	Expires          time.Duration   // Send only, receivers are refused after this long, never if zero
+	FastResume       bool            // Receive only, trust partial files without hashing
+	RenameExisting   bool            // Receive only, save as "Name (2)" if the folder exists with other files in it
+	Limits           transfer.Limits // Receive only, manifests with more files or data are refused
+	Password         string          // Optional password both sides must know
+	Timeout          time.Duration   // Stream inactivity timeout, transfer.StreamTimeout if zero
+	BootstrapTimeout time.Duration   // p2p.DefaultBootstrapTimeout if zero
+	FindTimeout      time.Duration   // Receive only, p2p.DefaultFindTimeout if zero
+	Retries          int             // Receive only, reconnection attempts, transfer.MaxRetries if zero
+	Listen           []string        // IP addresses, interface names or multiaddrs to listen on, all if empty
+	Port             int             // Fixed TCP and QUIC port, random if zero
+	Proxy            string          // SOCKS5 proxy URL for peer connections, direct if empty
+	NoPortMap        bool            // Do not ask the router to forward ports
+	Access           p2p.AccessList  // Peers that may connect, independent of the code
+	Monitor          Monitor         // Observes the transfer, e.g. for metrics, if set
+
+	// Accept decides whether a sender transfers to a connecting receiver.
+	// Every receiver is accepted if nil.
+	Accept func(p peer.ID, sas string) bool
+	// Confirm decides whether a receiver accepts an incoming manifest.
+	// Every manifest is accepted if nil.
+	Confirm func(m *transfer.Manifest) bool
+}
+
+func (o *Options) monitor() Monitor {
+	if o.Monitor == nil {
+		return nopMonitor{}
+	}
+	return o.Monitor
+}
+
+func (o *Options) retries() int {
+	if o.Retries <= 0 {
+		return transfer.MaxRetries
+	}
+	return o.Retries
+}
+
+// Send starts sending path and returns the code for the receiver
+func Send(ctx context.Context, path string, opts Options) (Code, <-chan Event, error) {
+	if _, err := os.Stat(path); err != nil {
+		return "", nil, fmt.Errorf("cannot access path: %w", err)
+	}
+	code, err := words.Generate()
+	if err != nil {
+		return "", nil, err
+	}
+
+	events := newEmitter()
+	go func() {
+		m := opts.monitor().Start("send")
+		err := runSend(ctx, path, code, opts, events, m)
+		m.Done(err)
+		events.finish(err)
+	}()
+	return Code(code), events.ch, nil
+}
+
+// Receive starts receiving the transfer offered under code into dest
+func Receive(ctx context.Context, code, dest string, opts Options) (<-chan Event, error) {
+	if !words.Validate(code) {
+		return nil, errors.New("invalid code")
+	}
+	if info, err := os.Stat(dest); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("destination is not a directory: %s", dest)
+	}
+
+	events := newEmitter()
+	go func() {
+		m := opts.monitor().Start("receive")
+		err := runReceive(ctx, code, dest, opts, events, m)
+		m.Done(err)
+		events.finish(err)
+	}()
+	return events.ch, nil
+}
+
+func newNode(ctx context.Context, opts Options) (*p2p.Node, error) {
+	node, err := p2p.NewNodeWithConfig(ctx, p2p.Config{Listen: opts.Listen, Port: opts.Port, Proxy: opts.Proxy, NoPortMap: opts.NoPortMap, Access: opts.Access})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create P2P node: %w", err)
+	}
+	node.BootstrapTimeout = opts.BootstrapTimeout
+	node.FindTimeout = opts.FindTimeout
+	if err := node.Bootstrap(); err != nil {
+		node.Close()
+		return nil, fmt.Errorf("failed to bootstrap: %w", err)
+	}
+	return node, nil
+}
+
+func runSend(ctx context.Context, path, code string, opts Options, events *emitter, m TransferMonitor) error {
+	sender, err := transfer.NewSender(ctx, path, opts.CacheManifest, opts.SkipHash, func(file string, size int64) {
+		events.emit(Event{Type: EventHashing, File: file})
+	})
+	if err != nil {
+		return err
+	}
+	sender.Code = code
+	sender.Password = opts.Password
+	sender.Compress = opts.Compress
+	sender.CompressLevel = opts.CompressLevel
+	sender.Timeout = opts.Timeout
+	if opts.Expires > 0 {
+		sender.ExpiresAt = time.Now().Add(opts.Expires)
+	}
+	sender.OnProgress = func(file string, sent, total int64) {
+		events.progress(file, sent, total)
+		m.Progress(file, sent, total)
+	}
+	events.manifest(sender.Manifest)
+
+	node, err := newNode(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer node.Close()
+	defer opts.monitor().TrackNode(node)()
+
+	if err := node.Advertise(code); err != nil {
+		return err
+	}
+	events.emit(Event{Type: EventWaiting})
+
+	done := make(chan error, 1)
+	var busy sync.Mutex
+	var accepted peer.ID
+	node.SetStreamHandler(func(stream network.Stream) {
+		// One receiver at a time, a later connection is a reconnect
+		if !busy.TryLock() {
+			transfer.WriteMessage(stream, &transfer.Message{Type: transfer.MsgError, Payload: []byte("Transfer already in progress")})
+			stream.Close()
+			return
+		}
+		defer busy.Unlock()
+		defer stream.Close()
+
+		peerID := stream.Conn().RemotePeer()
+		sender.DataStream = func(ctx context.Context, token []byte) (io.ReadWriteCloser, error) {
+			return node.AcceptDataStream(ctx, peerID, token)
+		}
+		if err := sender.Handshake(stream); err != nil {
+			opts.monitor().HandshakeFailed()
+			return
+		}
+
+		if peerID != accepted {
+			sas := node.ShortAuthString(peerID, code)
+			events.emit(Event{Type: EventConnected, Peer: peerID, SAS: sas})
+			if opts.Accept != nil && !opts.Accept(peerID, sas) {
+				transfer.WriteMessage(stream, &transfer.Message{Type: transfer.MsgError, Payload: []byte("Connection rejected by sender")})
+				return
+			}
+			accepted = peerID
+		}
+
+		var dataStream io.ReadWriter = stream
+		if sender.Compress {
+			compressed, err := transfer.NewCompressedStreamLevel(stream, sender.CompressLevel)
+			if err != nil {
+				return
+			}
+			defer compressed.Close()
+			dataStream = compressed
+		}
+
+		delivery, err := sender.Send(ctx, dataStream)
+		if err != nil && transfer.IsRetryableError(err) && ctx.Err() == nil {
+			m.Retry()
+			events.emit(Event{Type: EventReconnecting, Err: err})
+			return
+		}
+		if err == nil {
+			receipt := delivery.Receipt
+			if receipt != nil && receipt.PeerID != peerID.String() {
+				receipt = nil
+			}
+			events.emit(Event{Type: EventComplete, Receipt: receipt, Confirmed: delivery.Confirmed, Done: sender.Manifest.TotalSize, Total: sender.Manifest.TotalSize})
+		}
+		select {
+		case done <- err:
+		default:
+		}
+	})
+
+	var expired <-chan time.Time
+	if opts.Expires > 0 {
+		timer := time.NewTimer(opts.Expires)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-expired:
+			// A transfer in progress may finish
+			if busy.TryLock() {
+				busy.Unlock()
+				return transfer.ErrExpired
+			}
+			expired = time.After(time.Second)
+		case <-ticker.C:
+			node.Advertise(code)
+		}
+	}
+}
+
+func runReceive(ctx context.Context, code, dest string, opts Options, events *emitter, m TransferMonitor) error {
+	node, err := newNode(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer node.Close()
+	defer opts.monitor().TrackNode(node)()
+
+	receiver := transfer.NewReceiver(dest)
+	receiver.Code = code
+	receiver.Password = opts.Password
+	receiver.FastResume = opts.FastResume
+	receiver.RenameExisting = opts.RenameExisting
+	receiver.Limits = opts.Limits
+	receiver.Identity = node.PrivateKey()
+	if opts.Timeout > 0 {
+		receiver.Timeout = opts.Timeout
+	}
+	receiver.OnConfirmation = func(m *transfer.Manifest) bool {
+		events.manifest(m)
+		return opts.Confirm == nil || opts.Confirm(m)
+	}
+	receiver.OnProgress = func(file string, received, total int64) {
+		events.progress(file, received, total)
+		m.Progress(file, received, total)
+	}
+
+	var connected peer.ID
+	for attempt := 0; ; attempt++ {
+		peerID, err := node.FindPeer(code)
+		if err != nil {
+			return fmt.Errorf("failed to find sender: %w", err)
+		}
+		if peerID != connected {
+			events.emit(Event{Type: EventConnected, Peer: peerID, SAS: node.ShortAuthString(peerID, code)})
+			connected = peerID
+		}
+		stream, err := node.NewStream(peerID)
+		if err != nil {
+			return fmt.Errorf("failed to open stream: %w", err)
+		}
+
+		receiver.DataStream = func(ctx context.Context, token []byte) (io.ReadWriteCloser, error) {
+			return node.NewDataStream(ctx, peerID, token)
+		}
+		err = receiver.Receive(ctx, stream)
+		stream.Close()
+		if err == nil {
+			break
+		}
+		if receiver.Manifest == nil && ctx.Err() == nil {
+			opts.monitor().HandshakeFailed()
+		}
+		if !transfer.IsRetryableError(err) || attempt >= opts.retries() {
+			return err
+		}
+
+		m.Retry()
+		events.emit(Event{Type: EventReconnecting, Err: err})
+		select {
+		case <-time.After(time.Duration(1<<attempt) * 2 * time.Second):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	total := receiver.Manifest.TotalSize
+	events.emit(Event{
+		Type:  EventComplete,
+		Path:  receiver.LocalFolder(),
+		Done:  total,
+		Total: total,
+	})
+	return nil
+}
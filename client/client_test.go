@@ -0,0 +1,62 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ebob10000/2c1f/transfer"
+)
+
+func TestValidation(t *testing.T) {
+	if _, _, err := Send(context.Background(), "/does/not/exist", Options{}); err == nil {
+		t.Error("Send() should reject a missing path")
+	}
+	if _, err := Receive(context.Background(), "not-a-code", t.TempDir(), Options{}); err == nil {
+		t.Error("Receive() should reject an invalid code")
+	}
+	if _, err := Receive(context.Background(), "123-456-789", "/does/not/exist", Options{}); err == nil {
+		t.Error("Receive() should reject a missing destination")
+	}
+}
+
+func TestEmitter(t *testing.T) {
+	e := newEmitter()
+	e.manifest(&transfer.Manifest{
+		TotalSize: 30,
+		Files:     []transfer.FileEntry{{Path: "a", Size: 10}, {Path: "b", Size: 20}},
+	})
+
+	// Progress is reported over the whole transfer and dropped once the buffer is full
+	for i := 0; i < 2*eventBufferSize; i++ {
+		e.progress("b", 5, 20)
+	}
+
+	collected := make(chan []Event)
+	go func() {
+		var events []Event
+		for ev := range e.ch {
+			events = append(events, ev)
+		}
+		collected <- events
+	}()
+
+	e.finish(errors.New("boom"))
+	// Events after the transfer ended are ignored instead of panicking
+	e.emit(Event{Type: EventWaiting})
+	e.progress("a", 1, 10)
+
+	events := <-collected
+	if len(events) != eventBufferSize+1 {
+		t.Fatalf("got %d events, want %d", len(events), eventBufferSize+1)
+	}
+	if events[0].Type != EventManifest || events[0].Total != 30 {
+		t.Errorf("first event = %+v, want manifest", events[0])
+	}
+	if events[1].Type != EventProgress || events[1].Done != 15 || events[1].Total != 30 {
+		t.Errorf("progress event = %+v, want 15 of 30", events[1])
+	}
+	if last := events[len(events)-1]; last.Type != EventError || last.Err == nil {
+		t.Errorf("last event = %+v, want error", last)
+	}
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"sync"
+
+	"github.com/ebob10000/2c1f/transfer"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// EventType identifies what an Event reports
+type EventType string
+
+const (
+	EventHashing      EventType = "hashing"      // Sender is hashing File
+	EventManifest     EventType = "manifest"     // Manifest is known
+	EventWaiting      EventType = "waiting"      // Sender is advertised and waits for the receiver
+	EventConnected    EventType = "connected"    // Peer connected, compare SAS with the other side
+	EventProgress     EventType = "progress"     // Done of Total bytes transferred
+	EventReconnecting EventType = "reconnecting" // Connection dropped, Err holds the cause
+	EventComplete     EventType = "complete"     // Transfer finished, always the last event on success
+	EventError        EventType = "error"        // Transfer failed, always the last event on failure
+)
+
+// Event reports the progress of a transfer. Only the fields relevant to Type are set.
+type Event struct {
+	Type      EventType
+	File      string             // Current file, relative to the transfer root
+	Done      int64              // Bytes transferred over all files
+	Total     int64              // Total bytes of the transfer
+	Manifest  *transfer.Manifest // EventManifest
+	Peer      peer.ID            // EventConnected
+	SAS       string             // EventConnected, short authentication string
+	Path      string             // EventComplete on receive, where the files were saved
+	Receipt   *transfer.Receipt  // EventComplete on send, the receiver's verified delivery receipt
+	Confirmed bool               // EventComplete on send, the receiver acknowledged all files
+	Err       error              // EventError and EventReconnecting
+}
+
+// eventBufferSize lets a consumer fall behind briefly without slowing the transfer
+const eventBufferSize = 64
+
+// emitter delivers events to a channel. Progress events are dropped while the
+// buffer is full so a slow consumer never stalls a transfer; every other
+// event is delivered.
+type emitter struct {
+	ch chan Event
+
+	// sendMu serializes sends with finish so that stream handlers still
+	// running after the transfer ended never send on a closed channel
+	sendMu sync.Mutex
+	closed bool
+
+	mu      sync.Mutex
+	offsets map[string]int64
+	total   int64
+}
+
+func newEmitter() *emitter {
+	return &emitter{ch: make(chan Event, eventBufferSize)}
+}
+
+func (e *emitter) emit(ev Event) {
+	e.sendMu.Lock()
+	defer e.sendMu.Unlock()
+	if !e.closed {
+		e.ch <- ev
+	}
+}
+
+func (e *emitter) manifest(m *transfer.Manifest) {
+	offsets := make(map[string]int64, len(m.Files))
+	var offset int64
+	for _, f := range m.Files {
+		offsets[f.Path] = offset
+		offset += f.Size
+	}
+	e.mu.Lock()
+	e.offsets = offsets
+	e.total = m.TotalSize
+	e.mu.Unlock()
+	e.emit(Event{Type: EventManifest, Manifest: m, Total: m.TotalSize})
+}
+
+// progress matches the OnProgress callbacks of transfer.Sender and transfer.Receiver
+func (e *emitter) progress(file string, done, _ int64) {
+	e.mu.Lock()
+	ev := Event{Type: EventProgress, File: file, Done: e.offsets[file] + done, Total: e.total}
+	e.mu.Unlock()
+
+	e.sendMu.Lock()
+	defer e.sendMu.Unlock()
+	if e.closed {
+		return
+	}
+	select {
+	case e.ch <- ev:
+	default:
+	}
+}
+
+// finish sends the terminal error event if err is set and closes the channel
+func (e *emitter) finish(err error) {
+	if err != nil {
+		e.emit(Event{Type: EventError, Err: err})
+	}
+	e.sendMu.Lock()
+	e.closed = true
+	close(e.ch)
+	e.sendMu.Unlock()
+}
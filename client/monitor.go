@@ -0,0 +1,37 @@
+package client
+
+import "github.com/ebob10000/2c1f/p2p"
+
+// Monitor observes transfers, such as to export metrics. Its methods are
+// called from the goroutines of the transfers and must be safe for
+// concurrent use.
+type Monitor interface {
+	// Start is called when a transfer starts, direction is "send" or "receive"
+	Start(direction string) TransferMonitor
+	// TrackNode is called with the node of a transfer, untrack once it closes
+	TrackNode(n *p2p.Node) (untrack func())
+	// HandshakeFailed is called for a connection that failed before its
+	// transfer started, such as with a wrong code or password
+	HandshakeFailed()
+}
+
+// TransferMonitor observes one transfer, from Monitor.Start to Done
+type TransferMonitor interface {
+	// Progress matches the OnProgress callbacks of transfer.Sender and
+	// transfer.Receiver
+	Progress(file string, pos, total int64)
+	// Retry is called for each reconnection
+	Retry()
+	// Done is called once the transfer finished with err
+	Done(err error)
+}
+
+// nopMonitor is the Monitor of Options without one
+type nopMonitor struct{}
+
+func (nopMonitor) Start(string) TransferMonitor         { return nopMonitor{} }
+func (nopMonitor) TrackNode(*p2p.Node) (untrack func()) { return func() {} }
+func (nopMonitor) HandshakeFailed()                     {}
+func (nopMonitor) Progress(string, int64, int64)        {}
+func (nopMonitor) Retry()                               {}
+func (nopMonitor) Done(error)                           {}
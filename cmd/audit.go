@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"flag"
+	"time"
+
+	"github.com/ebob10000/2c1f/transfer"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// auditFlag adds -audit, and returns a function opening the log it names,
+// nil without it
+func auditFlag(fs *flag.FlagSet) (open func() *transfer.AuditLog) {
+	path := fs.String("audit", "", "Append the handshake, each file with its checksum, retries and timing to this file as JSON lines")
+	return func() *transfer.AuditLog {
+		if *path == "" {
+			return nil
+		}
+		audit, err := transfer.OpenAuditLog(*path)
+		if err != nil {
+			fatalf("Failed to open the audit log: %v", err)
+		}
+		return audit
+	}
+}
+
+// auditEnd records how a transfer that started then ended, with the Merkle
+// root of its files if they were verified against it
+func auditEnd(audit *transfer.AuditLog, peerID peer.ID, size int64, started time.Time, root string, err error) {
+	e := transfer.AuditEvent{Event: transfer.AuditEnd, Peer: peerID.String(), Size: size, Seconds: time.Since(started).Seconds(), Error: transfer.AuditError(err)}
+	if root != "" && err == nil {
+		e.Verified = true
+		e.Options = map[string]interface{}{"root": root}
+	}
+	audit.Record(e)
+}
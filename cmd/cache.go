@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ebob10000/2c1f/cache"
+	"github.com/ebob10000/2c1f/i18n"
+	"github.com/ebob10000/2c1f/paths"
+	"github.com/ebob10000/2c1f/settings"
+	"github.com/ebob10000/2c1f/transfer"
+)
+
+// Cache shows what the cache folder holds with 2c1f cache [list], and trims
+// it to the maxCacheMB setting with cache gc, or empties it with gc -all
+func Cache(args []string) {
+	action := "list"
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+	switch action {
+	case "list":
+		cacheList(args)
+	case "gc":
+		cacheGC(args)
+	default:
+		fmt.Println("Usage: 2c1f cache [list] | cache gc [-max-mb n] [-all]")
+		os.Exit(1)
+	}
+}
+
+func cacheList(args []string) {
+	fs := flag.NewFlagSet("cache list", flag.ExitOnError)
+	applyOutput := outputFlags(fs)
+	parseArgs(fs, args)
+	applyOutput()
+
+	folders, err := cache.Usage()
+	if err != nil {
+		fatalf("Failed to read the cache: %v", err)
+	}
+	if printJSON(folders) {
+		return
+	}
+	var total int64
+	for _, f := range folders {
+		fmt.Printf("%-12s  %6d files  %10s\n", f.Name, f.Files, transfer.FormatBytes(f.Size))
+		total += f.Size
+	}
+	fmt.Printf("%s in %s\n", transfer.FormatBytes(total), paths.CacheDir())
+}
+
+func cacheGC(args []string) {
+	fs := flag.NewFlagSet("cache gc", flag.ExitOnError)
+	maxMB := fs.Int("max-mb", settings.LoadSettings().MaxCacheMB, "Megabytes to trim the cache to, 0 only removes leftovers of interrupted writes")
+	all := fs.Bool("all", false, "Remove everything in the cache")
+	applyOutput := outputFlags(fs)
+	parseArgs(fs, args)
+	applyOutput()
+
+	var result cache.Result
+	var err error
+	if *all {
+		result, err = cache.Clear()
+	} else {
+		result, err = cache.Trim(int64(*maxMB) << 20)
+	}
+	if err != nil {
+		fatalf("Failed to trim the cache: %v", err)
+	}
+	if !printJSON(result) {
+		fmt.Printf("Removed %d files, freed %s\n", result.Files, transfer.FormatBytes(result.Freed))
+	}
+}
+
+// trimCache keeps the cache within the maxCacheMB setting before a command
+// adds to it
+func trimCache() {
+	if _, err := cache.Trim(int64(settings.LoadSettings().MaxCacheMB) << 20); err != nil {
+		infoln(i18n.T("Warning: %s", err))
+	}
+}
@@ -6,10 +6,17 @@ import (
 	"io"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ebob10000/2c1f/cmd"
+	"github.com/ebob10000/2c1f/i18n"
+	"github.com/ebob10000/2c1f/paths"
 	"github.com/ebob10000/2c1f/settings"
+	"github.com/ebob10000/2c1f/source"
 	golog "github.com/ipfs/go-log/v2"
+	"github.com/spf13/cobra"
 )
 
 func init() {
@@ -20,80 +27,498 @@ func init() {
 	golog.SetAllLoggers(golog.LevelError)
 }
 
-func main() {
-	if len(os.Args) < 2 {
-		printUsage()
-		os.Exit(1)
+// command is a subcommand of the CLI, such as receive
+type command struct {
+	name  string
+	usage string // Arguments shown in the usage
+	run   func(args []string)
+}
+
+// commands are the subcommands of rootCommand. Set in init, as printUsage
+// lists them.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"send", "<folder/file> [flags] | send -resume-session <id>", sendCommand},
+		{"receive", "<code> [flags]", handleReceive},
+		{"resume", "-last | <id> [flags]", resumeCommand},
+		{"history", "[-receipts] | history stats", cmd.History},
+		{"config", "[list] | get <key> | set <key> <value> | path", cmd.Config},
+		{"update", "[-rollback]", cmd.Update},
+		{"doctor", "[-wait 10s]", func(args []string) {
+			cmd.Doctor(append(networkArgs(settings.LoadSettings()), args...))
+		}},
+		{"serve", "[flags] | serve list | serve approve <id> | serve reject <id>", cmd.Serve},
+		{"share", "[flags] <label>=<path>... | share add <name> <path> | share list | share rm <name> | share serve", cmd.Share},
+		{"mailbox-server", "[flags] | mailbox-server list", cmd.MailboxServer},
+		{"daemon", "[-listen addr] [-token-file path] [-metrics addr]", cmd.Daemon},
+		{"hash", "<path> [-o manifest.json]", cmd.Hash},
+		{"verify", "<path> <manifest.json> [-ignore-extra]", cmd.Verify},
+		{"decrypt", "<folder> [-keep]", cmd.Decrypt},
+		{"cache", "[list] | cache gc [-max-mb n] [-all]", cmd.Cache},
+		{"integrate", "install|uninstall", cmd.Integrate},
 	}
+}
 
-	firstArg := os.Args[1]
+func main() {
+	initPortable()
+	i18n.SetLanguage(settings.LoadSettings().Language)
+
+	if err := rootCommand().Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, i18n.T("Error: %v", err))
+		os.Exit(2)
+	}
+}
 
-	// Handle receive command
-	if firstArg == "receive" {
-		// Edge case: check if "receive" is actually a file/folder in current directory
-		if len(os.Args) == 2 {
-			// No code provided, check if "receive" exists as a file/folder
-			if _, err := os.Stat("receive"); err == nil {
-				// File/folder named "receive" exists, treat as send path
-				handleSend("receive", os.Args[2:])
-				return
+// rootCommand dispatches to commands. Only -q, -v and --json before the
+// command are parsed here, the commands parse their own flags and take the
+// same ones after their name. 2c1f <path> is short for 2c1f send <path>; a
+// file named like a command is sent with 2c1f send <name> or 2c1f ./<name>.
+func rootCommand() *cobra.Command {
+	var quiet, verbose, asJSON bool
+	root := &cobra.Command{
+		Use:               "2c1f",
+		Args:              cobra.ArbitraryArgs,
+		TraverseChildren:  true,
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		CompletionOptions: cobra.CompletionOptions{DisableDefaultCmd: true},
+		PersistentPreRun: func(*cobra.Command, []string) {
+			cmd.SetOutput(quiet, verbose, asJSON)
+		},
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 {
+				printUsage()
+				os.Exit(1)
 			}
-		}
-		// Normal receive command
-		cmd.Receive(os.Args[2:])
+			handleSend(args[0], args[1:])
+		},
+	}
+	root.SetHelpFunc(func(*cobra.Command, []string) { printUsage() })
+	root.Flags().SetInterspersed(false)
+	root.Flags().BoolVarP(&quiet, "quiet", "q", false, "")
+	root.Flags().BoolVarP(&verbose, "verbose", "v", false, "")
+	root.Flags().BoolVar(&asJSON, "json", false, "")
+
+	for _, c := range commands {
+		run := c.run
+		root.AddCommand(&cobra.Command{
+			Use:                c.name + " " + c.usage,
+			DisableFlagParsing: true,
+			Run: func(_ *cobra.Command, args []string) {
+				run(args)
+			},
+		})
+	}
+	return root
+}
+
+// sendCommand runs 2c1f send, where the path is optional so that a session
+// can be resumed
+func sendCommand(args []string) {
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		handleSend(args[0], args[1:])
 		return
 	}
+	handleSend("", args)
+}
 
-	// Otherwise treat as path for sending
-	handleSend(firstArg, os.Args[2:])
+func resumeCommand(args []string) {
+	receiveArgs, err := cmd.ResumeArgs(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, i18n.T("Error: %v", err))
+		os.Exit(1)
+	}
+	handleReceive(receiveArgs)
 }
 
 func handleSend(path string, args []string) {
-	// Validate path exists
-	if _, err := os.Stat(path); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Cannot access path '%s': %v\n", path, err)
-		os.Exit(1)
+	// Validate path exists, a resumed session brings its own path
+	if path != "" && !source.IsURL(path) {
+		if _, err := os.Stat(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Cannot access path '%s': %v\n", path, err)
+			os.Exit(1)
+		}
 	}
 
-	// Load settings from file
-	userSettings := settings.LoadSettings()
+	// Load settings from file, with the environment applied
+	userSettings, err := settings.LoadSettings().WithEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, i18n.T("Error: %v", err))
+		os.Exit(1)
+	}
 
 	// Parse optional flags (override defaults from settings)
 	fs := flag.NewFlagSet("send", flag.ExitOnError)
 	compress := fs.Bool("compress", userSettings.Compress, "Enable compression")
+	autoCompress := fs.Bool("auto-compress", userSettings.AutoCompress, "Compress on slow links when the files are compressible, unless -compress is set")
+	compressLevel := fs.Int("compress-level", userSettings.CompressLevel, "Gzip compression level from 1 (fastest) to 9 (smallest)")
 	cacheManifest := fs.Bool("cache-manifest", userSettings.CacheManifest, "Cache manifest file")
 	skipHash := fs.Bool("skip-hash", !userSettings.AutoHash, "Skip file hashing")
+	timeout := fs.Duration("timeout", seconds(userSettings.Timeout), "Stream inactivity timeout")
+	bootstrapTimeout := fs.Duration("bootstrap-timeout", seconds(userSettings.BootstrapTimeout), "Bootstrap peer connection timeout")
+	strict := fs.Bool("strict", userSettings.StrictVerify, "Require confirming the verification code")
+	password := fs.String("password", "", "Require the receiver to know this password")
+	to := fs.String("to", "", "Push to a receiver running 2c1f serve with this code")
+	mailbox := fs.String("mailbox", "", "Store the files in a mailbox running 2c1f mailbox-server with this code")
+	startAt := fs.String("start-at", "", "Hold connected receivers until this time")
+	resumeSession := fs.String("resume-session", "", "Continue an interrupted send")
+	preserveNames := fs.Bool("preserve-names", false, "Send file names without Unicode normalization")
+	directIO := fs.Bool("direct-io", false, "Read files without the page cache")
+	sourceLimit := fs.Int("source-limit", userSettings.SourceLimit, "Read files at most this many MB/s")
+	incognito := fs.Bool("incognito", false, "Keep this transfer out of the history")
+	expires := fs.Duration("expires", 0, "Stop accepting receivers after this long")
+	maxDownloads := fs.Int("max-downloads", 1, "Stop after this many completed downloads")
+	listen := fs.String("listen", userSettings.ListenAddrs, "Addresses or interfaces to listen on")
+	port := fs.Int("port", userSettings.Port, "Fixed TCP and QUIC port")
+	proxy := fs.String("proxy", userSettings.Proxy, "SOCKS5 proxy for all connections")
+	noUPnP := fs.Bool("no-upnp", userSettings.NoUPnP, "Do not ask the router to forward ports")
+	noLAN := fs.Bool("no-lan", false, "Do not fall back to a direct connection on the local network")
+	allow := fs.String("allow", userSettings.AllowPeers, "Peers that may connect")
+	deny := fs.String("deny", userSettings.DenyPeers, "Peers that may not connect")
+	bootstrapPeers := fs.String("bootstrap-peers", "", "Bootstrap peer multiaddrs")
+	onComplete := fs.String("on-complete", userSettings.OnComplete, "Command to run when the transfer completes or fails")
+	audit := fs.String("audit", "", "Append a record of the transfer to this file as JSON lines")
+	summaryJSON := fs.String("summary-json", "", "Write a summary of the transfer as JSON to this file")
+	showPeer := fs.Bool("show-peer", false, "Show the peer ID beside the code")
+	decoys := fs.Int("decoys", 0, "Also advertise this many random codes")
+	quiet := fs.Bool("q", false, "Only print the code and the result")
+	verbose := fs.Bool("v", false, "Print connection details and checksums")
+	asJSON := fs.Bool("json", false, "Print results as JSON")
+	profile := fs.String("profile", "", "Use the options of a profile from the settings")
 	fs.Parse(args)
+	if *profile != "" {
+		if err := cmd.ApplyProfile(fs, userSettings, *profile); err != nil {
+			fmt.Fprintln(os.Stderr, i18n.T("Error: %v", err))
+			os.Exit(1)
+		}
+	}
+	// Options without a setting, such as -password
+	if err := cmd.ApplyEnv(fs); err != nil {
+		fmt.Fprintln(os.Stderr, i18n.T("Error: %v", err))
+		os.Exit(1)
+	}
+
+	if path == "" && *resumeSession == "" {
+		fmt.Fprintln(os.Stderr, "Error: Path or -resume-session required")
+		os.Exit(1)
+	}
 
 	// Construct args array for cmd.Send
 	var sendArgs []string
+	// cmd.Send takes its default from the settings too, so it must also be
+	// told when the flag turns it off
+	sendArgs = append(sendArgs, "-auto-compress="+strconv.FormatBool(*autoCompress))
 	if *compress {
 		sendArgs = append(sendArgs, "-compress")
 	}
+	if *compressLevel != 0 {
+		sendArgs = append(sendArgs, "-compress-level="+strconv.Itoa(*compressLevel))
+	}
 	if *cacheManifest {
 		sendArgs = append(sendArgs, "-cache-manifest")
 	}
 	if *skipHash {
 		sendArgs = append(sendArgs, "-skip-hash")
 	}
-	sendArgs = append(sendArgs, path)
+	if *strict {
+		sendArgs = append(sendArgs, "-strict")
+	}
+	if *password != "" {
+		sendArgs = append(sendArgs, "-password="+*password)
+	}
+	if *to != "" {
+		sendArgs = append(sendArgs, "-to="+*to)
+	}
+	if *mailbox != "" {
+		sendArgs = append(sendArgs, "-mailbox="+*mailbox)
+	}
+	if *startAt != "" {
+		sendArgs = append(sendArgs, "-start-at="+*startAt)
+	}
+	if *resumeSession != "" {
+		sendArgs = append(sendArgs, "-resume-session="+*resumeSession)
+	}
+	if *preserveNames {
+		sendArgs = append(sendArgs, "-preserve-names")
+	}
+	if *directIO {
+		sendArgs = append(sendArgs, "-direct-io")
+	}
+	if *sourceLimit != 0 {
+		sendArgs = append(sendArgs, "-source-limit="+strconv.Itoa(*sourceLimit))
+	}
+	if *audit != "" {
+		sendArgs = append(sendArgs, "-audit="+*audit)
+	}
+	if *summaryJSON != "" {
+		sendArgs = append(sendArgs, "-summary-json="+*summaryJSON)
+	}
+	if *incognito {
+		sendArgs = append(sendArgs, "-incognito")
+	}
+	if *showPeer {
+		sendArgs = append(sendArgs, "-show-peer")
+	}
+	if *decoys != 0 {
+		sendArgs = append(sendArgs, "-decoys="+strconv.Itoa(*decoys))
+	}
+	if *expires != 0 {
+		sendArgs = append(sendArgs, "-expires="+expires.String())
+	}
+	if *maxDownloads != 1 {
+		sendArgs = append(sendArgs, "-max-downloads="+strconv.Itoa(*maxDownloads))
+	}
+	if *listen != "" {
+		sendArgs = append(sendArgs, "-listen="+*listen)
+	}
+	if *port != 0 {
+		sendArgs = append(sendArgs, "-port="+strconv.Itoa(*port))
+	}
+	if *proxy != "" {
+		sendArgs = append(sendArgs, "-proxy="+*proxy)
+	}
+	if *noUPnP {
+		sendArgs = append(sendArgs, "-no-upnp")
+	}
+	if *noLAN {
+		sendArgs = append(sendArgs, "-no-lan")
+	}
+	if *allow != "" {
+		sendArgs = append(sendArgs, "-allow="+*allow)
+	}
+	if *deny != "" {
+		sendArgs = append(sendArgs, "-deny="+*deny)
+	}
+	if *bootstrapPeers != "" {
+		sendArgs = append(sendArgs, "-bootstrap-peers="+*bootstrapPeers)
+	}
+	if *onComplete != "" {
+		sendArgs = append(sendArgs, "-on-complete="+*onComplete)
+	}
+	if *quiet {
+		sendArgs = append(sendArgs, "-q")
+	}
+	if *verbose {
+		sendArgs = append(sendArgs, "-v")
+	}
+	if *asJSON {
+		sendArgs = append(sendArgs, "-json")
+	}
+	sendArgs = append(sendArgs, "-timeout="+timeout.String())
+	sendArgs = append(sendArgs, "-bootstrap-timeout="+bootstrapTimeout.String())
+	if path != "" {
+		sendArgs = append(sendArgs, path)
+	}
 
 	cmd.Send(sendArgs)
 }
 
+func handleReceive(args []string) {
+	// cmd.Receive applies the environment to the options without a setting
+	userSettings, err := settings.LoadSettings().WithEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, i18n.T("Error: %v", err))
+		os.Exit(1)
+	}
+	// The profile's settings become the defaults, cmd.Receive applies the
+	// rest of it
+	if name := profileArg(args); name != "" {
+		profiled, err := userSettings.WithProfile(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, i18n.T("Error: %v", err))
+			os.Exit(1)
+		}
+		userSettings = profiled
+	}
+
+	// Settings provide the defaults; flags given by the user come later and win
+	receiveArgs := []string{
+		"-timeout=" + seconds(userSettings.Timeout).String(),
+		"-retries=" + strconv.Itoa(userSettings.Retries),
+		"-find-timeout=" + seconds(userSettings.FindTimeout).String(),
+		"-bootstrap-timeout=" + seconds(userSettings.BootstrapTimeout).String(),
+	}
+	if userSettings.StrictVerify {
+		receiveArgs = append(receiveArgs, "-strict")
+	}
+	if userSettings.OnComplete != "" {
+		receiveArgs = append(receiveArgs, "-on-complete="+userSettings.OnComplete)
+	}
+	if userSettings.ScanCommand != "" {
+		receiveArgs = append(receiveArgs, "-scan="+userSettings.ScanCommand)
+	}
+	if userSettings.KeepRejected {
+		receiveArgs = append(receiveArgs, "-keep-rejected")
+	}
+	if userSettings.NoQuarantine {
+		receiveArgs = append(receiveArgs, "-no-quarantine")
+	}
+	receiveArgs = append(receiveArgs, networkArgs(userSettings)...)
+	receiveArgs = append(receiveArgs, args...)
+
+	cmd.Receive(receiveArgs)
+}
+
+// networkArgs returns the node flags for the network settings
+func networkArgs(s settings.AppSettings) []string {
+	var args []string
+	if s.ListenAddrs != "" {
+		args = append(args, "-listen="+s.ListenAddrs)
+	}
+	if s.Port != 0 {
+		args = append(args, "-port="+strconv.Itoa(s.Port))
+	}
+	if s.Proxy != "" {
+		args = append(args, "-proxy="+s.Proxy)
+	}
+	if s.NoUPnP {
+		args = append(args, "-no-upnp")
+	}
+	if s.AllowPeers != "" {
+		args = append(args, "-allow="+s.AllowPeers)
+	}
+	if s.DenyPeers != "" {
+		args = append(args, "-deny="+s.DenyPeers)
+	}
+	return args
+}
+
+// profileArg returns the value of the -profile flag in args
+func profileArg(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "profile" {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
+
+// initPortable keeps the data files next to the executable if --portable
+// is passed, which is removed from the arguments, or a portable run did
+// before. Must run before anything reads the settings.
+func initPortable() {
+	portable := false
+	args := os.Args[:1]
+	for _, arg := range os.Args[1:] {
+		if arg == "--portable" || arg == "-portable" {
+			portable = true
+			continue
+		}
+		args = append(args, arg)
+	}
+	os.Args = args
+	if _, err := paths.InitPortable(portable); err != nil {
+		fmt.Fprintln(os.Stderr, i18n.T("Error: %v", err))
+		os.Exit(1)
+	}
+}
+
 func printUsage() {
 	fmt.Println("2C1F - Simple & Fast P2P File Transfer")
 	fmt.Println()
 	fmt.Println("Usage:")
+	fmt.Println("  2c1f [global flags] <command> [flags]")
 	fmt.Println("  2c1f <folder/file> [flags]")
-	fmt.Println("  2c1f receive <code> [flags]")
+	fmt.Println("  2c1f <s3://bucket/prefix | https://host/folder/> [flags]")
+	for _, c := range commands {
+		fmt.Printf("  2c1f %s %s\n", c.name, c.usage)
+	}
+	fmt.Println()
+	fmt.Println("Global flags, before the command or after send, receive, serve, mailbox-server, history, config, update and doctor:")
+	fmt.Println("  -q               Only print the code and the result")
+	fmt.Println("  -v               Print addresses, connection attempts and checksums")
+	fmt.Println("  --json           Print results as JSON lines on stdout, messages go to stderr")
+	fmt.Println("  --portable       Keep settings, history and keys in 2c1f-data next to the executable")
 	fmt.Println()
 	fmt.Println("Flags:")
+	fmt.Println("  -profile <name>  Use the options of a profile from the settings (send, receive)")
 	fmt.Println("  -compress        Enable compression")
+	fmt.Println("  -auto-compress   Compress on slow links when the files are compressible")
+	fmt.Println("  -compress-level <n>  Gzip compression level from 1 (fastest) to 9 (smallest)")
 	fmt.Println("  -cache-manifest  Cache manifest file")
 	fmt.Println("  -skip-hash       Skip file hashing")
+	fmt.Println("  -timeout <dur>   Stream inactivity timeout (e.g. 2m)")
+	fmt.Println("  -strict          Confirm the verification code before transferring")
+	fmt.Println("  -password <pw>   Require the receiver to know this password")
+	fmt.Println("  -show-peer       Show the peer ID beside the code, for receivers to check with -peer")
+	fmt.Println("  -decoys <n>      Also advertise up to 8 random codes that lead nowhere, to mislead code scanners")
+	fmt.Println("  -to <code>       Push to a receiver running 2c1f serve")
+	fmt.Println("  -mailbox <code>  Store encrypted in a mailbox running 2c1f mailbox-server, or claim from it (send, receive)")
+	fmt.Println("  -incognito       Keep the transfer out of the history and save no session (send, receive)")
+	fmt.Println("  -on-complete <cmd>  Run cmd when the transfer completes or fails, e.g. \"notify-send {status} {path}\" (send, receive)")
+	fmt.Println("  -scan <cmd>      Scan each received file before it is complete, e.g. \"clamdscan --no-summary {file}\" (receive)")
+	fmt.Println("  -keep-rejected   Move files the scan rejects to the rejected folder and go on instead of failing (receive)")
+	fmt.Println("  -no-quarantine   Do not mark received programs and installers for Gatekeeper on macOS (receive)")
+	fmt.Println("  -audit <file>    Append the handshake, each file with its checksum, retries and timing as JSON lines (send, receive)")
+	fmt.Println("  -summary-json <file>  Write the files, bytes, time, speed and verification of the transfer as JSON when it ends (send, receive)")
+	fmt.Println("  -start-at <time> Start sending at HH:MM (e.g. 23:00)")
+	fmt.Println("  -resume-session <id>  Continue an interrupted send with its code")
+	fmt.Println("  -preserve-names  Send file names without Unicode normalization")
+	fmt.Println("  -direct-io       Read and write files without the page cache, for very fast disks and links (send, receive)")
+	fmt.Println("  -source-limit <MB/s>  Read files no faster, 40 on SMB or NFS mounts unless set, -1 for unlimited")
+	fmt.Println("  -expires <dur>   Stop accepting receivers after this long (e.g. 30m)")
+	fmt.Println("  -max-downloads <n>  Keep sending until n receivers are done, 0 for no limit (default 1)")
+	fmt.Println("  -listen <addrs>  Comma separated IPs, interfaces or multiaddrs to listen on (send, receive, serve)")
+	fmt.Println("  -port <n>        Fixed TCP and QUIC port, e.g. for port forwarding (send, receive, serve)")
+	fmt.Println("  -proxy <url>     Connect through a SOCKS5 proxy such as socks5://127.0.0.1:9050 for Tor (send, receive, serve)")
+	fmt.Println("  -no-upnp         Do not ask the router to forward ports with UPnP or NAT-PMP (send, receive, serve)")
+	fmt.Println("  -no-lan          Do not fall back to a direct connection on the local network when the P2P network fails (send, receive)")
+	fmt.Println("  -allow <list>    Only connect with these comma separated peer IDs, IPs or CIDR ranges (send, receive, serve)")
+	fmt.Println("  -deny <list>     Never connect with these peer IDs, IPs or CIDR ranges (send, receive, serve)")
+	fmt.Println("  -bootstrap-peers <list>  Comma separated bootstrap peer multiaddrs used instead of the public ones (send, receive, serve)")
+	fmt.Println("  -bootstrap-timeout <dur>  Timeout for each bootstrap peer connection, e.g. 10s (send, receive, serve)")
 	fmt.Println()
 	fmt.Println("  receive:")
-	fmt.Println("    -o <path>        Output directory")
-	fmt.Println("    -fast-resume     Fast resume (skip hashing)")
+	fmt.Println("    -o <path>             Output directory")
+	fmt.Println("    -dest <url>           Store in s3://bucket/prefix, webdav://host/path or webdav+http://host/path instead")
+	fmt.Println("    -fast-resume          Fast resume (skip hashing)")
+	fmt.Println("    -paranoid             Check files already there block by block, not by their full checksum")
+	fmt.Println("    -rename-existing      Save as \"Name (2)\" if the folder exists with other files in it")
+	fmt.Println("    -write-checksums      Write Name.SHA256SUMS next to the folder, =blake3 for Name.B3SUMS")
+	fmt.Println("    -max-files <n>        Refuse transfers with more files (default 1000000, -1 for no limit)")
+	fmt.Println("    -max-depth <n>        Refuse transfers with deeper paths (default 128, -1 for no limit)")
+	fmt.Println("    -max-file-mb <n>      Refuse transfers with a larger file")
+	fmt.Println("    -max-total-mb <n>     Refuse larger transfers")
+	fmt.Println("    -timeout <dur>        Stream inactivity timeout (e.g. 2m)")
+	fmt.Println("    -retries <n>          Reconnection attempts")
+	fmt.Println("    -find-timeout <dur>   Timeout for locating the sender")
+	fmt.Println("    -strict               Confirm the verification code before receiving")
+	fmt.Println("    -peer <id>            Only accept the sender with this peer ID, shown by send -show-peer")
+	fmt.Println("    -password <pw>        Password set by the sender")
+	fmt.Println("    -encrypt              Encrypt received files on disk with a passphrase")
+	fmt.Println()
+	fmt.Println("  serve:")
+	fmt.Println("    -o <path>                 Output directory")
+	fmt.Println("    -code <code>              Code senders push to (persistent if omitted)")
+	fmt.Println("    -max-mb-per-hour <n>      Per-sender size quota")
+	fmt.Println("    -max-files-per-hour <n>   Per-sender file count quota")
+	fmt.Println("    -block-ext <list>         Refuse transfers containing these extensions")
+	fmt.Println("    -quarantine               Hold transfers until approved")
+	fmt.Println("    -auto-accept-contacts     Save transfers from contacts without quarantine (off by default)")
+	fmt.Println("    -metrics <addr>           Serve Prometheus metrics, /healthz and /readyz (e.g. :9090)")
+	fmt.Println("    -log-format <fmt>         Log as text or json")
+	fmt.Println("    -drain-timeout <dur>      Time a shutdown waits for the files being received (default 25s)")
+	fmt.Println()
+	fmt.Println("  mailbox-server:")
+	fmt.Println("    -dir <path>               Directory the deposits are kept in")
+	fmt.Println("    -code <code>              Code of the mailbox (persistent if omitted)")
+	fmt.Println("    -max-ttl <dur>            Longest time a deposit is kept unless claimed (default 168h)")
+	fmt.Println("    -max-deposit-mb <n>       Largest deposit accepted (default 10240, 0 for unlimited)")
+	fmt.Println("    -max-total-mb <n>         Most space all deposits may take (default 51200, 0 for unlimited)")
 }
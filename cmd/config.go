@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ebob10000/2c1f/i18n"
+	"github.com/ebob10000/2c1f/settings"
+)
+
+// Config shows and changes the settings the GUI edits, named as in the
+// settings file: 2c1f config [list], config get <key>, config set <key>
+// <value> and config path
+func Config(args []string) {
+	fs := flag.NewFlagSet("config", flag.ExitOnError)
+	applyOutput := outputFlags(fs)
+	args = parseArgs(fs, args)
+	applyOutput()
+
+	action := "list"
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+
+	s, err := settings.Read()
+	if err != nil {
+		fmt.Println(i18n.T("Error: %v", err))
+		os.Exit(1)
+	}
+
+	switch {
+	case action == "list" && len(args) == 0:
+		if printJSON(s) {
+			return
+		}
+		for _, key := range settings.Keys() {
+			value, _ := s.Get(key)
+			fmt.Printf("%s = %v\n", key, value)
+		}
+		if names := s.ProfileNames(); len(names) > 0 {
+			fmt.Printf("profiles: %v (edit them in %s)\n", names, settings.GetSettingsPath())
+		}
+
+	case action == "get" && len(args) == 1:
+		value, err := s.Get(args[0])
+		if err != nil {
+			fmt.Println(i18n.T("Error: %v", err))
+			os.Exit(1)
+		}
+		if !printJSON(value) {
+			fmt.Println(value)
+		}
+
+	case action == "set" && len(args) == 2:
+		s, err = s.Set(args[0], args[1])
+		if err == nil {
+			err = settings.Save(s)
+		}
+		if err != nil {
+			fmt.Println(i18n.T("Error: %v", err))
+			os.Exit(1)
+		}
+		value, _ := s.Get(args[0])
+		if !printJSON(value) {
+			fmt.Printf("%s = %v\n", args[0], value)
+		}
+
+	case action == "path" && len(args) == 0:
+		if !printJSON(settings.GetSettingsPath()) {
+			fmt.Println(settings.GetSettingsPath())
+		}
+
+	default:
+		fmt.Println("Usage: 2c1f config [list] | get <key> | set <key> <value> | path")
+		os.Exit(1)
+	}
+}
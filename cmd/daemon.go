@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/ebob10000/2c1f/client"
+	"github.com/ebob10000/2c1f/daemon"
+	"github.com/ebob10000/2c1f/i18n"
+	"github.com/ebob10000/2c1f/metrics"
+	"github.com/ebob10000/2c1f/p2p"
+	"github.com/ebob10000/2c1f/transfer"
+)
+
+// Daemon serves the local control API until interrupted
+func Daemon(args []string) {
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	listen := fs.String("listen", daemon.DefaultListenAddr, "Address to serve the API on")
+	tokenFile := fs.String("token-file", daemon.GetTokenPath(), "File holding the API token, created if missing")
+	timeout := fs.Duration("timeout", transfer.StreamTimeout, "Stream inactivity timeout")
+	bootstrapTimeout := fs.Duration("bootstrap-timeout", p2p.DefaultBootstrapTimeout, "Timeout for each bootstrap peer connection")
+	retries := fs.Int("retries", transfer.MaxRetries, "Reconnection attempts after an interrupted receive")
+	metricsAddr := fs.String("metrics", "", "Serve Prometheus metrics, /healthz and /readyz on this address (e.g. :9090)")
+	fs.Parse(args)
+	applyEnv(fs)
+
+	token, err := daemon.LoadOrCreateToken(*tokenFile)
+	if err != nil {
+		fmt.Printf("Error: Failed to load API token: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	if *metricsAddr != "" {
+		if err := metrics.Listen(ctx, *metricsAddr); err != nil {
+			fmt.Printf("Error: Failed to serve metrics: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Metrics on http://%s/metrics\n", *metricsAddr)
+	}
+
+	manager := daemon.NewManager(ctx)
+	manager.Timeout = *timeout
+	manager.BootstrapTimeout = *bootstrapTimeout
+	manager.Retries = *retries
+	manager.Monitor = metricsMonitor{}
+
+	server := &http.Server{
+		Addr:              *listen,
+		Handler:           daemon.NewServer(manager, token).Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		metrics.SetReady(false)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Println(i18n.T("Error: %v", err))
+		os.Exit(1)
+	}
+	metrics.SetReady(true)
+	fmt.Printf("API listening on http://%s\n", *listen)
+	fmt.Printf("Token: %s\n", *tokenFile)
+	if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Println(i18n.T("Error: %v", err))
+		os.Exit(1)
+	}
+}
+
+// metricsMonitor counts the transfers of the daemon in the metrics
+type metricsMonitor struct{}
+
+func (metricsMonitor) Start(direction string) client.TransferMonitor {
+	return metrics.Start(direction)
+}
+
+func (metricsMonitor) TrackNode(n *p2p.Node) (untrack func()) {
+	return metrics.TrackNode(n)
+}
+
+func (metricsMonitor) HandshakeFailed() {
+	metrics.HandshakeFailed()
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ebob10000/2c1f/i18n"
+	"github.com/ebob10000/2c1f/transfer"
+	"golang.org/x/term"
+)
+
+// Decrypt unlocks files received with -encrypt, replacing each encrypted file
+// with its plaintext
+func Decrypt(args []string) {
+	flags := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	keep := flags.Bool("keep", false, "Keep the encrypted files after decrypting")
+	positional := parseArgs(flags, args)
+
+	if len(positional) == 0 {
+		fmt.Println("Usage: 2c1f decrypt <folder> [-keep]")
+		os.Exit(1)
+	}
+	root := positional[0]
+
+	var files []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(d.Name(), transfer.EncryptedExt) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println(i18n.T("Error: %v", err))
+		os.Exit(1)
+	}
+	if len(files) == 0 {
+		fmt.Println("No encrypted files found.")
+		return
+	}
+
+	passphrase, err := readPassphrase("Passphrase: ")
+	if err != nil {
+		fmt.Println(i18n.T("Error: %v", err))
+		os.Exit(1)
+	}
+
+	decryptor := transfer.NewDecryptor(passphrase)
+	failed := 0
+	for _, src := range files {
+		dst := strings.TrimSuffix(src, transfer.EncryptedExt)
+		if _, err := os.Stat(dst); err == nil {
+			fmt.Printf("Skipping %s: %s already exists\n", src, dst)
+			failed++
+			continue
+		}
+		if err := decryptor.DecryptFile(src, dst); err != nil {
+			fmt.Printf("Failed to decrypt %s: %v\n", src, err)
+			failed++
+			continue
+		}
+		if !*keep {
+			os.Remove(src)
+		}
+	}
+
+	fmt.Printf("Decrypted %d of %d files.\n", len(files)-failed, len(files))
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// readPassphrase prompts for a passphrase without echoing it when stdin is a terminal
+func readPassphrase(prompt string) (string, error) {
+	fmt.Print(prompt)
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		var passphrase string
+		fmt.Scanln(&passphrase)
+		return passphrase, nil
+	}
+	data, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return string(data), nil
+}
+
+// newEncryptionKey asks for a new passphrase twice and derives the at-rest key
+func newEncryptionKey() (*transfer.EncryptionKey, error) {
+	passphrase, err := readPassphrase("Encryption passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	confirm, err := readPassphrase("Repeat passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if passphrase != confirm {
+		return nil, fmt.Errorf("passphrases do not match")
+	}
+	return transfer.NewEncryptionKey(passphrase)
+}
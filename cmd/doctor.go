@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ebob10000/2c1f/i18n"
+	"github.com/ebob10000/2c1f/p2p"
+)
+
+// Doctor starts a node and reports how reachable it is, such as whether the
+// router forwards its ports
+func Doctor(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	wait := fs.Duration("wait", 10*time.Second, "Time the router has to map ports")
+	nodeConfig := nodeFlags(fs)
+	applyOutput := outputFlags(fs)
+	fs.Parse(args)
+	applyEnv(fs)
+	applyOutput()
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	fmt.Println("Checking the network...")
+	stats, err := p2p.CheckNetwork(ctx, nodeConfig(), *wait)
+	if stats.Addrs == nil && err != nil {
+		fmt.Println(i18n.T("Error: %v", err))
+		os.Exit(1)
+	}
+	report := doctorReport{Stats: stats}
+	if err != nil {
+		report.BootstrapError = err.Error()
+	}
+	if printJSON(report) {
+		return
+	}
+
+	fmt.Println("Addresses:")
+	for _, addr := range stats.Addrs {
+		fmt.Printf("  %s\n", addr)
+	}
+	if err != nil {
+		fmt.Printf("Bootstrap: %v\n", err)
+	} else {
+		fmt.Printf("Bootstrap: connected to %d peers through the %s set\n", stats.Peers, stats.Bootstrap)
+	}
+
+	switch {
+	case !stats.PortMapping:
+		fmt.Println("Port mapping: off")
+	case !stats.Gateway:
+		fmt.Println("Port mapping: no router with UPnP or NAT-PMP found, connections may need hole punching or a relay")
+	case len(stats.Mappings) == 0:
+		fmt.Println("Port mapping: the router refused to forward ports")
+	default:
+		fmt.Println("Port mapping:")
+		for _, m := range stats.Mappings {
+			fmt.Printf("  %s %d -> %s (lease %s, renewed automatically)\n", m.Protocol, m.InternalPort, m.ExternalAddr, m.Lease)
+		}
+	}
+}
+
+// doctorReport is printed by doctor with --json
+type doctorReport struct {
+	p2p.Stats
+	BootstrapError string `json:"bootstrapError,omitempty"`
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ebob10000/2c1f/i18n"
+	"github.com/ebob10000/2c1f/transfer"
+)
+
+// Hash writes a standalone integrity manifest for a file or folder
+func Hash(args []string) {
+	fs := flag.NewFlagSet("hash", flag.ExitOnError)
+	output := fs.String("o", "manifest.json", "Output manifest file")
+	positional := parseArgs(fs, args)
+
+	if len(positional) == 0 {
+		fmt.Println("Usage: 2c1f hash <path> [-o manifest.json]")
+		os.Exit(1)
+	}
+	path := positional[0]
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	manifest, err := transfer.BuildManifest(ctx, path, false, false, func(p string, size int64) {
+		fmt.Printf("\rHashing: %s...", p)
+	})
+	fmt.Println()
+	if err != nil {
+		fmt.Println(i18n.T("Error: %v", err))
+		os.Exit(1)
+	}
+
+	if err := transfer.SaveManifest(manifest, *output); err != nil {
+		fmt.Printf("Error: Failed to write manifest: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Wrote manifest for %d files (%s) to %s\n", len(manifest.Files), transfer.FormatBytes(manifest.TotalSize), *output)
+}
+
+// Verify checks a file or folder against a manifest written by Hash or cached by a sender
+func Verify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	ignoreExtra := fs.Bool("ignore-extra", false, "Do not report files missing from the manifest")
+	positional := parseArgs(fs, args)
+
+	if len(positional) < 2 {
+		fmt.Println("Usage: 2c1f verify <path> <manifest.json> [-ignore-extra]")
+		os.Exit(1)
+	}
+	path, manifestPath := positional[0], positional[1]
+
+	manifest, err := transfer.LoadManifest(manifestPath)
+	if err != nil {
+		fmt.Printf("Error: Failed to read manifest: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	results, err := transfer.VerifyManifest(ctx, path, manifest, func(p string, size int64) {
+		fmt.Printf("\rVerifying: %s...", p)
+	})
+	fmt.Println()
+	if err != nil {
+		fmt.Println(i18n.T("Error: %v", err))
+		os.Exit(1)
+	}
+
+	failed := 0
+	for _, r := range results {
+		switch r.Status {
+		case transfer.VerifyOK:
+			continue
+		case transfer.VerifyExtra:
+			if *ignoreExtra {
+				continue
+			}
+		case transfer.VerifyCorrupt:
+			if r.BadBlock >= 0 {
+				fmt.Printf("  %-16s %s (first bad block %d)\n", r.Status, r.Path, r.BadBlock)
+				failed++
+				continue
+			}
+		}
+		fmt.Printf("  %-16s %s\n", r.Status, r.Path)
+		failed++
+	}
+
+	if failed > 0 {
+		fmt.Printf("Verification failed: %d of %d entries differ.\n", failed, len(results))
+		os.Exit(1)
+	}
+	fmt.Printf("All %d files match the manifest.\n", len(manifest.Files))
+}
+
+// parseArgs parses flags that may appear before or after positional arguments
+// and returns the positional arguments
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// signalContext returns a context cancelled on SIGINT or SIGTERM
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ebob10000/2c1f/history"
+	"github.com/ebob10000/2c1f/i18n"
+	"github.com/ebob10000/2c1f/settings"
+	"github.com/ebob10000/2c1f/source"
+	"github.com/ebob10000/2c1f/storage"
+	"github.com/ebob10000/2c1f/transfer"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func History(args []string) {
+	if len(args) > 0 && args[0] == "stats" {
+		historyStats(args[1:])
+		return
+	}
+
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	receipts := fs.Bool("receipts", false, "Show fingerprints and the delivery receipts of sent transfers")
+	applyOutput := outputFlags(fs)
+	fs.Parse(args)
+	applyOutput()
+
+	records := loadHistory()
+	if records == nil {
+		records = []history.Record{}
+	}
+	if printJSON(records) {
+		return
+	}
+	if len(records) == 0 {
+		fmt.Println("No transfers yet.")
+		return
+	}
+
+	for _, r := range records {
+		fmt.Printf("%s  %-7s  %-11s  %10s  %s\n",
+			r.Timestamp.Local().Format("2006-01-02 15:04"), r.Direction, r.Status, transfer.FormatBytes(r.Size), r.Path)
+		if r.Resumable() {
+			fmt.Printf("    %s of %s done, resume with: 2c1f resume %s\n", transfer.FormatBytes(r.Transferred), transfer.FormatBytes(r.Size), r.ID)
+		}
+
+		if *receipts && r.Root != "" {
+			fmt.Printf("    Files:     %s\n", transfer.Fingerprint(r.Root))
+		}
+		if !*receipts || r.Direction != "send" {
+			continue
+		}
+		if r.Receipt == nil {
+			fmt.Println("    Receipt:   none")
+			continue
+		}
+		status := "valid"
+		if err := r.Receipt.Verify(r.Receipt.ManifestHash); err != nil {
+			status = fmt.Sprintf("INVALID (%v)", err)
+		}
+		fmt.Printf("    Receipt:   %s\n", status)
+		fmt.Printf("    Receiver:  %s\n", r.Receipt.PeerID)
+		fmt.Printf("    Manifest:  %s\n", r.Receipt.ManifestHash)
+		fmt.Printf("    Signed at: %s\n", r.Receipt.Timestamp.Local().Format("2006-01-02 15:04:05"))
+	}
+}
+
+// How many days, weeks and peers history stats lists
+const (
+	statsDays  = 7
+	statsWeeks = 4
+	statsPeers = 5
+)
+
+func historyStats(args []string) {
+	fs := flag.NewFlagSet("history stats", flag.ExitOnError)
+	applyOutput := outputFlags(fs)
+	fs.Parse(args)
+	applyOutput()
+
+	stats := history.Summarize(loadHistory(), time.Local)
+	if printJSON(stats) {
+		return
+	}
+	if stats.Transfers == 0 {
+		fmt.Println("No transfers yet.")
+		return
+	}
+
+	fmt.Printf("%d transfers, %s sent, %s received\n", stats.Transfers, transfer.FormatBytes(stats.BytesSent), transfer.FormatBytes(stats.BytesReceived))
+	if stats.AverageSpeed > 0 {
+		fmt.Printf("Average speed: %s/s\n", transfer.FormatBytes(stats.AverageSpeed))
+	}
+	printPeriods := func(title string, periods []history.Period, n int) {
+		fmt.Printf("\n%-12s  %10s  %10s\n", title, "Sent", "Received")
+		for _, p := range periods[:min(n, len(periods))] {
+			fmt.Printf("%-12s  %10s  %10s\n", p.Start.Format("2006-01-02"), transfer.FormatBytes(p.Sent), transfer.FormatBytes(p.Received))
+		}
+	}
+	printPeriods("Day", stats.Days, statsDays)
+	printPeriods("Week of", stats.Weeks, statsWeeks)
+	if len(stats.Peers) > 0 {
+		fmt.Println("\nPeers")
+		for _, p := range stats.Peers[:min(statsPeers, len(stats.Peers))] {
+			fmt.Printf("%s  %4d transfers  %10s\n", p.Peer, p.Transfers, transfer.FormatBytes(p.Bytes))
+		}
+	}
+}
+
+// recordTransfer adds a completed transfer with peerID, which connected at
+// started, to the shared history file. Either may be unknown, as may
+// compression if it was off.
+func recordTransfer(path string, size int64, direction, status, root string, receipt *transfer.Receipt, peerID peer.ID, started time.Time, compression transfer.CompressionStats) {
+	record := history.NewRecord(absPath(path), size, direction, status)
+	record.Root = root
+	record.Receipt = receipt
+	record.SetCompression(compression)
+	if peerID != "" {
+		record.Peer = peerID.String()
+	}
+	if !started.IsZero() {
+		record.Duration = time.Since(started)
+	}
+	saveRecord(record)
+}
+
+// unfinishedRecord returns the history record of a transfer that ended with
+// err. The caller adds what is needed to resume it and saves it.
+func unfinishedRecord(path string, size int64, direction string, err error) history.Record {
+	return history.NewRecord(absPath(path), size, direction, history.FailureStatus(err))
+}
+
+// incognito keeps the transfer out of the history and the sessions
+var incognito bool
+
+// incognitoFlag adds -incognito to fs
+func incognitoFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&incognito, "incognito", false, "Keep this transfer out of the history and save no session")
+}
+
+// saveRecord adds record to the history and reports whether it is kept
+func saveRecord(record history.Record) bool {
+	s := settings.LoadSettings()
+	if incognito || !s.HistoryEnabled {
+		return false
+	}
+	if err := history.Add(record, s.HistoryRetentionDays); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return false
+	}
+	return true
+}
+
+// loadHistory returns the history within the retention of the settings
+func loadHistory() []history.Record {
+	return history.Prune(history.Load(), settings.LoadSettings().HistoryRetentionDays, time.Now())
+}
+
+func absPath(path string) string {
+	if source.IsURL(path) || storage.IsURL(path) {
+		return path
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// printConfirmation tells whether the receiver confirmed it saved all files
+func printConfirmation(delivery *transfer.Delivery) {
+	if delivery.Confirmed && len(delivery.Skipped) > 0 {
+		infoln(i18n.T("Receiver confirmed the files it chose, %d were left out.", len(delivery.Skipped)))
+	} else if delivery.Confirmed {
+		infoln(i18n.T("Receiver confirmed all files."))
+	} else {
+		infoln(i18n.T("Sent, but the receiver did not confirm it received the files."))
+	}
+}
+
+// printCompression reports how well compression did, if it was on
+func printCompression(stats transfer.CompressionStats) {
+	if stats.Wire > 0 {
+		infoln(i18n.T("Compression: %s", stats))
+	}
+}
+
+// summaryJSON is the file -summary-json writes the summary of a transfer to
+var summaryJSON string
+
+// summaryFlag adds -summary-json to fs
+func summaryFlag(fs *flag.FlagSet) {
+	fs.StringVar(&summaryJSON, "summary-json", "", "Write a summary of the transfer as JSON to this file when it ends")
+}
+
+// printSummary prints how a transfer that ended with err went, and writes
+// it to the -summary-json file
+func printSummary(summary transfer.Summary, err error) {
+	if err != nil {
+		summary.Error = err.Error()
+	}
+	if summary.Elapsed > 0 {
+		infoln(i18n.T("Files: %d transferred, %d skipped, %d failed", summary.Files, summary.Skipped, summary.Failed))
+		infoln(i18n.T("Data: %s transferred, %s resumed, in %s at %s/s",
+			transfer.FormatBytes(summary.Bytes), transfer.FormatBytes(summary.Resumed), roundElapsed(summary.Elapsed), transfer.FormatBytes(summary.Speed)))
+	}
+	if summaryJSON == "" {
+		return
+	}
+	data, jsonErr := json.MarshalIndent(summary, "", "  ")
+	if jsonErr == nil {
+		jsonErr = os.WriteFile(summaryJSON, append(data, '\n'), 0644)
+	}
+	if jsonErr != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to write summary: %v\n", jsonErr)
+	}
+}
+
+// shortSummary describes a transfer in a few words, for log lines
+func shortSummary(summary transfer.Summary) string {
+	return fmt.Sprintf("%d files, %s in %s", summary.Files, transfer.FormatBytes(summary.Bytes), roundElapsed(summary.Elapsed))
+}
+
+// roundElapsed rounds d to seconds, or milliseconds if shorter
+func roundElapsed(d time.Duration) time.Duration {
+	if d < time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(time.Second)
+}
+
+// verifiedReceipt returns the receipt of delivery if it was signed by the connected peer
+func verifiedReceipt(delivery *transfer.Delivery, peerID peer.ID) *transfer.Receipt {
+	if delivery.Receipt == nil {
+		return nil
+	}
+	if delivery.Receipt.PeerID != peerID.String() {
+		fmt.Println(i18n.T("Warning: ignoring receipt signed by a different peer"))
+		return nil
+	}
+	return delivery.Receipt
+}
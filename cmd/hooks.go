@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ebob10000/2c1f/hooks"
+	"github.com/ebob10000/2c1f/i18n"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// runHook runs the -on-complete command, if any, for a transfer that ended
+// with err. The hook runs even after Ctrl+C, so it is not tied to the
+// transfer's context.
+func runHook(command, direction, path string, size int64, peerID peer.ID, err error) {
+	if command == "" {
+		return
+	}
+	t := hooks.Transfer{Direction: direction, Path: path, Size: size, Status: hooks.Status(err)}
+	if peerID != "" {
+		t.Peer = peerID.String()
+	}
+	if err := hooks.Run(context.Background(), command, t); err != nil {
+		fmt.Println(i18n.T("Warning: %s", err))
+	}
+}
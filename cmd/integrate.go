@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ebob10000/2c1f/i18n"
+	"github.com/ebob10000/2c1f/integrate"
+)
+
+// Integrate adds or removes the "Send with 2c1f" file manager entry
+func Integrate(args []string) {
+	if len(args) != 1 || (args[0] != "install" && args[0] != "uninstall") {
+		fmt.Println("Usage: 2c1f integrate install|uninstall")
+		os.Exit(1)
+	}
+
+	if args[0] == "uninstall" {
+		if err := integrate.Uninstall(); err != nil {
+			fmt.Println(i18n.T("Error: %v", err))
+			os.Exit(1)
+		}
+		fmt.Printf("Removed \"%s\" from the context menu.\n", integrate.MenuLabel)
+		return
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Printf("Error: failed to get executable path: %v\n", err)
+		os.Exit(1)
+	}
+	if err := integrate.Install(exe); err != nil {
+		fmt.Println(i18n.T("Error: %v", err))
+		os.Exit(1)
+	}
+	fmt.Printf("Added \"%s\" to the context menu for %s.\n", integrate.MenuLabel, exe)
+	fmt.Println("Run 2c1f integrate install again after moving 2c1f.")
+}
@@ -0,0 +1,367 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ebob10000/2c1f/events"
+	"github.com/ebob10000/2c1f/history"
+	"github.com/ebob10000/2c1f/i18n"
+	"github.com/ebob10000/2c1f/p2p"
+	"github.com/ebob10000/2c1f/serve"
+	"github.com/ebob10000/2c1f/transfer"
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// MailboxServer keeps transfers deposited with `2c1f send <path> -mailbox
+// <code>` until the receiver claims them with `2c1f receive -mailbox <code>
+// <claim code>`, so both sides need not be online at the same time. Files
+// arrive encrypted with the claim code, which the mailbox never learns. The
+// list subcommand shows the deposits.
+func MailboxServer(args []string) {
+	if len(args) > 0 && args[0] == "list" {
+		mailboxList(args[1:])
+		return
+	}
+
+	fs := flag.NewFlagSet("mailbox-server", flag.ExitOnError)
+	dir := fs.String("dir", serve.DefaultMailboxDir(), "Directory the deposits are kept in")
+	code := fs.String("code", "", "Code senders and receivers reach the mailbox with, a persistent code is generated if empty")
+	maxTTL := fs.Duration("max-ttl", transfer.DefaultMailboxTTL, "Longest time a deposit is kept unless claimed")
+	maxDepositMB := fs.Int64("max-deposit-mb", 10<<10, "Largest deposit in MB, 0 for unlimited")
+	maxTotalMB := fs.Int64("max-total-mb", 50<<10, "Most MB all deposits may take together, 0 for unlimited")
+	timeout := fs.Duration("timeout", transfer.StreamTimeout, "Stream inactivity timeout")
+	bootstrapTimeout := fs.Duration("bootstrap-timeout", p2p.DefaultBootstrapTimeout, "Timeout for each bootstrap peer connection")
+	nodeConfig := nodeFlags(fs)
+	applyOutput := outputFlags(fs)
+	fs.Parse(args)
+	applyEnv(fs)
+	applyOutput()
+
+	if *code == "" {
+		var err error
+		*code, err = serve.LoadOrCreateMailboxCode()
+		if err != nil {
+			fatalf("Failed to create mailbox code: %v", err)
+		}
+	}
+	if err := os.MkdirAll(*dir, 0700); err != nil {
+		fatalf("Failed to create mailbox: %v", err)
+	}
+	mailbox := &serve.Mailbox{Dir: *dir, MaxTTL: *maxTTL, MaxTotalSize: *maxTotalMB << 20}
+	expire := func() {
+		removed, err := mailbox.Expire()
+		if err != nil {
+			logf("Failed to delete expired deposits: %v", err)
+		} else if removed > 0 {
+			logf("Deleted %d expired deposits", removed)
+		}
+	}
+	expire()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		logf("Shutting down")
+		cancel()
+	}()
+
+	logf("Starting P2P node...")
+	node, err := p2p.NewNodeWithConfig(ctx, nodeConfig())
+	if err != nil {
+		fatalf("Failed to create P2P node: %v", err)
+	}
+	defer node.Close()
+	node.BootstrapTimeout = *bootstrapTimeout
+	node.OnBootstrap = logBootstrap
+
+	logf("Connecting to network...")
+	if err := node.Bootstrap(); err != nil {
+		fatalf("Failed to bootstrap: %v", err)
+	}
+
+	time.Sleep(2 * time.Second)
+
+	if err := node.Advertise(*code); err != nil {
+		fatalf("Failed to advertise: %v", err)
+	}
+
+	node.SetMailboxHandler(func(stream network.Stream) {
+		defer stream.Close()
+		serveMailbox(ctx, node, stream, mailbox, *code, *maxDepositMB<<20, *timeout)
+	})
+
+	logf("Mailbox on code %s, keeping deposits in %s", *code, *dir)
+	logf("Senders deposit with: 2c1f send <path> -mailbox %s", *code)
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			logf("Stopped")
+			return
+		case <-ticker.C:
+			node.Advertise(*code)
+			expire()
+		}
+	}
+}
+
+// serveMailbox answers the request a mailbox stream starts with and runs
+// the transfer that follows it. Deposits of more than maxDeposit bytes are
+// refused, unless it is zero.
+func serveMailbox(ctx context.Context, node *p2p.Node, stream network.Stream, mailbox *serve.Mailbox, code string, maxDeposit int64, timeout time.Duration) {
+	peerID := stream.Conn().RemotePeer().String()
+	transfer.SetStreamDeadline(stream, transfer.DefaultHandshakeTimeout)
+	req, err := transfer.ReadMailboxRequest(stream)
+	if err != nil {
+		logf("Invalid request from %s: %v", peerID[:12], err)
+		stream.Reset()
+		return
+	}
+	logf("Connection from %s, verification code %s", peerID[:12], node.ShortAuthString(stream.Conn().RemotePeer(), code))
+
+	switch req.Op {
+	case transfer.MailboxDeposit:
+		d, err := mailbox.Reserve(req.Claim, peerID, req.TTL)
+		if err != nil {
+			logf("Refusing deposit from %s: %v", peerID[:12], err)
+			transfer.WriteMailboxReply(stream, transfer.MailboxReply{Error: err.Error()})
+			return
+		}
+		if err := transfer.WriteMailboxReply(stream, transfer.MailboxReply{ExpiresAt: d.ExpiresAt}); err != nil {
+			mailbox.Remove(d.ID)
+			return
+		}
+
+		receiver := transfer.NewReceiver(mailbox.Path(d.ID))
+		receiver.Code = code
+		receiver.Timeout = timeout
+		receiver.Identity = node.PrivateKey()
+		receiver.Limits = transfer.Limits{MaxTotalSize: maxDeposit}
+		receiver.OnConfirmation = func(m *transfer.Manifest) bool {
+			if err := mailbox.Admit(d, m); err != nil {
+				logf("Refusing deposit from %s: %v", peerID[:12], err)
+				return false
+			}
+			logf("Storing %s from %s (%s, %d files) until %s", m.FolderName, peerID[:12], transfer.FormatBytes(m.TotalSize), len(m.Files), d.ExpiresAt.Local().Format("2006-01-02 15:04"))
+			return true
+		}
+		if err := receiver.Receive(ctx, stream); err != nil {
+			logf("Deposit from %s failed: %v", peerID[:12], err)
+			mailbox.Remove(d.ID)
+			return
+		}
+		if err := mailbox.Complete(d, receiver.Manifest); err != nil {
+			logf("Failed to record deposit: %v", err)
+			mailbox.Remove(d.ID)
+			return
+		}
+		logf("Stored %s as %s", d.FolderName, d.ID)
+
+	case transfer.MailboxClaim:
+		d, err := mailbox.Claim(req.Claim)
+		if err != nil {
+			logf("Refusing claim from %s: %v", peerID[:12], err)
+			transfer.WriteMailboxReply(stream, transfer.MailboxReply{Error: err.Error()})
+			return
+		}
+		delivered := false
+		defer func() { mailbox.Release(d.ID, delivered) }()
+
+		sender, err := transfer.NewSender(ctx, mailbox.FolderPath(d), false, false, nil)
+		if err != nil {
+			logf("Failed to read deposit %s: %v", d.ID, err)
+			transfer.WriteMailboxReply(stream, transfer.MailboxReply{Error: "deposit cannot be read"})
+			return
+		}
+		sender.Code = code
+		sender.Timeout = timeout
+		if err := transfer.WriteMailboxReply(stream, transfer.MailboxReply{ExpiresAt: d.ExpiresAt}); err != nil {
+			return
+		}
+
+		logf("Delivering %s to %s", d.FolderName, peerID[:12])
+		delivery, err := pushStream(ctx, sender, stream)
+		if err != nil {
+			logf("Delivering %s to %s failed: %v", d.FolderName, peerID[:12], err)
+			return
+		}
+		// Kept for another claim unless the receiver confirmed every file
+		delivered = delivery.Confirmed && len(delivery.Skipped) == 0
+		if delivered {
+			logf("Delivered %s to %s, deleted it", d.FolderName, peerID[:12])
+		}
+
+	default:
+		transfer.WriteMailboxReply(stream, transfer.MailboxReply{Error: fmt.Sprintf("unknown operation %q", req.Op)})
+	}
+}
+
+func mailboxList(args []string) {
+	fs := flag.NewFlagSet("mailbox-server list", flag.ExitOnError)
+	dir := fs.String("dir", serve.DefaultMailboxDir(), "Directory the deposits are kept in")
+	applyOutput := outputFlags(fs)
+	fs.Parse(args)
+	applyOutput()
+
+	deposits, err := (&serve.Mailbox{Dir: *dir}).List()
+	if err != nil {
+		fmt.Println(i18n.T("Error: %v", err))
+		os.Exit(1)
+	}
+	if deposits == nil {
+		deposits = []serve.Deposit{}
+	}
+	if printJSON(deposits) {
+		return
+	}
+	if len(deposits) == 0 {
+		fmt.Println("No deposits in the mailbox.")
+		return
+	}
+	for _, d := range deposits {
+		status := "ready"
+		if !d.Complete {
+			status = "receiving"
+		}
+		fmt.Printf("%s  %s  %-9s  %10s  %4d files  %s  expires %s\n",
+			d.ID, d.Stored.Local().Format("2006-01-02 15:04"), status, transfer.FormatBytes(d.Size), d.Files, d.FolderName, d.ExpiresAt.Local().Format("2006-01-02 15:04"))
+	}
+}
+
+// sealForMailbox encrypts the files at folderPath into a temporary folder
+// with a new claim code. The caller removes the folder in tmp.
+func sealForMailbox(folderPath string) (claimCode, sealed, tmp string, err error) {
+	claimCode, err = transfer.NewClaimCode()
+	if err != nil {
+		return "", "", "", err
+	}
+	_, secret, err := transfer.SplitClaimCode(claimCode)
+	if err != nil {
+		return "", "", "", err
+	}
+	key, err := transfer.NewEncryptionKey(secret)
+	if err != nil {
+		return "", "", "", err
+	}
+	tmp, err = os.MkdirTemp("", "2c1f-mailbox-")
+	if err != nil {
+		return "", "", "", err
+	}
+	sealed, err = transfer.EncryptFolder(folderPath, tmp, key)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return "", "", "", err
+	}
+	return claimCode, sealed, tmp, nil
+}
+
+// deposit stores the files of sender, encrypted by sealForMailbox, in the
+// mailbox with the sender's code and returns how it went and when the
+// mailbox deletes them. Like push the mailbox is looked up by its code.
+func deposit(ctx context.Context, node *p2p.Node, sender *transfer.Sender, folderPath, claimCode string, ttl time.Duration) (*transfer.Delivery, time.Time, error) {
+	id, _, err := transfer.SplitClaimCode(claimCode)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	infoln(i18n.T("Searching for mailbox..."))
+	peerID, err := node.FindPeer(sender.Code)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to find mailbox: %w", err)
+	}
+	fmt.Println(i18n.T("Verification code: %s", node.ShortAuthString(peerID, sender.Code)))
+
+	started := time.Now()
+	stream, err := node.NewMailboxStream(peerID)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to open stream: %w", err)
+	}
+	defer stream.Close()
+
+	reply, err := transfer.WriteMailboxRequest(stream, transfer.MailboxRequest{Op: transfer.MailboxDeposit, Claim: id, TTL: ttl})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	delivery, err := pushStream(ctx, sender, stream)
+	if err != nil {
+		return delivery, time.Time{}, err
+	}
+	recordTransfer(folderPath, sender.Manifest.TotalSize, "send", history.SendStatus(delivery.Confirmed), delivery.Root(), verifiedReceipt(delivery, peerID), peerID, started, delivery.Compression)
+	return delivery, reply.ExpiresAt, nil
+}
+
+// printClaim shows the receiver's claim code of a deposit
+func printClaim(mailboxCode, claimCode string, expires time.Time) {
+	if printJSON(jsonEvent{Event: "code", Code: claimCode}) {
+		return
+	}
+	fmt.Println(i18n.T("Stored in the mailbox until %s.", expires.Local().Format("2006-01-02 15:04")))
+	fmt.Println(i18n.T("Claim code: %s", claimCode))
+	fmt.Println(i18n.T("The receiver collects the files with: %s", fmt.Sprintf("2c1f receive -mailbox %s %s", mailboxCode, claimCode)))
+}
+
+// claim collects the deposit of claimCode from the mailbox with the code
+// mailboxCode with receiver, into its DestPath, and decrypts it. It returns
+// where it was saved, DestPath if it failed, and its size.
+func claim(ctx context.Context, node *p2p.Node, receiver *transfer.Receiver, mailboxCode, claimCode string, timeout time.Duration) (string, int64, error) {
+	destPath := receiver.DestPath
+	id, secret, err := transfer.SplitClaimCode(claimCode)
+	if err != nil {
+		return destPath, 0, err
+	}
+	infoln(i18n.T("Searching for mailbox..."))
+	peerID, err := node.FindPeer(mailboxCode)
+	if err != nil {
+		return destPath, 0, fmt.Errorf("failed to find mailbox: %w", err)
+	}
+
+	started := time.Now()
+	stream, err := node.NewMailboxStream(peerID)
+	if err != nil {
+		return destPath, 0, fmt.Errorf("failed to open stream: %w", err)
+	}
+	defer stream.Close()
+	if _, err := transfer.WriteMailboxRequest(stream, transfer.MailboxRequest{Op: transfer.MailboxClaim, Claim: id}); err != nil {
+		return destPath, 0, err
+	}
+
+	receiver.Code = mailboxCode
+	receiver.Timeout = timeout
+	receiver.Identity = node.PrivateKey()
+	var display *progressDisplay
+	progress := events.Progress{Emitter: events.Nop{}}
+	receiver.OnConfirmation = func(m *transfer.Manifest) bool {
+		infoln(i18n.T("Claiming %s (%s, %d files)", m.FolderName, transfer.FormatBytes(m.TotalSize), len(m.Files)))
+		display = newProgressDisplay("Receiving", m)
+		progress.Emitter = display
+		return true
+	}
+	receiver.OnStartFile = progress.StartFile
+	receiver.OnProgress = progress.Update
+	receiver.OnFileComplete = progress.FileComplete
+	if err := receiver.Receive(ctx, stream); err != nil {
+		return destPath, 0, err
+	}
+	if display != nil {
+		display.finish()
+	}
+
+	savedPath := receiver.LocalFolder()
+	infoln(i18n.T("Decrypting..."))
+	if err := transfer.DecryptFolder(savedPath, secret); err != nil {
+		return destPath, 0, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	recordTransfer(savedPath, receiver.Manifest.TotalSize, "receive", history.StatusComplete, "", nil, peerID, started, receiver.Compression)
+	return savedPath, receiver.Manifest.TotalSize, nil
+}
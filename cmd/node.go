@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"flag"
+	"io"
+	"strings"
+
+	"github.com/ebob10000/2c1f/p2p"
+)
+
+// nodeFlags adds the -listen, -port, -proxy, -no-upnp, -allow and -deny flags
+// to fs. The returned function
+// gives the node config once fs is parsed.
+func nodeFlags(fs *flag.FlagSet) func() p2p.Config {
+	listen := fs.String("listen", "", "Comma separated IP addresses, interface names or multiaddrs to listen on, all interfaces if empty")
+	port := fs.Int("port", 0, "Fixed TCP and QUIC port, e.g. for port forwarding, random if 0")
+	proxy := fs.String("proxy", "", "SOCKS5 proxy such as socks5://127.0.0.1:9050 for Tor, hides the IP addresses of both sides")
+	noUPnP := fs.Bool("no-upnp", false, "Do not ask the router to forward ports with UPnP or NAT-PMP")
+	allow := fs.String("allow", "", "Comma separated peer IDs, IPs or CIDR ranges that may connect, anyone if empty")
+	deny := fs.String("deny", "", "Comma separated peer IDs, IPs or CIDR ranges that may not connect")
+	bootstrap := fs.String("bootstrap-peers", "", "Comma separated multiaddrs of bootstrap peers to use instead of the public libp2p and IPFS peers")
+	return func() p2p.Config {
+		return p2p.Config{
+			Listen:    splitList(*listen),
+			Port:      *port,
+			Proxy:     *proxy,
+			NoPortMap: *noUPnP,
+			Access:    p2p.ParseAccessList(*allow, *deny),
+			Bootstrap: splitList(*bootstrap),
+		}
+	}
+}
+
+// splitList returns the non-empty items of a comma separated list
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// transferStream is a transfer stream over libp2p or a connection of the LAN
+// fallback, see p2p.ListenLAN
+type transferStream interface {
+	io.ReadWriteCloser
+	Reset() error
+}
+
+// lanFlag adds the -no-lan flag to fs. The returned function reports
+// whether the LAN fallback may be used with a node config, never through a
+// proxy that is there to hide the IP address.
+func lanFlag(fs *flag.FlagSet) func(cfg p2p.Config) bool {
+	noLAN := fs.Bool("no-lan", false, "Do not fall back to a direct connection on the local network when the P2P network fails")
+	return func(cfg p2p.Config) bool {
+		return !*noLAN && cfg.Proxy == ""
+	}
+}
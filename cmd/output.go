@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ebob10000/2c1f/hooks"
+	"github.com/ebob10000/2c1f/i18n"
+	"github.com/ebob10000/2c1f/p2p"
+	"github.com/ebob10000/2c1f/transfer"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+type outputLevel int
+
+const (
+	levelQuiet   outputLevel = iota // Only the code and the result
+	levelNormal                     // Status messages and progress
+	levelVerbose                    // Addresses, connection attempts and checksums
+)
+
+// output is set by the -q and -v flags
+var output = levelNormal
+
+// jsonOut receives results as JSON when --json is set, nil otherwise.
+// Messages then go to stderr, so stdout only holds JSON.
+var jsonOut io.Writer
+
+func setOutputLevel(quiet, verbose bool) {
+	switch {
+	case quiet:
+		output = levelQuiet
+	case verbose:
+		output = levelVerbose
+	default:
+		output = levelNormal
+	}
+}
+
+// SetOutput applies the global -q, -v and --json flags given before the
+// command. The flags of the command default to them.
+func SetOutput(quiet, verbose, asJSON bool) {
+	setOutputLevel(quiet, verbose)
+	if asJSON && jsonOut == nil {
+		jsonOut = os.Stdout
+		os.Stdout = os.Stderr
+	}
+}
+
+// outputFlags adds the global -q, -v and --json flags to fs. apply sets
+// them once fs is parsed.
+func outputFlags(fs *flag.FlagSet) (apply func()) {
+	quiet := fs.Bool("q", output == levelQuiet, "Only print the code and the result")
+	verbose := fs.Bool("v", output == levelVerbose, "Print addresses, connection attempts and checksums")
+	asJSON := fs.Bool("json", jsonOut != nil, "Print results as JSON, messages go to stderr")
+	return func() {
+		SetOutput(*quiet, *verbose, *asJSON)
+	}
+}
+
+// printJSON writes v as a line of JSON if --json is set, and reports
+// whether it did
+func printJSON(v any) bool {
+	if jsonOut == nil {
+		return false
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return true
+	}
+	fmt.Fprintln(jsonOut, string(data))
+	return true
+}
+
+// infof prints a status message, hidden with -q
+func infof(format string, a ...interface{}) {
+	if output >= levelNormal {
+		fmt.Printf(format, a...)
+	}
+}
+
+// infoln is infof with fmt.Println formatting
+func infoln(a ...interface{}) {
+	if output >= levelNormal {
+		fmt.Println(a...)
+	}
+}
+
+// debugf prints details that are only shown with -v
+func debugf(format string, a ...interface{}) {
+	if output >= levelVerbose {
+		fmt.Printf(format, a...)
+	}
+}
+
+// jsonEvent is a line printed with --json by send and receive
+type jsonEvent struct {
+	Event     string `json:"event"` // "code" once a send can be received, "done" when a transfer ended
+	Code      string `json:"code,omitempty"`
+	Direction string `json:"direction,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	Status    string `json:"status,omitempty"` // See hooks.Status
+	Peer      string `json:"peer,omitempty"`
+	Error     string `json:"error,omitempty"`
+	// Summary tells how a transfer that got to its files went
+	Summary *transfer.Summary `json:"summary,omitempty"`
+}
+
+// printDone prints a transfer that ended with err as JSON if --json is set
+func printDone(direction, path string, size int64, peerID peer.ID, summary transfer.Summary, err error) {
+	event := jsonEvent{Event: "done", Direction: direction, Path: path, Size: size, Status: hooks.Status(err)}
+	if summary.Elapsed > 0 {
+		event.Summary = &summary
+	}
+	if peerID != "" {
+		event.Peer = peerID.String()
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	printJSON(event)
+}
+
+// debugAddrs prints the addresses the node listens on with its ID, so
+// browsers and other peers can dial them as printed
+func debugAddrs(node *p2p.Node) {
+	addrs, err := peer.AddrInfoToP2pAddrs(&peer.AddrInfo{ID: node.Host.ID(), Addrs: node.Host.Addrs()})
+	if err != nil {
+		return
+	}
+	for _, addr := range addrs {
+		debugf("Listening on %s\n", addr)
+	}
+}
+
+// debugDial prints a connection attempt, see p2p.Node.SetDialHandler
+func debugDial(pi peer.AddrInfo, err error) {
+	if err != nil {
+		debugf("Connecting to %s failed: %v\n", pi.ID.ShortString(), err)
+		return
+	}
+	debugf("Connected to %s via %v\n", pi.ID.ShortString(), pi.Addrs)
+}
+
+// reportBootstrap prints the outcome of trying a set of bootstrap peers, see
+// p2p.Node.OnBootstrap
+func reportBootstrap(set string, err error) {
+	if err != nil {
+		infoln(i18n.T("Could not reach the %s bootstrap peers: %v", set, err))
+		return
+	}
+	debugf("%s\n", i18n.T("Connected through the %s bootstrap peers", set))
+}
+
+// fileChecksums maps each file of m to its checksum, nil unless -v is set
+func fileChecksums(m *transfer.Manifest) map[string]string {
+	if output < levelVerbose {
+		return nil
+	}
+	checksums := make(map[string]string, len(m.Files))
+	for _, f := range m.Files {
+		checksums[f.Path] = f.Checksum
+	}
+	return checksums
+}
+
+// debugChecksum prints the checksum of a file once it was transferred
+func debugChecksum(checksums map[string]string, filename string) {
+	if checksums == nil {
+		return
+	}
+	if sum := checksums[filename]; sum != "" {
+		debugf("  %s: checksum %s\n", filename, sum)
+	} else {
+		debugf("  %s: not hashed\n", filename)
+	}
+}
+
+// estimate describes how long size bytes take over a probed link
+func estimate(probe p2p.Probe, size int64) string {
+	eta, speed := probe.Estimate(size).Round(time.Second).String(), transfer.FormatBytes(int64(probe.Throughput))
+	if probe.Relayed {
+		return i18n.T("Estimated time: ~%s at %s/s (relayed, a direct connection may be faster)", eta, speed)
+	}
+	return i18n.T("Estimated time: ~%s at %s/s", eta, speed)
+}
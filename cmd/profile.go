@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ebob10000/2c1f/i18n"
+	"github.com/ebob10000/2c1f/settings"
+)
+
+// ApplyProfile sets the options of the named profile on fs, except the
+// flags given on the command line, which win. Options fs does not define,
+// such as send options for a receive, are ignored.
+func ApplyProfile(fs *flag.FlagSet, s settings.AppSettings, name string) error {
+	flags, err := s.ProfileFlags(name)
+	if err != nil {
+		return err
+	}
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for flagName, value := range flags {
+		if given[flagName] || fs.Lookup(flagName) == nil {
+			continue
+		}
+		if err := fs.Set(flagName, value); err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ApplyEnv sets the options of the environment on fs, see
+// settings.EnvFlags. Flags given on the command line or by a profile win,
+// as do flags they set under another name, such as -dest for -o. Variables
+// for options fs does not define are ignored.
+func ApplyEnv(fs *flag.FlagSet) error {
+	flags, err := settings.EnvFlags()
+	if err != nil {
+		return err
+	}
+	given := make(map[flag.Value]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Value] = true })
+	for name, value := range flags {
+		f := fs.Lookup(name)
+		if f == nil || given[f.Value] {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("environment: -%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// applyEnv is ApplyEnv for the commands, which exit on invalid values
+func applyEnv(fs *flag.FlagSet) {
+	if err := ApplyEnv(fs); err != nil {
+		fmt.Println(i18n.T("Error: %v", err))
+		os.Exit(1)
+	}
+}
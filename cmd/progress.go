@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ebob10000/2c1f/events"
+	"github.com/ebob10000/2c1f/transfer"
+	"golang.org/x/term"
+)
+
+const (
+	progressWidth    = 20
+	progressInterval = 100 * time.Millisecond
+)
+
+// progressDisplay renders two lines: the whole transfer with speed and ETA,
+// and the current file below it. Bytes that were already transferred before
+// a resume count towards the total but not towards the speed.
+type progressDisplay struct {
+	out   io.Writer
+	tty   bool
+	verb  string // "Sending" or "Receiving"
+	total int64
+
+	mu        sync.Mutex
+	offsets   map[string]int64 // Start of each file within the transfer
+	sizes     map[string]int64
+	file      string
+	fileSize  int64
+	filePos   int64
+	fresh     bool // No progress seen for file since it started
+	index     int
+	count     int
+	done      int64
+	moved     int64 // Bytes moved over the network on this connection
+	started   time.Time
+	lastDraw  time.Time
+	drawn     bool
+	completed bool
+}
+
+func newProgressDisplay(verb string, m *transfer.Manifest) *progressDisplay {
+	// Verbose output is printed between files, so the display can't redraw
+	p := &progressDisplay{
+		out:     os.Stdout,
+		tty:     output == levelNormal && term.IsTerminal(int(os.Stdout.Fd())),
+		verb:    verb,
+		total:   m.TotalSize,
+		offsets: make(map[string]int64, len(m.Files)),
+		sizes:   make(map[string]int64, len(m.Files)),
+	}
+	var offset int64
+	for _, f := range m.Files {
+		p.offsets[f.Path] = offset
+		p.sizes[f.Path] = f.Size
+		offset += f.Size
+	}
+	if output == levelQuiet {
+		p.out = io.Discard
+	}
+	return p
+}
+
+// startFile matches the OnStartFile callbacks. Files are sent in manifest
+// order, so everything before filename is complete, including files that
+// were skipped because the receiver already had them.
+func (p *progressDisplay) startFile(filename string, index, total int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.file, p.index, p.count = filename, index, total
+	p.filePos, p.fileSize, p.fresh = 0, p.sizes[filename], true
+	p.done = p.offsets[filename]
+	if p.started.IsZero() {
+		p.started = time.Now()
+	}
+	if !p.tty {
+		fmt.Fprintf(p.out, "%s %s (%d/%d)\n", p.verb, filename, index, total)
+		return
+	}
+	p.draw()
+}
+
+// update matches the OnProgress callbacks, pos includes the resume offset
+func (p *progressDisplay) update(filename string, pos, size int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if filename != p.file {
+		return
+	}
+	// The first update of a file jumps over its resume offset
+	if !p.fresh && pos > p.filePos {
+		p.moved += pos - p.filePos
+	}
+	p.fresh = false
+	p.filePos, p.fileSize = pos, size
+	p.done = p.offsets[filename] + pos
+
+	if !p.tty || time.Since(p.lastDraw) < progressInterval && pos < size {
+		return
+	}
+	p.draw()
+}
+
+// fileComplete matches the OnFileComplete callbacks and lists the file
+// above the display, with a check mark or a cross if it failed
+func (p *progressDisplay) fileComplete(filename string, verified bool, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	line := "✓ " + filename
+	switch {
+	case err != nil:
+		line = fmt.Sprintf("✗ %s: %v", filename, err)
+	case !verified:
+		line += " (not verified)"
+	}
+	p.above(func() { fmt.Fprintln(p.out, line) })
+}
+
+// Emit draws the events of events.Progress, which the transfer callbacks
+// are routed through, and prints other events above the display with
+// events.Writer
+func (p *progressDisplay) Emit(name string, data ...interface{}) {
+	var d interface{}
+	if len(data) > 0 {
+		d = data[0]
+	}
+	switch e := d.(type) {
+	case events.FileStarted:
+		p.startFile(e.Filename, e.Index, e.Total)
+	case events.FileProgressed:
+		p.update(e.Filename, e.Sent, e.Total)
+	case events.FileCompleted:
+		var err error
+		if e.Error != "" {
+			err = errors.New(e.Error)
+		}
+		p.fileComplete(e.Filename, e.Verified, err)
+	default:
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.above(func() { events.NewWriter(p.out).Emit(name, data...) })
+	}
+}
+
+// above prints with print above the display, which is drawn again below
+func (p *progressDisplay) above(print func()) {
+	if p.tty && p.drawn {
+		fmt.Fprint(p.out, "\r\033[1A\r\033[J")
+		p.drawn = false
+		print()
+		p.draw()
+		return
+	}
+	print()
+}
+
+// reconnected is called before the transfer continues on a new connection
+func (p *progressDisplay) reconnected() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.drawn = false
+	p.fresh = true
+	p.moved = 0
+	p.started = time.Now()
+}
+
+// next starts over for another receiver after a finished transfer
+func (p *progressDisplay) next() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.drawn, p.completed = false, false
+	p.fresh = true
+	p.done, p.moved = 0, 0
+	p.started = time.Time{}
+}
+
+// finish draws the final state and moves below the display
+func (p *progressDisplay) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.completed {
+		return
+	}
+	p.completed = true
+	p.done = p.total
+	p.filePos = p.fileSize
+	if !p.tty {
+		fmt.Fprintln(p.out, p.overallLine())
+		return
+	}
+	p.draw()
+	fmt.Fprintln(p.out)
+}
+
+func (p *progressDisplay) draw() {
+	if p.drawn {
+		// Back to the start of the first line
+		fmt.Fprint(p.out, "\r\033[1A")
+	}
+	fmt.Fprintf(p.out, "\r\033[K%s\n\r\033[K%s", p.overallLine(), p.fileLine())
+	p.drawn = true
+	p.lastDraw = time.Now()
+}
+
+func (p *progressDisplay) overallLine() string {
+	filled := 0
+	if p.total > 0 {
+		filled = int(p.done * progressWidth / p.total)
+	}
+	if filled > progressWidth {
+		filled = progressWidth
+	}
+	bar := strings.Repeat("=", filled)
+	if filled < progressWidth {
+		bar += ">" + strings.Repeat(" ", progressWidth-filled-1)
+	}
+
+	line := fmt.Sprintf("%s [%s] %3d%% %s / %s", p.verb, bar, percent(p.done, p.total),
+		transfer.FormatBytes(p.done), transfer.FormatBytes(p.total))
+
+	elapsed := time.Since(p.started).Seconds()
+	if p.moved > 0 && elapsed > 0 {
+		speed := float64(p.moved) / elapsed
+		line += fmt.Sprintf("  %s/s", transfer.FormatBytes(int64(speed)))
+		if remaining := p.total - p.done; remaining > 0 {
+			eta := time.Duration(float64(remaining) / speed * float64(time.Second))
+			line += fmt.Sprintf("  ETA %s", eta.Round(time.Second))
+		}
+	}
+	return line
+}
+
+func (p *progressDisplay) fileLine() string {
+	if p.file == "" {
+		return ""
+	}
+	return fmt.Sprintf("  %s (%d/%d) %d%%", p.file, p.index, p.count, percent(p.filePos, p.fileSize))
+}
+
+func percent(n, total int64) int64 {
+	if total <= 0 {
+		return 100
+	}
+	return n * 100 / total
+}
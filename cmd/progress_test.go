@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ebob10000/2c1f/events"
+	"github.com/ebob10000/2c1f/transfer"
+)
+
+func testDisplay(tty bool) (*progressDisplay, *bytes.Buffer) {
+	m := &transfer.Manifest{
+		TotalSize: 300,
+		Files: []transfer.FileEntry{
+			{Path: "a.txt", Size: 100},
+			{Path: "b.txt", Size: 200},
+		},
+	}
+	var out bytes.Buffer
+	p := newProgressDisplay("Sending", m)
+	p.out, p.tty = &out, tty
+	return p, &out
+}
+
+func TestProgressResume(t *testing.T) {
+	p, _ := testDisplay(false)
+
+	// a.txt was complete before the resume, b.txt continues at 150
+	p.startFile("b.txt", 2, 2)
+	if p.done != 100 {
+		t.Errorf("done = %d at the start of b.txt, want 100", p.done)
+	}
+	p.update("b.txt", 150, 200)
+	if p.done != 250 || p.moved != 0 {
+		t.Errorf("done = %d, moved = %d after jumping to the resume offset, want 250 and 0", p.done, p.moved)
+	}
+	p.update("b.txt", 180, 200)
+	if p.done != 280 || p.moved != 30 {
+		t.Errorf("done = %d, moved = %d, want 280 and 30", p.done, p.moved)
+	}
+	if got := p.fileLine(); !strings.Contains(got, "b.txt (2/2) 90%") {
+		t.Errorf("fileLine() = %q, want b.txt at 90%%", got)
+	}
+	if got := p.overallLine(); !strings.Contains(got, " 93% ") {
+		t.Errorf("overallLine() = %q, want 93%%", got)
+	}
+
+	// Updates of another file do not move the display
+	p.update("a.txt", 100, 100)
+	if p.done != 280 {
+		t.Errorf("done = %d after an update of another file, want 280", p.done)
+	}
+}
+
+func TestProgressReconnected(t *testing.T) {
+	p, _ := testDisplay(false)
+	p.startFile("a.txt", 1, 2)
+	p.update("a.txt", 10, 100)
+	p.update("a.txt", 60, 100)
+
+	// The new connection resumes where the receiver got to
+	p.reconnected()
+	p.update("a.txt", 40, 100)
+	if p.moved != 0 || p.done != 40 {
+		t.Errorf("moved = %d, done = %d after reconnecting, want 0 and 40", p.moved, p.done)
+	}
+	p.update("a.txt", 70, 100)
+	if p.moved != 30 {
+		t.Errorf("moved = %d, want 30", p.moved)
+	}
+
+	p.finish()
+	p.next()
+	if p.done != 0 || p.moved != 0 || p.completed {
+		t.Errorf("next() left done = %d, moved = %d, completed = %v", p.done, p.moved, p.completed)
+	}
+}
+
+func TestProgressPlainOutput(t *testing.T) {
+	p, out := testDisplay(false)
+	p.startFile("a.txt", 1, 2)
+	p.update("a.txt", 100, 100)
+	p.fileComplete("a.txt", true, nil)
+	p.startFile("b.txt", 2, 2)
+	p.fileComplete("b.txt", false, nil)
+	p.finish()
+	p.finish()
+
+	want := []string{"Sending a.txt (1/2)", "✓ a.txt", "Sending b.txt (2/2)", "✓ b.txt (not verified)"}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != len(want)+1 {
+		t.Fatalf("Got %d lines, want %d:\n%s", len(lines), len(want)+1, out)
+	}
+	for i, w := range want {
+		if lines[i] != w {
+			t.Errorf("Line %d = %q, want %q", i+1, lines[i], w)
+		}
+	}
+	if last := lines[len(want)]; !strings.Contains(last, "[====================] 100%") {
+		t.Errorf("Final line = %q, want a full bar", last)
+	}
+	if strings.Contains(out.String(), "\033") {
+		t.Error("Plain output contains terminal escapes")
+	}
+}
+
+func TestProgressTerminal(t *testing.T) {
+	p, out := testDisplay(true)
+	p.startFile("a.txt", 1, 2)
+	if strings.Contains(out.String(), "\033[1A") {
+		t.Error("The first draw moved up over earlier output")
+	}
+	p.fileComplete("a.txt", false, errors.New("test error"))
+	// The failed file replaces the display, which is drawn again below it
+	if !strings.Contains(out.String(), "\033[J✗ a.txt: test error\n") {
+		t.Errorf("Output %q does not list the failed file above the display", out)
+	}
+	if n := strings.Count(out.String(), "Sending ["); n != 2 {
+		t.Errorf("Display drawn %d times, want 2", n)
+	}
+
+	// Updates in quick succession are drawn once
+	p.startFile("b.txt", 2, 2)
+	out.Reset()
+	p.update("b.txt", 10, 200)
+	p.update("b.txt", 20, 200)
+	if out.Len() != 0 {
+		t.Errorf("Updates within %v drew %q", progressInterval, out)
+	}
+	p.update("b.txt", 200, 200)
+	if !strings.Contains(out.String(), "b.txt (2/2) 100%") {
+		t.Errorf("The last update of a file was not drawn: %q", out)
+	}
+}
+
+func TestProgressEvents(t *testing.T) {
+	p, out := testDisplay(false)
+	progress := events.Progress{Emitter: p}
+	progress.StartFile("a.txt", 1, 2)
+	progress.Update("a.txt", 40, 100)
+	if p.done != 40 {
+		t.Errorf("done = %d after a progress event, want 40", p.done)
+	}
+	progress.FileComplete("a.txt", true, nil)
+	progress.StartFile("b.txt", 2, 2)
+	progress.FileComplete("b.txt", false, errors.New("test error"))
+	p.Emit("log", "Reconnecting...")
+
+	want := "Sending a.txt (1/2)\n✓ a.txt\nSending b.txt (2/2)\n✗ b.txt: test error\nlog: Reconnecting...\n"
+	if out.String() != want {
+		t.Errorf("Output %q, want %q", out, want)
+	}
+}
@@ -2,32 +2,88 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"syscall"
 	"time"
 
+	"github.com/ebob10000/2c1f/events"
+	"github.com/ebob10000/2c1f/history"
+	"github.com/ebob10000/2c1f/hooks"
+	"github.com/ebob10000/2c1f/i18n"
 	"github.com/ebob10000/2c1f/p2p"
+	"github.com/ebob10000/2c1f/settings"
+	"github.com/ebob10000/2c1f/storage"
 	"github.com/ebob10000/2c1f/transfer"
-	"github.com/schollz/progressbar/v3"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"golang.org/x/term"
 )
 
 func Receive(args []string) {
 	fs := flag.NewFlagSet("receive", flag.ExitOnError)
-	outputDir := fs.String("o", "", "Output directory")
+	outputDir := fs.String("o", "", "Output directory or storage URL")
+	fs.StringVar(outputDir, "dest", "", "Storage URL such as s3://bucket/prefix or webdav://host/path, same as -o")
 	fastResume := fs.Bool("fast-resume", false, "Enable fast resume (skip hashing existing files)")
+	paranoid := fs.Bool("paranoid", false, "Check existing files block by block instead of taking those with a matching checksum as complete")
+	var checksumAlgo checksumFlag
+	fs.Var(&checksumAlgo, "write-checksums", "Write a SHA256SUMS file of the received files next to their folder, =blake3 for a B3SUMS file")
+	var syncPolicy syncFlag
+	fs.Var(&syncPolicy, "sync", "When to sync received files to disk: never, file (each once complete) or every N MB, 8 by default (file with -strict)")
+	noPreallocate := fs.Bool("no-preallocate", false, "Do not reserve disk space for files before they arrive, for file systems where that is slow")
+	directIO := fs.Bool("direct-io", false, "Write files without the page cache, for very fast disks and links")
+	renameExisting := fs.Bool("rename-existing", false, "Save as \"Name (2)\" if the folder exists with other files in it")
+	incognitoFlag(fs)
+	summaryFlag(fs)
+	maxFiles := fs.Int("max-files", transfer.DefaultMaxFiles, "Refuse transfers with more files, -1 for unlimited")
+	maxDepth := fs.Int("max-depth", transfer.DefaultMaxDepth, "Refuse transfers with paths nested in more folders, -1 for unlimited")
+	maxFileMB := fs.Int64("max-file-mb", 0, "Refuse transfers with a larger file in megabytes, 0 for unlimited")
+	maxTotalMB := fs.Int64("max-total-mb", 0, "Refuse transfers larger than this many megabytes, 0 for unlimited")
+	timeout := fs.Duration("timeout", transfer.StreamTimeout, "Stream inactivity timeout")
+	maxRetries := fs.Int("retries", transfer.MaxRetries, "Reconnection attempts after an interrupted transfer")
+	findTimeout := fs.Duration("find-timeout", p2p.DefaultFindTimeout, "Timeout for locating the sender")
+	bootstrapTimeout := fs.Duration("bootstrap-timeout", p2p.DefaultBootstrapTimeout, "Timeout for each bootstrap peer connection")
+	strict := fs.Bool("strict", false, "Require confirming the verification code before receiving")
+	expectPeer := fs.String("peer", "", "Only accept the sender with this peer ID, shown by send -show-peer")
+	password := fs.String("password", "", "Password set by the sender")
+	encrypt := fs.Bool("encrypt", false, "Encrypt received files on disk with a passphrase (see 2c1f decrypt)")
+	segmented := fs.Bool("segmented", false, "Have large files sent in 64 MB segments, each checked on arrival")
+	dedup := fs.Bool("dedup", false, "Keep blocks of received files and take those you have from earlier transfers instead of the sender")
+	share := fs.String("share", "", "Label of the share to receive from a sender offering several with 2c1f share")
+	mailbox := fs.String("mailbox", "", "Claim the files with the claim code from a mailbox running 2c1f mailbox-server with this code")
+	applyOutput := outputFlags(fs)
+	profile := fs.String("profile", "", "Use the options of a profile from the settings")
+	onComplete := fs.String("on-complete", "", "Command to run when the transfer completes or fails, {path}, {size}, {status} and {peer} are replaced")
+	scan := fs.String("scan", "", "Virus scanner command to run on each received file before it is complete, {file} is replaced")
+	noQuarantine := fs.Bool("no-quarantine", false, "Do not mark received programs and installers for Gatekeeper on macOS")
+	keepRejected := fs.Bool("keep-rejected", false, "Move files the -scan command rejects to the rejected folder and go on, instead of removing them and failing")
+	nodeConfig := nodeFlags(fs)
+	lanAllowed := lanFlag(fs)
+	openAudit := auditFlag(fs)
 	fs.Parse(args)
+	if *profile != "" {
+		if err := ApplyProfile(fs, settings.LoadSettings(), *profile); err != nil {
+			fmt.Println(i18n.T("Error: %v", err))
+			os.Exit(1)
+		}
+	}
+	applyEnv(fs)
+	applyOutput()
+	trimCache()
 
 	code := fs.Arg(0)
 	if code == "" {
-		fmt.Print("Enter connection code: ")
+		fmt.Print(i18n.T("Enter connection code: "))
 		fmt.Scanln(&code)
 	}
 	if code == "" {
-		fmt.Println("Error: Code required")
+		fmt.Println(i18n.T("Error: Code required"))
 		os.Exit(1)
 	}
 
@@ -40,8 +96,66 @@ func Receive(args []string) {
 		}
 	}
 
-	fmt.Printf("Code: %s\n", code)
-	fmt.Printf("Destination: %s\n", destPath)
+	var backend storage.Backend
+	if storage.IsURL(destPath) {
+		var err error
+		backend, err = storage.New(destPath)
+		if err != nil {
+			fmt.Println(i18n.T("Error: %v", err))
+			os.Exit(1)
+		}
+		// Without the credentials a WebDAV URL may hold
+		destPath = fmt.Sprint(backend)
+	}
+
+	if *mailbox != "" {
+		if _, _, err := transfer.SplitClaimCode(code); err != nil {
+			fmt.Println(i18n.T("Error: %v", err))
+			os.Exit(1)
+		}
+		if backend != nil || *encrypt {
+			fmt.Println(i18n.T("Error: %v", "-mailbox needs a local output directory and cannot be combined with -encrypt"))
+			os.Exit(1)
+		}
+	}
+	if *scan != "" && (backend != nil || *encrypt) {
+		fmt.Println(i18n.T("Error: %v", "-scan needs a local output directory and cannot be combined with -encrypt"))
+		os.Exit(1)
+	}
+
+	var expected peer.ID
+	if *expectPeer != "" {
+		var err error
+		if expected, err = peer.Decode(*expectPeer); err != nil {
+			fmt.Println(i18n.T("Error: %v", fmt.Errorf("invalid peer ID %q: %w", *expectPeer, err)))
+			os.Exit(1)
+		}
+	}
+
+	infoln(i18n.T("Code: %s", code))
+	infoln(i18n.T("Destination: %s", destPath))
+
+	audit := openAudit()
+	defer audit.Close()
+	begun := time.Now()
+	audit.Record(transfer.AuditEvent{Event: transfer.AuditStart, Options: map[string]interface{}{
+		"role":    "receive",
+		"dest":    destPath,
+		"strict":  *strict,
+		"encrypt": *encrypt,
+		"mailbox": *mailbox != "",
+		"scan":    *scan,
+	}})
+
+	var encryption *transfer.EncryptionKey
+	if *encrypt {
+		var err error
+		encryption, err = newEncryptionKey()
+		if err != nil {
+			fmt.Println(i18n.T("Error: %v", err))
+			os.Exit(1)
+		}
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -50,159 +164,525 @@ func Receive(args []string) {
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		<-sigChan
-		fmt.Println("\nShutting down...")
+		infoln("\n" + i18n.T("Shutting down..."))
 		cancel()
 	}()
 
-	fmt.Println("Starting P2P node...")
-	node, err := p2p.NewNode(ctx)
+	infoln(i18n.T("Starting P2P node..."))
+	cfg := nodeConfig()
+	node, err := p2p.NewNodeWithConfig(ctx, cfg)
 	if err != nil {
-		fmt.Printf("Error: Failed to create P2P node: %v\n", err)
+		fmt.Println(i18n.T("Error: Failed to create P2P node: %v", err))
 		os.Exit(1)
 	}
 	defer node.Close()
+	node.BootstrapTimeout = *bootstrapTimeout
+	node.FindTimeout = *findTimeout
+	node.SetDialHandler(debugDial)
+	node.OnBootstrap = reportBootstrap
 
-	fmt.Printf("Node ID: %s\n", node.Host.ID().String()[:12])
+	infoln(i18n.T("Node ID: %s", node.Host.ID().String()[:12]))
+	debugAddrs(node)
 
-	fmt.Println("Connecting to network...")
+	// A failure is only reported if the sender is not on the local
+	// network either
+	var netErr string
+	infoln(i18n.T("Connecting to network..."))
 	if err := node.Bootstrap(); err != nil {
-		fmt.Printf("Error: Failed to bootstrap: %v\n", err)
-		os.Exit(1)
+		netErr = i18n.T("Error: Failed to bootstrap: %v", err)
+	} else {
+		debugf("Connected to %d peers\n", len(node.Host.Network().Peers()))
 	}
 
-	fmt.Println("Searching for sender...")
-	peerID, err := node.FindPeer(code)
-	if err != nil {
-		fmt.Printf("Error: Failed to find peer: %v\n", err)
-		os.Exit(1)
+	if *mailbox != "" {
+		if netErr != "" {
+			fmt.Println(netErr)
+			os.Exit(1)
+		}
+		receiver := transfer.NewReceiver(destPath)
+		savedPath, size, err := claim(ctx, node, receiver, *mailbox, code, *timeout)
+		auditEnd(audit, "", size, begun, "", err)
+		summary := receiver.Summary()
+		printSummary(summary, err)
+		printDone("receive", savedPath, size, "", summary, err)
+		runHook(*onComplete, "receive", savedPath, size, "", err)
+		if err != nil {
+			fmt.Println(i18n.T("Error: Transfer failed: %v", err))
+			os.Exit(1)
+		}
+		infoln()
+		fmt.Println(i18n.T("Files saved to: %s", savedPath))
+		return
 	}
 
-	stream, err := node.NewStream(peerID)
-	if err != nil {
-		fmt.Printf("Error: Failed to open stream: %v\n", err)
+	var peerID peer.ID
+	node.ChoosePeer = choosePeer(node, code)
+	node.ExpectPeer = expected
+	if netErr == "" {
+		infoln(i18n.T("Searching for sender..."))
+		if peerID, err = node.FindPeer(code); errors.Is(err, p2p.ErrWithdrawn) {
+			fmt.Println(i18n.T("The sender cancelled this transfer."))
+			os.Exit(1)
+		} else if errors.Is(err, p2p.ErrDuplicatePeers) {
+			fmt.Println(i18n.T("Error: Failed to find peer: %v", err))
+			os.Exit(1)
+		} else if err != nil {
+			netErr = i18n.T("Error: Failed to find peer: %v", err)
+		}
+	}
+
+	// Connections of the LAN fallback carry the same identities, so the
+	// verification code matches the sender's
+	lan := netErr != ""
+	dialLAN := func() (*p2p.LANConn, error) {
+		ctx, cancel := context.WithTimeout(ctx, p2p.DefaultLANTimeout)
+		defer cancel()
+		conn, err := p2p.DialLAN(ctx, code, node.PrivateKey(), cfg)
+		if err == nil && expected != "" && conn.Remote != expected {
+			conn.Reset()
+			return nil, fmt.Errorf("the sender on the local network is not %s", expected)
+		}
+		return conn, err
+	}
+	var stream transferStream
+	if lan {
+		if !lanAllowed(cfg) {
+			fmt.Println(netErr)
+			os.Exit(1)
+		}
+		infoln(i18n.T("Searching the local network..."))
+		conn, err := dialLAN()
+		if err != nil {
+			debugf("LAN fallback failed: %v\n", err)
+			fmt.Println(netErr)
+			os.Exit(1)
+		}
+		peerID = conn.Remote
+		stream = conn
+		debugf("Sender address: %s (local network)\n", conn.RemoteAddr())
+	}
+
+	if !verifyPeer(node, peerID, code, *strict) {
+		fmt.Println(i18n.T("Verification codes did not match. Aborting."))
 		os.Exit(1)
 	}
-	defer stream.Close()
+	audit.Record(transfer.AuditEvent{Event: transfer.AuditConnect, Peer: peerID.String(), Options: map[string]interface{}{"lan": lan}})
+
+	// Measured before the transfer stream opens, so the sender can decide
+	// on compression. Older senders do not answer probes.
+	var probe p2p.Probe
+	probed := false
+	var monitor *p2p.Monitor
+	if !lan {
+		probe, err = node.ProbeThroughput(ctx, peerID, code)
+		probed = err == nil
+		if !probed {
+			debugf("Throughput probe failed: %v\n", err)
+		}
+
+		libp2pStream, err := node.NewStream(peerID)
+		if err != nil {
+			fmt.Println(i18n.T("Error: Failed to open stream: %v", err))
+			os.Exit(1)
+		}
+		stream = libp2pStream
+		debugf("Sender address: %s\n", libp2pStream.Conn().RemoteMultiaddr())
+
+		monitor = node.NewMonitor(peerID)
+		monitor.OnMigrate = func() {
+			infoln("\n" + i18n.T("Direct connection established, migrating transfer..."))
+		}
+		monitor.Track(libp2pStream)
+		monitor.Start()
+		defer monitor.Stop()
+	}
+	defer func() { stream.Close() }()
 
 	receiver := transfer.NewReceiver(destPath)
+	// ended records a transfer that did not finish, so 2c1f resume can
+	// continue it, and runs the -on-complete command
+	ended := func(err error) {
+		var size int64
+		if receiver.Manifest != nil {
+			size = receiver.Manifest.TotalSize
+		}
+		if err != nil {
+			record := unfinishedRecord(receiver.LocalFolder(), size, "receive", err)
+			record.Transferred = receiver.Received()
+			record.Peer = peerID.String()
+			record.Dest = destPath
+			if backend == nil {
+				record.Dest = absPath(destPath)
+			}
+			// Resuming would not encrypt the rest, so it starts over instead
+			if encryption == nil {
+				record.Code = code
+			}
+			if saveRecord(record) && record.Resumable() {
+				infoln(i18n.T("Resume with: %s", "2c1f resume -last"))
+			}
+		}
+		auditEnd(audit, peerID, receiver.Received(), begun, receiver.Root(), err)
+		summary := receiver.Summary()
+		printSummary(summary, err)
+		printDone("receive", receiver.LocalFolder(), size, peerID, summary, err)
+		runHook(*onComplete, "receive", receiver.LocalFolder(), size, peerID, err)
+	}
 	receiver.Code = code
+	receiver.Password = *password
+	receiver.Share = *share
+	if *segmented {
+		receiver.SegmentSize = transfer.DefaultSegmentSize
+	}
+	if *dedup {
+		receiver.BlockStore = transfer.NewBlockStore("")
+	}
 	receiver.FastResume = *fastResume
+	receiver.Paranoid = *paranoid
+	receiver.RenameExisting = *renameExisting
+	receiver.Checksums = string(checksumAlgo)
+	receiver.NoPreallocate = *noPreallocate
+	receiver.DirectIO = *directIO
+	receiver.Sync, receiver.JournalInterval = syncPolicy.policy, syncPolicy.interval
+	if *strict && !syncPolicy.set {
+		// Files reported complete in strict mode survive a power failure
+		receiver.Sync = transfer.SyncFile
+	}
+	receiver.Limits = transfer.Limits{
+		MaxFiles:     *maxFiles,
+		MaxDepth:     *maxDepth,
+		MaxFileSize:  *maxFileMB << 20,
+		MaxTotalSize: *maxTotalMB << 20,
+	}
+	receiver.Encryption = encryption
+	receiver.Storage = backend
+	receiver.Timeout = *timeout
+	receiver.Identity = node.PrivateKey()
+	receiver.Audit = audit
+	receiver.Quarantine = !*noQuarantine
+	if *scan != "" {
+		receiver.Scan = func(path string) error {
+			return hooks.Scan(ctx, *scan, path)
+		}
+		if *keepRejected {
+			receiver.RejectedDir = hooks.RejectedDir()
+		}
+	}
+	if !lan {
+		receiver.DataStream = func(ctx context.Context, token []byte) (io.ReadWriteCloser, error) {
+			s, err := node.NewDataStream(ctx, peerID, token)
+			if err != nil {
+				return nil, err
+			}
+			// File data flows here, so this is the stream to reset on migration
+			monitor.Track(s)
+			return s, nil
+		}
+	}
+
+	var waitingUntil time.Time
+	receiver.OnWait = func(until time.Time) {
+		if !until.Equal(waitingUntil) {
+			waitingUntil = until
+			infoln(i18n.T("Sender scheduled the transfer, waiting until %s...", until.Local().Format("2006-01-02 15:04")))
+		}
+	}
 
 	receiver.OnConfirmation = func(m *transfer.Manifest) bool {
-		fmt.Println("\nIncoming Transfer:")
-		fmt.Printf("  Name: %s\n", m.FolderName)
-		fmt.Printf("  Size: %s\n", transfer.FormatBytes(m.TotalSize))
-		fmt.Printf("  Files: %d\n", len(m.Files))
+		fmt.Println("\n" + i18n.T("Incoming Transfer:"))
+		fmt.Println("  " + i18n.T("Name: %s", m.FolderName))
+		fmt.Println("  " + i18n.T("Size: %s", transfer.FormatBytes(m.TotalSize)))
+		fmt.Println("  " + i18n.T("Files: %d", len(m.Files)))
+		if m.Root != "" {
+			fmt.Println("  " + i18n.T("Fingerprint: %s", transfer.Fingerprint(m.Root)))
+		}
 
 		var existingSize int64
-		destFolder := filepath.Join(destPath, m.FolderName)
-		for _, file := range m.Files {
-			localPath := filepath.Join(destFolder, filepath.FromSlash(file.Path))
-			info, err := os.Stat(localPath)
-			if err == nil && !info.IsDir() {
-				if info.Size() <= file.Size {
-					existingSize += info.Size()
+		// Files in storage are always received from the start
+		if backend == nil {
+			destFolder := filepath.Join(destPath, m.FolderName)
+			for _, file := range m.Files {
+				localPath := filepath.Join(destFolder, filepath.FromSlash(file.Path))
+				info, err := os.Stat(localPath)
+				if err == nil && !info.IsDir() {
+					if info.Size() <= file.Size {
+						existingSize += info.Size()
+					}
 				}
 			}
 		}
 
 		if existingSize > 0 {
-			fmt.Printf("  Resuming: found %s existing data\n", transfer.FormatBytes(existingSize))
+			fmt.Println("  " + i18n.T("Resuming: found %s existing data", transfer.FormatBytes(existingSize)))
+		}
+		if probed {
+			fmt.Printf("  %s\n", estimate(probe, m.TotalSize-existingSize))
 		}
 
-		fmt.Print("Accept? [y/N]: ")
+		fmt.Print(i18n.T("Accept? [y/N]: "))
 		var response string
 		fmt.Scanln(&response)
 		if response == "y" || response == "Y" {
 			return true
 		}
-		fmt.Println("Transfer rejected.")
+		fmt.Println(i18n.T("Transfer rejected."))
 		return false
 	}
 
-	var bar *progressbar.ProgressBar
-	fileOffsets := make(map[string]int64)
-
+	var display *progressDisplay
+	progress := events.Progress{Emitter: events.Nop{}}
+	var checksums map[string]string
+	// The monitor is given what arrived, not what a resumed file already
+	// had on disk
+	var counted int64
 	receiver.OnStartFile = func(filename string, index, total int) {
-		if bar == nil {
-			if receiver.Manifest != nil {
-				var currentOffset int64
-				for _, f := range receiver.Manifest.Files {
-					fileOffsets[f.Path] = currentOffset
-					currentOffset += f.Size
-				}
-				bar = progressbar.NewOptions64(
-					receiver.Manifest.TotalSize,
-					progressbar.OptionSetDescription("receiving"),
-					progressbar.OptionShowBytes(true),
-					progressbar.OptionSetWidth(20),
-					progressbar.OptionShowCount(),
-					progressbar.OptionOnCompletion(func() {
-						fmt.Println()
-					}),
-					progressbar.OptionSetTheme(progressbar.Theme{
-						Saucer:        "=",
-						SaucerHead:    ">",
-						SaucerPadding: " ",
-						BarStart:      "[",
-						BarEnd:        "]",
-					}),
-				)
-			}
-		}
-		if bar != nil {
-			bar.Describe(fmt.Sprintf("Receiving %s (%d/%d)", filename, index, total))
+		counted = receiver.Received()
+		if display == nil && receiver.Manifest != nil {
+			display = newProgressDisplay("Receiving", receiver.Manifest)
+			progress.Emitter = display
+			checksums = fileChecksums(receiver.Manifest)
 		}
+		progress.StartFile(filename, index, total)
 	}
 
+	receiver.OnFileComplete = progress.FileComplete
+
 	receiver.OnProgress = func(filename string, received, total int64) {
-		if bar != nil {
-			if offset, ok := fileOffsets[filename]; ok {
-				bar.Set64(offset + received)
-			}
+		if got := receiver.Received(); monitor != nil && got > counted {
+			monitor.AddBytes(got - counted)
+			counted = got
+		}
+
+		progress.Update(filename, received, total)
+		if received == total {
+			debugChecksum(checksums, filename)
 		}
 	}
 
-	maxRetries := 5
-	for attempt := 0; attempt <= maxRetries; attempt++ {
-		err := receiver.Receive(stream)
+	started := time.Now()
+	for attempt := 0; attempt <= *maxRetries; attempt++ {
+		err := receiver.Receive(ctx, stream)
 		if err == nil {
 			break
 		}
 
-		if transfer.IsRetryableError(err) && attempt < maxRetries {
-			fmt.Printf("\nConnection interrupted: %v\n", err)
-			fmt.Printf("Retrying (%d/%d)...\n", attempt+1, maxRetries)
+		if transfer.CategoryOf(err) == transfer.CategoryCancelled {
+			fmt.Println(i18n.T("Transfer cancelled. Partially received files are kept and will resume next time."))
+			ended(err)
+			return
+		}
+
+		if monitor != nil && monitor.TakeMigration() {
+			newStream, streamErr := node.NewStream(peerID)
+			if streamErr == nil {
+				stream = newStream
+				monitor.Track(newStream)
+				attempt--
+				continue
+			}
+		}
+
+		if transfer.IsRetryableError(err) && attempt < *maxRetries {
+			infoln("\n" + i18n.T("Connection interrupted: %v", err))
+			infoln(i18n.T("Retrying (%d/%d)...", attempt+1, *maxRetries))
+			audit.Record(transfer.AuditEvent{Event: transfer.AuditRetry, Peer: peerID.String(), Attempt: attempt + 1, Error: err.Error()})
 
 			stream.Close()
 
 			backoff := time.Duration(1<<attempt) * 2 * time.Second
-			time.Sleep(backoff)
+			debugf("Waiting %s before reconnecting\n", backoff)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				fmt.Println(i18n.T("Cancelled."))
+				ended(ctx.Err())
+				return
+			}
 
-			fmt.Println("Reconnecting to sender...")
+			infoln(i18n.T("Reconnecting to sender..."))
+			if lan {
+				conn, err := dialLAN()
+				if err != nil {
+					fmt.Println(i18n.T("Error: Failed to find peer: %v", err))
+					ended(err)
+					os.Exit(1)
+				}
+				if conn.Remote != peerID && !verifyPeer(node, conn.Remote, code, *strict) {
+					conn.Reset()
+					fmt.Println(i18n.T("Verification codes did not match. Aborting."))
+					os.Exit(1)
+				}
+				stream = conn
+				peerID = conn.Remote
+				audit.Record(transfer.AuditEvent{Event: transfer.AuditConnect, Peer: peerID.String(), Options: map[string]interface{}{"lan": true}})
+				if display != nil {
+					display.reconnected()
+				}
+				continue
+			}
 			newPeerID, findErr := node.FindPeer(code)
 			if findErr != nil {
-				fmt.Printf("Error: Failed to find peer: %v\n", findErr)
+				fmt.Println(i18n.T("Error: Failed to find peer: %v", findErr))
+				ended(findErr)
 				os.Exit(1)
 			}
 
+			// Asked before the stream opens, whose handshake the sender times
+			if newPeerID != peerID && !verifyPeer(node, newPeerID, code, *strict) {
+				fmt.Println(i18n.T("Verification codes did not match. Aborting."))
+				os.Exit(1)
+			}
 			newStream, streamErr := node.NewStream(newPeerID)
 			if streamErr != nil {
-				fmt.Printf("Error: Failed to open stream: %v\n", streamErr)
+				fmt.Println(i18n.T("Error: Failed to open stream: %v", streamErr))
+				ended(streamErr)
 				os.Exit(1)
 			}
 			stream = newStream
+			peerID = newPeerID
+			monitor.Track(newStream)
+			audit.Record(transfer.AuditEvent{Event: transfer.AuditConnect, Peer: peerID.String(), Options: map[string]interface{}{"lan": false}})
+			debugf("Sender address: %s\n", newStream.Conn().RemoteMultiaddr())
 
-			if bar != nil {
-				bar.Reset()
+			if display != nil {
+				display.reconnected()
 			}
 
 			continue
 		}
 
-		fmt.Printf("Error: Transfer failed: %v\n", err)
+		switch transfer.CategoryOf(err) {
+		case transfer.CategoryRejected:
+			fmt.Println(i18n.T("Transfer rejected: %v", err))
+		case transfer.CategoryValidation:
+			fmt.Println(i18n.T("Error: Transfer failed verification: %v", err))
+		default:
+			fmt.Println(i18n.T("Error: Transfer failed: %v", err))
+		}
+		ended(err)
 		os.Exit(1)
 	}
 
-	fmt.Printf("\nFiles saved to: %s\n", filepath.Join(destPath, receiver.Manifest.FolderName))
+	if display != nil {
+		display.finish()
+	}
+	savedPath := receiver.LocalFolder()
+	recordTransfer(savedPath, receiver.Manifest.TotalSize, "receive", history.StatusComplete, receiver.Root(), nil, peerID, started, receiver.Compression)
+	infoln()
+	fmt.Println(i18n.T("Files saved to: %s", savedPath))
+	if receiver.Verified {
+		infoln(i18n.T("Fingerprint verified: %s", transfer.Fingerprint(receiver.Manifest.Root)))
+	}
+	printCompression(receiver.Compression)
+	printRenamed(receiver.Renamed)
+	if encryption != nil && backend == nil {
+		fmt.Println(i18n.T("Files are encrypted, unlock them with: %s", fmt.Sprintf("2c1f decrypt %q", savedPath)))
+	}
+	ended(nil)
+}
+
+// printRenamed reports files saved under a different name than the sender
+// used, because the name is not valid on this system
+func printRenamed(renamed map[string]string) {
+	if len(renamed) == 0 {
+		return
+	}
+	names := make([]string, 0, len(renamed))
+	for name := range renamed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Println(i18n.T("Renamed because the names are not valid on this system:"))
+	for _, name := range names {
+		fmt.Printf("  %s -> %s\n", name, renamed[name])
+	}
+}
+
+// verifyPeer prints the short authentication string for the connection to
+// peerID. In strict mode the user must confirm it matches the sender's.
+func verifyPeer(node *p2p.Node, peerID peer.ID, code string, strict bool) bool {
+	sas := node.ShortAuthString(peerID, code)
+	fmt.Println(i18n.T("Verification code: %s", sas))
+	if !strict {
+		return true
+	}
+
+	fmt.Print(i18n.T("Does the sender show the same verification code? [y/N]: "))
+	var response string
+	fmt.Scanln(&response)
+	return response == "y" || response == "Y"
+}
+
+// choosePeer asks which sender is meant when more than one advertises code.
+// They are told apart by the verification code each of them shows.
+func choosePeer(node *p2p.Node, code string) func([]peer.AddrInfo) (peer.ID, error) {
+	return func(candidates []peer.AddrInfo) (peer.ID, error) {
+		fmt.Println(i18n.T("Warning: %d senders use this code. Pick the one that shows the same verification code:", len(candidates)))
+		for i, c := range candidates {
+			fmt.Printf("  %d) %s  %s\n", i+1, node.ShortAuthString(c.ID, code), c.ID.String()[:12])
+		}
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return "", p2p.ErrDuplicatePeers
+		}
+		fmt.Print(i18n.T("Sender [1-%d], or Enter to abort: ", len(candidates)))
+		var response string
+		fmt.Scanln(&response)
+		i, err := strconv.Atoi(response)
+		if err != nil || i < 1 || i > len(candidates) {
+			return "", p2p.ErrDuplicatePeers
+		}
+		return candidates[i-1].ID, nil
+	}
+}
+
+// syncFlag is the policy of -sync, a number of megabytes for syncing at that
+// interval
+type syncFlag struct {
+	policy   transfer.SyncPolicy
+	interval int64
+	set      bool
+}
+
+func (s *syncFlag) String() string {
+	if s.interval > 0 {
+		return strconv.FormatInt(s.interval>>20, 10)
+	}
+	return string(s.policy)
+}
+
+func (s *syncFlag) Set(value string) error {
+	if mb, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if mb <= 0 {
+			return errors.New("sync interval must be at least 1 MB")
+		}
+		*s = syncFlag{policy: transfer.SyncInterval, interval: mb << 20, set: true}
+		return nil
+	}
+	policy, err := transfer.ParseSyncPolicy(value)
+	if err != nil {
+		return err
+	}
+	*s = syncFlag{policy: policy, set: true}
+	return nil
+}
+
+// checksumFlag is the algorithm of -write-checksums, which given alone means
+// SHA-256
+type checksumFlag string
+
+func (c *checksumFlag) String() string   { return string(*c) }
+func (c *checksumFlag) IsBoolFlag() bool { return true }
+
+func (c *checksumFlag) Set(value string) error {
+	switch value {
+	case "true":
+		value = transfer.ChecksumSHA256
+	case "false":
+		value = ""
+	}
+	if err := transfer.CheckChecksumAlgorithm(value); err != nil {
+		return err
+	}
+	*c = checksumFlag(value)
+	return nil
 }
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ebob10000/2c1f/history"
+	"github.com/ebob10000/2c1f/i18n"
+	"github.com/ebob10000/2c1f/transfer"
+)
+
+// ResumeArgs returns the receive arguments that continue a failed or
+// cancelled receive from the history: 2c1f resume -last or 2c1f resume <id>.
+// Further arguments, such as -password, are passed on to receive.
+func ResumeArgs(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return nil, errors.New(i18n.T("usage: 2c1f resume -last | <id> [receive flags]"))
+	}
+	records := loadHistory()
+	var record history.Record
+	var ok bool
+	switch args[0] {
+	case "-last", "--last":
+		record, ok = history.LastResumable(records)
+		if !ok {
+			return nil, errors.New(i18n.T("no failed or cancelled receive to resume"))
+		}
+	default:
+		record, ok = history.Find(records, args[0])
+		if !ok {
+			return nil, errors.New(i18n.T("no transfer %s in the history, see 2c1f history", args[0]))
+		}
+		if !record.Resumable() {
+			return nil, errors.New(i18n.T("transfer %s cannot be resumed", record.Path))
+		}
+	}
+
+	fmt.Println(i18n.T("Resuming %s (%s of %s done)", record.Path, transfer.FormatBytes(record.Transferred), transfer.FormatBytes(record.Size)))
+	var receiveArgs []string
+	if record.Dest != "" {
+		receiveArgs = append(receiveArgs, "-o="+record.Dest)
+	}
+	receiveArgs = append(receiveArgs, args[1:]...)
+	return append(receiveArgs, record.Code), nil
+}
@@ -2,170 +2,476 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/ebob10000/2c1f/events"
+	"github.com/ebob10000/2c1f/history"
+	"github.com/ebob10000/2c1f/i18n"
 	"github.com/ebob10000/2c1f/p2p"
+	"github.com/ebob10000/2c1f/session"
+	"github.com/ebob10000/2c1f/settings"
+	"github.com/ebob10000/2c1f/source"
 	"github.com/ebob10000/2c1f/transfer"
 	"github.com/ebob10000/2c1f/words"
 	"github.com/libp2p/go-libp2p/core/network"
-	"github.com/schollz/progressbar/v3"
+	"github.com/libp2p/go-libp2p/core/peer"
 )
 
+// maxDecoys limits -decoys, each is advertised as often as the code
+const maxDecoys = 8
+
 func Send(args []string) {
 	fs := flag.NewFlagSet("send", flag.ExitOnError)
 	compress := fs.Bool("compress", false, "Enable compression")
+	autoCompress := fs.Bool("auto-compress", settings.LoadSettings().AutoCompress, "Compress on slow links when the files are compressible, unless -compress is set")
+	compressLevel := fs.Int("compress-level", transfer.DefaultCompressLevel, "Gzip compression level from 1 (fastest) to 9 (smallest)")
 	cacheManifest := fs.Bool("cache-manifest", false, "Cache manifest file")
 	skipHash := fs.Bool("skip-hash", false, "Skip file hashing (faster start, less secure resume)")
+	timeout := fs.Duration("timeout", transfer.StreamTimeout, "Stream inactivity timeout")
+	bootstrapTimeout := fs.Duration("bootstrap-timeout", p2p.DefaultBootstrapTimeout, "Timeout for each bootstrap peer connection")
+	strict := fs.Bool("strict", false, "Require confirming the verification code of every receiver before sending")
+	password := fs.String("password", "", "Password the receiver must also know, never sent over the network")
+	to := fs.String("to", "", "Push to a receiver running 2c1f serve with this code")
+	mailbox := fs.String("mailbox", "", "Store the files encrypted in a mailbox running 2c1f mailbox-server with this code, for the receiver to claim later")
+	startAt := fs.String("start-at", "", "Hold connected receivers until this time, HH:MM or RFC 3339")
+	resumeSession := fs.String("resume-session", "", "Continue an interrupted send with the same code")
+	incognitoFlag(fs)
+	summaryFlag(fs)
+	showPeer := fs.Bool("show-peer", false, "Show this node's peer ID beside the code, for receivers to check with -peer")
+	decoys := fs.Int("decoys", 0, "Also advertise this many random codes that lead nowhere, to mislead code scanners, at most 8")
+	preserveNames := fs.Bool("preserve-names", false, "Send file names byte for byte instead of normalized to Unicode NFC")
+	directIO := fs.Bool("direct-io", false, "Read files without the page cache, for very fast disks and links")
+	sourceLimit := fs.Int("source-limit", 0, "Read files at most this many MB/s, 40 on network mounts if 0, unlimited if -1")
+	expires := fs.Duration("expires", 0, "Stop accepting receivers after this long, e.g. 30m, never if 0")
+	maxDownloads := fs.Int("max-downloads", 1, "Stop after this many receivers completed the transfer, unlimited if 0")
+	onComplete := fs.String("on-complete", "", "Command to run when a transfer completes or fails, {path}, {size}, {status} and {peer} are replaced")
+	applyOutput := outputFlags(fs)
+	nodeConfig := nodeFlags(fs)
+	lanAllowed := lanFlag(fs)
+	openAudit := auditFlag(fs)
 	fs.Parse(args)
+	applyOutput()
+	trimCache()
+	if err := transfer.CheckCompressLevel(*compressLevel); err != nil {
+		fmt.Println(i18n.T("Error: %v", err))
+		os.Exit(1)
+	}
+	if *decoys < 0 || *decoys > maxDecoys {
+		fmt.Println(i18n.T("Error: %v", fmt.Sprintf("-decoys must be between 0 and %d", maxDecoys)))
+		os.Exit(1)
+	}
+
+	var sess *session.Session
+	if *resumeSession != "" {
+		var err error
+		sess, err = session.Load(session.GetSessionsPath(), *resumeSession)
+		if err != nil {
+			fmt.Println(i18n.T("Error: Cannot load session %s: %v", *resumeSession, err))
+			os.Exit(1)
+		}
+		if err := sess.CheckSource(); err != nil {
+			fmt.Println(i18n.T("Error: Cannot resume session: %v", err))
+			os.Exit(1)
+		}
+		*compress = *compress || sess.Compress
+	}
 
 	folderPath := fs.Arg(0)
+	if sess != nil {
+		folderPath = sess.Path
+	}
 	if folderPath == "" {
-		fmt.Print("Enter path to file or folder: ")
+		fmt.Print(i18n.T("Enter path to file or folder: "))
 		fmt.Scanln(&folderPath)
 	}
 	if folderPath == "" {
-		fmt.Println("Error: Path required")
+		fmt.Println(i18n.T("Error: Path required"))
 		os.Exit(1)
 	}
 
-	_, err := os.Stat(folderPath)
-	if err != nil {
-		fmt.Printf("Error: Cannot access path: %v\n", err)
-		os.Exit(1)
+	remote := source.IsURL(folderPath)
+	var err error
+	if !remote {
+		if _, err = os.Stat(folderPath); err != nil {
+			fmt.Println(i18n.T("Error: Cannot access path: %v", err))
+			os.Exit(1)
+		}
 	}
 
-	sender, err := transfer.NewSender(folderPath, *cacheManifest, *skipHash, func(path string, size int64) {
-		fmt.Printf("\rHashing: %s...", path)
-	})
-	if err != nil {
-		fmt.Printf("\nError: Failed to scan path: %v\n", err)
-		os.Exit(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		infoln("\n" + i18n.T("Shutting down..."))
+		cancel()
+	}()
+
+	// The mailbox gets an encrypted copy, whose key is in the claim code
+	var claimCode string
+	sourcePath := folderPath
+	if *mailbox != "" {
+		if remote || sess != nil || *to != "" {
+			fmt.Println(i18n.T("Error: %v", "-mailbox needs a local path and cannot be combined with -to or -resume-session"))
+			os.Exit(1)
+		}
+		infoln(i18n.T("Encrypting for the mailbox..."))
+		var tmp string
+		claimCode, sourcePath, tmp, err = sealForMailbox(folderPath)
+		if err != nil {
+			fmt.Println(i18n.T("Error: %v", err))
+			os.Exit(1)
+		}
+		defer os.RemoveAll(tmp)
+	}
+
+	// Hashing reads the files no faster than sending does
+	limit := transfer.SourceLimit(sourcePath, *sourceLimit)
+	if *sourceLimit == 0 && limit > 0 {
+		infoln(i18n.T("Reading from a network mount at up to %s/s, change with -source-limit", transfer.FormatBytes(limit)))
+	}
+	var sender *transfer.Sender
+	if sess != nil {
+		// The files were checked against the saved manifest, so the
+		// receiver's partial files stay valid
+		sender = &transfer.Sender{FolderPath: sess.Path, Manifest: sess.Manifest}
+	} else {
+		onHash := func(path string, size int64) {
+			infof("\r%s", i18n.T("Hashing: %s...", path))
+		}
+		if remote {
+			var fsys source.FS
+			var name string
+			fsys, name, err = source.New(folderPath)
+			if err == nil {
+				sender, err = transfer.NewSenderFSLimited(ctx, fsys, name, *skipHash, limit, onHash)
+			}
+		} else {
+			sender, err = transfer.NewSenderLimited(ctx, sourcePath, *cacheManifest && !incognito, *skipHash, limit, onHash)
+		}
+		if err != nil {
+			if transfer.CategoryOf(err) == transfer.CategoryCancelled {
+				fmt.Println("\n" + i18n.T("Cancelled."))
+				return
+			}
+			fmt.Println("\n" + i18n.T("Error: Failed to scan path: %v", err))
+			os.Exit(1)
+		}
+		infoln()
+		if *preserveNames {
+			sender.PreserveNames()
+		}
 	}
-	fmt.Println()
 	sender.Compress = *compress
+	sender.CompressLevel = *compressLevel
+	sender.Timeout = *timeout
+	sender.DirectIO = *directIO
+	sender.SourceLimit = limit
+	sender.MaxDownloads = *maxDownloads
+	if *expires > 0 {
+		sender.ExpiresAt = time.Now().Add(*expires)
+	}
+	if *startAt != "" {
+		sender.StartAt, err = transfer.ParseStartTime(*startAt, time.Now())
+		if err != nil {
+			fmt.Println(i18n.T("Error: %v", err))
+			os.Exit(1)
+		}
+	}
 
-	fmt.Printf("Sending: %s (%d files)\n", sender.Manifest.FolderName, len(sender.Manifest.Files))
-
-	fileOffsets := make(map[string]int64)
-	var currentOffset int64
-	for _, f := range sender.Manifest.Files {
-		fileOffsets[f.Path] = currentOffset
-		currentOffset += f.Size
-	}
-
-	bar := progressbar.NewOptions64(
-		sender.Manifest.TotalSize,
-		progressbar.OptionSetDescription("sending"),
-		progressbar.OptionShowBytes(true),
-		progressbar.OptionSetWidth(20),
-		progressbar.OptionShowCount(),
-		progressbar.OptionOnCompletion(func() {
-			fmt.Println()
-		}),
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "=",
-			SaucerHead:    ">",
-			SaucerPadding: " ",
-			BarStart:      "[",
-			BarEnd:        "]",
-		}),
-	)
-
-	sender.OnStartFile = func(filename string, index, total int) {
-		bar.Describe(fmt.Sprintf("Sending %s (%d/%d)", filename, index, total))
+	infoln(i18n.T("Sending: %s (%d files)", sender.Manifest.FolderName, len(sender.Manifest.Files)))
+	if root := sender.Manifest.MerkleRoot(); root != "" {
+		infoln(i18n.T("Fingerprint: %s", transfer.Fingerprint(root)))
+	}
+	for _, warning := range transfer.PortabilityWarnings(sender.Manifest) {
+		infoln(i18n.T("Warning: %s", warning))
 	}
 
+	display := newProgressDisplay("Sending", sender.Manifest)
+	progress := events.Progress{Emitter: display}
+	sender.OnStartFile = progress.StartFile
+	sender.OnFileComplete = progress.FileComplete
+	checksums := fileChecksums(sender.Manifest)
+
+	var currentPeer atomic.Value // peer.ID of the receiver being sent to
+	currentPeer.Store(peer.ID(""))
 	sender.OnProgress = func(filename string, sent, total int64) {
-		if offset, ok := fileOffsets[filename]; ok {
-			bar.Set64(offset + sent)
+		progress.Update(filename, sent, total)
+		if sent == total {
+			debugChecksum(checksums, filename)
+		}
+		if sess != nil {
+			sess.Progress(currentPeer.Load().(peer.ID).String(), filename, sent)
 		}
 	}
 
-	code, err := words.Generate()
-	if err != nil {
-		fmt.Printf("Error: Failed to generate code: %v\n", err)
-		os.Exit(1)
+	code := *to
+	if *mailbox != "" {
+		code = *mailbox
+	}
+	switch {
+	case sess != nil:
+		code = sess.Code
+	case code == "":
+		code, err = words.Generate()
+		if err != nil {
+			fmt.Println(i18n.T("Error: Failed to generate code: %v", err))
+			os.Exit(1)
+		}
+		// Pushes to serve are not resumable, the receiver is looked up again.
+		// Neither are remote sources, which may change in the meantime.
+		if !remote && !incognito {
+			sess, err = session.Create(session.GetSessionsPath(), folderPath, code, sender.Compress, sender.Manifest)
+			if err != nil {
+				fmt.Println(i18n.T("Warning: Session will not be resumable: %v", err))
+			}
+		}
 	}
 	sender.Code = code
+	sender.Password = *password
+	var decoyCodes []string
+	for range *decoys {
+		if decoy, err := words.Generate(); err == nil {
+			decoyCodes = append(decoyCodes, decoy)
+		}
+	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	audit := openAudit()
+	defer audit.Close()
+	begun := time.Now()
+	sender.Audit = audit
+	audit.Record(transfer.AuditEvent{Event: transfer.AuditStart, Path: folderPath, Size: sender.Manifest.TotalSize, Options: map[string]interface{}{
+		"role":    "send",
+		"files":   len(sender.Manifest.Files),
+		"strict":  *strict,
+		"to":      *to != "",
+		"mailbox": *mailbox != "",
+	}})
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	// ended records a transfer that did not finish and runs the
+	// -on-complete command. delivery is nil if sending did not start.
+	// Cancelling before anyone connected is not recorded.
+	ended := func(peerID peer.ID, delivery *transfer.Delivery, err error) {
+		summary := transfer.Summary{Direction: "send", Path: sender.FolderPath}
+		var sent int64
+		var root string
+		if delivery != nil {
+			summary, sent = delivery.Summary(), delivery.Sent()
+			// Verified for the sender once the receiver signed for the root
+			if delivery.Receipt != nil {
+				root = delivery.Receipt.Root
+			}
+		}
+		if err != nil && (peerID != "" || transfer.CategoryOf(err) != transfer.CategoryCancelled) {
+			record := unfinishedRecord(folderPath, sender.Manifest.TotalSize, "send", err)
+			record.Transferred = sent
+			record.Code = code
+			record.Peer = peerID.String()
+			saveRecord(record)
+		}
+		auditEnd(audit, peerID, sent, begun, root, err)
+		printSummary(summary, err)
+		printDone("send", folderPath, sender.Manifest.TotalSize, peerID, summary, err)
+		runHook(*onComplete, "send", folderPath, sender.Manifest.TotalSize, peerID, err)
+	}
+
+	infoln(i18n.T("Starting P2P node..."))
+	cfg := nodeConfig()
+	// Once the code is advertised, the node outlives a cancel to withdraw it
+	nodeCtx, cancelNode := context.WithCancel(context.Background())
+	defer cancelNode()
+	var advertised atomic.Bool
 	go func() {
-		<-sigChan
-		fmt.Println("\nShutting down...")
-		cancel()
+		<-ctx.Done()
+		if !advertised.Load() {
+			cancelNode()
+		}
 	}()
-
-	fmt.Println("Starting P2P node...")
-	node, err := p2p.NewNode(ctx)
+	node, err := p2p.NewNodeWithConfig(nodeCtx, cfg)
 	if err != nil {
-		fmt.Printf("Error: Failed to create P2P node: %v\n", err)
+		fmt.Println(i18n.T("Error: Failed to create P2P node: %v", err))
 		os.Exit(1)
 	}
 	defer node.Close()
+	node.BootstrapTimeout = *bootstrapTimeout
+	node.SetDialHandler(debugDial)
+	node.OnBootstrap = reportBootstrap
 
-	fmt.Printf("Node ID: %s\n", node.Host.ID().String()[:12])
+	infoln(i18n.T("Node ID: %s", node.Host.ID().String()[:12]))
+	debugAddrs(node)
 
-	fmt.Println("Connecting to network...")
+	// Receivers on the same network connect directly if libp2p fails on
+	// either side. Pushes look the receiver up on the network.
+	var lan *p2p.LANListener
+	if lanAllowed(cfg) && *to == "" && *mailbox == "" {
+		lan, err = p2p.ListenLAN(code, node.PrivateKey(), cfg)
+		if err != nil {
+			debugf("LAN fallback unavailable: %v\n", err)
+		} else {
+			defer lan.Close()
+			debugf("LAN fallback listening on %s\n", lan.Addr())
+		}
+	}
+
+	infoln(i18n.T("Connecting to network..."))
+	online := true
 	if err := node.Bootstrap(); err != nil {
-		fmt.Printf("Error: Failed to bootstrap: %v\n", err)
-		os.Exit(1)
+		if lan == nil {
+			fmt.Println(i18n.T("Error: Failed to bootstrap: %v", err))
+			os.Exit(1)
+		}
+		fmt.Println(i18n.T("Warning: %s", i18n.T("Only receivers on the local network can connect: %v", err)))
+		online = false
+	} else {
+		debugf("Connected to %d peers\n", len(node.Host.Network().Peers()))
 	}
 
-	time.Sleep(2 * time.Second)
+	if *to != "" || *mailbox != "" {
+		var delivery *transfer.Delivery
+		var storedUntil time.Time
+		if *mailbox != "" {
+			delivery, storedUntil, err = deposit(ctx, node, sender, folderPath, claimCode, *expires)
+		} else {
+			delivery, err = push(ctx, node, sender, folderPath)
+		}
+		ended("", delivery, err)
+		if err != nil {
+			if transfer.CategoryOf(err) == transfer.CategoryCancelled {
+				fmt.Println(i18n.T("Cancelled."))
+				return
+			}
+			fmt.Println(i18n.T("Transfer failed: %v", err))
+			os.Exit(1)
+		}
+		display.finish()
+		fmt.Println(i18n.T("Transfer complete!"))
+		if *mailbox != "" {
+			printClaim(code, claimCode, storedUntil)
+		}
+		return
+	}
 
-	if err := node.Advertise(code); err != nil {
-		fmt.Printf("Error: Failed to advertise: %v\n", err)
-		os.Exit(1)
+	if online {
+		time.Sleep(2 * time.Second)
+
+		advertised.Store(true)
+		go node.AdvertiseDecoys(decoyCodes)
+		if err := node.Advertise(code); err != nil {
+			if lan == nil {
+				fmt.Println(i18n.T("Error: Failed to advertise: %v", err))
+				os.Exit(1)
+			}
+			fmt.Println(i18n.T("Warning: %s", i18n.T("Only receivers on the local network can connect: %v", err)))
+			online = false
+		}
 	}
 
 	transferDone := make(chan error, 1)
-	var peerAccepted bool
+	cancelled := make(chan *transfer.Delivery, 1) // Of the transfer a cancel stopped
+	// Receivers are accepted one at a time, the prompt reads stdin
+	var acceptMu sync.Mutex
+	var peerAccepted bool // Under acceptMu, like acceptedPeer
+	var acceptedPeer peer.ID
+	var sending atomic.Bool
+	var compressMu sync.Mutex
+	var compressReason string // Last reported -auto-compress decision, under compressMu
 
-	node.SetStreamHandler(func(stream network.Stream) {
-		peerID := stream.Conn().RemotePeer()
-		fmt.Printf("\nPeer connected: %s\n", peerID.String()[:12])
+	node.SetProbeCode(code)
+	node.OnProbe = func(_ peer.ID, probe p2p.Probe) {
+		infoln(estimate(probe, sender.Manifest.TotalSize))
+	}
+	// handle runs a transfer on a stream from peerID, whose data streams
+	// come from openData, nil if there are none
+	handle := func(stream transferStream, peerID peer.ID, remoteAddr string, openData func(ctx context.Context, token []byte) (io.ReadWriteCloser, error)) {
+		infoln("\n" + i18n.T("Peer connected: %s", peerID.String()[:12]))
+		debugf("Peer address: %s\n", remoteAddr)
+		currentPeer.Store(peerID)
+		if sent := sessionSent(sess, peerID); sent > 0 {
+			infoln(i18n.T("Session sent %s to this receiver before", transfer.FormatBytes(sent)))
+		}
+
+		// The receiver measured the link before opening the stream. Others
+		// may be sending at the same time, so the decision only applies to
+		// this stream.
+		opts := transfer.StreamOptions{Compress: *compress, DataStream: openData}
+		if *autoCompress && !*compress {
+			if probe, ok := node.PeerProbe(peerID); ok {
+				var reason string
+				opts.Compress, reason = transfer.AutoCompress(sender.Manifest, probe.Throughput)
+				compressMu.Lock()
+				if reason != compressReason {
+					infoln(reason)
+					compressReason = reason
+				}
+				compressMu.Unlock()
+			}
+		}
 
-		err := sender.Handshake(stream)
+		err := sender.HandshakeWith(stream, opts)
+		audit.Record(transfer.AuditEvent{Event: transfer.AuditConnect, Peer: peerID.String(), Options: map[string]interface{}{"address": remoteAddr}, Error: transfer.AuditError(err)})
 		if err != nil {
-			fmt.Printf("Handshake failed: %v\n", err)
-			stream.Close()
+			if !errors.Is(err, transfer.ErrTooManyHandshakes) {
+				fmt.Println(i18n.T("Handshake failed: %v", err))
+			}
+			stats := sender.HandshakeStats()
+			debugf("Handshakes: %d pending, %d accepted, %d refused, %d timed out, %d failed\n",
+				stats.Pending, stats.Accepted, stats.Refused, stats.TimedOut, stats.Failed)
+			stream.Reset()
 			return
 		}
+		sending.Store(true)
+		defer sending.Store(false)
 
-		if !peerAccepted {
-			fmt.Printf("Connection request from %s. Accept? [y/N]: ", peerID.String()[:12])
+		// The receiver shows the same code only if nobody is in between
+		sas := node.ShortAuthString(peerID, code)
+		acceptMu.Lock()
+		if !peerAccepted || (*strict && peerID != acceptedPeer) {
+			fmt.Println(i18n.T("Verification code: %s", sas))
+			if *strict {
+				fmt.Println(i18n.T("Confirm the receiver shows the same verification code before accepting."))
+			}
+			fmt.Print(i18n.T("Connection request from %s. Accept? [y/N]: ", peerID.String()[:12]))
 			var response string
 			fmt.Scanln(&response)
 			if response != "y" && response != "Y" {
-				fmt.Println("Connection rejected.")
+				acceptMu.Unlock()
+				fmt.Println(i18n.T("Connection rejected."))
+				transfer.WriteMessage(stream, &transfer.Message{Type: transfer.MsgError, Payload: []byte("Connection rejected by sender")})
 				stream.Close()
 				return
 			}
 			peerAccepted = true
+			acceptedPeer = peerID
 		} else {
-			fmt.Println("Receiver reconnected, resuming transfer...")
+			infoln(i18n.T("Receiver reconnected, resuming transfer..."))
+			display.reconnected()
 		}
+		acceptMu.Unlock()
+
+		started := time.Now()
 
 		var dataStream io.ReadWriter = stream
-		if sender.Compress {
-			compressedStream, err := transfer.NewCompressedStream(stream)
+		if opts.Compress {
+			compressedStream, err := transfer.NewCompressedStreamLevel(stream, sender.CompressLevel)
 			if err != nil {
-				fmt.Printf("Failed to initialize compression: %v\n", err)
+				fmt.Println(i18n.T("Failed to initialize compression: %v", err))
 				stream.Close()
 				if transfer.IsRetryableError(err) {
-					fmt.Println("Waiting for receiver to reconnect...")
+					infoln(i18n.T("Waiting for receiver to reconnect..."))
 					return
 				}
+				ended(peerID, nil, err)
 				transferDone <- err
 				return
 			}
@@ -173,25 +479,99 @@ func Send(args []string) {
 			dataStream = compressedStream
 		}
 
-		err = sender.Send(dataStream)
+		delivery, err := sender.SendWith(ctx, dataStream, opts)
 		if err != nil {
+			if transfer.CategoryOf(err) == transfer.CategoryCancelled {
+				stream.Reset()
+				select {
+				case cancelled <- delivery:
+				default:
+				}
+				return
+			}
 			if transfer.IsRetryableError(err) {
-				fmt.Printf("\nConnection interrupted: %v\n", err)
-				fmt.Println("Waiting for receiver to reconnect...")
+				audit.Record(transfer.AuditEvent{Event: transfer.AuditRetry, Peer: peerID.String(), Error: err.Error()})
+				infoln("\n" + i18n.T("Connection interrupted: %v", err))
+				infoln(i18n.T("Waiting for receiver to reconnect..."))
 				stream.Close()
 				return
 			}
+		} else {
+			display.finish()
+			receipt := verifiedReceipt(delivery, peerID)
+			if receipt != nil {
+				infoln(i18n.T("Delivery receipt verified."))
+			}
+			printConfirmation(delivery)
+			printCompression(delivery.Compression)
+			recordTransfer(folderPath, sender.Manifest.TotalSize, "send", history.SendStatus(delivery.Confirmed), delivery.Root(), receipt, peerID, started, delivery.Compression)
 		}
+		// The next receiver is asked for again
+		acceptMu.Lock()
+		peerAccepted = false
+		acceptMu.Unlock()
+		ended(peerID, delivery, err)
 		transferDone <- err
+	}
+	node.SetStreamHandler(func(stream network.Stream) {
+		peerID := stream.Conn().RemotePeer()
+		handle(stream, peerID, stream.Conn().RemoteMultiaddr().String(), func(ctx context.Context, token []byte) (io.ReadWriteCloser, error) {
+			return node.AcceptDataStream(ctx, peerID, token)
+		})
 	})
+	if lan != nil {
+		go func() {
+			for {
+				conn, err := lan.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer conn.Close()
+					handle(conn, conn.Remote, conn.RemoteAddr().String(), nil)
+				}()
+			}
+		}()
+	}
 
-	fmt.Println()
-	fmt.Println("========================================")
-	fmt.Printf("  CONNECTION CODE: %s\n", code)
-	fmt.Println("========================================")
-	fmt.Println()
-	fmt.Println("Share this code with the receiver.")
-	fmt.Println("Waiting for peer to connect...")
+	event := jsonEvent{Event: "code", Code: code}
+	if *showPeer {
+		event.Peer = node.Host.ID().String()
+	}
+	printJSON(event)
+	if output == levelQuiet {
+		fmt.Println(code)
+		if *showPeer {
+			fmt.Println(node.Host.ID())
+		}
+	} else {
+		fmt.Println()
+		fmt.Println("========================================")
+		fmt.Println("  " + i18n.T("CONNECTION CODE: %s", code))
+		if *showPeer {
+			fmt.Println("  " + i18n.T("PEER ID: %s", node.Host.ID()))
+		}
+		fmt.Println("========================================")
+		fmt.Println()
+		if *showPeer {
+			fmt.Println(i18n.T("Share the code and the peer ID with the receiver, who runs: %s", "2c1f receive "+code+" -peer "+node.Host.ID().String()))
+		} else {
+			fmt.Println(i18n.T("Share this code with the receiver."))
+		}
+	}
+	if sess != nil {
+		infoln(i18n.T("Session: %s (continue with %s)", sess.ID, "2c1f send -resume-session "+sess.ID))
+	}
+	if !sender.StartAt.IsZero() {
+		infoln(i18n.T("The transfer starts at %s.", sender.StartAt.Format("2006-01-02 15:04")))
+	}
+	if !sender.ExpiresAt.IsZero() {
+		infoln(i18n.T("The code expires at %s.", sender.ExpiresAt.Format("2006-01-02 15:04")))
+	}
+	if sender.MaxDownloads > 1 {
+		infoln(i18n.T("Up to %d receivers can download.", sender.MaxDownloads))
+	}
+	infoln(i18n.T("Waiting for peer to connect..."))
 
 	go func() {
 		ticker := time.NewTicker(30 * time.Second)
@@ -201,19 +581,175 @@ func Send(args []string) {
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				node.Advertise(code)
+				// Receivers are refused from now on, so stop inviting them
+				if sender.Closed() != nil {
+					return
+				}
+				if online {
+					node.Advertise(code)
+					node.AdvertiseDecoys(decoyCodes)
+				}
 			}
 		}
 	}()
 
-	select {
-	case err := <-transferDone:
+	var expired <-chan time.Time
+	if !sender.ExpiresAt.IsZero() {
+		timer := time.NewTimer(time.Until(sender.ExpiresAt))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	for {
+		select {
+		case err := <-transferDone:
+			// With more downloads allowed a failed receiver only ends its
+			// own transfer
+			if err != nil && sender.MaxDownloads != 1 && sender.Closed() == nil {
+				fmt.Println(i18n.T("Transfer failed: %v", err))
+				infoln(i18n.T("Waiting for the next receiver..."))
+				display.next()
+				continue
+			}
+			if err != nil {
+				saveSession(sess)
+				fmt.Println(i18n.T("Transfer failed: %v", err))
+				os.Exit(1)
+			}
+			if sender.Closed() == nil {
+				if sender.MaxDownloads > 0 {
+					fmt.Println(i18n.T("Transfer complete! %d of %d downloads done.", sender.Downloads(), sender.MaxDownloads))
+				} else {
+					fmt.Println(i18n.T("Transfer complete! %d downloads done.", sender.Downloads()))
+				}
+				infoln(i18n.T("Waiting for the next receiver..."))
+				display.next()
+				continue
+			}
+			if sess != nil {
+				sess.Delete()
+			}
+			fmt.Println(i18n.T("Transfer complete!"))
+			if sender.MaxDownloads != 1 {
+				fmt.Println(i18n.T("Stopped: %v after %d downloads.", sender.Closed(), sender.Downloads()))
+			}
+		case <-expired:
+			// A transfer in progress may finish, but not reconnect
+			if sending.Load() {
+				expired = time.After(time.Second)
+				continue
+			}
+			if sender.Downloads() == 0 {
+				saveSession(sess)
+				fmt.Println(i18n.T("Stopped: code expired before anyone downloaded the files."))
+				os.Exit(1)
+			}
+			if sess != nil {
+				sess.Delete()
+			}
+			fmt.Println(i18n.T("Stopped: code expired after %d downloads.", sender.Downloads()))
+		case <-ctx.Done():
+			// Receivers that still find the code are told why it is gone
+			sender.Withdraw()
+			saveSession(sess)
+			fmt.Println(i18n.T("Cancelled."))
+			// A transfer in progress stops at once and tells how far it got
+			var delivery *transfer.Delivery
+			select {
+			case delivery = <-cancelled:
+			default:
+				if sending.Load() {
+					select {
+					case delivery = <-cancelled:
+					case <-time.After(time.Second):
+					}
+				}
+			}
+			ended(currentPeer.Load().(peer.ID), delivery, ctx.Err())
+			if online {
+				withdraw(node, code)
+			}
+		}
+		return
+	}
+}
+
+// withdraw tells receivers that look up the code of a cancelled send
+// later that it is gone, so they fail fast
+func withdraw(node *p2p.Node, code string) {
+	infoln(i18n.T("Withdrawing the code..."))
+	if err := node.Withdraw(code); err != nil {
+		debugf("%v\n", err)
+	}
+}
+
+// saveSession writes the final progress of an unfinished send and tells the
+// user how to continue it
+// sessionSent returns the bytes sess recorded as sent to peerID, also
+// before the send was resumed
+func sessionSent(sess *session.Session, peerID peer.ID) int64 {
+	if sess == nil {
+		return 0
+	}
+	return sess.SentTo(peerID.String())
+}
+
+func saveSession(sess *session.Session) {
+	if sess == nil {
+		return
+	}
+	if err := sess.Save(); err != nil {
+		fmt.Println(i18n.T("Warning: Failed to save session: %v", err))
+		return
+	}
+	fmt.Println(i18n.T("Resume with: %s", "2c1f send -resume-session "+sess.ID))
+}
+
+// push delivers to a receiver running 2c1f serve. Unlike a normal send the
+// receiver is looked up by its code instead of waiting for it to connect.
+func push(ctx context.Context, node *p2p.Node, sender *transfer.Sender, folderPath string) (*transfer.Delivery, error) {
+	infoln(i18n.T("Searching for receiver..."))
+	peerID, err := node.FindPeer(sender.Code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find receiver: %w", err)
+	}
+	fmt.Println(i18n.T("Verification code: %s", node.ShortAuthString(peerID, sender.Code)))
+
+	started := time.Now()
+	stream, err := node.NewStream(peerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stream: %w", err)
+	}
+	defer stream.Close()
+
+	delivery, err := pushStream(ctx, sender, stream)
+	if err != nil {
+		return delivery, err
+	}
+	printConfirmation(delivery)
+	printCompression(delivery.Compression)
+	recordTransfer(folderPath, sender.Manifest.TotalSize, "send", history.SendStatus(delivery.Confirmed), delivery.Root(), verifiedReceipt(delivery, peerID), peerID, started, delivery.Compression)
+	return delivery, nil
+}
+
+// pushStream sends to the receiver that opened the transfer on stream
+func pushStream(ctx context.Context, sender *transfer.Sender, stream io.ReadWriteCloser) (*transfer.Delivery, error) {
+	if err := sender.Handshake(stream); err != nil {
+		return nil, err
+	}
+	return sendAccepted(ctx, sender, stream)
+}
+
+// sendAccepted sends to a receiver whose handshake succeeded on stream
+func sendAccepted(ctx context.Context, sender *transfer.Sender, stream io.ReadWriteCloser) (*transfer.Delivery, error) {
+	var dataStream io.ReadWriter = stream
+	if sender.Compress {
+		compressed, err := transfer.NewCompressedStreamLevel(stream, sender.CompressLevel)
 		if err != nil {
-			fmt.Printf("Transfer failed: %v\n", err)
-			os.Exit(1)
+			return nil, fmt.Errorf("failed to initialize compression: %w", err)
 		}
-		fmt.Println("Transfer complete!")
-	case <-ctx.Done():
-		fmt.Println("Cancelled.")
+		defer compressed.Close()
+		dataStream = compressed
 	}
+
+	return sender.Send(ctx, dataStream)
 }
@@ -0,0 +1,444 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ebob10000/2c1f/contacts"
+	"github.com/ebob10000/2c1f/history"
+	"github.com/ebob10000/2c1f/i18n"
+	"github.com/ebob10000/2c1f/metrics"
+	"github.com/ebob10000/2c1f/p2p"
+	"github.com/ebob10000/2c1f/serve"
+	"github.com/ebob10000/2c1f/storage"
+	"github.com/ebob10000/2c1f/transfer"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Serve runs an unattended receiver that accepts transfers pushed to a stable
+// code with `2c1f <path> -to <code>`. The list, approve and reject
+// subcommands manage transfers held in quarantine.
+func Serve(args []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "list":
+			serveList(args[1:])
+			return
+		case "approve":
+			serveApprove(args[1:])
+			return
+		case "reject":
+			serveReject(args[1:])
+			return
+		}
+	}
+
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	outputDir := fs.String("o", "", "Output directory or storage URL")
+	fs.StringVar(outputDir, "dest", "", "Storage URL such as s3://bucket/prefix or webdav://host/path, same as -o")
+	code := fs.String("code", "", "Code senders push to, a persistent code is generated if empty")
+	password := fs.String("password", "", "Password senders must know")
+	timeout := fs.Duration("timeout", transfer.StreamTimeout, "Stream inactivity timeout")
+	bootstrapTimeout := fs.Duration("bootstrap-timeout", p2p.DefaultBootstrapTimeout, "Timeout for each bootstrap peer connection")
+	maxMB := fs.Int64("max-mb-per-hour", 0, "Maximum megabytes accepted from each sender per hour, 0 for unlimited")
+	maxFiles := fs.Int("max-files-per-hour", 0, "Maximum files accepted from each sender per hour, 0 for unlimited")
+	blockExt := fs.String("block-ext", "", "Comma separated file extensions to refuse (e.g. .exe,.bat)")
+	quarantine := fs.Bool("quarantine", false, "Hold transfers in quarantine until approved with 2c1f serve approve <id>")
+	quarantineDir := fs.String("quarantine-dir", serve.DefaultQuarantineDir(), "Quarantine directory")
+	autoAccept := fs.Bool("auto-accept-contacts", false, "Save transfers from contacts without holding them in quarantine")
+	metricsAddr := fs.String("metrics", "", "Serve Prometheus metrics, /healthz and /readyz on this address (e.g. :9090)")
+	logFormat := fs.String("log-format", "text", "Log format, text or json for one JSON object per line")
+	drainTimeout := fs.Duration("drain-timeout", defaultDrainTimeout, "How long a shutdown waits for the files being received")
+	nodeConfig := nodeFlags(fs)
+	applyOutput := outputFlags(fs)
+	fs.Parse(args)
+	applyEnv(fs)
+	applyOutput()
+
+	// --json logs as JSON, where the other commands print their results
+	var logOut io.Writer = os.Stdout
+	if jsonOut != nil {
+		*logFormat = "json"
+		logOut = jsonOut
+	}
+	switch *logFormat {
+	case "text":
+	case "json":
+		jsonLog = slog.New(slog.NewJSONHandler(logOut, nil))
+	default:
+		fmt.Printf("Error: invalid log format %q, must be text or json\n", *logFormat)
+		os.Exit(1)
+	}
+
+	destPath := *outputDir
+	if destPath == "" {
+		var err error
+		destPath, err = os.Getwd()
+		if err != nil {
+			destPath = "."
+		}
+	}
+
+	var backend storage.Backend
+	if storage.IsURL(destPath) {
+		if *quarantine {
+			fatalf("-quarantine needs a local output directory")
+		}
+		var err error
+		backend, err = storage.New(destPath)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		destPath = fmt.Sprint(backend)
+	}
+
+	if *code == "" {
+		var err error
+		*code, err = serve.LoadOrCreateCode()
+		if err != nil {
+			fatalf("Failed to create serve code: %v", err)
+		}
+	}
+
+	policy := serve.Policy{
+		MaxBytesPerHour: *maxMB * 1024 * 1024,
+		MaxFilesPerHour: *maxFiles,
+	}
+	if *blockExt != "" {
+		policy.BlockedExtensions = strings.Split(*blockExt, ",")
+	}
+	limiter := serve.NewLimiter(policy)
+
+	var q *serve.Quarantine
+	if *quarantine {
+		q = &serve.Quarantine{Dir: *quarantineDir}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	drain := newDrainer()
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		// Transfers stop after their current file and resume when the
+		// sender tries again, a second signal stops them right away
+		logf("Shutting down, finishing the files being received")
+		metrics.SetReady(false)
+		select {
+		case <-drain.close():
+		case <-sigChan:
+		case <-time.After(*drainTimeout):
+			logf("Files still incomplete after %s, stopping", *drainTimeout)
+		}
+		cancel()
+	}()
+
+	if *metricsAddr != "" {
+		if err := metrics.Listen(ctx, *metricsAddr); err != nil {
+			fatalf("Failed to serve metrics: %v", err)
+		}
+		logf("Metrics on http://%s/metrics, probes at /healthz and /readyz", *metricsAddr)
+	}
+
+	logf("Starting P2P node...")
+	node, err := p2p.NewNodeWithConfig(ctx, nodeConfig())
+	if err != nil {
+		fatalf("Failed to create P2P node: %v", err)
+	}
+	defer node.Close()
+	defer metrics.TrackNode(node)()
+	node.BootstrapTimeout = *bootstrapTimeout
+	node.OnBootstrap = logBootstrap
+
+	logf("Connecting to network...")
+	if err := node.Bootstrap(); err != nil {
+		fatalf("Failed to bootstrap: %v", err)
+	}
+
+	time.Sleep(2 * time.Second)
+
+	if err := node.Advertise(*code); err != nil {
+		fatalf("Failed to advertise: %v", err)
+	}
+
+	node.SetStreamHandler(func(stream network.Stream) {
+		if !drain.add() {
+			stream.Reset()
+			return
+		}
+		defer drain.done()
+		defer stream.Close()
+
+		receiver := transfer.NewReceiver(destPath)
+		receiver.Code = *code
+		receiver.Password = *password
+		receiver.Timeout = *timeout
+		receiver.Identity = node.PrivateKey()
+		receiver.Storage = backend
+		receiver.Draining = drain.draining
+		serveIncoming(ctx, node, stream, receiver, limiter, q, *autoAccept)
+	})
+
+	metrics.SetReady(true)
+	logf("Serving on code %s, saving to %s", *code, destPath)
+	logf("Senders push with: 2c1f <path> -to %s", *code)
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// Interrupted transfers record where they stopped
+			select {
+			case <-drain.close():
+			case <-time.After(5 * time.Second):
+			}
+			logf("Stopped")
+			return
+		case <-ticker.C:
+			if !drain.closing() {
+				node.Advertise(*code)
+			}
+		}
+	}
+}
+
+// defaultDrainTimeout stays below the 30 seconds container runtimes such as
+// Kubernetes and Docker give a process between SIGTERM and SIGKILL
+const defaultDrainTimeout = 25 * time.Second
+
+// drainer tracks the transfers serve is receiving, so a shutdown can let
+// them finish their current file
+type drainer struct {
+	mu       sync.Mutex
+	active   sync.WaitGroup
+	draining chan struct{} // Closed on shutdown, see transfer.Receiver.Draining
+	stopped  bool
+}
+
+func newDrainer() *drainer {
+	return &drainer{draining: make(chan struct{})}
+}
+
+// add counts a new transfer, false once shutting down
+func (d *drainer) add() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		return false
+	}
+	d.active.Add(1)
+	return true
+}
+
+func (d *drainer) done() {
+	d.active.Done()
+}
+
+func (d *drainer) closing() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stopped
+}
+
+// close refuses new transfers and drains the others. The returned channel
+// is closed once they ended.
+func (d *drainer) close() <-chan struct{} {
+	d.mu.Lock()
+	if !d.stopped {
+		d.stopped = true
+		close(d.draining)
+	}
+	d.mu.Unlock()
+
+	ended := make(chan struct{})
+	go func() {
+		d.active.Wait()
+		close(ended)
+	}()
+	return ended
+}
+
+// serveIncoming receives one pushed transfer, applying the limiter and
+// landing it in quarantine if enabled, unless it is from a contact and
+// autoAccept is set
+func serveIncoming(ctx context.Context, node *p2p.Node, stream network.Stream, receiver *transfer.Receiver, limiter *serve.Limiter, q *serve.Quarantine, autoAccept bool) {
+	peerID := stream.Conn().RemotePeer()
+	sender := peerID.String()
+	logf("Connection from %s, verification code %s", sender[:12], node.ShortAuthString(peerID, receiver.Code))
+
+	var held *serve.Held
+	contact, trusted := contacts.Lookup(peerID)
+	if trusted && autoAccept && q != nil {
+		logf("Accepting %s from contact %s without quarantine", sender[:12], contact.Name)
+	} else if q != nil {
+		var err error
+		held, err = q.Hold(sender, receiver.DestPath)
+		if err != nil {
+			logf("Refusing %s: %v", sender[:12], err)
+			return
+		}
+		receiver.DestPath = q.Path(held.ID)
+	}
+
+	started := time.Now()
+	tracked := metrics.Start("receive")
+	receiver.OnProgress = tracked.Progress
+	receiver.OnConfirmation = func(m *transfer.Manifest) bool {
+		if err := limiter.Admit(sender, m); err != nil {
+			logf("Rejected %s from %s: %v", m.FolderName, sender[:12], err)
+			return false
+		}
+		logf("Receiving %s from %s (%s, %d files)", m.FolderName, sender[:12], transfer.FormatBytes(m.TotalSize), len(m.Files))
+		return true
+	}
+
+	err := receiver.Receive(ctx, stream)
+	tracked.Done(err)
+	if err != nil {
+		if receiver.Manifest == nil && ctx.Err() == nil {
+			metrics.HandshakeFailed()
+		}
+		if held != nil {
+			q.Discard(held.ID)
+		}
+		if errors.Is(err, transfer.ErrDrained) {
+			logf("Stopped receiving %s from %s for the shutdown", receiver.Manifest.FolderName, sender[:12])
+			return
+		}
+		if transfer.CategoryOf(err) != transfer.CategoryRejected {
+			logf("Transfer from %s failed: %v", sender[:12], err)
+		}
+		return
+	}
+
+	if held != nil {
+		if err := q.Complete(held, receiver.Manifest); err != nil {
+			logf("Failed to record quarantined transfer: %v", err)
+			return
+		}
+		logf("Holding %s in quarantine, approve with: 2c1f serve approve %s", receiver.Manifest.FolderName, held.ID)
+		return
+	}
+
+	savedPath := receiver.LocalFolder()
+	recordTransfer(savedPath, receiver.Manifest.TotalSize, "receive", history.StatusComplete, receiver.Root(), nil, peerID, started, receiver.Compression)
+	logf("Saved %s (%s)", savedPath, shortSummary(receiver.Summary()))
+}
+
+func serveList(args []string) {
+	fs := flag.NewFlagSet("serve list", flag.ExitOnError)
+	quarantineDir := fs.String("quarantine-dir", serve.DefaultQuarantineDir(), "Quarantine directory")
+	applyOutput := outputFlags(fs)
+	fs.Parse(args)
+	applyOutput()
+
+	held, err := (&serve.Quarantine{Dir: *quarantineDir}).List()
+	if err != nil {
+		fmt.Println(i18n.T("Error: %v", err))
+		os.Exit(1)
+	}
+	if held == nil {
+		held = []serve.Held{}
+	}
+	if printJSON(held) {
+		return
+	}
+	if len(held) == 0 {
+		fmt.Println("No transfers in quarantine.")
+		return
+	}
+	for _, h := range held {
+		status := "ready"
+		if !h.Complete {
+			status = "receiving"
+		}
+		fmt.Printf("%s  %s  %-9s  %10s  %4d files  %s  from %s\n",
+			h.ID, h.Received.Local().Format("2006-01-02 15:04"), status, transfer.FormatBytes(h.Size), h.Files, h.FolderName, h.PeerID[:12])
+	}
+}
+
+func serveApprove(args []string) {
+	fs := flag.NewFlagSet("serve approve", flag.ExitOnError)
+	quarantineDir := fs.String("quarantine-dir", serve.DefaultQuarantineDir(), "Quarantine directory")
+	ids := parseArgs(fs, args)
+
+	if len(ids) == 0 {
+		fmt.Println("Usage: 2c1f serve approve <id>")
+		os.Exit(1)
+	}
+
+	q := &serve.Quarantine{Dir: *quarantineDir}
+	for _, id := range ids {
+		held, err := q.Approve(id)
+		if err != nil {
+			fmt.Println(i18n.T("Error: %v", err))
+			os.Exit(1)
+		}
+		recordTransfer(held.ReleasePath(), held.Size, "receive", history.StatusComplete, "", nil, peer.ID(held.PeerID), time.Time{}, transfer.CompressionStats{})
+		fmt.Printf("Released %s\n", held.ReleasePath())
+	}
+}
+
+func serveReject(args []string) {
+	fs := flag.NewFlagSet("serve reject", flag.ExitOnError)
+	quarantineDir := fs.String("quarantine-dir", serve.DefaultQuarantineDir(), "Quarantine directory")
+	ids := parseArgs(fs, args)
+
+	if len(ids) == 0 {
+		fmt.Println("Usage: 2c1f serve reject <id>")
+		os.Exit(1)
+	}
+
+	q := &serve.Quarantine{Dir: *quarantineDir}
+	for _, id := range ids {
+		if err := q.Discard(id); err != nil {
+			fmt.Println(i18n.T("Error: %v", err))
+			os.Exit(1)
+		}
+		fmt.Printf("Deleted %s\n", id)
+	}
+}
+
+// jsonLog writes the log as JSON lines when set, see -log-format
+var jsonLog *slog.Logger
+
+func logf(format string, args ...interface{}) {
+	if jsonLog != nil {
+		jsonLog.Info(fmt.Sprintf(format, args...))
+		return
+	}
+	fmt.Printf("%s  %s\n", time.Now().Format("2006-01-02 15:04:05"), fmt.Sprintf(format, args...))
+}
+
+// logBootstrap logs the outcome of each bootstrap set, see p2p.Node.OnBootstrap
+func logBootstrap(set string, err error) {
+	if err != nil {
+		logf("Could not reach the %s bootstrap peers: %v", set, err)
+		return
+	}
+	logf("Connected through the %s bootstrap peers", set)
+}
+
+// fatalf logs an error like logf and exits
+func fatalf(format string, args ...interface{}) {
+	if jsonLog != nil {
+		jsonLog.Error(fmt.Sprintf(format, args...))
+	} else {
+		fmt.Println(i18n.T("Error: %v", fmt.Sprintf(format, args...)))
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,272 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ebob10000/2c1f/history"
+	"github.com/ebob10000/2c1f/i18n"
+	"github.com/ebob10000/2c1f/p2p"
+	"github.com/ebob10000/2c1f/serve"
+	"github.com/ebob10000/2c1f/shares"
+	"github.com/ebob10000/2c1f/transfer"
+	"github.com/ebob10000/2c1f/words"
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// Share runs a sender that offers several folders under one code until it
+// is stopped. Each share has a label, which receivers pick with
+// `2c1f receive -share <label> <code>`. Every receiver that knows the code
+// (and the password if set) may download, as often as it likes. The add,
+// list and rm subcommands manage named shares, which serve offers on a
+// stable code and identity.
+func Share(args []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "add":
+			shareAdd(args[1:])
+			return
+		case "list":
+			shareList(args[1:])
+			return
+		case "rm":
+			shareRemove(args[1:])
+			return
+		case "serve":
+			offerShares("share serve", args[1:], true)
+			return
+		}
+	}
+	offerShares("share", args, false)
+}
+
+// offerShares runs the sender of Share. Saved offers the named shares with
+// the persistent code and identity instead of those given in args.
+func offerShares(name string, args []string, saved bool) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	code := fs.String("code", "", "Code to offer the shares on, a new one is generated if empty")
+	password := fs.String("password", "", "Password receivers must know, never sent over the network")
+	compress := fs.Bool("compress", false, "Enable compression")
+	compressLevel := fs.Int("compress-level", transfer.DefaultCompressLevel, "Gzip compression level from 1 (fastest) to 9 (smallest)")
+	skipHash := fs.Bool("skip-hash", false, "Skip file hashing (faster start, less secure resume)")
+	sourceLimit := fs.Int("source-limit", 0, "Read files at most this many MB/s, 40 on network mounts if 0, unlimited if -1")
+	timeout := fs.Duration("timeout", transfer.StreamTimeout, "Stream inactivity timeout")
+	bootstrapTimeout := fs.Duration("bootstrap-timeout", p2p.DefaultBootstrapTimeout, "Timeout for each bootstrap peer connection")
+	nodeConfig := nodeFlags(fs)
+	applyOutput := outputFlags(fs)
+	positional := parseArgs(fs, args)
+	applyEnv(fs)
+	applyOutput()
+
+	var offered []shares.Share
+	if saved && len(positional) > 0 {
+		fmt.Println("Usage: 2c1f share serve [flags], add shares with 2c1f share add <name> <path>")
+		os.Exit(1)
+	}
+	if saved {
+		offered = shares.Load()
+		if len(offered) == 0 {
+			fatalf("No shares yet, add one with 2c1f share add <name> <path>")
+		}
+	} else {
+		for _, arg := range positional {
+			label, path, ok := strings.Cut(arg, "=")
+			if !ok {
+				label, path = filepath.Base(filepath.Clean(arg)), arg
+			}
+			offered = append(offered, shares.Share{Name: label, Path: path})
+		}
+	}
+	if len(offered) == 0 {
+		fmt.Println("Usage: 2c1f share [flags] <label>=<path>... (the label defaults to the folder name)")
+		os.Exit(1)
+	}
+	if err := transfer.CheckCompressLevel(*compressLevel); err != nil {
+		fatalf("%v", err)
+	}
+	if *code == "" {
+		var err error
+		if saved {
+			*code, err = serve.LoadOrCreateShareCode()
+		} else {
+			*code, err = words.Generate()
+		}
+		if err != nil {
+			fatalf("Failed to generate code: %v", err)
+		}
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	catalog := transfer.NewCatalog(*code)
+	for _, share := range offered {
+		logf("Hashing %s...", share.Path)
+		sender, err := transfer.NewSenderLimited(ctx, share.Path, false, *skipHash, transfer.SourceLimit(share.Path, *sourceLimit), nil)
+		if err == nil {
+			sender.Password = *password
+			sender.Compress = *compress
+			sender.CompressLevel = *compressLevel
+			sender.Timeout = *timeout
+			err = catalog.Add(share.Name, sender)
+		}
+		// A saved share whose folder is gone does not stop the others
+		if err != nil && saved && transfer.CategoryOf(err) != transfer.CategoryCancelled {
+			logf("Skipping %s: %v", share.Name, err)
+			continue
+		}
+		if err != nil {
+			fatalf("Failed to share %s: %v", share.Path, err)
+		}
+	}
+	if len(catalog.Labels()) == 0 {
+		fatalf("None of the shares can be offered")
+	}
+
+	// Known receivers find the named shares by the peer ID as well
+	cfg := nodeConfig()
+	if saved {
+		key, err := p2p.LoadOrCreateIdentity(p2p.GetIdentityPath())
+		if err != nil {
+			fatalf("Failed to load identity: %v", err)
+		}
+		cfg.Identity = key
+	}
+
+	logf("Starting P2P node...")
+	node, err := p2p.NewNodeWithConfig(ctx, cfg)
+	if err != nil {
+		fatalf("Failed to create P2P node: %v", err)
+	}
+	defer node.Close()
+	node.BootstrapTimeout = *bootstrapTimeout
+	node.OnBootstrap = logBootstrap
+
+	logf("Connecting to network...")
+	if err := node.Bootstrap(); err != nil {
+		fatalf("Failed to bootstrap: %v", err)
+	}
+
+	time.Sleep(2 * time.Second)
+
+	advertise := func() error {
+		if saved {
+			if err := node.AdvertiseIdentity(); err != nil {
+				return err
+			}
+		}
+		return node.Advertise(*code)
+	}
+	if err := advertise(); err != nil {
+		fatalf("Failed to advertise: %v", err)
+	}
+
+	node.SetStreamHandler(func(stream network.Stream) {
+		defer stream.Close()
+		peerID := stream.Conn().RemotePeer()
+		sender, err := catalog.Handshake(stream, func(ctx context.Context, token []byte) (io.ReadWriteCloser, error) {
+			return node.AcceptDataStream(ctx, peerID, token)
+		})
+		if err != nil {
+			if !errors.Is(err, transfer.ErrTooManyHandshakes) {
+				logf("Handshake with %s failed: %v", peerID.String()[:12], err)
+			}
+			stream.Reset()
+			return
+		}
+		logf("Sending %s to %s, verification code %s", sender.Manifest.FolderName, peerID.String()[:12], node.ShortAuthString(peerID, *code))
+
+		started := time.Now()
+		delivery, err := sendAccepted(ctx, sender, stream)
+		if err != nil {
+			if transfer.CategoryOf(err) != transfer.CategoryCancelled {
+				logf("Transfer of %s to %s failed: %v", sender.Manifest.FolderName, peerID.String()[:12], err)
+			}
+			return
+		}
+		recordTransfer(sender.FolderPath, sender.Manifest.TotalSize, "send", history.SendStatus(delivery.Confirmed), delivery.Root(), verifiedReceipt(delivery, peerID), peerID, started, delivery.Compression)
+		logf("Sent %s to %s (%s)", sender.Manifest.FolderName, peerID.String()[:12], shortSummary(delivery.Summary()))
+	})
+
+	printJSON(jsonEvent{Event: "code", Code: *code})
+	logf("Sharing %s on code %s", strings.Join(catalog.Labels(), ", "), *code)
+	if saved {
+		logf("Peer ID %s", node.Host.ID())
+	}
+	logf("Receivers download with: 2c1f receive -share <label> %s", *code)
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			logf("Stopped")
+			return
+		case <-ticker.C:
+			advertise()
+		}
+	}
+}
+
+func shareAdd(args []string) {
+	fs := flag.NewFlagSet("share add", flag.ExitOnError)
+	applyOutput := outputFlags(fs)
+	args = parseArgs(fs, args)
+	applyOutput()
+
+	if len(args) != 2 {
+		fmt.Println("Usage: 2c1f share add <name> <path>")
+		os.Exit(1)
+	}
+	share, err := shares.Add(args[0], args[1])
+	if err != nil {
+		fmt.Println(i18n.T("Error: %v", err))
+		os.Exit(1)
+	}
+	if !printJSON(share) {
+		fmt.Printf("Added %s, offered by 2c1f share serve\n", share.Name)
+	}
+}
+
+func shareList(args []string) {
+	fs := flag.NewFlagSet("share list", flag.ExitOnError)
+	applyOutput := outputFlags(fs)
+	fs.Parse(args)
+	applyOutput()
+
+	list := shares.Load()
+	if printJSON(list) {
+		return
+	}
+	if len(list) == 0 {
+		fmt.Println("No shares. Add one with 2c1f share add <name> <path>.")
+		return
+	}
+	for _, s := range list {
+		fmt.Printf("%-16s  %s\n", s.Name, s.Path)
+	}
+}
+
+func shareRemove(args []string) {
+	fs := flag.NewFlagSet("share rm", flag.ExitOnError)
+	names := parseArgs(fs, args)
+
+	if len(names) == 0 {
+		fmt.Println("Usage: 2c1f share rm <name>")
+		os.Exit(1)
+	}
+	for _, name := range names {
+		if err := shares.Remove(name); err != nil {
+			fmt.Println(i18n.T("Error: %v", err))
+			os.Exit(1)
+		}
+		fmt.Printf("Removed %s\n", name)
+	}
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ebob10000/2c1f/i18n"
+	"github.com/ebob10000/2c1f/settings"
+	"github.com/ebob10000/2c1f/updater"
+	"github.com/ebob10000/2c1f/version"
+)
+
+func Update(args []string) {
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	rollback := fs.Bool("rollback", false, "Restore the version that was installed before the last update")
+	applyOutput := outputFlags(fs)
+	fs.Parse(args)
+	applyOutput()
+
+	if *rollback {
+		exePath, err := os.Executable()
+		if err != nil {
+			fmt.Printf("Error: Failed to get executable path: %v\n", err)
+			os.Exit(1)
+		}
+		state, err := updater.Rollback(exePath)
+		if err != nil {
+			fmt.Println(i18n.T("Error: %v", err))
+			os.Exit(1)
+		}
+		if state != nil && state.PreviousVersion != "" {
+			fmt.Printf("Rolled back from v%s to v%s.\n", state.NewVersion, state.PreviousVersion)
+		} else {
+			fmt.Println("Rolled back to the previous version.")
+		}
+		return
+	}
+
+	userSettings := settings.LoadSettings()
+	updater.Proxy = userSettings.UpdateProxy
+
+	fmt.Printf("Current version: v%s\n", version.Version)
+	info, err := updater.CheckForUpdates("ebob10000/2c1f", version.Version, userSettings.UpdateChannel)
+	if err != nil {
+		fmt.Printf("Error: Failed to check for updates: %v\n", err)
+		os.Exit(1)
+	}
+	if printJSON(updateStatus{Version: version.Version, Update: info}) {
+		return
+	}
+	if info == nil {
+		fmt.Println("You are running the latest version.")
+		return
+	}
+	fmt.Printf("Update available: v%s\n", info.Version)
+	for _, entry := range info.Changelog {
+		fmt.Printf("\n== v%s ==\n", entry.Version)
+		if entry.Notes != "" {
+			fmt.Println(strings.TrimSpace(entry.Notes))
+		}
+	}
+	fmt.Println()
+	if !info.CanInstall {
+		fmt.Println(info.InstallHint)
+		return
+	}
+	fmt.Println("Install it from the desktop app or download it from https://github.com/ebob10000/2c1f/releases")
+}
+
+// updateStatus is printed by update with --json
+type updateStatus struct {
+	Version string              `json:"version"`
+	Update  *updater.UpdateInfo `json:"update"` // Null if the version is the latest
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ebob10000/2c1f/contacts"
+	"github.com/ebob10000/2c1f/history"
+	"github.com/ebob10000/2c1f/i18n"
+	"github.com/ebob10000/2c1f/p2p"
+	"github.com/ebob10000/2c1f/settings"
+	"github.com/ebob10000/2c1f/transfer"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// GetPeerID returns this device's permanent ID that others add as a contact
+func (a *App) GetPeerID() (string, error) {
+	key, err := p2p.LoadOrCreateIdentity(p2p.GetIdentityPath())
+	if err != nil {
+		return "", err
+	}
+	id, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+// ListContacts returns the saved contacts
+func (a *App) ListContacts() []contacts.Contact {
+	return contacts.Load()
+}
+
+// AddContact pins a peer ID under a name. Transfers from contacts are
+// accepted without a code.
+func (a *App) AddContact(name, peerID string) (contacts.Contact, error) {
+	c, err := contacts.Add(name, peerID)
+	if err != nil {
+		return c, err
+	}
+	go a.startInbox()
+	return c, nil
+}
+
+// RemoveContact deletes a contact, its transfers are refused from now on
+func (a *App) RemoveContact(name string) error {
+	return contacts.Remove(name)
+}
+
+// SendToContact sends path directly to a contact without exchanging a code.
+// The contact must have 2c1f open.
+func (a *App) SendToContact(path, name string, compress, skipHash, cacheManifest bool) error {
+	contact, err := contacts.Named(name)
+	if err != nil {
+		return err
+	}
+	peerID, err := contact.ID()
+	if err != nil {
+		return err
+	}
+	node, err := a.startInbox()
+	if err != nil {
+		return err
+	}
+	ctx, cancel, ok := a.claimTransfer()
+	if !ok {
+		return errors.New("a transfer is already in progress")
+	}
+	opts := a.GetSettings()
+
+	go func() {
+		defer cancel()
+		a.events.Emit("sender_status", i18n.T("Initializing..."))
+		limit := transfer.SourceLimit(path, opts.SourceLimit)
+		sender, err := transfer.NewSenderLimited(ctx, path, cacheManifest, skipHash, limit, func(path string, size int64) {
+			a.events.Emit("hashing_progress", map[string]interface{}{
+				"filename": path,
+				"size":     size,
+			})
+		})
+		if err != nil {
+			if transfer.CategoryOf(err) != transfer.CategoryCancelled {
+				a.events.Emit("error", i18n.T("Failed to prepare files: %v", err))
+			}
+			return
+		}
+		sender.Code = p2p.ContactCode(node.Host.ID(), peerID)
+		sender.Compress = compress
+		sender.CompressLevel = opts.CompressLevel
+		sender.Timeout = time.Duration(opts.Timeout) * time.Second
+
+		types := sender.FileTypes()
+		a.events.Emit("transfer_manifest", map[string]interface{}{
+			"folderName": sender.Manifest.FolderName,
+			"files":      sender.Manifest.Files,
+			"totalSize":  sender.Manifest.TotalSize,
+			"types":      types,
+			"kinds":      transfer.CountKinds(types),
+		})
+		progress := newProgressTracker(a.events, sender.Manifest.TotalSize)
+		sender.OnStartFile = progress.onStartFile
+		sender.OnProgress = progress.onProgress
+		sender.OnFileComplete = progress.onFileComplete
+
+		a.events.Emit("sender_status", i18n.T("Connecting to %s...", contact.Name))
+		if err := node.DialPeer(peerID); err != nil {
+			a.emitTransferError(i18n.T("Contact unreachable"), err)
+			return
+		}
+		started := time.Now()
+		stream, err := node.NewStream(peerID)
+		if err != nil {
+			a.emitTransferError(i18n.T("Connection failed"), err)
+			return
+		}
+		defer stream.Close()
+
+		if err := sender.Handshake(stream); err != nil {
+			a.emitTransferError(i18n.T("Handshake failed"), err)
+			return
+		}
+		a.events.Emit("log", i18n.T("Connected to %s", contact.Name))
+
+		var dataStream io.ReadWriter = stream
+		if sender.Compress {
+			compressed, err := transfer.NewCompressedStreamLevel(stream, sender.CompressLevel)
+			if err != nil {
+				a.emitTransferError(i18n.T("Compression init failed"), err)
+				return
+			}
+			defer compressed.Close()
+			dataStream = compressed
+		}
+
+		delivery, err := sender.Send(ctx, dataStream)
+		if err != nil {
+			if transfer.CategoryOf(err) != transfer.CategoryCancelled {
+				a.emitTransferError(i18n.T("Transfer failed"), err)
+			}
+			return
+		}
+
+		a.emitComplete(fmt.Sprintf("Sent to %s", contact.Name), delivery.Summary())
+		record := history.NewRecord(path, sender.Manifest.TotalSize, "send", history.SendStatus(delivery.Confirmed))
+		record.SetCompression(delivery.Compression)
+		record.Root = delivery.Root()
+		record.Peer = peerID.String()
+		record.Duration = time.Since(started)
+		if receipt := delivery.Receipt; receipt != nil && receipt.PeerID == peerID.String() {
+			record.Receipt = receipt
+		}
+		a.addRecord(record)
+	}()
+	return nil
+}
+
+// startInbox starts the node that uses the permanent identity, if it is not
+// running yet. It accepts transfers from contacts and dials them for
+// SendToContact.
+func (a *App) startInbox() (*p2p.Node, error) {
+	a.inboxMu.Lock()
+	defer a.inboxMu.Unlock()
+	if a.inbox != nil {
+		return a.inbox, nil
+	}
+
+	key, err := p2p.LoadOrCreateIdentity(p2p.GetIdentityPath())
+	if err != nil {
+		return nil, err
+	}
+	cfg := a.nodeConfig(false)
+	cfg.Identity = key
+	node, err := p2p.NewNodeWithConfig(a.ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start contact node: %w", err)
+	}
+	a.configureNode(node)
+	if err := node.Bootstrap(); err != nil {
+		node.Close()
+		return nil, fmt.Errorf("bootstrap failed: %w", err)
+	}
+	node.SetStreamHandler(func(stream network.Stream) {
+		defer stream.Close()
+		a.receiveFromContact(node, stream)
+	})
+
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		for {
+			node.AdvertiseIdentity()
+			select {
+			case <-node.Ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	a.inbox = node
+	return node, nil
+}
+
+func (a *App) closeInbox() {
+	a.inboxMu.Lock()
+	node := a.inbox
+	a.inbox = nil
+	a.inboxMu.Unlock()
+	if node != nil {
+		node.Close()
+	}
+}
+
+// receiveFromContact accepts a transfer pushed by a contact, without asking
+// if AutoAcceptFromContacts is set, and refuses everyone else
+func (a *App) receiveFromContact(node *p2p.Node, stream network.Stream) {
+	peerID := stream.Conn().RemotePeer()
+	contact, ok := contacts.Lookup(peerID)
+	if !ok {
+		transfer.WriteMessage(stream, &transfer.Message{Type: transfer.MsgError, Payload: []byte("Not a contact")})
+		return
+	}
+
+	ctx, cancel, ok := a.claimTransfer()
+	if !ok {
+		transfer.WriteMessage(stream, &transfer.Message{Type: transfer.MsgError, Payload: []byte("Transfer already in progress")})
+		return
+	}
+	defer cancel()
+
+	opts := a.GetSettings()
+	destPath := contactDir(opts)
+	// Accepted ones only show a notification, the others ask like a
+	// transfer with a code
+	autoAccept := opts.AutoAcceptFromContacts
+	a.events.Emit("contact_transfer", map[string]interface{}{"name": contact.Name, "autoAccept": autoAccept})
+	a.events.Emit("log", i18n.T("Receiving from contact %s", contact.Name))
+
+	started := time.Now()
+	receiver := transfer.NewReceiver(destPath)
+	receiver.Code = p2p.ContactCode(node.Host.ID(), peerID)
+	receiver.Identity = node.PrivateKey()
+	receiver.Timeout = time.Duration(opts.Timeout) * time.Second
+	// Contacts are trusted, so their programs may run without Gatekeeper
+	// asking first if the user chose so
+	receiver.Quarantine = !opts.NoQuarantine && !opts.NoQuarantineContacts
+	receiver.OnConfirmation = func(m *transfer.Manifest) bool {
+		if !autoAccept {
+			choice := a.awaitTransferConfirmation(ctx, m)
+			if !choice.accept {
+				return false
+			}
+			receiver.FolderName = choice.folderName
+			receiver.Skip = make(map[string]bool, len(choice.skip))
+			for _, path := range choice.skip {
+				receiver.Skip[path] = true
+			}
+		}
+		files, types, totalSize := selectedFiles(m, receiver.Skip)
+		progress := newProgressTracker(a.events, totalSize)
+		receiver.OnStartFile = progress.onStartFile
+		receiver.OnProgress = progress.onProgress
+		progress.localPath = receiver.LocalPath
+		receiver.OnFileComplete = progress.onFileComplete
+		a.events.Emit("transfer_manifest", map[string]interface{}{
+			"folderName":  filepath.Base(receiver.LocalFolder()),
+			"totalSize":   totalSize,
+			"fileCount":   len(files),
+			"files":       files,
+			"fingerprint": transfer.Fingerprint(m.Root),
+			"types":       types,
+			"kinds":       transfer.CountKinds(types),
+		})
+		return true
+	}
+
+	if err := receiver.Receive(ctx, stream); err != nil {
+		if transfer.CategoryOf(err) != transfer.CategoryCancelled {
+			a.emitTransferError(i18n.T("Transfer failed"), err)
+		}
+		return
+	}
+	a.emitComplete(receiver.LocalFolder(), receiver.Summary())
+	status := history.StatusComplete
+	if len(receiver.Skip) > 0 {
+		status = history.StatusPartial
+	}
+	record := history.NewRecord(receiver.Manifest.FolderName, receiver.Manifest.TotalSize, "receive", status)
+	record.SetCompression(receiver.Compression)
+	record.Root = receiver.Root()
+	record.Peer = peerID.String()
+	record.Duration = time.Since(started)
+	a.addRecord(record)
+}
+
+// contactDir is where transfers from contacts are saved
+func contactDir(s settings.AppSettings) string {
+	if s.ContactDir != "" {
+		return s.ContactDir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "."
+	}
+	if info, err := os.Stat(filepath.Join(home, "Downloads")); err == nil && info.IsDir() {
+		return filepath.Join(home, "Downloads")
+	}
+	return home
+}
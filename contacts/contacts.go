@@ -0,0 +1,131 @@
+package contacts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ebob10000/2c1f/paths"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Contact is a trusted device, identified by its pinned peer ID
+type Contact struct {
+	Name   string    `json:"name"`
+	PeerID string    `json:"peerId"`
+	Added  time.Time `json:"added"`
+}
+
+// ErrNotFound is returned when no contact has the given name
+var ErrNotFound = errors.New("contact not found")
+
+// GetContactsPath returns the path to the contacts file
+func GetContactsPath() string {
+	return paths.Config("contacts.json", ".2c1f-contacts.json")
+}
+
+// Load reads the contacts file. A missing or corrupted file yields no contacts.
+func Load() []Contact {
+	return loadFrom(GetContactsPath())
+}
+
+// Add saves a new contact. Names are unique ignoring case and each peer ID
+// can only be added once.
+func Add(name, peerID string) (Contact, error) {
+	return addTo(GetContactsPath(), name, peerID)
+}
+
+// Remove deletes the contact with the given name
+func Remove(name string) error {
+	return removeFrom(GetContactsPath(), name)
+}
+
+// Lookup returns the contact pinned to id
+func Lookup(id peer.ID) (Contact, bool) {
+	return lookupIn(Load(), id)
+}
+
+// Named returns the contact called name
+func Named(name string) (Contact, error) {
+	for _, c := range Load() {
+		if strings.EqualFold(c.Name, name) {
+			return c, nil
+		}
+	}
+	return Contact{}, ErrNotFound
+}
+
+// ID returns the contact's decoded peer ID
+func (c Contact) ID() (peer.ID, error) {
+	return peer.Decode(c.PeerID)
+}
+
+func lookupIn(list []Contact, id peer.ID) (Contact, bool) {
+	for _, c := range list {
+		if c.PeerID == id.String() {
+			return c, true
+		}
+	}
+	return Contact{}, false
+}
+
+func addTo(path, name, peerID string) (Contact, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Contact{}, errors.New("contact name is required")
+	}
+	id, err := peer.Decode(strings.TrimSpace(peerID))
+	if err != nil {
+		return Contact{}, fmt.Errorf("invalid peer ID: %w", err)
+	}
+
+	list := loadFrom(path)
+	for _, c := range list {
+		if strings.EqualFold(c.Name, name) {
+			return Contact{}, fmt.Errorf("a contact named %s already exists", c.Name)
+		}
+		if c.PeerID == id.String() {
+			return Contact{}, fmt.Errorf("this device is already saved as %s", c.Name)
+		}
+	}
+
+	contact := Contact{Name: name, PeerID: id.String(), Added: time.Now()}
+	return contact, saveTo(path, append(list, contact))
+}
+
+func removeFrom(path, name string) error {
+	list := loadFrom(path)
+	for i, c := range list {
+		if strings.EqualFold(c.Name, name) {
+			return saveTo(path, append(list[:i], list[i+1:]...))
+		}
+	}
+	return ErrNotFound
+}
+
+func loadFrom(path string) []Contact {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []Contact{}
+	}
+	var list []Contact
+	if err := json.Unmarshal(data, &list); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to parse contacts file: %v\n", err)
+		return []Contact{}
+	}
+	return list
+}
+
+func saveTo(path string, list []Contact) error {
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal contacts: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save contacts: %w", err)
+	}
+	return nil
+}
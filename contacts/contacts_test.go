@@ -0,0 +1,77 @@
+package contacts
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func newPeerID(t *testing.T) peer.ID {
+	t.Helper()
+	_, pub, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestAddLookupRemove(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "contacts.json")
+	laptop, phone := newPeerID(t), newPeerID(t)
+
+	if _, err := addTo(path, "Laptop", laptop.String()); err != nil {
+		t.Fatalf("addTo failed: %v", err)
+	}
+	if _, err := addTo(path, "Phone", phone.String()); err != nil {
+		t.Fatalf("addTo failed: %v", err)
+	}
+
+	list := loadFrom(path)
+	if len(list) != 2 {
+		t.Fatalf("Expected 2 contacts, got %d", len(list))
+	}
+	c, ok := lookupIn(list, phone)
+	if !ok || c.Name != "Phone" {
+		t.Errorf("lookupIn = %+v, %v", c, ok)
+	}
+	if id, err := c.ID(); err != nil || id != phone {
+		t.Errorf("ID() = %v, %v", id, err)
+	}
+
+	if err := removeFrom(path, "laptop"); err != nil {
+		t.Fatalf("removeFrom failed: %v", err)
+	}
+	if _, ok := lookupIn(loadFrom(path), laptop); ok {
+		t.Error("Removed contact still found")
+	}
+	if err := removeFrom(path, "laptop"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestAddRejectsDuplicatesAndInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "contacts.json")
+	id := newPeerID(t)
+
+	if _, err := addTo(path, "Laptop", id.String()); err != nil {
+		t.Fatalf("addTo failed: %v", err)
+	}
+	if _, err := addTo(path, "LAPTOP", newPeerID(t).String()); err == nil {
+		t.Error("Expected duplicate name to fail")
+	}
+	if _, err := addTo(path, "Other", id.String()); err == nil {
+		t.Error("Expected duplicate peer ID to fail")
+	}
+	if _, err := addTo(path, "Bad", "not-a-peer-id"); err == nil {
+		t.Error("Expected invalid peer ID to fail")
+	}
+	if _, err := addTo(path, " ", newPeerID(t).String()); err == nil {
+		t.Error("Expected empty name to fail")
+	}
+}
@@ -0,0 +1,294 @@
+package daemon
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ebob10000/2c1f/client"
+	"github.com/ebob10000/2c1f/history"
+	"github.com/ebob10000/2c1f/p2p"
+	"github.com/ebob10000/2c1f/settings"
+	"github.com/ebob10000/2c1f/transfer"
+)
+
+// Status is the lifecycle state of a transfer
+type Status string
+
+const (
+	StatusPreparing    Status = "preparing"
+	StatusWaiting      Status = "waiting" // Sender is waiting for the receiver to connect
+	StatusConnecting   Status = "connecting"
+	StatusTransferring Status = "transferring"
+	StatusComplete     Status = "complete"
+	StatusFailed       Status = "failed"
+	StatusCancelled    Status = "cancelled"
+)
+
+// ErrNotFound is returned for unknown transfer IDs
+var ErrNotFound = errors.New("transfer not found")
+
+// Transfer is a snapshot of a transfer's state
+type Transfer struct {
+	ID          string     `json:"id"`
+	Direction   string     `json:"direction"` // "send" or "receive"
+	Path        string     `json:"path"`      // Source for sends, destination folder for receives
+	Code        string     `json:"code"`
+	Status      Status     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	Name        string     `json:"name,omitempty"`
+	Files       int        `json:"files"`
+	TotalBytes  int64      `json:"totalBytes"`
+	DoneBytes   int64      `json:"doneBytes"`
+	CurrentFile string     `json:"currentFile,omitempty"`
+	Started     time.Time  `json:"started"`
+	Finished    *time.Time `json:"finished,omitempty"`
+}
+
+// SendRequest describes a transfer to start sending
+type SendRequest struct {
+	Path     string `json:"path"`
+	Compress bool   `json:"compress"`
+	SkipHash bool   `json:"skipHash"`
+	Password string `json:"password"`
+}
+
+// ReceiveRequest describes a transfer to start receiving
+type ReceiveRequest struct {
+	Code       string `json:"code"`
+	Dest       string `json:"dest"`
+	Password   string `json:"password"`
+	FastResume bool   `json:"fastResume"`
+}
+
+// Manager runs transfers in the background and tracks their progress
+type Manager struct {
+	Timeout          time.Duration // Stream inactivity timeout
+	BootstrapTimeout time.Duration
+	Retries          int            // Reconnection attempts for receives
+	Monitor          client.Monitor // Observes the transfers, e.g. for metrics, if set
+
+	ctx   context.Context
+	mu    sync.Mutex
+	jobs  map[string]*job
+	order []string
+}
+
+type job struct {
+	mu     sync.Mutex
+	state  Transfer
+	cancel context.CancelFunc
+}
+
+// NewManager creates a manager whose transfers stop when ctx is cancelled
+func NewManager(ctx context.Context) *Manager {
+	return &Manager{
+		Timeout:          transfer.StreamTimeout,
+		BootstrapTimeout: p2p.DefaultBootstrapTimeout,
+		Retries:          transfer.MaxRetries,
+		ctx:              ctx,
+		jobs:             make(map[string]*job),
+	}
+}
+
+// Send validates the request and starts sending in the background. The
+// returned transfer already carries the code to give to the receiver.
+func (m *Manager) Send(req SendRequest) (Transfer, error) {
+	if req.Path == "" {
+		return Transfer{}, errors.New("path is required")
+	}
+	path, err := filepath.Abs(req.Path)
+	if err != nil {
+		return Transfer{}, err
+	}
+
+	opts := m.options(req.Password)
+	opts.Compress = req.Compress
+	opts.SkipHash = req.SkipHash
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	code, events, err := client.Send(ctx, path, opts)
+	if err != nil {
+		cancel()
+		return Transfer{}, err
+	}
+
+	j := m.add("send", path, string(code), cancel)
+	go j.track(events)
+	return j.snapshot(), nil
+}
+
+// Receive validates the request and starts receiving in the background
+func (m *Manager) Receive(req ReceiveRequest) (Transfer, error) {
+	dest := req.Dest
+	if dest == "" {
+		dest = "."
+	}
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return Transfer{}, err
+	}
+
+	opts := m.options(req.Password)
+	opts.FastResume = req.FastResume
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	events, err := client.Receive(ctx, req.Code, dest, opts)
+	if err != nil {
+		cancel()
+		return Transfer{}, err
+	}
+
+	j := m.add("receive", dest, req.Code, cancel)
+	go j.track(events)
+	return j.snapshot(), nil
+}
+
+// List returns all transfers, oldest first
+func (m *Manager) List() []Transfer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	transfers := make([]Transfer, 0, len(m.order))
+	for _, id := range m.order {
+		transfers = append(transfers, m.jobs[id].snapshot())
+	}
+	return transfers
+}
+
+// Get returns the transfer with the given ID
+func (m *Manager) Get(id string) (Transfer, error) {
+	m.mu.Lock()
+	j, ok := m.jobs[id]
+	m.mu.Unlock()
+	if !ok {
+		return Transfer{}, ErrNotFound
+	}
+	return j.snapshot(), nil
+}
+
+// Cancel stops a transfer. Cancelling a finished transfer has no effect.
+func (m *Manager) Cancel(id string) (Transfer, error) {
+	m.mu.Lock()
+	j, ok := m.jobs[id]
+	m.mu.Unlock()
+	if !ok {
+		return Transfer{}, ErrNotFound
+	}
+	j.cancel()
+	return j.snapshot(), nil
+}
+
+func (m *Manager) options(password string) client.Options {
+	return client.Options{
+		Password:         password,
+		Timeout:          m.Timeout,
+		BootstrapTimeout: m.BootstrapTimeout,
+		Retries:          m.Retries,
+		Monitor:          m.Monitor,
+	}
+}
+
+func (m *Manager) add(direction, path, code string, cancel context.CancelFunc) *job {
+	id := make([]byte, 6)
+	rand.Read(id)
+
+	j := &job{
+		state: Transfer{
+			ID:        hex.EncodeToString(id),
+			Direction: direction,
+			Path:      path,
+			Code:      code,
+			Status:    StatusPreparing,
+			Started:   time.Now(),
+		},
+		cancel: cancel,
+	}
+
+	m.mu.Lock()
+	m.jobs[j.state.ID] = j
+	m.order = append(m.order, j.state.ID)
+	m.mu.Unlock()
+	return j
+}
+
+// track applies a transfer's events to its state until the transfer ends
+func (j *job) track(events <-chan client.Event) {
+	defer j.cancel()
+	for ev := range events {
+		j.mu.Lock()
+		t := &j.state
+		switch ev.Type {
+		case client.EventHashing:
+			t.CurrentFile = ev.File
+		case client.EventManifest:
+			t.Name = ev.Manifest.FolderName
+			t.Files = len(ev.Manifest.Files)
+			t.TotalBytes = ev.Manifest.TotalSize
+		case client.EventWaiting:
+			t.Status = StatusWaiting
+		case client.EventConnected:
+			t.Status = StatusConnecting
+		case client.EventProgress:
+			t.Status = StatusTransferring
+			t.CurrentFile = ev.File
+			t.DoneBytes = ev.Done
+		case client.EventReconnecting:
+			t.Status = StatusConnecting
+			if t.Direction == "send" {
+				t.Status = StatusWaiting
+			}
+		case client.EventComplete:
+			t.Status = StatusComplete
+			t.DoneBytes = t.TotalBytes
+			path := t.Path
+			if ev.Path != "" {
+				path = ev.Path
+			}
+			status := history.StatusComplete
+			if t.Direction == "send" {
+				status = history.SendStatus(ev.Confirmed)
+			}
+			addHistory(path, t.TotalBytes, t.Direction, status)
+		case client.EventError:
+			t.Error = ev.Err.Error()
+			t.Status = StatusFailed
+			if transfer.CategoryOf(ev.Err) == transfer.CategoryCancelled {
+				t.Status = StatusCancelled
+				t.Error = ""
+			}
+		}
+		if ev.Type == client.EventComplete || ev.Type == client.EventError {
+			now := time.Now()
+			t.Finished = &now
+			t.CurrentFile = ""
+		}
+		j.mu.Unlock()
+	}
+}
+
+func addHistory(path string, size int64, direction, status string) {
+	s := settings.LoadSettings()
+	if !s.HistoryEnabled {
+		return
+	}
+	if err := history.Add(history.NewRecord(path, size, direction, status), s.HistoryRetentionDays); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+func (j *job) snapshot() Transfer {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	t := j.state
+	if t.Finished != nil {
+		finished := *t.Finished
+		t.Finished = &finished
+	}
+	return t
+}
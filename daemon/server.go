@@ -0,0 +1,142 @@
+package daemon
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/ebob10000/2c1f/paths"
+)
+
+// DefaultListenAddr keeps the API on the loopback interface
+const DefaultListenAddr = "127.0.0.1:7341"
+
+// Server exposes a Manager over a token protected JSON API:
+//
+//	POST /v1/send                   start sending, body SendRequest
+//	POST /v1/receive                start receiving, body ReceiveRequest
+//	GET  /v1/transfers              list transfers
+//	GET  /v1/transfers/{id}         transfer progress
+//	POST /v1/transfers/{id}/cancel  cancel a transfer
+//
+// Every request needs an "Authorization: Bearer <token>" header.
+type Server struct {
+	manager *Manager
+	token   string
+}
+
+func NewServer(manager *Manager, token string) *Server {
+	return &Server{manager: manager, token: token}
+}
+
+// Handler returns the HTTP handler serving the API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/send", s.handleSend)
+	mux.HandleFunc("POST /v1/receive", s.handleReceive)
+	mux.HandleFunc("GET /v1/transfers", s.handleList)
+	mux.HandleFunc("GET /v1/transfers/{id}", s.handleGet)
+	mux.HandleFunc("POST /v1/transfers/{id}/cancel", s.handleCancel)
+	return s.authenticate(mux)
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("invalid or missing token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleSend(w http.ResponseWriter, r *http.Request) {
+	var req SendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	t, err := s.manager.Send(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, t)
+}
+
+func (s *Server) handleReceive(w http.ResponseWriter, r *http.Request) {
+	var req ReceiveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	t, err := s.manager.Receive(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, t)
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.manager.List())
+}
+
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
+	t, err := s.manager.Get(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+func (s *Server) handleCancel(w http.ResponseWriter, r *http.Request) {
+	t, err := s.manager.Cancel(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// GetTokenPath returns the file holding the API token
+func GetTokenPath() string {
+	return paths.Config("daemon-token", ".2c1f-daemon-token")
+}
+
+// LoadOrCreateToken reads the API token from path, creating a random one
+// readable only by the current user on first use
+func LoadOrCreateToken(path string) (string, error) {
+	if data, err := os.ReadFile(path); err == nil {
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, nil
+		}
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return token, nil
+}
@@ -0,0 +1,87 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	srv := httptest.NewServer(NewServer(NewManager(ctx), "secret").Handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func request(t *testing.T, srv *httptest.Server, method, path, token, body string) *http.Response {
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestServerRequiresToken(t *testing.T) {
+	srv := newTestServer(t)
+	for _, token := range []string{"", "wrong"} {
+		if resp := request(t, srv, "GET", "/v1/transfers", token, ""); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("token %q: status %d, want 401", token, resp.StatusCode)
+		}
+	}
+	if resp := request(t, srv, "GET", "/v1/transfers", "secret", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("valid token: status %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestServerValidatesRequests(t *testing.T) {
+	srv := newTestServer(t)
+
+	tests := []struct {
+		method, path, body string
+		status             int
+	}{
+		{"POST", "/v1/send", `{"path": "/does/not/exist"}`, http.StatusBadRequest},
+		{"POST", "/v1/send", `not json`, http.StatusBadRequest},
+		{"POST", "/v1/receive", `{"code": "nope"}`, http.StatusBadRequest},
+		{"GET", "/v1/transfers/unknown", ``, http.StatusNotFound},
+		{"POST", "/v1/transfers/unknown/cancel", ``, http.StatusNotFound},
+		{"DELETE", "/v1/transfers", ``, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		resp := request(t, srv, tt.method, tt.path, "secret", tt.body)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.path, resp.StatusCode, tt.status)
+		}
+	}
+
+	var transfers []Transfer
+	resp := request(t, srv, "GET", "/v1/transfers", "secret", "")
+	if err := json.NewDecoder(resp.Body).Decode(&transfers); err != nil || len(transfers) != 0 {
+		t.Errorf("transfers = %v, %v, want none after rejected requests", transfers, err)
+	}
+}
+
+func TestLoadOrCreateToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	first, err := LoadOrCreateToken(path)
+	if err != nil || len(first) != 64 {
+		t.Fatalf("LoadOrCreateToken() = %q, %v", first, err)
+	}
+	second, err := LoadOrCreateToken(path)
+	if err != nil || second != first {
+		t.Errorf("token changed between loads: %q != %q", second, first)
+	}
+}
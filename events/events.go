@@ -0,0 +1,132 @@
+// Package events decouples transfer notifications from the frontend that
+// shows them. The GUI forwards events to Wails, the CLI prints them and tests
+// collect them on a channel. Progress turns the callbacks of a transfer into
+// events for any of them.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Emitter publishes a named event with optional data
+type Emitter interface {
+	Emit(name string, data ...interface{})
+}
+
+// Nop discards every event
+type Nop struct{}
+
+func (Nop) Emit(string, ...interface{}) {}
+
+// Event is a single emitted event
+type Event struct {
+	Name string
+	Data []interface{}
+}
+
+// Channel delivers events to C. Emit blocks while C is full, so the consumer
+// must keep reading for as long as events are emitted.
+type Channel struct {
+	C chan Event
+}
+
+// NewChannel creates a channel emitter buffering up to size events
+func NewChannel(size int) *Channel {
+	return &Channel{C: make(chan Event, size)}
+}
+
+func (c *Channel) Emit(name string, data ...interface{}) {
+	c.C <- Event{Name: name, Data: data}
+}
+
+// Names of the events of Progress
+const (
+	StartFile    = "transfer_start_file"
+	FileProgress = "transfer_file_progress"
+	FileComplete = "transfer_file_complete"
+)
+
+// FileStarted is the data of StartFile events
+type FileStarted struct {
+	Filename string `json:"filename"`
+	Index    int    `json:"index"` // From 1
+	Total    int    `json:"total"`
+}
+
+// FileProgressed is the data of FileProgress events, Sent includes the
+// offset a resumed file started at
+type FileProgressed struct {
+	Filename string `json:"filename"`
+	Sent     int64  `json:"sent"`
+	Total    int64  `json:"total"`
+}
+
+// FileCompleted is the data of FileComplete events
+type FileCompleted struct {
+	Filename string `json:"filename"`
+	Verified bool   `json:"verified"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Progress emits the OnStartFile, OnProgress and OnFileComplete callbacks of
+// transfer.Sender and transfer.Receiver as events
+type Progress struct {
+	Emitter Emitter
+}
+
+func (p *Progress) StartFile(filename string, index, total int) {
+	p.Emitter.Emit(StartFile, FileStarted{Filename: filename, Index: index, Total: total})
+}
+
+func (p *Progress) Update(filename string, sent, total int64) {
+	p.Emitter.Emit(FileProgress, FileProgressed{Filename: filename, Sent: sent, Total: total})
+}
+
+func (p *Progress) FileComplete(filename string, verified bool, err error) {
+	data := FileCompleted{Filename: filename, Verified: verified}
+	if err != nil {
+		data.Error = err.Error()
+	}
+	p.Emitter.Emit(FileComplete, data)
+}
+
+// Writer prints one line per event, for example "log: Connecting...".
+// Strings are printed as is, other data is encoded as JSON.
+type Writer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriter creates an emitter that prints to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+func (w *Writer) Emit(name string, data ...interface{}) {
+	line := name
+	for i, d := range data {
+		sep := " "
+		if i == 0 {
+			sep = ": "
+		}
+		line += sep + format(d)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	fmt.Fprintln(w.w, line)
+}
+
+func format(d interface{}) string {
+	if s, ok := d.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Sprint(d)
+	}
+	return string(data)
+}
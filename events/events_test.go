@@ -0,0 +1,65 @@
+package events
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestChannel(t *testing.T) {
+	c := NewChannel(2)
+	var e Emitter = c
+	e.Emit("log", "Connecting...")
+	e.Emit("sender_ready")
+
+	ev := <-c.C
+	if ev.Name != "log" || len(ev.Data) != 1 || ev.Data[0] != "Connecting..." {
+		t.Errorf("unexpected event %+v", ev)
+	}
+	ev = <-c.C
+	if ev.Name != "sender_ready" || len(ev.Data) != 0 {
+		t.Errorf("unexpected event %+v", ev)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Emit("log", "Connecting...")
+	w.Emit("transfer_global_progress", map[string]interface{}{"sent": 1, "total": 2})
+	w.Emit("sender_ready")
+	w.Emit("pair", "a", 3)
+
+	want := "log: Connecting...\n" +
+		"transfer_global_progress: {\"sent\":1,\"total\":2}\n" +
+		"sender_ready\n" +
+		"pair: a 3\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestNop(t *testing.T) {
+	var e Emitter = Nop{}
+	e.Emit("log", "ignored")
+}
+
+func TestProgress(t *testing.T) {
+	c := NewChannel(3)
+	p := Progress{Emitter: c}
+	p.StartFile("a.txt", 1, 2)
+	p.Update("a.txt", 50, 100)
+	p.FileComplete("a.txt", false, errors.New("disk full"))
+
+	want := []Event{
+		{Name: StartFile, Data: []interface{}{FileStarted{Filename: "a.txt", Index: 1, Total: 2}}},
+		{Name: FileProgress, Data: []interface{}{FileProgressed{Filename: "a.txt", Sent: 50, Total: 100}}},
+		{Name: FileComplete, Data: []interface{}{FileCompleted{Filename: "a.txt", Error: "disk full"}}},
+	}
+	for _, w := range want {
+		if ev := <-c.C; !reflect.DeepEqual(ev, w) {
+			t.Errorf("got %+v, want %+v", ev, w)
+		}
+	}
+}
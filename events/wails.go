@@ -0,0 +1,21 @@
+package events
+
+import (
+	"context"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Wails forwards events to the frontend of a Wails application
+type Wails struct {
+	ctx context.Context
+}
+
+// NewWails creates an emitter for the application context passed to OnStartup
+func NewWails(ctx context.Context) *Wails {
+	return &Wails{ctx: ctx}
+}
+
+func (w *Wails) Emit(name string, data ...interface{}) {
+	runtime.EventsEmit(w.ctx, name, data...)
+}
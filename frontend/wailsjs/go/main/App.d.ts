@@ -1,34 +1,85 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
+import {contacts} from '../models';
+import {p2p} from '../models';
+import {i18n} from '../models';
 import {settings} from '../models';
-import {main} from '../models';
+import {history} from '../models';
+
+export function AddContact(arg1:string,arg2:string):Promise<contacts.Contact>;
 
 export function AddTransferRecord(arg1:string,arg2:number,arg3:string,arg4:string):Promise<void>;
 
+export function AnswerTransferConfirmation(arg1:boolean,arg2:Array<string>,arg3:string):Promise<void>;
+
 export function CancelTransfer():Promise<void>;
 
+export function CheckNetwork():Promise<p2p.Stats>;
+
+export function ChoosePeer(arg1:string):Promise<void>;
+
 export function ClearHistory():Promise<void>;
 
+export function ConfirmPeer(arg1:boolean):Promise<void>;
+
 export function CopyToClipboard(arg1:string):Promise<void>;
 
+export function DismissRollback():Promise<void>;
+
 export function DownloadAndInstallUpdate(arg1:string):Promise<void>;
 
+export function GetLanguages():Promise<Array<i18n.Language>>;
+
+export function GetMessages():Promise<Record<string, string>>;
+
+export function GetPeerID():Promise<string>;
+
 export function GetSettings():Promise<settings.AppSettings>;
 
-export function GetTransferHistory():Promise<Array<main.TransferRecord>>;
+export function GetThumbnail(arg1:string,arg2:number):Promise<string>;
+
+export function GetTransferHistory():Promise<Array<history.Record>>;
+
+export function GetTransferStats():Promise<history.Stats>;
 
 export function GetVersion():Promise<string>;
 
 export function IsPaused():Promise<boolean>;
 
+export function ListContacts():Promise<Array<contacts.Contact>>;
+
+export function ListLocalSenders():Promise<Array<p2p.LocalSender>>;
+
+export function MinimizeToTray():Promise<void>;
+
+export function PreflightNetwork():Promise<void>;
+
+export function ReceiveFromLocalSender(arg1:string,arg2:string,arg3:boolean,arg4:string):Promise<string>;
+
+export function RemoveContact(arg1:string):Promise<void>;
+
+export function RestoreFromTray():Promise<void>;
+
+export function ResumeFromHistory(arg1:string):Promise<void>;
+
+export function RollbackUpdate():Promise<void>;
+
 export function SaveSettings(arg1:settings.AppSettings):Promise<void>;
 
+export function ScheduleSend(arg1:string,arg2:string,arg3:boolean,arg4:boolean,arg5:boolean,arg6:string):Promise<string>;
+
 export function SelectFile():Promise<string>;
 
 export function SelectFolder():Promise<string>;
 
+export function SelectProfile(arg1:string):Promise<settings.AppSettings>;
+
 export function SelectSaveDirectory():Promise<string>;
 
-export function StartReceiver(arg1:string,arg2:string,arg3:boolean):Promise<void>;
+export function SendToContact(arg1:string,arg2:string,arg3:boolean,arg4:boolean,arg5:boolean):Promise<void>;
+
+export function SetBackgroundMode(arg1:boolean):Promise<void>;
+
+export function StartReceiver(arg1:string,arg2:string,arg3:boolean,arg4:string):Promise<void>;
 
-export function StartSender(arg1:string,arg2:boolean,arg3:boolean,arg4:boolean):Promise<string>;
+export function StartSender(arg1:string,arg2:boolean,arg3:boolean,arg4:boolean,arg5:string):Promise<string>;
@@ -2,34 +2,78 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function AddContact(arg1, arg2) {
+  return window['go']['main']['App']['AddContact'](arg1, arg2);
+}
+
 export function AddTransferRecord(arg1, arg2, arg3, arg4) {
   return window['go']['main']['App']['AddTransferRecord'](arg1, arg2, arg3, arg4);
 }
 
+export function AnswerTransferConfirmation(arg1, arg2, arg3) {
+  return window['go']['main']['App']['AnswerTransferConfirmation'](arg1, arg2, arg3);
+}
+
 export function CancelTransfer() {
   return window['go']['main']['App']['CancelTransfer']();
 }
 
+export function CheckNetwork() {
+  return window['go']['main']['App']['CheckNetwork']();
+}
+
+export function ChoosePeer(arg1) {
+  return window['go']['main']['App']['ChoosePeer'](arg1);
+}
+
 export function ClearHistory() {
   return window['go']['main']['App']['ClearHistory']();
 }
 
+export function ConfirmPeer(arg1) {
+  return window['go']['main']['App']['ConfirmPeer'](arg1);
+}
+
 export function CopyToClipboard(arg1) {
   return window['go']['main']['App']['CopyToClipboard'](arg1);
 }
 
+export function DismissRollback() {
+  return window['go']['main']['App']['DismissRollback']();
+}
+
 export function DownloadAndInstallUpdate(arg1) {
   return window['go']['main']['App']['DownloadAndInstallUpdate'](arg1);
 }
 
+export function GetLanguages() {
+  return window['go']['main']['App']['GetLanguages']();
+}
+
+export function GetMessages() {
+  return window['go']['main']['App']['GetMessages']();
+}
+
+export function GetPeerID() {
+  return window['go']['main']['App']['GetPeerID']();
+}
+
 export function GetSettings() {
   return window['go']['main']['App']['GetSettings']();
 }
 
+export function GetThumbnail(arg1, arg2) {
+  return window['go']['main']['App']['GetThumbnail'](arg1, arg2);
+}
+
 export function GetTransferHistory() {
   return window['go']['main']['App']['GetTransferHistory']();
 }
 
+export function GetTransferStats() {
+  return window['go']['main']['App']['GetTransferStats']();
+}
+
 export function GetVersion() {
   return window['go']['main']['App']['GetVersion']();
 }
@@ -38,10 +82,50 @@ export function IsPaused() {
   return window['go']['main']['App']['IsPaused']();
 }
 
+export function ListContacts() {
+  return window['go']['main']['App']['ListContacts']();
+}
+
+export function ListLocalSenders() {
+  return window['go']['main']['App']['ListLocalSenders']();
+}
+
+export function MinimizeToTray() {
+  return window['go']['main']['App']['MinimizeToTray']();
+}
+
+export function PreflightNetwork() {
+  return window['go']['main']['App']['PreflightNetwork']();
+}
+
+export function ReceiveFromLocalSender(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['ReceiveFromLocalSender'](arg1, arg2, arg3, arg4);
+}
+
+export function RemoveContact(arg1) {
+  return window['go']['main']['App']['RemoveContact'](arg1);
+}
+
+export function RestoreFromTray() {
+  return window['go']['main']['App']['RestoreFromTray']();
+}
+
+export function ResumeFromHistory(arg1) {
+  return window['go']['main']['App']['ResumeFromHistory'](arg1);
+}
+
+export function RollbackUpdate() {
+  return window['go']['main']['App']['RollbackUpdate']();
+}
+
 export function SaveSettings(arg1) {
   return window['go']['main']['App']['SaveSettings'](arg1);
 }
 
+export function ScheduleSend(arg1, arg2, arg3, arg4, arg5, arg6) {
+  return window['go']['main']['App']['ScheduleSend'](arg1, arg2, arg3, arg4, arg5, arg6);
+}
+
 export function SelectFile() {
   return window['go']['main']['App']['SelectFile']();
 }
@@ -50,14 +134,26 @@ export function SelectFolder() {
   return window['go']['main']['App']['SelectFolder']();
 }
 
+export function SelectProfile(arg1) {
+  return window['go']['main']['App']['SelectProfile'](arg1);
+}
+
 export function SelectSaveDirectory() {
   return window['go']['main']['App']['SelectSaveDirectory']();
 }
 
-export function StartReceiver(arg1, arg2, arg3) {
-  return window['go']['main']['App']['StartReceiver'](arg1, arg2, arg3);
+export function SendToContact(arg1, arg2, arg3, arg4, arg5) {
+  return window['go']['main']['App']['SendToContact'](arg1, arg2, arg3, arg4, arg5);
+}
+
+export function SetBackgroundMode(arg1) {
+  return window['go']['main']['App']['SetBackgroundMode'](arg1);
+}
+
+export function StartReceiver(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['StartReceiver'](arg1, arg2, arg3, arg4);
 }
 
-export function StartSender(arg1, arg2, arg3, arg4) {
-  return window['go']['main']['App']['StartSender'](arg1, arg2, arg3, arg4);
+export function StartSender(arg1, arg2, arg3, arg4, arg5) {
+  return window['go']['main']['App']['StartSender'](arg1, arg2, arg3, arg4, arg5);
 }
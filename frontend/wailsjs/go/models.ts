@@ -1,6 +1,98 @@
-export namespace main {
+export namespace contacts {
 	
-	export class TransferRecord {
+	export class Contact {
+	    name: string;
+	    peerId: string;
+	    // Go type: time
+	    added: any;
+	
+	    static createFrom(source: any = {}) {
+	        return new Contact(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.peerId = source["peerId"];
+	        this.added = this.convertValues(source["added"], null);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+}
+
+export namespace history {
+	
+	export class PeerStats {
+	    peer: string;
+	    transfers: number;
+	    bytes: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new PeerStats(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.peer = source["peer"];
+	        this.transfers = source["transfers"];
+	        this.bytes = source["bytes"];
+	    }
+	}
+	export class Period {
+	    // Go type: time
+	    start: any;
+	    sent: number;
+	    received: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new Period(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.start = this.convertValues(source["start"], null);
+	        this.sent = source["sent"];
+	        this.received = source["received"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class Record {
+	    id?: string;
 	    // Go type: time
 	    timestamp: any;
 	    path: string;
@@ -8,19 +100,172 @@ export namespace main {
 	    size: number;
 	    direction: string;
 	    status: string;
+	    receipt?: transfer.Receipt;
+	    root?: string;
+	    duration?: number;
+	    transferred?: number;
+	    code?: string;
+	    peer?: string;
+	    dest?: string;
 	
 	    static createFrom(source: any = {}) {
-	        return new TransferRecord(source);
+	        return new Record(source);
 	    }
 	
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
 	        this.timestamp = this.convertValues(source["timestamp"], null);
 	        this.path = source["path"];
 	        this.fullPath = source["fullPath"];
 	        this.size = source["size"];
 	        this.direction = source["direction"];
 	        this.status = source["status"];
+	        this.receipt = this.convertValues(source["receipt"], transfer.Receipt);
+	        this.root = source["root"];
+	        this.duration = source["duration"];
+	        this.transferred = source["transferred"];
+	        this.code = source["code"];
+	        this.peer = source["peer"];
+	        this.dest = source["dest"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class Stats {
+	    transfers: number;
+	    bytesSent: number;
+	    bytesReceived: number;
+	    averageSpeed: number;
+	    days: Period[];
+	    weeks: Period[];
+	    peers: PeerStats[];
+	
+	    static createFrom(source: any = {}) {
+	        return new Stats(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.transfers = source["transfers"];
+	        this.bytesSent = source["bytesSent"];
+	        this.bytesReceived = source["bytesReceived"];
+	        this.averageSpeed = source["averageSpeed"];
+	        this.days = this.convertValues(source["days"], Period);
+	        this.weeks = this.convertValues(source["weeks"], Period);
+	        this.peers = this.convertValues(source["peers"], PeerStats);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+}
+
+export namespace i18n {
+	
+	export class Language {
+	    code: string;
+	    name: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new Language(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.code = source["code"];
+	        this.name = source["name"];
+	    }
+	}
+
+}
+
+export namespace p2p {
+	
+	export class LocalSender {
+	    id: string;
+	    name: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new LocalSender(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	    }
+	}
+	export class PortMapping {
+	    protocol: string;
+	    internalPort: number;
+	    externalAddr: string;
+	    lease: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new PortMapping(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.protocol = source["protocol"];
+	        this.internalPort = source["internalPort"];
+	        this.externalAddr = source["externalAddr"];
+	        this.lease = source["lease"];
+	    }
+	}
+	export class Stats {
+	    addrs: string[];
+	    peers: number;
+	    bootstrap: string;
+	    portMapping: boolean;
+	    gateway: boolean;
+	    mappings: PortMapping[];
+	
+	    static createFrom(source: any = {}) {
+	        return new Stats(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.addrs = source["addrs"];
+	        this.peers = source["peers"];
+	        this.bootstrap = source["bootstrap"];
+	        this.portMapping = source["portMapping"];
+	        this.gateway = source["gateway"];
+	        this.mappings = this.convertValues(source["mappings"], PortMapping);
 	    }
 	
 		convertValues(a: any, classs: any, asMap: boolean = false): any {
@@ -49,7 +294,34 @@ export namespace settings {
 	export class AppSettings {
 	    autoHash: boolean;
 	    compress: boolean;
+	    autoCompress: boolean;
+	    compressLevel: number;
 	    cacheManifest: boolean;
+	    timeout: number;
+	    retries: number;
+	    findTimeout: number;
+	    bootstrapTimeout: number;
+	    updateChannel: string;
+	    updateProxy: string;
+	    updateTimeout: number;
+	    strictVerify: boolean;
+	    backgroundMode: boolean;
+	    backgroundRateLimit: number;
+	    lanVisible: boolean;
+	    deviceName: string;
+	    contactDir: string;
+	    listenAddrs: string;
+	    port: number;
+	    proxy: string;
+	    noUpnp: boolean;
+	    allowPeers: string;
+	    denyPeers: string;
+	    onComplete: string;
+	    historyEnabled: boolean;
+	    historyRetentionDays: number;
+	    language: string;
+	    maxCacheMB: number;
+	    profiles?: Record<string, any>;
 	
 	    static createFrom(source: any = {}) {
 	        return new AppSettings(source);
@@ -59,9 +331,80 @@ export namespace settings {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.autoHash = source["autoHash"];
 	        this.compress = source["compress"];
+	        this.autoCompress = source["autoCompress"];
+	        this.compressLevel = source["compressLevel"];
 	        this.cacheManifest = source["cacheManifest"];
+	        this.timeout = source["timeout"];
+	        this.retries = source["retries"];
+	        this.findTimeout = source["findTimeout"];
+	        this.bootstrapTimeout = source["bootstrapTimeout"];
+	        this.updateChannel = source["updateChannel"];
+	        this.updateProxy = source["updateProxy"];
+	        this.updateTimeout = source["updateTimeout"];
+	        this.strictVerify = source["strictVerify"];
+	        this.backgroundMode = source["backgroundMode"];
+	        this.backgroundRateLimit = source["backgroundRateLimit"];
+	        this.lanVisible = source["lanVisible"];
+	        this.deviceName = source["deviceName"];
+	        this.contactDir = source["contactDir"];
+	        this.listenAddrs = source["listenAddrs"];
+	        this.port = source["port"];
+	        this.proxy = source["proxy"];
+	        this.noUpnp = source["noUpnp"];
+	        this.allowPeers = source["allowPeers"];
+	        this.denyPeers = source["denyPeers"];
+	        this.onComplete = source["onComplete"];
+	        this.historyEnabled = source["historyEnabled"];
+	        this.historyRetentionDays = source["historyRetentionDays"];
+	        this.language = source["language"];
+	        this.maxCacheMB = source["maxCacheMB"];
+	        this.profiles = source["profiles"];
 	    }
 	}
 
 }
 
+export namespace transfer {
+	
+	export class Receipt {
+	    manifestHash: string;
+	    root?: string;
+	    peerId: string;
+	    // Go type: time
+	    timestamp: any;
+	    signature: number[];
+	
+	    static createFrom(source: any = {}) {
+	        return new Receipt(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.manifestHash = source["manifestHash"];
+	        this.root = source["root"];
+	        this.peerId = source["peerId"];
+	        this.timestamp = this.convertValues(source["timestamp"], null);
+	        this.signature = source["signature"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+}
+
@@ -0,0 +1,189 @@
+package history
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ebob10000/2c1f/paths"
+	"github.com/ebob10000/2c1f/transfer"
+)
+
+// MaxRecords is the number of transfers kept in the history file
+const MaxRecords = 50
+
+// Statuses of recorded transfers
+const (
+	StatusComplete    = "complete"
+	StatusUnconfirmed = "unconfirmed" // Sent, but the receiver did not acknowledge it
+	StatusPartial     = "partial"     // Received without the files the user left out
+	StatusFailed      = "failed"
+	StatusCancelled   = "cancelled"
+)
+
+// SendStatus returns the status of a finished send, depending on whether the
+// receiver confirmed it
+func SendStatus(confirmed bool) string {
+	if confirmed {
+		return StatusComplete
+	}
+	return StatusUnconfirmed
+}
+
+// FailureStatus returns the status of a transfer that ended with err
+func FailureStatus(err error) string {
+	if transfer.CategoryOf(err) == transfer.CategoryCancelled {
+		return StatusCancelled
+	}
+	return StatusFailed
+}
+
+// Record stores info about a finished or abandoned transfer
+type Record struct {
+	ID        string            `json:"id,omitempty"` // Empty for records written by older versions
+	Timestamp time.Time         `json:"timestamp"`
+	Path      string            `json:"path"`
+	FullPath  string            `json:"fullPath"`
+	Size      int64             `json:"size"`
+	Direction string            `json:"direction"`
+	Status    string            `json:"status"`
+	Receipt   *transfer.Receipt `json:"receipt,omitempty"`  // Signed proof of delivery for sends
+	Root      string            `json:"root,omitempty"`     // Merkle root of the files, identifies what was transferred
+	Duration  time.Duration     `json:"duration,omitempty"` // Time from connecting to the end of the transfer, unknown if zero
+	// Compression tells how well compression did, nil if it was off
+	Compression *transfer.CompressionStats `json:"compression,omitempty"`
+
+	// Unfinished transfers keep what is needed to resume them
+	Transferred int64  `json:"transferred,omitempty"` // Bytes done when the transfer ended
+	Code        string `json:"code,omitempty"`        // Connection code
+	Peer        string `json:"peer,omitempty"`        // Peer ID of the other side, empty if none connected or unknown
+	Dest        string `json:"dest,omitempty"`        // Output folder of a receive
+}
+
+// NewRecord creates a record for a transfer that finished now
+func NewRecord(path string, size int64, direction, status string) Record {
+	return Record{
+		ID:        newID(),
+		Timestamp: time.Now(),
+		Path:      filepath.Base(path),
+		FullPath:  path,
+		Size:      size,
+		Direction: direction,
+		Status:    status,
+	}
+}
+
+// SetCompression records stats of a compressed transfer, nothing if it was
+// not compressed
+func (r *Record) SetCompression(stats transfer.CompressionStats) {
+	if stats.Wire > 0 {
+		r.Compression = &stats
+	}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Resumable reports whether the record is a receive that did not finish and
+// can be started again with its code
+func (r Record) Resumable() bool {
+	return r.Direction == "receive" && r.Code != "" && (r.Status == StatusFailed || r.Status == StatusCancelled)
+}
+
+// Find returns the record with the given ID
+func Find(records []Record, id string) (Record, bool) {
+	for _, r := range records {
+		if r.ID != "" && r.ID == id {
+			return r, true
+		}
+	}
+	return Record{}, false
+}
+
+// LastResumable returns the newest record that can be resumed
+func LastResumable(records []Record) (Record, bool) {
+	for _, r := range records {
+		if r.Resumable() {
+			return r, true
+		}
+	}
+	return Record{}, false
+}
+
+// GetHistoryPath returns the path to the history file
+func GetHistoryPath() string {
+	return paths.Data("history.json", ".2c1f-history.json")
+}
+
+// Load reads the history file, newest first. A missing or corrupted file yields an empty history.
+func Load() []Record {
+	return loadFrom(GetHistoryPath())
+}
+
+// Save writes the history file
+func Save(records []Record) error {
+	return saveTo(GetHistoryPath(), records)
+}
+
+// Add prepends a record to the history file, keeping at most MaxRecords
+// entries of the last retentionDays days, all if zero
+func Add(record Record, retentionDays int) error {
+	return Save(Prune(Prepend(Load(), record), retentionDays, time.Now()))
+}
+
+// Prepend returns records with record added at the front, trimmed to MaxRecords
+func Prepend(records []Record, record Record) []Record {
+	records = append([]Record{record}, records...)
+	if len(records) > MaxRecords {
+		records = records[:MaxRecords]
+	}
+	return records
+}
+
+// Prune returns the records of the last days days before now, all if days
+// is zero
+func Prune(records []Record, days int, now time.Time) []Record {
+	if days <= 0 {
+		return records
+	}
+	cutoff := now.AddDate(0, 0, -days)
+	kept := make([]Record, 0, len(records))
+	for _, r := range records {
+		if r.Timestamp.After(cutoff) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+func loadFrom(path string) []Record {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		// File doesn't exist or can't be read - start with empty history
+		return []Record{}
+	}
+	var records []Record
+	if err := json.Unmarshal(data, &records); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to parse history file, starting fresh: %v\n", err)
+		return []Record{}
+	}
+	return records
+}
+
+func saveTo(path string, records []Record) error {
+	data, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save history: %w", err)
+	}
+	return nil
+}
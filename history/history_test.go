@@ -0,0 +1,118 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ebob10000/2c1f/transfer"
+	"github.com/libp2p/go-libp2p/core/crypto"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+
+	key, _, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	receipt, err := transfer.SignReceipt(key, "abc123", "")
+	if err != nil {
+		t.Fatalf("Failed to sign receipt: %v", err)
+	}
+
+	record := NewRecord("/tmp/photos", 1024, "send", "complete")
+	record.Receipt = receipt
+	if err := saveTo(path, []Record{record}); err != nil {
+		t.Fatalf("saveTo failed: %v", err)
+	}
+
+	loaded := loadFrom(path)
+	if len(loaded) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(loaded))
+	}
+	if loaded[0].Path != "photos" || loaded[0].FullPath != "/tmp/photos" {
+		t.Errorf("Unexpected paths: %q, %q", loaded[0].Path, loaded[0].FullPath)
+	}
+	if loaded[0].Receipt == nil {
+		t.Fatal("Expected receipt to be preserved")
+	}
+	if err := loaded[0].Receipt.Verify("abc123"); err != nil {
+		t.Errorf("Loaded receipt failed verification: %v", err)
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	records := loadFrom(filepath.Join(t.TempDir(), "missing.json"))
+	if len(records) != 0 {
+		t.Errorf("Expected empty history, got %d records", len(records))
+	}
+}
+
+func TestPrependTrims(t *testing.T) {
+	var records []Record
+	for i := 0; i < MaxRecords+10; i++ {
+		records = Prepend(records, NewRecord("file", int64(i), "send", "complete"))
+	}
+	if len(records) != MaxRecords {
+		t.Fatalf("Expected %d records, got %d", MaxRecords, len(records))
+	}
+	if records[0].Size != MaxRecords+9 {
+		t.Errorf("Expected newest record first, got size %d", records[0].Size)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	records := []Record{
+		{ID: "today", Timestamp: now.Add(-time.Hour)},
+		{ID: "last week", Timestamp: now.AddDate(0, 0, -6)},
+		{ID: "last month", Timestamp: now.AddDate(0, -1, 0)},
+	}
+	if kept := Prune(records, 0, now); len(kept) != 3 {
+		t.Errorf("Prune without retention kept %d records", len(kept))
+	}
+	kept := Prune(records, 7, now)
+	if len(kept) != 2 || kept[1].ID != "last week" {
+		t.Errorf("Prune(7 days) = %+v", kept)
+	}
+}
+
+func TestLastResumable(t *testing.T) {
+	failed := NewRecord("/tmp/in/photos", 100, "receive", FailureStatus(errors.New("connection reset")))
+	failed.Code = "apple-banana-cherry"
+	failed.Dest = "/tmp/in"
+	cancelled := NewRecord("/tmp/in/docs", 50, "receive", FailureStatus(context.Canceled))
+	cancelled.Code = "dog-egg-fig"
+	sendFailed := NewRecord("/tmp/out", 10, "send", StatusFailed)
+	sendFailed.Code = "x-y-z"
+	complete := NewRecord("/tmp/in/done", 10, "receive", StatusComplete)
+	complete.Code = "a-b-c"
+
+	if cancelled.Status != StatusCancelled || failed.Status != StatusFailed {
+		t.Fatalf("FailureStatus gave %q and %q", cancelled.Status, failed.Status)
+	}
+	if failed.ID == "" || failed.ID == cancelled.ID {
+		t.Errorf("Records need distinct IDs, got %q and %q", failed.ID, cancelled.ID)
+	}
+
+	// Newest first
+	records := []Record{complete, sendFailed, failed, cancelled}
+	last, ok := LastResumable(records)
+	if !ok || last.ID != failed.ID {
+		t.Errorf("LastResumable = %+v, %v, want the failed receive", last, ok)
+	}
+	if _, ok := LastResumable([]Record{complete, sendFailed}); ok {
+		t.Error("Completed receives and sends are not resumable")
+	}
+
+	found, ok := Find(records, cancelled.ID)
+	if !ok || found.Code != cancelled.Code {
+		t.Errorf("Find = %+v, %v", found, ok)
+	}
+	if _, ok := Find(records, ""); ok {
+		t.Error("Records from older versions have no ID and must not match")
+	}
+}
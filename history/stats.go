@@ -0,0 +1,134 @@
+package history
+
+import (
+	"sort"
+	"time"
+)
+
+// Stats sums up the transfers in a history for a statistics page
+type Stats struct {
+	Transfers     int         `json:"transfers"`
+	BytesSent     int64       `json:"bytesSent"`
+	BytesReceived int64       `json:"bytesReceived"`
+	AverageSpeed  int64       `json:"averageSpeed"` // Bytes per second of the transfers with a known duration, zero if none
+	Days          []Period    `json:"days"`         // Days with transfers, newest first
+	Weeks         []Period    `json:"weeks"`        // Weeks with transfers starting on Monday, newest first
+	Peers         []PeerStats `json:"peers"`        // Most used first
+}
+
+// Period holds the bytes transferred from Start on for a day or week
+type Period struct {
+	Start    time.Time `json:"start"`
+	Sent     int64     `json:"sent"`
+	Received int64     `json:"received"`
+}
+
+// PeerStats counts the transfers with one peer
+type PeerStats struct {
+	Peer      string `json:"peer"`
+	Transfers int    `json:"transfers"`
+	Bytes     int64  `json:"bytes"`
+}
+
+// Bytes returns how much of the transfer moved: all of it once complete,
+// what was done when it failed otherwise
+func (r Record) Bytes() int64 {
+	switch r.Status {
+	case StatusFailed, StatusCancelled:
+		return r.Transferred
+	}
+	return r.Size
+}
+
+// PeerID returns the peer the transfer was with, from the receipt if the
+// record does not name it, or an empty string
+func (r Record) PeerID() string {
+	if r.Peer == "" && r.Receipt != nil {
+		return r.Receipt.PeerID
+	}
+	return r.Peer
+}
+
+// Summarize returns the statistics of records, grouping days and weeks in
+// the time zone loc
+func Summarize(records []Record, loc *time.Location) Stats {
+	stats := Stats{Days: []Period{}, Weeks: []Period{}, Peers: []PeerStats{}}
+	days := make(map[time.Time]*Period)
+	weeks := make(map[time.Time]*Period)
+	peers := make(map[string]*PeerStats)
+	var timed int64
+	var took time.Duration
+
+	for _, r := range records {
+		n := r.Bytes()
+		stats.Transfers++
+		t := r.Timestamp.In(loc)
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		// Weeks start on Monday
+		week := day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+		for _, p := range []*Period{period(days, day), period(weeks, week)} {
+			if r.Direction == "send" {
+				p.Sent += n
+			} else {
+				p.Received += n
+			}
+		}
+		if r.Direction == "send" {
+			stats.BytesSent += n
+		} else {
+			stats.BytesReceived += n
+		}
+
+		if r.Duration > 0 {
+			timed += n
+			took += r.Duration
+		}
+		if id := r.PeerID(); id != "" {
+			p, ok := peers[id]
+			if !ok {
+				p = &PeerStats{Peer: id}
+				peers[id] = p
+			}
+			p.Transfers++
+			p.Bytes += n
+		}
+	}
+
+	if took > 0 {
+		stats.AverageSpeed = int64(float64(timed) / took.Seconds())
+	}
+	stats.Days = sortedPeriods(days)
+	stats.Weeks = sortedPeriods(weeks)
+	for _, p := range peers {
+		stats.Peers = append(stats.Peers, *p)
+	}
+	sort.Slice(stats.Peers, func(i, j int) bool {
+		a, b := stats.Peers[i], stats.Peers[j]
+		if a.Transfers != b.Transfers {
+			return a.Transfers > b.Transfers
+		}
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return a.Peer < b.Peer
+	})
+	return stats
+}
+
+func period(periods map[time.Time]*Period, start time.Time) *Period {
+	p, ok := periods[start]
+	if !ok {
+		p = &Period{Start: start}
+		periods[start] = p
+	}
+	return p
+}
+
+func sortedPeriods(periods map[time.Time]*Period) []Period {
+	sorted := make([]Period, 0, len(periods))
+	for _, p := range periods {
+		sorted = append(sorted, *p)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start.After(sorted[j].Start) })
+	return sorted
+}
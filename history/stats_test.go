@@ -0,0 +1,53 @@
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSummarize(t *testing.T) {
+	day := func(d int, hour int) time.Time { return time.Date(2026, 10, d, hour, 0, 0, 0, time.UTC) }
+	records := []Record{
+		// Thursday and Wednesday of one week, Sunday of the week before
+		{Timestamp: day(15, 9), Direction: "send", Status: StatusComplete, Size: 300, Peer: "a", Duration: time.Second},
+		{Timestamp: day(15, 8), Direction: "receive", Status: StatusComplete, Size: 100, Peer: "b", Duration: time.Second},
+		{Timestamp: day(14, 23), Direction: "send", Status: StatusFailed, Size: 1000, Transferred: 50, Peer: "a"},
+		{Timestamp: day(11, 12), Direction: "send", Status: StatusUnconfirmed, Size: 20},
+	}
+
+	stats := Summarize(records, time.UTC)
+	if stats.Transfers != 4 || stats.BytesSent != 370 || stats.BytesReceived != 100 {
+		t.Errorf("totals = %d transfers, %d sent, %d received", stats.Transfers, stats.BytesSent, stats.BytesReceived)
+	}
+	if stats.AverageSpeed != 200 {
+		t.Errorf("AverageSpeed = %d, want 200", stats.AverageSpeed)
+	}
+
+	wantDays := []Period{
+		{Start: day(15, 0), Sent: 300, Received: 100},
+		{Start: day(14, 0), Sent: 50},
+		{Start: day(11, 0), Sent: 20},
+	}
+	if len(stats.Days) != len(wantDays) {
+		t.Fatalf("Days = %+v", stats.Days)
+	}
+	for i, want := range wantDays {
+		if got := stats.Days[i]; !got.Start.Equal(want.Start) || got.Sent != want.Sent || got.Received != want.Received {
+			t.Errorf("Days[%d] = %+v, want %+v", i, got, want)
+		}
+	}
+
+	if len(stats.Weeks) != 2 || !stats.Weeks[0].Start.Equal(day(12, 0)) || stats.Weeks[0].Sent != 350 || !stats.Weeks[1].Start.Equal(day(5, 0)) {
+		t.Errorf("Weeks = %+v", stats.Weeks)
+	}
+	if len(stats.Peers) != 2 || stats.Peers[0] != (PeerStats{Peer: "a", Transfers: 2, Bytes: 350}) {
+		t.Errorf("Peers = %+v", stats.Peers)
+	}
+}
+
+func TestSummarizeEmpty(t *testing.T) {
+	stats := Summarize(nil, time.UTC)
+	if stats.Transfers != 0 || stats.AverageSpeed != 0 || stats.Days == nil || stats.Peers == nil {
+		t.Errorf("Summarize(nil) = %+v", stats)
+	}
+}
@@ -0,0 +1,117 @@
+// Package hooks runs a user command after a transfer completes or fails,
+// such as a notification script, a virus scan or an import.
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/ebob10000/2c1f/transfer"
+)
+
+// Statuses of finished transfers
+const (
+	StatusComplete  = "complete"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+	StatusRejected  = "rejected"
+)
+
+// Status returns the status of a transfer that ended with err
+func Status(err error) string {
+	switch {
+	case err == nil:
+		return StatusComplete
+	case transfer.CategoryOf(err) == transfer.CategoryCancelled:
+		return StatusCancelled
+	case transfer.CategoryOf(err) == transfer.CategoryRejected:
+		return StatusRejected
+	}
+	return StatusFailed
+}
+
+// Transfer describes a finished transfer to a hook
+type Transfer struct {
+	Direction string // "send" or "receive"
+	Path      string // Sent file or folder, or the folder the files were saved in
+	Size      int64
+	Status    string
+	Peer      string // Peer ID of the other side, empty if none connected
+}
+
+func (t Transfer) vars() map[string]string {
+	return map[string]string{
+		"direction": t.Direction,
+		"path":      t.Path,
+		"dest":      t.Path,
+		"size":      strconv.FormatInt(t.Size, 10),
+		"status":    t.Status,
+		"peer":      t.Peer,
+	}
+}
+
+// Expand replaces the placeholders {direction}, {path}, {dest} (the same as
+// {path}), {size}, {status} and {peer} in command with the quoted values.
+// The sender chooses the file names, so they are never left unquoted.
+func Expand(command string, t Transfer) string {
+	return expand(command, t.vars())
+}
+
+// expand replaces the placeholders of vars in command with the quoted values
+func expand(command string, vars map[string]string) string {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(command, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(command[start:], '}')
+		if end < 0 {
+			break
+		}
+		value, ok := vars[command[start+1:start+end]]
+		if !ok {
+			b.WriteString(command[:start+1])
+			command = command[start+1:]
+			continue
+		}
+		b.WriteString(command[:start])
+		b.WriteString(quote(value))
+		command = command[start+end+1:]
+	}
+	b.WriteString(command)
+	return b.String()
+}
+
+// quote makes s a single argument for the shell that runs hooks
+func quote(s string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Run runs command through the shell after expanding its placeholders. The
+// values are also in the environment as TWOC1F_DIRECTION, TWOC1F_PATH,
+// TWOC1F_SIZE, TWOC1F_STATUS and TWOC1F_PEER. The command's output goes to
+// the standard output and error of this process.
+func Run(ctx context.Context, command string, t Transfer) error {
+	cmd := shell(ctx, Expand(command, t))
+	cmd.Env = append(os.Environ(),
+		"TWOC1F_DIRECTION="+t.Direction,
+		"TWOC1F_PATH="+t.Path,
+		"TWOC1F_SIZE="+strconv.FormatInt(t.Size, 10),
+		"TWOC1F_STATUS="+t.Status,
+		"TWOC1F_PEER="+t.Peer,
+	)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("hook %q failed: %w", command, err)
+	}
+	return nil
+}
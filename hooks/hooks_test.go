@@ -0,0 +1,100 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/ebob10000/2c1f/transfer"
+)
+
+func TestStatus(t *testing.T) {
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{nil, StatusComplete},
+		{errors.New("boom"), StatusFailed},
+		{&transfer.Error{Category: transfer.CategoryCancelled, Err: errors.New("stop")}, StatusCancelled},
+		{&transfer.Error{Category: transfer.CategoryRejected, Err: errors.New("no")}, StatusRejected},
+	}
+	for _, c := range cases {
+		if got := Status(c.err); got != c.want {
+			t.Errorf("Status(%v) = %q, want %q", c.err, got, c.want)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("quoting differs on Windows")
+	}
+	tr := Transfer{Direction: "receive", Path: "/tmp/it's here", Size: 42, Status: StatusComplete, Peer: "12D3"}
+	got := Expand("notify {dest} {size} {status} {peer} {direction} {unknown} {", tr)
+	want := `notify '/tmp/it'\''s here' '42' 'complete' '12D3' 'receive' {unknown} {`
+	if got != want {
+		t.Errorf("Expand = %s, want %s", got, want)
+	}
+}
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+	out := filepath.Join(t.TempDir(), "out")
+	tr := Transfer{Direction: "send", Path: "a $(touch pwned) b", Size: 7, Status: StatusFailed}
+	err := Run(context.Background(), "printf '%s|%s|%s' {path} \"$TWOC1F_SIZE\" {status} > "+out, tr)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "a $(touch pwned) b|7|failed" {
+		t.Errorf("hook wrote %q", data)
+	}
+
+	err = Run(context.Background(), "exit 3", tr)
+	if err == nil || !strings.Contains(err.Error(), "exit 3") {
+		t.Errorf("expected failing hook error, got %v", err)
+	}
+}
+
+func TestRunWindows(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("uses cmd.exe")
+	}
+	dir := filepath.Join(t.TempDir(), "with space")
+	os.Mkdir(dir, 0755)
+	tr := Transfer{Direction: "receive", Path: dir, Status: StatusComplete}
+	if err := Run(context.Background(), `cd /d {path} && echo {status}> out.txt`, tr); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "out.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(data)); got != `"complete"` {
+		t.Errorf("hook wrote %q", got)
+	}
+}
+
+func TestScan(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+	path := filepath.Join(t.TempDir(), "it's here")
+	os.WriteFile(path, []byte("EICAR"), 0644)
+	if err := Scan(context.Background(), `test -f {file} && test "$TWOC1F_FILE" = {file}`, path); err != nil {
+		t.Errorf("Scan of a clean file: %v", err)
+	}
+	err := Scan(context.Background(), "echo; echo {file}: Eicar-Signature FOUND; exit 1", path)
+	if err == nil || !strings.Contains(err.Error(), "Eicar-Signature FOUND") {
+		t.Errorf("expected the scanner's output as the reason, got %v", err)
+	}
+}
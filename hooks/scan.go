@@ -0,0 +1,36 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ebob10000/2c1f/paths"
+)
+
+// RejectedDir returns the folder received files a scan rejected are moved
+// to, when they are kept
+func RejectedDir() string {
+	return paths.Data("rejected", "")
+}
+
+// Scan runs a virus scanner command such as "clamdscan --no-summary {file}"
+// on the received file at path, with {file} replaced by the quoted path,
+// which is also in the environment as TWOC1F_FILE. The file is rejected if
+// the command fails, with the first line of its output as the reason, so
+// files are also rejected while the scanner cannot run.
+func Scan(ctx context.Context, command, path string) error {
+	cmd := shell(ctx, expand(command, map[string]string{"file": path}))
+	cmd.Env = append(os.Environ(), "TWOC1F_FILE="+path)
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return fmt.Errorf("scan rejected the file: %s", line)
+		}
+	}
+	return fmt.Errorf("scan rejected the file: %w", err)
+}
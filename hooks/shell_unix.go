@@ -0,0 +1,13 @@
+//go:build !windows
+
+package hooks
+
+import (
+	"context"
+	"os/exec"
+)
+
+// shell returns the command that runs command through the shell
+func shell(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "/bin/sh", "-c", command)
+}
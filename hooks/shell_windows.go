@@ -0,0 +1,20 @@
+//go:build windows
+
+package hooks
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+)
+
+// shell returns the command that runs command through cmd.exe. The command
+// line is passed as it is: Go would escape the quotes in command for
+// programs that parse their arguments like the C runtime, which cmd.exe
+// does not, so quoted paths with spaces would break.
+func shell(ctx context.Context, command string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "cmd.exe")
+	// /S takes everything between the outer quotes as the command
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: `cmd.exe /S /C "` + command + `"`}
+	return cmd
+}
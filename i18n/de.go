@@ -0,0 +1,184 @@
+package i18n
+
+// de holds the German translations
+var de = map[string]string{
+	"Accept? [y/N]: ":             "Annehmen? [y/N]: ",
+	"Bootstrap failed: %v":        "Verbindung zum Netzwerk fehlgeschlagen: %v",
+	"Bootstrapping Simulation...": "Verbinde Simulation mit dem Netzwerk...",
+	"Bootstrapping network...":    "Verbinde mit dem Netzwerk...",
+	"Bootstrapping...":            "Verbinde mit dem Netzwerk...",
+	"CONNECTION CODE: %s":         "VERBINDUNGSCODE: %s",
+	"PEER ID: %s":                 "PEER-ID: %s",
+	"Cancelled.":                  "Abgebrochen.",
+	"Withdrawing the code...":     "Code wird zurückgezogen...",
+	"Claim code: %s":              "Abholcode: %s",
+	"Claiming %s (%s, %d files)":  "Hole %s ab (%s, %d Dateien)",
+	"Code: %s":                    "Code: %s",
+	"Compression init failed":     "Komprimierung konnte nicht gestartet werden",
+	"Confirm the receiver shows the same verification code before accepting.": "Prüfe vor dem Annehmen, ob der Empfänger denselben Bestätigungscode anzeigt.",
+	"Connected through the %s bootstrap peers":                                "Verbunden über die %s-Bootstrap-Peers",
+	"Connected to %s":            "Verbunden mit %s",
+	"Connecting to %s...":        "Verbinde mit %s...",
+	"Connecting to network...":   "Verbinde mit dem Netzwerk...",
+	"Connecting...":              "Verbinde...",
+	"Connection failed":          "Verbindung fehlgeschlagen",
+	"Connection interrupted: %v": "Verbindung unterbrochen: %v",
+	"Connection interrupted: %v. Waiting for receiver to reconnect...": "Verbindung unterbrochen: %v. Warte, bis sich der Empfänger erneut verbindet...",
+	"Connection rejected.":                                     "Verbindung abgelehnt.",
+	"Connection request from %s. Accept? [y/N]: ":              "Verbindungsanfrage von %s. Annehmen? [y/N]: ",
+	"Contact unreachable":                                      "Kontakt nicht erreichbar",
+	"Could not reach the %s bootstrap peers: %v":               "Die %s-Bootstrap-Peers sind nicht erreichbar: %v",
+	"Decrypting...":                                            "Entschlüssele...",
+	"Delivery receipt verified":                                "Empfangsbestätigung geprüft",
+	"Delivery receipt verified.":                               "Empfangsbestätigung geprüft.",
+	"Destination: %s":                                          "Ziel: %s",
+	"Direct connection established, migrating transfer...":     "Direkte Verbindung hergestellt, Übertragung wird umgestellt...",
+	"Does the sender show the same verification code? [y/N]: ": "Zeigt der Sender denselben Bestätigungscode an? [y/N]: ",
+	"Encrypting for the mailbox...":                            "Verschlüssele für das Postfach...",
+	"Enter connection code: ":                                  "Verbindungscode eingeben: ",
+	"Enter path to file or folder: ":                           "Pfad zur Datei oder zum Ordner eingeben: ",
+	"Error: %v":                                                "Fehler: %v",
+	"Error: Cannot access path: %v":                            "Fehler: Auf den Pfad kann nicht zugegriffen werden: %v",
+	"Error: Cannot load session %s: %v":                        "Fehler: Sitzung %s kann nicht geladen werden: %v",
+	"Error: Cannot resume session: %v":                         "Fehler: Sitzung kann nicht fortgesetzt werden: %v",
+	"Error: Code required":                                     "Fehler: Code erforderlich",
+	"Error: Failed to advertise: %v":                           "Fehler: Code konnte nicht bekannt gegeben werden: %v",
+	"Error: Failed to bootstrap: %v":                           "Fehler: Verbindung zum Netzwerk fehlgeschlagen: %v",
+	"Error: Failed to create P2P node: %v":                     "Fehler: P2P-Knoten konnte nicht erstellt werden: %v",
+	"Error: Failed to find peer: %v":                           "Fehler: Gegenstelle nicht gefunden: %v",
+	"Error: Failed to generate code: %v":                       "Fehler: Code konnte nicht erzeugt werden: %v",
+	"Error: Failed to open stream: %v":                         "Fehler: Stream konnte nicht geöffnet werden: %v",
+	"Error: Failed to scan path: %v":                           "Fehler: Pfad konnte nicht gelesen werden: %v",
+	"Error: Path required":                                     "Fehler: Pfad erforderlich",
+	"Error: Transfer failed verification: %v":                  "Fehler: Übertragung hat die Prüfung nicht bestanden: %v",
+	"Error: Transfer failed: %v":                               "Fehler: Übertragung fehlgeschlagen: %v",
+	"Estimated time: ~%s at %s/s":                              "Geschätzte Dauer: ~%s bei %s/s",
+	"Estimated time: ~%s at %s/s (relayed, a direct connection may be faster)": "Geschätzte Dauer: ~%s bei %s/s (über Relay, eine direkte Verbindung kann schneller sein)",
+	"Failed to generate code: %v":                         "Code konnte nicht erzeugt werden: %v",
+	"Failed to initialize compression: %v":                "Komprimierung konnte nicht gestartet werden: %v",
+	"Failed to prepare files: %v":                         "Dateien konnten nicht vorbereitet werden: %v",
+	"Failed to start node: %v":                            "Knoten konnte nicht gestartet werden: %v",
+	"Failed to start p2p node: %v":                        "P2P-Knoten konnte nicht gestartet werden: %v",
+	"Files are encrypted, unlock them with: %s":           "Die Dateien sind verschlüsselt, entsperren mit: %s",
+	"Files saved to: %s":                                  "Dateien gespeichert in: %s",
+	"Files: %d":                                           "Dateien: %d",
+	"Finding peer...":                                     "Suche Gegenstelle...",
+	"Fingerprint verified: %s":                            "Fingerabdruck geprüft: %s",
+	"Compression: %s":                                     "Komprimierung: %s",
+	"Files: %d transferred, %d skipped, %d failed":        "Dateien: %d übertragen, %d übersprungen, %d fehlgeschlagen",
+	"Data: %s transferred, %s resumed, in %s at %s/s":     "Daten: %s übertragen, %s fortgesetzt, in %s mit %s/s",
+	"Fingerprint: %s":                                     "Fingerabdruck: %s",
+	"Handshake failed":                                    "Handshake fehlgeschlagen",
+	"Handshake failed: %v":                                "Handshake fehlgeschlagen: %v",
+	"Hashing: %s...":                                      "Berechne Prüfsummen: %s...",
+	"Ignoring receipt signed by a different peer":         "Empfangsbestätigung einer anderen Gegenstelle wird ignoriert",
+	"Incoming Transfer:":                                  "Eingehende Übertragung:",
+	"Initializing Simulation...":                          "Starte Simulation...",
+	"Initializing...":                                     "Starte...",
+	"Name: %s":                                            "Name: %s",
+	"Network ready. Advertising code...":                  "Netzwerk bereit. Gebe Code bekannt...",
+	"Node ID: %s":                                         "Knoten-ID: %s",
+	"Only receivers on the local network can connect: %v": "Nur Empfänger im lokalen Netzwerk können sich verbinden: %v",
+	"Peer connected: %s":                                  "Gegenstelle verbunden: %s",
+	"Peer connected: SIMULATOR":                           "Gegenstelle verbunden: SIMULATOR",
+	"Peer not found. Make sure the sender is online and the code is correct.": "Gegenstelle nicht gefunden. Prüfe, ob der Sender online und der Code richtig ist.",
+	"Receive failed after retries":                                            "Empfang nach mehreren Versuchen fehlgeschlagen",
+	"Receiver confirmed all files.":                                           "Der Empfänger hat alle Dateien bestätigt.",
+	"Receiver confirmed the files it chose, %d were left out.":                "Der Empfänger hat die gewählten Dateien bestätigt, %d wurden ausgelassen.",
+	"Receiver did not confirm the transfer":                                   "Der Empfänger hat die Übertragung nicht bestätigt",
+	"Receiver reconnected, resuming transfer...":                              "Empfänger erneut verbunden, setze Übertragung fort...",
+	"Receiving from contact %s":                                               "Empfange von Kontakt %s",
+	"Reconnecting to sender...":                                               "Verbinde erneut mit dem Sender...",
+	"Renamed because the names are not valid on this system:":                 "Umbenannt, weil die Namen auf diesem System ungültig sind:",
+	"Resume with: %s":                                                         "Fortsetzen mit: %s",
+	"Resuming %s (%s of %s done)":                                             "Setze %s fort (%s von %s erledigt)",
+	"Resuming: found %s existing data":                                        "Fortsetzen: %s vorhandene Daten gefunden",
+	"Retrying (%d/%d)...":                                                     "Neuer Versuch (%d/%d)...",
+	"Retrying transfer (attempt %d/%d)...":                                    "Wiederhole Übertragung (Versuch %d/%d)...",
+	"Saved %s as %s, the name is not valid on this system":                    "%s als %s gespeichert, der Name ist auf diesem System ungültig",
+	"Searching for mailbox...":                                                "Suche Postfach...",
+	"Searching for receiver...":                                               "Suche Empfänger...",
+	"Searching for sender...":                                                 "Suche Sender...",
+	"Searching for sender... (%ds)":                                           "Suche Sender... (%ds)",
+	"Searching the local network...":                                          "Suche im lokalen Netzwerk...",
+	"Sender scheduled the transfer for %s":                                    "Der Sender hat die Übertragung für %s geplant",
+	"Sender scheduled the transfer, waiting until %s...":                      "Der Sender hat die Übertragung geplant, warte bis %s...",
+	"Reading from a network mount at up to %s/s, change with -source-limit":   "Lese von einem Netzlaufwerk mit bis zu %s/s, änderbar mit -source-limit",
+	"Sending: %s (%d files)":                                                  "Sende: %s (%d Dateien)",
+	"Sent, but the receiver did not confirm it received the files.":           "Gesendet, aber der Empfänger hat den Erhalt der Dateien nicht bestätigt.",
+	"Session sent %s to this receiver before":                                 "Diese Sitzung hatte %s an diesen Empfänger gesendet",
+	"Session: %s (continue with %s)":                                          "Sitzung: %s (fortsetzen mit %s)",
+	"Share the code and the peer ID with the receiver, who runs: %s":          "Teile den Code und die Peer-ID mit dem Empfänger, der Folgendes ausführt: %s",
+	"Share this code with the receiver.":                                      "Teile diesen Code mit dem Empfänger.",
+	"Shutting down...":                                                        "Beende...",
+	"Size: %s":                                                                "Größe: %s",
+	"Starting P2P node...":                                                    "Starte P2P-Knoten...",
+	"Stopped: %v after %d downloads.":                                         "Beendet: %v nach %d Downloads.",
+	"Stopped: code expired after %d downloads.":                               "Beendet: Code nach %d Downloads abgelaufen.",
+	"Stopped: code expired before anyone downloaded the files.":               "Beendet: Code abgelaufen, bevor jemand die Dateien heruntergeladen hat.",
+	"Stored in the mailbox until %s.":                                         "Im Postfach gespeichert bis %s.",
+	"The code expires at %s.":                                                 "Der Code läuft um %s ab.",
+	"The receiver collects the files with: %s":                                "Der Empfänger holt die Dateien ab mit: %s",
+	"The transfer starts at %s.":                                              "Die Übertragung beginnt um %s.",
+	"More than one sender uses this code. Ask for a new one.":                 "Mehr als ein Absender verwendet diesen Code. Bitte um einen neuen.",
+	"Sender [1-%d], or Enter to abort: ":                                      "Absender [1-%d], oder Enter zum Abbrechen: ",
+	"Warning: %d senders use this code. Pick the one that shows the same verification code:": "Warnung: %d Absender verwenden diesen Code. Wähle den, der denselben Bestätigungscode anzeigt:",
+	"The sender cancelled this transfer.":                                                    "Der Absender hat diese Übertragung abgebrochen.",
+	"Transfer cancelled":                                                                     "Übertragung abgebrochen",
+	"Transfer cancelled. Partially received files are kept and will resume next time.":       "Übertragung abgebrochen. Teilweise empfangene Dateien bleiben erhalten und werden beim nächsten Mal fortgesetzt.",
+	"Transfer complete!":                                                                     "Übertragung abgeschlossen!",
+	"Transfer complete! %d downloads done.":                                                  "Übertragung abgeschlossen! %d Downloads erledigt.",
+	"Transfer complete! %d of %d downloads done.":                                            "Übertragung abgeschlossen! %d von %d Downloads erledigt.",
+	"Transfer failed":                                                                        "Übertragung fehlgeschlagen",
+	"Transfer failed: %v":                                                                    "Übertragung fehlgeschlagen: %v",
+	"Transfer rejected.":                                                                     "Übertragung abgelehnt.",
+	"Transfer rejected: %v":                                                                  "Übertragung abgelehnt: %v",
+	"Transfer scheduled for %s":                                                              "Übertragung geplant für %s",
+	"Up to %d receivers can download.":                                                       "Bis zu %d Empfänger können herunterladen.",
+	"Verification code: %s":                                                                  "Bestätigungscode: %s",
+	"Verification codes did not match. Aborting.":                                            "Die Bestätigungscodes stimmen nicht überein. Abbruch.",
+	"Verification codes did not match. Connection rejected.":                                 "Die Bestätigungscodes stimmen nicht überein. Verbindung abgelehnt.",
+	"Verification codes did not match. Transfer aborted.":                                    "Die Bestätigungscodes stimmen nicht überein. Übertragung abgebrochen.",
+	"Waiting for connection (Simulation)...":                                                 "Warte auf Verbindung (Simulation)...",
+	"Waiting for connection...":                                                              "Warte auf Verbindung...",
+	"Waiting for peer to connect...":                                                         "Warte, bis sich die Gegenstelle verbindet...",
+	"Waiting for receiver to reconnect...":                                                   "Warte, bis sich der Empfänger erneut verbindet...",
+	"Waiting for the next receiver...":                                                       "Warte auf den nächsten Empfänger...",
+	"Warning: %s":                                                                            "Warnung: %s",
+	"Warning: Failed to save session: %v":                                                    "Warnung: Sitzung konnte nicht gespeichert werden: %v",
+	"Warning: Session will not be resumable: %v":                                             "Warnung: Die Sitzung kann nicht fortgesetzt werden: %v",
+	"Warning: ignoring receipt signed by a different peer":                                   "Warnung: Empfangsbestätigung einer anderen Gegenstelle wird ignoriert",
+	"no failed or cancelled receive to resume":                                               "kein fehlgeschlagener oder abgebrochener Empfang zum Fortsetzen",
+	"no transfer %s in the history, see 2c1f history":                                        "keine Übertragung %s im Verlauf, siehe 2c1f history",
+	"transfer %s cannot be resumed":                                                          "Übertragung %s kann nicht fortgesetzt werden",
+	"usage: 2c1f resume -last | <id> [receive flags]":                                        "Verwendung: 2c1f resume -last | <id> [Empfangsoptionen]",
+
+	// Interface
+	"Automatic":                              "Automatisch",
+	"Background Speed Limit":                 "Geschwindigkeitsbegrenzung im Hintergrund",
+	"Browse":                                 "Durchsuchen",
+	"Cancel":                                 "Abbrechen",
+	"Cancel Transfer":                        "Übertragung abbrechen",
+	"Codes Match":                            "Codes stimmen überein",
+	"Configure application defaults.":        "Standardeinstellungen der Anwendung festlegen.",
+	"Connect & Download":                     "Verbinden und herunterladen",
+	"Connect to a peer to download.":         "Mit einer Gegenstelle verbinden, um herunterzuladen.",
+	"Create Transfer":                        "Übertragung erstellen",
+	"Create a secure P2P transfer.":          "Eine sichere P2P-Übertragung erstellen.",
+	"Doesn't Match":                          "Stimmt nicht überein",
+	"File":                                   "Datei",
+	"Folder":                                 "Ordner",
+	"History":                                "Verlauf",
+	"Language":                               "Sprache",
+	"Language of the interface and messages": "Sprache der Oberfläche und Meldungen",
+	"New Transfer":                           "Neue Übertragung",
+	"Receive":                                "Empfangen",
+	"Receive Files":                          "Dateien empfangen",
+	"Recent file transfers.":                 "Letzte Dateiübertragungen.",
+	"Reject":                                 "Ablehnen",
+	"Send":                                   "Senden",
+	"Send Files":                             "Dateien senden",
+	"Send to Contact":                        "An Kontakt senden",
+	"Settings":                               "Einstellungen",
+	"Transfer Complete!":                     "Übertragung abgeschlossen!",
+}
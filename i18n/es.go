@@ -0,0 +1,184 @@
+package i18n
+
+// es holds the Spanish translations
+var es = map[string]string{
+	"Accept? [y/N]: ":             "¿Aceptar? [y/N]: ",
+	"Bootstrap failed: %v":        "No se pudo conectar a la red: %v",
+	"Bootstrapping Simulation...": "Conectando la simulación a la red...",
+	"Bootstrapping network...":    "Conectando a la red...",
+	"Bootstrapping...":            "Conectando a la red...",
+	"CONNECTION CODE: %s":         "CÓDIGO DE CONEXIÓN: %s",
+	"PEER ID: %s":                 "ID DE PEER: %s",
+	"Cancelled.":                  "Cancelado.",
+	"Withdrawing the code...":     "Retirando el código...",
+	"Claim code: %s":              "Código de recogida: %s",
+	"Claiming %s (%s, %d files)":  "Recogiendo %s (%s, %d archivos)",
+	"Code: %s":                    "Código: %s",
+	"Compression init failed":     "No se pudo iniciar la compresión",
+	"Confirm the receiver shows the same verification code before accepting.": "Confirma que el receptor muestra el mismo código de verificación antes de aceptar.",
+	"Connected through the %s bootstrap peers":                                "Conectado a través de los pares de arranque %s",
+	"Connected to %s":            "Conectado a %s",
+	"Connecting to %s...":        "Conectando a %s...",
+	"Connecting to network...":   "Conectando a la red...",
+	"Connecting...":              "Conectando...",
+	"Connection failed":          "Falló la conexión",
+	"Connection interrupted: %v": "Conexión interrumpida: %v",
+	"Connection interrupted: %v. Waiting for receiver to reconnect...": "Conexión interrumpida: %v. Esperando a que el receptor se vuelva a conectar...",
+	"Connection rejected.":                                     "Conexión rechazada.",
+	"Connection request from %s. Accept? [y/N]: ":              "Solicitud de conexión de %s. ¿Aceptar? [y/N]: ",
+	"Contact unreachable":                                      "Contacto inaccesible",
+	"Could not reach the %s bootstrap peers: %v":               "No se pudo contactar con los pares de arranque %s: %v",
+	"Decrypting...":                                            "Descifrando...",
+	"Delivery receipt verified":                                "Acuse de recibo verificado",
+	"Delivery receipt verified.":                               "Acuse de recibo verificado.",
+	"Destination: %s":                                          "Destino: %s",
+	"Direct connection established, migrating transfer...":     "Conexión directa establecida, migrando la transferencia...",
+	"Does the sender show the same verification code? [y/N]: ": "¿Muestra el emisor el mismo código de verificación? [y/N]: ",
+	"Encrypting for the mailbox...":                            "Cifrando para el buzón...",
+	"Enter connection code: ":                                  "Introduce el código de conexión: ",
+	"Enter path to file or folder: ":                           "Introduce la ruta del archivo o la carpeta: ",
+	"Error: %v":                                                "Error: %v",
+	"Error: Cannot access path: %v":                            "Error: no se puede acceder a la ruta: %v",
+	"Error: Cannot load session %s: %v":                        "Error: no se puede cargar la sesión %s: %v",
+	"Error: Cannot resume session: %v":                         "Error: no se puede reanudar la sesión: %v",
+	"Error: Code required":                                     "Error: se necesita un código",
+	"Error: Failed to advertise: %v":                           "Error: no se pudo anunciar el código: %v",
+	"Error: Failed to bootstrap: %v":                           "Error: no se pudo conectar a la red: %v",
+	"Error: Failed to create P2P node: %v":                     "Error: no se pudo crear el nodo P2P: %v",
+	"Error: Failed to find peer: %v":                           "Error: no se encontró el par: %v",
+	"Error: Failed to generate code: %v":                       "Error: no se pudo generar el código: %v",
+	"Error: Failed to open stream: %v":                         "Error: no se pudo abrir el flujo: %v",
+	"Error: Failed to scan path: %v":                           "Error: no se pudo recorrer la ruta: %v",
+	"Error: Path required":                                     "Error: se necesita una ruta",
+	"Error: Transfer failed verification: %v":                  "Error: la transferencia no superó la verificación: %v",
+	"Error: Transfer failed: %v":                               "Error: falló la transferencia: %v",
+	"Estimated time: ~%s at %s/s":                              "Tiempo estimado: ~%s a %s/s",
+	"Estimated time: ~%s at %s/s (relayed, a direct connection may be faster)": "Tiempo estimado: ~%s a %s/s (por relé, una conexión directa puede ser más rápida)",
+	"Failed to generate code: %v":                         "No se pudo generar el código: %v",
+	"Failed to initialize compression: %v":                "No se pudo iniciar la compresión: %v",
+	"Failed to prepare files: %v":                         "No se pudieron preparar los archivos: %v",
+	"Failed to start node: %v":                            "No se pudo iniciar el nodo: %v",
+	"Failed to start p2p node: %v":                        "No se pudo iniciar el nodo P2P: %v",
+	"Files are encrypted, unlock them with: %s":           "Los archivos están cifrados, desbloquéalos con: %s",
+	"Files saved to: %s":                                  "Archivos guardados en: %s",
+	"Files: %d":                                           "Archivos: %d",
+	"Finding peer...":                                     "Buscando el par...",
+	"Fingerprint verified: %s":                            "Huella verificada: %s",
+	"Compression: %s":                                     "Compresión: %s",
+	"Files: %d transferred, %d skipped, %d failed":        "Archivos: %d transferidos, %d omitidos, %d fallidos",
+	"Data: %s transferred, %s resumed, in %s at %s/s":     "Datos: %s transferidos, %s reanudados, en %s a %s/s",
+	"Fingerprint: %s":                                     "Huella: %s",
+	"Handshake failed":                                    "Falló el protocolo de enlace",
+	"Handshake failed: %v":                                "Falló el protocolo de enlace: %v",
+	"Hashing: %s...":                                      "Calculando sumas de verificación: %s...",
+	"Ignoring receipt signed by a different peer":         "Se ignora un acuse de recibo firmado por otro par",
+	"Incoming Transfer:":                                  "Transferencia entrante:",
+	"Initializing Simulation...":                          "Iniciando la simulación...",
+	"Initializing...":                                     "Iniciando...",
+	"Name: %s":                                            "Nombre: %s",
+	"Network ready. Advertising code...":                  "Red lista. Anunciando el código...",
+	"Node ID: %s":                                         "ID del nodo: %s",
+	"Only receivers on the local network can connect: %v": "Solo los receptores de la red local pueden conectarse: %v",
+	"Peer connected: %s":                                  "Par conectado: %s",
+	"Peer connected: SIMULATOR":                           "Par conectado: SIMULADOR",
+	"Peer not found. Make sure the sender is online and the code is correct.": "No se encontró el par. Asegúrate de que el emisor está en línea y de que el código es correcto.",
+	"Receive failed after retries":                                            "La recepción falló tras varios intentos",
+	"Receiver confirmed all files.":                                           "El receptor confirmó todos los archivos.",
+	"Receiver confirmed the files it chose, %d were left out.":                "El receptor confirmó los archivos elegidos, %d quedaron fuera.",
+	"Receiver did not confirm the transfer":                                   "El receptor no confirmó la transferencia",
+	"Receiver reconnected, resuming transfer...":                              "El receptor se volvió a conectar, reanudando la transferencia...",
+	"Receiving from contact %s":                                               "Recibiendo del contacto %s",
+	"Reconnecting to sender...":                                               "Volviendo a conectar con el emisor...",
+	"Renamed because the names are not valid on this system:":                 "Renombrados porque los nombres no son válidos en este sistema:",
+	"Resume with: %s":                                                         "Reanudar con: %s",
+	"Resuming %s (%s of %s done)":                                             "Reanudando %s (%s de %s hecho)",
+	"Resuming: found %s existing data":                                        "Reanudando: se encontraron %s de datos existentes",
+	"Retrying (%d/%d)...":                                                     "Reintentando (%d/%d)...",
+	"Retrying transfer (attempt %d/%d)...":                                    "Reintentando la transferencia (intento %d/%d)...",
+	"Saved %s as %s, the name is not valid on this system":                    "%s se guardó como %s, el nombre no es válido en este sistema",
+	"Searching for mailbox...":                                                "Buscando el buzón...",
+	"Searching for receiver...":                                               "Buscando al receptor...",
+	"Searching for sender...":                                                 "Buscando al emisor...",
+	"Searching for sender... (%ds)":                                           "Buscando al emisor... (%ds)",
+	"Searching the local network...":                                          "Buscando en la red local...",
+	"Sender scheduled the transfer for %s":                                    "El emisor programó la transferencia para %s",
+	"Sender scheduled the transfer, waiting until %s...":                      "El emisor programó la transferencia, esperando hasta %s...",
+	"Reading from a network mount at up to %s/s, change with -source-limit":   "Leyendo de una unidad de red a %s/s como máximo, se cambia con -source-limit",
+	"Sending: %s (%d files)":                                                  "Enviando: %s (%d archivos)",
+	"Sent, but the receiver did not confirm it received the files.":           "Enviado, pero el receptor no confirmó que recibió los archivos.",
+	"Session sent %s to this receiver before":                                 "Esta sesión había enviado %s a este receptor",
+	"Session: %s (continue with %s)":                                          "Sesión: %s (continuar con %s)",
+	"Share the code and the peer ID with the receiver, who runs: %s":          "Comparte el código y el ID de peer con el receptor, que ejecuta: %s",
+	"Share this code with the receiver.":                                      "Comparte este código con el receptor.",
+	"Shutting down...":                                                        "Cerrando...",
+	"Size: %s":                                                                "Tamaño: %s",
+	"Starting P2P node...":                                                    "Iniciando el nodo P2P...",
+	"Stopped: %v after %d downloads.":                                         "Detenido: %v tras %d descargas.",
+	"Stopped: code expired after %d downloads.":                               "Detenido: el código caducó tras %d descargas.",
+	"Stopped: code expired before anyone downloaded the files.":               "Detenido: el código caducó antes de que nadie descargara los archivos.",
+	"Stored in the mailbox until %s.":                                         "Guardado en el buzón hasta %s.",
+	"The code expires at %s.":                                                 "El código caduca a las %s.",
+	"The receiver collects the files with: %s":                                "El receptor recoge los archivos con: %s",
+	"The transfer starts at %s.":                                              "La transferencia empieza a las %s.",
+	"More than one sender uses this code. Ask for a new one.":                 "Más de un remitente usa este código. Pide uno nuevo.",
+	"Sender [1-%d], or Enter to abort: ":                                      "Remitente [1-%d], o Intro para cancelar: ",
+	"Warning: %d senders use this code. Pick the one that shows the same verification code:": "Aviso: %d remitentes usan este código. Elige el que muestra el mismo código de verificación:",
+	"The sender cancelled this transfer.":                                                    "El remitente canceló esta transferencia.",
+	"Transfer cancelled":                                                                     "Transferencia cancelada",
+	"Transfer cancelled. Partially received files are kept and will resume next time.":       "Transferencia cancelada. Los archivos recibidos en parte se conservan y se reanudarán la próxima vez.",
+	"Transfer complete!":                                                                     "¡Transferencia completada!",
+	"Transfer complete! %d downloads done.":                                                  "¡Transferencia completada! %d descargas hechas.",
+	"Transfer complete! %d of %d downloads done.":                                            "¡Transferencia completada! %d de %d descargas hechas.",
+	"Transfer failed":                                                                        "Falló la transferencia",
+	"Transfer failed: %v":                                                                    "Falló la transferencia: %v",
+	"Transfer rejected.":                                                                     "Transferencia rechazada.",
+	"Transfer rejected: %v":                                                                  "Transferencia rechazada: %v",
+	"Transfer scheduled for %s":                                                              "Transferencia programada para %s",
+	"Up to %d receivers can download.":                                                       "Hasta %d receptores pueden descargar.",
+	"Verification code: %s":                                                                  "Código de verificación: %s",
+	"Verification codes did not match. Aborting.":                                            "Los códigos de verificación no coinciden. Cancelando.",
+	"Verification codes did not match. Connection rejected.":                                 "Los códigos de verificación no coinciden. Conexión rechazada.",
+	"Verification codes did not match. Transfer aborted.":                                    "Los códigos de verificación no coinciden. Transferencia cancelada.",
+	"Waiting for connection (Simulation)...":                                                 "Esperando conexión (simulación)...",
+	"Waiting for connection...":                                                              "Esperando conexión...",
+	"Waiting for peer to connect...":                                                         "Esperando a que el par se conecte...",
+	"Waiting for receiver to reconnect...":                                                   "Esperando a que el receptor se vuelva a conectar...",
+	"Waiting for the next receiver...":                                                       "Esperando al siguiente receptor...",
+	"Warning: %s":                                                                            "Aviso: %s",
+	"Warning: Failed to save session: %v":                                                    "Aviso: no se pudo guardar la sesión: %v",
+	"Warning: Session will not be resumable: %v":                                             "Aviso: la sesión no se podrá reanudar: %v",
+	"Warning: ignoring receipt signed by a different peer":                                   "Aviso: se ignora un acuse de recibo firmado por otro par",
+	"no failed or cancelled receive to resume":                                               "no hay ninguna recepción fallida o cancelada que reanudar",
+	"no transfer %s in the history, see 2c1f history":                                        "no hay ninguna transferencia %s en el historial, consulta 2c1f history",
+	"transfer %s cannot be resumed":                                                          "la transferencia %s no se puede reanudar",
+	"usage: 2c1f resume -last | <id> [receive flags]":                                        "uso: 2c1f resume -last | <id> [opciones de recepción]",
+
+	// Interface
+	"Automatic":                              "Automático",
+	"Background Speed Limit":                 "Límite de velocidad en segundo plano",
+	"Browse":                                 "Examinar",
+	"Cancel":                                 "Cancelar",
+	"Cancel Transfer":                        "Cancelar transferencia",
+	"Codes Match":                            "Los códigos coinciden",
+	"Configure application defaults.":        "Configura los valores predeterminados de la aplicación.",
+	"Connect & Download":                     "Conectar y descargar",
+	"Connect to a peer to download.":         "Conéctate a un par para descargar.",
+	"Create Transfer":                        "Crear transferencia",
+	"Create a secure P2P transfer.":          "Crea una transferencia P2P segura.",
+	"Doesn't Match":                          "No coincide",
+	"File":                                   "Archivo",
+	"Folder":                                 "Carpeta",
+	"History":                                "Historial",
+	"Language":                               "Idioma",
+	"Language of the interface and messages": "Idioma de la interfaz y de los mensajes",
+	"New Transfer":                           "Nueva transferencia",
+	"Receive":                                "Recibir",
+	"Receive Files":                          "Recibir archivos",
+	"Recent file transfers.":                 "Transferencias de archivos recientes.",
+	"Reject":                                 "Rechazar",
+	"Send":                                   "Enviar",
+	"Send Files":                             "Enviar archivos",
+	"Send to Contact":                        "Enviar al contacto",
+	"Settings":                               "Ajustes",
+	"Transfer Complete!":                     "¡Transferencia completada!",
+}
@@ -0,0 +1,184 @@
+package i18n
+
+// fr holds the French translations
+var fr = map[string]string{
+	"Accept? [y/N]: ":             "Accepter ? [y/N] : ",
+	"Bootstrap failed: %v":        "Échec de la connexion au réseau : %v",
+	"Bootstrapping Simulation...": "Connexion de la simulation au réseau...",
+	"Bootstrapping network...":    "Connexion au réseau...",
+	"Bootstrapping...":            "Connexion au réseau...",
+	"CONNECTION CODE: %s":         "CODE DE CONNEXION : %s",
+	"PEER ID: %s":                 "ID DE PAIR : %s",
+	"Cancelled.":                  "Annulé.",
+	"Withdrawing the code...":     "Retrait du code...",
+	"Claim code: %s":              "Code de retrait : %s",
+	"Claiming %s (%s, %d files)":  "Retrait de %s (%s, %d fichiers)",
+	"Code: %s":                    "Code : %s",
+	"Compression init failed":     "Impossible d'activer la compression",
+	"Confirm the receiver shows the same verification code before accepting.": "Vérifiez que le destinataire affiche le même code de vérification avant d'accepter.",
+	"Connected through the %s bootstrap peers":                                "Connecté via les pairs d'amorçage %s",
+	"Connected to %s":            "Connecté à %s",
+	"Connecting to %s...":        "Connexion à %s...",
+	"Connecting to network...":   "Connexion au réseau...",
+	"Connecting...":              "Connexion...",
+	"Connection failed":          "Échec de la connexion",
+	"Connection interrupted: %v": "Connexion interrompue : %v",
+	"Connection interrupted: %v. Waiting for receiver to reconnect...": "Connexion interrompue : %v. En attente de la reconnexion du destinataire...",
+	"Connection rejected.":                                     "Connexion refusée.",
+	"Connection request from %s. Accept? [y/N]: ":              "Demande de connexion de %s. Accepter ? [y/N] : ",
+	"Contact unreachable":                                      "Contact injoignable",
+	"Could not reach the %s bootstrap peers: %v":               "Les pairs d'amorçage %s sont injoignables : %v",
+	"Decrypting...":                                            "Déchiffrement...",
+	"Delivery receipt verified":                                "Accusé de réception vérifié",
+	"Delivery receipt verified.":                               "Accusé de réception vérifié.",
+	"Destination: %s":                                          "Destination : %s",
+	"Direct connection established, migrating transfer...":     "Connexion directe établie, migration du transfert...",
+	"Does the sender show the same verification code? [y/N]: ": "L'expéditeur affiche-t-il le même code de vérification ? [y/N] : ",
+	"Encrypting for the mailbox...":                            "Chiffrement pour la boîte aux lettres...",
+	"Enter connection code: ":                                  "Saisissez le code de connexion : ",
+	"Enter path to file or folder: ":                           "Saisissez le chemin du fichier ou du dossier : ",
+	"Error: %v":                                                "Erreur : %v",
+	"Error: Cannot access path: %v":                            "Erreur : impossible d'accéder au chemin : %v",
+	"Error: Cannot load session %s: %v":                        "Erreur : impossible de charger la session %s : %v",
+	"Error: Cannot resume session: %v":                         "Erreur : impossible de reprendre la session : %v",
+	"Error: Code required":                                     "Erreur : code requis",
+	"Error: Failed to advertise: %v":                           "Erreur : impossible d'annoncer le code : %v",
+	"Error: Failed to bootstrap: %v":                           "Erreur : échec de la connexion au réseau : %v",
+	"Error: Failed to create P2P node: %v":                     "Erreur : impossible de créer le nœud P2P : %v",
+	"Error: Failed to find peer: %v":                           "Erreur : pair introuvable : %v",
+	"Error: Failed to generate code: %v":                       "Erreur : impossible de générer le code : %v",
+	"Error: Failed to open stream: %v":                         "Erreur : impossible d'ouvrir le flux : %v",
+	"Error: Failed to scan path: %v":                           "Erreur : impossible de parcourir le chemin : %v",
+	"Error: Path required":                                     "Erreur : chemin requis",
+	"Error: Transfer failed verification: %v":                  "Erreur : le transfert n'a pas passé la vérification : %v",
+	"Error: Transfer failed: %v":                               "Erreur : échec du transfert : %v",
+	"Estimated time: ~%s at %s/s":                              "Durée estimée : ~%s à %s/s",
+	"Estimated time: ~%s at %s/s (relayed, a direct connection may be faster)": "Durée estimée : ~%s à %s/s (via relais, une connexion directe peut être plus rapide)",
+	"Failed to generate code: %v":                         "Impossible de générer le code : %v",
+	"Failed to initialize compression: %v":                "Impossible d'activer la compression : %v",
+	"Failed to prepare files: %v":                         "Impossible de préparer les fichiers : %v",
+	"Failed to start node: %v":                            "Impossible de démarrer le nœud : %v",
+	"Failed to start p2p node: %v":                        "Impossible de démarrer le nœud P2P : %v",
+	"Files are encrypted, unlock them with: %s":           "Les fichiers sont chiffrés, déverrouillez-les avec : %s",
+	"Files saved to: %s":                                  "Fichiers enregistrés dans : %s",
+	"Files: %d":                                           "Fichiers : %d",
+	"Finding peer...":                                     "Recherche du pair...",
+	"Fingerprint verified: %s":                            "Empreinte vérifiée : %s",
+	"Compression: %s":                                     "Compression : %s",
+	"Files: %d transferred, %d skipped, %d failed":        "Fichiers : %d transférés, %d ignorés, %d en échec",
+	"Data: %s transferred, %s resumed, in %s at %s/s":     "Données : %s transférés, %s repris, en %s à %s/s",
+	"Fingerprint: %s":                                     "Empreinte : %s",
+	"Handshake failed":                                    "Échec de la négociation",
+	"Handshake failed: %v":                                "Échec de la négociation : %v",
+	"Hashing: %s...":                                      "Calcul des sommes de contrôle : %s...",
+	"Ignoring receipt signed by a different peer":         "Accusé de réception signé par un autre pair ignoré",
+	"Incoming Transfer:":                                  "Transfert entrant :",
+	"Initializing Simulation...":                          "Démarrage de la simulation...",
+	"Initializing...":                                     "Démarrage...",
+	"Name: %s":                                            "Nom : %s",
+	"Network ready. Advertising code...":                  "Réseau prêt. Annonce du code...",
+	"Node ID: %s":                                         "ID du nœud : %s",
+	"Only receivers on the local network can connect: %v": "Seuls les destinataires du réseau local peuvent se connecter : %v",
+	"Peer connected: %s":                                  "Pair connecté : %s",
+	"Peer connected: SIMULATOR":                           "Pair connecté : SIMULATEUR",
+	"Peer not found. Make sure the sender is online and the code is correct.": "Pair introuvable. Vérifiez que l'expéditeur est en ligne et que le code est correct.",
+	"Receive failed after retries":                                            "Échec de la réception après plusieurs tentatives",
+	"Receiver confirmed all files.":                                           "Le destinataire a confirmé tous les fichiers.",
+	"Receiver confirmed the files it chose, %d were left out.":                "Le destinataire a confirmé les fichiers choisis, %d ont été laissés de côté.",
+	"Receiver did not confirm the transfer":                                   "Le destinataire n'a pas confirmé le transfert",
+	"Receiver reconnected, resuming transfer...":                              "Destinataire reconnecté, reprise du transfert...",
+	"Receiving from contact %s":                                               "Réception depuis le contact %s",
+	"Reconnecting to sender...":                                               "Reconnexion à l'expéditeur...",
+	"Renamed because the names are not valid on this system:":                 "Renommés car les noms ne sont pas valides sur ce système :",
+	"Resume with: %s":                                                         "Reprendre avec : %s",
+	"Resuming %s (%s of %s done)":                                             "Reprise de %s (%s sur %s effectués)",
+	"Resuming: found %s existing data":                                        "Reprise : %s de données existantes trouvées",
+	"Retrying (%d/%d)...":                                                     "Nouvelle tentative (%d/%d)...",
+	"Retrying transfer (attempt %d/%d)...":                                    "Nouvelle tentative de transfert (%d/%d)...",
+	"Saved %s as %s, the name is not valid on this system":                    "%s enregistré sous %s, le nom n'est pas valide sur ce système",
+	"Searching for mailbox...":                                                "Recherche de la boîte aux lettres...",
+	"Searching for receiver...":                                               "Recherche du destinataire...",
+	"Searching for sender...":                                                 "Recherche de l'expéditeur...",
+	"Searching for sender... (%ds)":                                           "Recherche de l'expéditeur... (%ds)",
+	"Searching the local network...":                                          "Recherche sur le réseau local...",
+	"Sender scheduled the transfer for %s":                                    "L'expéditeur a programmé le transfert pour %s",
+	"Sender scheduled the transfer, waiting until %s...":                      "L'expéditeur a programmé le transfert, attente jusqu'à %s...",
+	"Reading from a network mount at up to %s/s, change with -source-limit":   "Lecture depuis un montage réseau à %s/s au plus, modifiable avec -source-limit",
+	"Sending: %s (%d files)":                                                  "Envoi : %s (%d fichiers)",
+	"Sent, but the receiver did not confirm it received the files.":           "Envoyé, mais le destinataire n'a pas confirmé la réception des fichiers.",
+	"Session sent %s to this receiver before":                                 "Cette session avait envoyé %s à ce destinataire",
+	"Session: %s (continue with %s)":                                          "Session : %s (continuer avec %s)",
+	"Share the code and the peer ID with the receiver, who runs: %s":          "Partagez le code et l'ID de pair avec le destinataire, qui exécute : %s",
+	"Share this code with the receiver.":                                      "Partagez ce code avec le destinataire.",
+	"Shutting down...":                                                        "Arrêt...",
+	"Size: %s":                                                                "Taille : %s",
+	"Starting P2P node...":                                                    "Démarrage du nœud P2P...",
+	"Stopped: %v after %d downloads.":                                         "Arrêté : %v après %d téléchargements.",
+	"Stopped: code expired after %d downloads.":                               "Arrêté : code expiré après %d téléchargements.",
+	"Stopped: code expired before anyone downloaded the files.":               "Arrêté : le code a expiré avant que quiconque ne télécharge les fichiers.",
+	"Stored in the mailbox until %s.":                                         "Stocké dans la boîte aux lettres jusqu'au %s.",
+	"The code expires at %s.":                                                 "Le code expire à %s.",
+	"The receiver collects the files with: %s":                                "Le destinataire récupère les fichiers avec : %s",
+	"The transfer starts at %s.":                                              "Le transfert commence à %s.",
+	"More than one sender uses this code. Ask for a new one.":                 "Plusieurs expéditeurs utilisent ce code. Demandez-en un nouveau.",
+	"Sender [1-%d], or Enter to abort: ":                                      "Expéditeur [1-%d], ou Entrée pour annuler : ",
+	"Warning: %d senders use this code. Pick the one that shows the same verification code:": "Attention : %d expéditeurs utilisent ce code. Choisissez celui qui affiche le même code de vérification :",
+	"The sender cancelled this transfer.":                                                    "L'expéditeur a annulé ce transfert.",
+	"Transfer cancelled":                                                                     "Transfert annulé",
+	"Transfer cancelled. Partially received files are kept and will resume next time.":       "Transfert annulé. Les fichiers partiellement reçus sont conservés et reprendront la prochaine fois.",
+	"Transfer complete!":                                                                     "Transfert terminé !",
+	"Transfer complete! %d downloads done.":                                                  "Transfert terminé ! %d téléchargements effectués.",
+	"Transfer complete! %d of %d downloads done.":                                            "Transfert terminé ! %d téléchargements sur %d effectués.",
+	"Transfer failed":                                                                        "Échec du transfert",
+	"Transfer failed: %v":                                                                    "Échec du transfert : %v",
+	"Transfer rejected.":                                                                     "Transfert refusé.",
+	"Transfer rejected: %v":                                                                  "Transfert refusé : %v",
+	"Transfer scheduled for %s":                                                              "Transfert programmé pour %s",
+	"Up to %d receivers can download.":                                                       "Jusqu'à %d destinataires peuvent télécharger.",
+	"Verification code: %s":                                                                  "Code de vérification : %s",
+	"Verification codes did not match. Aborting.":                                            "Les codes de vérification ne correspondent pas. Abandon.",
+	"Verification codes did not match. Connection rejected.":                                 "Les codes de vérification ne correspondent pas. Connexion refusée.",
+	"Verification codes did not match. Transfer aborted.":                                    "Les codes de vérification ne correspondent pas. Transfert interrompu.",
+	"Waiting for connection (Simulation)...":                                                 "En attente de connexion (simulation)...",
+	"Waiting for connection...":                                                              "En attente de connexion...",
+	"Waiting for peer to connect...":                                                         "En attente de la connexion du pair...",
+	"Waiting for receiver to reconnect...":                                                   "En attente de la reconnexion du destinataire...",
+	"Waiting for the next receiver...":                                                       "En attente du prochain destinataire...",
+	"Warning: %s":                                                                            "Avertissement : %s",
+	"Warning: Failed to save session: %v":                                                    "Avertissement : impossible d'enregistrer la session : %v",
+	"Warning: Session will not be resumable: %v":                                             "Avertissement : la session ne pourra pas être reprise : %v",
+	"Warning: ignoring receipt signed by a different peer":                                   "Avertissement : accusé de réception signé par un autre pair ignoré",
+	"no failed or cancelled receive to resume":                                               "aucune réception échouée ou annulée à reprendre",
+	"no transfer %s in the history, see 2c1f history":                                        "aucun transfert %s dans l'historique, voir 2c1f history",
+	"transfer %s cannot be resumed":                                                          "le transfert %s ne peut pas être repris",
+	"usage: 2c1f resume -last | <id> [receive flags]":                                        "utilisation : 2c1f resume -last | <id> [options de réception]",
+
+	// Interface
+	"Automatic":                              "Automatique",
+	"Background Speed Limit":                 "Limite de vitesse en arrière-plan",
+	"Browse":                                 "Parcourir",
+	"Cancel":                                 "Annuler",
+	"Cancel Transfer":                        "Annuler le transfert",
+	"Codes Match":                            "Les codes correspondent",
+	"Configure application defaults.":        "Configurer les valeurs par défaut de l'application.",
+	"Connect & Download":                     "Se connecter et télécharger",
+	"Connect to a peer to download.":         "Connectez-vous à un pair pour télécharger.",
+	"Create Transfer":                        "Créer un transfert",
+	"Create a secure P2P transfer.":          "Créer un transfert P2P sécurisé.",
+	"Doesn't Match":                          "Ne correspond pas",
+	"File":                                   "Fichier",
+	"Folder":                                 "Dossier",
+	"History":                                "Historique",
+	"Language":                               "Langue",
+	"Language of the interface and messages": "Langue de l'interface et des messages",
+	"New Transfer":                           "Nouveau transfert",
+	"Receive":                                "Recevoir",
+	"Receive Files":                          "Recevoir des fichiers",
+	"Recent file transfers.":                 "Transferts de fichiers récents.",
+	"Reject":                                 "Refuser",
+	"Send":                                   "Envoyer",
+	"Send Files":                             "Envoyer des fichiers",
+	"Send to Contact":                        "Envoyer au contact",
+	"Settings":                               "Paramètres",
+	"Transfer Complete!":                     "Transfert terminé !",
+}
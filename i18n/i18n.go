@@ -0,0 +1,110 @@
+// Package i18n translates user-facing messages. Messages are looked up by
+// their English text, so untranslated ones are shown in English.
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Language is a supported language
+type Language struct {
+	Code string `json:"code"` // ISO 639-1, such as "de"
+	Name string `json:"name"` // Name in the language itself
+}
+
+// Languages lists the supported languages, English first
+var Languages = []Language{
+	{"en", "English"},
+	{"de", "Deutsch"},
+	{"fr", "Français"},
+	{"es", "Español"},
+	{"zh", "中文"},
+}
+
+// catalogs maps a language code to translations keyed by English message
+var catalogs = map[string]map[string]string{
+	"de": de,
+	"fr": fr,
+	"es": es,
+	"zh": zh,
+}
+
+var (
+	mu      sync.RWMutex
+	current = "en"
+)
+
+// SetLanguage selects the language of messages. An empty code detects it
+// from the system, unsupported ones fall back to English.
+func SetLanguage(code string) {
+	if code == "" {
+		code = Detect()
+	}
+	code = normalize(code)
+	if _, ok := catalogs[code]; !ok {
+		code = "en"
+	}
+	mu.Lock()
+	current = code
+	mu.Unlock()
+}
+
+// Current returns the code of the selected language
+func Current() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// T translates msg into the selected language. With args, msg is a format
+// for fmt.Sprintf.
+func T(msg string, args ...any) string {
+	mu.RLock()
+	translated, ok := catalogs[current][msg]
+	mu.RUnlock()
+	if !ok {
+		translated = msg
+	}
+	if len(args) == 0 {
+		return translated
+	}
+	return fmt.Sprintf(translated, args...)
+}
+
+// Messages returns the translations of the selected language keyed by
+// English message, for the frontend
+func Messages() map[string]string {
+	mu.RLock()
+	defer mu.RUnlock()
+	messages := make(map[string]string, len(catalogs[current]))
+	for k, v := range catalogs[current] {
+		messages[k] = v
+	}
+	return messages
+}
+
+// Detect returns the language of the system from the locale environment
+// variables, or the platform's setting if they are not set
+func Detect() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG", "LANGUAGE"} {
+		// LANGUAGE is a list of preferences separated by colons
+		value, _, _ := strings.Cut(os.Getenv(name), ":")
+		if value != "" && value != "C" && value != "POSIX" {
+			return normalize(value)
+		}
+	}
+	return normalize(systemLocale())
+}
+
+// normalize reduces a locale such as de_DE.UTF-8 or zh-Hans-CN to its
+// language code
+func normalize(locale string) string {
+	locale = strings.ToLower(locale)
+	if i := strings.IndexAny(locale, "_-.@"); i >= 0 {
+		locale = locale[:i]
+	}
+	return locale
+}
@@ -0,0 +1,139 @@
+package i18n
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	cases := map[string]string{
+		"de_DE.UTF-8": "de",
+		"fr-FR":       "fr",
+		"zh-Hans-CN":  "zh",
+		"es":          "es",
+		"EN_us":       "en",
+		"sr@latin":    "sr",
+		"":            "",
+	}
+	for locale, want := range cases {
+		if got := normalize(locale); got != want {
+			t.Errorf("normalize(%q) = %q, want %q", locale, got, want)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_MESSAGES", "C")
+	t.Setenv("LANG", "fr_CA.UTF-8")
+	t.Setenv("LANGUAGE", "de:en")
+	if got := Detect(); got != "fr" {
+		t.Errorf("Detect() = %q, want fr", got)
+	}
+
+	t.Setenv("LANG", "")
+	if got := Detect(); got != "de" {
+		t.Errorf("Detect() with LANGUAGE = %q, want de", got)
+	}
+}
+
+func TestT(t *testing.T) {
+	defer SetLanguage("en")
+
+	SetLanguage("de_DE.UTF-8")
+	if Current() != "de" {
+		t.Fatalf("Current() = %q, want de", Current())
+	}
+	if got := T("Files: %d", 3); got != "Dateien: 3" {
+		t.Errorf("T = %q, want translated and formatted", got)
+	}
+	if got := T("not translated %d", 1); got != "not translated 1" {
+		t.Errorf("T = %q, want English fallback", got)
+	}
+	if got := T("100% done"); got != "100% done" {
+		t.Errorf("T without args = %q, want it unformatted", got)
+	}
+
+	SetLanguage("xx")
+	if Current() != "en" {
+		t.Errorf("unsupported language selected %q, want en", Current())
+	}
+	if got := T("Files: %d", 3); got != "Files: 3" {
+		t.Errorf("T in English = %q", got)
+	}
+}
+
+var verbs = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+// TestCatalogVerbs makes sure translations take the same arguments as the
+// English message
+func TestCatalogVerbs(t *testing.T) {
+	for code, catalog := range catalogs {
+		for msg, translated := range catalog {
+			if !slices.Equal(verbs.FindAllString(msg, -1), verbs.FindAllString(translated, -1)) {
+				t.Errorf("%s: %q has different verbs than %q", code, translated, msg)
+			}
+		}
+	}
+}
+
+// TestCatalogsComplete makes sure every message passed to T in the
+// repository is translated into every language
+func TestCatalogsComplete(t *testing.T) {
+	var messages []string
+	err := filepath.WalkDir("..", func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && (d.Name() == "frontend" || strings.HasPrefix(d.Name(), ".") && d.Name() != "..") {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+		if err != nil {
+			return err
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) == 0 {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || sel.Sel.Name != "T" {
+				return true
+			}
+			if pkg, ok := sel.X.(*ast.Ident); !ok || pkg.Name != "i18n" {
+				return true
+			}
+			if lit, ok := call.Args[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				msg, _ := strconv.Unquote(lit.Value)
+				messages = append(messages, msg)
+			}
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) == 0 {
+		t.Fatal("found no messages")
+	}
+	for code, catalog := range catalogs {
+		for _, msg := range messages {
+			if _, ok := catalog[msg]; !ok {
+				t.Errorf("%s: missing translation of %q", code, msg)
+			}
+		}
+	}
+}
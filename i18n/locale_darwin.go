@@ -0,0 +1,18 @@
+//go:build darwin
+
+package i18n
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// systemLocale returns the locale chosen in System Settings, such as de_DE.
+// Apps started from the Finder do not get LANG.
+func systemLocale() string {
+	out, err := exec.Command("defaults", "read", "-g", "AppleLocale").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
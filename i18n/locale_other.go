@@ -0,0 +1,8 @@
+//go:build !windows && !darwin
+
+package i18n
+
+// systemLocale is empty, the environment variables are the only source
+func systemLocale() string {
+	return ""
+}
@@ -0,0 +1,184 @@
+package i18n
+
+// zh holds the Simplified Chinese translations
+var zh = map[string]string{
+	"Accept? [y/N]: ":             "接受？[y/N]：",
+	"Bootstrap failed: %v":        "连接网络失败：%v",
+	"Bootstrapping Simulation...": "正在将模拟连接到网络...",
+	"Bootstrapping network...":    "正在连接网络...",
+	"Bootstrapping...":            "正在连接网络...",
+	"CONNECTION CODE: %s":         "连接码：%s",
+	"PEER ID: %s":                 "节点 ID：%s",
+	"Cancelled.":                  "已取消。",
+	"Withdrawing the code...":     "正在撤回代码...",
+	"Claim code: %s":              "领取码：%s",
+	"Claiming %s (%s, %d files)":  "正在领取 %s（%s，%d 个文件）",
+	"Code: %s":                    "连接码：%s",
+	"Compression init failed":     "无法启用压缩",
+	"Confirm the receiver shows the same verification code before accepting.": "接受前请确认接收方显示相同的验证码。",
+	"Connected through the %s bootstrap peers":                                "已通过 %s 引导节点连接",
+	"Connected to %s":            "已连接到 %s",
+	"Connecting to %s...":        "正在连接 %s...",
+	"Connecting to network...":   "正在连接网络...",
+	"Connecting...":              "正在连接...",
+	"Connection failed":          "连接失败",
+	"Connection interrupted: %v": "连接中断：%v",
+	"Connection interrupted: %v. Waiting for receiver to reconnect...": "连接中断：%v。正在等待接收方重新连接...",
+	"Connection rejected.":                                     "已拒绝连接。",
+	"Connection request from %s. Accept? [y/N]: ":              "来自 %s 的连接请求。接受？[y/N]：",
+	"Contact unreachable":                                      "无法联系到联系人",
+	"Could not reach the %s bootstrap peers: %v":               "无法连接 %s 引导节点：%v",
+	"Decrypting...":                                            "正在解密...",
+	"Delivery receipt verified":                                "送达回执已验证",
+	"Delivery receipt verified.":                               "送达回执已验证。",
+	"Destination: %s":                                          "目标位置：%s",
+	"Direct connection established, migrating transfer...":     "已建立直接连接，正在迁移传输...",
+	"Does the sender show the same verification code? [y/N]: ": "发送方是否显示相同的验证码？[y/N]：",
+	"Encrypting for the mailbox...":                            "正在为信箱加密...",
+	"Enter connection code: ":                                  "请输入连接码：",
+	"Enter path to file or folder: ":                           "请输入文件或文件夹的路径：",
+	"Error: %v":                                                "错误：%v",
+	"Error: Cannot access path: %v":                            "错误：无法访问路径：%v",
+	"Error: Cannot load session %s: %v":                        "错误：无法加载会话 %s：%v",
+	"Error: Cannot resume session: %v":                         "错误：无法恢复会话：%v",
+	"Error: Code required":                                     "错误：需要连接码",
+	"Error: Failed to advertise: %v":                           "错误：无法发布连接码：%v",
+	"Error: Failed to bootstrap: %v":                           "错误：连接网络失败：%v",
+	"Error: Failed to create P2P node: %v":                     "错误：无法创建 P2P 节点：%v",
+	"Error: Failed to find peer: %v":                           "错误：找不到对方：%v",
+	"Error: Failed to generate code: %v":                       "错误：无法生成连接码：%v",
+	"Error: Failed to open stream: %v":                         "错误：无法打开数据流：%v",
+	"Error: Failed to scan path: %v":                           "错误：无法扫描路径：%v",
+	"Error: Path required":                                     "错误：需要路径",
+	"Error: Transfer failed verification: %v":                  "错误：传输未通过校验：%v",
+	"Error: Transfer failed: %v":                               "错误：传输失败：%v",
+	"Estimated time: ~%s at %s/s":                              "预计时间：约 %s，速度 %s/s",
+	"Estimated time: ~%s at %s/s (relayed, a direct connection may be faster)": "预计时间：约 %s，速度 %s/s（经过中继，直接连接可能更快）",
+	"Failed to generate code: %v":                         "无法生成连接码：%v",
+	"Failed to initialize compression: %v":                "无法启用压缩：%v",
+	"Failed to prepare files: %v":                         "无法准备文件：%v",
+	"Failed to start node: %v":                            "无法启动节点：%v",
+	"Failed to start p2p node: %v":                        "无法启动 P2P 节点：%v",
+	"Files are encrypted, unlock them with: %s":           "文件已加密，请用以下命令解锁：%s",
+	"Files saved to: %s":                                  "文件已保存到：%s",
+	"Files: %d":                                           "文件数：%d",
+	"Finding peer...":                                     "正在查找对方...",
+	"Fingerprint verified: %s":                            "指纹已验证：%s",
+	"Compression: %s":                                     "压缩：%s",
+	"Files: %d transferred, %d skipped, %d failed":        "文件：已传输 %d 个，跳过 %d 个，失败 %d 个",
+	"Data: %s transferred, %s resumed, in %s at %s/s":     "数据：已传输 %s，续传 %s，用时 %s，速度 %s/s",
+	"Fingerprint: %s":                                     "指纹：%s",
+	"Handshake failed":                                    "握手失败",
+	"Handshake failed: %v":                                "握手失败：%v",
+	"Hashing: %s...":                                      "正在计算校验和：%s...",
+	"Ignoring receipt signed by a different peer":         "忽略由其他节点签名的回执",
+	"Incoming Transfer:":                                  "传入的传输：",
+	"Initializing Simulation...":                          "正在启动模拟...",
+	"Initializing...":                                     "正在启动...",
+	"Name: %s":                                            "名称：%s",
+	"Network ready. Advertising code...":                  "网络已就绪。正在发布连接码...",
+	"Node ID: %s":                                         "节点 ID：%s",
+	"Only receivers on the local network can connect: %v": "只有本地网络中的接收方可以连接：%v",
+	"Peer connected: %s":                                  "对方已连接：%s",
+	"Peer connected: SIMULATOR":                           "对方已连接：模拟器",
+	"Peer not found. Make sure the sender is online and the code is correct.": "找不到对方。请确认发送方在线并且连接码正确。",
+	"Receive failed after retries":                                            "多次重试后接收失败",
+	"Receiver confirmed all files.":                                           "接收方已确认所有文件。",
+	"Receiver confirmed the files it chose, %d were left out.":                "接收方已确认所选文件，%d 个未接收。",
+	"Receiver did not confirm the transfer":                                   "接收方未确认传输",
+	"Receiver reconnected, resuming transfer...":                              "接收方已重新连接，正在继续传输...",
+	"Receiving from contact %s":                                               "正在从联系人 %s 接收",
+	"Reconnecting to sender...":                                               "正在重新连接发送方...",
+	"Renamed because the names are not valid on this system:":                 "以下文件名在此系统上无效，已重命名：",
+	"Resume with: %s":                                                         "继续传输：%s",
+	"Resuming %s (%s of %s done)":                                             "正在继续 %s（已完成 %s / %s）",
+	"Resuming: found %s existing data":                                        "继续传输：发现 %s 已有数据",
+	"Retrying (%d/%d)...":                                                     "正在重试（%d/%d）...",
+	"Retrying transfer (attempt %d/%d)...":                                    "正在重试传输（第 %d/%d 次）...",
+	"Saved %s as %s, the name is not valid on this system":                    "%s 已保存为 %s，该名称在此系统上无效",
+	"Searching for mailbox...":                                                "正在查找信箱...",
+	"Searching for receiver...":                                               "正在查找接收方...",
+	"Searching for sender...":                                                 "正在查找发送方...",
+	"Searching for sender... (%ds)":                                           "正在查找发送方...（%d 秒）",
+	"Searching the local network...":                                          "正在搜索本地网络...",
+	"Sender scheduled the transfer for %s":                                    "发送方已将传输安排在 %s",
+	"Sender scheduled the transfer, waiting until %s...":                      "发送方已安排传输，等待到 %s...",
+	"Reading from a network mount at up to %s/s, change with -source-limit":   "从网络挂载读取，最高 %s/s，可用 -source-limit 更改",
+	"Sending: %s (%d files)":                                                  "正在发送：%s（%d 个文件）",
+	"Sent, but the receiver did not confirm it received the files.":           "已发送，但接收方未确认收到文件。",
+	"Session sent %s to this receiver before":                                 "此会话此前已向该接收方发送 %s",
+	"Session: %s (continue with %s)":                                          "会话：%s（用 %s 继续）",
+	"Share the code and the peer ID with the receiver, who runs: %s":          "请将连接码和节点 ID 分享给接收方，接收方运行：%s",
+	"Share this code with the receiver.":                                      "请将此连接码分享给接收方。",
+	"Shutting down...":                                                        "正在退出...",
+	"Size: %s":                                                                "大小：%s",
+	"Starting P2P node...":                                                    "正在启动 P2P 节点...",
+	"Stopped: %v after %d downloads.":                                         "已停止：%v，共下载 %d 次。",
+	"Stopped: code expired after %d downloads.":                               "已停止：连接码在 %d 次下载后过期。",
+	"Stopped: code expired before anyone downloaded the files.":               "已停止：连接码在有人下载文件前过期。",
+	"Stored in the mailbox until %s.":                                         "已存入信箱，保留至 %s。",
+	"The code expires at %s.":                                                 "连接码将于 %s 过期。",
+	"The receiver collects the files with: %s":                                "接收方使用以下命令领取文件：%s",
+	"The transfer starts at %s.":                                              "传输将于 %s 开始。",
+	"More than one sender uses this code. Ask for a new one.":                 "多个发送方使用此代码。请索取新的代码。",
+	"Sender [1-%d], or Enter to abort: ":                                      "发送方 [1-%d]，或按回车取消：",
+	"Warning: %d senders use this code. Pick the one that shows the same verification code:": "警告：%d 个发送方使用此代码。请选择显示相同验证码的那个：",
+	"The sender cancelled this transfer.":                                                    "发送方已取消此传输。",
+	"Transfer cancelled":                                                                     "传输已取消",
+	"Transfer cancelled. Partially received files are kept and will resume next time.":       "传输已取消。已部分接收的文件会保留，下次将继续传输。",
+	"Transfer complete!":                                                                     "传输完成！",
+	"Transfer complete! %d downloads done.":                                                  "传输完成！已下载 %d 次。",
+	"Transfer complete! %d of %d downloads done.":                                            "传输完成！已下载 %d/%d 次。",
+	"Transfer failed":                                                                        "传输失败",
+	"Transfer failed: %v":                                                                    "传输失败：%v",
+	"Transfer rejected.":                                                                     "传输已被拒绝。",
+	"Transfer rejected: %v":                                                                  "传输已被拒绝：%v",
+	"Transfer scheduled for %s":                                                              "传输已安排在 %s",
+	"Up to %d receivers can download.":                                                       "最多 %d 个接收方可以下载。",
+	"Verification code: %s":                                                                  "验证码：%s",
+	"Verification codes did not match. Aborting.":                                            "验证码不一致。正在中止。",
+	"Verification codes did not match. Connection rejected.":                                 "验证码不一致。已拒绝连接。",
+	"Verification codes did not match. Transfer aborted.":                                    "验证码不一致。传输已中止。",
+	"Waiting for connection (Simulation)...":                                                 "正在等待连接（模拟）...",
+	"Waiting for connection...":                                                              "正在等待连接...",
+	"Waiting for peer to connect...":                                                         "正在等待对方连接...",
+	"Waiting for receiver to reconnect...":                                                   "正在等待接收方重新连接...",
+	"Waiting for the next receiver...":                                                       "正在等待下一个接收方...",
+	"Warning: %s":                                                                            "警告：%s",
+	"Warning: Failed to save session: %v":                                                    "警告：无法保存会话：%v",
+	"Warning: Session will not be resumable: %v":                                             "警告：会话将无法继续：%v",
+	"Warning: ignoring receipt signed by a different peer":                                   "警告：忽略由其他节点签名的回执",
+	"no failed or cancelled receive to resume":                                               "没有可继续的失败或已取消的接收",
+	"no transfer %s in the history, see 2c1f history":                                        "历史记录中没有传输 %s，请查看 2c1f history",
+	"transfer %s cannot be resumed":                                                          "传输 %s 无法继续",
+	"usage: 2c1f resume -last | <id> [receive flags]":                                        "用法：2c1f resume -last | <id> [接收选项]",
+
+	// Interface
+	"Automatic":                              "自动",
+	"Background Speed Limit":                 "后台速度限制",
+	"Browse":                                 "浏览",
+	"Cancel":                                 "取消",
+	"Cancel Transfer":                        "取消传输",
+	"Codes Match":                            "验证码一致",
+	"Configure application defaults.":        "配置应用程序默认设置。",
+	"Connect & Download":                     "连接并下载",
+	"Connect to a peer to download.":         "连接到对方以下载。",
+	"Create Transfer":                        "创建传输",
+	"Create a secure P2P transfer.":          "创建安全的 P2P 传输。",
+	"Doesn't Match":                          "不一致",
+	"File":                                   "文件",
+	"Folder":                                 "文件夹",
+	"History":                                "历史记录",
+	"Language":                               "语言",
+	"Language of the interface and messages": "界面和消息的语言",
+	"New Transfer":                           "新建传输",
+	"Receive":                                "接收",
+	"Receive Files":                          "接收文件",
+	"Recent file transfers.":                 "最近的文件传输。",
+	"Reject":                                 "拒绝",
+	"Send":                                   "发送",
+	"Send Files":                             "发送文件",
+	"Send to Contact":                        "发送给联系人",
+	"Settings":                               "设置",
+	"Transfer Complete!":                     "传输完成！",
+}
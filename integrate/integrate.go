@@ -0,0 +1,46 @@
+// Package integrate adds a "Send with 2c1f" entry to the file manager's
+// context menu. The entry runs the 2c1f CLI on the selected file or folder.
+package integrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MenuLabel is the context menu entry shown by the file manager
+const MenuLabel = "Send with 2c1f"
+
+// Install registers the context menu entry for the CLI at exe
+func Install(exe string) error {
+	exe, err := filepath.Abs(exe)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(exe); err != nil {
+		return fmt.Errorf("cannot access executable: %w", err)
+	}
+	return install(exe)
+}
+
+// Uninstall removes the context menu entry. Removing an entry that was
+// never installed is not an error.
+func Uninstall() error {
+	return uninstall()
+}
+
+// shellQuote quotes s for POSIX shells
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// removeAll deletes paths, ignoring the ones that do not exist
+func removeAll(paths ...string) error {
+	for _, path := range paths {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
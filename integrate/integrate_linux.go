@@ -0,0 +1,89 @@
+//go:build linux
+
+package integrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The script opens a terminal so the user sees the code. Nautilus runs it as a
+// script and Dolphin through the service menu below.
+const linuxScript = `#!/bin/sh
+# Installed by 2c1f integrate install
+for term in x-terminal-emulator gnome-terminal konsole xfce4-terminal xterm; do
+	if command -v "$term" >/dev/null 2>&1; then
+		case "$term" in
+		gnome-terminal) exec "$term" -- %[1]s "$1" ;;
+		*) exec "$term" -e %[1]s "$1" ;;
+		esac
+	fi
+done
+exec %[1]s "$1"
+`
+
+const dolphinServiceMenu = `[Desktop Entry]
+Type=Service
+MimeType=all/all;
+Actions=send2c1f;
+X-KDE-ServiceTypes=KonqPopupMenu/Plugin
+
+[Desktop Action send2c1f]
+Name=%s
+Icon=document-send
+Exec=%s %%f
+`
+
+func linuxPaths() (script, serviceMenu string, err error) {
+	dataDir := os.Getenv("XDG_DATA_HOME")
+	if dataDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", err
+		}
+		dataDir = filepath.Join(home, ".local", "share")
+	}
+	script = filepath.Join(dataDir, "nautilus", "scripts", MenuLabel)
+	serviceMenu = filepath.Join(dataDir, "kio", "servicemenus", "2c1f-send.desktop")
+	return script, serviceMenu, nil
+}
+
+func install(exe string) error {
+	script, serviceMenu, err := linuxPaths()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(script), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(script, []byte(fmt.Sprintf(linuxScript, shellQuote(exe))), 0755); err != nil {
+		return fmt.Errorf("failed to write Nautilus script: %w", err)
+	}
+
+	// Dolphin only runs service menus that are marked executable
+	if err := os.MkdirAll(filepath.Dir(serviceMenu), 0755); err != nil {
+		return err
+	}
+	entry := fmt.Sprintf(dolphinServiceMenu, MenuLabel, desktopQuote(script))
+	if err := os.WriteFile(serviceMenu, []byte(entry), 0755); err != nil {
+		return fmt.Errorf("failed to write Dolphin service menu: %w", err)
+	}
+	return nil
+}
+
+func uninstall() error {
+	script, serviceMenu, err := linuxPaths()
+	if err != nil {
+		return err
+	}
+	return removeAll(script, serviceMenu)
+}
+
+// desktopQuote quotes an Exec argument of a desktop entry
+func desktopQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`", "$", `\$`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,63 @@
+//go:build linux
+
+package integrate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInstallLinux(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	exe := filepath.Join(t.TempDir(), "it's 2c1f")
+	if err := os.WriteFile(exe, nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Install(exe); err != nil {
+		t.Fatalf("Install failed: %v", err)
+	}
+	script, serviceMenu, err := linuxPaths()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(script)
+	if err != nil {
+		t.Fatalf("script not written: %v", err)
+	}
+	if !strings.Contains(string(data), shellQuote(exe)+` "$1"`) {
+		t.Errorf("script does not run the executable:\n%s", data)
+	}
+	if info, err := os.Stat(serviceMenu); err != nil || info.Mode()&0100 == 0 {
+		t.Errorf("service menu missing or not executable: %v", err)
+	}
+
+	if err := Uninstall(); err != nil {
+		t.Fatalf("Uninstall failed: %v", err)
+	}
+	for _, path := range []string{script, serviceMenu} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s still exists", path)
+		}
+	}
+	if err := Uninstall(); err != nil {
+		t.Errorf("second Uninstall failed: %v", err)
+	}
+}
+
+func TestDesktopQuote(t *testing.T) {
+	got := desktopQuote(`/a b/"x"$y`)
+	want := `"/a b/\"x\"\$y"`
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestInstallMissingExecutable(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	if err := Install(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected error for missing executable")
+	}
+}
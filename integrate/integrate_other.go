@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !windows
+
+package integrate
+
+import "errors"
+
+var errUnsupported = errors.New("context menu integration is not supported on this platform")
+
+func install(string) error {
+	return errUnsupported
+}
+
+func uninstall() error {
+	return errUnsupported
+}
@@ -0,0 +1,57 @@
+//go:build windows
+
+package integrate
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// Per-user verbs for files and folders, no administrator rights needed
+var verbKeys = []string{
+	`Software\Classes\*\shell\2c1f`,
+	`Software\Classes\Directory\shell\2c1f`,
+}
+
+func install(exe string) error {
+	command := fmt.Sprintf(`"%s" "%%1"`, exe)
+	for _, path := range verbKeys {
+		key, _, err := registry.CreateKey(registry.CURRENT_USER, path, registry.SET_VALUE)
+		if err != nil {
+			return fmt.Errorf("failed to create registry key: %w", err)
+		}
+		err = key.SetStringValue("", MenuLabel)
+		if err == nil {
+			err = key.SetStringValue("Icon", exe)
+		}
+		key.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write registry value: %w", err)
+		}
+
+		key, _, err = registry.CreateKey(registry.CURRENT_USER, path+`\command`, registry.SET_VALUE)
+		if err != nil {
+			return fmt.Errorf("failed to create registry key: %w", err)
+		}
+		err = key.SetStringValue("", command)
+		key.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write registry value: %w", err)
+		}
+	}
+	return nil
+}
+
+func uninstall() error {
+	for _, path := range verbKeys {
+		// Subkeys have to be deleted first
+		for _, key := range []string{path + `\command`, path} {
+			if err := registry.DeleteKey(registry.CURRENT_USER, key); err != nil && !errors.Is(err, registry.ErrNotExist) {
+				return fmt.Errorf("failed to delete registry key: %w", err)
+			}
+		}
+	}
+	return nil
+}
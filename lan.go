@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ebob10000/2c1f/p2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ListLocalSenders returns the senders on the local network that offer their
+// transfer. Discovery starts on the first call, so poll while the receive
+// screen is open.
+func (a *App) ListLocalSenders() ([]p2p.LocalSender, error) {
+	node, err := a.discovery()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(a.ctx, 3*time.Second)
+	defer cancel()
+	return node.LocalSenders(ctx), nil
+}
+
+// ReceiveFromLocalSender starts receiving from a sender returned by
+// ListLocalSenders and returns the code it offered
+func (a *App) ReceiveFromLocalSender(id, destPath string, fastResume bool, password string) (string, error) {
+	peerID, err := peer.Decode(id)
+	if err != nil {
+		return "", fmt.Errorf("invalid sender: %w", err)
+	}
+	node, err := a.discovery()
+	if err != nil {
+		return "", err
+	}
+	code, err := node.LocalCode(a.ctx, peerID)
+	if err != nil {
+		return "", err
+	}
+	return code, a.StartReceiver(code, destPath, fastResume, password)
+}
+
+// discovery returns the node used to find local senders, starting it if needed.
+// It only uses mDNS and is never bootstrapped.
+func (a *App) discovery() (*p2p.Node, error) {
+	a.nodeMu.Lock()
+	defer a.nodeMu.Unlock()
+	if a.discoveryNode == nil {
+		node, err := p2p.NewNodeWithConfig(a.ctx, a.nodeConfig(false))
+		if err != nil {
+			return nil, fmt.Errorf("failed to start local discovery: %w", err)
+		}
+		a.discoveryNode = node
+	}
+	return a.discoveryNode, nil
+}
+
+func (a *App) closeDiscovery() {
+	a.nodeMu.Lock()
+	node := a.discoveryNode
+	a.discoveryNode = nil
+	a.nodeMu.Unlock()
+	if node != nil {
+		node.Close()
+	}
+}
+
+// deviceName is the name local receivers see for this sender
+func (a *App) deviceName() string {
+	if a.settings.DeviceName != "" {
+		return a.settings.DeviceName
+	}
+	if name, err := os.Hostname(); err == nil {
+		return name
+	}
+	return "2c1f"
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"embed"
+	"os"
+	"path/filepath"
 
+	"github.com/ebob10000/2c1f/paths"
 	"github.com/ebob10000/2c1f/version"
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
@@ -15,11 +18,22 @@ import (
 var assets embed.FS
 
 func main() {
+	// Before the app loads its settings and history
+	portable, err := paths.InitPortable(hasFlag("--portable"))
+	if err != nil {
+		println("Error:", err.Error())
+	}
+	var webviewDataPath string
+	if portable {
+		webviewDataPath = filepath.Join(paths.BaseDir(), "webview")
+	}
+
 	// Create an instance of the app structure
 	app := NewApp()
+	app.insecureUpdate = hasFlag("--insecure-update")
 
 	// Create application with options
-	err := wails.Run(&options.App{
+	err = wails.Run(&options.App{
 		Title:  "2c1f",
 		Width:  1024,
 		Height: 768,
@@ -33,6 +47,7 @@ func main() {
 		Windows: &windows.Options{
 			WebviewIsTransparent: false,
 			WindowIsTranslucent:  false,
+			WebviewUserDataPath:  webviewDataPath,
 		},
 		Mac: &mac.Options{
 			TitleBar: &mac.TitleBar{
@@ -53,6 +68,8 @@ func main() {
 		},
 		BackgroundColour: &options.RGBA{R: 9, G: 9, B: 11, A: 255},
 		OnStartup:        app.startup,
+		OnShutdown:       app.shutdown,
+		OnBeforeClose:    app.beforeClose,
 		Bind: []interface{}{
 			app,
 		},
@@ -62,3 +79,13 @@ func main() {
 		println("Error:", err.Error())
 	}
 }
+
+// hasFlag reports whether a bare command line flag was passed
+func hasFlag(name string) bool {
+	for _, arg := range os.Args[1:] {
+		if arg == name {
+			return true
+		}
+	}
+	return false
+}
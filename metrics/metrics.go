@@ -0,0 +1,212 @@
+// Package metrics exposes Prometheus metrics of the long running modes, serve
+// and daemon, for operating 2c1f as shared infrastructure. libp2p registers
+// its own metrics on the same registry, so they are served too, next to the
+// /healthz and /readyz probes of container orchestrators.
+package metrics
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ebob10000/2c1f/p2p"
+	"github.com/ebob10000/2c1f/transfer"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metric names start with this, as they cannot start with a digit
+const namespace = "twoc1f"
+
+var (
+	activeTransfers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_transfers",
+		Help:      "Transfers in progress.",
+	}, []string{"direction"})
+	transfers = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transfers_total",
+		Help:      "Finished transfers by result.",
+	}, []string{"direction", "result"})
+	transferBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transfer_bytes_total",
+		Help:      "File data sent or received.",
+	}, []string{"direction"})
+	retries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "retries_total",
+		Help:      "Reconnections after an interrupted transfer.",
+	}, []string{"direction"})
+	handshakeFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "handshake_failures_total",
+		Help:      "Connections that failed before a transfer started, such as a wrong code or password.",
+	})
+)
+
+// ready is what /readyz reports, see SetReady
+var ready atomic.Bool
+
+var (
+	nodesMu sync.Mutex
+	nodes   = make(map[*p2p.Node]struct{})
+)
+
+func init() {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "dht_peers",
+		Help:      "Peers in the DHT routing tables of the running nodes.",
+	}, func() float64 {
+		return float64(countNodes(func(n *p2p.Node) int {
+			if n.DHT == nil {
+				return 0
+			}
+			return n.DHT.RoutingTable().Size()
+		}))
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "relayed_connections",
+		Help:      "Open connections that go through a relay.",
+	}, func() float64 {
+		return float64(countNodes(func(n *p2p.Node) int {
+			relayed := 0
+			for _, c := range n.Host.Network().Conns() {
+				if p2p.IsRelayedConn(c) {
+					relayed++
+				}
+			}
+			return relayed
+		}))
+	})
+}
+
+func countNodes(count func(n *p2p.Node) int) int {
+	nodesMu.Lock()
+	defer nodesMu.Unlock()
+	total := 0
+	for n := range nodes {
+		total += count(n)
+	}
+	return total
+}
+
+// TrackNode includes n in the DHT and relay metrics until untrack is called
+func TrackNode(n *p2p.Node) (untrack func()) {
+	nodesMu.Lock()
+	nodes[n] = struct{}{}
+	nodesMu.Unlock()
+	return func() {
+		nodesMu.Lock()
+		delete(nodes, n)
+		nodesMu.Unlock()
+	}
+}
+
+// HandshakeFailed counts a connection that failed before its transfer started
+func HandshakeFailed() {
+	handshakeFailures.Inc()
+}
+
+// Transfer counts the metrics of one transfer, from Start to Done
+type Transfer struct {
+	direction string
+	mu        sync.Mutex
+	pos       map[string]int64
+	done      bool
+}
+
+// Start counts a transfer as active. direction is "send" or "receive".
+func Start(direction string) *Transfer {
+	activeTransfers.WithLabelValues(direction).Inc()
+	return &Transfer{direction: direction, pos: make(map[string]int64)}
+}
+
+// Progress counts the bytes moved since the last position of key. It matches
+// the OnProgress callbacks of transfer.Sender and transfer.Receiver.
+func (t *Transfer) Progress(key string, pos, _ int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if delta := pos - t.pos[key]; delta > 0 {
+		transferBytes.WithLabelValues(t.direction).Add(float64(delta))
+	}
+	t.pos[key] = pos
+}
+
+// Retry counts a reconnection
+func (t *Transfer) Retry() {
+	retries.WithLabelValues(t.direction).Inc()
+}
+
+// Done counts the transfer as finished with err. Later calls have no effect.
+func (t *Transfer) Done(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return
+	}
+	t.done = true
+	activeTransfers.WithLabelValues(t.direction).Dec()
+	transfers.WithLabelValues(t.direction, result(err)).Inc()
+}
+
+func result(err error) string {
+	switch {
+	case err == nil:
+		return "complete"
+	case transfer.CategoryOf(err) == transfer.CategoryCancelled:
+		return "cancelled"
+	case transfer.CategoryOf(err) == transfer.CategoryRejected:
+		return "rejected"
+	}
+	return "failed"
+}
+
+// SetReady sets whether /readyz reports the process ready for transfers,
+// such as once its code is advertised. It is not ready until set.
+func SetReady(r bool) {
+	ready.Store(r)
+}
+
+func healthz(w http.ResponseWriter, _ *http.Request) {
+	io.WriteString(w, "ok\n")
+}
+
+func readyz(w http.ResponseWriter, _ *http.Request) {
+	if !ready.Load() {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	io.WriteString(w, "ready\n")
+}
+
+// Listen serves the metrics on addr at /metrics until ctx is cancelled. A
+// liveness probe answers at /healthz and a readiness probe at /readyz, see
+// SetReady.
+func Listen(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", healthz)
+	mux.HandleFunc("/readyz", readyz)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	go server.Serve(ln)
+	return nil
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ebob10000/2c1f/transfer"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+	code, body := get(t, "/metrics")
+	if code != http.StatusOK {
+		t.Fatalf("/metrics status = %d", code)
+	}
+	return body
+}
+
+// get serves the metrics and requests path from them
+func get(t *testing.T, path string) (int, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := Listen(ctx, addr); err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	resp, err := http.Get("http://" + addr + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestProbes(t *testing.T) {
+	if code, _ := get(t, "/healthz"); code != http.StatusOK {
+		t.Errorf("/healthz status = %d, want 200", code)
+	}
+	if code, _ := get(t, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz status before SetReady = %d, want 503", code)
+	}
+	SetReady(true)
+	defer SetReady(false)
+	if code, _ := get(t, "/readyz"); code != http.StatusOK {
+		t.Errorf("/readyz status when ready = %d, want 200", code)
+	}
+}
+
+func TestTransferMetrics(t *testing.T) {
+	tr := Start("send")
+	tr.Progress("a.txt", 100, 300)
+	tr.Progress("a.txt", 300, 300)
+	tr.Progress("b.txt", 50, 50)
+	// A resume from an earlier position counts the data again once it moves
+	tr.Progress("b.txt", 20, 50)
+	tr.Progress("b.txt", 50, 50)
+	tr.Retry()
+
+	body := scrape(t)
+	for _, want := range []string{
+		`twoc1f_active_transfers{direction="send"} 1`,
+		`twoc1f_transfer_bytes_total{direction="send"} 380`,
+		`twoc1f_retries_total{direction="send"} 1`,
+		`twoc1f_dht_peers 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Metrics missing %q", want)
+		}
+	}
+
+	tr.Done(nil)
+	tr.Done(errors.New("ignored"))
+	rejected := Start("receive")
+	rejected.Done(&transfer.Error{Category: transfer.CategoryRejected, Err: errors.New("no")})
+	HandshakeFailed()
+
+	body = scrape(t)
+	for _, want := range []string{
+		`twoc1f_active_transfers{direction="send"} 0`,
+		`twoc1f_transfers_total{direction="send",result="complete"} 1`,
+		`twoc1f_transfers_total{direction="receive",result="rejected"} 1`,
+		`twoc1f_handshake_failures_total 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Metrics missing %q", want)
+		}
+	}
+}
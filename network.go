@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/ebob10000/2c1f/p2p"
+)
+
+// CheckNetwork starts a node with the network settings and reports its
+// addresses and whether the router forwards its ports
+func (a *App) CheckNetwork() (p2p.Stats, error) {
+	ctx, cancel := context.WithTimeout(a.ctx, time.Minute)
+	defer cancel()
+	stats, err := p2p.CheckNetwork(ctx, a.nodeConfig(true), 10*time.Second)
+	if err != nil && stats.Addrs == nil {
+		// The fixed port may be taken by a running transfer
+		stats, err = p2p.CheckNetwork(ctx, a.nodeConfig(false), 10*time.Second)
+	}
+	return stats, err
+}
+
+// PreflightNetwork checks that a send would be found before its code is
+// shown: it starts a node, bootstraps and advertises a test code, emitting
+// "network_stage" events as StartSender does. It returns once the code was
+// published, or why it could not be.
+func (a *App) PreflightNetwork() error {
+	ctx, cancel := context.WithTimeout(a.ctx, time.Minute)
+	defer cancel()
+
+	a.emitStage(p2p.StageStarting)
+	// A random port, the fixed one may be taken by a running transfer
+	node, err := p2p.NewNodeWithConfig(ctx, a.nodeConfig(false))
+	if err != nil {
+		return err
+	}
+	defer node.Close()
+	a.configureNode(node)
+	return node.Preflight(a.emitStage)
+}
+
+// emitStage tells the frontend how far a node got towards being found by its
+// code, one of the p2p.Stage constants
+func (a *App) emitStage(stage string) {
+	a.events.Emit("network_stage", stage)
+}
+
+// watchConnections tells the frontend about each attempt to connect to a
+// peer, so it can show how the connection is set up
+func (a *App) watchConnections(node *p2p.Node) {
+	node.SetConnectHandler(func(attempt p2p.ConnectAttempt) {
+		a.events.Emit("peer_connect_attempt", attempt)
+	})
+}
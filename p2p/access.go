@@ -0,0 +1,178 @@
+package p2p
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// AccessList limits the peers a node transfers with. Entries are peer IDs,
+// IP addresses or CIDR ranges such as 192.168.1.0/24.
+type AccessList struct {
+	Allow []string // Only these peers may connect, anyone if empty
+	Deny  []string // These peers are refused, even if allowed
+}
+
+// ParseAccessList splits comma separated allow and deny entries as stored in
+// the settings
+func ParseAccessList(allow, deny string) AccessList {
+	return AccessList{Allow: splitList(allow), Deny: splitList(deny)}
+}
+
+func splitList(s string) []string {
+	var entries []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// accessRules is a parsed allow or deny list
+type accessRules struct {
+	peers map[peer.ID]bool
+	nets  []*net.IPNet
+}
+
+func parseRules(entries []string) (accessRules, error) {
+	r := accessRules{peers: make(map[peer.ID]bool)}
+	for _, e := range entries {
+		if ip := net.ParseIP(e); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			r.nets = append(r.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(e); err == nil {
+			r.nets = append(r.nets, ipNet)
+			continue
+		}
+		id, err := peer.Decode(e)
+		if err != nil {
+			return accessRules{}, fmt.Errorf("invalid access list entry %q: not a peer ID, IP address or CIDR range", e)
+		}
+		r.peers[id] = true
+	}
+	return r, nil
+}
+
+func (r accessRules) empty() bool {
+	return len(r.peers) == 0 && len(r.nets) == 0
+}
+
+func (r accessRules) matchIP(ip net.IP) bool {
+	for _, n := range r.nets {
+		if ip != nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// accessGater enforces an AccessList on connections. Allow only applies to
+// inbound connections, as outbound ones also reach the DHT and relays;
+// FindPeer and DialPeer check it for the peers they connect to instead.
+type accessGater struct {
+	allow, deny accessRules
+}
+
+var _ connmgr.ConnectionGater = (*accessGater)(nil)
+
+func newAccessGater(list AccessList) (*accessGater, error) {
+	allow, err := parseRules(list.Allow)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := parseRules(list.Deny)
+	if err != nil {
+		return nil, err
+	}
+	if allow.empty() && deny.empty() {
+		return nil, nil
+	}
+	return &accessGater{allow: allow, deny: deny}, nil
+}
+
+// remoteIP returns the IP of a direct connection's peer. Relayed
+// connections only show the relay's.
+func remoteIP(addr multiaddr.Multiaddr) net.IP {
+	if addr == nil || isRelayedAddr(addr) {
+		return nil
+	}
+	ip, err := manet.ToIP(addr)
+	if err != nil {
+		return nil
+	}
+	return ip
+}
+
+func (g *accessGater) denied(p peer.ID, ip net.IP) bool {
+	return g.deny.peers[p] || g.deny.matchIP(ip)
+}
+
+// permits reports whether the peer p connecting from addr may transfer
+func (g *accessGater) permits(p peer.ID, addr multiaddr.Multiaddr) bool {
+	if g == nil {
+		return true
+	}
+	ip := remoteIP(addr)
+	if g.denied(p, ip) {
+		return false
+	}
+	return g.allow.empty() || g.allow.peers[p] || g.allow.matchIP(ip)
+}
+
+func (g *accessGater) InterceptPeerDial(p peer.ID) bool {
+	return !g.deny.peers[p]
+}
+
+func (g *accessGater) InterceptAddrDial(p peer.ID, addr multiaddr.Multiaddr) bool {
+	return !g.denied(p, remoteIP(addr))
+}
+
+func (g *accessGater) InterceptAccept(addrs network.ConnMultiaddrs) bool {
+	return !g.deny.matchIP(remoteIP(addrs.RemoteMultiaddr()))
+}
+
+func (g *accessGater) InterceptSecured(dir network.Direction, p peer.ID, addrs network.ConnMultiaddrs) bool {
+	if dir == network.DirInbound {
+		return g.permits(p, addrs.RemoteMultiaddr())
+	}
+	return !g.denied(p, remoteIP(addrs.RemoteMultiaddr()))
+}
+
+func (g *accessGater) InterceptUpgraded(network.Conn) (bool, control.DisconnectReason) {
+	return true, 0
+}
+
+// permitted reports whether the access list lets the node transfer with p
+// over one of its open connections
+func (n *Node) permitted(p peer.ID) bool {
+	if n.access == nil {
+		return true
+	}
+	for _, c := range n.Host.Network().ConnsToPeer(p) {
+		if n.access.permits(p, c.RemoteMultiaddr()) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPermitted is permitted as an error for the callers of Connect
+func (n *Node) checkPermitted(p peer.ID) error {
+	if !n.permitted(p) {
+		return fmt.Errorf("peer %s is not on the access list", p.ShortString())
+	}
+	return nil
+}
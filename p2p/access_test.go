@@ -0,0 +1,96 @@
+package p2p
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+func TestAccessGater(t *testing.T) {
+	known, _ := peer.Decode("QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN")
+	other, _ := peer.Decode("QmQCU2EcMqAqQPR2i9bChDtGNJchTbq5TbXJJ16u19uLTa")
+	lan := multiaddr.StringCast("/ip4/192.168.1.5/tcp/4001")
+	wan := multiaddr.StringCast("/ip4/203.0.113.7/tcp/4001")
+	relayed := multiaddr.StringCast("/ip4/192.168.1.5/tcp/4001/p2p/12D3KooWGRUVh9ki6WAVyDhVz6UdZWZBpbhoX3rYNxafXnS8bkk9/p2p-circuit")
+
+	g, err := newAccessGater(AccessList{Allow: []string{known.String(), "192.168.1.0/24"}, Deny: []string{"192.168.1.66"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		p    peer.ID
+		addr multiaddr.Multiaddr
+		want bool
+	}{
+		{known, wan, true},
+		{other, lan, true},
+		{other, wan, false},
+		// A relay's address says nothing about the peer behind it
+		{other, relayed, false},
+		{known, relayed, true},
+		{known, multiaddr.StringCast("/ip4/192.168.1.66/tcp/4001"), false},
+	}
+	for _, tt := range tests {
+		if got := g.permits(tt.p, tt.addr); got != tt.want {
+			t.Errorf("permits(%s, %s) = %v, want %v", tt.p, tt.addr, got, tt.want)
+		}
+	}
+
+	var none *accessGater
+	if !none.permits(other, wan) {
+		t.Error("Node without access list refused a peer")
+	}
+}
+
+func TestParseAccessList(t *testing.T) {
+	list := ParseAccessList(" 10.0.0.0/8, ,fd00::1", "")
+	if len(list.Allow) != 2 || list.Allow[0] != "10.0.0.0/8" || list.Allow[1] != "fd00::1" || list.Deny != nil {
+		t.Errorf("ParseAccessList() = %+v", list)
+	}
+	if g, err := newAccessGater(list); err != nil || len(g.allow.nets) != 2 {
+		t.Errorf("newAccessGater(%+v) = %+v, %v", list, g, err)
+	}
+	if g, err := newAccessGater(AccessList{}); g != nil || err != nil {
+		t.Errorf("newAccessGater() without entries = %+v, %v, want no gater", g, err)
+	}
+	if _, err := newAccessGater(AccessList{Deny: []string{"laptop"}}); err == nil {
+		t.Error("newAccessGater() accepted an invalid entry")
+	}
+}
+
+func TestAccessListConnect(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	allowed, stranger := newTCPNode(t, ctx), newTCPNode(t, ctx)
+	node, err := NewNodeWithConfig(ctx, Config{
+		Listen: []string{"/ip4/127.0.0.1/tcp/0"},
+		Access: AccessList{Allow: []string{allowed.Host.ID().String()}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+
+	info := peer.AddrInfo{ID: node.Host.ID(), Addrs: node.Host.Addrs()}
+	if err := allowed.Host.Connect(ctx, info); err != nil {
+		t.Errorf("Allowed peer failed to connect: %v", err)
+	}
+	// The stranger may see its side of the handshake succeed, but the node
+	// drops the connection
+	stranger.Host.Connect(ctx, info)
+	if len(node.Host.Network().ConnsToPeer(stranger.Host.ID())) > 0 {
+		t.Error("Peer that is not on the allow list connected")
+	}
+
+	// Outgoing connections work, but not for transfers
+	if err := node.Host.Connect(ctx, peer.AddrInfo{ID: stranger.Host.ID(), Addrs: stranger.Host.Addrs()}); err != nil {
+		t.Fatalf("Outgoing connection failed: %v", err)
+	}
+	if node.permitted(stranger.Host.ID()) || !node.permitted(allowed.Host.ID()) {
+		t.Error("permitted() does not follow the allow list")
+	}
+}
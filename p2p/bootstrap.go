@@ -0,0 +1,139 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/discovery/routing"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// DefaultBootstrapBackoff is the wait before trying the second bootstrap
+// set, doubled for each one after it
+const DefaultBootstrapBackoff = 2 * time.Second
+
+// IPFSBootstrapPeers are the bootstrap peers of IPFS that are not in
+// BootstrapPeers, reachable by IP when DNS is not
+var IPFSBootstrapPeers = []string{
+	"/ip4/104.131.131.82/tcp/4001/p2p/QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ",
+	"/ip4/104.131.131.82/udp/4001/quic-v1/p2p/QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ",
+}
+
+// Names of the bootstrap sets
+const (
+	BootstrapCustom = "custom" // Config.Bootstrap
+	BootstrapLibp2p = "libp2p" // BootstrapPeers
+	BootstrapIPFS   = "ipfs"   // IPFSBootstrapPeers
+)
+
+// BootstrapSet is a group of bootstrap peers that are tried together
+type BootstrapSet struct {
+	Name  string
+	Peers []string
+}
+
+// bootstrapSets returns the sets Bootstrap tries in order. Configured peers
+// replace the public ones, so a private network never reaches out to them.
+func (n *Node) bootstrapSets() []BootstrapSet {
+	if len(n.bootstrap) > 0 {
+		return []BootstrapSet{{BootstrapCustom, n.bootstrap}}
+	}
+	return []BootstrapSet{
+		{BootstrapLibp2p, BootstrapPeers},
+		{BootstrapIPFS, IPFSBootstrapPeers},
+	}
+}
+
+// Bootstrap connects to the peers of the first bootstrap set that has one
+// reachable, waiting longer before each next set. OnBootstrap, if set, is
+// called after each set was tried, and BootstrapSetName returns the set
+// that worked.
+func (n *Node) Bootstrap() error {
+	if err := n.DHT.Bootstrap(n.Ctx); err != nil {
+		return fmt.Errorf("failed to bootstrap DHT: %w", err)
+	}
+
+	sets := n.bootstrapSets()
+	backoff := n.bootstrapBackoff()
+	var tried []string
+	for i, set := range sets {
+		if i > 0 {
+			select {
+			case <-n.Ctx.Done():
+				return n.Ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		err := n.connectBootstrap(set.Peers)
+		if n.OnBootstrap != nil {
+			n.OnBootstrap(set.Name, err)
+		}
+		if err == nil {
+			n.mu.Lock()
+			n.bootstrapSet = set.Name
+			n.mu.Unlock()
+			n.Discovery = routing.NewRoutingDiscovery(n.DHT)
+			return nil
+		}
+		tried = append(tried, set.Name)
+	}
+	return fmt.Errorf("failed to connect to any bootstrap peers, tried the %s sets", strings.Join(tried, ", "))
+}
+
+// BootstrapSetName returns the name of the bootstrap set the node is
+// connected through, empty before Bootstrap succeeded
+func (n *Node) BootstrapSetName() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.bootstrapSet
+}
+
+// connectBootstrap connects to the peers in parallel, failing if none could
+// be reached
+func (n *Node) connectBootstrap(peers []string) error {
+	var wg sync.WaitGroup
+	connected := 0
+	var connMu sync.Mutex
+
+	for _, peerAddr := range peers {
+		maddr, err := multiaddr.NewMultiaddr(peerAddr)
+		if err != nil {
+			continue
+		}
+		peerInfo, err := peer.AddrInfoFromP2pAddr(maddr)
+		if err != nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func(pi peer.AddrInfo) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(n.Ctx, n.bootstrapTimeout())
+			defer cancel()
+			if err := n.Host.Connect(ctx, pi); err == nil {
+				connMu.Lock()
+				connected++
+				connMu.Unlock()
+			}
+		}(*peerInfo)
+	}
+
+	wg.Wait()
+
+	if connected == 0 {
+		return fmt.Errorf("none of %d peers answered", len(peers))
+	}
+	return nil
+}
+
+func (n *Node) bootstrapBackoff() time.Duration {
+	if n.BootstrapBackoff <= 0 {
+		return DefaultBootstrapBackoff
+	}
+	return n.BootstrapBackoff
+}
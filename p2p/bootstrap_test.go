@@ -0,0 +1,121 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBootstrapSets(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	boot := newLocalNode(t, ctx)
+	addr := fmt.Sprintf("%s/p2p/%s", boot.Host.Addrs()[0], boot.Host.ID())
+	node, err := NewNodeWithConfig(ctx, Config{Listen: []string{"/ip4/127.0.0.1/tcp/0"}, NoPortMap: true, Bootstrap: []string{addr}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+
+	var names []string
+	for _, set := range node.bootstrapSets() {
+		names = append(names, set.Name)
+	}
+	if want := []string{BootstrapCustom}; !reflect.DeepEqual(names, want) {
+		t.Errorf("bootstrap sets = %v, want %v", names, want)
+	}
+
+	// The IPFS set is the fallback for when DNS is blocked
+	for _, addr := range IPFSBootstrapPeers {
+		if !strings.HasPrefix(addr, "/ip4/") && !strings.HasPrefix(addr, "/ip6/") {
+			t.Errorf("IPFSBootstrapPeers has %s, which needs DNS", addr)
+		}
+	}
+
+	var tried []string
+	node.OnBootstrap = func(set string, err error) {
+		tried = append(tried, fmt.Sprintf("%s %t", set, err == nil))
+	}
+	if err := node.Bootstrap(); err != nil {
+		t.Fatalf("Bootstrap() error = %v", err)
+	}
+	if want := []string{"custom true"}; !reflect.DeepEqual(tried, want) {
+		t.Errorf("tried %v, want %v", tried, want)
+	}
+	if got := node.BootstrapSetName(); got != BootstrapCustom {
+		t.Errorf("BootstrapSetName() = %q, want %q", got, BootstrapCustom)
+	}
+}
+
+func TestBootstrapFallback(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	// The public sets point to a local peer and a gone one
+	boot := newLocalNode(t, ctx)
+	gone := newLocalNode(t, ctx)
+	goneAddr := fmt.Sprintf("%s/p2p/%s", gone.Host.Addrs()[0], gone.Host.ID())
+	gone.Close()
+	defer func(libp2p, ipfs []string) { BootstrapPeers, IPFSBootstrapPeers = libp2p, ipfs }(BootstrapPeers, IPFSBootstrapPeers)
+	BootstrapPeers = []string{goneAddr}
+	IPFSBootstrapPeers = []string{fmt.Sprintf("%s/p2p/%s", boot.Host.Addrs()[0], boot.Host.ID())}
+
+	node, err := NewNodeWithConfig(ctx, Config{Listen: []string{"/ip4/127.0.0.1/tcp/0"}, NoPortMap: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+	node.BootstrapTimeout = time.Second
+	node.BootstrapBackoff = time.Millisecond
+	var tried []string
+	node.OnBootstrap = func(set string, err error) {
+		tried = append(tried, fmt.Sprintf("%s %t", set, err == nil))
+	}
+
+	if err := node.Bootstrap(); err != nil {
+		t.Fatalf("Bootstrap() error = %v", err)
+	}
+	if want := []string{"libp2p false", "ipfs true"}; !reflect.DeepEqual(tried, want) {
+		t.Errorf("tried %v, want %v", tried, want)
+	}
+	if got := node.BootstrapSetName(); got != BootstrapIPFS {
+		t.Errorf("BootstrapSetName() = %q, want %q", got, BootstrapIPFS)
+	}
+
+	// All sets failing is an error
+	IPFSBootstrapPeers = []string{goneAddr}
+	other, err := NewNodeWithConfig(ctx, Config{Listen: []string{"/ip4/127.0.0.1/tcp/0"}, NoPortMap: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	other.BootstrapTimeout = time.Second
+	other.BootstrapBackoff = time.Millisecond
+	if err := other.Bootstrap(); err == nil {
+		t.Error("Bootstrap() succeeded without a reachable peer")
+	}
+
+	// Configured peers do not fall back to the public sets
+	IPFSBootstrapPeers = []string{fmt.Sprintf("%s/p2p/%s", boot.Host.Addrs()[0], boot.Host.ID())}
+	private, err := NewNodeWithConfig(ctx, Config{Listen: []string{"/ip4/127.0.0.1/tcp/0"}, NoPortMap: true, Bootstrap: []string{goneAddr}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer private.Close()
+	private.BootstrapTimeout = time.Second
+	private.BootstrapBackoff = time.Millisecond
+	tried = nil
+	private.OnBootstrap = func(set string, err error) {
+		tried = append(tried, fmt.Sprintf("%s %t", set, err == nil))
+	}
+	if err := private.Bootstrap(); err == nil {
+		t.Error("Bootstrap() fell back to the public peers")
+	}
+	if want := []string{"custom false"}; !reflect.DeepEqual(tried, want) {
+		t.Errorf("tried %v, want %v", tried, want)
+	}
+}
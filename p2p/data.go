@@ -0,0 +1,116 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// DataProtocolID carries the file data of a transfer next to its stream on
+// ProtocolID, which keeps control messages free of queued data. The stream
+// starts with the token of the transfer it belongs to, so two transfers
+// with the same peer do not take each other's data.
+const DataProtocolID = "/2c1f/data/2.0.0"
+
+// DataTokenSize is the length of the token that starts a data stream
+const DataTokenSize = 16
+
+// dataStreamWait is how long an opened data stream waits for the transfer
+// that takes it
+const dataStreamWait = time.Minute
+
+// dataKey identifies the transfer a data stream belongs to
+type dataKey struct {
+	peer  peer.ID
+	token string
+}
+
+// handleDataStream reads the token of a data stream and passes it to the
+// AcceptDataStream waiting for it, or resets it if no transfer with the
+// peer takes it in time
+func (n *Node) handleDataStream(s network.Stream) {
+	token := make([]byte, DataTokenSize)
+	s.SetReadDeadline(time.Now().Add(dataStreamWait))
+	if _, err := io.ReadFull(s, token); err != nil {
+		s.Reset()
+		return
+	}
+	s.SetReadDeadline(time.Time{})
+
+	key := dataKey{s.Conn().RemotePeer(), string(token)}
+	ch := n.dataStreams(key)
+	defer n.dropDataStreams(key, ch)
+	select {
+	case ch <- s:
+	case <-time.After(dataStreamWait):
+		s.Reset()
+	case <-n.Ctx.Done():
+		s.Reset()
+	}
+}
+
+func (n *Node) dataStreams(key dataKey) chan network.Stream {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.data == nil {
+		n.data = make(map[dataKey]chan network.Stream)
+	}
+	ch, ok := n.data[key]
+	if !ok {
+		ch = make(chan network.Stream)
+		n.data[key] = ch
+	}
+	return ch
+}
+
+// dropDataStreams forgets the channel of key once either side is done
+// with it
+func (n *Node) dropDataStreams(key dataKey, ch chan network.Stream) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.data[key] == ch {
+		delete(n.data, key)
+	}
+}
+
+// AcceptDataStream waits for the data stream p opens with token for the
+// transfer on the stream it opened before
+func (n *Node) AcceptDataStream(ctx context.Context, p peer.ID, token []byte) (network.Stream, error) {
+	if len(token) != DataTokenSize {
+		return nil, fmt.Errorf("invalid data stream token of %d bytes", len(token))
+	}
+	key := dataKey{p, string(token)}
+	ch := n.dataStreams(key)
+	defer n.dropDataStreams(key, ch)
+	select {
+	case s := <-ch:
+		return s, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// NewDataStream opens a data stream with token for the transfer with p
+func (n *Node) NewDataStream(ctx context.Context, p peer.ID, token []byte) (network.Stream, error) {
+	if len(token) != DataTokenSize {
+		return nil, fmt.Errorf("invalid data stream token of %d bytes", len(token))
+	}
+	s, err := n.Host.NewStream(ctx, p, protocol.ID(DataProtocolID))
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		s.SetWriteDeadline(deadline)
+	}
+	if _, err := s.Write(token); err != nil {
+		s.Reset()
+		return nil, err
+	}
+	s.SetWriteDeadline(time.Time{})
+	return s, nil
+}
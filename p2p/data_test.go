@@ -0,0 +1,58 @@
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestDataStream(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sender, receiver := newTCPNode(t, ctx), newTCPNode(t, ctx)
+	sender.SetStreamHandler(func(s network.Stream) { s.Close() })
+	if err := receiver.Host.Connect(ctx, peer.AddrInfo{ID: sender.Host.ID(), Addrs: sender.Host.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two transfers with the same peer each get their own stream
+	tokens := [][]byte{bytes.Repeat([]byte{1}, DataTokenSize), bytes.Repeat([]byte{2}, DataTokenSize)}
+	for i, token := range tokens {
+		go func() {
+			s, err := receiver.NewDataStream(ctx, sender.Host.ID(), token)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(s, "data %d", i)
+			s.Close()
+		}()
+	}
+
+	for i := len(tokens) - 1; i >= 0; i-- {
+		s, err := sender.AcceptDataStream(ctx, receiver.Host.ID(), tokens[i])
+		if err != nil {
+			t.Fatalf("AcceptDataStream() error = %v", err)
+		}
+		got, _ := io.ReadAll(s)
+		if want := fmt.Sprintf("data %d", i); string(got) != want {
+			t.Errorf("Read %q from the data stream of transfer %d, want %q", got, i, want)
+		}
+	}
+
+	// Streams of other peers are not handed out
+	short, cancelShort := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancelShort()
+	if _, err := sender.AcceptDataStream(short, sender.Host.ID(), tokens[0]); err == nil {
+		t.Error("AcceptDataStream() returned a stream nobody opened")
+	}
+	if _, err := sender.AcceptDataStream(ctx, receiver.Host.ID(), []byte("short")); err == nil {
+		t.Error("AcceptDataStream() took a token of the wrong size")
+	}
+}
@@ -0,0 +1,38 @@
+package p2p
+
+import (
+	"errors"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// duplicateWindow is how long FindPeer keeps looking for other peers with
+// the same code after reaching the first one
+const duplicateWindow = 2 * time.Second
+
+// ErrDuplicatePeers is returned by FindPeer when more than one peer
+// advertises the code and the node has no ChoosePeer
+var ErrDuplicatePeers = errors.New("more than one peer advertises this code")
+
+// pickPeer returns the peer to use among the reachable ones FindPeer found.
+// The peer found before wins again, so reconnects stay with the same
+// sender. Otherwise several peers mean that two senders picked the same
+// code, and ChoosePeer decides which one is meant.
+func (n *Node) pickPeer(found []peer.AddrInfo) (peer.ID, error) {
+	if len(found) == 1 {
+		return found[0].ID, nil
+	}
+	n.mu.Lock()
+	connected := n.ConnectedPeer
+	n.mu.Unlock()
+	for _, p := range found {
+		if p.ID == connected {
+			return p.ID, nil
+		}
+	}
+	if n.ChoosePeer == nil {
+		return "", ErrDuplicatePeers
+	}
+	return n.ChoosePeer(found)
+}
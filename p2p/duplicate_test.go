@@ -0,0 +1,37 @@
+package p2p
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestPickPeer(t *testing.T) {
+	a, b := newTestPeerID(t), newTestPeerID(t)
+	found := []peer.AddrInfo{{ID: a}, {ID: b}}
+
+	n := &Node{}
+	if id, err := n.pickPeer(found[:1]); err != nil || id != a {
+		t.Errorf("Single peer: got %s, %v", id, err)
+	}
+	if _, err := n.pickPeer(found); !errors.Is(err, ErrDuplicatePeers) {
+		t.Errorf("Two peers without ChoosePeer: err = %v, want ErrDuplicatePeers", err)
+	}
+
+	var offered []peer.AddrInfo
+	n.ChoosePeer = func(candidates []peer.AddrInfo) (peer.ID, error) {
+		offered = candidates
+		return b, nil
+	}
+	if id, err := n.pickPeer(found); err != nil || id != b || len(offered) != 2 {
+		t.Errorf("Two peers: got %s, %v after offering %d", id, err, len(offered))
+	}
+
+	// A reconnect stays with the peer found before without asking
+	offered = nil
+	n.ConnectedPeer = a
+	if id, err := n.pickPeer(found); err != nil || id != a || offered != nil {
+		t.Errorf("Reconnect: got %s, %v, asked = %v", id, err, offered != nil)
+	}
+}
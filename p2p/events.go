@@ -0,0 +1,198 @@
+package p2p
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/holepunch"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// Transports of ConnectAttempt
+const (
+	TransportTCP          = "tcp"
+	TransportQUIC         = "quic"
+	TransportWebTransport = "webtransport"
+	TransportWebSocket    = "websocket"
+	TransportWebRTC       = "webrtc"
+	TransportRelay        = "relay"
+	TransportHolePunch    = "holepunch" // A direct connection through both NATs
+)
+
+// ConnectAttempt is an attempt to connect to a peer or a connection a peer
+// opened, so the connection can be shown as it is set up
+type ConnectAttempt struct {
+	Peer      string `json:"peer"`
+	Transport string `json:"transport"` // Transports tried, separated by commas if it failed
+	Inbound   bool   `json:"inbound"`   // The peer connected to this node
+	Success   bool   `json:"success"`
+	Error     string `json:"error,omitempty"`
+}
+
+// SetConnectHandler sets a function called after each attempt to connect to
+// a peer found by FindPeer or mDNS, for each connection another peer opens
+// and after each attempt to punch a hole to a peer behind a NAT
+func (n *Node) SetConnectHandler(f func(a ConnectAttempt)) {
+	n.mu.Lock()
+	n.onConnect = f
+	n.mu.Unlock()
+}
+
+func (n *Node) connectAttempt(a ConnectAttempt) {
+	n.mu.Lock()
+	f := n.onConnect
+	n.mu.Unlock()
+	if f != nil {
+		f(a)
+	}
+}
+
+// watchConnections reports the connections peers open
+func (n *Node) watchConnections() {
+	n.Host.Network().Notify(&network.NotifyBundle{
+		ConnectedF: func(_ network.Network, c network.Conn) {
+			if c.Stat().Direction != network.DirInbound {
+				return
+			}
+			n.connectAttempt(ConnectAttempt{
+				Peer:      c.RemotePeer().String(),
+				Transport: Transport(c.RemoteMultiaddr()),
+				Inbound:   true,
+				Success:   true,
+			})
+		},
+	})
+}
+
+// dialAttempt describes the outcome of connecting to pi
+func (n *Node) dialAttempt(pi peer.AddrInfo, err error) ConnectAttempt {
+	a := ConnectAttempt{Peer: pi.ID.String(), Success: err == nil}
+	if err != nil {
+		a.Error = err.Error()
+		a.Transport = transports(pi.Addrs)
+		return a
+	}
+	var addrs []multiaddr.Multiaddr
+	for _, c := range n.Host.Network().ConnsToPeer(pi.ID) {
+		addrs = append(addrs, c.RemoteMultiaddr())
+	}
+	a.Transport = transports(addrs)
+	return a
+}
+
+// holePunchTracer reports the outcome of hole punching, see
+// holepunch.WithTracer
+type holePunchTracer struct {
+	node func() *Node // Nil until the node is created
+}
+
+func (t holePunchTracer) Trace(evt *holepunch.Event) {
+	end, ok := evt.Evt.(*holepunch.EndHolePunchEvt)
+	n := t.node()
+	if !ok || n == nil {
+		return
+	}
+	n.connectAttempt(ConnectAttempt{
+		Peer:      evt.Remote.String(),
+		Transport: TransportHolePunch,
+		Success:   end.Success,
+		Error:     end.Error,
+	})
+}
+
+// Transport names the transport of addr, such as TransportQUIC
+func Transport(addr multiaddr.Multiaddr) string {
+	if isRelayedAddr(addr) {
+		return TransportRelay
+	}
+	// Transports over QUIC or TCP first
+	for _, t := range []struct {
+		code int
+		name string
+	}{
+		{multiaddr.P_WEBTRANSPORT, TransportWebTransport},
+		{multiaddr.P_WEBRTC_DIRECT, TransportWebRTC},
+		{multiaddr.P_QUIC_V1, TransportQUIC},
+		{multiaddr.P_WS, TransportWebSocket},
+		{multiaddr.P_WSS, TransportWebSocket},
+		{multiaddr.P_TCP, TransportTCP},
+	} {
+		if _, err := addr.ValueForProtocol(t.code); err == nil {
+			return t.name
+		}
+	}
+	return "unknown"
+}
+
+// transports lists the transports of addrs without duplicates
+func transports(addrs []multiaddr.Multiaddr) string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, addr := range addrs {
+		if name := Transport(addr); !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// PublicAddrs returns the addresses of the node peers on the internet can
+// reach, including those through a relay
+func (n *Node) PublicAddrs() []string {
+	addrs := []string{}
+	for _, addr := range n.Host.Addrs() {
+		if manet.IsPublicAddr(addr) {
+			addrs = append(addrs, addr.String())
+		}
+	}
+	return addrs
+}
+
+// WatchAddrs calls f with PublicAddrs once NAT detection found out whether
+// the node is reachable, and again each time they change, until the node is
+// closed
+func (n *Node) WatchAddrs(f func(addrs []string)) error {
+	sub, err := n.Host.EventBus().Subscribe([]interface{}{
+		new(event.EvtLocalReachabilityChanged),
+		new(event.EvtLocalAddressesUpdated),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch addresses: %w", err)
+	}
+	go func() {
+		defer sub.Close()
+		detected := false
+		reported := false
+		var last string
+		for {
+			select {
+			case <-n.Ctx.Done():
+				return
+			case e, ok := <-sub.Out():
+				if !ok {
+					return
+				}
+				if r, ok := e.(event.EvtLocalReachabilityChanged); ok && r.Reachability != network.ReachabilityUnknown {
+					detected = true
+				}
+			}
+			if !detected {
+				continue
+			}
+			addrs := n.PublicAddrs()
+			if key := strings.Join(addrs, " "); !reported || key != last {
+				reported = true
+				last = key
+				f(addrs)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,110 @@
+package p2p
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+const relayPeer = "QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN"
+
+func TestTransport(t *testing.T) {
+	tests := map[string]string{
+		"/ip4/1.2.3.4/tcp/4001":                                   TransportTCP,
+		"/ip4/1.2.3.4/udp/4001/quic-v1":                           TransportQUIC,
+		"/ip4/1.2.3.4/udp/4001/quic-v1/webtransport":              TransportWebTransport,
+		"/ip4/1.2.3.4/tcp/443/ws":                                 TransportWebSocket,
+		"/ip4/1.2.3.4/tcp/4001/p2p/" + relayPeer + "/p2p-circuit": TransportRelay,
+	}
+	for addr, want := range tests {
+		if got := Transport(multiaddr.StringCast(addr)); got != want {
+			t.Errorf("Transport(%s) = %q, want %q", addr, got, want)
+		}
+	}
+}
+func TestConnectAttempts(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	a := newLocalNode(t, ctx)
+	b := newLocalNode(t, ctx)
+	aIn, aOut := attemptsWith(a, b.Host.ID())
+	bIn, _ := attemptsWith(b, a.Host.ID())
+
+	a.HandlePeerFound(peer.AddrInfo{ID: b.Host.ID(), Addrs: b.Host.Addrs()})
+	want := ConnectAttempt{Peer: b.Host.ID().String(), Transport: TransportTCP, Success: true}
+	if got := <-aOut; got != want {
+		t.Errorf("outbound attempt = %+v, want %+v", got, want)
+	}
+	// mDNS may have connected the nodes the other way first
+	select {
+	case got := <-bIn:
+		want := ConnectAttempt{Peer: a.Host.ID().String(), Transport: TransportTCP, Inbound: true, Success: true}
+		if got != want {
+			t.Errorf("inbound attempt = %+v, want %+v", got, want)
+		}
+	case <-aIn:
+	case <-ctx.Done():
+		t.Fatal("no inbound attempt reported")
+	}
+
+	// A peer that is gone fails
+	addrs := b.Host.Addrs()
+	id := b.Host.ID()
+	b.Close()
+	a.Host.Network().ClosePeer(id)
+	a.Host.Peerstore().ClearAddrs(id)
+	a.HandlePeerFound(peer.AddrInfo{ID: id, Addrs: addrs})
+	for got := range aOut {
+		if got.Success {
+			continue
+		}
+		if got.Error == "" || got.Transport != TransportTCP {
+			t.Errorf("attempt to a closed peer = %+v, want a failed tcp attempt", got)
+		}
+		break
+	}
+}
+
+// attemptsWith returns the inbound and outbound connect attempts of n
+// involving p
+func attemptsWith(n *Node, p peer.ID) (in, out <-chan ConnectAttempt) {
+	inbound := make(chan ConnectAttempt, 16)
+	outbound := make(chan ConnectAttempt, 16)
+	n.SetConnectHandler(func(a ConnectAttempt) {
+		if a.Peer != p.String() {
+			return
+		}
+		ch := outbound
+		if a.Inbound {
+			ch = inbound
+		}
+		select {
+		case ch <- a:
+		default:
+		}
+	})
+	return inbound, outbound
+}
+
+// newLocalNode creates a node set up like real ones, on loopback TCP
+func newLocalNode(t *testing.T, ctx context.Context) *Node {
+	t.Helper()
+	n, err := NewNodeWithConfig(ctx, Config{Listen: []string{"/ip4/127.0.0.1/tcp/0"}, NoPortMap: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { n.Close() })
+	return n
+}
+
+func TestPublicAddrs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// Loopback addresses are not reachable from the internet
+	if addrs := newLocalNode(t, ctx).PublicAddrs(); len(addrs) != 0 {
+		t.Errorf("PublicAddrs() = %v, want none", addrs)
+	}
+}
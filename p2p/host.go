@@ -4,17 +4,24 @@ import (
 	"context"
 	"crypto/sha256"
 	"fmt"
+	"net"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/libp2p/go-libp2p"
 	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/protocol"
 	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
 	"github.com/libp2p/go-libp2p/p2p/discovery/routing"
+	basichost "github.com/libp2p/go-libp2p/p2p/host/basic"
+	"github.com/libp2p/go-libp2p/p2p/protocol/holepunch"
 	"github.com/libp2p/go-libp2p/p2p/security/noise"
 	libp2ptls "github.com/libp2p/go-libp2p/p2p/security/tls"
 	"github.com/multiformats/go-multiaddr"
@@ -25,6 +32,9 @@ const (
 	RendezvousNS    = "2c1f-rendezvous"
 	DiscoveryPeriod = 10 * time.Second
 	MDNSServiceTag  = "2c1f-local"
+
+	DefaultBootstrapTimeout = 30 * time.Second
+	DefaultFindTimeout      = 30 * time.Second
 )
 
 var BootstrapPeers = []string{
@@ -32,6 +42,7 @@ var BootstrapPeers = []string{
 	"/dnsaddr/bootstrap.libp2p.io/p2p/QmQCU2EcMqAqQPR2i9bChDtGNJchTbq5TbXJJ16u19uLTa",
 	"/dnsaddr/bootstrap.libp2p.io/p2p/QmbLHAnMoJPWSCR5Zhtx6BHJX9KiKNN6tpvbUcqanj75Nb",
 	"/dnsaddr/bootstrap.libp2p.io/p2p/QmcZf59bWwK5XFi76CZX8cbJ4BhTzzA3gU1ZjYZcYW3dwt",
+	"/dnsaddr/va1.bootstrap.libp2p.io/p2p/12D3KooWKnDdG3iXw9eTFijk3EWSunZcFi54Zka4wmtqtt6rPxc8",
 }
 
 type Node struct {
@@ -41,27 +52,190 @@ type Node struct {
 	Cancel        context.CancelFunc
 	Discovery     *routing.RoutingDiscovery
 	ConnectedPeer peer.ID
-	mu            sync.Mutex
+	// BootstrapTimeout bounds each bootstrap peer connection attempt
+	BootstrapTimeout time.Duration
+	// BootstrapBackoff is the wait before trying the next bootstrap set,
+	// DefaultBootstrapBackoff if zero
+	BootstrapBackoff time.Duration
+	// OnBootstrap is called after Bootstrap tried a set of bootstrap
+	// peers, err is nil if it connected
+	OnBootstrap func(set string, err error)
+	// FindTimeout bounds a single FindPeer lookup
+	FindTimeout  time.Duration
+	mu           sync.Mutex
+	localPeers   map[peer.ID]struct{} // Found by mDNS
+	onDial       func(pi peer.AddrInfo, err error)
+	onConnect    func(a ConnectAttempt)
+	data         map[dataKey]chan network.Stream // Data streams by the peer and token waiting for them
+	nat          basichost.NATManager            // Nil if port mapping is off
+	access       *accessGater                    // Nil if every peer may connect
+	probes       map[peer.ID]Probe               // Throughput measured by receivers
+	probed       map[peer.ID]*peerProbes         // Probes run by each receiver, see allowProbe
+	probeCode    string                          // Code receivers prove to probe, see SetProbeCode
+	bootstrap    []string                        // Bootstrap peers used instead of the public ones
+	bootstrapSet string                          // Name of the set Bootstrap connected through
+	rendezvous   rendezvousCache                 // Keys of the codes advertised or looked up
+	// OnProbe is called after a receiver measured the link from this node
+	// with ProbeThroughput
+	OnProbe func(p peer.ID, probe Probe)
+	// ChoosePeer picks one of the reachable peers FindPeer found for a
+	// code that more than one peer advertises, see pickPeer
+	ChoosePeer func(candidates []peer.AddrInfo) (peer.ID, error)
+	// ExpectPeer makes FindPeer ignore every other peer that advertises
+	// the code, if set
+	ExpectPeer peer.ID
+}
+
+// Config adjusts how a node is set up. The zero value listens on all IPv4
+// and IPv6 interfaces on random ports with a random identity.
+type Config struct {
+	Identity crypto.PrivKey // Peer identity, random if nil
+	// Listen lists IP addresses, interface names or multiaddrs to listen
+	// on, all interfaces if empty
+	Listen []string
+	// Port is the TCP and QUIC port for the addresses in Listen that are
+	// not multiaddrs, random if zero
+	Port int
+	// Proxy is a SOCKS5 proxy URL such as socks5://127.0.0.1:9050 for Tor.
+	// Connections then go through it and relays only, and Listen and Port
+	// are ignored.
+	Proxy string
+	// NoPortMap stops asking the router to forward ports with UPnP or
+	// NAT-PMP
+	NoPortMap bool
+	// Access limits the peers that can connect, independent of the code
+	Access AccessList
+	// Bootstrap lists the multiaddrs of the peers Bootstrap connects to
+	// instead of the public BootstrapPeers and IPFSBootstrapPeers
+	Bootstrap []string
+}
+
+// listenAddrs returns the multiaddrs to listen on
+func (c Config) listenAddrs() ([]string, error) {
+	if c.Port < 0 || c.Port > 65535 {
+		return nil, fmt.Errorf("invalid port %d", c.Port)
+	}
+	hosts := c.Listen
+	if len(hosts) == 0 {
+		hosts = []string{"0.0.0.0", "::"}
+	}
+	var addrs []string
+	for _, h := range hosts {
+		h = strings.TrimSpace(h)
+		if strings.HasPrefix(h, "/") {
+			if _, err := multiaddr.NewMultiaddr(h); err != nil {
+				return nil, fmt.Errorf("invalid listen address %q: %w", h, err)
+			}
+			addrs = append(addrs, h)
+			continue
+		}
+		ips, err := listenIPs(h)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			proto := "ip4"
+			if ip.To4() == nil {
+				proto = "ip6"
+			}
+			// Browsers connect with WebTransport or WebRTC, which share
+			// the UDP port with QUIC
+			addrs = append(addrs,
+				fmt.Sprintf("/%s/%s/tcp/%d", proto, ip, c.Port),
+				fmt.Sprintf("/%s/%s/udp/%d/quic-v1", proto, ip, c.Port),
+				fmt.Sprintf("/%s/%s/udp/%d/quic-v1/webtransport", proto, ip, c.Port),
+				fmt.Sprintf("/%s/%s/udp/%d/webrtc-direct", proto, ip, c.Port),
+			)
+		}
+	}
+	return addrs, nil
+}
+
+// listenIPs resolves an IP address or the name of a network interface
+func listenIPs(host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	iface, err := net.InterfaceByName(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listen address %q: not an IP address or interface", host)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get addresses of %s: %w", host, err)
+	}
+	var ips []net.IP
+	for _, a := range addrs {
+		// Link-local IPv6 addresses would need the zone
+		if ipNet, ok := a.(*net.IPNet); ok && !ipNet.IP.IsLinkLocalUnicast() {
+			ips = append(ips, ipNet.IP)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("interface %s has no addresses", host)
+	}
+	return ips, nil
 }
 
 func NewNode(ctx context.Context) (*Node, error) {
-	ctx, cancel := context.WithCancel(ctx)
+	return NewNodeWithConfig(ctx, Config{})
+}
+
+// NewNodeWithIdentity creates a node that uses key as its peer identity. A
+// random identity is generated if key is nil.
+func NewNodeWithIdentity(ctx context.Context, key crypto.PrivKey) (*Node, error) {
+	return NewNodeWithConfig(ctx, Config{Identity: key})
+}
 
-	h, err := libp2p.New(
-		libp2p.ListenAddrStrings(
-			"/ip4/0.0.0.0/tcp/0",
-			"/ip4/0.0.0.0/udp/0/quic-v1",
-		),
+// NewNodeWithConfig creates a node set up as cfg says
+func NewNodeWithConfig(ctx context.Context, cfg Config) (*Node, error) {
+	opts := []libp2p.Option{
 		libp2p.Security(libp2ptls.ID, libp2ptls.New),
 		libp2p.Security(noise.ID, noise.New),
-		libp2p.NATPortMap(),
-		libp2p.EnableHolePunching(),
 		libp2p.EnableRelay(),
-	)
+	}
+	access, err := newAccessGater(cfg.Access)
+	if err != nil {
+		return nil, err
+	}
+	if access != nil {
+		opts = append(opts, libp2p.ConnectionGater(access))
+	}
+	var dhtRef atomic.Pointer[dht.IpfsDHT]
+	var nodeRef atomic.Pointer[Node]
+	var natMgr basichost.NATManager
+	if cfg.Proxy != "" {
+		dialer, err := parseProxy(cfg.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, proxyOptions(dialer, &dhtRef)...)
+	} else {
+		listen, err := cfg.listenAddrs()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts,
+			libp2p.ListenAddrStrings(listen...),
+			libp2p.EnableHolePunching(holepunch.WithTracer(holePunchTracer{node: nodeRef.Load})),
+		)
+		if !cfg.NoPortMap {
+			// Kept for Stats, libp2p does not expose it
+			opts = append(opts, libp2p.NATManager(func(nw network.Network) basichost.NATManager {
+				natMgr = basichost.NewNATManager(nw)
+				return natMgr
+			}))
+		}
+	}
+	if cfg.Identity != nil {
+		opts = append(opts, libp2p.Identity(cfg.Identity))
+	}
+
+	h, err := libp2p.New(opts...)
 	if err != nil {
-		cancel()
 		return nil, fmt.Errorf("failed to create host: %w", err)
 	}
+	ctx, cancel := context.WithCancel(ctx)
 
 	kadDHT, err := dht.New(ctx, h, dht.Mode(dht.ModeClient))
 	if err != nil {
@@ -69,16 +243,27 @@ func NewNode(ctx context.Context) (*Node, error) {
 		cancel()
 		return nil, fmt.Errorf("failed to create DHT: %w", err)
 	}
+	dhtRef.Store(kadDHT)
 
 	node := &Node{
-		Host:   h,
-		DHT:    kadDHT,
-		Ctx:    ctx,
-		Cancel: cancel,
+		Host:             h,
+		DHT:              kadDHT,
+		Ctx:              ctx,
+		Cancel:           cancel,
+		BootstrapTimeout: DefaultBootstrapTimeout,
+		FindTimeout:      DefaultFindTimeout,
+		nat:              natMgr,
+		access:           access,
+		bootstrap:        cfg.Bootstrap,
 	}
+	nodeRef.Store(node)
+	node.watchConnections()
 
-	if err := node.setupLocalDiscovery(); err != nil {
-		fmt.Printf("Warning: Failed to setup MDNS: %v\n", err)
+	// mDNS would announce the local addresses
+	if cfg.Proxy == "" {
+		if err := node.setupLocalDiscovery(); err != nil {
+			fmt.Printf("Warning: Failed to setup MDNS: %v\n", err)
+		}
 	}
 
 	return node, nil
@@ -93,61 +278,29 @@ func (n *Node) HandlePeerFound(pi peer.AddrInfo) {
 	if pi.ID == n.Host.ID() {
 		return
 	}
-	if err := n.Host.Connect(n.Ctx, pi); err != nil {
-		// Log connection failures but don't fail the discovery process
-		// Peers may be temporarily unavailable or behind NAT
-		// Silently ignore connection errors as they're expected in P2P networks
+	n.mu.Lock()
+	if n.localPeers == nil {
+		n.localPeers = make(map[peer.ID]struct{})
 	}
+	n.localPeers[pi.ID] = struct{}{}
+	n.mu.Unlock()
+	// Connection failures don't fail the discovery process, peers may be
+	// temporarily unavailable or behind NAT
+	n.dialed(pi, n.Host.Connect(n.Ctx, pi))
 }
 
-func (n *Node) Bootstrap() error {
-	if err := n.DHT.Bootstrap(n.Ctx); err != nil {
-		return fmt.Errorf("failed to bootstrap DHT: %w", err)
-	}
-
-	var wg sync.WaitGroup
-	connected := 0
-	var connMu sync.Mutex
-
-	for _, peerAddr := range BootstrapPeers {
-		maddr, err := multiaddr.NewMultiaddr(peerAddr)
-		if err != nil {
-			continue
-		}
-		peerInfo, err := peer.AddrInfoFromP2pAddr(maddr)
-		if err != nil {
+// Advertise makes the node findable by code, see advertisedRendezvous
+func (n *Node) Advertise(code string) error {
+	var err error
+	advertised := false
+	for _, rendezvous := range n.advertisedRendezvous(code, time.Now()) {
+		if _, advErr := n.Discovery.Advertise(n.Ctx, rendezvous); advErr != nil {
+			err = advErr
 			continue
 		}
-
-		wg.Add(1)
-		go func(pi peer.AddrInfo) {
-			defer wg.Done()
-			ctx, cancel := context.WithTimeout(n.Ctx, 30*time.Second)
-			defer cancel()
-			if err := n.Host.Connect(ctx, pi); err == nil {
-				connMu.Lock()
-				connected++
-				connMu.Unlock()
-			}
-		}(*peerInfo)
+		advertised = true
 	}
-
-	wg.Wait()
-
-	if connected == 0 {
-		return fmt.Errorf("failed to connect to any bootstrap peers")
-	}
-
-	n.Discovery = routing.NewRoutingDiscovery(n.DHT)
-
-	return nil
-}
-
-func (n *Node) Advertise(code string) error {
-	rendezvous := codeToRendezvous(code)
-
-	_, err := n.Discovery.Advertise(n.Ctx, rendezvous)
-	if err != nil {
+	if !advertised {
 		return fmt.Errorf("failed to advertise: %w", err)
 	}
 
@@ -155,55 +308,161 @@ func (n *Node) Advertise(code string) error {
 }
 
 func (n *Node) FindPeer(code string) (peer.ID, error) {
-	rendezvous := codeToRendezvous(code)
-
-	ctx, cancel := context.WithTimeout(n.Ctx, 30*time.Second)
+	ctx, cancel := context.WithTimeout(n.Ctx, n.findTimeout())
 	defer cancel()
 
-	peerChan, err := n.Discovery.FindPeers(ctx, rendezvous)
+	rendezvous := n.lookupRendezvous(code, time.Now())
+	peerChan, err := n.findProviders(ctx, rendezvous)
 	if err != nil {
 		return "", fmt.Errorf("failed to find peers: %w", err)
 	}
 
-	for p := range peerChan {
+	// Stale records of a cancelled sender are told apart by its tombstone,
+	// looked up once a peer cannot be reached. They only fail the lookup if
+	// no other provider of the code, such as a new sender, is reachable.
+	var withdrawn map[peer.ID]bool
+	sawWithdrawn := false
+	isWithdrawn := func(id peer.ID) bool {
+		if withdrawn == nil {
+			withdrawn = n.withdrawnPeers(rendezvous)
+		}
+		return withdrawn[id]
+	}
+
+	// Providers keep arriving for a while after the first reachable one,
+	// to notice another sender with the same code
+	var found []peer.AddrInfo
+	var window <-chan time.Time
+collect:
+	for {
+		var p peer.AddrInfo
+		var ok bool
 		select {
 		case <-n.Ctx.Done():
 			return "", n.Ctx.Err()
-		default:
+		case <-window:
+			break collect
+		case p, ok = <-peerChan:
+			if !ok {
+				break collect
+			}
 		}
 
-		if p.ID == n.Host.ID() {
+		if n.ExpectPeer != "" && p.ID != n.ExpectPeer {
+			continue
+		}
+		if p.ID == n.Host.ID() || slices.ContainsFunc(found, func(f peer.AddrInfo) bool { return f.ID == p.ID }) {
 			continue
 		}
 		if len(p.Addrs) == 0 {
+			if len(found) == 0 && isWithdrawn(p.ID) {
+				sawWithdrawn = true
+			}
 			continue
 		}
 
 		ctxConn, cancelConn := context.WithTimeout(n.Ctx, 5*time.Second)
 		err := n.Host.Connect(ctxConn, p)
 		cancelConn()
+		if err == nil {
+			err = n.checkPermitted(p.ID)
+		}
+		n.dialed(p, err)
 
 		if err != nil {
+			if len(found) == 0 && isWithdrawn(p.ID) {
+				sawWithdrawn = true
+			}
 			continue
 		}
+		found = append(found, p)
+		if window == nil {
+			window = time.After(duplicateWindow)
+		}
+	}
+	if len(found) == 0 {
+		if sawWithdrawn {
+			return "", ErrWithdrawn
+		}
+		return "", fmt.Errorf("no peers found")
+	}
+
+	id, err := n.pickPeer(found)
+	for _, p := range found {
+		if p.ID != id {
+			n.Host.Network().ClosePeer(p.ID)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	n.mu.Lock()
+	n.ConnectedPeer = id
+	n.mu.Unlock()
+	return id, nil
+}
+
+// SetDialHandler sets a function called after each attempt to connect to a
+// peer found by FindPeer or mDNS, err is nil on success
+func (n *Node) SetDialHandler(f func(pi peer.AddrInfo, err error)) {
+	n.mu.Lock()
+	n.onDial = f
+	n.mu.Unlock()
+}
+
+func (n *Node) dialed(pi peer.AddrInfo, err error) {
+	n.mu.Lock()
+	f := n.onDial
+	n.mu.Unlock()
+	if f != nil {
+		f(pi, err)
+	}
+	n.connectAttempt(n.dialAttempt(pi, err))
+}
 
-		n.mu.Lock()
-		n.ConnectedPeer = p.ID
-		n.mu.Unlock()
-		return p.ID, nil
+func (n *Node) bootstrapTimeout() time.Duration {
+	if n.BootstrapTimeout <= 0 {
+		return DefaultBootstrapTimeout
 	}
+	return n.BootstrapTimeout
+}
 
-	return "", fmt.Errorf("no peers found")
+func (n *Node) findTimeout() time.Duration {
+	if n.FindTimeout <= 0 {
+		return DefaultFindTimeout
+	}
+	return n.FindTimeout
 }
 
+// SetStreamHandler handles transfer streams, and the data and probe streams
+// that go with them, see AcceptDataStream and ProbeThroughput
 func (n *Node) SetStreamHandler(handler network.StreamHandler) {
-	n.Host.SetStreamHandler(protocol.ID(ProtocolID), handler)
+	n.Host.SetStreamHandler(protocol.ID(ProtocolID), n.permittedOnly(handler))
+	n.Host.SetStreamHandler(protocol.ID(DataProtocolID), n.permittedOnly(n.handleDataStream))
+	n.Host.SetStreamHandler(protocol.ID(ProbeProtocolID), n.permittedOnly(n.handleProbe))
+}
+
+// permittedOnly resets streams the access list does not allow, such as
+// streams from a DHT peer over a connection this node opened
+func (n *Node) permittedOnly(handler network.StreamHandler) network.StreamHandler {
+	return func(s network.Stream) {
+		if !n.access.permits(s.Conn().RemotePeer(), s.Conn().RemoteMultiaddr()) {
+			s.Reset()
+			return
+		}
+		handler(s)
+	}
 }
 
 func (n *Node) NewStream(peerID peer.ID) (network.Stream, error) {
 	return n.Host.NewStream(n.Ctx, peerID, protocol.ID(ProtocolID))
 }
 
+// PrivateKey returns the node's identity key, used to sign transfer receipts
+func (n *Node) PrivateKey() crypto.PrivKey {
+	return n.Host.Peerstore().PrivKey(n.Host.ID())
+}
+
 func (n *Node) Close() error {
 	n.Cancel()
 	if err := n.DHT.Close(); err != nil {
@@ -2,6 +2,9 @@ package p2p
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"strings"
 	"testing"
 	"time"
 
@@ -201,3 +204,90 @@ func TestBootstrapPeers(t *testing.T) {
 		}
 	}
 }
+
+func TestListenAddrs(t *testing.T) {
+	addrs, err := Config{}.listenAddrs()
+	if err != nil {
+		t.Fatalf("listenAddrs() error = %v", err)
+	}
+	want := []string{
+		"/ip4/0.0.0.0/tcp/0", "/ip4/0.0.0.0/udp/0/quic-v1", "/ip4/0.0.0.0/udp/0/quic-v1/webtransport", "/ip4/0.0.0.0/udp/0/webrtc-direct",
+		"/ip6/::/tcp/0", "/ip6/::/udp/0/quic-v1", "/ip6/::/udp/0/quic-v1/webtransport", "/ip6/::/udp/0/webrtc-direct",
+	}
+	if strings.Join(addrs, " ") != strings.Join(want, " ") {
+		t.Errorf("Default listen addresses = %v, want %v", addrs, want)
+	}
+
+	addrs, err = Config{Listen: []string{"192.168.1.5", "/ip4/10.0.0.1/tcp/4001"}, Port: 4242}.listenAddrs()
+	if err != nil {
+		t.Fatalf("listenAddrs() error = %v", err)
+	}
+	want = []string{
+		"/ip4/192.168.1.5/tcp/4242", "/ip4/192.168.1.5/udp/4242/quic-v1", "/ip4/192.168.1.5/udp/4242/quic-v1/webtransport", "/ip4/192.168.1.5/udp/4242/webrtc-direct",
+		"/ip4/10.0.0.1/tcp/4001",
+	}
+	if strings.Join(addrs, " ") != strings.Join(want, " ") {
+		t.Errorf("Listen addresses = %v, want %v", addrs, want)
+	}
+
+	for _, cfg := range []Config{
+		{Listen: []string{"no-such-interface0"}},
+		{Listen: []string{"/ip4/bad"}},
+		{Port: 70000},
+	} {
+		if _, err := cfg.listenAddrs(); err == nil {
+			t.Errorf("listenAddrs() accepted %+v", cfg)
+		}
+	}
+}
+
+func TestNodeFixedPort(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	node, err := NewNodeWithConfig(ctx, Config{Listen: []string{"127.0.0.1"}, Port: port})
+	if err != nil {
+		t.Fatalf("NewNodeWithConfig() error = %v", err)
+	}
+	defer node.Close()
+	want := fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", port)
+	for _, addr := range node.Host.Network().ListenAddresses() {
+		if addr.String() == want {
+			return
+		}
+	}
+	t.Errorf("Listening on %v, want %s", node.Host.Network().ListenAddresses(), want)
+}
+
+func TestBrowserTransports(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	node, err := NewNodeWithConfig(ctx, Config{Listen: []string{"127.0.0.1"}})
+	if err != nil {
+		t.Fatalf("NewNodeWithConfig() error = %v", err)
+	}
+	defer node.Close()
+
+	// Browsers can only verify the self-signed certificates by their hashes
+	var webTransport, webRTC bool
+	for _, addr := range node.Host.Addrs() {
+		s := addr.String()
+		if !strings.Contains(s, "/webtransport/") && !strings.Contains(s, "/webrtc-direct/") {
+			continue
+		}
+		if !strings.Contains(s, "/certhash/") {
+			t.Errorf("Browser address %s lacks the certificate hash", s)
+		}
+		webTransport = webTransport || strings.Contains(s, "/webtransport/")
+		webRTC = webRTC || strings.Contains(s, "/webrtc-direct/")
+	}
+	if !webTransport || !webRTC {
+		t.Errorf("Addrs() = %v, want WebTransport and WebRTC addresses", node.Host.Addrs())
+	}
+}
@@ -0,0 +1,94 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/ebob10000/2c1f/paths"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"lukechampine.com/blake3"
+)
+
+// GetIdentityPath returns the path to the persistent identity key. Only
+// contact transfers and named shares use it, code transfers get a fresh
+// identity every time.
+func GetIdentityPath() string {
+	return paths.Config("identity.key", ".2c1f-identity.key")
+}
+
+// LoadOrCreateIdentity reads the identity key at path, creating it if missing
+func LoadOrCreateIdentity(path string) (crypto.PrivKey, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		key, err := crypto.UnmarshalPrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity key %s: %w", path, err)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key, _, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		return nil, err
+	}
+	data, err = crypto.MarshalPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to save identity key: %w", err)
+	}
+	return key, nil
+}
+
+// ContactCode is the connection code for a transfer between two contacts.
+// Both sides derive it from their peer IDs, the argument order does not matter.
+func ContactCode(a, b peer.ID) string {
+	first, second := a.String(), b.String()
+	if first > second {
+		first, second = second, first
+	}
+	sum := blake3.Sum256([]byte("2c1f-contact\x00" + first + "\x00" + second))
+	return fmt.Sprintf("contact-%x", sum[:8])
+}
+
+// AdvertiseIdentity makes this node findable by its peer ID with DialPeer
+func (n *Node) AdvertiseIdentity() error {
+	// Peer IDs are no secret, so they need none of the protection codes get
+	if _, err := n.Discovery.Advertise(n.Ctx, codeToRendezvous(n.Host.ID().String())); err != nil {
+		return fmt.Errorf("failed to advertise: %w", err)
+	}
+	return nil
+}
+
+// DialPeer connects to a known peer ID. It tries DHT peer routing first and
+// falls back to the rendezvous announced with AdvertiseIdentity.
+func (n *Node) DialPeer(id peer.ID) error {
+	ctx, cancel := context.WithTimeout(n.Ctx, n.findTimeout())
+	defer cancel()
+
+	if info, err := n.DHT.FindPeer(ctx, id); err == nil {
+		if err := n.Host.Connect(ctx, info); err == nil {
+			return n.checkPermitted(id)
+		}
+	}
+
+	peers, err := n.Discovery.FindPeers(ctx, codeToRendezvous(id.String()))
+	if err != nil {
+		return fmt.Errorf("failed to find peer: %w", err)
+	}
+	for p := range peers {
+		if p.ID != id || len(p.Addrs) == 0 {
+			continue
+		}
+		if err := n.Host.Connect(ctx, p); err == nil {
+			return n.checkPermitted(id)
+		}
+	}
+	return fmt.Errorf("peer %s is not online", id.ShortString())
+}
@@ -0,0 +1,33 @@
+package p2p
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOrCreateIdentity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identity.key")
+
+	first, err := LoadOrCreateIdentity(path)
+	if err != nil {
+		t.Fatalf("LoadOrCreateIdentity() error = %v", err)
+	}
+	second, err := LoadOrCreateIdentity(path)
+	if err != nil {
+		t.Fatalf("LoadOrCreateIdentity() error = %v", err)
+	}
+	if !first.Equals(second) {
+		t.Error("Identity changed between loads")
+	}
+}
+
+func TestContactCode(t *testing.T) {
+	a, b, c := newTestPeerID(t), newTestPeerID(t), newTestPeerID(t)
+
+	if ContactCode(a, b) != ContactCode(b, a) {
+		t.Error("ContactCode depends on argument order")
+	}
+	if ContactCode(a, b) == ContactCode(a, c) {
+		t.Error("Different contacts share a code")
+	}
+}
@@ -0,0 +1,444 @@
+package p2p
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	libp2ptls "github.com/libp2p/go-libp2p/p2p/security/tls"
+	"github.com/libp2p/zeroconf/v2"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"golang.org/x/crypto/argon2"
+)
+
+// LANService is the mDNS service senders announce the LAN fallback under
+const LANService = "_2c1f-lan._tcp"
+
+// DefaultLANTimeout bounds the search for a sender on the local network
+const DefaultLANTimeout = 5 * time.Second
+
+// lanHandshakeTimeout bounds the TLS handshake of a LAN connection
+const lanHandshakeTimeout = 10 * time.Second
+
+// maxLANSalts bounds the keys a receiver derives while searching, so a
+// peer flooding the network with announcements cannot keep it busy
+const maxLANSalts = 16
+
+// ErrNoLANSender fails DialLAN when no sender of the code answered on the
+// local network
+var ErrNoLANSender = errors.New("no sender found on the local network")
+
+// LANConn is a connection of the LAN fallback, a TLS connection whose
+// certificates carry the libp2p identities of both sides like libp2p's own
+// TLS transport does
+type LANConn struct {
+	*tls.Conn
+	Remote peer.ID // Identity of the other side
+}
+
+// Reset closes the connection without telling the other side, like
+// network.Stream.Reset
+func (c *LANConn) Reset() error {
+	return c.NetConn().Close()
+}
+
+// LANListener accepts receivers on the local network when libp2p cannot
+// connect the two sides. It listens on a random TCP port of the addresses in
+// Config.Listen and announces it with mDNS, together with a proof of the
+// code keyed with Argon2id and a random salt. Only receivers of the code can
+// verify the announcement, so they do not send the code to a peer that
+// copied it, and guessing the code from it takes deriving every code anew
+// for each transfer.
+type LANListener struct {
+	lns      []net.Listener
+	server   *zeroconf.Server
+	identity *libp2ptls.Identity
+	id       peer.ID
+	access   *accessGater // Nil if every peer may connect
+	conns    chan *LANConn
+	done     chan struct{}
+	close    sync.Once
+}
+
+// ListenLAN starts the LAN fallback for code with the identity key, a
+// random one if nil. It listens on the addresses in cfg.Listen and refuses
+// the peers cfg.Access does not permit, like the node does.
+func ListenLAN(code string, key crypto.PrivKey, cfg Config) (*LANListener, error) {
+	identity, id, err := lanIdentity(key)
+	if err != nil {
+		return nil, err
+	}
+	access, err := newAccessGater(cfg.Access)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := cfg.lanIPs()
+	if err != nil {
+		return nil, err
+	}
+	lns, err := listenLAN(ips)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on the local network: %w", err)
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		closeAll(lns)
+		return nil, err
+	}
+	saltHex := hex.EncodeToString(salt)
+	port := lns[0].Addr().(*net.TCPAddr).Port
+	text := []string{"salt=" + saltHex, "peer=" + id.String(), "auth=" + lanAuth(lanKey(code, saltHex), id)}
+	server, err := zeroconf.Register(id.String(), LANService, "local.", port, text, nil)
+	if err != nil {
+		closeAll(lns)
+		return nil, fmt.Errorf("failed to announce on the local network: %w", err)
+	}
+
+	l := &LANListener{
+		lns:      lns,
+		server:   server,
+		identity: identity,
+		id:       id,
+		access:   access,
+		conns:    make(chan *LANConn),
+		done:     make(chan struct{}),
+	}
+	for _, ln := range lns {
+		go l.acceptLoop(ln)
+	}
+	return l, nil
+}
+
+// lanIPs returns the IPs of the addresses in Listen, nil for all
+func (c Config) lanIPs() ([]net.IP, error) {
+	var ips []net.IP
+	for _, h := range c.Listen {
+		h = strings.TrimSpace(h)
+		if !strings.HasPrefix(h, "/") {
+			hostIPs, err := listenIPs(h)
+			if err != nil {
+				return nil, err
+			}
+			ips = append(ips, hostIPs...)
+			continue
+		}
+		addr, err := multiaddr.NewMultiaddr(h)
+		if err != nil {
+			return nil, fmt.Errorf("invalid listen address %q: %w", h, err)
+		}
+		// Addresses without an IP, such as DNS names, are not listened on
+		if ip, err := manet.ToIP(addr); err == nil {
+			ips = append(ips, ip)
+		}
+	}
+	if len(c.Listen) > 0 && len(ips) == 0 {
+		return nil, errors.New("no IP address to listen on in the listen addresses")
+	}
+	return ips, nil
+}
+
+// listenLAN listens on the same random port of all ips, as mDNS announces a
+// single one, or of all interfaces if there are none
+func listenLAN(ips []net.IP) ([]net.Listener, error) {
+	if len(ips) == 0 {
+		ln, err := net.Listen("tcp", ":0")
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{ln}, nil
+	}
+	var err error
+	// The port picked for the first IP may be taken on the others
+	for range 3 {
+		var lns []net.Listener
+		port := "0"
+		for _, ip := range ips {
+			var ln net.Listener
+			ln, err = net.Listen("tcp", net.JoinHostPort(ip.String(), port))
+			if err != nil {
+				break
+			}
+			lns = append(lns, ln)
+			port = strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+		}
+		if err == nil {
+			return lns, nil
+		}
+		closeAll(lns)
+	}
+	return nil, err
+}
+
+func closeAll(lns []net.Listener) {
+	for _, ln := range lns {
+		ln.Close()
+	}
+}
+
+// ID returns the identity receivers see
+func (l *LANListener) ID() peer.ID {
+	return l.id
+}
+
+// Addr returns an address the listener accepts connections on
+func (l *LANListener) Addr() net.Addr {
+	return l.lns[0].Addr()
+}
+
+// Accept waits for a receiver that completed the TLS handshake
+func (l *LANListener) Accept() (*LANConn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops listening and announcing. Accepted connections stay open.
+func (l *LANListener) Close() error {
+	l.close.Do(func() {
+		close(l.done)
+		l.server.Shutdown()
+		closeAll(l.lns)
+	})
+	return nil
+}
+
+// acceptLoop runs the handshakes concurrently, so a peer that stalls in
+// one does not hold up the others
+func (l *LANListener) acceptLoop(ln net.Listener) {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			l.Close()
+			return
+		}
+		go func() {
+			conn, err := l.handshake(c)
+			if err != nil {
+				c.Close()
+				return
+			}
+			select {
+			case l.conns <- conn:
+			case <-l.done:
+				conn.Close()
+			}
+		}()
+	}
+}
+
+// handshake authenticates the peer at c and checks it against the access
+// list, refusing denied IPs before spending a TLS handshake on them
+func (l *LANListener) handshake(c net.Conn) (*LANConn, error) {
+	addr, _ := manet.FromNetAddr(c.RemoteAddr())
+	if l.access != nil && l.access.deny.matchIP(remoteIP(addr)) {
+		return nil, errLANDenied
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), lanHandshakeTimeout)
+	defer cancel()
+	conf, keyCh := l.identity.ConfigForPeer("")
+	conn := tls.Server(c, conf)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	remote, err := peer.IDFromPublicKey(<-keyCh)
+	if err != nil {
+		return nil, err
+	}
+	if !l.access.permits(remote, addr) {
+		return nil, errLANDenied
+	}
+	return &LANConn{Conn: conn, Remote: remote}, nil
+}
+
+var errLANDenied = errors.New("peer is not on the access list")
+
+// DialLAN looks for the sender of code on the local network with mDNS and
+// connects to it with the identity key, a random one if nil, skipping the
+// senders cfg.Access does not permit. It gives up with ErrNoLANSender once
+// ctx is done, see DefaultLANTimeout.
+func DialLAN(ctx context.Context, code string, key crypto.PrivKey, cfg Config) (*LANConn, error) {
+	identity, _, err := lanIdentity(key)
+	if err != nil {
+		return nil, err
+	}
+	access, err := newAccessGater(cfg.Access)
+	if err != nil {
+		return nil, err
+	}
+	keys := newLANKeys(code)
+
+	ctx, cancel := context.WithCancel(ctx)
+	entries := make(chan *zeroconf.ServiceEntry)
+	browsed := make(chan error, 1)
+	go func() {
+		browsed <- zeroconf.Browse(ctx, LANService, "local.", entries)
+	}()
+	// Browse blocks on entries until it notices the cancellation, and
+	// closes them when it returns
+	defer func() {
+		cancel()
+		go func() {
+			for range entries {
+			}
+		}()
+	}()
+
+	lastErr := ErrNoLANSender
+	found := entries
+	for {
+		select {
+		case e, ok := <-found:
+			if !ok {
+				found = nil
+				continue
+			}
+			sender, addrs, ok := lanOffer(e, keys)
+			if !ok {
+				continue
+			}
+			for _, addr := range addrs {
+				if !access.permits(sender, lanMultiaddr(addr)) {
+					lastErr = fmt.Errorf("peer %s is not on the access list", sender.ShortString())
+					continue
+				}
+				conn, err := dialLAN(ctx, addr, sender, identity)
+				if err == nil {
+					return conn, nil
+				}
+				lastErr = err
+			}
+		case err := <-browsed:
+			if err != nil && ctx.Err() == nil {
+				return nil, fmt.Errorf("failed to search the local network: %w", err)
+			}
+			return nil, lastErr
+		}
+	}
+}
+
+// dialLAN connects to the sender at addr, failing unless it has the
+// identity sender
+func dialLAN(ctx context.Context, addr string, sender peer.ID, identity *libp2ptls.Identity) (*LANConn, error) {
+	ctx, cancel := context.WithTimeout(ctx, lanHandshakeTimeout)
+	defer cancel()
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conf, _ := identity.ConfigForPeer(sender)
+	conn := tls.Client(c, conf)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return &LANConn{Conn: conn, Remote: sender}, nil
+}
+
+// lanMultiaddr returns the multiaddr of the host:port addr for the access
+// list, nil if it has none
+func lanMultiaddr(addr string) multiaddr.Multiaddr {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return nil
+	}
+	m, _ := manet.FromNetAddr(tcpAddr)
+	return m
+}
+
+// lanOffer returns the identity and addresses of the sender e announces,
+// if it announces the code of keys
+func lanOffer(e *zeroconf.ServiceEntry, keys *lanKeys) (peer.ID, []string, bool) {
+	fields := make(map[string]string)
+	for _, txt := range e.Text {
+		if k, v, ok := strings.Cut(txt, "="); ok {
+			fields[k] = v
+		}
+	}
+	sender, err := peer.Decode(fields["peer"])
+	if err != nil || fields["auth"] == "" {
+		return "", nil, false
+	}
+	key, ok := keys.key(fields["salt"])
+	if !ok || !hmac.Equal([]byte(fields["auth"]), []byte(lanAuth(key, sender))) {
+		return "", nil, false
+	}
+	var addrs []string
+	for _, ip := range append(e.AddrIPv4, e.AddrIPv6...) {
+		addrs = append(addrs, net.JoinHostPort(ip.String(), strconv.Itoa(e.Port)))
+	}
+	return sender, addrs, true
+}
+
+// lanIdentity returns the TLS identity of key, generating a key if nil
+func lanIdentity(key crypto.PrivKey) (*libp2ptls.Identity, peer.ID, error) {
+	if key == nil {
+		var err error
+		if key, _, err = crypto.GenerateEd25519Key(rand.Reader); err != nil {
+			return nil, "", fmt.Errorf("failed to generate identity: %w", err)
+		}
+	}
+	identity, err := libp2ptls.NewIdentity(key)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create TLS identity: %w", err)
+	}
+	id, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return nil, "", err
+	}
+	return identity, id, nil
+}
+
+// lanKey derives the key of the announcements of code with salt. It is
+// slow to derive like rendezvousKey, and the salt is random for each
+// transfer, so an announcement overheard on the network does not reveal the
+// code without trying every possible one.
+func lanKey(code, salt string) []byte {
+	return argon2.IDKey([]byte(code), []byte("2c1f-lan:"+salt), 1, 64*1024, 4, 32)
+}
+
+// lanAuth proves that the sender with the identity id knows the code of key
+func lanAuth(key []byte, id peer.ID) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("2c1f-lan-auth\x00" + id.String()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// lanKeys keeps the keys a receiver derived for the salts it saw, up to
+// maxLANSalts of them
+type lanKeys struct {
+	code string
+	keys map[string][]byte
+}
+
+func newLANKeys(code string) *lanKeys {
+	return &lanKeys{code: code, keys: make(map[string][]byte)}
+}
+
+func (k *lanKeys) key(salt string) ([]byte, bool) {
+	if key, ok := k.keys[salt]; ok {
+		return key, true
+	}
+	if salt == "" || len(k.keys) >= maxLANSalts {
+		return nil, false
+	}
+	key := lanKey(k.code, salt)
+	k.keys[salt] = key
+	return key, true
+}
@@ -0,0 +1,193 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/zeroconf/v2"
+)
+
+func TestLANConn(t *testing.T) {
+	l, err := ListenLAN("123-456", nil, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	addr := net.JoinHostPort("127.0.0.1", portOf(l.Addr()))
+
+	key, _, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, id, err := lanIdentity(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Another peer at the address is refused
+	if _, err := dialLAN(ctx, addr, id, identity); err == nil {
+		t.Error("dialLAN() connected to the wrong peer")
+	}
+
+	client, err := dialLAN(ctx, addr, l.ID(), identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if client.Remote != l.ID() {
+		t.Errorf("client.Remote = %s, want %s", client.Remote, l.ID())
+	}
+	server, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	if server.Remote != id {
+		t.Errorf("server.Remote = %s, want %s", server.Remote, id)
+	}
+
+	go client.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(server, buf); err != nil || string(buf) != "hello" {
+		t.Errorf("read %q, %v, want hello", buf, err)
+	}
+
+	l.Close()
+	if _, err := l.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Accept() after Close error = %v, want %v", err, net.ErrClosed)
+	}
+}
+
+func TestLANOffer(t *testing.T) {
+	sender := newTestPeerID(t)
+	entry := &zeroconf.ServiceEntry{
+		Port:     4001,
+		Text:     []string{"salt=ab12", "peer=" + sender.String(), "auth=" + lanAuth(lanKey("123-456", "ab12"), sender)},
+		AddrIPv4: []net.IP{net.ParseIP("192.168.1.2")},
+	}
+	keys := newLANKeys("123-456")
+	id, addrs, ok := lanOffer(entry, keys)
+	if !ok || id != sender || len(addrs) != 1 || addrs[0] != "192.168.1.2:4001" {
+		t.Errorf("lanOffer() = %s, %v, %t, want %s at 192.168.1.2:4001", id, addrs, ok, sender)
+	}
+	if _, _, ok := lanOffer(entry, newLANKeys("654-321")); ok {
+		t.Error("lanOffer() matched another code")
+	}
+
+	// The proof only holds with the salt it was made with
+	entry.Text[0] = "salt=cd34"
+	if _, _, ok := lanOffer(entry, keys); ok {
+		t.Error("lanOffer() accepted a proof made with another salt")
+	}
+	entry.Text[0] = "salt=ab12"
+
+	// A peer that copied the announcement cannot claim it without the code
+	other := newTestPeerID(t)
+	entry.Text[1] = "peer=" + other.String()
+	if _, _, ok := lanOffer(entry, keys); ok {
+		t.Error("lanOffer() accepted an announcement for another peer")
+	}
+	entry.Text[2] = "auth=" + lanAuth(lanKey("654-321", "ab12"), other)
+	if _, _, ok := lanOffer(entry, keys); ok {
+		t.Error("lanOffer() accepted an announcement made without the code")
+	}
+}
+
+func TestLANKeysLimit(t *testing.T) {
+	keys := newLANKeys("123-456")
+	for i := range maxLANSalts {
+		if _, ok := keys.key(fmt.Sprint(i)); !ok {
+			t.Fatalf("key(%d) refused below the limit", i)
+		}
+	}
+	if _, ok := keys.key("new"); ok {
+		t.Error("key() derived a key past the limit")
+	}
+	if _, ok := keys.key("0"); !ok {
+		t.Error("key() refused a salt it already derived")
+	}
+}
+
+func TestLANAccess(t *testing.T) {
+	key, _, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, id, err := lanIdentity(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := ListenLAN("123-456", nil, Config{Listen: []string{"127.0.0.1"}, Access: AccessList{Deny: []string{id.String()}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if host, _, _ := net.SplitHostPort(l.Addr().String()); host != "127.0.0.1" {
+		t.Errorf("Addr() = %s, want 127.0.0.1", l.Addr())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := dialLAN(ctx, l.Addr().String(), l.ID(), identity)
+	if err == nil {
+		// TLS 1.3 lets the client finish before the server checks it
+		client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, err = client.Read(make([]byte, 1))
+		client.Close()
+	}
+	if err == nil {
+		t.Error("denied peer could use the connection")
+	}
+
+	accepted := make(chan *LANConn, 1)
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	select {
+	case conn := <-accepted:
+		conn.Close()
+		t.Error("Accept() returned a denied peer")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestDialLANWithoutSender(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if _, err := DialLAN(ctx, "no-such-code", nil, Config{}); !errors.Is(err, ErrNoLANSender) {
+		t.Errorf("DialLAN() error = %v, want %v", err, ErrNoLANSender)
+	}
+}
+
+func TestDialLAN(t *testing.T) {
+	l, err := ListenLAN("123-456", nil, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultLANTimeout)
+	defer cancel()
+	conn, err := DialLAN(ctx, "123-456", nil, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if conn.Remote != l.ID() {
+		t.Errorf("Remote = %s, want %s", conn.Remote, l.ID())
+	}
+}
+
+func portOf(addr net.Addr) string {
+	_, port, _ := net.SplitHostPort(addr.String())
+	return port
+}
@@ -0,0 +1,119 @@
+package p2p
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// LocalProtocolID is used by receivers to ask senders on the local network
+// what they offer
+const LocalProtocolID = "/2c1f/local/1.0.0"
+
+const localQueryTimeout = 3 * time.Second
+
+// LocalSender is a sender on the local network that offers its transfer to
+// nearby receivers. The code is only fetched when receiving from it.
+type LocalSender struct {
+	ID   string `json:"id"`   // Peer ID
+	Name string `json:"name"` // Device name chosen by the sender
+}
+
+type localOffer struct {
+	Name string `json:"name"`
+	Code string `json:"code"`
+}
+
+// OfferLocally lets receivers on the local network find this sender by name
+// and receive without typing the code. Peers that are not connected over a
+// private or loopback address are refused.
+func (n *Node) OfferLocally(name, code string) {
+	n.Host.SetStreamHandler(protocol.ID(LocalProtocolID), func(s network.Stream) {
+		defer s.Close()
+		if !IsLocalAddr(s.Conn().RemoteMultiaddr()) {
+			s.Reset()
+			return
+		}
+		s.SetDeadline(time.Now().Add(localQueryTimeout))
+		json.NewEncoder(s).Encode(localOffer{Name: name, Code: code})
+	})
+}
+
+// IsLocalAddr reports whether addr is on the local network
+func IsLocalAddr(addr multiaddr.Multiaddr) bool {
+	return manet.IsPrivateAddr(addr) || manet.IsIPLoopback(addr)
+}
+
+// LocalSenders asks the peers found by mDNS whether they offer a transfer,
+// sorted by name
+func (n *Node) LocalSenders(ctx context.Context) []LocalSender {
+	n.mu.Lock()
+	peers := make([]peer.ID, 0, len(n.localPeers))
+	for id := range n.localPeers {
+		peers = append(peers, id)
+	}
+	n.mu.Unlock()
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		senders []LocalSender
+	)
+	for _, id := range peers {
+		wg.Add(1)
+		go func(id peer.ID) {
+			defer wg.Done()
+			offer, err := n.queryLocal(ctx, id)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			senders = append(senders, LocalSender{ID: id.String(), Name: offer.Name})
+			mu.Unlock()
+		}(id)
+	}
+	wg.Wait()
+
+	sort.Slice(senders, func(i, j int) bool { return senders[i].Name < senders[j].Name })
+	return senders
+}
+
+// LocalCode fetches the code a sender returned by LocalSenders offers
+func (n *Node) LocalCode(ctx context.Context, id peer.ID) (string, error) {
+	offer, err := n.queryLocal(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return offer.Code, nil
+}
+
+func (n *Node) queryLocal(ctx context.Context, id peer.ID) (*localOffer, error) {
+	ctx, cancel := context.WithTimeout(ctx, localQueryTimeout)
+	defer cancel()
+
+	s, err := n.Host.NewStream(ctx, id, protocol.ID(LocalProtocolID))
+	if err != nil {
+		return nil, fmt.Errorf("sender is not available: %w", err)
+	}
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(localQueryTimeout))
+
+	var offer localOffer
+	if err := json.NewDecoder(io.LimitReader(s, 4096)).Decode(&offer); err != nil {
+		return nil, fmt.Errorf("invalid answer from sender: %w", err)
+	}
+	if offer.Code == "" {
+		return nil, fmt.Errorf("sender did not offer a transfer")
+	}
+	return &offer, nil
+}
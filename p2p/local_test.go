@@ -0,0 +1,56 @@
+package p2p
+
+import (
+	"context"
+	"testing"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// newTCPNode creates a node on a loopback TCP port without DHT or mDNS
+func newTCPNode(t *testing.T, ctx context.Context) *Node {
+	t.Helper()
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return &Node{Host: h, Ctx: ctx}
+}
+
+func TestLocalSenders(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sender, receiver := newTCPNode(t, ctx), newTCPNode(t, ctx)
+	sender.OfferLocally("Test Laptop", "123-456")
+	receiver.HandlePeerFound(peer.AddrInfo{ID: sender.Host.ID(), Addrs: sender.Host.Addrs()})
+
+	senders := receiver.LocalSenders(ctx)
+	if len(senders) != 1 || senders[0].Name != "Test Laptop" || senders[0].ID != sender.Host.ID().String() {
+		t.Fatalf("LocalSenders() = %+v", senders)
+	}
+	code, err := receiver.LocalCode(ctx, sender.Host.ID())
+	if err != nil {
+		t.Fatalf("LocalCode() error = %v", err)
+	}
+	if code != "123-456" {
+		t.Errorf("LocalCode() = %q", code)
+	}
+}
+
+func TestLocalSendersIgnoresNonOffering(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	other, receiver := newTCPNode(t, ctx), newTCPNode(t, ctx)
+	receiver.HandlePeerFound(peer.AddrInfo{ID: other.Host.ID(), Addrs: other.Host.Addrs()})
+
+	if senders := receiver.LocalSenders(ctx); len(senders) != 0 {
+		t.Errorf("LocalSenders() = %+v, want none", senders)
+	}
+	if _, err := receiver.LocalCode(ctx, other.Host.ID()); err == nil {
+		t.Error("LocalCode() should fail for a peer that offers nothing")
+	}
+}
@@ -0,0 +1,22 @@
+package p2p
+
+import (
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// MailboxProtocolID opens streams to a mailbox server, which stores
+// transfers for receivers that are not online yet. Each stream starts with
+// a transfer.MailboxRequest.
+const MailboxProtocolID = "/2c1f/mailbox/1.0.0"
+
+// SetMailboxHandler handles mailbox streams
+func (n *Node) SetMailboxHandler(handler network.StreamHandler) {
+	n.Host.SetStreamHandler(protocol.ID(MailboxProtocolID), n.permittedOnly(handler))
+}
+
+// NewMailboxStream opens a stream to the mailbox server peerID
+func (n *Node) NewMailboxStream(peerID peer.ID) (network.Stream, error) {
+	return n.Host.NewStream(n.Ctx, peerID, protocol.ID(MailboxProtocolID))
+}
@@ -0,0 +1,196 @@
+package p2p
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+	"github.com/multiformats/go-multiaddr"
+)
+
+const MonitorInterval = 5 * time.Second
+
+// MaxMigrations bounds how often a Monitor resets the tracked stream, as
+// the transfer is retried each time without counting as an attempt
+const MaxMigrations = 3
+
+// ConnQuality is a snapshot of the link to a connected peer
+type ConnQuality struct {
+	RTT        time.Duration `json:"rtt"`
+	Throughput float64       `json:"throughput"` // Bytes per second over the last interval
+	Relayed    bool          `json:"relayed"`
+}
+
+// Monitor periodically pings a peer, tracks RTT and throughput, and migrates
+// the tracked stream once a relayed connection is upgraded to a direct one
+type Monitor struct {
+	node     *Node
+	peerID   peer.ID
+	OnUpdate func(q ConnQuality)
+	// OnMigrate is called after the tracked stream was reset so the transfer
+	// can be resumed over the direct connection
+	OnMigrate func()
+
+	mu         sync.Mutex
+	quality    ConnQuality
+	stream     network.Stream
+	migrated   bool
+	migrations int // Streams reset so far, at most MaxMigrations
+	bytes      int64
+	lastBytes  int64
+	lastTick   time.Time
+	cancel     context.CancelFunc
+}
+
+func (n *Node) NewMonitor(peerID peer.ID) *Monitor {
+	return &Monitor{
+		node:   n,
+		peerID: peerID,
+	}
+}
+
+// Start launches the monitor goroutine. It stops when Stop is called or the node is closed.
+func (m *Monitor) Start() {
+	ctx, cancel := context.WithCancel(m.node.Ctx)
+	m.mu.Lock()
+	m.cancel = cancel
+	m.lastTick = time.Now()
+	m.mu.Unlock()
+	go m.run(ctx)
+}
+
+func (m *Monitor) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cancel != nil {
+		m.cancel()
+	}
+}
+
+// Track registers the stream currently carrying the transfer
+func (m *Monitor) Track(s network.Stream) {
+	m.mu.Lock()
+	m.stream = s
+	m.mu.Unlock()
+}
+
+// TakeMigration reports whether the tracked stream was reset for migration and clears the flag
+func (m *Monitor) TakeMigration() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	migrated := m.migrated
+	m.migrated = false
+	return migrated
+}
+
+// AddBytes records transferred payload bytes for throughput calculation
+func (m *Monitor) AddBytes(n int64) {
+	m.mu.Lock()
+	m.bytes += n
+	m.mu.Unlock()
+}
+
+func (m *Monitor) Quality() ConnQuality {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.quality
+}
+
+func (m *Monitor) run(ctx context.Context) {
+	ticker := time.NewTicker(MonitorInterval)
+	defer ticker.Stop()
+
+	wasRelayed := m.node.IsRelayed(m.peerID)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		rtt := m.ping(ctx)
+		relayed := m.node.IsRelayed(m.peerID)
+
+		m.mu.Lock()
+		now := time.Now()
+		elapsed := now.Sub(m.lastTick).Seconds()
+		if elapsed > 0 {
+			m.quality.Throughput = float64(m.bytes-m.lastBytes) / elapsed
+		}
+		m.lastBytes = m.bytes
+		m.lastTick = now
+		if rtt > 0 {
+			m.quality.RTT = rtt
+		}
+		m.quality.Relayed = relayed
+		quality := m.quality
+		m.mu.Unlock()
+
+		if m.OnUpdate != nil {
+			m.OnUpdate(quality)
+		}
+
+		if wasRelayed && !relayed {
+			m.migrate()
+		}
+		wasRelayed = relayed
+	}
+}
+
+func (m *Monitor) ping(ctx context.Context) time.Duration {
+	ctx, cancel := context.WithTimeout(ctx, MonitorInterval)
+	defer cancel()
+
+	res, ok := <-ping.Ping(ctx, m.node.Host, m.peerID)
+	if !ok || res.Error != nil {
+		return 0
+	}
+	return res.RTT
+}
+
+// migrate resets the tracked stream if it is still running over the relay,
+// unless it did so MaxMigrations times already
+func (m *Monitor) migrate() {
+	m.mu.Lock()
+	s := m.stream
+	if s == nil || !IsRelayedConn(s.Conn()) || m.migrations >= MaxMigrations {
+		m.mu.Unlock()
+		return
+	}
+	m.migrated = true
+	m.migrations++
+	m.stream = nil
+	m.mu.Unlock()
+
+	s.Reset()
+	if m.OnMigrate != nil {
+		m.OnMigrate()
+	}
+}
+
+// IsRelayed reports whether all open connections to the peer go through a circuit relay
+func (n *Node) IsRelayed(p peer.ID) bool {
+	conns := n.Host.Network().ConnsToPeer(p)
+	if len(conns) == 0 {
+		return false
+	}
+	for _, c := range conns {
+		if !IsRelayedConn(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func IsRelayedConn(c network.Conn) bool {
+	return isRelayedAddr(c.RemoteMultiaddr())
+}
+
+func isRelayedAddr(addr multiaddr.Multiaddr) bool {
+	_, err := addr.ValueForProtocol(multiaddr.P_CIRCUIT)
+	return err == nil
+}
@@ -0,0 +1,78 @@
+package p2p
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+func TestIsRelayedAddr(t *testing.T) {
+	tests := []struct {
+		name string
+		addr string
+		want bool
+	}{
+		{
+			name: "direct tcp",
+			addr: "/ip4/192.168.1.10/tcp/4001",
+			want: false,
+		},
+		{
+			name: "direct quic",
+			addr: "/ip4/1.2.3.4/udp/4001/quic-v1",
+			want: false,
+		},
+		{
+			name: "circuit relay",
+			addr: "/ip4/1.2.3.4/tcp/4001/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN/p2p-circuit",
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, err := multiaddr.NewMultiaddr(tt.addr)
+			if err != nil {
+				t.Fatalf("NewMultiaddr(%q) error = %v", tt.addr, err)
+			}
+			if got := isRelayedAddr(addr); got != tt.want {
+				t.Errorf("isRelayedAddr(%q) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMonitorWithoutConnection(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	node, err := NewNode(ctx)
+	if err != nil {
+		t.Fatalf("NewNode() error = %v", err)
+	}
+	defer node.Close()
+
+	other, err := peer.Decode("QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN")
+	if err != nil {
+		t.Fatalf("peer.Decode() error = %v", err)
+	}
+
+	if node.IsRelayed(other) {
+		t.Error("IsRelayed() = true for a peer without connections")
+	}
+
+	monitor := node.NewMonitor(other)
+	monitor.AddBytes(1024)
+	monitor.Start()
+	monitor.Stop()
+
+	if monitor.TakeMigration() {
+		t.Error("TakeMigration() = true without a tracked stream")
+	}
+	if q := monitor.Quality(); q.Relayed {
+		t.Error("Quality().Relayed = true before any measurement")
+	}
+}
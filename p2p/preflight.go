@@ -0,0 +1,56 @@
+package p2p
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+)
+
+// Stages a node passes to be found by its code, see Announce. Callers
+// report StageStarting while they create the node.
+const (
+	StageStarting      = "starting"
+	StageBootstrapping = "bootstrapping"
+	StageAdvertising   = "advertising"
+	StageReady         = "ready"
+)
+
+// ErrNoDHTPeers fails an announcement that has nobody to publish to
+var ErrNoDHTPeers = errors.New("no DHT peers to publish the code to")
+
+// Announce bootstraps the node and advertises code, calling onStage, if
+// set, as each stage starts. Unlike Bootstrap and Advertise on their own,
+// it fails when the DHT has no peers to take the provider record, so
+// receivers would not find the code. The DHT does not acknowledge records,
+// so a publish counts once it reached a peer.
+func (n *Node) Announce(code string, onStage func(stage string)) error {
+	report := func(stage string) {
+		if onStage != nil {
+			onStage(stage)
+		}
+	}
+
+	report(StageBootstrapping)
+	if err := n.Bootstrap(); err != nil {
+		return err
+	}
+
+	report(StageAdvertising)
+	if n.DHT.RoutingTable().Size() == 0 {
+		return ErrNoDHTPeers
+	}
+	if err := n.Advertise(code); err != nil {
+		return err
+	}
+
+	report(StageReady)
+	return nil
+}
+
+// Preflight announces a random code no receiver looks for, to check that a
+// send would be found before its code is shown
+func (n *Node) Preflight(onStage func(stage string)) error {
+	code := make([]byte, 16)
+	rand.Read(code)
+	return n.Announce(hex.EncodeToString(code), onStage)
+}
@@ -0,0 +1,57 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPreflight(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	// Nodes are DHT clients, so a bootstrap peer of this test cannot take
+	// the provider record
+	boot, err := NewNodeWithConfig(ctx, Config{Listen: []string{"/ip4/127.0.0.1/tcp/0"}, NoPortMap: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer boot.Close()
+	addr := fmt.Sprintf("%s/p2p/%s", boot.Host.Addrs()[0], boot.Host.ID())
+
+	cfg := Config{Listen: []string{"/ip4/127.0.0.1/tcp/0"}, NoPortMap: true, Bootstrap: []string{addr}}
+	node, err := NewNodeWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+	var stages []string
+	onStage := func(stage string) { stages = append(stages, stage) }
+
+	if err := node.Preflight(onStage); !errors.Is(err, ErrNoDHTPeers) {
+		t.Errorf("Preflight() error = %v, want %v", err, ErrNoDHTPeers)
+	}
+	if want := []string{StageBootstrapping, StageAdvertising}; !reflect.DeepEqual(stages, want) {
+		t.Errorf("stages = %v, want %v", stages, want)
+	}
+
+	// A fresh node cannot reach the bootstrap peer once it is gone
+	boot.Close()
+	other, err := NewNodeWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	other.BootstrapTimeout = time.Second
+	other.BootstrapBackoff = time.Millisecond
+	stages = nil
+	if err := other.Preflight(onStage); err == nil {
+		t.Error("Preflight() succeeded without a bootstrap peer")
+	}
+	if want := []string{StageBootstrapping}; !reflect.DeepEqual(stages, want) {
+		t.Errorf("stages without a bootstrap peer = %v, want %v", stages, want)
+	}
+}
@@ -0,0 +1,224 @@
+package p2p
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"lukechampine.com/blake3"
+)
+
+// ProbeProtocolID measures the throughput of the link from a sender to a
+// receiver before a transfer starts. The receiver first proves it knows
+// the sender's code, so others cannot make it send data.
+const ProbeProtocolID = "/2c1f/probe/2.0.0"
+
+const (
+	// ProbeSize is how much random data a probe sends, so compression
+	// cannot inflate the result
+	ProbeSize = 4 << 20
+	// maxProbeSize bounds what a peer may ask for
+	maxProbeSize   = 16 << 20
+	probeChunkSize = 64 << 10
+	// probeDuration ends slow probes early, the rate is then taken from
+	// the data that arrived
+	probeDuration = 5 * time.Second
+	// probeTimeout bounds a whole probe
+	probeTimeout = 2 * probeDuration
+	// maxPeerProbes is how many probes a peer may run within probeWindow
+	maxPeerProbes  = 3
+	probeWindow    = 10 * time.Minute
+	probeNonceSize = 16
+	probeProofSize = 32
+)
+
+// probeProof proves knowledge of code for the probe with nonce that
+// requester runs against responder
+func probeProof(code string, nonce []byte, requester, responder peer.ID) []byte {
+	sum := blake3.Sum256([]byte("2c1f-probe\x00" + code + "\x00" + string(nonce) + "\x00" + requester.String() + "\x00" + responder.String()))
+	return sum[:]
+}
+
+// peerProbes counts the probes of a peer since the start of its window
+type peerProbes struct {
+	since time.Time
+	count int
+}
+
+// Probe is the measured throughput of the link from a peer
+type Probe struct {
+	Throughput float64 `json:"throughput"` // Bytes per second
+	Relayed    bool    `json:"relayed"`
+}
+
+// Estimate returns how long size bytes take at the measured throughput
+func (p Probe) Estimate(size int64) time.Duration {
+	if p.Throughput <= 0 {
+		return 0
+	}
+	return time.Duration(float64(size) / p.Throughput * float64(time.Second))
+}
+
+// ProbeThroughput asks p, which sends with code, to send ProbeSize bytes
+// and measures how fast they arrive. p learns the result through OnProbe
+// and PeerProbe.
+func (n *Node) ProbeThroughput(ctx context.Context, p peer.ID, code string) (Probe, error) {
+	s, err := n.Host.NewStream(ctx, p, protocol.ID(ProbeProtocolID))
+	if err != nil {
+		return Probe{}, err
+	}
+	defer s.Close()
+	result := Probe{Relayed: IsRelayedConn(s.Conn())}
+
+	s.SetReadDeadline(time.Now().Add(probeTimeout))
+	nonce := make([]byte, probeNonceSize)
+	if _, err := io.ReadFull(s, nonce); err != nil {
+		s.Reset()
+		return result, err
+	}
+	request := append(probeProof(code, nonce, n.Host.ID(), p), 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(request[len(request)-4:], ProbeSize)
+	if _, err := s.Write(request); err != nil {
+		s.Reset()
+		return result, err
+	}
+	start := time.Now()
+	s.SetReadDeadline(start.Add(probeTimeout))
+	var received int64
+	for {
+		var n uint32
+		if err := binary.Read(s, binary.BigEndian, &n); err != nil {
+			s.Reset()
+			return result, err
+		}
+		if n == 0 {
+			break
+		}
+		if _, err := io.CopyN(io.Discard, s, int64(n)); err != nil {
+			s.Reset()
+			return result, err
+		}
+		received += int64(n)
+	}
+	result.Throughput = float64(received) / time.Since(start).Seconds()
+
+	// The sender acknowledges once it stored the result, so it knows it
+	// before the transfer stream opens
+	if err := binary.Write(s, binary.BigEndian, math.Float64bits(result.Throughput)); err == nil {
+		io.ReadFull(s, make([]byte, 1))
+	}
+	return result, nil
+}
+
+// handleProbe sends the random data a peer asked for with ProbeThroughput,
+// if it knows the code set with SetProbeCode and did not probe too often
+func (n *Node) handleProbe(s network.Stream) {
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(probeTimeout))
+
+	n.mu.Lock()
+	code := n.probeCode
+	n.mu.Unlock()
+	if code == "" {
+		s.Reset()
+		return
+	}
+	nonce := make([]byte, probeNonceSize)
+	rand.Read(nonce)
+	if _, err := s.Write(nonce); err != nil {
+		s.Reset()
+		return
+	}
+	request := make([]byte, probeProofSize+4)
+	if _, err := io.ReadFull(s, request); err != nil {
+		s.Reset()
+		return
+	}
+	p := s.Conn().RemotePeer()
+	proof, size := request[:len(request)-4], binary.BigEndian.Uint32(request[len(request)-4:])
+	if subtle.ConstantTimeCompare(proof, probeProof(code, nonce, p, n.Host.ID())) != 1 || size > maxProbeSize || !n.allowProbe(p) {
+		s.Reset()
+		return
+	}
+	// Data goes in chunks with their length first, an empty one ends it
+	buf := make([]byte, 4+probeChunkSize)
+	start := time.Now()
+	for sent := 0; sent < int(size) && time.Since(start) < probeDuration; sent += probeChunkSize {
+		chunk := buf[:4+min(probeChunkSize, int(size)-sent)]
+		binary.BigEndian.PutUint32(chunk, uint32(len(chunk)-4))
+		rand.Read(chunk[4:])
+		if _, err := s.Write(chunk); err != nil {
+			s.Reset()
+			return
+		}
+	}
+	if err := binary.Write(s, binary.BigEndian, uint32(0)); err != nil {
+		s.Reset()
+		return
+	}
+
+	var bits uint64
+	if err := binary.Read(s, binary.BigEndian, &bits); err != nil {
+		return
+	}
+	probe := Probe{Throughput: math.Float64frombits(bits), Relayed: IsRelayedConn(s.Conn())}
+	n.mu.Lock()
+	if n.probes == nil {
+		n.probes = make(map[peer.ID]Probe)
+	}
+	n.probes[p] = probe
+	n.mu.Unlock()
+	if n.OnProbe != nil {
+		n.OnProbe(p, probe)
+	}
+	s.Write([]byte{1})
+}
+
+// allowProbe counts a probe of p, false if it ran maxPeerProbes within
+// probeWindow already
+func (n *Node) allowProbe(p peer.ID) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	now := time.Now()
+	if n.probed == nil {
+		n.probed = make(map[peer.ID]*peerProbes)
+	}
+	for id, pp := range n.probed {
+		if now.Sub(pp.since) > probeWindow {
+			delete(n.probed, id)
+		}
+	}
+	pp := n.probed[p]
+	if pp == nil {
+		pp = &peerProbes{since: now}
+		n.probed[p] = pp
+	}
+	if pp.count >= maxPeerProbes {
+		return false
+	}
+	pp.count++
+	return true
+}
+
+// SetProbeCode lets receivers that know code measure the link with
+// ProbeThroughput. Probes are refused before it is set.
+func (n *Node) SetProbeCode(code string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.probeCode = code
+}
+
+// PeerProbe returns the last throughput p measured with ProbeThroughput
+func (n *Node) PeerProbe(p peer.ID) (Probe, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	probe, ok := n.probes[p]
+	return probe, ok
+}
@@ -0,0 +1,77 @@
+package p2p
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestProbeThroughput(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	sender, receiver := newTCPNode(t, ctx), newTCPNode(t, ctx)
+	sender.SetStreamHandler(func(s network.Stream) { s.Close() })
+	reported := make(chan Probe, 1)
+	sender.OnProbe = func(p peer.ID, probe Probe) {
+		if p != receiver.Host.ID() {
+			t.Errorf("OnProbe() peer = %s, want the receiver", p)
+		}
+		reported <- probe
+	}
+	if err := receiver.Host.Connect(ctx, peer.AddrInfo{ID: sender.Host.ID(), Addrs: sender.Host.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only receivers that know the code may probe
+	if _, err := receiver.ProbeThroughput(ctx, sender.Host.ID(), "123-456"); err == nil {
+		t.Error("ProbeThroughput() succeeded before the sender set a code")
+	}
+	sender.SetProbeCode("123-456")
+	if _, err := receiver.ProbeThroughput(ctx, sender.Host.ID(), "654-321"); err == nil {
+		t.Error("ProbeThroughput() succeeded with a wrong code")
+	}
+
+	probe, err := receiver.ProbeThroughput(ctx, sender.Host.ID(), "123-456")
+	if err != nil {
+		t.Fatalf("ProbeThroughput() error = %v", err)
+	}
+	if probe.Throughput <= 0 || probe.Relayed {
+		t.Errorf("ProbeThroughput() = %+v", probe)
+	}
+	if got, ok := sender.PeerProbe(receiver.Host.ID()); !ok || got != probe {
+		t.Errorf("PeerProbe() = %+v, %v, want %+v", got, ok, probe)
+	}
+	select {
+	case got := <-reported:
+		if got != probe {
+			t.Errorf("Sender learned %+v, receiver measured %+v", got, probe)
+		}
+	case <-ctx.Done():
+		t.Fatal("Sender did not learn the result")
+	}
+
+	// Each peer only gets a few probes
+	for i := 1; i < maxPeerProbes; i++ {
+		if _, err := receiver.ProbeThroughput(ctx, sender.Host.ID(), "123-456"); err != nil {
+			t.Fatalf("Probe %d error = %v", i+1, err)
+		}
+		<-reported
+	}
+	if _, err := receiver.ProbeThroughput(ctx, sender.Host.ID(), "123-456"); err == nil {
+		t.Errorf("ProbeThroughput() succeeded more than %d times", maxPeerProbes)
+	}
+}
+
+func TestProbeEstimate(t *testing.T) {
+	p := Probe{Throughput: 12 << 20}
+	if got := p.Estimate(12 << 20 * 60); got != time.Minute {
+		t.Errorf("Estimate() = %v, want 1m", got)
+	}
+	if got := (Probe{}).Estimate(1 << 20); got != 0 {
+		t.Errorf("Estimate() without a measurement = %v, want 0", got)
+	}
+}
@@ -0,0 +1,179 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sync/atomic"
+
+	"github.com/libp2p/go-libp2p"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/transport"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"golang.org/x/net/proxy"
+)
+
+// parseProxy checks a proxy URL such as socks5://127.0.0.1:9050 and returns
+// a dialer for it
+func parseProxy(rawURL string) (proxy.ContextDialer, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q: want socks5://host:port", rawURL)
+	}
+	if u.Scheme != "socks5" && u.Scheme != "socks5h" {
+		return nil, fmt.Errorf("unsupported proxy %q: only socks5 is supported", rawURL)
+	}
+	d, err := proxy.FromURL(u, proxy.Direct)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", rawURL, err)
+	}
+	return d.(proxy.ContextDialer), nil
+}
+
+// proxyOptions sets up a host that only makes TCP connections through the
+// proxy and never listens. It is reachable through relays alone, so peers
+// learn neither its IP addresses nor it theirs.
+func proxyOptions(dialer proxy.ContextDialer, dhtRef *atomic.Pointer[dht.IpfsDHT]) []libp2p.Option {
+	return []libp2p.Option{
+		libp2p.NoTransports,
+		libp2p.Transport(func(upgrader transport.Upgrader, rcmgr network.ResourceManager) *proxyTransport {
+			return &proxyTransport{dialer: dialer, upgrader: upgrader, rcmgr: rcmgr}
+		}),
+		libp2p.NoListenAddrs,
+		libp2p.AddrsFactory(relayAddrs),
+		libp2p.ForceReachabilityPrivate(),
+		libp2p.EnableAutoRelayWithPeerSource(func(ctx context.Context, num int) <-chan peer.AddrInfo {
+			return relayCandidates(dhtRef.Load(), num)
+		}),
+	}
+}
+
+// relayAddrs keeps the relay addresses only, such as an address observed by
+// a peer, which would be the proxy's
+func relayAddrs(addrs []multiaddr.Multiaddr) []multiaddr.Multiaddr {
+	var relayed []multiaddr.Multiaddr
+	for _, addr := range addrs {
+		if isRelayedAddr(addr) {
+			relayed = append(relayed, addr)
+		}
+	}
+	return relayed
+}
+
+// relayCandidates offers DHT peers for relay reservations, which autorelay
+// checks for relay support
+func relayCandidates(kadDHT *dht.IpfsDHT, num int) <-chan peer.AddrInfo {
+	ch := make(chan peer.AddrInfo, num)
+	defer close(ch)
+	if kadDHT == nil {
+		return ch
+	}
+	h := kadDHT.Host()
+	for _, p := range kadDHT.RoutingTable().ListPeers() {
+		if len(ch) == num {
+			break
+		}
+		ch <- h.Peerstore().PeerInfo(p)
+	}
+	return ch
+}
+
+// proxyTransport dials TCP addresses through a SOCKS5 proxy. Host names are
+// resolved by the proxy, so lookups do not leak either.
+type proxyTransport struct {
+	dialer   proxy.ContextDialer
+	upgrader transport.Upgrader
+	rcmgr    network.ResourceManager
+}
+
+var _ transport.Transport = &proxyTransport{}
+
+func (t *proxyTransport) Dial(ctx context.Context, raddr multiaddr.Multiaddr, p peer.ID) (transport.CapableConn, error) {
+	target, err := proxyTarget(raddr)
+	if err != nil {
+		return nil, err
+	}
+	scope, err := t.rcmgr.OpenConnection(network.DirOutbound, true, raddr)
+	if err != nil {
+		return nil, err
+	}
+	if err := scope.SetPeer(p); err != nil {
+		scope.Done()
+		return nil, err
+	}
+	conn, err := t.dialer.DialContext(ctx, "tcp", target)
+	if err != nil {
+		scope.Done()
+		return nil, fmt.Errorf("proxy dial to %s failed: %w", target, err)
+	}
+	laddr, err := manet.FromNetAddr(conn.LocalAddr())
+	if err != nil {
+		conn.Close()
+		scope.Done()
+		return nil, err
+	}
+	c, err := t.upgrader.Upgrade(ctx, t, &proxyConn{Conn: conn, laddr: laddr, raddr: raddr}, network.DirOutbound, p, scope)
+	if err != nil {
+		scope.Done()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (t *proxyTransport) CanDial(addr multiaddr.Multiaddr) bool {
+	_, err := proxyTarget(addr)
+	return err == nil
+}
+
+// SkipResolve leaves DNS addresses to the proxy
+func (t *proxyTransport) SkipResolve(ctx context.Context, addr multiaddr.Multiaddr) bool {
+	return true
+}
+
+func (t *proxyTransport) Listen(laddr multiaddr.Multiaddr) (transport.Listener, error) {
+	return nil, fmt.Errorf("cannot listen on %s through a proxy", laddr)
+}
+
+func (t *proxyTransport) Protocols() []int {
+	return []int{multiaddr.P_TCP}
+}
+
+func (t *proxyTransport) Proxy() bool {
+	return false
+}
+
+// proxyTarget returns the host:port the proxy connects to for a TCP address
+func proxyTarget(addr multiaddr.Multiaddr) (string, error) {
+	protos := addr.Protocols()
+	if len(protos) < 2 || len(protos) > 3 || protos[1].Code != multiaddr.P_TCP ||
+		(len(protos) == 3 && protos[2].Code != multiaddr.P_P2P) {
+		return "", fmt.Errorf("cannot dial %s through a proxy", addr)
+	}
+	switch protos[0].Code {
+	case multiaddr.P_IP4, multiaddr.P_IP6, multiaddr.P_DNS, multiaddr.P_DNS4, multiaddr.P_DNS6:
+	default:
+		return "", fmt.Errorf("cannot dial %s through a proxy", addr)
+	}
+	host, err := addr.ValueForProtocol(protos[0].Code)
+	if err != nil {
+		return "", err
+	}
+	port, err := addr.ValueForProtocol(multiaddr.P_TCP)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// proxyConn reports the dialed peer address instead of the proxy's
+type proxyConn struct {
+	net.Conn
+	laddr, raddr multiaddr.Multiaddr
+}
+
+func (c *proxyConn) LocalMultiaddr() multiaddr.Multiaddr  { return c.laddr }
+func (c *proxyConn) RemoteMultiaddr() multiaddr.Multiaddr { return c.raddr }
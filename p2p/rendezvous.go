@@ -0,0 +1,153 @@
+package p2p
+
+import (
+	"context"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"golang.org/x/crypto/argon2"
+)
+
+// legacyRendezvousUntil ends the transition from codeToRendezvous. Until
+// then senders also advertise there and receivers also look there, for
+// peers running older versions.
+var legacyRendezvousUntil = time.Date(2027, time.April, 1, 0, 0, 0, 0, time.UTC)
+
+// rendezvousSkew is how far the clocks of sender and receiver may be apart
+// around midnight UTC, when the day salting the rendezvous changes
+const rendezvousSkew = 10 * time.Minute
+
+// rendezvousKey derives where a code is advertised on day, a UTC date in
+// the form 2006-01-02. Unlike codeToRendezvous it is slow to derive and
+// salted with the day, so finding the codes in use on the DHT would take
+// deriving every possible code again each day.
+func rendezvousKey(code, day string) string {
+	key := argon2.IDKey([]byte(code), []byte("2c1f-rendezvous:"+day), 1, 64*1024, 4, 16)
+	return RendezvousNS + "/v2/" + hex.EncodeToString(key)
+}
+
+// rendezvousDays returns the days a receiver looks up at now, more than one
+// when the sender's clock may be on the other side of midnight
+func rendezvousDays(now time.Time) []string {
+	var days []string
+	for _, t := range []time.Time{now.Add(-rendezvousSkew), now, now.Add(rendezvousSkew)} {
+		day := t.UTC().Format(time.DateOnly)
+		if len(days) == 0 || days[len(days)-1] != day {
+			days = append(days, day)
+		}
+	}
+	return days
+}
+
+// rendezvousCache keeps the keys derived with rendezvousKey, as senders
+// advertise and receivers look up the same ones again and again. Only keys
+// of the day asked for and the days next to it are kept, so codes used
+// earlier do not stay in memory.
+type rendezvousCache struct {
+	mu   sync.Mutex
+	day  string // The day asked for last
+	keys map[[2]string]string
+}
+
+func (c *rendezvousCache) key(code, day string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key, ok := c.keys[[2]string{code, day}]; ok {
+		return key
+	}
+	if c.keys == nil {
+		c.keys = make(map[[2]string]string)
+	}
+	if day != c.day {
+		c.day = day
+		c.evict(day)
+	}
+	key := rendezvousKey(code, day)
+	c.keys[[2]string{code, day}] = key
+	return key
+}
+
+// evict drops the keys of days more than a day away from day
+func (c *rendezvousCache) evict(day string) {
+	t, err := time.Parse(time.DateOnly, day)
+	if err != nil {
+		return
+	}
+	near := map[string]bool{day: true}
+	for _, d := range []int{-1, 1} {
+		near[t.AddDate(0, 0, d).Format(time.DateOnly)] = true
+	}
+	for k := range c.keys {
+		if !near[k[1]] {
+			delete(c.keys, k)
+		}
+	}
+}
+
+// advertisedRendezvous returns where a sender advertises code at now
+func (n *Node) advertisedRendezvous(code string, now time.Time) []string {
+	keys := []string{n.rendezvous.key(code, now.UTC().Format(time.DateOnly))}
+	if now.Before(legacyRendezvousUntil) {
+		keys = append(keys, codeToRendezvous(code))
+	}
+	return keys
+}
+
+// lookupRendezvous returns where a receiver looks for code at now
+func (n *Node) lookupRendezvous(code string, now time.Time) []string {
+	var keys []string
+	for _, day := range rendezvousDays(now) {
+		keys = append(keys, n.rendezvous.key(code, day))
+	}
+	if now.Before(legacyRendezvousUntil) {
+		keys = append(keys, codeToRendezvous(code))
+	}
+	return keys
+}
+
+// AdvertiseDecoys advertises codes nobody sends, so scanning the DHT for
+// codes in use also turns up ones that lead nowhere. Receivers that try
+// them are refused like any with a wrong code. It is best-effort.
+func (n *Node) AdvertiseDecoys(codes []string) {
+	for _, code := range codes {
+		n.Advertise(code)
+	}
+}
+
+// findProviders looks up all of rendezvous at once and merges the peers
+// found. It fails only if none of the lookups could start.
+func (n *Node) findProviders(ctx context.Context, rendezvous []string) (<-chan peer.AddrInfo, error) {
+	merged := make(chan peer.AddrInfo)
+	var wg sync.WaitGroup
+	var err error
+	started := 0
+	for _, r := range rendezvous {
+		peers, findErr := n.Discovery.FindPeers(ctx, r)
+		if findErr != nil {
+			err = findErr
+			continue
+		}
+		started++
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range peers {
+				select {
+				case merged <- p:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+	if started == 0 && err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
@@ -0,0 +1,84 @@
+package p2p
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRendezvousKey(t *testing.T) {
+	key := rendezvousKey("123-456", "2026-10-15")
+	if !strings.HasPrefix(key, RendezvousNS+"/v2/") {
+		t.Errorf("Unexpected format %q", key)
+	}
+	if key != rendezvousKey("123-456", "2026-10-15") {
+		t.Error("rendezvousKey is not deterministic")
+	}
+	for _, other := range []string{rendezvousKey("123-457", "2026-10-15"), rendezvousKey("123-456", "2026-10-16"), codeToRendezvous("123-456")} {
+		if key == other {
+			t.Errorf("Key %q is not unique", key)
+		}
+	}
+}
+
+func TestRendezvousDays(t *testing.T) {
+	tests := []struct {
+		now  time.Time
+		want []string
+	}{
+		{time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC), []string{"2026-10-15"}},
+		{time.Date(2026, 10, 15, 0, 5, 0, 0, time.UTC), []string{"2026-10-14", "2026-10-15"}},
+		{time.Date(2026, 10, 15, 23, 55, 0, 0, time.UTC), []string{"2026-10-15", "2026-10-16"}},
+	}
+	for _, tt := range tests {
+		got := rendezvousDays(tt.now)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("rendezvousDays(%v) = %v, want %v", tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestRendezvousTransition(t *testing.T) {
+	n := &Node{}
+	code := "123-456"
+	before := legacyRendezvousUntil.Add(-time.Hour)
+	after := legacyRendezvousUntil.Add(time.Hour)
+
+	advertised := n.advertisedRendezvous(code, before)
+	if len(advertised) != 2 || advertised[1] != codeToRendezvous(code) {
+		t.Errorf("Before the transition ends advertised at %v, want the legacy rendezvous too", advertised)
+	}
+	if advertised := n.advertisedRendezvous(code, after); len(advertised) != 1 {
+		t.Errorf("After the transition advertised at %v, want one rendezvous", advertised)
+	}
+
+	// Receivers look wherever a sender with a clock a bit off advertises,
+	// also just after midnight
+	now := legacyRendezvousUntil.Add(2 * time.Minute)
+	lookup := n.lookupRendezvous(code, now)
+	for _, skew := range []time.Duration{-rendezvousSkew / 2, 0, rendezvousSkew / 2} {
+		key := n.advertisedRendezvous(code, now.Add(skew))[0]
+		if !strings.Contains(strings.Join(lookup, " "), key) {
+			t.Errorf("Sender off by %v advertises at %s, not looked up in %v", skew, key, lookup)
+		}
+	}
+}
+
+func TestRendezvousCacheEvicts(t *testing.T) {
+	var c rendezvousCache
+	c.key("123-456", "2026-10-15")
+	c.key("123-456", "2026-10-16")
+	c.key("654-321", "2026-10-15")
+	if len(c.keys) != 3 {
+		t.Fatalf("Cached %d keys of neighbouring days, want 3", len(c.keys))
+	}
+	c.key("654-321", "2026-10-17")
+	for k := range c.keys {
+		if k[1] < "2026-10-16" {
+			t.Errorf("Key of %s for %s still cached on 2026-10-17", k[1], k[0])
+		}
+	}
+	if len(c.keys) != 2 {
+		t.Errorf("Cached %d keys on 2026-10-17, want 2", len(c.keys))
+	}
+}
@@ -0,0 +1,29 @@
+package p2p
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"lukechampine.com/blake3"
+)
+
+// ShortAuthString derives a 6-digit code from both peer IDs and the connection
+// code. Both ends see the same value only if they are talking to each other
+// directly; a man-in-the-middle who guessed the code has a different peer ID
+// on each side. The argument order does not matter.
+func ShortAuthString(a, b peer.ID, code string) string {
+	first, second := a.String(), b.String()
+	if first > second {
+		first, second = second, first
+	}
+
+	sum := blake3.Sum256([]byte("2c1f-sas\x00" + code + "\x00" + first + "\x00" + second))
+	n := binary.BigEndian.Uint32(sum[:4]) % 1000000
+	return fmt.Sprintf("%03d %03d", n/1000, n%1000)
+}
+
+// ShortAuthString returns the short authentication string for a connection to remote
+func (n *Node) ShortAuthString(remote peer.ID, code string) string {
+	return ShortAuthString(n.Host.ID(), remote, code)
+}
@@ -0,0 +1,42 @@
+package p2p
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func newTestPeerID(t *testing.T) peer.ID {
+	t.Helper()
+	_, pub, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestShortAuthString(t *testing.T) {
+	sender, receiver, attacker := newTestPeerID(t), newTestPeerID(t), newTestPeerID(t)
+
+	sas := ShortAuthString(sender, receiver, "apple-banana-cherry")
+	if !regexp.MustCompile(`^\d{3} \d{3}$`).MatchString(sas) {
+		t.Errorf("Unexpected format %q", sas)
+	}
+	if other := ShortAuthString(receiver, sender, "apple-banana-cherry"); other != sas {
+		t.Errorf("Both ends must agree: %q != %q", sas, other)
+	}
+	if other := ShortAuthString(sender, receiver, "apple-banana-grape"); other == sas {
+		t.Error("Different codes should give a different string")
+	}
+
+	// A man-in-the-middle shows different strings on each side
+	if ShortAuthString(sender, attacker, "apple-banana-cherry") == ShortAuthString(attacker, receiver, "apple-banana-cherry") {
+		t.Error("Intercepted connections should not produce matching strings")
+	}
+}
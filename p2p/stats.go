@@ -0,0 +1,117 @@
+package p2p
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/libp2p/go-libp2p/p2p/net/nat"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// PortMapping is a port the router forwards to the node after a UPnP or
+// NAT-PMP request
+type PortMapping struct {
+	Protocol     string        `json:"protocol"` // "tcp" or "udp"
+	InternalPort int           `json:"internalPort"`
+	ExternalAddr string        `json:"externalAddr"` // IP and port on the router
+	Lease        time.Duration `json:"lease"`        // Renewed well before it runs out
+}
+
+// Stats is the network state of a node
+type Stats struct {
+	Addrs       []string      `json:"addrs"`       // Addresses announced to peers
+	Peers       int           `json:"peers"`       // Connected peers
+	Bootstrap   string        `json:"bootstrap"`   // Bootstrap set connected through, empty if none
+	PortMapping bool          `json:"portMapping"` // UPnP and NAT-PMP are enabled
+	Gateway     bool          `json:"gateway"`     // A router that maps ports was found
+	Mappings    []PortMapping `json:"mappings"`
+}
+
+// Stats reports the addresses, peers and port mappings of the node
+func (n *Node) Stats() Stats {
+	s := Stats{Peers: len(n.Host.Network().Peers()), Bootstrap: n.BootstrapSetName(), Mappings: []PortMapping{}}
+	for _, addr := range n.Host.Addrs() {
+		s.Addrs = append(s.Addrs, addr.String())
+	}
+	if n.nat == nil {
+		return s
+	}
+	s.PortMapping = true
+	s.Gateway = n.nat.HasDiscoveredNAT()
+
+	// Transports on the same UDP port share its mapping
+	seen := make(map[string]bool)
+	for _, addr := range n.Host.Network().ListenAddresses() {
+		mapped := n.nat.GetMapping(addr)
+		if mapped == nil {
+			continue
+		}
+		m, ok := portMapping(addr, mapped)
+		if !ok || seen[m.Protocol+m.ExternalAddr] {
+			continue
+		}
+		seen[m.Protocol+m.ExternalAddr] = true
+		s.Mappings = append(s.Mappings, m)
+	}
+	sort.Slice(s.Mappings, func(i, j int) bool {
+		return s.Mappings[i].Protocol+s.Mappings[i].ExternalAddr < s.Mappings[j].Protocol+s.Mappings[j].ExternalAddr
+	})
+	return s
+}
+
+// portMapping describes the mapping of the listen address addr to mapped
+func portMapping(addr, mapped multiaddr.Multiaddr) (PortMapping, bool) {
+	for _, proto := range []struct {
+		name string
+		code int
+	}{{"tcp", multiaddr.P_TCP}, {"udp", multiaddr.P_UDP}} {
+		internal, err := addr.ValueForProtocol(proto.code)
+		if err != nil {
+			continue
+		}
+		port, err := strconv.Atoi(internal)
+		if err != nil {
+			return PortMapping{}, false
+		}
+		external, err := mapped.ValueForProtocol(proto.code)
+		if err != nil {
+			return PortMapping{}, false
+		}
+		ip, err := mapped.ValueForProtocol(multiaddr.P_IP4)
+		if err != nil {
+			if ip, err = mapped.ValueForProtocol(multiaddr.P_IP6); err != nil {
+				return PortMapping{}, false
+			}
+		}
+		return PortMapping{
+			Protocol:     proto.name,
+			InternalPort: port,
+			ExternalAddr: net.JoinHostPort(ip, external),
+			Lease:        nat.MappingDuration,
+		}, true
+	}
+	return PortMapping{}, false
+}
+
+// CheckNetwork starts a node with cfg, connects it to the bootstrap peers
+// and reports its state once the router had wait to map its ports
+func CheckNetwork(ctx context.Context, cfg Config, wait time.Duration) (Stats, error) {
+	node, err := NewNodeWithConfig(ctx, cfg)
+	if err != nil {
+		return Stats{}, err
+	}
+	defer node.Close()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	bootErr := node.Bootstrap()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return node.Stats(), ctx.Err()
+	}
+	return node.Stats(), bootErr
+}
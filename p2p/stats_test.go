@@ -0,0 +1,71 @@
+package p2p
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/multiformats/go-multiaddr"
+)
+
+// fakeNAT maps every TCP and UDP port to the same port on 203.0.113.7
+type fakeNAT struct{}
+
+func (fakeNAT) GetMapping(addr multiaddr.Multiaddr) multiaddr.Multiaddr {
+	for _, code := range []int{multiaddr.P_TCP, multiaddr.P_UDP} {
+		if port, err := addr.ValueForProtocol(code); err == nil {
+			return multiaddr.StringCast("/ip4/203.0.113.7/" + multiaddr.ProtocolWithCode(code).Name + "/" + port)
+		}
+	}
+	return nil
+}
+func (fakeNAT) HasDiscoveredNAT() bool { return true }
+func (fakeNAT) Close() error           { return nil }
+
+func TestStats(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	node, err := NewNodeWithConfig(ctx, Config{Listen: []string{"127.0.0.1"}, Port: 0, NoPortMap: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+	if s := node.Stats(); s.PortMapping || s.Gateway || len(s.Mappings) != 0 || len(s.Addrs) == 0 {
+		t.Errorf("Stats() with port mapping off = %+v", s)
+	}
+
+	node.nat = fakeNAT{}
+	s := node.Stats()
+	if !s.PortMapping || !s.Gateway {
+		t.Errorf("Stats() = %+v, want port mapping and a gateway", s)
+	}
+	protocols := make(map[string]int)
+	seen := make(map[string]bool)
+	for _, m := range s.Mappings {
+		protocols[m.Protocol]++
+		if seen[m.Protocol+m.ExternalAddr] {
+			t.Errorf("Mapping %+v listed twice", m)
+		}
+		seen[m.Protocol+m.ExternalAddr] = true
+	}
+	if protocols["tcp"] != 1 || protocols["udp"] == 0 {
+		t.Fatalf("Mappings = %+v, want one for TCP and the UDP ports", s.Mappings)
+	}
+	for _, m := range s.Mappings {
+		if m.InternalPort == 0 || m.ExternalAddr == "" || m.Lease <= 0 {
+			t.Errorf("Incomplete mapping %+v", m)
+		}
+	}
+}
+
+func TestPortMappingEnabled(t *testing.T) {
+	node, err := NewNodeWithConfig(context.Background(), Config{Listen: []string{"127.0.0.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+	if !node.Stats().PortMapping {
+		t.Error("Port mapping off by default")
+	}
+}
@@ -0,0 +1,64 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ErrWithdrawn is returned by FindPeer when the senders found for a code
+// withdrew it with Withdraw and no other one could be reached
+var ErrWithdrawn = errors.New("the sender cancelled this transfer")
+
+// WithdrawTimeout bounds publishing the tombstone of a withdrawn code
+const WithdrawTimeout = 5 * time.Second
+
+// tombstoneLookupTimeout bounds the search for tombstones in FindPeer
+const tombstoneLookupTimeout = 10 * time.Second
+
+// withdrawnRendezvous is where a sender announces that the code it
+// advertised at rendezvous was cancelled
+func withdrawnRendezvous(rendezvous string) string {
+	return rendezvous + "/withdrawn"
+}
+
+// Withdraw announces that the transfer on code was cancelled. Provider
+// records cannot be deleted and keep pointing at this node until they
+// expire, so it publishes a tombstone next to them instead, which makes
+// receivers that find them fail with ErrWithdrawn rather than wait for
+// the lookup to time out. Callers stop advertising code first and refuse
+// handshakes while this runs. It is best-effort and gives up after
+// WithdrawTimeout.
+func (n *Node) Withdraw(code string) error {
+	ctx, cancel := context.WithTimeout(n.Ctx, WithdrawTimeout)
+	defer cancel()
+	// Older receivers do not look for tombstones
+	rendezvous := n.advertisedRendezvous(code, time.Now())[0]
+	if _, err := n.Discovery.Advertise(ctx, withdrawnRendezvous(rendezvous)); err != nil {
+		return fmt.Errorf("failed to withdraw code: %w", err)
+	}
+	return nil
+}
+
+// withdrawnPeers returns the peers that withdrew the code they advertised
+// at one of rendezvous
+func (n *Node) withdrawnPeers(rendezvous []string) map[peer.ID]bool {
+	ctx, cancel := context.WithTimeout(n.Ctx, min(n.findTimeout(), tombstoneLookupTimeout))
+	defer cancel()
+	withdrawn := make(map[peer.ID]bool)
+	tombstones := make([]string, len(rendezvous))
+	for i, r := range rendezvous {
+		tombstones[i] = withdrawnRendezvous(r)
+	}
+	peers, err := n.findProviders(ctx, tombstones)
+	if err != nil {
+		return withdrawn
+	}
+	for p := range peers {
+		withdrawn[p.ID] = true
+	}
+	return withdrawn
+}
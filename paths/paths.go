@@ -0,0 +1,173 @@
+// Package paths locates the files 2c1f keeps between runs: configuration in
+// the platform's config folder (~/.config/2c1f, ~/Library/Application
+// Support/2c1f or %AppData%\2c1f), data such as the history in the data
+// folder (~/.local/share/2c1f on Linux, the config folder elsewhere) and
+// caches in the cache folder. Files left in the home folder by older
+// versions are moved there the first time they are used.
+package paths
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// App is the name of the folder of 2c1f inside the platform's folders
+const App = "2c1f"
+
+// PortableDir is the folder next to the executable that holds all files in
+// portable mode
+const PortableDir = "2c1f-data"
+
+var (
+	baseDir string
+	mu      sync.Mutex // Serializes migrations
+)
+
+// SetBaseDir keeps all files in dir instead of the platform's folders. Must
+// be called before any of them is read.
+func SetBaseDir(dir string) {
+	baseDir = dir
+}
+
+// BaseDir returns the folder set with SetBaseDir, empty if there is none
+func BaseDir() string {
+	return baseDir
+}
+
+// InitPortable keeps all files in PortableDir next to the executable, so
+// the app runs from a USB stick without leaving anything on the machine.
+// That is the case if portable is set, which creates the folder, or a
+// portable run created it before. Returns whether the app is portable.
+func InitPortable(portable bool) (bool, error) {
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		if portable {
+			return false, fmt.Errorf("failed to locate the executable: %w", err)
+		}
+		return false, nil
+	}
+	dir := filepath.Join(filepath.Dir(exe), PortableDir)
+
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		SetBaseDir(dir)
+		return true, nil
+	}
+	if !portable {
+		return false, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return false, fmt.Errorf("failed to create portable data folder: %w", err)
+	}
+	SetBaseDir(dir)
+	return true, nil
+}
+
+// ConfigDir returns the folder of the configuration files
+func ConfigDir() string {
+	if baseDir != "" {
+		return baseDir
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, App)
+}
+
+// DataDir returns the folder of the history, sessions and other data
+func DataDir() string {
+	if baseDir != "" {
+		return baseDir
+	}
+	switch runtime.GOOS {
+	case "windows", "darwin", "ios", "plan9":
+		return ConfigDir()
+	}
+	if dir := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, App)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".local", "share", App)
+}
+
+// CacheDir returns the folder of files that can be rebuilt when deleted
+func CacheDir() string {
+	if baseDir != "" {
+		return filepath.Join(baseDir, "cache")
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, App)
+}
+
+// Config returns the path of the configuration file called name. A file
+// older versions kept in the home folder as legacy, such as
+// ".2c1f-settings.json", is moved there first.
+func Config(name, legacy string) string {
+	return locate(ConfigDir(), name, legacy)
+}
+
+// Data returns the path of the data file or folder called name, moving it
+// from legacy like Config
+func Data(name, legacy string) string {
+	return locate(DataDir(), name, legacy)
+}
+
+// Cache returns the path of the cache file called name
+func Cache(name string) string {
+	return locate(CacheDir(), name, "")
+}
+
+// locate returns the path of name in dir, creating dir and moving the file
+// from its legacy path if it is only there. The legacy path is returned if
+// it cannot be moved, so its contents are not lost.
+func locate(dir, name, legacy string) string {
+	path := filepath.Join(dir, name)
+	if dir == "" {
+		return path
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return path
+	}
+	if legacy == "" {
+		return path
+	}
+	oldPath := filepath.Join(legacyDir(), legacy)
+	if _, err := os.Lstat(path); err == nil {
+		return path
+	}
+	if _, err := os.Lstat(oldPath); err != nil {
+		return path
+	}
+	if err := os.Rename(oldPath, path); err != nil {
+		return oldPath
+	}
+	return path
+}
+
+// legacyDir is where older versions kept the files, the home folder or the
+// portable folder
+func legacyDir() string {
+	if baseDir != "" {
+		return baseDir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return home
+}
@@ -0,0 +1,76 @@
+package paths
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// setHome points the home and platform folders at a temporary folder
+func setHome(t *testing.T) string {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("AppData", filepath.Join(home, "AppData", "Roaming"))
+	t.Setenv("LocalAppData", filepath.Join(home, "AppData", "Local"))
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("XDG_CACHE_HOME", "")
+	return home
+}
+
+func TestMigrate(t *testing.T) {
+	home := setHome(t)
+	os.WriteFile(filepath.Join(home, ".2c1f-settings.json"), []byte("{}"), 0600)
+	os.MkdirAll(filepath.Join(home, ".2c1f-sessions", "abc"), 0700)
+
+	path := Config("settings.json", ".2c1f-settings.json")
+	if path != filepath.Join(ConfigDir(), "settings.json") {
+		t.Errorf("Config = %s, want it in %s", path, ConfigDir())
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "{}" {
+		t.Errorf("settings were not moved: %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".2c1f-settings.json")); err == nil {
+		t.Error("legacy settings file is still in the home folder")
+	}
+
+	sessions := Data("sessions", ".2c1f-sessions")
+	if info, err := os.Stat(filepath.Join(sessions, "abc")); err != nil || !info.IsDir() {
+		t.Errorf("sessions were not moved: %v", err)
+	}
+	if runtime.GOOS == "linux" && sessions != filepath.Join(home, ".local", "share", App, "sessions") {
+		t.Errorf("Data = %s, want it in ~/.local/share/2c1f", sessions)
+	}
+
+	// The new file wins over one an older version wrote since
+	os.WriteFile(filepath.Join(home, ".2c1f-settings.json"), []byte("old"), 0600)
+	if data, _ := os.ReadFile(Config("settings.json", ".2c1f-settings.json")); string(data) != "{}" {
+		t.Errorf("settings = %q, want the migrated ones", data)
+	}
+
+	if dir := filepath.Dir(Cache("manifests/a.json")); dir != filepath.Join(CacheDir(), "manifests") {
+		t.Errorf("Cache is in %s", dir)
+	} else if _, err := os.Stat(dir); err != nil {
+		t.Errorf("cache folder was not created: %v", err)
+	}
+}
+
+func TestBaseDir(t *testing.T) {
+	setHome(t)
+	dir := t.TempDir()
+	SetBaseDir(dir)
+	defer SetBaseDir("")
+
+	os.WriteFile(filepath.Join(dir, ".2c1f-history.json"), []byte("[]"), 0600)
+	if path := Data("history.json", ".2c1f-history.json"); path != filepath.Join(dir, "history.json") {
+		t.Errorf("Data = %s, want it in %s", path, dir)
+	}
+	if path := Config("identity.key", ".2c1f-identity.key"); path != filepath.Join(dir, "identity.key") {
+		t.Errorf("Config = %s, want it in %s", path, dir)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "history.json")); err != nil {
+		t.Errorf("history was not moved within the base folder: %v", err)
+	}
+}
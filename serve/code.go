@@ -0,0 +1,60 @@
+package serve
+
+import (
+	"os"
+	"strings"
+
+	"github.com/ebob10000/2c1f/paths"
+	"github.com/ebob10000/2c1f/words"
+)
+
+// GetCodePath returns the file that keeps the serve code stable across restarts
+func GetCodePath() string {
+	return paths.Config("serve-code", ".2c1f-serve-code")
+}
+
+// GetMailboxCodePath returns the file that keeps the mailbox code stable
+// across restarts
+func GetMailboxCodePath() string {
+	return paths.Config("mailbox-code", ".2c1f-mailbox-code")
+}
+
+// GetShareCodePath returns the file that keeps the code of 2c1f share serve
+// stable across restarts
+func GetShareCodePath() string {
+	return paths.Config("share-code", ".2c1f-share-code")
+}
+
+// LoadOrCreateCode returns the persisted serve code, generating one on first use
+func LoadOrCreateCode() (string, error) {
+	return loadOrCreateCode(GetCodePath())
+}
+
+// LoadOrCreateMailboxCode returns the persisted mailbox code, generating one
+// on first use
+func LoadOrCreateMailboxCode() (string, error) {
+	return loadOrCreateCode(GetMailboxCodePath())
+}
+
+// LoadOrCreateShareCode returns the persisted code of the named shares,
+// generating one on first use
+func LoadOrCreateShareCode() (string, error) {
+	return loadOrCreateCode(GetShareCodePath())
+}
+
+func loadOrCreateCode(path string) (string, error) {
+	if data, err := os.ReadFile(path); err == nil {
+		if code := strings.TrimSpace(string(data)); words.Validate(code) {
+			return code, nil
+		}
+	}
+
+	code, err := words.Generate()
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(code+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return code, nil
+}
@@ -0,0 +1,295 @@
+package serve
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ebob10000/2c1f/paths"
+	"github.com/ebob10000/2c1f/transfer"
+	"github.com/ebob10000/2c1f/words"
+)
+
+// ErrNoDeposit is returned for claims of deposits that do not exist, are
+// incomplete or expired
+var ErrNoDeposit = errors.New("no such deposit, it may have expired or been claimed")
+
+// Deposit is a transfer a mailbox keeps until it is claimed or expires. Its
+// files are encrypted by the sender, only their names and sizes are known.
+type Deposit struct {
+	ID         string    `json:"id"` // First half of the claim code
+	PeerID     string    `json:"peerId"`
+	FolderName string    `json:"folderName"`
+	Size       int64     `json:"size"`
+	Files      int       `json:"files"`
+	Stored     time.Time `json:"stored"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Complete   bool      `json:"complete"`
+}
+
+// Mailbox stores deposits in Dir, each in its own subdirectory next to a
+// metadata file of the same name, like Quarantine
+type Mailbox struct {
+	Dir          string
+	MaxTTL       time.Duration // Longest lifetime a sender may ask for, transfer.DefaultMailboxTTL if zero
+	MaxTotalSize int64         // Bytes of all deposits, unlimited if zero
+
+	mu       sync.Mutex
+	claimed  map[string]bool  // Deposits being sent to a receiver
+	admitted map[string]int64 // Sizes of the deposits being received
+}
+
+// DefaultMailboxDir returns the mailbox used when none is configured
+func DefaultMailboxDir() string {
+	return paths.Data("mailbox", ".2c1f-mailbox")
+}
+
+// Reserve creates the slot for a deposit from peerID, kept for ttl or
+// MaxTTL if that is zero or longer
+func (m *Mailbox) Reserve(id, peerID string, ttl time.Duration) (*Deposit, error) {
+	if err := validDepositID(id); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(m.metadataPath(id)); err == nil {
+		return nil, errors.New("claim code already in use")
+	}
+	if ttl <= 0 || ttl > m.maxTTL() {
+		ttl = m.maxTTL()
+	}
+	now := time.Now()
+	d := &Deposit{ID: id, PeerID: peerID, Stored: now, ExpiresAt: now.Add(ttl)}
+	if err := os.MkdirAll(m.Path(id), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create mailbox: %w", err)
+	}
+	if err := m.save(d); err != nil {
+		os.RemoveAll(m.Path(id))
+		return nil, err
+	}
+	return d, nil
+}
+
+// Path returns the directory a deposit is received into
+func (m *Mailbox) Path(id string) string {
+	return filepath.Join(m.Dir, id)
+}
+
+// Admit checks that the files of manifest fit into the mailbox and counts
+// them as stored in d until Complete or Remove, so deposits received at the
+// same time cannot exceed MaxTotalSize together
+func (m *Mailbox) Admit(d *Deposit, manifest *transfer.Manifest) error {
+	size := depositSize(manifest)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.MaxTotalSize > 0 {
+		used, err := m.used()
+		if err != nil {
+			return err
+		}
+		if size > m.MaxTotalSize-used {
+			return fmt.Errorf("mailbox is full, %d of %d bytes are in use", used, m.MaxTotalSize)
+		}
+	}
+	if m.admitted == nil {
+		m.admitted = make(map[string]int64)
+	}
+	m.admitted[d.ID] = size
+	return nil
+}
+
+// depositSize returns the bytes manifest takes, the sum of its files if
+// that is more than the total it states
+func depositSize(manifest *transfer.Manifest) int64 {
+	var sum int64
+	for _, f := range manifest.Files {
+		if f.Size > math.MaxInt64-sum {
+			return math.MaxInt64
+		}
+		sum += f.Size
+	}
+	return max(sum, manifest.TotalSize)
+}
+
+// used returns the bytes of the stored deposits and those being received.
+// m.mu must be held.
+func (m *Mailbox) used() (int64, error) {
+	deposits, err := m.List()
+	if err != nil {
+		return 0, err
+	}
+	var used int64
+	for _, d := range deposits {
+		if d.Complete {
+			used += d.Size
+		}
+	}
+	for _, size := range m.admitted {
+		used += size
+	}
+	return used, nil
+}
+
+// Complete records that the deposit finished receiving
+func (m *Mailbox) Complete(d *Deposit, manifest *transfer.Manifest) error {
+	d.FolderName = manifest.FolderName
+	d.Size = depositSize(manifest)
+	d.Files = len(manifest.Files)
+	d.Complete = true
+	err := m.save(d)
+	m.mu.Lock()
+	delete(m.admitted, d.ID)
+	m.mu.Unlock()
+	return err
+}
+
+// Claim returns a complete deposit that has not expired and marks it as
+// being claimed until Release, so two receivers cannot claim it at once
+func (m *Mailbox) Claim(id string) (*Deposit, error) {
+	if err := validDepositID(id); err != nil {
+		return nil, err
+	}
+	d, err := m.load(id)
+	if err != nil || !d.Complete || time.Now().After(d.ExpiresAt) {
+		return nil, ErrNoDeposit
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.claimed[id] {
+		return nil, errors.New("deposit is being claimed")
+	}
+	if m.claimed == nil {
+		m.claimed = make(map[string]bool)
+	}
+	m.claimed[id] = true
+	return d, nil
+}
+
+// Release ends a claim, deleting the deposit if it was delivered
+func (m *Mailbox) Release(id string, delivered bool) error {
+	m.mu.Lock()
+	delete(m.claimed, id)
+	m.mu.Unlock()
+	if !delivered {
+		return nil
+	}
+	return m.Remove(id)
+}
+
+// FolderPath returns the received folder or file of a complete deposit
+func (m *Mailbox) FolderPath(d *Deposit) string {
+	return filepath.Join(m.Path(d.ID), d.FolderName)
+}
+
+// Remove deletes a deposit and everything received for it
+func (m *Mailbox) Remove(id string) error {
+	if err := validDepositID(id); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	delete(m.admitted, id)
+	m.mu.Unlock()
+	if err := os.RemoveAll(m.Path(id)); err != nil {
+		return err
+	}
+	if err := os.Remove(m.metadataPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Expire removes the deposits that expired and returns how many
+func (m *Mailbox) Expire() (int, error) {
+	deposits, err := m.List()
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	removed := 0
+	for _, d := range deposits {
+		m.mu.Lock()
+		claimed := m.claimed[d.ID]
+		m.mu.Unlock()
+		if claimed || now.Before(d.ExpiresAt) {
+			continue
+		}
+		if err := m.Remove(d.ID); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// List returns the deposits, oldest first
+func (m *Mailbox) List() ([]Deposit, error) {
+	entries, err := os.ReadDir(m.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var deposits []Deposit
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), metadataExt) {
+			continue
+		}
+		d, err := m.load(strings.TrimSuffix(e.Name(), metadataExt))
+		if err != nil {
+			continue
+		}
+		deposits = append(deposits, *d)
+	}
+	sort.Slice(deposits, func(i, j int) bool { return deposits[i].Stored.Before(deposits[j].Stored) })
+	return deposits, nil
+}
+
+func (m *Mailbox) maxTTL() time.Duration {
+	if m.MaxTTL <= 0 {
+		return transfer.DefaultMailboxTTL
+	}
+	return m.MaxTTL
+}
+
+// validDepositID rejects IDs that could escape the mailbox directory
+func validDepositID(id string) error {
+	if !words.Validate(id) {
+		return errors.New("invalid claim code")
+	}
+	return nil
+}
+
+func (m *Mailbox) metadataPath(id string) string {
+	return filepath.Join(m.Dir, id+metadataExt)
+}
+
+func (m *Mailbox) load(id string) (*Deposit, error) {
+	data, err := os.ReadFile(m.metadataPath(id))
+	if err != nil {
+		return nil, err
+	}
+	var d Deposit
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (m *Mailbox) save(d *Deposit) error {
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(m.metadataPath(d.ID), data, 0600); err != nil {
+		return fmt.Errorf("failed to save mailbox record: %w", err)
+	}
+	return nil
+}
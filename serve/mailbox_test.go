@@ -0,0 +1,148 @@
+package serve
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMailboxClaim(t *testing.T) {
+	m := &Mailbox{Dir: t.TempDir(), MaxTTL: time.Hour}
+
+	d, err := m.Reserve("123-456-789", "peer", 48*time.Hour)
+	if err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+	if d.ExpiresAt.After(time.Now().Add(time.Hour)) {
+		t.Errorf("ExpiresAt = %v, want at most MaxTTL from now", d.ExpiresAt)
+	}
+	if _, err := m.Reserve("123-456-789", "other", 0); err == nil {
+		t.Error("expected reserving a claim code in use to fail")
+	}
+	if _, err := m.Claim(d.ID); !errors.Is(err, ErrNoDeposit) {
+		t.Errorf("Claim() of an incomplete deposit error = %v", err)
+	}
+
+	received := filepath.Join(m.Path(d.ID), "test", "a.jpg")
+	if err := os.MkdirAll(filepath.Dir(received), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(received, []byte("jpg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Complete(d, manifest(3, "a.jpg")); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+
+	claimed, err := m.Claim(d.ID)
+	if err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+	if m.FolderPath(claimed) != filepath.Dir(received) {
+		t.Errorf("FolderPath() = %s, want %s", m.FolderPath(claimed), filepath.Dir(received))
+	}
+	if _, err := m.Claim(d.ID); err == nil {
+		t.Error("expected a second claim at the same time to fail")
+	}
+
+	// An interrupted claim can be tried again
+	if err := m.Release(d.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Claim(d.ID); err != nil {
+		t.Fatalf("Claim() after a failed delivery error = %v", err)
+	}
+	if err := m.Release(d.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Claim(d.ID); !errors.Is(err, ErrNoDeposit) {
+		t.Errorf("Claim() of a delivered deposit error = %v", err)
+	}
+	if deposits, _ := m.List(); len(deposits) != 0 {
+		t.Errorf("mailbox not empty after delivery: %+v", deposits)
+	}
+}
+
+func TestMailboxExpire(t *testing.T) {
+	m := &Mailbox{Dir: t.TempDir()}
+	old, err := m.Reserve("111-111-111", "peer", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Reserve("222-222-222", "peer", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	old.ExpiresAt = time.Now().Add(-time.Minute)
+	if err := m.Complete(old, manifest(1, "a")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Claim(old.ID); !errors.Is(err, ErrNoDeposit) {
+		t.Errorf("Claim() of an expired deposit error = %v", err)
+	}
+	removed, err := m.Expire()
+	if err != nil || removed != 1 {
+		t.Fatalf("Expire() = %d, %v, want 1", removed, err)
+	}
+	deposits, _ := m.List()
+	if len(deposits) != 1 || deposits[0].ID != "222-222-222" {
+		t.Errorf("List() after Expire() = %+v", deposits)
+	}
+	if _, err := os.Stat(m.Path(old.ID)); !os.IsNotExist(err) {
+		t.Errorf("expired deposit left files behind: %v", err)
+	}
+}
+
+func TestMailboxRejectsInvalidIDs(t *testing.T) {
+	m := &Mailbox{Dir: t.TempDir()}
+	for _, id := range []string{"", "../etc", "123-456-78/"} {
+		if _, err := m.Reserve(id, "peer", 0); err == nil {
+			t.Errorf("Reserve(%q) should fail", id)
+		}
+		if _, err := m.Claim(id); err == nil {
+			t.Errorf("Claim(%q) should fail", id)
+		}
+		if err := m.Remove(id); err == nil {
+			t.Errorf("Remove(%q) should fail", id)
+		}
+	}
+}
+
+func TestMailboxAdmit(t *testing.T) {
+	m := &Mailbox{Dir: t.TempDir(), MaxTotalSize: 10}
+	a, _ := m.Reserve("111-111-111", "peer", time.Hour)
+	b, _ := m.Reserve("222-222-222", "peer", time.Hour)
+
+	if err := m.Admit(a, manifest(6, "a.jpg")); err != nil {
+		t.Fatalf("Admit() error = %v", err)
+	}
+	// Deposits being received count as well as stored ones
+	if err := m.Admit(b, manifest(6, "b.jpg")); err == nil {
+		t.Error("expected deposits over MaxTotalSize together to be refused")
+	}
+	if err := m.Complete(a, manifest(6, "a.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Admit(b, manifest(6, "b.jpg")); err == nil {
+		t.Error("expected a deposit that does not fit next to a stored one to be refused")
+	}
+	// The sizes of the files count if the total stated is less
+	lie := manifest(0, "b.jpg")
+	lie.Files[0].Size = 6
+	if err := m.Admit(b, lie); err == nil {
+		t.Error("expected the sizes of the files to count")
+	}
+	if err := m.Admit(b, manifest(4, "b.jpg")); err != nil {
+		t.Errorf("Admit() of a deposit that fits error = %v", err)
+	}
+
+	if err := m.Remove(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	c, _ := m.Reserve("333-333-333", "peer", time.Hour)
+	if err := m.Admit(c, manifest(6, "c.jpg")); err != nil {
+		t.Errorf("Admit() after removing a deposit error = %v", err)
+	}
+}
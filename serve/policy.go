@@ -0,0 +1,115 @@
+package serve
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ebob10000/2c1f/transfer"
+)
+
+// QuotaWindow is the sliding window per-sender quotas are counted over
+const QuotaWindow = time.Hour
+
+// Policy limits what an unattended receiver accepts
+type Policy struct {
+	MaxBytesPerHour   int64    // Per sender, 0 for unlimited
+	MaxFilesPerHour   int      // Per sender, 0 for unlimited
+	BlockedExtensions []string // Case-insensitive, with or without the leading dot
+}
+
+// Limiter enforces a Policy and tracks per-sender usage
+type Limiter struct {
+	policy  Policy
+	blocked []string
+
+	mu    sync.Mutex
+	usage map[string][]usage
+	now   func() time.Time
+}
+
+type usage struct {
+	at    time.Time
+	bytes int64
+	files int
+}
+
+func NewLimiter(policy Policy) *Limiter {
+	var blocked []string
+	for _, ext := range policy.BlockedExtensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		blocked = append(blocked, ext)
+	}
+	return &Limiter{
+		policy:  policy,
+		blocked: blocked,
+		usage:   make(map[string][]usage),
+		now:     time.Now,
+	}
+}
+
+// Admit checks an incoming manifest against the policy and, if accepted,
+// counts it against the sender's quota. Usage is counted up front so a sender
+// cannot exceed the quota by aborting and retrying transfers.
+func (l *Limiter) Admit(sender string, m *transfer.Manifest) error {
+	for _, f := range m.Files {
+		if ext := l.blockedExtension(f.Path); ext != "" {
+			return fmt.Errorf("%s has blocked extension %s", f.Path, ext)
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	bytes, files := l.recentUsage(sender, now)
+
+	if l.policy.MaxBytesPerHour > 0 && bytes+m.TotalSize > l.policy.MaxBytesPerHour {
+		return fmt.Errorf("sender exceeded quota of %s per hour (%s used)",
+			transfer.FormatBytes(l.policy.MaxBytesPerHour), transfer.FormatBytes(bytes))
+	}
+	if l.policy.MaxFilesPerHour > 0 && files+len(m.Files) > l.policy.MaxFilesPerHour {
+		return fmt.Errorf("sender exceeded quota of %d files per hour (%d used)", l.policy.MaxFilesPerHour, files)
+	}
+
+	l.usage[sender] = append(l.usage[sender], usage{at: now, bytes: m.TotalSize, files: len(m.Files)})
+	return nil
+}
+
+func (l *Limiter) blockedExtension(path string) string {
+	name := strings.ToLower(path)
+	for _, ext := range l.blocked {
+		if strings.HasSuffix(name, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// recentUsage sums the sender's usage within QuotaWindow and drops older entries
+func (l *Limiter) recentUsage(sender string, now time.Time) (int64, int) {
+	var bytes int64
+	var files int
+	entries := l.usage[sender][:0]
+	for _, u := range l.usage[sender] {
+		if now.Sub(u.at) >= QuotaWindow {
+			continue
+		}
+		entries = append(entries, u)
+		bytes += u.bytes
+		files += u.files
+	}
+	if len(entries) == 0 {
+		delete(l.usage, sender)
+	} else {
+		l.usage[sender] = entries
+	}
+	return bytes, files
+}
@@ -0,0 +1,56 @@
+package serve
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ebob10000/2c1f/transfer"
+)
+
+func manifest(size int64, paths ...string) *transfer.Manifest {
+	m := &transfer.Manifest{FolderName: "test", TotalSize: size}
+	for _, p := range paths {
+		m.Files = append(m.Files, transfer.FileEntry{Path: p})
+	}
+	return m
+}
+
+func TestLimiterBlockedExtensions(t *testing.T) {
+	l := NewLimiter(Policy{BlockedExtensions: []string{"EXE", ".tar.gz", " "}})
+
+	if err := l.Admit("peer", manifest(1, "docs/readme.txt")); err != nil {
+		t.Errorf("Admit() = %v, want accepted", err)
+	}
+	if err := l.Admit("peer", manifest(1, "bin/Setup.Exe")); err == nil {
+		t.Error("expected .exe to be blocked")
+	}
+	if err := l.Admit("peer", manifest(1, "backup.tar.gz")); err == nil {
+		t.Error("expected .tar.gz to be blocked")
+	}
+}
+
+func TestLimiterQuotas(t *testing.T) {
+	now := time.Now()
+	l := NewLimiter(Policy{MaxBytesPerHour: 100, MaxFilesPerHour: 3})
+	l.now = func() time.Time { return now }
+
+	if err := l.Admit("a", manifest(60, "1", "2")); err != nil {
+		t.Fatalf("first transfer rejected: %v", err)
+	}
+	if err := l.Admit("a", manifest(60, "3")); err == nil {
+		t.Error("expected byte quota to be exceeded")
+	}
+	if err := l.Admit("a", manifest(10, "3", "4")); err == nil {
+		t.Error("expected file quota to be exceeded")
+	}
+	// Quotas are per sender
+	if err := l.Admit("b", manifest(60, "1")); err != nil {
+		t.Errorf("other sender rejected: %v", err)
+	}
+
+	// Usage expires after the window
+	now = now.Add(QuotaWindow)
+	if err := l.Admit("a", manifest(100, "1", "2", "3")); err != nil {
+		t.Errorf("transfer after window rejected: %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package serve
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ebob10000/2c1f/paths"
+	"github.com/ebob10000/2c1f/transfer"
+)
+
+const metadataExt = ".json"
+
+// Held is a transfer kept in quarantine until it is approved
+type Held struct {
+	ID         string    `json:"id"`
+	PeerID     string    `json:"peerId"`
+	FolderName string    `json:"folderName"`
+	Size       int64     `json:"size"`
+	Files      int       `json:"files"`
+	Received   time.Time `json:"received"`
+	Dest       string    `json:"dest"` // Directory the transfer moves to once approved
+	Complete   bool      `json:"complete"`
+}
+
+// ReleasePath returns where the transfer is moved on approval
+func (h *Held) ReleasePath() string {
+	return filepath.Join(h.Dest, h.FolderName)
+}
+
+// Quarantine stores incoming transfers in Dir, each in its own subdirectory
+// next to a metadata file of the same name
+type Quarantine struct {
+	Dir string
+}
+
+// DefaultQuarantineDir returns the quarantine used when none is configured
+func DefaultQuarantineDir() string {
+	return paths.Data("quarantine", ".2c1f-quarantine")
+}
+
+// Hold reserves a quarantine slot for a transfer from peerID that will be
+// released into dest on approval
+func (q *Quarantine) Hold(peerID, dest string) (*Held, error) {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	h := &Held{
+		ID:       hex.EncodeToString(id),
+		PeerID:   peerID,
+		Received: time.Now(),
+		Dest:     dest,
+	}
+	if err := os.MkdirAll(q.Path(h.ID), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create quarantine: %w", err)
+	}
+	if err := q.save(h); err != nil {
+		os.RemoveAll(q.Path(h.ID))
+		return nil, err
+	}
+	return h, nil
+}
+
+// Path returns the directory a held transfer is received into
+func (q *Quarantine) Path(id string) string {
+	return filepath.Join(q.Dir, id)
+}
+
+// Complete records that the held transfer finished receiving
+func (q *Quarantine) Complete(h *Held, m *transfer.Manifest) error {
+	h.FolderName = m.FolderName
+	h.Size = m.TotalSize
+	h.Files = len(m.Files)
+	h.Complete = true
+	return q.save(h)
+}
+
+// Discard removes a held transfer and everything received for it
+func (q *Quarantine) Discard(id string) error {
+	if err := q.validID(id); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(q.Path(id)); err != nil {
+		return err
+	}
+	if err := os.Remove(q.metadataPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List returns the held transfers, oldest first
+func (q *Quarantine) List() ([]Held, error) {
+	entries, err := os.ReadDir(q.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var held []Held
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), metadataExt) {
+			continue
+		}
+		h, err := q.load(strings.TrimSuffix(e.Name(), metadataExt))
+		if err != nil {
+			continue
+		}
+		held = append(held, *h)
+	}
+	sort.Slice(held, func(i, j int) bool { return held[i].Received.Before(held[j].Received) })
+	return held, nil
+}
+
+// Approve moves a completed transfer out of quarantine to its ReleasePath
+func (q *Quarantine) Approve(id string) (*Held, error) {
+	if err := q.validID(id); err != nil {
+		return nil, err
+	}
+	h, err := q.load(id)
+	if err != nil {
+		return nil, fmt.Errorf("no quarantined transfer %s", id)
+	}
+	if !h.Complete {
+		return nil, fmt.Errorf("transfer %s has not finished receiving", id)
+	}
+
+	target := h.ReleasePath()
+	if _, err := os.Stat(target); err == nil {
+		return nil, fmt.Errorf("%s already exists", target)
+	}
+	if err := os.MkdirAll(h.Dest, 0755); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(filepath.Join(q.Path(id), h.FolderName), target); err != nil {
+		return nil, fmt.Errorf("failed to release transfer: %w", err)
+	}
+	return h, q.Discard(id)
+}
+
+// validID rejects IDs that could escape the quarantine directory
+func (q *Quarantine) validID(id string) error {
+	if _, err := hex.DecodeString(id); err != nil || id == "" {
+		return errors.New("invalid quarantine ID")
+	}
+	return nil
+}
+
+func (q *Quarantine) metadataPath(id string) string {
+	return filepath.Join(q.Dir, id+metadataExt)
+}
+
+func (q *Quarantine) load(id string) (*Held, error) {
+	data, err := os.ReadFile(q.metadataPath(id))
+	if err != nil {
+		return nil, err
+	}
+	var h Held
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+func (q *Quarantine) save(h *Held) error {
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(q.metadataPath(h.ID), data, 0600); err != nil {
+		return fmt.Errorf("failed to save quarantine record: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package serve
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQuarantineApprove(t *testing.T) {
+	q := &Quarantine{Dir: t.TempDir()}
+	dest := t.TempDir()
+
+	h, err := q.Hold("peer", dest)
+	if err != nil {
+		t.Fatalf("Hold() error = %v", err)
+	}
+
+	// Simulate the receiver writing into the slot
+	received := filepath.Join(q.Path(h.ID), "photos", "a.jpg")
+	if err := os.MkdirAll(filepath.Dir(received), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(received, []byte("jpg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := q.Approve(h.ID); err == nil {
+		t.Error("expected approving an incomplete transfer to fail")
+	}
+
+	m := manifest(3, "a.jpg")
+	m.FolderName = "photos"
+	if err := q.Complete(h, m); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+
+	held, err := q.List()
+	if err != nil || len(held) != 1 || !held[0].Complete {
+		t.Fatalf("List() = %+v, %v, want one complete transfer", held, err)
+	}
+
+	approved, err := q.Approve(h.ID)
+	if err != nil {
+		t.Fatalf("Approve() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "photos", "a.jpg")); err != nil {
+		t.Errorf("released file missing: %v", err)
+	}
+	if approved.ReleasePath() != filepath.Join(dest, "photos") {
+		t.Errorf("ReleasePath() = %s", approved.ReleasePath())
+	}
+	if held, _ := q.List(); len(held) != 0 {
+		t.Errorf("quarantine not empty after approval: %+v", held)
+	}
+}
+
+func TestQuarantineRejectsInvalidIDs(t *testing.T) {
+	q := &Quarantine{Dir: t.TempDir()}
+	for _, id := range []string{"", "../etc", "zz"} {
+		if _, err := q.Approve(id); err == nil {
+			t.Errorf("Approve(%q) should fail", id)
+		}
+		if err := q.Discard(id); err == nil {
+			t.Errorf("Discard(%q) should fail", id)
+		}
+	}
+}
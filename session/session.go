@@ -0,0 +1,215 @@
+// Package session persists the state of a running send so that it can be
+// resumed with the same code after the sender process exits.
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ebob10000/2c1f/paths"
+	"github.com/ebob10000/2c1f/transfer"
+)
+
+// saveInterval limits how often progress is written to disk
+const saveInterval = 2 * time.Second
+
+// ErrNotFound is returned for unknown session IDs
+var ErrNotFound = errors.New("session not found")
+
+// Session is a send that has not completed yet
+type Session struct {
+	ID       string             `json:"id"`
+	Path     string             `json:"path"`
+	Code     string             `json:"code"`
+	Compress bool               `json:"compress"`
+	Manifest *transfer.Manifest `json:"manifest"`
+	Created  time.Time          `json:"created"`
+	Updated  time.Time          `json:"updated"`
+	// Sent holds the bytes sent of each file, per receiver peer ID
+	Sent map[string]map[string]int64 `json:"sent"`
+
+	dir       string
+	mu        sync.Mutex
+	lastSaved time.Time
+}
+
+// GetSessionsPath returns the directory sessions are stored in
+func GetSessionsPath() string {
+	return paths.Data("sessions", ".2c1f-sessions")
+}
+
+// Create starts a new session in dir and saves it
+func Create(dir, path, code string, compress bool, m *transfer.Manifest) (*Session, error) {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	s := &Session{
+		ID:       hex.EncodeToString(id),
+		Path:     absPath,
+		Code:     code,
+		Compress: compress,
+		Manifest: m,
+		Created:  now,
+		Updated:  now,
+		Sent:     make(map[string]map[string]int64),
+		dir:      dir,
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create session directory: %w", err)
+	}
+	return s, s.Save()
+}
+
+// Load reads the session with the given ID from dir
+func Load(dir, id string) (*Session, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(dir, id+".json"))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid session file: %w", err)
+	}
+	if s.Manifest == nil {
+		return nil, fmt.Errorf("session %s has no manifest", id)
+	}
+	if s.Sent == nil {
+		s.Sent = make(map[string]map[string]int64)
+	}
+	s.dir = dir
+	return &s, nil
+}
+
+// List returns the sessions in dir, most recently updated first
+func List(dir string) ([]*Session, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sessions []*Session
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok {
+			continue
+		}
+		if s, err := Load(dir, id); err == nil {
+			sessions = append(sessions, s)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Updated.After(sessions[j].Updated) })
+	return sessions, nil
+}
+
+// Save writes the session to disk
+func (s *Session) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save()
+}
+
+func (s *Session) save() error {
+	s.Updated = time.Now()
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %w", err)
+	}
+	path := filepath.Join(s.dir, s.ID+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	s.lastSaved = s.Updated
+	return os.Rename(tmp, path)
+}
+
+// Progress records the bytes of file sent to peer. It matches
+// transfer.Sender.OnProgress once the peer is bound and saves at most every
+// few seconds.
+func (s *Session) Progress(peer, file string, sent int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files := s.Sent[peer]
+	if files == nil {
+		files = make(map[string]int64)
+		s.Sent[peer] = files
+	}
+	files[file] = sent
+	if time.Since(s.lastSaved) >= saveInterval {
+		s.save()
+	}
+}
+
+// SentTo returns the total bytes sent to peer
+func (s *Session) SentTo(peer string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var total int64
+	for _, n := range s.Sent[peer] {
+		total += n
+	}
+	return total
+}
+
+// Delete removes the finished session
+func (s *Session) Delete() error {
+	err := os.Remove(filepath.Join(s.dir, s.ID+".json"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// CheckSource reports an error if a file of the manifest changed size since
+// the session was created
+func (s *Session) CheckSource() error {
+	info, err := os.Stat(s.Path)
+	if err != nil {
+		return fmt.Errorf("cannot access %s: %w", s.Path, err)
+	}
+	for _, entry := range s.Manifest.Files {
+		path := s.Path
+		if info.IsDir() {
+			path = transfer.ResolveName(filepath.Join(s.Path, filepath.FromSlash(entry.Path)))
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("%s is missing: %w", entry.Path, err)
+		}
+		if fi.Size() != entry.Size {
+			return fmt.Errorf("%s changed since the session started", entry.Path)
+		}
+	}
+	return nil
+}
+
+func validID(id string) bool {
+	if id == "" {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
@@ -0,0 +1,125 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ebob10000/2c1f/transfer"
+)
+
+func testManifest(t *testing.T) (string, *transfer.Manifest) {
+	t.Helper()
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := &transfer.Manifest{
+		FolderName: filepath.Base(src),
+		TotalSize:  5,
+		Files:      []transfer.FileEntry{{Path: "a.txt", Size: 5}},
+	}
+	return src, m
+}
+
+func TestCreateLoadDelete(t *testing.T) {
+	dir := t.TempDir()
+	src, m := testManifest(t)
+
+	s, err := Create(dir, src, "123-456", true, m)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	s.Progress("peerA", "a.txt", 3)
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := Load(dir, s.ID)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded.Code != "123-456" || !loaded.Compress || loaded.Path != src {
+		t.Errorf("Unexpected session %+v", loaded)
+	}
+	if got := loaded.SentTo("peerA"); got != 3 {
+		t.Errorf("SentTo = %d, want 3", got)
+	}
+	if err := loaded.CheckSource(); err != nil {
+		t.Errorf("CheckSource failed: %v", err)
+	}
+
+	list, err := List(dir)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("List = %v, %v", list, err)
+	}
+
+	if err := loaded.Delete(); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := Load(dir, s.ID); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+}
+
+func TestCheckSourceDetectsChanges(t *testing.T) {
+	dir := t.TempDir()
+	src, m := testManifest(t)
+	s, err := Create(dir, src, "123-456", false, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(src, "a.txt"), []byte("changed!"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CheckSource(); err == nil {
+		t.Error("Expected CheckSource to fail after the file changed")
+	}
+}
+
+func TestLoadRejectsInvalidID(t *testing.T) {
+	if _, err := Load(t.TempDir(), "../etc"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+// TestProgressPerReceiver checks that the bytes sent to each receiver
+// survive a restart apart from the others
+func TestProgressPerReceiver(t *testing.T) {
+	dir := t.TempDir()
+	src, m := testManifest(t)
+	s, err := Create(dir, src, "123-456", false, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Progress("peerA", "a.txt", 2)
+	s.Progress("peerB", "a.txt", 4)
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The send is resumed and only peerA comes back
+	resumed, err := Load(dir, s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed.Progress("peerA", "a.txt", 5)
+	if err := resumed.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(dir, s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.SentTo("peerA"); got != 5 {
+		t.Errorf("SentTo(peerA) = %d, want 5", got)
+	}
+	if got := loaded.SentTo("peerB"); got != 4 {
+		t.Errorf("SentTo(peerB) = %d, want 4 as before the restart", got)
+	}
+	if got := loaded.SentTo("peerC"); got != 0 {
+		t.Errorf("SentTo(peerC) = %d, want 0", got)
+	}
+}
@@ -0,0 +1,83 @@
+package settings
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Keys returns the names of the settings in the settings file, such as
+// "compress" or "updateChannel", sorted
+func Keys() []string {
+	values, _ := DefaultSettings().values()
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		if key != "profiles" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Get returns the value of the setting key, named as in the settings file
+func (s AppSettings) Get(key string) (any, error) {
+	values, err := s.values()
+	if err != nil {
+		return nil, err
+	}
+	value, ok := values[key]
+	if !ok || key == "profiles" {
+		return nil, fmt.Errorf("unknown setting %q", key)
+	}
+	return value, nil
+}
+
+// Set returns the settings with key set to value, parsed as the type of the
+// setting. "on" and "off" stand for true and false, as in profiles.
+func (s AppSettings) Set(key, value string) (AppSettings, error) {
+	current, err := s.Get(key)
+	if err != nil {
+		return s, err
+	}
+	var parsed any
+	switch current.(type) {
+	case bool:
+		switch strings.ToLower(value) {
+		case "on":
+			value = "true"
+		case "off":
+			value = "false"
+		}
+		parsed, err = strconv.ParseBool(value)
+	case float64:
+		parsed, err = strconv.Atoi(value)
+	default:
+		parsed = value
+	}
+	if err != nil {
+		return s, fmt.Errorf("invalid value %q for %s", value, key)
+	}
+
+	data, err := json.Marshal(map[string]any{key: parsed})
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("invalid value %q for %s", value, key)
+	}
+	return s, nil
+}
+
+// values returns the settings keyed by their names in the settings file
+func (s AppSettings) values() (map[string]any, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]any
+	err = json.Unmarshal(data, &values)
+	return values, err
+}
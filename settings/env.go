@@ -0,0 +1,73 @@
+package settings
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvPrefix starts the names of environment variables that set options,
+// such as 2C1F_COMPRESS=true for -compress. Shells cannot assign such names
+// directly, but env 2C1F_COMPRESS=true 2c1f ..., docker run -e and CI
+// configurations can.
+const EnvPrefix = "2C1F_"
+
+// envAliases maps variables that have no flag of the same name to the flag
+var envAliases = map[string]string{
+	"output-dir": "o",
+}
+
+// logLevels maps the values of 2C1F_LOG_LEVEL to the flag they set
+var logLevels = map[string]string{
+	"quiet":   "q",
+	"error":   "q",
+	"normal":  "",
+	"info":    "",
+	"verbose": "v",
+	"debug":   "v",
+}
+
+// EnvFlags returns the options set in the environment, keyed by the name of
+// their command line flag: 2C1F_BOOTSTRAP_PEERS sets -bootstrap-peers,
+// 2C1F_OUTPUT_DIR sets -o and 2C1F_LOG_LEVEL sets -q or -v.
+func EnvFlags() (map[string]string, error) {
+	flags := make(map[string]string)
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		name, ok := strings.CutPrefix(strings.ToUpper(key), EnvPrefix)
+		// Empty variables count as unset, as in most tools
+		if !ok || name == "" || value == "" {
+			continue
+		}
+		flag := strings.ReplaceAll(strings.ToLower(name), "_", "-")
+		if alias, ok := envAliases[flag]; ok {
+			flag = alias
+		}
+		if flag == "log-level" {
+			level, ok := logLevels[strings.ToLower(value)]
+			if !ok {
+				return nil, fmt.Errorf("%s: invalid log level %q, must be quiet, normal or verbose", key, value)
+			}
+			if level != "" {
+				flags[level] = "true"
+			}
+			continue
+		}
+		flags[flag] = value
+	}
+	return flags, nil
+}
+
+// WithEnv returns the settings with the options set in the environment
+// applied, see EnvFlags. Options without a setting are left out.
+func (s AppSettings) WithEnv() (AppSettings, error) {
+	flags, err := EnvFlags()
+	if err != nil {
+		return s, err
+	}
+	s, err = s.withFlags(flags)
+	if err != nil {
+		return s, fmt.Errorf("environment: %w", err)
+	}
+	return s, nil
+}
@@ -0,0 +1,9 @@
+package settings
+
+import "github.com/ebob10000/2c1f/paths"
+
+// SetBaseDir keeps the settings and all other files in dir, see
+// paths.SetBaseDir
+func SetBaseDir(dir string) {
+	paths.SetBaseDir(dir)
+}
@@ -0,0 +1,152 @@
+package settings
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Profile is a named set of transfer options, such as "backup" or
+// "quick-share", keyed by the name of their command line flag. Values are
+// booleans, numbers, strings or lists of strings; "on" and "off" stand for
+// true and false.
+type Profile map[string]any
+
+// Flags returns the options of the profile as flag values. Lists are joined
+// with commas.
+func (p Profile) Flags() (map[string]string, error) {
+	flags := make(map[string]string, len(p))
+	for name, value := range p {
+		switch v := value.(type) {
+		case bool:
+			flags[name] = strconv.FormatBool(v)
+		case float64:
+			flags[name] = strconv.FormatFloat(v, 'f', -1, 64)
+		case string:
+			switch strings.ToLower(v) {
+			case "on":
+				v = "true"
+			case "off":
+				v = "false"
+			}
+			flags[name] = v
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("option %s: list items must be strings", name)
+				}
+				items[i] = s
+			}
+			flags[name] = strings.Join(items, ",")
+		default:
+			return nil, fmt.Errorf("option %s: unsupported value %v", name, value)
+		}
+	}
+	return flags, nil
+}
+
+// ProfileNames returns the names of the saved profiles, sorted
+func (s AppSettings) ProfileNames() []string {
+	names := make([]string, 0, len(s.Profiles))
+	for name := range s.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ProfileFlags returns the options of the named profile as flag values
+func (s AppSettings) ProfileFlags(name string) (map[string]string, error) {
+	p, ok := s.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q", name)
+	}
+	flags, err := p.Flags()
+	if err != nil {
+		return nil, fmt.Errorf("profile %s: %w", name, err)
+	}
+	return flags, nil
+}
+
+// WithProfile returns the settings with the options of the named profile
+// applied. Options without a setting, such as -password, are left out.
+func (s AppSettings) WithProfile(name string) (AppSettings, error) {
+	flags, err := s.ProfileFlags(name)
+	if err != nil {
+		return s, err
+	}
+	s, err = s.withFlags(flags)
+	if err != nil {
+		return s, fmt.Errorf("profile %s: %w", name, err)
+	}
+	return s, nil
+}
+
+// withFlags returns the settings with the options in flags, keyed by the
+// name of their command line flag, applied
+func (s AppSettings) withFlags(flags map[string]string) (AppSettings, error) {
+	for flag, value := range flags {
+		var err error
+		switch flag {
+		case "compress":
+			s.Compress, err = strconv.ParseBool(value)
+		case "auto-compress":
+			s.AutoCompress, err = strconv.ParseBool(value)
+		case "compress-level":
+			s.CompressLevel, err = strconv.Atoi(value)
+		case "cache-manifest":
+			s.CacheManifest, err = strconv.ParseBool(value)
+		case "skip-hash":
+			var skip bool
+			skip, err = strconv.ParseBool(value)
+			s.AutoHash = !skip
+		case "strict":
+			s.StrictVerify, err = strconv.ParseBool(value)
+		case "timeout":
+			s.Timeout, err = parseSeconds(value)
+		case "find-timeout":
+			s.FindTimeout, err = parseSeconds(value)
+		case "bootstrap-timeout":
+			s.BootstrapTimeout, err = parseSeconds(value)
+		case "retries":
+			s.Retries, err = strconv.Atoi(value)
+		case "listen":
+			s.ListenAddrs = value
+		case "port":
+			s.Port, err = strconv.Atoi(value)
+		case "proxy":
+			s.Proxy = value
+		case "no-upnp":
+			s.NoUPnP, err = strconv.ParseBool(value)
+		case "allow":
+			s.AllowPeers = value
+		case "deny":
+			s.DenyPeers = value
+		case "on-complete":
+			s.OnComplete = value
+		case "scan":
+			s.ScanCommand = value
+		case "source-limit":
+			s.SourceLimit, err = strconv.Atoi(value)
+		case "no-quarantine":
+			s.NoQuarantine, err = strconv.ParseBool(value)
+		case "keep-rejected":
+			s.KeepRejected, err = strconv.ParseBool(value)
+		}
+		if err != nil {
+			return s, fmt.Errorf("invalid value %q for %s", value, flag)
+		}
+	}
+	return s, nil
+}
+
+// parseSeconds converts a duration flag such as 2m to the seconds the
+// settings store
+func parseSeconds(value string) (int, error) {
+	d, err := time.ParseDuration(value)
+	return int(d / time.Second), err
+}
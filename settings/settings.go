@@ -2,45 +2,113 @@ package settings
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
-	"path/filepath"
+
+	"github.com/ebob10000/2c1f/paths"
 )
 
 // AppSettings contains user preferences for file transfers
 type AppSettings struct {
-	AutoHash      bool `json:"autoHash"`
-	Compress      bool `json:"compress"`
-	CacheManifest bool `json:"cacheManifest"`
+	AutoHash               bool               `json:"autoHash"`
+	Compress               bool               `json:"compress"`
+	AutoCompress           bool               `json:"autoCompress"`  // Compress on slow links with compressible files when Compress is off
+	CompressLevel          int                `json:"compressLevel"` // gzip level from 1 (fastest) to 9 (smallest)
+	CacheManifest          bool               `json:"cacheManifest"`
+	Timeout                int                `json:"timeout"`                // Stream inactivity timeout in seconds
+	Retries                int                `json:"retries"`                // Reconnection attempts on the receiver
+	FindTimeout            int                `json:"findTimeout"`            // Peer lookup timeout in seconds
+	BootstrapTimeout       int                `json:"bootstrapTimeout"`       // Per bootstrap peer connect timeout in seconds
+	UpdateChannel          string             `json:"updateChannel"`          // "stable" or "beta" to include pre-releases
+	UpdateProxy            string             `json:"updateProxy"`            // Proxy URL for update checks and downloads, environment proxy if empty
+	UpdateTimeout          int                `json:"updateTimeout"`          // Seconds to wait for update server responses or data
+	StrictVerify           bool               `json:"strictVerify"`           // Require confirming the verification code before data flows
+	BackgroundMode         bool               `json:"backgroundMode"`         // Closing the window keeps an active transfer running
+	SourceLimit            int                `json:"sourceLimit"`            // MB/s files are read at when sending, 40 on network mounts if zero, unlimited if negative
+	BackgroundRateLimit    int                `json:"backgroundRateLimit"`    // KB/s for transfers while the window is in the background, unlimited if zero
+	LanVisible             bool               `json:"lanVisible"`             // Offer sent transfers to receivers on the local network
+	DeviceName             string             `json:"deviceName"`             // Name shown to receivers on the local network, host name if empty
+	ContactDir             string             `json:"contactDir"`             // Folder for transfers from contacts, Downloads if empty
+	AutoAcceptFromContacts bool               `json:"autoAcceptFromContacts"` // Receive transfers from contacts without asking first
+	ListenAddrs            string             `json:"listenAddrs"`            // Comma separated addresses or interfaces to listen on, all if empty
+	Port                   int                `json:"port"`                   // Fixed TCP and QUIC port for transfers, random if zero
+	Proxy                  string             `json:"proxy"`                  // SOCKS5 proxy URL for peer connections, direct if empty
+	NoUPnP                 bool               `json:"noUpnp"`                 // Do not ask the router to forward ports
+	AllowPeers             string             `json:"allowPeers"`             // Comma separated peer IDs, IPs or CIDR ranges that may connect, anyone if empty
+	DenyPeers              string             `json:"denyPeers"`              // Comma separated peer IDs, IPs or CIDR ranges that may not connect
+	OnComplete             string             `json:"onComplete"`             // Command run after a transfer completes or fails, see package hooks
+	ScanCommand            string             `json:"scanCommand"`            // Virus scanner run on each received file, see hooks.Scan
+	NoQuarantine           bool               `json:"noQuarantine"`           // Do not mark received programs for Gatekeeper on macOS
+	NoQuarantineContacts   bool               `json:"noQuarantineContacts"`   // Do not mark programs received from contacts for Gatekeeper
+	KeepRejected           bool               `json:"keepRejected"`           // Move files the scanner rejects to the rejected folder instead of failing
+	HistoryEnabled         bool               `json:"historyEnabled"`         // Record transfers in the history
+	HistoryRetentionDays   int                `json:"historyRetentionDays"`   // Days transfers stay in the history, forever if zero
+	Language               string             `json:"language"`               // Language code such as "de" for messages, detected from the system if empty
+	MaxCacheMB             int                `json:"maxCacheMB"`             // Megabytes the cache folder is trimmed to, unlimited if zero
+	Profiles               map[string]Profile `json:"profiles,omitempty"`     // Named option sets chosen with -profile or in the GUI
+}
+
+// DefaultSettings returns the safe defaults used when no settings file exists
+func DefaultSettings() AppSettings {
+	return AppSettings{
+		AutoHash:               true,
+		Compress:               false,
+		AutoCompress:           true,
+		CompressLevel:          6,
+		CacheManifest:          true,
+		Timeout:                60,
+		Retries:                5,
+		FindTimeout:            30,
+		BootstrapTimeout:       30,
+		UpdateChannel:          "stable",
+		UpdateTimeout:          30,
+		HistoryEnabled:         true,
+		MaxCacheMB:             2048,
+		AutoAcceptFromContacts: true,
+	}
 }
 
 // GetSettingsPath returns the path to the settings file
 func GetSettingsPath() string {
-	home, _ := os.UserHomeDir()
-	return filepath.Join(home, ".2c1f-settings.json")
+	return paths.Config("settings.json", ".2c1f-settings.json")
 }
 
 // LoadSettings loads settings from the JSON file or returns safe defaults
 func LoadSettings() AppSettings {
-	path := GetSettingsPath()
-	data, err := os.ReadFile(path)
+	settings, err := Read()
+	if err != nil {
+		// Return safe defaults if the file is corrupted or can't be read
+		return DefaultSettings()
+	}
+	return settings
+}
+
+// Read loads the settings like LoadSettings, but returns an error if the
+// file exists and cannot be used, so it is not overwritten with defaults
+func Read() (AppSettings, error) {
+	data, err := os.ReadFile(GetSettingsPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return DefaultSettings(), nil
+	}
 	if err != nil {
-		// Return safe defaults if file doesn't exist or can't be read
-		return AppSettings{
-			AutoHash:      true,
-			Compress:      false,
-			CacheManifest: true,
-		}
+		return DefaultSettings(), err
 	}
 
-	var settings AppSettings
+	// Start from defaults so fields missing from older files keep sane values
+	settings := DefaultSettings()
 	if err := json.Unmarshal(data, &settings); err != nil {
-		// Return safe defaults if JSON is corrupted
-		return AppSettings{
-			AutoHash:      true,
-			Compress:      false,
-			CacheManifest: true,
-		}
+		return DefaultSettings(), fmt.Errorf("invalid settings file %s: %w", GetSettingsPath(), err)
 	}
+	return settings, nil
+}
 
-	return settings
+// Save writes the settings to the settings file
+func Save(s AppSettings) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(GetSettingsPath(), data, 0600)
 }
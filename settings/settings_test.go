@@ -3,6 +3,7 @@ package settings
 import (
 	"encoding/json"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -100,8 +101,8 @@ func TestGetSettingsPath(t *testing.T) {
 		t.Errorf("GetSettingsPath() returned empty string")
 	}
 
-	// Should end with .2c1f-settings.json
-	expectedSuffix := ".2c1f-settings.json"
+	// Should be settings.json in the 2c1f config folder
+	expectedSuffix := filepath.Join("2c1f", "settings.json")
 	if len(path) < len(expectedSuffix) {
 		t.Errorf("Settings path too short: %s", path)
 	}
@@ -111,3 +112,179 @@ func TestGetSettingsPath(t *testing.T) {
 		t.Errorf("Settings path doesn't end with %s, got: %s", expectedSuffix, path)
 	}
 }
+
+func TestDefaultSettings_Timeouts(t *testing.T) {
+	defaults := DefaultSettings()
+
+	if defaults.Timeout != 60 {
+		t.Errorf("Timeout = %d, want 60", defaults.Timeout)
+	}
+	if defaults.Retries != 5 {
+		t.Errorf("Retries = %d, want 5", defaults.Retries)
+	}
+	if defaults.FindTimeout != 30 {
+		t.Errorf("FindTimeout = %d, want 30", defaults.FindTimeout)
+	}
+	if defaults.BootstrapTimeout != 30 {
+		t.Errorf("BootstrapTimeout = %d, want 30", defaults.BootstrapTimeout)
+	}
+	if defaults.UpdateChannel != "stable" {
+		t.Errorf("UpdateChannel = %q, want stable", defaults.UpdateChannel)
+	}
+	if defaults.UpdateTimeout != 30 {
+		t.Errorf("UpdateTimeout = %d, want 30", defaults.UpdateTimeout)
+	}
+}
+
+func TestAppSettings_MissingFieldsKeepDefaults(t *testing.T) {
+	// Settings files written by older versions lack the timeout fields
+	settings := DefaultSettings()
+	if err := json.Unmarshal([]byte(`{"autoHash":false,"compress":true,"cacheManifest":false}`), &settings); err != nil {
+		t.Fatalf("Failed to unmarshal settings: %v", err)
+	}
+
+	if settings.Compress != true {
+		t.Errorf("Compress = %v, want true", settings.Compress)
+	}
+	if settings.Timeout != 60 {
+		t.Errorf("Timeout = %d, want default 60", settings.Timeout)
+	}
+	if settings.Retries != 5 {
+		t.Errorf("Retries = %d, want default 5", settings.Retries)
+	}
+	// Contacts' transfers were always accepted before it could be turned off
+	if !settings.AutoAcceptFromContacts {
+		t.Error("AutoAcceptFromContacts = false, want default true")
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	var s AppSettings
+	data := `{"compress":true,"autoHash":true,"profiles":{
+		"backup":{"compress":"off","skip-hash":false,"retries":10,"timeout":"2m","allow":["10.0.0.0/8","192.168.1.2"],"password":"secret"},
+		"quick-share":{"skip-hash":"on"},
+		"broken":{"compress-level":"fast"}}}`
+	if err := json.Unmarshal([]byte(data), &s); err != nil {
+		t.Fatal(err)
+	}
+
+	if names := s.ProfileNames(); len(names) != 3 || names[0] != "backup" || names[2] != "quick-share" {
+		t.Errorf("ProfileNames() = %v", names)
+	}
+
+	flags, err := s.ProfileFlags("backup")
+	if err != nil {
+		t.Fatalf("ProfileFlags() error = %v", err)
+	}
+	want := map[string]string{"compress": "false", "skip-hash": "false", "retries": "10", "allow": "10.0.0.0/8,192.168.1.2", "password": "secret"}
+	for name, value := range want {
+		if flags[name] != value {
+			t.Errorf("ProfileFlags()[%q] = %q, want %q", name, flags[name], value)
+		}
+	}
+
+	backup, err := s.WithProfile("backup")
+	if err != nil {
+		t.Fatalf("WithProfile() error = %v", err)
+	}
+	if backup.Compress || backup.Retries != 10 || backup.Timeout != 120 || backup.AllowPeers != "10.0.0.0/8,192.168.1.2" {
+		t.Errorf("WithProfile(backup) = %+v", backup)
+	}
+	if !s.Compress {
+		t.Error("WithProfile() changed the saved settings")
+	}
+	quick, _ := s.WithProfile("quick-share")
+	if quick.AutoHash {
+		t.Error("WithProfile(quick-share) kept hashing on")
+	}
+
+	if _, err := s.WithProfile("broken"); err == nil {
+		t.Error("WithProfile() accepted an invalid compression level")
+	}
+	if _, err := s.WithProfile("missing"); err == nil {
+		t.Error("WithProfile() accepted an unknown profile")
+	}
+}
+
+func TestSetBaseDir(t *testing.T) {
+	dir := t.TempDir()
+	SetBaseDir(dir)
+	defer SetBaseDir("")
+
+	// Written by a portable run of an older version
+	os.WriteFile(filepath.Join(dir, ".2c1f-settings.json"), []byte(`{"language":"de"}`), 0600)
+	if got := GetSettingsPath(); got != filepath.Join(dir, "settings.json") {
+		t.Errorf("GetSettingsPath() = %s, want it in %s", got, dir)
+	}
+	if lang := LoadSettings().Language; lang != "de" {
+		t.Errorf("Language = %q, want the one in the base folder", lang)
+	}
+}
+
+func TestWithEnv(t *testing.T) {
+	t.Setenv("2C1F_COMPRESS", "true")
+	t.Setenv("2C1F_TIMEOUT", "2m")
+	t.Setenv("2C1F_BOOTSTRAP_PEERS", "/ip4/10.0.0.1/tcp/4001/p2p/QmPeer")
+	t.Setenv("2C1F_OUTPUT_DIR", "/data")
+	t.Setenv("2C1F_LOG_LEVEL", "debug")
+
+	flags, err := EnvFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"compress":        "true",
+		"timeout":         "2m",
+		"bootstrap-peers": "/ip4/10.0.0.1/tcp/4001/p2p/QmPeer",
+		"o":               "/data",
+		"v":               "true",
+	}
+	for name, value := range want {
+		if flags[name] != value {
+			t.Errorf("flag %s = %q, want %q", name, flags[name], value)
+		}
+	}
+
+	s, err := DefaultSettings().WithEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Compress || s.Timeout != 120 {
+		t.Errorf("settings from the environment: compress %v, timeout %d", s.Compress, s.Timeout)
+	}
+
+	t.Setenv("2C1F_LOG_LEVEL", "loud")
+	if _, err := EnvFlags(); err == nil {
+		t.Error("invalid log level was accepted")
+	}
+	t.Setenv("2C1F_LOG_LEVEL", "")
+	t.Setenv("2C1F_RETRIES", "many")
+	if _, err := DefaultSettings().WithEnv(); err == nil {
+		t.Error("invalid number of retries was accepted")
+	}
+}
+
+func TestGetSet(t *testing.T) {
+	s := DefaultSettings()
+	if v, err := s.Get("compressLevel"); err != nil || v != float64(6) {
+		t.Errorf("Get(compressLevel) = %v, %v, want 6", v, err)
+	}
+	s, err := s.Set("compress", "on")
+	if err != nil || !s.Compress {
+		t.Errorf("Set(compress, on) = %v, %v", s.Compress, err)
+	}
+	if s, err = s.Set("timeout", "90"); err != nil || s.Timeout != 90 {
+		t.Errorf("Set(timeout, 90) = %d, %v", s.Timeout, err)
+	}
+	if s, err = s.Set("language", "fr"); err != nil || s.Language != "fr" {
+		t.Errorf("Set(language, fr) = %q, %v", s.Language, err)
+	}
+	for key, value := range map[string]string{"timeout": "1.5", "noUpnp": "maybe", "missing": "1", "profiles": "{}"} {
+		if _, err := s.Set(key, value); err == nil {
+			t.Errorf("Set(%s, %s) succeeded", key, value)
+		}
+	}
+	if keys := Keys(); len(keys) == 0 || keys[0] != "allowPeers" {
+		t.Errorf("Keys() = %v", keys)
+	}
+}
@@ -0,0 +1,104 @@
+// Package shares keeps the folders `2c1f share serve` offers, by name
+package shares
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ebob10000/2c1f/paths"
+	"github.com/ebob10000/2c1f/transfer"
+)
+
+// Share is a folder or file offered under a name, which receivers ask for
+type Share struct {
+	Name  string    `json:"name"`
+	Path  string    `json:"path"`
+	Added time.Time `json:"added"`
+}
+
+// ErrNotFound is returned when no share has the given name
+var ErrNotFound = errors.New("share not found")
+
+// GetSharesPath returns the path to the shares file
+func GetSharesPath() string {
+	return paths.Config("shares.json", ".2c1f-shares.json")
+}
+
+// Load reads the shares file. A missing or corrupted file yields no shares.
+func Load() []Share {
+	return loadFrom(GetSharesPath())
+}
+
+// Add saves a new share of path. Names are unique ignoring case and must
+// be valid share labels, see transfer.Catalog.
+func Add(name, path string) (Share, error) {
+	return addTo(GetSharesPath(), name, path)
+}
+
+// Remove deletes the share with the given name
+func Remove(name string) error {
+	return removeFrom(GetSharesPath(), name)
+}
+
+func addTo(file, name, path string) (Share, error) {
+	name = strings.TrimSpace(name)
+	if err := transfer.CheckShareLabel(name); err != nil {
+		return Share{}, err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return Share{}, err
+	}
+	if _, err := os.Stat(abs); err != nil {
+		return Share{}, fmt.Errorf("cannot share %s: %w", path, err)
+	}
+
+	list := loadFrom(file)
+	for _, s := range list {
+		if strings.EqualFold(s.Name, name) {
+			return Share{}, fmt.Errorf("a share named %s already exists", s.Name)
+		}
+	}
+
+	share := Share{Name: name, Path: abs, Added: time.Now()}
+	return share, saveTo(file, append(list, share))
+}
+
+func removeFrom(file, name string) error {
+	list := loadFrom(file)
+	for i, s := range list {
+		if strings.EqualFold(s.Name, name) {
+			return saveTo(file, append(list[:i], list[i+1:]...))
+		}
+	}
+	return ErrNotFound
+}
+
+func loadFrom(file string) []Share {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return []Share{}
+	}
+	var list []Share
+	if err := json.Unmarshal(data, &list); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to parse shares file: %v\n", err)
+		return []Share{}
+	}
+	return list
+}
+
+func saveTo(file string, list []Share) error {
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal shares: %w", err)
+	}
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		return fmt.Errorf("failed to save shares: %w", err)
+	}
+	return nil
+}
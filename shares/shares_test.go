@@ -0,0 +1,40 @@
+package shares
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestAddRemove(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "shares.json")
+	dir := t.TempDir()
+
+	share, err := addTo(file, "docs", dir)
+	if err != nil {
+		t.Fatalf("addTo failed: %v", err)
+	}
+	if share.Path != dir {
+		t.Errorf("Path = %s, want %s", share.Path, dir)
+	}
+	if _, err := addTo(file, "Docs", t.TempDir()); err == nil {
+		t.Error("Expected a duplicate name to be rejected")
+	}
+	for _, name := range []string{"", "a/b", "my docs"} {
+		if _, err := addTo(file, name, dir); err == nil {
+			t.Errorf("Expected name %q to be rejected", name)
+		}
+	}
+	if _, err := addTo(file, "missing", filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected a missing path to be rejected")
+	}
+
+	if list := loadFrom(file); len(list) != 1 || list[0].Name != "docs" {
+		t.Fatalf("loadFrom = %+v", list)
+	}
+	if err := removeFrom(file, "DOCS"); err != nil {
+		t.Fatalf("removeFrom failed: %v", err)
+	}
+	if err := removeFrom(file, "docs"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/ebob10000/2c1f/storage"
+)
+
+// maxListing bounds the size of a directory listing page
+const maxListing = 16 << 20
+
+var hrefPattern = regexp.MustCompile(`(?i)href\s*=\s*["']([^"'#]+)`)
+
+// httpRemote reads the files of a web server's directory listings, as
+// served by nginx autoindex, Apache mod_autoindex or python -m http.server.
+// Links ending in a slash are folders, other links to names in the folder
+// are files.
+type httpRemote struct {
+	base   *url.URL // Root folder, its path ends in a slash
+	client *http.Client
+}
+
+func newHTTP(u *url.URL) (FS, string, error) {
+	if u.Host == "" {
+		return nil, "", errors.New("http URL needs a host, such as https://host/path/")
+	}
+	r := &httpRemote{base: u, client: storage.HTTPClient()}
+	if !strings.HasSuffix(u.Path, "/") {
+		resp, err := r.request("HEAD", u, 0)
+		if err != nil {
+			return nil, "", err
+		}
+		resp.Body.Close()
+		// Servers redirect the folder without its trailing slash
+		if final := resp.Request.URL; !strings.HasSuffix(final.Path, "/") {
+			dir := *u
+			dir.Path = path.Dir(u.Path) + "/"
+			dir.RawPath = ""
+			r.base = &dir
+			name := path.Base(u.Path)
+			file := &fileInfo{name: name, size: resp.ContentLength}
+			file.modTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+			if file.size < 0 {
+				return nil, "", fmt.Errorf("server did not send the size of %s", u)
+			}
+			return newFS(single{r, file}), name, nil
+		}
+		base := *u
+		base.Path += "/"
+		base.RawPath = ""
+		r.base = &base
+	}
+	name := path.Base(strings.TrimSuffix(r.base.Path, "/"))
+	if name == "/" || name == "." {
+		name = r.base.Hostname()
+	}
+	return newFS(r), name, nil
+}
+
+// url returns the URL of the file or folder at name
+func (r *httpRemote) url(name string, dir bool) *url.URL {
+	u := *r.base
+	u.RawPath = ""
+	u.RawQuery = ""
+	if name != "." {
+		u.Path += name
+		if dir {
+			u.Path += "/"
+		}
+	}
+	return &u
+}
+
+func (r *httpRemote) request(method string, u *url.URL, offset int64) (*http.Response, error) {
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", u.Redacted(), resp.Status)
+	}
+	return resp, nil
+}
+
+func (r *httpRemote) list(dir string) ([]*fileInfo, error) {
+	dirURL := r.url(dir, true)
+	resp, err := r.request("GET", dirURL, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list folder: %w", err)
+	}
+	page, err := io.ReadAll(io.LimitReader(resp.Body, maxListing))
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list folder: %w", err)
+	}
+
+	var entries []*fileInfo
+	seen := make(map[string]bool)
+	for _, match := range hrefPattern.FindAllStringSubmatch(string(page), -1) {
+		ref, err := url.Parse(strings.TrimSpace(match[1]))
+		if err != nil || ref.RawQuery != "" {
+			continue
+		}
+		target := dirURL.ResolveReference(ref)
+		if target.Scheme != dirURL.Scheme || target.Host != dirURL.Host {
+			continue
+		}
+		name, ok := strings.CutPrefix(target.Path, dirURL.Path)
+		isDir := strings.HasSuffix(name, "/")
+		name = strings.TrimSuffix(name, "/")
+		if !ok || name == "" || strings.Contains(name, "/") || seen[name] {
+			continue
+		}
+		seen[name] = true
+		if isDir {
+			entries = append(entries, &fileInfo{name: name, dir: true})
+			continue
+		}
+
+		// Listings do not reliably show exact sizes
+		file := path.Join(dir, name)
+		resp, err := r.request("HEAD", r.url(file, false), 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up %s: %w", file, err)
+		}
+		resp.Body.Close()
+		if resp.ContentLength < 0 {
+			return nil, fmt.Errorf("server did not send the size of %s", file)
+		}
+		info := &fileInfo{name: name, size: resp.ContentLength}
+		info.modTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+		entries = append(entries, info)
+	}
+	return entries, nil
+}
+
+func (r *httpRemote) open(name string, offset int64) (io.ReadCloser, error) {
+	resp, err := r.request("GET", r.url(name, false), offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	// Servers without range support send the whole file
+	if offset > 0 && resp.StatusCode != http.StatusPartialContent {
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			resp.Body.Close()
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+	}
+	return resp.Body, nil
+}
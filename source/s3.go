@@ -0,0 +1,65 @@
+package source
+
+import (
+	"io"
+	"net/url"
+	"path"
+
+	"github.com/ebob10000/2c1f/storage"
+)
+
+// s3Remote reads the objects under the prefix of a bucket
+type s3Remote struct {
+	s *storage.S3
+}
+
+func newS3(u *url.URL) (FS, string, error) {
+	s, err := storage.NewS3(u)
+	if err != nil {
+		return nil, "", err
+	}
+	name := path.Base(s.Prefix)
+	if s.Prefix == "" {
+		name = s.Bucket
+	}
+	r := s3Remote{s}
+
+	// A prefix without anything under it may be an object of its own
+	objects, folders, err := s.List("")
+	if err != nil || len(objects) > 0 || len(folders) > 0 || s.Prefix == "" {
+		return newFS(r), name, err
+	}
+	obj, err := s.Stat("")
+	if err != nil {
+		return nil, "", err
+	}
+	parent := *s
+	parent.Prefix = path.Dir(s.Prefix)
+	if parent.Prefix == "." {
+		parent.Prefix = ""
+	}
+	file := &fileInfo{name: name, size: obj.Size, modTime: obj.ModTime}
+	return newFS(single{s3Remote{&parent}, file}), name, nil
+}
+
+func (r s3Remote) list(dir string) ([]*fileInfo, error) {
+	if dir == "." {
+		dir = ""
+	}
+	objects, folders, err := r.s.List(dir)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*fileInfo
+	for _, obj := range objects {
+		entries = append(entries, &fileInfo{name: path.Base(obj.Path), size: obj.Size, modTime: obj.ModTime})
+	}
+	for _, folder := range folders {
+		entries = append(entries, &fileInfo{name: path.Base(folder), dir: true})
+	}
+	return entries, nil
+}
+
+func (r s3Remote) open(name string, offset int64) (io.ReadCloser, error) {
+	return r.s.Read(name, offset)
+}
@@ -0,0 +1,287 @@
+// Package source reads the files to send from somewhere other than a local
+// folder, such as S3 compatible object storage or an HTTP directory
+// listing, so a server can relay remote content without staging it on disk.
+package source
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FS is a tree of files to send. Local folders (os.DirFS), files in memory
+// (fstest.MapFS) and the remote sources of New all are one.
+type FS = fs.FS
+
+// IsURL reports whether src names a remote source rather than a local path
+func IsURL(src string) bool {
+	scheme, _, ok := strings.Cut(src, "://")
+	if !ok {
+		return false
+	}
+	switch strings.ToLower(scheme) {
+	case "s3", "http", "https":
+		return true
+	}
+	return false
+}
+
+// New returns the files of a source URL and the name they are sent under:
+//
+//	s3://bucket/prefix            objects under the prefix, see storage.NewS3
+//	s3://bucket/key               a single object
+//	https://host/path/            files of a directory listing and its subfolders
+//	https://host/path/file        a single file
+//
+// A single file is the only file in the root of the returned FS.
+func New(src string) (FS, string, error) {
+	u, err := url.Parse(src)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid source URL: %w", err)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "s3":
+		return newS3(u)
+	case "http", "https":
+		return newHTTP(u)
+	}
+	return nil, "", fmt.Errorf("unsupported source URL: %s", src)
+}
+
+// remote is a file tree on a server, read through remoteFS
+type remote interface {
+	// list returns the files and folders directly in dir, "." for the root
+	list(dir string) ([]*fileInfo, error)
+	// open returns the content of the file at name from offset on
+	open(name string, offset int64) (io.ReadCloser, error)
+}
+
+// single is a remote with just one of the files of a folder
+type single struct {
+	remote
+	file *fileInfo
+}
+
+func (s single) list(dir string) ([]*fileInfo, error) {
+	if dir != "." {
+		return nil, fs.ErrNotExist
+	}
+	return []*fileInfo{s.file}, nil
+}
+
+// remoteFS is the fs.FS of a remote. Folder listings are cached, so files
+// added later are not seen.
+type remoteFS struct {
+	r remote
+
+	mu   sync.Mutex
+	dirs map[string][]*fileInfo
+}
+
+func newFS(r remote) *remoteFS {
+	return &remoteFS{r: r, dirs: make(map[string][]*fileInfo)}
+}
+
+func (f *remoteFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	info := &fileInfo{name: ".", dir: true}
+	if name != "." {
+		var err error
+		if info, err = f.stat(name); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	if info.dir {
+		return &remoteDir{fsys: f, path: name, info: info}, nil
+	}
+	return &remoteFile{fsys: f, path: name, info: info}, nil
+}
+
+func (f *remoteFS) stat(name string) (*fileInfo, error) {
+	entries, err := f.readDir(path.Dir(name))
+	if err != nil {
+		return nil, err
+	}
+	base := path.Base(name)
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].name >= base })
+	if i == len(entries) || entries[i].name != base {
+		return nil, fs.ErrNotExist
+	}
+	return entries[i], nil
+}
+
+func (f *remoteFS) readDir(dir string) ([]*fileInfo, error) {
+	f.mu.Lock()
+	entries, ok := f.dirs[dir]
+	f.mu.Unlock()
+	if ok {
+		return entries, nil
+	}
+	// Listing a folder that is not in its parent would make one up
+	if dir != "." {
+		info, err := f.stat(dir)
+		if err != nil {
+			return nil, err
+		}
+		if !info.dir {
+			return nil, errors.New("not a folder")
+		}
+	}
+	listed, err := f.r.list(dir)
+	if err != nil {
+		return nil, err
+	}
+	// Keys such as a/../b are valid on servers but cannot be files
+	entries = listed[:0]
+	for _, e := range listed {
+		if fs.ValidPath(e.name) && e.name != "." && !strings.Contains(e.name, "/") {
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	f.mu.Lock()
+	f.dirs[dir] = entries
+	f.mu.Unlock()
+	return entries, nil
+}
+
+// fileInfo describes a remote file or folder
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i *fileInfo) Name() string       { return i.name }
+func (i *fileInfo) Size() int64        { return i.size }
+func (i *fileInfo) ModTime() time.Time { return i.modTime }
+func (i *fileInfo) IsDir() bool        { return i.dir }
+func (i *fileInfo) Sys() any           { return nil }
+
+func (i *fileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (i *fileInfo) Type() fs.FileMode          { return i.Mode().Type() }
+func (i *fileInfo) Info() (fs.FileInfo, error) { return i, nil }
+
+// remoteFile reads a remote file. The request is made on the first read, so
+// seeking to resume first costs nothing.
+type remoteFile struct {
+	fsys   *remoteFS
+	path   string
+	info   *fileInfo
+	offset int64
+	body   io.ReadCloser
+	closed bool
+}
+
+func (f *remoteFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *remoteFile) Read(p []byte) (int, error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	if f.offset >= f.info.size {
+		return 0, io.EOF
+	}
+	if f.body == nil {
+		body, err := f.fsys.r.open(f.path, f.offset)
+		if err != nil {
+			return 0, err
+		}
+		f.body = body
+	}
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	if err == io.EOF && f.offset < f.info.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (f *remoteFile) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.size
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.path, Err: fs.ErrInvalid}
+	}
+	if offset != f.offset && f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *remoteFile) Close() error {
+	if f.closed {
+		return fs.ErrClosed
+	}
+	f.closed = true
+	if f.body != nil {
+		return f.body.Close()
+	}
+	return nil
+}
+
+// remoteDir lists a remote folder
+type remoteDir struct {
+	fsys    *remoteFS
+	path    string
+	info    *fileInfo
+	entries []*fileInfo // Not yet returned by ReadDir
+	listed  bool
+}
+
+func (d *remoteDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *remoteDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.path, Err: errors.New("is a folder")}
+}
+
+func (d *remoteDir) Close() error { return nil }
+
+func (d *remoteDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.listed {
+		entries, err := d.fsys.readDir(d.path)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: d.path, Err: err}
+		}
+		d.entries = entries
+		d.listed = true
+	}
+	count := len(d.entries)
+	if n > 0 && n < count {
+		count = n
+	}
+	if n > 0 && count == 0 {
+		return nil, io.EOF
+	}
+	list := make([]fs.DirEntry, count)
+	for i := range list {
+		list[i] = d.entries[i]
+	}
+	d.entries = d.entries[count:]
+	return list, nil
+}
@@ -0,0 +1,165 @@
+package source
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var files = fstest.MapFS{
+	"share/a b.txt":           {Data: []byte("hello world")},
+	"share/photos/1.jpg":      {Data: []byte("first photo")},
+	"share/photos/2024/2.jpg": {Data: []byte("second photo")},
+	"share/empty.txt":         {Data: nil},
+}
+
+func TestIsURL(t *testing.T) {
+	cases := map[string]bool{
+		"s3://bucket/prefix":  true,
+		"https://host/files/": true,
+		"HTTP://host/a.iso":   true,
+		"/home/me/photos":     false,
+		`C:\Users\me`:         false,
+		"webdav://host/dav":   false,
+		"folder/http://x":     false,
+	}
+	for src, want := range cases {
+		if got := IsURL(src); got != want {
+			t.Errorf("IsURL(%q) = %v, want %v", src, got, want)
+		}
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.FS(files)))
+	defer server.Close()
+
+	for _, src := range []string{server.URL + "/share/", server.URL + "/share"} {
+		fsys, name, err := New(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != "share" {
+			t.Errorf("name of %s = %s, want share", src, name)
+		}
+		if err := fstest.TestFS(fsys, "a b.txt", "empty.txt", "photos/1.jpg", "photos/2024/2.jpg"); err != nil {
+			t.Error(err)
+		}
+	}
+
+	fsys, name, err := New(server.URL + "/share/photos/1.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := fs.ReadFile(fsys, "1.jpg"); name != "1.jpg" || string(data) != "first photo" {
+		t.Errorf("single file %s = %q, %v", name, data, err)
+	}
+	if entries, _ := fs.ReadDir(fsys, "."); len(entries) != 1 {
+		t.Errorf("single file source has %d files, want 1", len(entries))
+	}
+
+	if _, _, err := New(server.URL + "/share/missing.txt"); err == nil {
+		t.Error("New of a missing file succeeded")
+	}
+}
+
+// TestHTTPNoRange checks resuming from servers that ignore Range requests
+func TestHTTPNoRange(t *testing.T) {
+	fileServer := http.FileServer(http.FS(files))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del("Range")
+		fileServer.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	fsys, _, err := New(server.URL + "/share/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := fsys.Open("a b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.(io.Seeker).Seek(6, io.SeekStart)
+	if data, _ := io.ReadAll(f); string(data) != "world" {
+		t.Errorf("read from offset 6 = %q", data)
+	}
+}
+
+// fakeS3 serves objects without checking signatures
+func fakeS3(objects map[string]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("list-type") == "2" {
+			prefix := query.Get("prefix")
+			fmt.Fprint(w, "<ListBucketResult>")
+			seen := make(map[string]bool)
+			for key, data := range objects {
+				rest, ok := strings.CutPrefix(key, strings.TrimPrefix(r.URL.Path, "/")+prefix)
+				if !ok {
+					continue
+				}
+				if folder, _, ok := strings.Cut(rest, "/"); ok {
+					if !seen[folder] {
+						seen[folder] = true
+						fmt.Fprintf(w, "<CommonPrefixes><Prefix>%s%s/</Prefix></CommonPrefixes>", prefix, folder)
+					}
+					continue
+				}
+				fmt.Fprintf(w, "<Contents><Key>%s%s</Key><Size>%d</Size></Contents>", prefix, rest, len(data))
+			}
+			fmt.Fprint(w, "</ListBucketResult>")
+			return
+		}
+		data, ok := objects[strings.TrimPrefix(r.URL.Path, "/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(data))
+	})
+}
+
+func TestS3(t *testing.T) {
+	server := httptest.NewServer(fakeS3(map[string]string{
+		"bucket/share/a.txt":             "hello world",
+		"bucket/share/photos/1.jpg":      "first photo",
+		"bucket/share/photos/2024/":      "",
+		"bucket/share/photos/2024/2.jpg": "second photo",
+		"bucket/other.txt":               "outside the prefix",
+	}))
+	defer server.Close()
+	t.Setenv("AWS_ACCESS_KEY_ID", "key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_ENDPOINT_URL_S3", server.URL)
+
+	fsys, name, err := New("s3://bucket/share/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "share" {
+		t.Errorf("name = %s, want share", name)
+	}
+	if err := fstest.TestFS(fsys, "a.txt", "photos/1.jpg", "photos/2024/2.jpg"); err != nil {
+		t.Error(err)
+	}
+
+	fsys, name, err = New("s3://bucket/share/photos/1.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := fs.ReadFile(fsys, "1.jpg"); name != "1.jpg" || string(data) != "first photo" {
+		t.Errorf("single object %s = %q, %v", name, data, err)
+	}
+
+	if _, _, err := New("s3://bucket/missing"); err == nil {
+		t.Error("New of a missing prefix succeeded")
+	}
+}
@@ -0,0 +1,490 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPartSize is how much of a file is buffered before it is uploaded
+// as one part of a multipart upload. Smaller files take a single request.
+const DefaultPartSize = 8 << 20
+
+// minPartSize is the smallest part S3 accepts, except for the last one
+const minPartSize = 5 << 20
+
+// S3 stores files in a bucket of Amazon S3 or a compatible server such as
+// MinIO, under a key prefix
+type S3 struct {
+	Endpoint     *url.URL // Server, such as https://s3.us-east-1.amazonaws.com
+	Bucket       string
+	Prefix       string // Key prefix without a trailing slash, may be empty
+	Region       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string // Optional, for temporary credentials
+	PathStyle    bool   // Address the bucket in the path instead of the host name, as MinIO needs
+	PartSize     int    // DefaultPartSize if zero
+	Client       *http.Client
+
+	now func() time.Time // Replaced in tests
+}
+
+// NewS3 returns the backend for a URL such as s3://bucket/prefix. The
+// credentials come from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN, the region from AWS_REGION or AWS_DEFAULT_REGION. For
+// MinIO and other servers, AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL sets the
+// server, whose buckets are then addressed in the path.
+func NewS3(u *url.URL) (*S3, error) {
+	if u.Host == "" {
+		return nil, errors.New("s3 URL needs a bucket, such as s3://bucket/prefix")
+	}
+	s := &S3{
+		Bucket:       u.Host,
+		Prefix:       strings.Trim(u.Path, "/"),
+		Region:       firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		Client:       HTTPClient(),
+	}
+	if s.AccessKey == "" || s.SecretKey == "" {
+		return nil, errors.New("s3 needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if s.Region == "" {
+		s.Region = "us-east-1"
+	}
+	if endpoint := firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"); endpoint != "" {
+		e, err := url.Parse(endpoint)
+		if err != nil || e.Host == "" {
+			return nil, fmt.Errorf("invalid s3 endpoint: %s", endpoint)
+		}
+		s.Endpoint = e
+		s.PathStyle = true
+	} else {
+		s.Endpoint = &url.URL{Scheme: "https", Host: "s3." + s.Region + ".amazonaws.com"}
+	}
+	return s, nil
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// String returns the destination as an s3:// URL
+func (s *S3) String() string {
+	if s.Prefix == "" {
+		return "s3://" + s.Bucket
+	}
+	return "s3://" + s.Bucket + "/" + s.Prefix
+}
+
+// Open starts storing the object at path under the prefix. Data is buffered
+// up to PartSize; larger files are uploaded in parts as they arrive.
+func (s *S3) Open(path string) (io.WriteCloser, error) {
+	key := s.key(path)
+	partSize := s.PartSize
+	if partSize <= 0 {
+		partSize = DefaultPartSize
+	}
+	return &s3Writer{s: s, key: key, partSize: max(partSize, minPartSize)}, nil
+}
+
+// key returns the key of path under the prefix, the prefix itself for an
+// empty path
+func (s *S3) key(path string) string {
+	switch {
+	case path == "":
+		return s.Prefix
+	case s.Prefix == "":
+		return path
+	}
+	return s.Prefix + "/" + path
+}
+
+// Object is a file in a bucket
+type Object struct {
+	Path    string // Relative to the prefix
+	Size    int64
+	ModTime time.Time
+}
+
+// List returns the objects and folders directly in the folder dir under the
+// prefix, the prefix itself for an empty dir. Folders are key prefixes
+// followed by a slash, S3 has no folders of its own.
+func (s *S3) List(dir string) (objects []Object, folders []string, err error) {
+	prefix := s.key(dir)
+	if prefix != "" {
+		prefix += "/"
+	}
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}, "delimiter": {"/"}}
+	for {
+		resp, err := s.do("GET", s.objectURL("", query), nil, "failed to list "+s.String())
+		if err != nil {
+			return nil, nil, err
+		}
+		var result struct {
+			Contents []struct {
+				Key          string
+				Size         int64
+				LastModified time.Time
+			}
+			CommonPrefixes []struct {
+				Prefix string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list %s: invalid response: %w", s.String(), err)
+		}
+		for _, c := range result.Contents {
+			name := strings.TrimPrefix(c.Key, prefix)
+			// Empty objects ending in a slash are how consoles create folders
+			if name == "" || strings.HasSuffix(name, "/") {
+				continue
+			}
+			objects = append(objects, Object{Path: joinPath(dir, name), Size: c.Size, ModTime: c.LastModified})
+		}
+		for _, p := range result.CommonPrefixes {
+			if name := strings.TrimSuffix(strings.TrimPrefix(p.Prefix, prefix), "/"); name != "" {
+				folders = append(folders, joinPath(dir, name))
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, folders, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+func joinPath(dir, name string) string {
+	if dir == "" {
+		return name
+	}
+	return dir + "/" + name
+}
+
+// Stat returns the object at path under the prefix. A missing object is
+// reported as fs.ErrNotExist.
+func (s *S3) Stat(path string) (Object, error) {
+	resp, err := s.get("HEAD", path, 0)
+	if err != nil {
+		return Object{}, err
+	}
+	resp.Body.Close()
+	obj := Object{Path: path, Size: resp.ContentLength}
+	obj.ModTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return obj, nil
+}
+
+// Read returns the content of the object at path under the prefix, from
+// offset on
+func (s *S3) Read(path string, offset int64) (io.ReadCloser, error) {
+	resp, err := s.get("GET", path, offset)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3) get(method, path string, offset int64) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.objectURL(s.key(path), nil).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	s.sign(req, nil)
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, &fs.PathError{Op: "read", Path: path, Err: fs.ErrNotExist}
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		return nil, statusError("failed to read "+path, resp)
+	}
+	return resp, nil
+}
+
+// objectURL returns the URL of key with the query
+func (s *S3) objectURL(key string, query url.Values) *url.URL {
+	u := *s.Endpoint
+	if s.PathStyle {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.Bucket + "/" + key
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	// Sent as signed, Go would leave characters such as + unescaped
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = query.Encode()
+	return &u
+}
+
+// do sends a signed request and returns the response if it succeeded
+func (s *S3) do(method string, u *url.URL, body []byte, op string) (*http.Response, error) {
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	s.sign(req, body)
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		return nil, statusError(op, resp)
+	}
+	return resp, nil
+}
+
+// sign adds AWS Signature Version 4 headers to req, covering the host and
+// every header already set
+func (s *S3) sign(req *http.Request, body []byte) {
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	t := now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	payloadHash := sha256.Sum256(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode percent-encodes everything but unreserved characters, and
+// slashes unless encodeSlash is set, as Signature Version 4 requires
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !encodeSlash {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Writer uploads an object, in parts once it outgrows one
+type s3Writer struct {
+	s        *S3
+	key      string
+	partSize int
+	buf      []byte
+	uploadID string   // Set once a multipart upload started
+	etags    []string // ETags of the uploaded parts, in order
+	closed   bool
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write to closed object")
+	}
+	n := len(p)
+	for len(p) > 0 {
+		take := min(len(p), w.partSize-len(w.buf))
+		w.buf = append(w.buf, p[:take]...)
+		p = p[take:]
+		if len(w.buf) == w.partSize {
+			if err := w.uploadPart(); err != nil {
+				return n - len(p), err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (w *s3Writer) uploadPart() error {
+	if w.uploadID == "" {
+		resp, err := w.s.do("POST", w.s.objectURL(w.key, url.Values{"uploads": {""}}), nil, "failed to start upload of "+w.key)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		var result struct {
+			UploadID string `xml:"UploadId"`
+		}
+		if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil || result.UploadID == "" {
+			return fmt.Errorf("failed to start upload of %s: invalid response", w.key)
+		}
+		w.uploadID = result.UploadID
+	}
+
+	number := len(w.etags) + 1
+	query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {w.uploadID}}
+	resp, err := w.s.do("PUT", w.s.objectURL(w.key, query), w.buf, fmt.Sprintf("failed to upload part %d of %s", number, w.key))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	w.etags = append(w.etags, resp.Header.Get("ETag"))
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Close uploads what is left and completes the object
+func (w *s3Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	if w.uploadID == "" {
+		resp, err := w.s.do("PUT", w.s.objectURL(w.key, nil), w.buf, "failed to upload "+w.key)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	if len(w.buf) > 0 {
+		if err := w.uploadPart(); err != nil {
+			w.abort()
+			return err
+		}
+	}
+	type part struct {
+		Number int    `xml:"PartNumber"`
+		ETag   string `xml:"ETag"`
+	}
+	complete := struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []part   `xml:"Part"`
+	}{}
+	for i, etag := range w.etags {
+		complete.Parts = append(complete.Parts, part{i + 1, etag})
+	}
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+	resp, err := w.s.do("POST", w.s.objectURL(w.key, url.Values{"uploadId": {w.uploadID}}), body, "failed to complete upload of "+w.key)
+	if err != nil {
+		w.abort()
+		return err
+	}
+	defer resp.Body.Close()
+	// S3 reports some failures in the body of a 200 response
+	data, _ := io.ReadAll(resp.Body)
+	if bytes.Contains(data, []byte("<Error>")) {
+		w.abort()
+		return fmt.Errorf("failed to complete upload of %s: %s", w.key, data)
+	}
+	return nil
+}
+
+// Abort discards the uploaded parts. An object that fits one part is only
+// uploaded on Close, so there is nothing to discard.
+func (w *s3Writer) Abort() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.abort()
+}
+
+func (w *s3Writer) abort() error {
+	if w.uploadID == "" {
+		return nil
+	}
+	resp, err := w.s.do("DELETE", w.s.objectURL(w.key, url.Values{"uploadId": {w.uploadID}}), nil, "failed to abort upload of "+w.key)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,97 @@
+// Package storage saves received files somewhere other than a local folder,
+// such as S3 compatible object storage or a WebDAV server, so a server can
+// land transfers directly where they are used.
+package storage
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Backend stores received files
+type Backend interface {
+	// Open returns a writer for the file at path, which is slash separated
+	// and relative to the destination the backend was created for. The
+	// file is complete once the writer is closed without error.
+	Open(path string) (io.WriteCloser, error)
+}
+
+// aborter is implemented by writers that can discard a file instead of
+// completing it
+type aborter interface {
+	Abort() error
+}
+
+// Abort discards a file opened with Open, such as after a checksum
+// mismatch. Writers that cannot discard data are closed.
+func Abort(w io.WriteCloser) error {
+	if a, ok := w.(aborter); ok {
+		return a.Abort()
+	}
+	return w.Close()
+}
+
+// Timeout bounds how long a storage server may take to respond
+var Timeout = 60 * time.Second
+
+// IsURL reports whether dest names a storage backend rather than a local
+// folder
+func IsURL(dest string) bool {
+	scheme, _, ok := strings.Cut(dest, "://")
+	if !ok {
+		return false
+	}
+	switch strings.ToLower(scheme) {
+	case "s3", "webdav", "webdav+http":
+		return true
+	}
+	return false
+}
+
+// New returns the backend for a destination URL:
+//
+//	s3://bucket/prefix            S3 or MinIO, see NewS3
+//	webdav://host/path            WebDAV over HTTPS
+//	webdav+http://host/path       WebDAV over plain HTTP
+func New(dest string) (Backend, error) {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage URL: %w", err)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "s3":
+		return NewS3(u)
+	case "webdav", "webdav+http":
+		return NewWebDAV(u)
+	}
+	return nil, fmt.Errorf("unsupported storage URL: %s", dest)
+}
+
+// HTTPClient returns a client for storage requests that honors the proxy
+// environment variables. Bodies are not bounded, so large files are not cut
+// off.
+func HTTPClient() *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: Timeout, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   Timeout,
+		ResponseHeaderTimeout: Timeout,
+		IdleConnTimeout:       90 * time.Second,
+		ForceAttemptHTTP2:     true,
+	}}
+}
+
+// statusError describes an unexpected response, with the start of its body
+// since servers explain errors there
+func statusError(op string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if msg := strings.TrimSpace(string(body)); msg != "" {
+		return fmt.Errorf("%s: %s: %s", op, resp.Status, msg)
+	}
+	return fmt.Errorf("%s: %s", op, resp.Status)
+}
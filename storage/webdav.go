@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// errAborted ends the upload of a discarded file
+var errAborted = errors.New("upload aborted")
+
+// WebDAV stores files on a WebDAV server, such as Nextcloud or Apache with
+// mod_dav, below a base folder
+type WebDAV struct {
+	Base     *url.URL // Folder files are stored in, http or https
+	User     string
+	Password string
+	Client   *http.Client
+
+	mu      sync.Mutex
+	created map[string]bool // Folders known to exist
+}
+
+// NewWebDAV returns the backend for a URL such as webdav://host/path, or
+// webdav+http://host/path for servers without TLS. The user name and
+// password come from the URL, or WEBDAV_USER and WEBDAV_PASSWORD so they do
+// not show in the process list.
+func NewWebDAV(u *url.URL) (*WebDAV, error) {
+	if u.Host == "" {
+		return nil, errors.New("webdav URL needs a host, such as webdav://host/path")
+	}
+	base := *u
+	base.Scheme = "https"
+	if strings.EqualFold(u.Scheme, "webdav+http") {
+		base.Scheme = "http"
+	}
+	base.User = nil
+	base.Path = strings.TrimSuffix(base.Path, "/")
+	base.RawPath = ""
+
+	d := &WebDAV{
+		Base:     &base,
+		User:     os.Getenv("WEBDAV_USER"),
+		Password: os.Getenv("WEBDAV_PASSWORD"),
+		Client:   HTTPClient(),
+	}
+	if u.User != nil {
+		d.User = u.User.Username()
+		if password, ok := u.User.Password(); ok {
+			d.Password = password
+		}
+	}
+	return d, nil
+}
+
+// String returns the destination as a webdav URL without credentials
+func (d *WebDAV) String() string {
+	u := *d.Base
+	u.Scheme = "webdav"
+	if d.Base.Scheme == "http" {
+		u.Scheme = "webdav+http"
+	}
+	return u.String()
+}
+
+func (d *WebDAV) fileURL(path string) string {
+	u := *d.Base
+	u.Path += "/" + path
+	return u.String()
+}
+
+func (d *WebDAV) request(method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, d.fileURL(path), body)
+	if err != nil {
+		return nil, err
+	}
+	if d.User != "" || d.Password != "" {
+		req.SetBasicAuth(d.User, d.Password)
+	}
+	return req, nil
+}
+
+// mkdirs creates the folders leading to path, which WebDAV does not do on
+// its own
+func (d *WebDAV) mkdirs(path string) error {
+	dirs := strings.Split(path, "/")
+	dirs = dirs[:len(dirs)-1]
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.created == nil {
+		d.created = make(map[string]bool)
+	}
+	for i := range dirs {
+		dir := strings.Join(dirs[:i+1], "/")
+		if d.created[dir] {
+			continue
+		}
+		req, err := d.request("MKCOL", dir+"/", nil)
+		if err != nil {
+			return err
+		}
+		resp, err := d.Client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to create folder %s: %w", dir, err)
+		}
+		resp.Body.Close()
+		// 405 Method Not Allowed means the folder exists
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode/100 != 2 {
+			return statusError("failed to create folder "+dir, resp)
+		}
+		d.created[dir] = true
+	}
+	return nil
+}
+
+// Open starts uploading the file at path. The data streams to the server as
+// it is written, so files of any size take no extra memory.
+func (d *WebDAV) Open(path string) (io.WriteCloser, error) {
+	if err := d.mkdirs(path); err != nil {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	req, err := d.request("PUT", path, pr)
+	if err != nil {
+		return nil, err
+	}
+	w := &webdavWriter{pw: pw, done: make(chan error, 1)}
+	go func() {
+		resp, err := d.Client.Do(req)
+		if err == nil {
+			if resp.StatusCode/100 != 2 {
+				err = statusError("failed to upload "+path, resp)
+			}
+			resp.Body.Close()
+		} else {
+			err = fmt.Errorf("failed to upload %s: %w", path, err)
+		}
+		// Unblocks writes if the server answered before reading everything
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+	return w, nil
+}
+
+type webdavWriter struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+func (w *webdavWriter) Write(p []byte) (int, error) {
+	n, err := w.pw.Write(p)
+	if err != nil {
+		// The upload ended early, its error explains why
+		select {
+		case uploadErr := <-w.done:
+			w.done <- uploadErr
+			if uploadErr != nil {
+				return n, uploadErr
+			}
+		default:
+		}
+	}
+	return n, err
+}
+
+// Close ends the upload and waits for the server to store the file
+func (w *webdavWriter) Close() error {
+	w.pw.Close()
+	err := <-w.done
+	w.done <- err
+	return err
+}
+
+// Abort cuts the upload off, so the server does not store the file
+func (w *webdavWriter) Abort() error {
+	w.pw.CloseWithError(errAborted)
+	err := <-w.done
+	w.done <- err
+	return nil
+}
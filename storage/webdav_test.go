@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDAV stores files and folders like a WebDAV server
+type fakeDAV struct {
+	mu      sync.Mutex
+	folders map[string]bool
+	files   map[string]string
+}
+
+func (f *fakeDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if user, password, _ := r.BasicAuth(); user != "alice" || password != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	parent := r.URL.Path[:strings.LastIndex(strings.TrimSuffix(r.URL.Path, "/"), "/")]
+	switch r.Method {
+	case "MKCOL":
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if !f.folders[parent] {
+			w.WriteHeader(http.StatusConflict)
+		} else if f.folders[strings.TrimSuffix(r.URL.Path, "/")] {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		} else {
+			f.folders[strings.TrimSuffix(r.URL.Path, "/")] = true
+			w.WriteHeader(http.StatusCreated)
+		}
+	case "PUT":
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if !f.folders[parent] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.files[r.URL.Path] = string(data)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newFakeDAV(t *testing.T) (*fakeDAV, string) {
+	fake := &fakeDAV{folders: map[string]bool{"/dav": true}, files: make(map[string]string)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, strings.Replace(server.URL, "http://", "webdav+http://alice:secret@", 1) + "/dav/"
+}
+
+func TestWebDAVUpload(t *testing.T) {
+	fake, dest := newFakeDAV(t)
+	b, err := New(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.TrimSuffix(strings.Replace(dest, "alice:secret@", "", 1), "/")
+	if d := b.(*WebDAV); d.Base.Scheme != "http" || d.String() != want {
+		t.Errorf("String() = %s, want %s", d.String(), want)
+	}
+
+	for _, name := range []string{"photos/2024/a.jpg", "photos/2024/b.jpg"} {
+		w, err := b.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, "data of "+name)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := fake.files["/dav/photos/2024/b.jpg"]; got != "data of photos/2024/b.jpg" {
+		t.Errorf("stored %q", got)
+	}
+}
+
+func TestWebDAVErrors(t *testing.T) {
+	fake, dest := newFakeDAV(t)
+
+	b, _ := New(strings.Replace(dest, "secret", "wrong", 1))
+	if _, err := b.Open("a/b.txt"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Open with a wrong password = %v, want 401", err)
+	}
+
+	b, _ = New(dest)
+	w, err := b.Open("c.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "partial")
+	if err := Abort(w); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.files["/dav/c.txt"]; ok {
+		t.Error("aborted file was stored")
+	}
+}
+
+func TestIsURL(t *testing.T) {
+	cases := map[string]bool{
+		"s3://bucket/prefix":   true,
+		"S3://bucket":          true,
+		"webdav://host/dav":    true,
+		"webdav+http://host":   true,
+		"/home/me/Downloads":   false,
+		`C:\Users\me`:          false,
+		"ftp://host/path":      false,
+		"folder/with://in/it":  false,
+		"relative/s3:/bucket/": false,
+	}
+	for dest, want := range cases {
+		if got := IsURL(dest); got != want {
+			t.Errorf("IsURL(%q) = %v, want %v", dest, got, want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Package thumbnail makes small JPEG previews of received images and caches
+// them, for the gallery of what arrived.
+package thumbnail
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // Decoders for image.Decode
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/ebob10000/2c1f/paths"
+	"lukechampine.com/blake3"
+)
+
+// Bounds of the maxSize of a preview
+const (
+	DefaultSize = 256
+	MaxSize     = 1024
+)
+
+// maxPixels refuses images that would take too much memory to decode, such
+// as a small file claiming huge dimensions
+const maxPixels = 100_000_000
+
+// samples is how many source pixels per direction are averaged into a
+// preview pixel. More only cost time at preview sizes.
+const samples = 4
+
+// ErrUnsupported is returned for files that are not JPEG, PNG or GIF images
+var ErrUnsupported = errors.New("not a supported image")
+
+// Get returns a JPEG preview of the image at path that fits into maxSize
+// pixels in both directions, DefaultSize if zero. Previews are cached until
+// the file changes.
+func Get(path string, maxSize int) ([]byte, error) {
+	maxSize = clampSize(maxSize)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	cached := cachePath(path, info, maxSize)
+	if data, err := os.ReadFile(cached); err == nil {
+		return data, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := Generate(f, maxSize)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	// Without a cache the preview is made again next time
+	os.WriteFile(cached, data, 0600)
+	return data, nil
+}
+
+// Generate returns a JPEG preview of the image in r that fits into maxSize
+// pixels in both directions, DefaultSize if zero
+func Generate(r io.ReadSeeker, maxSize int) ([]byte, error) {
+	maxSize = clampSize(maxSize)
+	config, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, fmt.Errorf("image of %dx%d pixels is too large", config.Width, config.Height)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scale(img, maxSize), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func clampSize(size int) int {
+	if size <= 0 {
+		return DefaultSize
+	}
+	return min(size, MaxSize)
+}
+
+// scale shrinks img to fit into size pixels, keeping its aspect ratio, on
+// a white background for transparent images. Each pixel averages a grid of
+// samples of the area it covers.
+func scale(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	switch {
+	case w <= size && h <= size:
+	case w >= h:
+		dw, dh = size, max(h*size/w, 1)
+	default:
+		dw, dh = max(w*size/h, 1), size
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := b.Min.Y+y*h/dh, b.Min.Y+(y+1)*h/dh
+		for x := 0; x < dw; x++ {
+			x0, x1 := b.Min.X+x*w/dw, b.Min.X+(x+1)*w/dw
+			var r, g, bl, a, n uint32
+			for sy := 0; sy < samples; sy++ {
+				py := y0 + (y1-y0)*sy/samples
+				for sx := 0; sx < samples; sx++ {
+					pr, pg, pb, pa := img.At(x0+(x1-x0)*sx/samples, py).RGBA()
+					r, g, bl, a, n = r+pr, g+pg, bl+pb, a+pa, n+1
+				}
+			}
+			// The colors are premultiplied by alpha
+			white := 0xffff - a/n
+			dst.SetRGBA(x, y, color.RGBA{uint8((r/n + white) >> 8), uint8((g/n + white) >> 8), uint8((bl/n + white) >> 8), 0xff})
+		}
+	}
+	return dst
+}
+
+// cachePath returns where the preview of the file at path is cached. The
+// size and modification time are part of the name, so a changed file gets
+// a new preview.
+func cachePath(path string, info os.FileInfo, maxSize int) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	key := path + "\x00" + strconv.FormatInt(info.Size(), 10) + "\x00" + strconv.FormatInt(info.ModTime().UnixNano(), 10) + "\x00" + strconv.Itoa(maxSize)
+	sum := blake3.Sum256([]byte(key))
+	return paths.Cache(filepath.Join("thumbnails", hex.EncodeToString(sum[:16])+".jpg"))
+}
@@ -0,0 +1,84 @@
+package thumbnail
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ebob10000/2c1f/paths"
+)
+
+func testPNG(t *testing.T, w, h int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: 255, A: 255})
+		}
+	}
+	// A transparent corner, which turns white
+	img.Set(0, 0, color.NRGBA{})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGenerate(t *testing.T) {
+	cases := []struct {
+		w, h, maxSize int
+		wantW, wantH  int
+	}{
+		{800, 400, 200, 200, 100},
+		{300, 900, 0, 85, 256},
+		{40, 30, 200, 40, 30}, // Small images keep their size
+		{3000, 2, 100, 100, 1},
+	}
+	for _, c := range cases {
+		data, err := Generate(bytes.NewReader(testPNG(t, c.w, c.h)), c.maxSize)
+		if err != nil {
+			t.Fatalf("Generate(%dx%d) error = %v", c.w, c.h, err)
+		}
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("preview is not a JPEG: %v", err)
+		}
+		if b := img.Bounds(); b.Dx() != c.wantW || b.Dy() != c.wantH {
+			t.Errorf("Generate(%dx%d, %d) = %dx%d, want %dx%d", c.w, c.h, c.maxSize, b.Dx(), b.Dy(), c.wantW, c.wantH)
+		}
+		if r, g, _, _ := img.At(c.wantW/2, c.wantH/2).RGBA(); r>>8 < 200 || g>>8 > 60 {
+			t.Errorf("Generate(%dx%d) center is not red: %d, %d", c.w, c.h, r>>8, g>>8)
+		}
+	}
+	if _, err := Generate(strings.NewReader("not an image"), 0); err != ErrUnsupported {
+		t.Errorf("Generate(text) error = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestGetCaches(t *testing.T) {
+	paths.SetBaseDir(t.TempDir())
+	defer paths.SetBaseDir("")
+
+	path := filepath.Join(t.TempDir(), "photo.png")
+	if err := os.WriteFile(path, testPNG(t, 500, 500), 0644); err != nil {
+		t.Fatal(err)
+	}
+	first, err := Get(path, 64)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	info, _ := os.Stat(path)
+	if _, err := os.Stat(cachePath(path, info, 64)); err != nil {
+		t.Errorf("preview not cached: %v", err)
+	}
+	second, err := Get(path, 64)
+	if err != nil || !bytes.Equal(first, second) {
+		t.Errorf("cached Get() = %d bytes, %v, want the first preview", len(second), err)
+	}
+}
@@ -0,0 +1,244 @@
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/argon2"
+	"lukechampine.com/blake3"
+)
+
+// EncryptedExt is appended to the name of every file encrypted at rest
+const EncryptedExt = ".2c1fenc"
+
+// Encrypted file layout: magic | passphrase salt | file nonce, followed by
+// AES-GCM sealed chunks of up to encChunkSize plaintext bytes. Each file uses
+// its own key derived from the passphrase key and the file nonce, so chunk
+// nonces are just a counter plus a flag marking the final chunk, which also
+// makes truncated files fail to decrypt.
+const (
+	encMagic     = "2C1FENC\x01"
+	encSaltSize  = 16
+	encNonceSize = 16
+	encChunkSize = 64 * 1024
+	encHeaderLen = len(encMagic) + encSaltSize + encNonceSize
+)
+
+// ErrWrongPassphrase is returned when an encrypted file cannot be authenticated
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted file")
+
+// EncryptionKey encrypts files at rest with a key derived from a passphrase
+type EncryptionKey struct {
+	salt []byte
+	key  []byte
+}
+
+// NewEncryptionKey derives a key from passphrase with a fresh random salt
+func NewEncryptionKey(passphrase string) (*EncryptionKey, error) {
+	if passphrase == "" {
+		return nil, errors.New("passphrase must not be empty")
+	}
+	salt := make([]byte, encSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return &EncryptionKey{salt: salt, key: deriveAtRestKey(passphrase, salt)}, nil
+}
+
+func deriveAtRestKey(passphrase string, salt []byte) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, 3, 64*1024, 4, 32)
+}
+
+// fileAEAD returns the cipher for a single file
+func fileAEAD(key, nonce []byte) (cipher.AEAD, error) {
+	h := blake3.New(32, key)
+	h.Write(nonce)
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptedSize returns the size of a file of size bytes once encrypted:
+// the header plus a GCM tag for every chunk, and at least one chunk
+func encryptedSize(size int64) int64 {
+	chunks := (size + encChunkSize - 1) / encChunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	return int64(encHeaderLen) + size + chunks*16
+}
+
+func chunkNonce(counter uint64, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[3:11], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// NewWriter returns a writer that encrypts everything written to w. Close
+// must be called to write the final chunk; it does not close w.
+func (k *EncryptionKey) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	header := make([]byte, 0, encHeaderLen)
+	header = append(header, encMagic...)
+	header = append(header, k.salt...)
+	nonce := make([]byte, encNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	header = append(header, nonce...)
+
+	aead, err := fileAEAD(k.key, nonce)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, header: header, buf: make([]byte, 0, encChunkSize)}, nil
+}
+
+type encryptWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	header  []byte
+	buf     []byte
+	counter uint64
+	closed  bool
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("write to closed encrypted writer")
+	}
+	written := 0
+	for len(p) > 0 {
+		// A full buffer is only flushed once more data arrives, so the
+		// final chunk is always the one written by Close
+		if len(e.buf) == encChunkSize {
+			if err := e.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(e.buf[len(e.buf):encChunkSize], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (e *encryptWriter) flush(last bool) error {
+	sealed := e.aead.Seal(nil, chunkNonce(e.counter, last), e.buf, e.header)
+	e.counter++
+	e.buf = e.buf[:0]
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+func (e *encryptWriter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	return e.flush(true)
+}
+
+// Decryptor decrypts files written with an EncryptionKey. Keys are cached per
+// salt so decrypting a whole folder only runs the key derivation once.
+type Decryptor struct {
+	passphrase string
+	keys       map[string][]byte
+}
+
+func NewDecryptor(passphrase string) *Decryptor {
+	return &Decryptor{passphrase: passphrase, keys: make(map[string][]byte)}
+}
+
+// Decrypt reads an encrypted stream from r and writes the plaintext to w
+func (d *Decryptor) Decrypt(r io.Reader, w io.Writer) error {
+	header := make([]byte, encHeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+	if !bytes.HasPrefix(header, []byte(encMagic)) {
+		return errors.New("not an encrypted 2c1f file")
+	}
+	salt := header[len(encMagic) : len(encMagic)+encSaltSize]
+	nonce := header[len(encMagic)+encSaltSize:]
+
+	key, ok := d.keys[string(salt)]
+	if !ok {
+		key = deriveAtRestKey(d.passphrase, salt)
+		d.keys[string(salt)] = key
+	}
+	aead, err := fileAEAD(key, nonce)
+	if err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(r)
+	buf := make([]byte, encChunkSize+aead.Overhead())
+	for counter := uint64(0); ; counter++ {
+		n, err := io.ReadFull(br, buf)
+		last := false
+		switch {
+		case err == io.EOF || err == io.ErrUnexpectedEOF:
+			last = true
+		case err != nil:
+			return err
+		default:
+			if _, peekErr := br.Peek(1); peekErr == io.EOF {
+				last = true
+			}
+		}
+
+		plain, err := aead.Open(buf[:0], chunkNonce(counter, last), buf[:n], header)
+		if err != nil {
+			return ErrWrongPassphrase
+		}
+		if _, err := w.Write(plain); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// DecryptFile decrypts src into dst. dst is only created once src has been
+// fully authenticated, so a wrong passphrase leaves nothing behind.
+func (d *Decryptor) DecryptFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".partial"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := d.Decrypt(in, out); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
@@ -0,0 +1,71 @@
+package transfer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func TestAtRestRoundTrip(t *testing.T) {
+	key, err := NewEncryptionKey("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sizes around the chunk boundary exercise the final chunk handling
+	for _, size := range []int{0, 1, encChunkSize - 1, encChunkSize, encChunkSize + 1, 3 * encChunkSize} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+
+		var encrypted bytes.Buffer
+		w, err := key.NewWriter(&encrypted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Write in odd pieces to make sure buffering does not depend on write sizes
+		for rest := plain; len(rest) > 0; {
+			n := min(len(rest), 1000)
+			if _, err := w.Write(rest[:n]); err != nil {
+				t.Fatal(err)
+			}
+			rest = rest[n:]
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if size > 16 && bytes.Contains(encrypted.Bytes(), plain[:16]) {
+			t.Fatalf("size %d: plaintext visible in encrypted output", size)
+		}
+
+		var decrypted bytes.Buffer
+		if err := NewDecryptor("correct horse").Decrypt(bytes.NewReader(encrypted.Bytes()), &decrypted); err != nil {
+			t.Fatalf("size %d: decrypt failed: %v", size, err)
+		}
+		if !bytes.Equal(decrypted.Bytes(), plain) {
+			t.Fatalf("size %d: decrypted content mismatch", size)
+		}
+
+		err = NewDecryptor("wrong").Decrypt(bytes.NewReader(encrypted.Bytes()), &bytes.Buffer{})
+		if !errors.Is(err, ErrWrongPassphrase) {
+			t.Errorf("size %d: wrong passphrase error = %v", size, err)
+		}
+	}
+}
+
+func TestAtRestDetectsTruncation(t *testing.T) {
+	key, err := NewEncryptionKey("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var encrypted bytes.Buffer
+	w, _ := key.NewWriter(&encrypted)
+	w.Write(make([]byte, 2*encChunkSize+10))
+	w.Close()
+
+	// Drop the final chunk so the file ends on a chunk boundary
+	truncated := encrypted.Bytes()[:encHeaderLen+2*(encChunkSize+16)]
+	if err := NewDecryptor("correct horse").Decrypt(bytes.NewReader(truncated), &bytes.Buffer{}); err == nil {
+		t.Error("expected truncated file to fail decryption")
+	}
+}
@@ -0,0 +1,106 @@
+package transfer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readAudit(t *testing.T, path string) []AuditEvent {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var events []AuditEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("Invalid audit line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	var nilLog *AuditLog
+	nilLog.Record(AuditEvent{Event: AuditStart})
+
+	for i := 0; i < 2; i++ {
+		audit, err := OpenAuditLog(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		audit.Record(AuditEvent{Event: AuditStart})
+		audit.Record(AuditEvent{Event: AuditEnd, Error: "failed"})
+		if err := audit.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events := readAudit(t, path)
+	if len(events) != 4 {
+		t.Fatalf("Got %d events, want 4 appended", len(events))
+	}
+	if events[0].Transfer == "" || events[0].Transfer != events[1].Transfer || events[1].Transfer == events[2].Transfer {
+		t.Errorf("Transfer IDs %q %q %q, want one per log opened", events[0].Transfer, events[1].Transfer, events[2].Transfer)
+	}
+	if events[1].Event != AuditEnd || events[1].Error != "failed" || events[1].Time.IsZero() {
+		t.Errorf("Unexpected event %+v", events[1])
+	}
+}
+
+func TestTransferAudit(t *testing.T) {
+	srcDir := t.TempDir()
+	os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("first file"), 0644)
+	os.WriteFile(filepath.Join(srcDir, "b.bin"), compressibleData(256*1024), 0644)
+	sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.Code = "123-456"
+
+	dir := t.TempDir()
+	sender.Audit, err = OpenAuditLog(filepath.Join(dir, "send.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiveAudit, err := OpenAuditLog(filepath.Join(dir, "receive.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendErr, recvErr := splitTransfer(t, context.Background(), sender, t.TempDir(), func(r *Receiver) {
+		r.Audit = receiveAudit
+	})
+	if sendErr != nil || recvErr != nil {
+		t.Fatalf("Send error %v, receive error %v", sendErr, recvErr)
+	}
+	sender.Audit.Close()
+	receiveAudit.Close()
+
+	checksums := make(map[string]string)
+	for _, f := range sender.Manifest.Files {
+		checksums[f.Path] = f.Checksum
+	}
+	for _, name := range []string{"send.jsonl", "receive.jsonl"} {
+		events := readAudit(t, filepath.Join(dir, name))
+		if len(events) != 3 || events[0].Event != AuditHandshake {
+			t.Fatalf("%s: got %+v, want the handshake and two files", name, events)
+		}
+		if events[0].Options["dataStream"] != true || events[0].Size != sender.Manifest.TotalSize || events[0].Checksum == "" {
+			t.Errorf("%s: unexpected handshake %+v", name, events[0])
+		}
+		for _, e := range events[1:] {
+			if e.Event != AuditFile || e.Checksum != checksums[e.Path] || !e.Verified || e.Error != "" {
+				t.Errorf("%s: unexpected file event %+v", name, e)
+			}
+		}
+	}
+}
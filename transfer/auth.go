@@ -0,0 +1,111 @@
+package transfer
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"lukechampine.com/blake3"
+)
+
+// ChallengeMsg asks the receiver to prove it knows the transfer password
+type ChallengeMsg struct {
+	Nonce []byte `json:"nonce"`
+}
+
+// ChallengeResponseMsg carries the receiver's proof for a ChallengeMsg
+type ChallengeResponseMsg struct {
+	Proof []byte `json:"proof"`
+}
+
+// CodeChallengeMsg answers a receiver's handshake. Neither side sends the
+// code, each proves it knows it for both nonces instead. The sender goes
+// first, so a receiver that reached someone squatting on the code refuses
+// before giving anything away.
+type CodeChallengeMsg struct {
+	Salt  []byte `json:"salt"`  // Salt of the sender's code key, see codeKey
+	Nonce []byte `json:"nonce"` // Sender's nonce
+	Proof []byte `json:"proof"` // Sender's proof for the receiver's and its own nonce
+}
+
+const nonceSize = 32
+
+// Proof roles keep the sender's and receiver's proofs for the same nonce distinct
+const (
+	roleSender   = "sender"
+	roleReceiver = "receiver"
+)
+
+// passwordKey derives the key used to prove knowledge of the password. The
+// password itself never goes on the wire. The code salts the derivation so the
+// same password yields unrelated keys for different transfers.
+func passwordKey(code, password string) []byte {
+	return argon2.IDKey([]byte(password), []byte("2c1f-password:"+code), 1, 64*1024, 4, 32)
+}
+
+// passwordProof answers a challenge nonce for the given role
+func passwordProof(key, nonce []byte, role string) []byte {
+	h := blake3.New(32, key)
+	h.Write([]byte("2c1f-handshake:" + role + ":"))
+	h.Write(nonce)
+	return h.Sum(nil)
+}
+
+func validProof(proof, key, nonce []byte, role string) bool {
+	return subtle.ConstantTimeCompare(proof, passwordProof(key, nonce, role)) == 1
+}
+
+// codeKey derives the key used to prove knowledge of the code. Codes are
+// short, so it is as slow to derive as passwordKey to keep an impostor from
+// trying every code against a proof it saw, and the sender's random salt
+// keeps that work from being done ahead of the send or reused for another.
+func codeKey(code string, salt []byte) []byte {
+	return argon2.IDKey([]byte(code), append([]byte("2c1f-code:"), salt...), 1, 64*1024, 4, 32)
+}
+
+// codeKeys holds the key of a sender's code, derived once with a salt of
+// its own for all its handshakes. Deriving it for each handshake would let
+// anyone who opens streams to the sender make it run Argon2 at will.
+type codeKeys struct {
+	mu   sync.Mutex
+	code string
+	salt []byte
+	key  []byte
+}
+
+// get returns the salt and key of code, derived on first use or when the
+// code changed
+func (c *codeKeys) get(code string) (salt, key []byte, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.key == nil || c.code != code {
+		salt, err := newNonce()
+		if err != nil {
+			return nil, nil, err
+		}
+		c.code, c.salt, c.key = code, salt, codeKey(code, salt)
+	}
+	return c.salt, c.key, nil
+}
+
+// codeProof proves knowledge of the code for the nonces of both sides
+func codeProof(key, receiverNonce, senderNonce []byte, role string) []byte {
+	h := blake3.New(32, key)
+	h.Write([]byte("2c1f-code:" + role + ":"))
+	h.Write(receiverNonce)
+	h.Write(senderNonce)
+	return h.Sum(nil)
+}
+
+func validCodeProof(proof, key, receiverNonce, senderNonce []byte, role string) bool {
+	return subtle.ConstantTimeCompare(proof, codeProof(key, receiverNonce, senderNonce, role)) == 1
+}
+
+func newNonce() ([]byte, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
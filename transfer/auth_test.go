@@ -0,0 +1,390 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runHandshake runs a sender handshake against a full receiver and returns
+// both errors. The sender closes the connection right after the handshake so
+// the receiver always returns.
+func runHandshake(t *testing.T, senderPassword, receiverPassword string) (senderErr, receiverErr error) {
+	return runSenderHandshake(t, &Sender{Code: "123-456", Password: senderPassword}, receiverPassword)
+}
+
+func runSenderHandshake(t *testing.T, sender *Sender, receiverPassword string) (senderErr, receiverErr error) {
+	return runReceiverHandshake(t, sender, func(r *Receiver) {
+		r.Code = sender.Code
+		r.Password = receiverPassword
+	})
+}
+
+// runReceiverHandshake is runSenderHandshake with a receiver set up by configure
+func runReceiverHandshake(t *testing.T, sender *Sender, configure func(r *Receiver)) (senderErr, receiverErr error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	errChan := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			errChan <- err
+			return
+		}
+		defer conn.Close()
+
+		receiver := NewReceiver(t.TempDir())
+		configure(receiver)
+		errChan <- receiver.Receive(context.Background(), conn)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	senderErr = sender.Handshake(conn)
+	conn.Close()
+
+	return senderErr, <-errChan
+}
+
+func TestCodeHandshake(t *testing.T) {
+	t.Run("Match", func(t *testing.T) {
+		senderErr, receiverErr := runHandshake(t, "", "")
+		if senderErr != nil {
+			t.Fatalf("Sender handshake failed: %v", senderErr)
+		}
+		if receiverErr != nil && strings.Contains(receiverErr.Error(), "code") {
+			t.Errorf("Receiver rejected the sender: %v", receiverErr)
+		}
+	})
+
+	t.Run("WrongCode", func(t *testing.T) {
+		// The receiver only answers once the sender proved the code, so
+		// the sender learns nothing about the code the receiver has
+		senderErr, receiverErr := runReceiverHandshake(t, &Sender{Code: "123-456"}, func(r *Receiver) { r.Code = "654-321" })
+		if CategoryOf(senderErr) != CategoryValidation || !strings.Contains(senderErr.Error(), "declined") {
+			t.Errorf("Sender error = %v, want the challenge declined", senderErr)
+		}
+		if CategoryOf(receiverErr) != CategoryValidation || !strings.Contains(receiverErr.Error(), "does not know the code") {
+			t.Errorf("Receiver error = %v, want the sender refused", receiverErr)
+		}
+	})
+
+	t.Run("EmptyCode", func(t *testing.T) {
+		senderErr, _ := runReceiverHandshake(t, &Sender{}, func(r *Receiver) {})
+		if CategoryOf(senderErr) != CategoryValidation {
+			t.Errorf("Sender error = %v, want an empty code refused", senderErr)
+		}
+	})
+}
+
+// TestRefuseHandshake checks that receivers without the code are told
+// nothing but that the handshake failed, after the same delay
+func TestRefuseHandshake(t *testing.T) {
+	defer func(d time.Duration) { refuseDelay = d }(refuseDelay)
+	refuseDelay = 100 * time.Millisecond
+
+	handshakes := map[string][]byte{
+		"CleartextCode": []byte("123-456"),
+		"CleartextJSON": []byte(`{"code":"123-456"}`),
+		"InvalidNonce":  []byte(`{"nonce":"AAAA"}`),
+	}
+	for name, payload := range handshakes {
+		t.Run(name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			errChan := make(chan error, 1)
+			go func() { errChan <- (&Sender{Code: "123-456"}).Handshake(server) }()
+
+			started := time.Now()
+			WriteMessage(client, &Message{Type: MsgHandshake, Payload: payload})
+			msg, err := ReadMessage(client)
+			if err != nil || msg.Type != MsgError || string(msg.Payload) != "handshake failed" {
+				t.Fatalf("Got %v, %v, want the generic error", msg, err)
+			}
+			if elapsed := time.Since(started); elapsed < refuseDelay {
+				t.Errorf("Refused after %v, want at least %v", elapsed, refuseDelay)
+			}
+			if err := <-errChan; err == nil {
+				t.Error("Sender handshake succeeded")
+			}
+		})
+	}
+}
+
+// TestRefuseHandshakeFreesSlot checks that a refused receiver does not hold
+// its MaxHandshakes slot while it waits for the refusal
+func TestRefuseHandshakeFreesSlot(t *testing.T) {
+	defer func(d time.Duration) { refuseDelay = d }(refuseDelay)
+	refuseDelay = time.Second
+
+	client, server := net.Pipe()
+	defer client.Close()
+	sender := &Sender{Code: "123-456", MaxHandshakes: 1}
+	errChan := make(chan error, 1)
+	go func() { errChan <- sender.Handshake(server) }()
+
+	WriteMessage(client, &Message{Type: MsgHandshake, Payload: []byte("654-321")})
+	deadline := time.Now().Add(refuseDelay / 2)
+	for sender.HandshakeStats().Pending != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Slot still taken during the refusal delay")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if msg, err := ReadMessage(client); err != nil || msg.Type != MsgError {
+		t.Errorf("Got %v, %v, want the generic error", msg, err)
+	}
+	if err := <-errChan; err == nil {
+		t.Error("Sender handshake succeeded")
+	}
+}
+
+func TestCodeProof(t *testing.T) {
+	a, b := make([]byte, nonceSize), make([]byte, nonceSize)
+	b[0] = 1
+	key := codeKey("123-456", a)
+	proof := codeProof(key, a, b, roleSender)
+	if !validCodeProof(proof, key, a, b, roleSender) {
+		t.Error("Proof did not validate")
+	}
+	if validCodeProof(proof, codeKey("654-321", a), a, b, roleSender) {
+		t.Error("Proof validated for another code")
+	}
+	if bytes.Equal(key, codeKey("123-456", b)) {
+		t.Error("Key is the same for another salt")
+	}
+	if validCodeProof(proof, key, b, a, roleSender) {
+		t.Error("Proof validated for swapped nonces")
+	}
+	if validCodeProof(proof, key, a, b, roleReceiver) {
+		t.Error("Sender proof validated as a receiver proof")
+	}
+}
+
+// TestCodeKeys checks that the code key is derived once for all handshakes
+func TestCodeKeys(t *testing.T) {
+	var keys codeKeys
+	salt, key, err := keys.get("123-456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt2, key2, err := keys.get("123-456")
+	if err != nil || !bytes.Equal(salt, salt2) || !bytes.Equal(key, key2) {
+		t.Error("Key derived again for the same code")
+	}
+	if !bytes.Equal(key, codeKey("123-456", salt)) {
+		t.Error("Key does not match its salt")
+	}
+	if salt3, _, _ := keys.get("654-321"); bytes.Equal(salt, salt3) {
+		t.Error("Same salt for another code")
+	}
+}
+
+func TestPasswordHandshake(t *testing.T) {
+	t.Run("Match", func(t *testing.T) {
+		senderErr, receiverErr := runHandshake(t, "hunter2", "hunter2")
+		if senderErr != nil {
+			t.Fatalf("Sender handshake failed: %v", senderErr)
+		}
+		// The handshake succeeded, the receiver only fails waiting for the manifest
+		if receiverErr != nil && strings.Contains(receiverErr.Error(), "password") {
+			t.Errorf("Receiver rejected the password: %v", receiverErr)
+		}
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		senderErr, receiverErr := runHandshake(t, "hunter2", "wrong")
+		if CategoryOf(senderErr) != CategoryValidation {
+			t.Errorf("Sender error = %v, want validation", senderErr)
+		}
+		if receiverErr == nil || !strings.Contains(receiverErr.Error(), "incorrect password") {
+			t.Errorf("Receiver error = %v, want incorrect password", receiverErr)
+		}
+	})
+
+	t.Run("ReceiverMissingPassword", func(t *testing.T) {
+		senderErr, receiverErr := runHandshake(t, "hunter2", "")
+		if CategoryOf(senderErr) != CategoryRejected {
+			t.Errorf("Sender error = %v, want rejected", senderErr)
+		}
+		if CategoryOf(receiverErr) != CategoryRejected {
+			t.Errorf("Receiver error = %v, want rejected", receiverErr)
+		}
+	})
+
+	t.Run("SenderMissingPassword", func(t *testing.T) {
+		_, receiverErr := runHandshake(t, "", "hunter2")
+		if CategoryOf(receiverErr) != CategoryValidation {
+			t.Errorf("Receiver error = %v, want validation", receiverErr)
+		}
+	})
+}
+
+func TestPasswordProofBoundToCode(t *testing.T) {
+	nonce := make([]byte, nonceSize)
+	a := passwordProof(passwordKey("123-456", "hunter2"), nonce, roleReceiver)
+	b := passwordProof(passwordKey("654-321", "hunter2"), nonce, roleReceiver)
+	if string(a) == string(b) {
+		t.Error("Proofs for different codes should differ")
+	}
+	if validProof(a, passwordKey("123-456", "hunter2"), nonce, roleSender) {
+		t.Error("Receiver proof should not validate as a sender proof")
+	}
+}
+
+func TestSenderLimits(t *testing.T) {
+	t.Run("Expired", func(t *testing.T) {
+		sender := &Sender{Code: "123-456", ExpiresAt: time.Now().Add(-time.Second)}
+		senderErr, receiverErr := runSenderHandshake(t, sender, "")
+		if !errors.Is(senderErr, ErrExpired) || CategoryOf(senderErr) != CategoryRejected {
+			t.Errorf("Sender error = %v, want rejected as expired", senderErr)
+		}
+		if receiverErr == nil || !strings.Contains(receiverErr.Error(), ErrExpired.Error()) {
+			t.Errorf("Receiver error = %v, want the reason", receiverErr)
+		}
+	})
+
+	t.Run("Withdrawn", func(t *testing.T) {
+		sender := &Sender{Code: "123-456", ExpiresAt: time.Now().Add(time.Hour)}
+		sender.Withdraw()
+		senderErr, receiverErr := runSenderHandshake(t, sender, "")
+		if !errors.Is(senderErr, ErrWithdrawn) || CategoryOf(senderErr) != CategoryRejected {
+			t.Errorf("Sender error = %v, want rejected as withdrawn", senderErr)
+		}
+		if receiverErr == nil || !strings.Contains(receiverErr.Error(), "transfer cancelled") {
+			t.Errorf("Receiver error = %v, want the reason", receiverErr)
+		}
+	})
+
+	t.Run("MaxDownloads", func(t *testing.T) {
+		srcDir := t.TempDir()
+		os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("data"), 0644)
+		sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sender.Code = "123-456"
+		sender.MaxDownloads = 1
+		sender.ExpiresAt = time.Now().Add(time.Hour)
+
+		if sender.Closed() != nil {
+			t.Fatalf("Closed() = %v before the first download", sender.Closed())
+		}
+		loopbackTransfer(t, sender, t.TempDir(), nil)
+		if sender.Downloads() != 1 || !errors.Is(sender.Closed(), ErrDownloadLimit) {
+			t.Fatalf("After one download: Downloads() = %d, Closed() = %v", sender.Downloads(), sender.Closed())
+		}
+		senderErr, receiverErr := runSenderHandshake(t, sender, "")
+		if !errors.Is(senderErr, ErrDownloadLimit) {
+			t.Errorf("Sender error = %v, want the download limit", senderErr)
+		}
+		if receiverErr == nil || !strings.Contains(receiverErr.Error(), ErrDownloadLimit.Error()) {
+			t.Errorf("Receiver error = %v, want the reason", receiverErr)
+		}
+	})
+}
+
+// TestHandshakeLimits checks that silent streams time out and that streams
+// over the limit are refused while they hold their slots
+func TestHandshakeLimits(t *testing.T) {
+	sender := &Sender{Code: "123-456", MaxHandshakes: 2, HandshakeTimeout: 200 * time.Millisecond}
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		client, server := net.Pipe()
+		defer client.Close()
+		go func() { errs <- sender.Handshake(server) }()
+	}
+	// Wait until both silent streams are in the handshake
+	for sender.HandshakeStats().Pending < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	if err := sender.Handshake(server); !errors.Is(err, ErrTooManyHandshakes) || CategoryOf(err) != CategoryRejected {
+		t.Errorf("Handshake over the limit = %v, want ErrTooManyHandshakes", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err == nil {
+			t.Error("Handshake of a silent stream succeeded")
+		}
+	}
+
+	senderErr, _ := runSenderHandshake(t, sender, "")
+	if senderErr != nil {
+		t.Fatalf("Handshake after the others timed out failed: %v", senderErr)
+	}
+	want := HandshakeStats{Accepted: 1, Refused: 1, TimedOut: 2}
+	if stats := sender.HandshakeStats(); stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+}
+
+// TestHandshakeTimeoutEnds checks that HandshakeTimeout does not run on
+// while the sender asks its user to accept the receiver, as with -strict
+func TestHandshakeTimeoutEnds(t *testing.T) {
+	srcDir := t.TempDir()
+	os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("data"), 0644)
+	sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.Code = "123-456"
+	sender.Compress = true
+	sender.HandshakeTimeout = 100 * time.Millisecond
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	recvErr := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			recvErr <- err
+			return
+		}
+		defer conn.Close()
+		receiver := NewReceiver(t.TempDir())
+		receiver.Code = sender.Code
+		recvErr <- receiver.Receive(context.Background(), conn)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := sender.Handshake(conn); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	// The user takes longer to answer than the handshake may
+	time.Sleep(3 * sender.HandshakeTimeout)
+
+	compressed, err := NewCompressedStream(conn)
+	if err != nil {
+		t.Fatalf("Compressed stream after the prompt failed: %v", err)
+	}
+	defer compressed.Close()
+	if _, err := sender.Send(context.Background(), compressed); err != nil {
+		t.Fatalf("Send after the prompt failed: %v", err)
+	}
+	if err := <-recvErr; err != nil {
+		t.Fatalf("Receive failed: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package transfer
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// AutoCompressThroughput is the link speed in bytes per second below which
+// AutoCompress turns compression on. Faster links are not worth the CPU.
+const AutoCompressThroughput = 10 << 20
+
+// compressedTypes are file extensions whose data is compressed already, so
+// gzip only costs time
+var compressedTypes = map[string]bool{
+	".7z": true, ".aac": true, ".apk": true, ".avi": true, ".avif": true,
+	".br": true, ".bz2": true, ".dmg": true, ".docx": true, ".epub": true,
+	".flac": true, ".gif": true, ".gz": true, ".heic": true, ".jar": true,
+	".jpeg": true, ".jpg": true, ".lz4": true, ".m4a": true, ".m4v": true,
+	".mkv": true, ".mov": true, ".mp3": true, ".mp4": true, ".ogg": true,
+	".opus": true, ".png": true, ".pptx": true, ".rar": true, ".tgz": true,
+	".webm": true, ".webp": true, ".xlsx": true, ".xz": true, ".zip": true,
+	".zst": true,
+}
+
+// CompressibleBytes returns how much of the manifest's data is in file
+// types that are not compressed already
+func CompressibleBytes(m *Manifest) int64 {
+	var n int64
+	for _, f := range m.Files {
+		if !compressedTypes[strings.ToLower(path.Ext(f.Path))] {
+			n += f.Size
+		}
+	}
+	return n
+}
+
+// AutoCompress decides whether to compress m over a link that was measured
+// at throughput bytes per second, and describes why. Compression pays off
+// when the link is slow and at least half the data is compressible.
+func AutoCompress(m *Manifest, throughput float64) (bool, string) {
+	speed := FormatBytes(int64(throughput)) + "/s"
+	if throughput <= 0 {
+		return false, "Compression off: the link was not measured"
+	}
+	if throughput >= AutoCompressThroughput {
+		return false, fmt.Sprintf("Compression off: the link is fast (%s)", speed)
+	}
+	compressible := CompressibleBytes(m)
+	if compressible*2 < m.TotalSize {
+		return false, fmt.Sprintf("Compression off: most files are compressed already, the link is %s", speed)
+	}
+	return true, fmt.Sprintf("Compression on: the link is slow (%s) and %d%% of the data is compressible", speed, percentOf(compressible, m.TotalSize))
+}
+
+func percentOf(n, total int64) int64 {
+	if total == 0 {
+		return 100
+	}
+	return n * 100 / total
+}
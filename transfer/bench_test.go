@@ -0,0 +1,175 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// benchFileCount can be changed with TWOC1F_BENCH_FILES
+func benchFileCount(b *testing.B) int {
+	if s := os.Getenv("TWOC1F_BENCH_FILES"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			b.Fatalf("Invalid TWOC1F_BENCH_FILES: %v", err)
+		}
+		return n
+	}
+	return 100000
+}
+
+// smallFiles creates count files of 1 KB spread over 100 directories
+func smallFiles(b *testing.B, count int) string {
+	b.Helper()
+	dir := b.TempDir()
+	data := bytes.Repeat([]byte("x"), 1024)
+	for i := 0; i < count; i++ {
+		sub := filepath.Join(dir, strconv.Itoa(i%100))
+		if i < 100 {
+			if err := os.Mkdir(sub, 0755); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if err := os.WriteFile(filepath.Join(sub, fmt.Sprintf("%d.txt", i)), data, 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// loopbackTransfer sends sender's files to destDir over TCP on localhost.
+// configure may change the receiver before it starts.
+func loopbackTransfer(tb testing.TB, sender *Sender, destDir string, configure func(r *Receiver)) {
+	tb.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer ln.Close()
+
+	errChan := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			errChan <- err
+			return
+		}
+		defer conn.Close()
+		receiver := NewReceiver(destDir)
+		receiver.Code = sender.Code
+		if configure != nil {
+			configure(receiver)
+		}
+		errChan <- receiver.Receive(context.Background(), conn)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer conn.Close()
+	if err := sender.Handshake(conn); err != nil {
+		tb.Fatalf("Handshake failed: %v", err)
+	}
+	var stream io.ReadWriter = conn
+	if sender.Compress {
+		compressed, err := NewCompressedStreamLevel(conn, sender.CompressLevel)
+		if err != nil {
+			tb.Fatalf("Compression failed: %v", err)
+		}
+		defer compressed.Close()
+		stream = compressed
+	}
+	if _, err := sender.Send(context.Background(), stream); err != nil {
+		tb.Fatalf("Send failed: %v", err)
+	}
+	if err := <-errChan; err != nil {
+		tb.Fatalf("Receive failed: %v", err)
+	}
+}
+
+func BenchmarkReadMessage(b *testing.B) {
+	var buf bytes.Buffer
+	WriteMessage(&buf, &Message{Type: MsgFileStart, Payload: []byte(`{"path":"dir/file.txt","size":1024,"offset":0}`)})
+	data := buf.Bytes()
+	r := bytes.NewReader(data)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.Reset(data)
+		if _, err := ReadMessage(r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBuildManifestSmallFiles(b *testing.B) {
+	dir := smallFiles(b, benchFileCount(b))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := BuildManifest(context.Background(), dir, false, false, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTransferSmallFiles(b *testing.B) {
+	count := benchFileCount(b)
+	dir := smallFiles(b, count)
+	sender, err := NewSender(context.Background(), dir, false, false, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	sender.Code = "123-456"
+
+	b.SetBytes(sender.Manifest.TotalSize)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		dest := b.TempDir()
+		b.StartTimer()
+		loopbackTransfer(b, sender, dest, nil)
+	}
+}
+
+// BenchmarkTransferDirectIO compares reading and writing through the page
+// cache with direct I/O. The file size can be changed with
+// TWOC1F_BENCH_FILES in megabytes.
+func BenchmarkTransferDirectIO(b *testing.B) {
+	size := 256
+	if s := os.Getenv("TWOC1F_BENCH_FILES"); s != "" {
+		size = benchFileCount(b)
+	}
+	dir := b.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "big.bin"), directData(size<<20), 0644); err != nil {
+		b.Fatal(err)
+	}
+	for _, direct := range []bool{false, true} {
+		b.Run(fmt.Sprintf("direct=%v", direct), func(b *testing.B) {
+			sender, err := NewSender(context.Background(), dir, false, false, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			sender.Code = "123-456"
+			sender.DirectIO = direct
+
+			b.SetBytes(sender.Manifest.TotalSize)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				dest := b.TempDir()
+				b.StartTimer()
+				loopbackTransfer(b, sender, dest, func(r *Receiver) { r.DirectIO = direct })
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package transfer
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ebob10000/2c1f/cache"
+	"github.com/ebob10000/2c1f/paths"
+	"lukechampine.com/blake3"
+)
+
+// BlockStore keeps blocks of received files by their BLAKE3 hash, the
+// block hashes of a manifest. A receiver with one claims the blocks it
+// already has from earlier transfers and the sender leaves them out, so a
+// dataset shared again only sends what changed.
+type BlockStore struct {
+	Dir string
+}
+
+// GetBlocksPath returns the folder of the default block store
+func GetBlocksPath() string {
+	return paths.Cache("blocks")
+}
+
+// NewBlockStore returns the block store in dir, GetBlocksPath if empty
+func NewBlockStore(dir string) *BlockStore {
+	if dir == "" {
+		dir = GetBlocksPath()
+	}
+	return &BlockStore{Dir: dir}
+}
+
+// path returns where the block hash is kept, empty if hash is not a hex
+// BLAKE3 hash. The hashes come from the sender's manifest.
+func (b *BlockStore) path(hash string) string {
+	if len(hash) != 64 {
+		return ""
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return ""
+	}
+	return filepath.Join(b.Dir, hash[:2], hash)
+}
+
+// Has reports whether the block hash is stored
+func (b *BlockStore) Has(hash string) bool {
+	p := b.path(hash)
+	if p == "" {
+		return false
+	}
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+// Get reads the block hash into buf, which must have room for it, and
+// returns its length. A block that no longer matches its hash is removed.
+func (b *BlockStore) Get(hash string, buf []byte) (int, error) {
+	p := b.path(hash)
+	if p == "" {
+		return 0, fmt.Errorf("invalid block hash %q", hash)
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	if sum := blake3.Sum256(buf[:n]); hex.EncodeToString(sum[:]) != hash {
+		os.Remove(p)
+		return 0, fmt.Errorf("stored block %s is corrupted", hash)
+	}
+	// Blocks in use are trimmed from the cache last
+	now := time.Now()
+	os.Chtimes(p, now, now)
+	return n, nil
+}
+
+// Put stores data as the block hash, unless it is stored already or data
+// does not match it
+func (b *BlockStore) Put(hash string, data []byte) error {
+	p := b.path(hash)
+	if p == "" {
+		return fmt.Errorf("invalid block hash %q", hash)
+	}
+	if sum := blake3.Sum256(data); hex.EncodeToString(sum[:]) != hash {
+		return fmt.Errorf("block does not match its hash %s", hash)
+	}
+	if _, err := os.Stat(p); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".block-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// PutFile stores the blocks of the received file at path, which matched
+// entry's checksum
+func (b *BlockStore) PutFile(path string, entry *FileEntry) error {
+	blockSize := entryBlockSize(entry)
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	pooled := getBlock(blockSize)
+	defer putBlock(pooled)
+	buf := *pooled
+	for _, hash := range entry.BlockHashes {
+		n, err := io.ReadFull(f, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		if err := b.Put(hash, buf[:n]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Claim returns the indexes of the blocks of entry from offset on that are
+// stored, in order
+func (b *BlockStore) Claim(entry *FileEntry, offset int64) []int {
+	blockSize := entryBlockSize(entry)
+	var claimed []int
+	for i, hash := range entry.BlockHashes {
+		if int64(i)*blockSize >= offset && b.Has(hash) {
+			claimed = append(claimed, i)
+		}
+	}
+	return claimed
+}
+
+// keep claims the stored blocks hash, so trimming the cache leaves them
+// until release is called
+func (b *BlockStore) keep(hashes []string) (release func(), err error) {
+	files := make([]string, len(hashes))
+	for i, hash := range hashes {
+		files[i] = b.path(hash)
+	}
+	return cache.Claim(files)
+}
+
+func entryBlockSize(entry *FileEntry) int64 {
+	if entry.BlockSize == 0 {
+		return LegacyBlockSize
+	}
+	return entry.BlockSize
+}
+
+// blockLength returns the length of block i of entry
+func blockLength(entry *FileEntry, i int) int64 {
+	blockSize := entryBlockSize(entry)
+	return min(blockSize, entry.Size-int64(i)*blockSize)
+}
+
+// claimedBytes returns how many bytes of entry the blocks claimed hold
+func claimedBytes(entry *FileEntry, claimed []int) int64 {
+	var n int64
+	for _, i := range claimed {
+		n += blockLength(entry, i)
+	}
+	return n
+}
+
+// validClaims reports whether claimed lists blocks of entry from offset on,
+// in order and each once
+func validClaims(entry *FileEntry, offset int64, claimed []int) bool {
+	blockSize := entryBlockSize(entry)
+	if !sort.IntsAreSorted(claimed) {
+		return false
+	}
+	for j, i := range claimed {
+		if i < 0 || i >= len(entry.BlockHashes) || int64(i)*blockSize < offset || int64(i)*blockSize >= entry.Size || (j > 0 && claimed[j-1] == i) {
+			return false
+		}
+	}
+	return true
+}
+
+// claimReader reads a file from offset with its claimed blocks taken from
+// the block store and the rest from the sender
+type claimReader struct {
+	src     io.Reader
+	store   *BlockStore
+	entry   *FileEntry
+	claimed []int
+	pos     int64
+	block   []byte // Rest of the claimed block being read
+	buf     *[]byte
+}
+
+func newClaimReader(src io.Reader, store *BlockStore, entry *FileEntry, offset int64, claimed []int) *claimReader {
+	return &claimReader{src: src, store: store, entry: entry, claimed: claimed, pos: offset}
+}
+
+func (c *claimReader) Read(p []byte) (int, error) {
+	if len(c.block) == 0 && len(c.claimed) > 0 && int64(c.claimed[0])*entryBlockSize(c.entry) == c.pos {
+		if c.buf == nil {
+			c.buf = getBlock(entryBlockSize(c.entry))
+		}
+		n, err := c.store.Get(c.entry.BlockHashes[c.claimed[0]], *c.buf)
+		if err != nil {
+			return 0, err
+		}
+		if int64(n) != blockLength(c.entry, c.claimed[0]) {
+			return 0, errors.New("stored block has the wrong length")
+		}
+		c.block = (*c.buf)[:n]
+		c.claimed = c.claimed[1:]
+	}
+	if len(c.block) > 0 {
+		n := copy(p, c.block)
+		c.block = c.block[n:]
+		c.pos += int64(n)
+		return n, nil
+	}
+	if len(c.claimed) > 0 {
+		p = p[:min(int64(len(p)), int64(c.claimed[0])*entryBlockSize(c.entry)-c.pos)]
+	}
+	n, err := c.src.Read(p)
+	c.pos += int64(n)
+	return n, err
+}
+
+// Close returns the block buffer to the pool
+func (c *claimReader) Close() {
+	if c.buf != nil {
+		putBlock(c.buf)
+		c.buf = nil
+	}
+}
+
+// skipReader reads a file from offset without the blocks the receiver
+// claimed, seeking past them
+type skipReader struct {
+	file    io.Reader
+	entry   *FileEntry
+	claimed []int
+	pos     int64
+	skipped int64 // Bytes of claimed blocks passed
+}
+
+func (s *skipReader) Read(p []byte) (int, error) {
+	blockSize := entryBlockSize(s.entry)
+	for len(s.claimed) > 0 && int64(s.claimed[0])*blockSize == s.pos {
+		n := blockLength(s.entry, s.claimed[0])
+		var err error
+		if seeker, ok := s.file.(io.Seeker); ok {
+			_, err = seeker.Seek(n, io.SeekCurrent)
+		} else {
+			_, err = io.CopyN(io.Discard, s.file, n)
+		}
+		if err != nil {
+			return 0, err
+		}
+		s.pos += n
+		s.skipped += n
+		s.claimed = s.claimed[1:]
+	}
+	if len(s.claimed) > 0 {
+		p = p[:min(int64(len(p)), int64(s.claimed[0])*blockSize-s.pos)]
+	}
+	n, err := s.file.Read(p)
+	s.pos += int64(n)
+	return n, err
+}
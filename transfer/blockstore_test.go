@@ -0,0 +1,120 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"lukechampine.com/blake3"
+)
+
+func TestBlockStore(t *testing.T) {
+	store := NewBlockStore(t.TempDir())
+	data := []byte("block")
+	sum := blake3.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	if err := store.Put(hash, []byte("other")); err == nil {
+		t.Error("Put() of data not matching its hash should fail")
+	}
+	for _, bad := range []string{"", "../../etc/passwd", hash[:62] + "zz"} {
+		if err := store.Put(bad, data); err == nil {
+			t.Errorf("Put(%q) should fail", bad)
+		}
+		if store.Has(bad) {
+			t.Errorf("Has(%q) = true", bad)
+		}
+	}
+	if err := store.Put(hash, data); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	buf := make([]byte, 16)
+	if n, err := store.Get(hash, buf); err != nil || !bytes.Equal(buf[:n], data) {
+		t.Errorf("Get() = %q, %v", buf[:n], err)
+	}
+
+	if err := os.WriteFile(store.path(hash), []byte("blick"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(hash, buf); err == nil {
+		t.Error("Get() of a corrupted block should fail")
+	}
+	if store.Has(hash) {
+		t.Error("corrupted block kept in the store")
+	}
+}
+
+// smallBlocks hashes the files of the sender's manifest in blocks of size,
+// so a test needs no 16 MB files
+func smallBlocks(t *testing.T, sender *Sender, size int64) {
+	t.Helper()
+	for i := range sender.Manifest.Files {
+		entry := &sender.Manifest.Files[i]
+		data, err := os.ReadFile(filepath.Join(sender.FolderPath, entry.Path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry.BlockSize = size
+		entry.BlockHashes = nil
+		for off := int64(0); off < int64(len(data)); off += size {
+			sum := blake3.Sum256(data[off:min(off+size, int64(len(data)))])
+			entry.BlockHashes = append(entry.BlockHashes, hex.EncodeToString(sum[:]))
+		}
+	}
+}
+
+func TestTransferBlockStore(t *testing.T) {
+	const blockSize = 64 << 10
+	for _, split := range []bool{false, true} {
+		srcDir := t.TempDir()
+		data := compressibleData(5*blockSize + 100)
+		for i := range data {
+			data[i] ^= byte(i / blockSize)
+		}
+		src := filepath.Join(srcDir, "data.bin")
+		os.WriteFile(src, data, 0644)
+		store := NewBlockStore(t.TempDir())
+
+		receive := func(dest string) *Receiver {
+			t.Helper()
+			sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sender.Code = "123-456"
+			smallBlocks(t, sender, blockSize)
+			var receiver *Receiver
+			sendErr, recvErr := splitTransfer(t, context.Background(), sender, dest, func(r *Receiver) {
+				if !split {
+					r.DataStream = nil
+				}
+				r.BlockStore = store
+				receiver = r
+			})
+			if sendErr != nil || recvErr != nil {
+				t.Fatalf("Split %v: send error %v, receive error %v", split, sendErr, recvErr)
+			}
+			got, err := os.ReadFile(filepath.Join(dest, filepath.Base(srcDir), "data.bin"))
+			if err != nil || !bytes.Equal(got, data) {
+				t.Fatalf("Split %v: received file differs from the original, %v", split, err)
+			}
+			return receiver
+		}
+
+		if r := receive(t.TempDir()); len(r.claimed) != 0 {
+			t.Errorf("Split %v: claimed %v from an empty store", split, r.claimed)
+		}
+
+		// The same file with its third block changed only sends that block
+		copy(data[2*blockSize:], "changed")
+		os.WriteFile(src, data, 0644)
+		r := receive(t.TempDir())
+		if want := []int{0, 1, 3, 4, 5}; !reflect.DeepEqual(r.claimed["data.bin"], want) {
+			t.Errorf("Split %v: claimed %v, want %v", split, r.claimed["data.bin"], want)
+		}
+	}
+}
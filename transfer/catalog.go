@@ -0,0 +1,159 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// MaxShareLabel is the longest label a share in a Catalog may have
+const MaxShareLabel = 64
+
+// Catalog offers several shares under one code, so a long-running sender
+// can serve multiple folders without restarting. Receivers pick a share by
+// its label in the handshake, see Receiver.Share.
+type Catalog struct {
+	Code             string
+	MaxHandshakes    int           // Streams in the handshake at once, DefaultMaxHandshakes if zero
+	HandshakeTimeout time.Duration // DefaultHandshakeTimeout if zero
+
+	mu       sync.Mutex
+	shares   map[string]*Sender
+	pending  int      // Streams in the handshake
+	codeKeys codeKeys // Key of Code for the handshakes
+}
+
+// NewCatalog returns an empty catalog for code
+func NewCatalog(code string) *Catalog {
+	return &Catalog{Code: code, shares: make(map[string]*Sender)}
+}
+
+// Add offers the files of s under label. Only its files and options are
+// used, each receiver gets a Sender of its own from Handshake.
+func (c *Catalog) Add(label string, s *Sender) error {
+	if err := CheckShareLabel(label); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.shares[label]; ok {
+		return validationError("", fmt.Errorf("share %q already exists", label))
+	}
+	c.shares[label] = s
+	return nil
+}
+
+// Remove stops offering the share label. Transfers of it continue.
+func (c *Catalog) Remove(label string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.shares, label)
+}
+
+// Labels returns the labels of the shares, sorted
+func (c *Catalog) Labels() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	labels := make([]string, 0, len(c.shares))
+	for label := range c.shares {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// Handshake checks the code the receiver sent on stream and returns a
+// Sender for the share it asked for, ready to Send. dataStream becomes its
+// DataStream. Receivers that name no share or an unknown one are told the
+// labels, once they proved they know the code.
+func (c *Catalog) Handshake(stream io.ReadWriter, dataStream func(ctx context.Context, token []byte) (io.ReadWriteCloser, error)) (_ *Sender, err error) {
+	if !c.beginHandshake() {
+		return nil, rejectedError("", ErrTooManyHandshakes)
+	}
+	defer func() {
+		c.endHandshake()
+		refuseHandshake(stream, err)
+	}()
+
+	timeout := c.HandshakeTimeout
+	if timeout <= 0 {
+		timeout = DefaultHandshakeTimeout
+	}
+	handshake, err := readHandshake(stream, timeout, &c.codeKeys, c.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	share := c.shares[handshake.Share]
+	c.mu.Unlock()
+	if share == nil {
+		errMsg := fmt.Sprintf("no share %q, choose one of: %s", handshake.Share, strings.Join(c.Labels(), ", "))
+		if handshake.Share == "" {
+			errMsg = "choose a share: " + strings.Join(c.Labels(), ", ")
+		}
+		WriteMessage(stream, &Message{Type: MsgError, Payload: []byte(errMsg)})
+		return nil, validationError("", errors.New(errMsg))
+	}
+
+	s := &Sender{
+		FolderPath:    share.FolderPath,
+		Source:        share.Source,
+		Code:          c.Code,
+		Password:      share.Password,
+		Compress:      share.Compress,
+		CompressLevel: share.CompressLevel,
+		Manifest:      share.Manifest,
+		Timeout:       share.Timeout,
+		ExpiresAt:     share.ExpiresAt,
+		DataStream:    dataStream,
+		SourceLimit:   share.SourceLimit,
+		original:      share.original,
+		// Receivers of the share read its files no faster together
+		readLimiter: share.hashLimiter(),
+	}
+	if err := s.accept(stream, s.options()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (c *Catalog) beginHandshake() bool {
+	limit := c.MaxHandshakes
+	if limit <= 0 {
+		limit = DefaultMaxHandshakes
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending >= limit {
+		return false
+	}
+	c.pending++
+	return true
+}
+
+func (c *Catalog) endHandshake() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending--
+}
+
+// CheckShareLabel allows letters, digits, dots, dashes and underscores,
+// so labels are easy to type and safe to show
+func CheckShareLabel(label string) error {
+	if label == "" || len(label) > MaxShareLabel {
+		return validationError("", fmt.Errorf("share label must be 1 to %d characters", MaxShareLabel))
+	}
+	for _, r := range label {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("._-", r) {
+			return validationError("", fmt.Errorf("invalid share label %q, use letters, digits, dots, dashes and underscores", label))
+		}
+	}
+	return nil
+}
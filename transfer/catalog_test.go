@@ -0,0 +1,97 @@
+package transfer
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCatalog(t *testing.T) {
+	catalog := NewCatalog("123-456-789")
+	for label, content := range map[string]string{"docs": "report", "photos": "beach"} {
+		dir := filepath.Join(t.TempDir(), label)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, label+".txt"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		sender, err := NewSender(context.Background(), dir, false, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := catalog.Add(label, sender); err != nil {
+			t.Fatalf("Add(%s) error = %v", label, err)
+		}
+	}
+	if err := catalog.Add("docs", &Sender{}); CategoryOf(err) != CategoryValidation {
+		t.Errorf("Add() of an existing label error = %v", err)
+	}
+	if err := catalog.Add("../etc", &Sender{}); CategoryOf(err) != CategoryValidation {
+		t.Errorf("Add() of an invalid label error = %v", err)
+	}
+
+	receive := func(share, destDir string) (sendErr, recvErr error) {
+		client, server := net.Pipe()
+		defer client.Close()
+		errChan := make(chan error, 1)
+		go func() {
+			receiver := NewReceiver(destDir)
+			receiver.Code = catalog.Code
+			receiver.Share = share
+			errChan <- receiver.Receive(context.Background(), client)
+		}()
+		sender, err := catalog.Handshake(server, nil)
+		if err == nil {
+			_, err = sender.Send(context.Background(), server)
+		}
+		server.Close()
+		return err, <-errChan
+	}
+
+	destDir := t.TempDir()
+	sendErr, recvErr := receive("photos", destDir)
+	if sendErr != nil || recvErr != nil {
+		t.Fatalf("Send error %v, receive error %v", sendErr, recvErr)
+	}
+	if got, _ := os.ReadFile(filepath.Join(destDir, "photos", "photos.txt")); string(got) != "beach" {
+		t.Errorf("photos.txt = %q, want the photos share", got)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "docs")); !os.IsNotExist(err) {
+		t.Error("received a share that was not asked for")
+	}
+
+	for _, share := range []string{"", "music"} {
+		sendErr, recvErr := receive(share, t.TempDir())
+		if CategoryOf(sendErr) != CategoryValidation {
+			t.Errorf("Handshake() for share %q error = %v", share, sendErr)
+		}
+		if recvErr == nil || !strings.Contains(recvErr.Error(), "docs, photos") {
+			t.Errorf("Receive() of share %q error = %v, want the labels", share, recvErr)
+		}
+	}
+
+	catalog.Remove("docs")
+	if labels := catalog.Labels(); len(labels) != 1 || labels[0] != "photos" {
+		t.Errorf("Labels() after Remove() = %v", labels)
+	}
+}
+
+func TestSenderRefusesShares(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go func() {
+		receiver := NewReceiver(t.TempDir())
+		receiver.Code = "123-456-789"
+		receiver.Share = "docs"
+		receiver.Receive(context.Background(), client)
+	}()
+	sender := &Sender{Code: "123-456-789", Manifest: &Manifest{}}
+	if err := sender.Handshake(server); CategoryOf(err) != CategoryValidation {
+		t.Errorf("Handshake() asking for a share error = %v, want a validation error", err)
+	}
+}
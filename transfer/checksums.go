@@ -0,0 +1,126 @@
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"lukechampine.com/blake3"
+)
+
+// Algorithms of the checksum file written after receiving, see
+// Receiver.Checksums
+const (
+	ChecksumSHA256 = "sha256"
+	ChecksumBLAKE3 = "blake3"
+)
+
+// checksumExt names the checksum file after the folder, such as
+// Photos.SHA256SUMS
+var checksumExt = map[string]string{
+	ChecksumSHA256: ".SHA256SUMS",
+	ChecksumBLAKE3: ".B3SUMS",
+}
+
+// CheckChecksumAlgorithm returns an error unless algo is ChecksumSHA256,
+// ChecksumBLAKE3 or empty for none
+func CheckChecksumAlgorithm(algo string) error {
+	if _, ok := checksumExt[algo]; !ok && algo != "" {
+		return fmt.Errorf("invalid checksum algorithm %q, must be %s or %s", algo, ChecksumSHA256, ChecksumBLAKE3)
+	}
+	return nil
+}
+
+// writeChecksums writes the checksums of the received files next to their
+// folder, in the format sha256sum and b3sum check. The files were hashed as
+// they arrived, only those already complete before are read again.
+func (r *Receiver) writeChecksums(destFolder string) error {
+	paths := make([]string, 0, len(r.entries))
+	for p := range r.entries {
+		// Files left out were not received, so there is nothing to list
+		if !r.Skip[p] {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	folder := r.folderName()
+	if r.Storage == nil {
+		folder = filepath.Base(destFolder)
+	}
+	var b strings.Builder
+	for _, p := range paths {
+		sum, ok := r.sums[p]
+		if !ok {
+			var err error
+			if sum, err = r.fileChecksum(destFolder, r.entries[p]); err != nil {
+				return err
+			}
+		}
+		name := p
+		if r.Storage == nil {
+			name = filepath.ToSlash(localName(p))
+		}
+		b.WriteString(checksumLine(sum, folder+"/"+name))
+	}
+
+	name := folder + checksumExt[r.Checksums]
+	if r.Storage != nil {
+		w, err := r.Storage.Open(name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			w.Close()
+			return err
+		}
+		return w.Close()
+	}
+	path := filepath.Join(filepath.Dir(destFolder), name)
+	if err := validatePath(path, r.DestPath); err != nil {
+		return err
+	}
+	return os.WriteFile(longPath(path), []byte(b.String()), 0644)
+}
+
+// fileChecksum hashes a file that was complete before the transfer
+func (r *Receiver) fileChecksum(destFolder string, entry *FileEntry) (string, error) {
+	// Its blocks matched the manifest, so the file has its checksum
+	if r.Checksums == ChecksumBLAKE3 && entry.Checksum != "" {
+		return entry.Checksum, nil
+	}
+	f, err := os.Open(longPath(r.names.resolve(filepath.Join(destFolder, localName(entry.Path)))))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := newChecksum(r.Checksums)
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", entry.Path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checksumLine formats a line of a checksum file. Names with a backslash or
+// newline are escaped and the line marked with a backslash, as sha256sum
+// does.
+func checksumLine(sum, name string) string {
+	if strings.ContainsAny(name, "\\\n") {
+		name = strings.NewReplacer("\\", "\\\\", "\n", "\\n").Replace(name)
+		return "\\" + sum + "  " + name + "\n"
+	}
+	return sum + "  " + name + "\n"
+}
+
+func newChecksum(algo string) hash.Hash {
+	if algo == ChecksumSHA256 {
+		return sha256.New()
+	}
+	return blake3.New(32, nil)
+}
@@ -0,0 +1,89 @@
+package transfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"lukechampine.com/blake3"
+)
+
+func TestChecksumLine(t *testing.T) {
+	if got := checksumLine("abc", "photos/a b.jpg"); got != "abc  photos/a b.jpg\n" {
+		t.Errorf("checksumLine = %q", got)
+	}
+	if got := checksumLine("abc", "photos/a\\b\nc"); got != "\\abc  photos/a\\\\b\\nc\n" {
+		t.Errorf("checksumLine with escapes = %q", got)
+	}
+}
+
+func TestTransferWritesChecksums(t *testing.T) {
+	srcDir := t.TempDir()
+	os.MkdirAll(filepath.Join(srcDir, "sub"), 0755)
+	os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("alpha"), 0644)
+	os.WriteFile(filepath.Join(srcDir, "sub", "b.txt"), []byte("beta"), 0644)
+	folder := filepath.Base(srcDir)
+
+	for algo, sum := range map[string]func(string) string{
+		ChecksumSHA256: func(s string) string { h := sha256.Sum256([]byte(s)); return hex.EncodeToString(h[:]) },
+		ChecksumBLAKE3: func(s string) string { h := blake3.Sum256([]byte(s)); return hex.EncodeToString(h[:]) },
+	} {
+		sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sender.Code = "123-456"
+
+		// A file complete before the transfer is not sent but still listed
+		destDir := t.TempDir()
+		os.MkdirAll(filepath.Join(destDir, folder), 0755)
+		os.WriteFile(filepath.Join(destDir, folder, "a.txt"), []byte("alpha"), 0644)
+
+		sendErr, recvErr := splitTransfer(t, context.Background(), sender, destDir, func(r *Receiver) {
+			r.Checksums = algo
+		})
+		if sendErr != nil || recvErr != nil {
+			t.Fatalf("Send error %v, receive error %v", sendErr, recvErr)
+		}
+		data, err := os.ReadFile(filepath.Join(destDir, folder+checksumExt[algo]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := sum("alpha") + "  " + folder + "/a.txt\n" + sum("beta") + "  " + folder + "/sub/b.txt\n"
+		if string(data) != want {
+			t.Errorf("%s checksum file:\n%s\nwant\n%s", algo, data, want)
+		}
+	}
+}
+
+func TestChecksumsLeaveOutSkipped(t *testing.T) {
+	srcDir := t.TempDir()
+	os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("alpha"), 0644)
+	os.WriteFile(filepath.Join(srcDir, "b.txt"), []byte("beta"), 0644)
+	folder := filepath.Base(srcDir)
+	sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.Code = "123-456"
+
+	destDir := t.TempDir()
+	sendErr, recvErr := splitTransfer(t, context.Background(), sender, destDir, func(r *Receiver) {
+		r.Checksums = ChecksumSHA256
+		r.Skip = map[string]bool{"b.txt": true}
+	})
+	if sendErr != nil || recvErr != nil {
+		t.Fatalf("Send error %v, receive error %v", sendErr, recvErr)
+	}
+	data, err := os.ReadFile(filepath.Join(destDir, folder+checksumExt[ChecksumSHA256]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := sha256.Sum256([]byte("alpha"))
+	if want := hex.EncodeToString(h[:]) + "  " + folder + "/a.txt\n"; string(data) != want {
+		t.Errorf("checksum file:\n%s\nwant\n%s", data, want)
+	}
+}
@@ -0,0 +1,263 @@
+package transfer
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultCompressLevel is the gzip level used when none is set. gzip is the
+// only codec, as receivers cannot tell the sender which others they read.
+const DefaultCompressLevel = 6
+
+// compressBlockSize is the amount of data each worker compresses at once
+const compressBlockSize = 1 << 20
+
+// compressWorkers is the number of blocks compressed in parallel. With one
+// worker the standard gzip writer is used.
+var compressWorkers = min(runtime.NumCPU(), 8)
+
+// CheckCompressLevel returns an error unless level is a gzip level from 1
+// (fastest) to 9 (smallest), or 0 for DefaultCompressLevel
+func CheckCompressLevel(level int) error {
+	if level < 0 || level > gzip.BestCompression {
+		return fmt.Errorf("invalid compression level %d, must be between %d and %d", level, gzip.BestSpeed, gzip.BestCompression)
+	}
+	return nil
+}
+
+type compressWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+var (
+	compressBufPool sync.Pool
+	flatePools      [gzip.BestCompression + 1]sync.Pool
+)
+
+// compressedBlock is one block of input and its compressed form, which is
+// ready once done is closed
+type compressedBlock struct {
+	data []byte
+	out  bytes.Buffer
+	done chan struct{}
+}
+
+func (b *compressedBlock) compress(level int) {
+	defer close(b.done)
+	fw, _ := flatePools[level].Get().(*flate.Writer)
+	if fw == nil {
+		fw, _ = flate.NewWriter(&b.out, level)
+	} else {
+		fw.Reset(&b.out)
+	}
+	// A sync flush ends the block on a byte boundary without marking it as
+	// final, so the blocks can be concatenated into one deflate stream
+	fw.Write(b.data)
+	fw.Flush()
+	flatePools[level].Put(fw)
+}
+
+// parallelWriter writes the same gzip stream as gzip.Writer, but compresses
+// blocks of input in parallel so compression is not limited to one core.
+// Blocks are compressed independently, which costs a little ratio.
+type parallelWriter struct {
+	w       io.Writer
+	level   int
+	workers int
+	header  bool // Whether the gzip header was written
+	buf     []byte
+	pending []*compressedBlock // Blocks being compressed, in stream order
+	crc     uint32
+	size    uint32
+	err     error
+}
+
+func newParallelWriter(w io.Writer, level, workers int) *parallelWriter {
+	return &parallelWriter{w: w, level: level, workers: workers}
+}
+
+func (pw *parallelWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if pw.err != nil {
+			return written, pw.err
+		}
+		if pw.buf == nil {
+			if buf, ok := compressBufPool.Get().([]byte); ok {
+				pw.buf = buf[:0]
+			} else {
+				pw.buf = make([]byte, 0, compressBlockSize)
+			}
+		}
+		n := copy(pw.buf[len(pw.buf):cap(pw.buf)], p)
+		pw.buf = pw.buf[:len(pw.buf)+n]
+		p = p[n:]
+		written += n
+		if len(pw.buf) == cap(pw.buf) {
+			pw.dispatch()
+		}
+	}
+	return written, nil
+}
+
+// dispatch starts compressing the buffered input. Once all workers are busy
+// it waits for the oldest block and writes it out.
+func (pw *parallelWriter) dispatch() {
+	if len(pw.buf) == 0 {
+		return
+	}
+	b := &compressedBlock{data: pw.buf, done: make(chan struct{})}
+	pw.buf = nil
+	pw.crc = crc32.Update(pw.crc, crc32.IEEETable, b.data)
+	pw.size += uint32(len(b.data))
+	go b.compress(pw.level)
+
+	pw.pending = append(pw.pending, b)
+	if len(pw.pending) >= pw.workers {
+		pw.writeBlock()
+	}
+}
+
+func (pw *parallelWriter) writeBlock() {
+	b := pw.pending[0]
+	pw.pending = pw.pending[1:]
+	<-b.done
+	pw.write(b.out.Bytes())
+	compressBufPool.Put(b.data)
+}
+
+func (pw *parallelWriter) write(p []byte) {
+	if pw.err != nil {
+		return
+	}
+	if !pw.header {
+		pw.header = true
+		// The header gzip.Writer writes without a name or time
+		if _, pw.err = pw.w.Write([]byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 0xff}); pw.err != nil {
+			return
+		}
+	}
+	if len(p) > 0 {
+		_, pw.err = pw.w.Write(p)
+	}
+}
+
+// Flush compresses and writes all buffered data, so the reader can decode
+// everything written so far
+func (pw *parallelWriter) Flush() error {
+	pw.dispatch()
+	for len(pw.pending) > 0 {
+		pw.writeBlock()
+	}
+	pw.write(nil)
+	return pw.err
+}
+
+// Close ends the deflate stream and writes the gzip trailer. It does not
+// close the underlying writer.
+func (pw *parallelWriter) Close() error {
+	if err := pw.Flush(); err != nil {
+		return err
+	}
+	// An empty final block followed by the checksum and size
+	trailer := []byte{3, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(trailer[2:], pw.crc)
+	binary.LittleEndian.PutUint32(trailer[6:], pw.size)
+	pw.write(trailer)
+	return pw.err
+}
+
+func newCompressWriter(w io.Writer, level int) (compressWriter, error) {
+	if err := CheckCompressLevel(level); err != nil {
+		return nil, err
+	}
+	if level == 0 {
+		level = DefaultCompressLevel
+	}
+	if compressWorkers > 1 {
+		return newParallelWriter(w, level, compressWorkers), nil
+	}
+	return gzip.NewWriterLevel(w, level)
+}
+
+// CompressionStats tells how well compression did on a transfer, so users
+// can judge whether to keep it on
+type CompressionStats struct {
+	Logical int64         `json:"logical"` // Bytes of data before compression
+	Wire    int64         `json:"wire"`    // Bytes sent or received compressed
+	CPUTime time.Duration `json:"cpuTime"` // Time spent compressing and decompressing, without waiting for the network
+}
+
+// Ratio returns how many bytes of data each byte on the wire carried, zero
+// if nothing was sent
+func (c CompressionStats) Ratio() float64 {
+	if c.Wire == 0 {
+		return 0
+	}
+	return float64(c.Logical) / float64(c.Wire)
+}
+
+// Saved returns the share of the data compression saved, negative if it
+// made the data larger
+func (c CompressionStats) Saved() float64 {
+	if c.Logical == 0 {
+		return 0
+	}
+	return 1 - float64(c.Wire)/float64(c.Logical)
+}
+
+// String formats the stats such as "2.10x (52% saved, 1.2s CPU)"
+func (c CompressionStats) String() string {
+	return fmt.Sprintf("%.2fx (%.0f%% saved, %s CPU)", c.Ratio(), c.Saved()*100, c.CPUTime.Round(10*time.Millisecond))
+}
+
+// compressionOf adds up the stats of the compressed streams among streams,
+// each once
+func compressionOf(streams ...any) CompressionStats {
+	var total CompressionStats
+	seen := make(map[*CompressedStream]bool)
+	for _, s := range streams {
+		if cs, ok := s.(*CompressedStream); ok && !seen[cs] {
+			seen[cs] = true
+			stats := cs.Stats()
+			total.Logical += stats.Logical
+			total.Wire += stats.Wire
+			total.CPUTime += stats.CPUTime
+		}
+	}
+	return total
+}
+
+// wireCounter counts the bytes a compressed stream reads and writes on the
+// connection and how long that takes
+type wireCounter struct {
+	rw    io.ReadWriter
+	bytes atomic.Int64
+	busy  atomic.Int64 // Nanoseconds
+}
+
+func (w *wireCounter) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := w.rw.Read(p)
+	w.busy.Add(int64(time.Since(start)))
+	w.bytes.Add(int64(n))
+	return n, err
+}
+
+func (w *wireCounter) Write(p []byte) (int, error) {
+	start := time.Now()
+	n, err := w.rw.Write(p)
+	w.busy.Add(int64(time.Since(start)))
+	w.bytes.Add(int64(n))
+	return n, err
+}
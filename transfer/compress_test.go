@@ -0,0 +1,286 @@
+package transfer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// compressibleData returns n bytes of text with some random content mixed in
+func compressibleData(n int) []byte {
+	var buf bytes.Buffer
+	noise := make([]byte, 8)
+	for i := 0; buf.Len() < n; i++ {
+		rand.Read(noise)
+		fmt.Fprintf(&buf, "line %d of the test data %x\n", i, noise)
+	}
+	return buf.Bytes()[:n]
+}
+
+func TestParallelWriterRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, compressBlockSize - 1, compressBlockSize, 5*compressBlockSize + 123} {
+		for _, level := range []int{1, DefaultCompressLevel, 9} {
+			t.Run(fmt.Sprintf("%d/%d", size, level), func(t *testing.T) {
+				data := compressibleData(size)
+				var out bytes.Buffer
+				pw := newParallelWriter(&out, level, 3)
+
+				// Uneven writes and flushes in between must not change the data
+				for rest := data; len(rest) > 0; {
+					n := min(len(rest), 300000)
+					if _, err := pw.Write(rest[:n]); err != nil {
+						t.Fatalf("Write failed: %v", err)
+					}
+					rest = rest[n:]
+					if len(rest)%2 == 0 {
+						pw.Flush()
+					}
+				}
+				if err := pw.Close(); err != nil {
+					t.Fatalf("Close failed: %v", err)
+				}
+
+				r, err := gzip.NewReader(&out)
+				if err != nil {
+					t.Fatalf("NewReader failed: %v", err)
+				}
+				got, err := io.ReadAll(r)
+				if err != nil {
+					t.Fatalf("Decompressing failed: %v", err)
+				}
+				if !bytes.Equal(got, data) {
+					t.Fatalf("Got %d bytes back, want %d identical bytes", len(got), len(data))
+				}
+			})
+		}
+	}
+}
+
+func TestParallelWriterFlush(t *testing.T) {
+	var out bytes.Buffer
+	pw := newParallelWriter(&out, DefaultCompressLevel, 4)
+	if err := pw.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	// The reader needs the header right away to start the stream
+	r, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatalf("Header not written on flush: %v", err)
+	}
+
+	pw.Write([]byte("hello"))
+	pw.Flush()
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(r, buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("Flushed data not readable: %q, %v", buf, err)
+	}
+}
+
+func TestCompressLevels(t *testing.T) {
+	data := compressibleData(4 * compressBlockSize)
+	size := func(level int) int {
+		var out bytes.Buffer
+		pw := newParallelWriter(&out, level, 2)
+		pw.Write(data)
+		pw.Close()
+		return out.Len()
+	}
+	if fast, best := size(1), size(9); best >= fast {
+		t.Errorf("Level 9 output %d bytes not smaller than level 1 output %d bytes", best, fast)
+	}
+
+	for _, level := range []int{-1, 10} {
+		if err := CheckCompressLevel(level); err == nil {
+			t.Errorf("CheckCompressLevel(%d) accepted invalid level", level)
+		}
+		if _, err := NewCompressedStreamLevel(nopStream{io.Discard}, level); err == nil {
+			t.Errorf("NewCompressedStreamLevel(%d) accepted invalid level", level)
+		}
+	}
+}
+
+type nopStream struct {
+	io.Writer
+}
+
+func (nopStream) Read([]byte) (int, error) { return 0, io.EOF }
+func (nopStream) Close() error             { return nil }
+
+func BenchmarkCompress(b *testing.B) {
+	data := compressibleData(16 * compressBlockSize)
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("Workers%d", workers), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				var w compressWriter
+				if workers == 1 {
+					w, _ = gzip.NewWriterLevel(io.Discard, DefaultCompressLevel)
+				} else {
+					w = newParallelWriter(io.Discard, DefaultCompressLevel, workers)
+				}
+				w.Write(data)
+				w.Close()
+			}
+		})
+	}
+}
+
+func TestParallelCompressedTransfer(t *testing.T) {
+	defer func(workers int) { compressWorkers = workers }(compressWorkers)
+	compressWorkers = 3
+
+	srcDir := t.TempDir()
+	files := map[string][]byte{
+		"small.txt": []byte("small"),
+		"large.txt": compressibleData(3*compressBlockSize + 17),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(srcDir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.Code = "123-456"
+	sender.Compress = true
+	sender.CompressLevel = 1
+
+	destDir := t.TempDir()
+	loopbackTransfer(t, sender, destDir, nil)
+
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(destDir, filepath.Base(srcDir), name))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: got %d bytes, want %d identical bytes", name, len(got), len(want))
+		}
+	}
+}
+
+func TestAutoCompress(t *testing.T) {
+	text := &Manifest{TotalSize: 300, Files: []FileEntry{{Path: "a.txt", Size: 200}, {Path: "b.JPG", Size: 100}}}
+	media := &Manifest{TotalSize: 300, Files: []FileEntry{{Path: "a.txt", Size: 100}, {Path: "dir/b.mp4", Size: 200}}}
+	tests := []struct {
+		m          *Manifest
+		throughput float64
+		want       bool
+	}{
+		{text, 1 << 20, true},
+		{text, AutoCompressThroughput, false},
+		{text, 0, false},
+		{media, 1 << 20, false},
+	}
+	for _, tt := range tests {
+		got, reason := AutoCompress(tt.m, tt.throughput)
+		if got != tt.want || reason == "" {
+			t.Errorf("AutoCompress(%v, %v) = %v, %q, want %v", tt.m.Files, tt.throughput, got, reason, tt.want)
+		}
+	}
+	if got := CompressibleBytes(text); got != 200 {
+		t.Errorf("CompressibleBytes() = %d, want 200", got)
+	}
+}
+
+func TestCompressionStats(t *testing.T) {
+	srcDir := t.TempDir()
+	os.WriteFile(filepath.Join(srcDir, "large.txt"), compressibleData(2*compressBlockSize), 0644)
+	sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.Code = "123-456"
+	sender.Compress = true
+
+	var receiver *Receiver
+	delivery, sendErr, recvErr := splitSend(t, context.Background(), sender, t.TempDir(), func(r *Receiver) {
+		receiver = r
+	})
+	if sendErr != nil || recvErr != nil {
+		t.Fatalf("Send error %v, receive error %v", sendErr, recvErr)
+	}
+	for name, stats := range map[string]CompressionStats{"sender": delivery.Compression, "receiver": receiver.Compression} {
+		if stats.Wire == 0 || stats.Logical < sender.Manifest.TotalSize || stats.Ratio() <= 1 {
+			t.Errorf("%s: got %+v, want compressed stats covering %d bytes", name, stats, sender.Manifest.TotalSize)
+		}
+	}
+
+	// A plain transfer has nothing to report
+	sender.Compress = false
+	delivery, sendErr, recvErr = splitSend(t, context.Background(), sender, t.TempDir(), nil)
+	if sendErr != nil || recvErr != nil {
+		t.Fatalf("Send error %v, receive error %v", sendErr, recvErr)
+	}
+	if delivery.Compression != (CompressionStats{}) {
+		t.Errorf("Got %+v after a plain transfer, want none", delivery.Compression)
+	}
+}
+
+// TestStreamOptionsCompress checks that one receiver can get a compressed
+// transfer from a Sender that does not compress for the others
+func TestStreamOptionsCompress(t *testing.T) {
+	srcDir := t.TempDir()
+	os.WriteFile(filepath.Join(srcDir, "large.txt"), compressibleData(2*compressBlockSize), 0644)
+	sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.Code = "123-456"
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	receiver := NewReceiver(t.TempDir())
+	receiver.Code = sender.Code
+	errChan := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			errChan <- err
+			return
+		}
+		defer conn.Close()
+		errChan <- receiver.Receive(context.Background(), conn)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	opts := StreamOptions{Compress: true}
+	if err := sender.HandshakeWith(conn, opts); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	compressed, err := NewCompressedStream(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sender.SendWith(context.Background(), compressed, opts); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	compressed.Close()
+	if err := <-errChan; err != nil {
+		t.Fatalf("Receive failed: %v", err)
+	}
+	if receiver.Compression.Wire == 0 {
+		t.Error("Receiver did not get a compressed transfer")
+	}
+	if sender.Compress {
+		t.Error("SendWith changed Sender.Compress")
+	}
+}
@@ -0,0 +1,123 @@
+package transfer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// DataTokenSize is the length of the random token a receiver starts its
+// data stream with, see Receiver.DataStream
+const DataTokenSize = 16
+
+// wrapDataStream prepares a separate data stream for file data, compressed
+// like the control stream
+func wrapDataStream(data io.ReadWriteCloser, compress bool, level int, timeout time.Duration) (io.ReadWriteCloser, error) {
+	if !compress {
+		return data, nil
+	}
+	SetStreamDeadline(data, timeout)
+	compressed, err := NewCompressedStreamLevel(data, level)
+	if err != nil {
+		data.Close()
+		return nil, fmt.Errorf("failed to initialize compression: %w", err)
+	}
+	return compressed, nil
+}
+
+type controlMsg struct {
+	msg *Message
+	err error
+}
+
+// controlReader reads the control stream while files are sent. A cancel from
+// the receiver aborts the transfer right away and progress acknowledgements
+// go to onAck, other messages are kept until the files are sent.
+type controlReader struct {
+	msgs    chan controlMsg
+	done    chan struct{}
+	mu      sync.Mutex
+	stopped bool
+	onAck   func(ProgressAckMsg)
+}
+
+func readControl(stream io.ReadWriter, abort func(error), onAck func(ProgressAckMsg)) *controlReader {
+	c := &controlReader{msgs: make(chan controlMsg, 4), done: make(chan struct{}), onAck: onAck}
+
+	// Reads only stop at the end of the transfer, which sets a deadline
+	if d, ok := stream.(interface{ SetReadDeadline(time.Time) error }); ok {
+		d.SetReadDeadline(time.Time{})
+	}
+	go func() {
+		for {
+			msg, err := ReadMessage(stream)
+			if err == nil && msg.Type == MsgError {
+				abort(rejectedError("", errors.New(string(msg.Payload))))
+			}
+			if err == nil && msg.Type == MsgProgressAck {
+				c.ack(msg.Payload)
+				continue
+			}
+			select {
+			case c.msgs <- controlMsg{msg, err}:
+			case <-c.done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return c
+}
+
+func (c *controlReader) next() (*Message, error) {
+	m := <-c.msgs
+	return m.msg, m.err
+}
+
+// ack passes a progress acknowledgement on, unless the transfer is over
+func (c *controlReader) ack(payload []byte) {
+	var ack ProgressAckMsg
+	if json.Unmarshal(payload, &ack) != nil || c.onAck == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.stopped {
+		c.onAck(ack)
+	}
+}
+
+// stop ends reading. No acknowledgements are passed on once it returns.
+func (c *controlReader) stop() {
+	c.mu.Lock()
+	c.stopped = true
+	c.mu.Unlock()
+	close(c.done)
+}
+
+// setControl makes notifyCancel write to control, or to nothing if nil
+func (r *Receiver) setControl(control io.Writer) {
+	r.controlMu.Lock()
+	defer r.controlMu.Unlock()
+	r.control = control
+}
+
+// notifyCancel tells the sender on the control stream that the transfer was
+// cancelled, instead of leaving it to notice the closed streams
+func (r *Receiver) notifyCancel() {
+	r.controlMu.Lock()
+	defer r.controlMu.Unlock()
+	if r.control == nil {
+		return
+	}
+	if d, ok := r.control.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		d.SetWriteDeadline(time.Now().Add(time.Second))
+	}
+	WriteMessage(r.control, &Message{Type: MsgError, Payload: []byte("Transfer cancelled by receiver")})
+	r.control = nil
+}
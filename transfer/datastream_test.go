@@ -0,0 +1,270 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// splitTransfer runs a transfer over a control connection and a data
+// connection, like two libp2p streams. configure can adjust the receiver.
+func splitTransfer(t *testing.T, ctx context.Context, sender *Sender, destDir string, configure func(r *Receiver)) (sendErr, recvErr error) {
+	t.Helper()
+	_, sendErr, recvErr = splitSend(t, ctx, sender, destDir, configure)
+	return sendErr, recvErr
+}
+
+// splitSend is splitTransfer that also returns the delivery of the send
+func splitSend(t *testing.T, ctx context.Context, sender *Sender, destDir string, configure func(r *Receiver)) (delivery *Delivery, sendErr, recvErr error) {
+	t.Helper()
+	controlLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer controlLn.Close()
+	dataLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dataLn.Close()
+
+	// The data connection starts with the token, like a data stream
+	sender.DataStream = func(ctx context.Context, token []byte) (io.ReadWriteCloser, error) {
+		conn, err := dataLn.Accept()
+		if err != nil {
+			return nil, err
+		}
+		got := make([]byte, len(token))
+		if _, err := io.ReadFull(conn, got); err != nil || !bytes.Equal(got, token) {
+			conn.Close()
+			return nil, fmt.Errorf("data connection started with %x, want %x", got, token)
+		}
+		return conn, nil
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		conn, err := net.Dial("tcp", controlLn.Addr().String())
+		if err != nil {
+			errChan <- err
+			return
+		}
+		defer conn.Close()
+		receiver := NewReceiver(destDir)
+		receiver.Code = sender.Code
+		receiver.DataStream = func(ctx context.Context, token []byte) (io.ReadWriteCloser, error) {
+			conn, err := net.Dial("tcp", dataLn.Addr().String())
+			if err != nil {
+				return nil, err
+			}
+			if _, err := conn.Write(token); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return conn, nil
+		}
+		if configure != nil {
+			configure(receiver)
+		}
+		errChan <- receiver.Receive(ctx, conn)
+	}()
+
+	conn, err := controlLn.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := sender.Handshake(conn); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	var stream io.ReadWriter = conn
+	if sender.Compress {
+		compressed, err := NewCompressedStream(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer compressed.Close()
+		stream = compressed
+	}
+	delivery, sendErr = sender.Send(context.Background(), stream)
+	return delivery, sendErr, <-errChan
+}
+
+func TestDataStreamTransfer(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		srcDir := t.TempDir()
+		data := compressibleData(3*CRCFrameSize + 5)
+		os.WriteFile(filepath.Join(srcDir, "a.bin"), data, 0644)
+		os.WriteFile(filepath.Join(srcDir, "b.txt"), []byte("small"), 0644)
+
+		sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sender.Code = "123-456"
+		sender.Compress = compress
+
+		destDir := t.TempDir()
+		delivery, sendErr, recvErr := splitSend(t, context.Background(), sender, destDir, nil)
+		if sendErr != nil || recvErr != nil {
+			t.Fatalf("Compress %v: send error %v, receive error %v", compress, sendErr, recvErr)
+		}
+		if !delivery.Confirmed {
+			t.Errorf("Compress %v: receiver did not acknowledge on the control stream", compress)
+		}
+		got, _ := os.ReadFile(filepath.Join(destDir, filepath.Base(srcDir), "a.bin"))
+		if !bytes.Equal(got, data) {
+			t.Errorf("Compress %v: received %d bytes, want %d identical bytes", compress, len(got), len(data))
+		}
+	}
+}
+
+func TestDataStreamReceiverCancel(t *testing.T) {
+	srcDir := t.TempDir()
+	os.WriteFile(filepath.Join(srcDir, "a.bin"), compressibleData(64<<20), 0644)
+	sender, err := NewSender(context.Background(), srcDir, false, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.Code = "123-456"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	start := time.Now()
+	sendErr, recvErr := splitTransfer(t, ctx, sender, t.TempDir(), func(r *Receiver) {
+		r.OnProgress = func(string, int64, int64) { cancel() }
+		// Slow reading keeps the sender busy writing when the cancel
+		// arrives on the control stream
+		open := r.DataStream
+		r.DataStream = func(ctx context.Context, token []byte) (io.ReadWriteCloser, error) {
+			s, err := open(ctx, token)
+			if err != nil {
+				return nil, err
+			}
+			return slowStream{s}, nil
+		}
+	})
+
+	if CategoryOf(recvErr) != CategoryCancelled {
+		t.Errorf("Receive error = %v, want cancelled", recvErr)
+	}
+	if CategoryOf(sendErr) != CategoryRejected {
+		t.Fatalf("Send error = %v, want the receiver's cancel", sendErr)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Sender took %s to notice the cancel", elapsed)
+	}
+}
+
+func TestDataStreamDrain(t *testing.T) {
+	srcDir := t.TempDir()
+	os.WriteFile(filepath.Join(srcDir, "a.bin"), compressibleData(1<<20), 0644)
+	os.WriteFile(filepath.Join(srcDir, "b.bin"), compressibleData(1<<20), 0644)
+	sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.Code = "123-456"
+
+	destDir := t.TempDir()
+	var first string
+	sendErr, recvErr := splitTransfer(t, context.Background(), sender, destDir, func(r *Receiver) {
+		draining := make(chan struct{})
+		r.Draining = draining
+		r.OnStartFile = func(filename string, _, _ int) {
+			if first == "" {
+				first = filename
+				close(draining)
+			}
+		}
+	})
+	if !errors.Is(recvErr, ErrDrained) || CategoryOf(recvErr) != CategoryCancelled {
+		t.Errorf("Receive error = %v, want drained", recvErr)
+	}
+	if sendErr == nil {
+		t.Error("Send succeeded, want the receiver's cancel")
+	}
+
+	folder := filepath.Join(destDir, filepath.Base(srcDir))
+	for _, name := range []string{"a.bin", "b.bin"} {
+		info, err := os.Stat(filepath.Join(folder, name))
+		switch {
+		case name == first && (err != nil || info.Size() != 1<<20):
+			t.Errorf("%s being received when draining was not completed: %v", name, err)
+		case name != first && err == nil:
+			t.Errorf("%s was received after draining", name)
+		}
+	}
+}
+
+type slowStream struct {
+	io.ReadWriteCloser
+}
+
+func (s slowStream) Read(p []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	return s.ReadWriteCloser.Read(p[:min(len(p), 4096)])
+}
+
+func TestProgressAck(t *testing.T) {
+	for _, split := range []bool{false, true} {
+		srcDir := t.TempDir()
+		os.WriteFile(filepath.Join(srcDir, "a.bin"), compressibleData(8<<20), 0644)
+		os.WriteFile(filepath.Join(srcDir, "b.txt"), []byte("small"), 0644)
+		sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sender.Code = "123-456"
+
+		var mu sync.Mutex
+		written := make(map[string]int64)
+		acked := make(map[string]int64)
+		sender.OnProgress = func(filename string, sent, total int64) {
+			mu.Lock()
+			defer mu.Unlock()
+			if sent > written[filename] {
+				t.Errorf("Split %v: %s acknowledged at %d before the receiver wrote it", split, filename, sent)
+			}
+			acked[filename] = sent
+		}
+
+		sendErr, recvErr := splitTransfer(t, context.Background(), sender, t.TempDir(), func(r *Receiver) {
+			if !split {
+				r.DataStream = nil
+			}
+			r.OnProgress = func(filename string, received, total int64) {
+				mu.Lock()
+				written[filename] = received
+				mu.Unlock()
+			}
+			// Slow reading spreads the transfer over several ack intervals
+			open := r.DataStream
+			if open != nil {
+				r.DataStream = func(ctx context.Context, token []byte) (io.ReadWriteCloser, error) {
+					s, err := open(ctx, token)
+					if err != nil {
+						return nil, err
+					}
+					return slowStream{s}, nil
+				}
+			}
+		})
+		if sendErr != nil || recvErr != nil {
+			t.Fatalf("Split %v: send error %v, receive error %v", split, sendErr, recvErr)
+		}
+		mu.Lock()
+		if acked["a.bin"] != 8<<20 || acked["b.txt"] != 5 {
+			t.Errorf("Split %v: acknowledged %v, want every file complete", split, acked)
+		}
+		mu.Unlock()
+	}
+}
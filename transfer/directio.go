@@ -0,0 +1,237 @@
+package transfer
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"unsafe"
+)
+
+// Direct I/O reads and writes file data without the page cache, which
+// limits transfers above a few GB/s between fast disks. It needs offsets,
+// lengths and buffers aligned to directAlign, which covers the logical
+// block size of current disks. Where the system or file system does not
+// support it, files are read and written as usual.
+const (
+	directAlign      = 4096
+	directBufferSize = 1 << 20
+)
+
+// errDirectUnsupported is returned by openDirect where there is no direct I/O
+var errDirectUnsupported = errors.New("direct I/O is not supported")
+
+var directPool = sync.Pool{New: func() interface{} { b := alignedBuffer(directBufferSize); return &b }}
+
+// alignedBuffer returns size bytes starting at a multiple of directAlign
+func alignedBuffer(size int) []byte {
+	buf := make([]byte, size+directAlign)
+	skip := 0
+	if rem := int(uintptr(unsafe.Pointer(&buf[0])) & (directAlign - 1)); rem != 0 {
+		skip = directAlign - rem
+	}
+	return buf[skip : skip+size : skip+size]
+}
+
+// directFile reads a file from aligned offsets into an aligned buffer, for
+// Sender.DirectIO. Reads fall back to the regular handle if direct I/O
+// fails.
+type directFile struct {
+	file   *os.File // Regular handle
+	direct *os.File // Handle opened for direct I/O, nil after a failure
+	buf    *[]byte
+	data   []byte // Read but not returned yet
+	pos    int64  // Offset of what Read returns next
+	size   int64
+}
+
+// newDirectFile opens file again for direct I/O
+func newDirectFile(file *os.File) (*directFile, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	direct, err := openDirect(file.Name(), false)
+	if err != nil {
+		return nil, err
+	}
+	return &directFile{file: file, direct: direct, buf: directPool.Get().(*[]byte), size: info.Size()}, nil
+}
+
+func (d *directFile) Read(p []byte) (int, error) {
+	if len(d.data) == 0 {
+		if d.direct == nil {
+			n, err := d.file.ReadAt(p, d.pos)
+			d.pos += int64(n)
+			if n > 0 && err == io.EOF {
+				err = nil
+			}
+			return n, err
+		}
+		start := d.pos &^ (directAlign - 1)
+		n, err := d.direct.ReadAt(*d.buf, start)
+		// Reading on from the unaligned end of the file fails
+		if err != nil && err != io.EOF && start+int64(n) < d.size {
+			d.direct.Close()
+			d.direct = nil
+			return d.Read(p)
+		}
+		if int64(n) <= d.pos-start {
+			return 0, io.EOF
+		}
+		d.data = (*d.buf)[d.pos-start : n]
+	}
+	n := copy(p, d.data)
+	d.data = d.data[n:]
+	d.pos += int64(n)
+	return n, nil
+}
+
+func (d *directFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += d.pos
+	default:
+		return d.pos, errors.New("directFile: unsupported whence")
+	}
+	if offset < 0 {
+		return d.pos, errors.New("directFile: negative position")
+	}
+	d.data = nil
+	d.pos = offset
+	return offset, nil
+}
+
+func (d *directFile) Stat() (fs.FileInfo, error) {
+	return d.file.Stat()
+}
+
+func (d *directFile) Close() error {
+	if d.direct != nil {
+		d.direct.Close()
+		d.direct = nil
+	}
+	if d.buf != nil {
+		directPool.Put(d.buf)
+		d.buf = nil
+	}
+	return d.file.Close()
+}
+
+// directWriter writes a file from offset on, the aligned part with direct
+// I/O and the rest, such as the end of the file, through the regular
+// handle, for Receiver.DirectIO. Everything goes through the regular
+// handle if direct I/O fails. Flush must be called once all is written.
+type directWriter struct {
+	file   *os.File // Regular handle, possibly opened for appending
+	direct *os.File // nil after a failure
+	buf    *[]byte
+	n      int   // Bytes in buf
+	pos    int64 // Offset of buf, everything before it is written
+}
+
+// newDirectWriter opens file again for direct I/O to write it from offset
+func newDirectWriter(file *os.File, offset int64) (*directWriter, error) {
+	direct, err := openDirect(file.Name(), true)
+	if err != nil {
+		return nil, err
+	}
+	return &directWriter{file: file, direct: direct, buf: directPool.Get().(*[]byte), pos: offset}, nil
+}
+
+func (d *directWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// Up to the first aligned offset and after a failure, data goes
+		// through the regular handle
+		if d.n == 0 && (d.direct == nil || d.pos%directAlign != 0) {
+			k := len(p)
+			if d.direct != nil {
+				k = min(k, int(directAlign-d.pos%directAlign))
+			}
+			if err := d.writeRegular(p[:k]); err != nil {
+				return written, err
+			}
+			written += k
+			p = p[k:]
+			continue
+		}
+		k := copy((*d.buf)[d.n:], p)
+		d.n += k
+		written += k
+		p = p[k:]
+		if d.n == len(*d.buf) {
+			if err := d.flushAligned(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// writeRegular writes b at pos through the regular handle
+func (d *directWriter) writeRegular(b []byte) error {
+	if _, err := d.file.Seek(d.pos, io.SeekStart); err != nil {
+		return err
+	}
+	n, err := d.file.Write(b)
+	d.pos += int64(n)
+	return err
+}
+
+// flushAligned writes the whole blocks of buf with direct I/O
+func (d *directWriter) flushAligned() error {
+	aligned := d.n &^ (directAlign - 1)
+	if aligned == 0 {
+		return nil
+	}
+	if d.direct != nil {
+		if _, err := d.direct.WriteAt((*d.buf)[:aligned], d.pos); err != nil {
+			d.direct.Close()
+			d.direct = nil
+		}
+	}
+	if d.direct == nil {
+		if err := d.writeRegular((*d.buf)[:aligned]); err != nil {
+			return err
+		}
+	} else {
+		d.pos += int64(aligned)
+	}
+	d.n = copy(*d.buf, (*d.buf)[aligned:d.n])
+	return nil
+}
+
+// Flush writes what is buffered
+func (d *directWriter) Flush() error {
+	if err := d.flushAligned(); err != nil {
+		return err
+	}
+	if d.n > 0 {
+		if err := d.writeRegular((*d.buf)[:d.n]); err != nil {
+			return err
+		}
+		d.n = 0
+	}
+	return nil
+}
+
+// Close flushes d and closes the direct I/O handle, the regular one is
+// left open
+func (d *directWriter) Close() error {
+	if d.buf == nil {
+		return nil
+	}
+	err := d.Flush()
+	if d.direct != nil {
+		d.direct.Close()
+		d.direct = nil
+	}
+	if d.buf != nil {
+		directPool.Put(d.buf)
+		d.buf = nil
+	}
+	return err
+}
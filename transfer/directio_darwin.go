@@ -0,0 +1,27 @@
+//go:build darwin
+
+package transfer
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// openDirect opens the existing file at path bypassing the cache with
+// F_NOCACHE, which macOS offers instead of O_DIRECT
+func openDirect(path string, write bool) (*os.File, error) {
+	flag := os.O_RDONLY
+	if write {
+		flag = os.O_WRONLY
+	}
+	file, err := os.OpenFile(path, flag, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := unix.FcntlInt(file.Fd(), unix.F_NOCACHE, 1); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
@@ -0,0 +1,18 @@
+//go:build linux
+
+package transfer
+
+import (
+	"os"
+	"syscall"
+)
+
+// openDirect opens the existing file at path for direct I/O with O_DIRECT,
+// which file systems such as tmpfs refuse
+func openDirect(path string, write bool) (*os.File, error) {
+	flag := os.O_RDONLY
+	if write {
+		flag = os.O_WRONLY
+	}
+	return os.OpenFile(path, flag|syscall.O_DIRECT, 0)
+}
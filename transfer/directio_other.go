@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !windows
+
+package transfer
+
+import "os"
+
+// openDirect fails, files are read and written as usual
+func openDirect(path string, write bool) (*os.File, error) {
+	return nil, errDirectUnsupported
+}
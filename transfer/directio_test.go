@@ -0,0 +1,109 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// directData returns n bytes that differ in every block
+func directData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i/directAlign)
+	}
+	return data
+}
+
+func TestDirectWriter(t *testing.T) {
+	data := directData(3*directBufferSize + 12345)
+	for _, fallback := range []bool{false, true} {
+		for _, offset := range []int64{0, directAlign, 1000} {
+			path := filepath.Join(t.TempDir(), "file.bin")
+			os.WriteFile(path, data[:offset], 0600)
+			flags := os.O_WRONLY | os.O_APPEND
+			if offset == 0 {
+				flags = os.O_WRONLY | os.O_TRUNC
+			}
+			file, err := os.OpenFile(path, flags, 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w, err := newDirectWriter(file, offset)
+			if err != nil {
+				file.Close()
+				t.Skipf("no direct I/O here: %v", err)
+			}
+			if fallback {
+				w.direct.Close()
+				w.direct = nil
+			}
+			// Uneven writes as they come from the network
+			for rest := data[offset:]; len(rest) > 0; {
+				n := min(len(rest), 50000)
+				if _, err := w.Write(rest[:n]); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+				rest = rest[n:]
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			file.Close()
+
+			got, err := os.ReadFile(path)
+			if err != nil || !bytes.Equal(got, data) {
+				t.Errorf("Fallback %v, offset %d: file of %d bytes differs from the data written, %v", fallback, offset, len(got), err)
+			}
+		}
+	}
+}
+
+func TestDirectFile(t *testing.T) {
+	data := directData(2*directBufferSize + 777)
+	path := filepath.Join(t.TempDir(), "file.bin")
+	os.WriteFile(path, data, 0600)
+
+	for _, offset := range []int64{0, 5000, int64(len(data))} {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := newDirectFile(file)
+		if err != nil {
+			file.Close()
+			t.Skipf("no direct I/O here: %v", err)
+		}
+		d.Seek(offset, io.SeekStart)
+		got, err := io.ReadAll(d)
+		if err != nil || !bytes.Equal(got, data[offset:]) {
+			t.Errorf("reading from %d: got %d bytes, want %d, %v", offset, len(got), len(data)-int(offset), err)
+		}
+		d.Close()
+	}
+}
+
+func TestTransferDirectIO(t *testing.T) {
+	srcDir := t.TempDir()
+	data := directData(3*directBufferSize + 100)
+	os.WriteFile(filepath.Join(srcDir, "big.bin"), data, 0644)
+	os.WriteFile(filepath.Join(srcDir, "small.txt"), []byte("small"), 0644)
+	sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.Code = "123-456"
+	sender.DirectIO = true
+
+	destDir := t.TempDir()
+	loopbackTransfer(t, sender, destDir, func(r *Receiver) { r.DirectIO = true })
+	for name, want := range map[string][]byte{"big.bin": data, "small.txt": []byte("small")} {
+		got, err := os.ReadFile(filepath.Join(destDir, filepath.Base(srcDir), name))
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("%s differs from the original, %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// Category classifies transfer errors for retry decisions and user reporting
+type Category int
+
+const (
+	CategoryUnknown Category = iota
+	CategoryNetwork
+	CategoryProtocol
+	CategoryValidation
+	CategoryRejected
+	CategoryCancelled
+)
+
+func (c Category) String() string {
+	switch c {
+	case CategoryNetwork:
+		return "network"
+	case CategoryProtocol:
+		return "protocol"
+	case CategoryValidation:
+		return "validation"
+	case CategoryRejected:
+		return "rejected"
+	case CategoryCancelled:
+		return "cancelled"
+	default:
+		return "unknown"
+	}
+}
+
+// Error is a transfer failure tagged with a category.
+// Callers may wrap it further with fmt.Errorf("...: %w", err); use errors.As or CategoryOf to inspect it.
+type Error struct {
+	Category Category
+	Op       string // What was being done when the error occurred, may be empty
+	Err      error
+}
+
+func (e *Error) Error() string {
+	if e.Op == "" {
+		return e.Err.Error()
+	}
+	return e.Op + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func newError(category Category, op string, err error) *Error {
+	return &Error{Category: category, Op: op, Err: err}
+}
+
+// networkError tags an I/O error on the stream, keeping cancellation distinct.
+// A clean io.EOF means the peer closed the stream between messages, which
+// retrying does not help, so only an unexpected EOF counts as a network error.
+func networkError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if isCancellation(err) {
+		return newError(CategoryCancelled, op, err)
+	}
+	if errors.Is(err, io.EOF) {
+		return newError(CategoryProtocol, op, err)
+	}
+	return newError(CategoryNetwork, op, err)
+}
+
+func cancelledError(err error) error {
+	return newError(CategoryCancelled, "transfer cancelled", err)
+}
+
+func protocolError(op string, err error) error {
+	return newError(CategoryProtocol, op, err)
+}
+
+func validationError(op string, err error) error {
+	return newError(CategoryValidation, op, err)
+}
+
+func rejectedError(op string, err error) error {
+	return newError(CategoryRejected, op, err)
+}
+
+// CategoryOf returns the category of err. Errors that did not originate in this
+// package are classified by inspecting well-known network error values.
+func CategoryOf(err error) Category {
+	if err == nil {
+		return CategoryUnknown
+	}
+	var te *Error
+	if errors.As(err, &te) {
+		return te.Category
+	}
+	if isCancellation(err) {
+		return CategoryCancelled
+	}
+	if isNetworkFailure(err) {
+		return CategoryNetwork
+	}
+	return CategoryUnknown
+}
+
+func isCancellation(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
+
+func isNetworkFailure(err error) bool {
+	switch {
+	case errors.Is(err, network.ErrReset),
+		errors.Is(err, net.ErrClosed),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, io.ErrClosedPipe),
+		errors.Is(err, os.ErrDeadlineExceeded),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNABORTED),
+		errors.Is(err, syscall.EPIPE),
+		errors.Is(err, syscall.EHOSTUNREACH),
+		errors.Is(err, syscall.ENETUNREACH):
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,92 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+func TestCategoryOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Category
+	}{
+		{"nil", nil, CategoryUnknown},
+		{"plain error", errors.New("something odd"), CategoryUnknown},
+		{"typed network", networkError("read", io.ErrUnexpectedEOF), CategoryNetwork},
+		{"closed by peer", networkError("read", io.EOF), CategoryProtocol},
+		{"foreign EOF", fmt.Errorf("read: %w", io.EOF), CategoryUnknown},
+		{"foreign unexpected EOF", fmt.Errorf("read: %w", io.ErrUnexpectedEOF), CategoryNetwork},
+		{"wrapped typed", fmt.Errorf("failed to send x: %w", validationError("", errors.New("bad"))), CategoryValidation},
+		{"double wrapped", fmt.Errorf("a: %w", fmt.Errorf("b: %w", rejectedError("", errors.New("no")))), CategoryRejected},
+		{"stream reset", fmt.Errorf("copy: %w", network.ErrReset), CategoryNetwork},
+		{"connection reset", fmt.Errorf("write: %w", syscall.ECONNRESET), CategoryNetwork},
+		{"context cancelled", networkError("read", context.Canceled), CategoryCancelled},
+		{"foreign cancelled", fmt.Errorf("dial: %w", context.Canceled), CategoryCancelled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CategoryOf(tt.err); got != tt.want {
+				t.Errorf("CategoryOf(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	if IsRetryableError(nil) {
+		t.Error("nil error should not be retryable")
+	}
+	if !IsRetryableError(fmt.Errorf("failed to read message: %w", networkError("", network.ErrReset))) {
+		t.Error("wrapped network error should be retryable")
+	}
+	if IsRetryableError(protocolError("", errors.New("stream reset"))) {
+		t.Error("protocol error should not be retryable even if its text looks like a network error")
+	}
+	if IsRetryableError(rejectedError("handshake rejected", errors.New("invalid connection code"))) {
+		t.Error("rejection should not be retryable")
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	err := rejectedError("handshake rejected", errors.New("invalid connection code"))
+	if got, want := err.Error(), "handshake rejected: invalid connection code"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+
+	var te *Error
+	if !errors.As(fmt.Errorf("outer: %w", err), &te) {
+		t.Fatal("errors.As failed to find *Error")
+	}
+	if te.Category != CategoryRejected {
+		t.Errorf("Category = %v, want %v", te.Category, CategoryRejected)
+	}
+}
+
+func TestReadMessageErrorCategories(t *testing.T) {
+	// Truncated stream is a network failure
+	_, err := ReadMessage(bytes.NewReader([]byte{0, 0}))
+	if CategoryOf(err) != CategoryNetwork {
+		t.Errorf("truncated length: category = %v, want network", CategoryOf(err))
+	}
+
+	// Oversized length prefix is a protocol violation
+	_, err = ReadMessage(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff}))
+	if CategoryOf(err) != CategoryProtocol {
+		t.Errorf("oversized message: category = %v, want protocol", CategoryOf(err))
+	}
+
+	// Garbage payload is a protocol violation
+	_, err = ReadMessage(bytes.NewReader([]byte{0, 0, 0, 3, 'x', 'y', 'z'}))
+	if CategoryOf(err) != CategoryProtocol {
+		t.Errorf("malformed payload: category = %v, want protocol", CategoryOf(err))
+	}
+}
@@ -0,0 +1,53 @@
+package transfer
+
+import "hash/crc32"
+
+// CRCFrameSize is the amount of file data covered by each CRC in FileEndMsg
+const CRCFrameSize = 1 << 20
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// frameCRC computes the CRC32C of each CRCFrameSize frame of the data
+// written to it
+type frameCRC struct {
+	sums []uint32
+	crc  uint32
+	n    int64 // Bytes in the current frame
+}
+
+func (f *frameCRC) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		n := min(int64(len(p)), CRCFrameSize-f.n)
+		f.crc = crc32.Update(f.crc, castagnoli, p[:n])
+		f.n += n
+		p = p[n:]
+		if f.n == CRCFrameSize {
+			f.sums = append(f.sums, f.crc)
+			f.crc, f.n = 0, 0
+		}
+	}
+	return written, nil
+}
+
+// Sums returns the checksums of all frames, the last one may be partial
+func (f *frameCRC) Sums() []uint32 {
+	if f.n > 0 {
+		return append(f.sums[:len(f.sums):len(f.sums)], f.crc)
+	}
+	return f.sums
+}
+
+// firstBadFrame returns the index of the first frame whose checksum does not
+// match, or -1 if all match
+func firstBadFrame(got, want []uint32) int {
+	for i := range min(len(got), len(want)) {
+		if got[i] != want[i] {
+			return i
+		}
+	}
+	if len(got) != len(want) {
+		return min(len(got), len(want))
+	}
+	return -1
+}
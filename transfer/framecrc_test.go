@@ -0,0 +1,122 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFrameCRC(t *testing.T) {
+	data := compressibleData(2*CRCFrameSize + 100)
+
+	var whole frameCRC
+	whole.Write(data)
+	sums := whole.Sums()
+	if len(sums) != 3 {
+		t.Fatalf("Got %d frames, want 3", len(sums))
+	}
+
+	// Frames do not depend on how the data is split into writes
+	var split frameCRC
+	for rest := data; len(rest) > 0; {
+		n := min(len(rest), 77777)
+		split.Write(rest[:n])
+		rest = rest[n:]
+	}
+	if firstBadFrame(split.Sums(), sums) != -1 {
+		t.Fatal("Split writes changed the frame checksums")
+	}
+
+	data[CRCFrameSize+5] ^= 1
+	var flipped frameCRC
+	flipped.Write(data)
+	if bad := firstBadFrame(flipped.Sums(), sums); bad != 1 {
+		t.Errorf("firstBadFrame = %d, want 1", bad)
+	}
+	if bad := firstBadFrame(sums[:2], sums); bad != 2 {
+		t.Errorf("firstBadFrame with a missing frame = %d, want 2", bad)
+	}
+}
+
+// corruptingConn flips one bit of the data written at the given position
+type corruptingConn struct {
+	net.Conn
+	at      int64
+	written int64
+}
+
+func (c *corruptingConn) Write(p []byte) (int, error) {
+	if i := c.at - c.written; i >= 0 && i < int64(len(p)) {
+		p = bytes.Clone(p)
+		p[i] ^= 1
+	}
+	c.written += int64(len(p))
+	return c.Conn.Write(p)
+}
+
+func TestSkipHashDetectsCorruption(t *testing.T) {
+	srcDir := t.TempDir()
+	data := compressibleData(3 * CRCFrameSize)
+	if err := os.WriteFile(filepath.Join(srcDir, "data.bin"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sender, err := NewSender(context.Background(), srcDir, false, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.Code = "123-456"
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	destDir := t.TempDir()
+	errChan := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			errChan <- err
+			return
+		}
+		defer conn.Close()
+		receiver := NewReceiver(destDir)
+		receiver.Code = sender.Code
+		errChan <- receiver.Receive(context.Background(), conn)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := sender.Handshake(conn); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+
+	// The messages before the data are far smaller than a frame, so this
+	// lands in the second frame of the file
+	stream := &corruptingConn{Conn: conn, at: CRCFrameSize + CRCFrameSize/2}
+	go func() {
+		sender.Send(context.Background(), stream)
+		conn.Close()
+	}()
+
+	err = <-errChan
+	if err == nil || !IsRetryableError(err) {
+		t.Fatalf("Receive error = %v, want a retryable corruption error", err)
+	}
+
+	// Only the intact first frame is kept for resuming
+	got, err := os.ReadFile(filepath.Join(destDir, filepath.Base(srcDir), "data.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != CRCFrameSize || !bytes.Equal(got, data[:CRCFrameSize]) {
+		t.Errorf("Kept %d bytes, want the first %d bytes", len(got), CRCFrameSize)
+	}
+}
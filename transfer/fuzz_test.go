@@ -0,0 +1,114 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func FuzzReadMessage(f *testing.F) {
+	var buf bytes.Buffer
+	WriteMessage(&buf, &Message{Type: MsgFileStart, Payload: []byte(`{"path":"a","size":1}`)})
+	f.Add(buf.Bytes())
+	f.Add([]byte{0, 0, 0, 2, '{', '}'})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, err := ReadMessage(bytes.NewReader(data))
+		if err != nil {
+			if CategoryOf(err) != CategoryNetwork && CategoryOf(err) != CategoryProtocol {
+				t.Fatalf("Unexpected error category for %v", err)
+			}
+			return
+		}
+
+		// Anything accepted must survive a round trip
+		var out bytes.Buffer
+		if err := WriteMessage(&out, msg); err != nil {
+			t.Fatalf("WriteMessage failed: %v", err)
+		}
+		again, err := ReadMessage(&out)
+		if err != nil {
+			t.Fatalf("ReadMessage of written message failed: %v", err)
+		}
+		if again.Type != msg.Type || !bytes.Equal(again.Payload, msg.Payload) {
+			t.Fatalf("Round trip changed the message: %+v != %+v", again, msg)
+		}
+	})
+}
+
+func FuzzParseManifest(f *testing.F) {
+	f.Add([]byte(`{"folder_name":"x","total_size":3,"files":[{"path":"a","size":3,"block_size":1,"block_hashes":["00"]}]}`))
+	f.Add([]byte(`{"files":[{"path":"../a","size":-1}]}`))
+	f.Add([]byte(`null`))
+
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		m, err := ParseManifest(&Message{Type: MsgManifest, Payload: payload})
+		if err != nil {
+			return
+		}
+		for _, file := range m.Files {
+			if file.Size < 0 || file.BlockSize < 0 || file.BlockSize > MaxBlockSize {
+				t.Fatalf("Accepted invalid file entry %+v", file)
+			}
+		}
+	})
+}
+
+// fuzzStream feeds scripted sender messages to a receiver and discards
+// everything the receiver writes
+type fuzzStream struct {
+	io.Reader
+}
+
+func (fuzzStream) Write(p []byte) (int, error) { return len(p), nil }
+func (fuzzStream) Close() error                { return nil }
+
+// FuzzReceiver runs the receiver against a hostile sender that answers the
+// handshake and then sends the given manifest, file start and file data
+func FuzzReceiver(f *testing.F) {
+	f.Add([]byte(`{"folder_name":"x","total_size":3,"files":[{"path":"a","size":3}]}`), []byte(`{"path":"a","size":3}`), []byte("abc"))
+	f.Add([]byte(`{"folder_name":"x","files":[{"path":"a","size":3,"block_size":-1,"block_hashes":["00"]}]}`), []byte(`{"path":"a","size":3,"offset":2}`), []byte("c"))
+	f.Add([]byte(`{"folder_name":"x","files":[{"path":"a","size":1}]}`), []byte(`{"path":"../../b","size":1}`), []byte("b"))
+	f.Add([]byte(`{"folder_name":"x","files":[{"path":"a","size":1}]}`), []byte(`{"path":"a","size":-5,"offset":-10}`), []byte(""))
+
+	f.Fuzz(func(t *testing.T, manifest, fileStart, data []byte) {
+		var in bytes.Buffer
+		ack, _ := json.Marshal(HandshakeAckMsg{})
+		WriteMessage(&in, &Message{Type: MsgHandshakeAck, Payload: ack})
+		WriteMessage(&in, &Message{Type: MsgManifest, Payload: manifest})
+		WriteMessage(&in, &Message{Type: MsgFileStart, Payload: fileStart})
+		in.Write(data)
+		WriteMessage(&in, &Message{Type: MsgFileEnd})
+		WriteMessage(&in, &Message{Type: MsgComplete})
+
+		// Existing data makes the receiver verify it for resuming
+		dest := t.TempDir()
+		os.MkdirAll(filepath.Join(dest, "x"), 0755)
+		os.WriteFile(filepath.Join(dest, "x", "a"), []byte("ab"), 0644)
+
+		// The sender proves the code before the script plays
+		client, server := net.Pipe()
+		defer server.Close()
+		go func() {
+			if _, err := readHandshake(server, 5*time.Second, &codeKeys{}, "123-456"); err != nil {
+				return
+			}
+			go io.Copy(io.Discard, server)
+			server.Write(in.Bytes())
+		}()
+
+		receiver := NewReceiver(dest)
+		receiver.Code = "123-456"
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		receiver.Receive(ctx, client)
+		client.Close()
+	})
+}
@@ -0,0 +1,121 @@
+package transfer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// JournalExt is appended to the name of a partial file for its progress
+// journal, which is removed once the file is complete
+const JournalExt = ".2c1f-progress"
+
+// DefaultJournalInterval is how much of a file is received between syncs
+// of the file and its progress journal
+const DefaultJournalInterval = 8 << 20
+
+// SyncPolicy is when a Receiver forces received data to disk. A file whose
+// checksum matched may still be lost in a power failure until it is synced.
+type SyncPolicy string
+
+// Policies of Receiver.Sync
+const (
+	SyncInterval SyncPolicy = ""      // Every JournalInterval bytes with the progress journal
+	SyncFile     SyncPolicy = "file"  // Like SyncInterval, and once a file is complete, before it is reported complete
+	SyncNever    SyncPolicy = "never" // Left to the system, no progress journal is kept
+)
+
+// ParseSyncPolicy parses a policy by name, "interval" for SyncInterval
+func ParseSyncPolicy(name string) (SyncPolicy, error) {
+	switch policy := SyncPolicy(name); policy {
+	case SyncFile, SyncNever, SyncInterval:
+		return policy, nil
+	case "interval":
+		return SyncInterval, nil
+	}
+	return "", fmt.Errorf("unknown sync policy %q, expected never, file or interval", name)
+}
+
+// progressJournal records how much of a partial file is safely on disk. The
+// data is synced before the journal is written, so after a crash the file
+// resumes from there rather than trusting what the crash left behind it.
+type progressJournal struct {
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum,omitempty"`
+	Offset   int64  `json:"offset"`
+}
+
+// readJournal returns the offset the journal of the partial file at path
+// records for entry, false if there is none or it is for another file
+func readJournal(path string, entry FileEntry) (int64, bool) {
+	data, err := os.ReadFile(path + JournalExt)
+	if err != nil {
+		return 0, false
+	}
+	var j progressJournal
+	if err := json.Unmarshal(data, &j); err != nil || j.Size != entry.Size || j.Checksum != entry.Checksum || j.Offset < 0 || j.Offset > j.Size {
+		return 0, false
+	}
+	return j.Offset, true
+}
+
+func removeJournal(path string) {
+	os.Remove(path + JournalExt)
+}
+
+// journal keeps the progress journal of a file being received
+type journal struct {
+	file     *os.File
+	entry    *FileEntry
+	interval int64
+	synced   int64 // Offset the journal records
+}
+
+func newJournal(file *os.File, entry *FileEntry, offset, interval int64) *journal {
+	return &journal{file: file, entry: entry, interval: interval, synced: offset}
+}
+
+// update records that the file is written up to offset, once it is
+// interval past the last record
+func (j *journal) update(offset int64) {
+	if j == nil || offset-j.synced < j.interval {
+		return
+	}
+	j.record(offset)
+}
+
+// flush records offset regardless of the interval, so an interrupted file
+// resumes from where it stopped
+func (j *journal) flush(offset int64) {
+	if j == nil || offset <= j.synced {
+		return
+	}
+	j.record(offset)
+}
+
+func (j *journal) record(offset int64) {
+	if err := j.file.Sync(); err != nil {
+		return
+	}
+	data, err := json.Marshal(progressJournal{Size: j.entry.Size, Checksum: j.entry.Checksum, Offset: offset})
+	if err != nil {
+		return
+	}
+	// Replaced in one step, so a crash leaves the old record or the new one
+	path := j.file.Name() + JournalExt
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		os.Remove(path + ".tmp")
+		return
+	}
+	j.synced = offset
+}
+
+// remove deletes the journal of a complete file
+func (j *journal) remove() {
+	if j != nil {
+		removeJournal(j.file.Name())
+	}
+}
@@ -0,0 +1,122 @@
+package transfer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"lukechampine.com/blake3"
+)
+
+func TestJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.bin")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	entry := &FileEntry{Path: "file.bin", Size: 100}
+
+	j := newJournal(file, entry, 0, 30)
+	file.Write(make([]byte, 20))
+	j.update(20)
+	if _, ok := readJournal(path, *entry); ok {
+		t.Error("journal written before the interval passed")
+	}
+	file.Write(make([]byte, 20))
+	j.update(40)
+	if offset, ok := readJournal(path, *entry); !ok || offset != 40 {
+		t.Errorf("readJournal = %d, %v, want 40", offset, ok)
+	}
+	if _, ok := readJournal(path, FileEntry{Size: 100, Checksum: "other"}); ok {
+		t.Error("journal accepted for a different file")
+	}
+
+	// An interrupted file records where it stopped
+	file.Write(make([]byte, 10))
+	j.flush(50)
+	if offset, ok := readJournal(path, *entry); !ok || offset != 50 {
+		t.Errorf("readJournal after flush = %d, %v, want 50", offset, ok)
+	}
+
+	j.remove()
+	if _, err := os.Stat(path + JournalExt); !os.IsNotExist(err) {
+		t.Errorf("journal left after remove: %v", err)
+	}
+}
+
+// TestResumeFromJournal checks that a partial file resumes from where its
+// journal says it was synced, not from what is on disk
+func TestResumeFromJournal(t *testing.T) {
+	const blockSize = 1000
+	data := bytes.Repeat([]byte("0123456789"), 350)
+	entry := FileEntry{Path: "file.bin", Size: int64(len(data)), BlockSize: blockSize}
+	for i := 0; i < len(data); i += blockSize {
+		sum := blake3.Sum256(data[i:min(i+blockSize, len(data))])
+		entry.BlockHashes = append(entry.BlockHashes, hex.EncodeToString(sum[:]))
+	}
+
+	path := filepath.Join(t.TempDir(), "file.bin")
+	// A crash left garbage after the synced data
+	partial := append(append([]byte(nil), data[:2500]...), make([]byte, 500)...)
+	os.WriteFile(path, partial, 0600)
+	r := NewReceiver(t.TempDir())
+
+	if offset, _ := r.verifyLocalFile(path, entry); offset != 2000 {
+		t.Errorf("without a journal resumed at %d, want the last whole block 2000", offset)
+	}
+	writeJournal := func(offset int64, entry FileEntry) {
+		data, _ := json.Marshal(progressJournal{Size: entry.Size, Checksum: entry.Checksum, Offset: offset})
+		os.WriteFile(path+JournalExt, data, 0600)
+	}
+	writeJournal(2500, entry)
+	if offset, _ := r.verifyLocalFile(path, entry); offset != 2500 {
+		t.Errorf("with a journal resumed at %d, want 2500", offset)
+	}
+
+	// Without block hashes the journal is all there is to go by
+	noHashes := FileEntry{Path: "file.bin", Size: entry.Size}
+	if offset, _ := r.verifyLocalFile(path, noHashes); offset != 2500 {
+		t.Errorf("without block hashes resumed at %d, want 2500", offset)
+	}
+	os.Remove(path + JournalExt)
+	if offset, _ := r.verifyLocalFile(path, noHashes); offset != 3000 {
+		t.Errorf("without block hashes or journal resumed at %d, want the file size 3000", offset)
+	}
+
+	// Corrupt data before the journal's offset is still caught
+	partial[100] ^= 0xff
+	os.WriteFile(path, partial, 0600)
+	writeJournal(2500, entry)
+	if offset, _ := r.verifyLocalFile(path, entry); offset != 0 {
+		t.Errorf("corrupt file resumed at %d, want 0", offset)
+	}
+}
+
+func TestSyncPolicy(t *testing.T) {
+	for name, want := range map[string]SyncPolicy{"": SyncInterval, "interval": SyncInterval, "file": SyncFile, "never": SyncNever} {
+		if policy, err := ParseSyncPolicy(name); err != nil || policy != want {
+			t.Errorf("ParseSyncPolicy(%q) = %q, %v, want %q", name, policy, err, want)
+		}
+	}
+	if _, err := ParseSyncPolicy("always"); err == nil {
+		t.Error("ParseSyncPolicy() of an unknown policy should fail")
+	}
+
+	r := NewReceiver(t.TempDir())
+	if r.journalInterval() != DefaultJournalInterval {
+		t.Errorf("journalInterval() = %d, want the default", r.journalInterval())
+	}
+	// Syncing each file keeps the journal for crashes in the middle of one
+	r.Sync = SyncFile
+	if r.journalInterval() != DefaultJournalInterval {
+		t.Errorf("journalInterval() with %q = %d, want the default", SyncFile, r.journalInterval())
+	}
+	r.Sync = SyncNever
+	if r.journalInterval() > 0 {
+		t.Errorf("journalInterval() with %q = %d, want no journal", SyncNever, r.journalInterval())
+	}
+}
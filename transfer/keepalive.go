@@ -0,0 +1,56 @@
+package transfer
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// pingTimeout returns the timeout keepalive pings have to beat: the shorter
+// of the local timeout and the one the sender announced in its
+// HandshakeAckMsg, as older senders do not announce theirs
+func pingTimeout(local time.Duration, senderMs int64) time.Duration {
+	if sender := time.Duration(senderMs) * time.Millisecond; sender > 0 && sender < local {
+		return sender
+	}
+	return local
+}
+
+// keepalive writes MsgPing to stream a few times per timeout until the
+// returned stop function is called, so the other side does not give up while
+// this side is busy. Nothing else may write to stream until then. stop can
+// be called more than once and returns once no ping is being written.
+func keepalive(stream io.Writer, timeout time.Duration) (stop func()) {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	deadline, _ := stream.(interface{ SetWriteDeadline(time.Time) error })
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(timeout / 3)
+		defer ticker.Stop()
+		if deadline != nil {
+			defer deadline.SetWriteDeadline(time.Time{})
+		}
+		for {
+			select {
+			case <-ticker.C:
+				if deadline != nil {
+					deadline.SetWriteDeadline(time.Now().Add(timeout))
+				}
+				if err := WriteMessage(stream, &Message{Type: MsgPing}); err != nil {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-exited
+		})
+	}
+}
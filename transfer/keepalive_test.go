@@ -0,0 +1,77 @@
+package transfer
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKeepaliveDuringConfirmation(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.Code = "123-456"
+	sender.Compress = true
+	sender.Timeout = 300 * time.Millisecond
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	destDir := t.TempDir()
+	recvErr := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			recvErr <- err
+			return
+		}
+		defer conn.Close()
+		receiver := NewReceiver(destDir)
+		receiver.Code = sender.Code
+		// Pings at a third of its own timeout would be too late for the
+		// sender
+		receiver.Timeout = 10 * sender.Timeout
+		// The user takes several sender timeouts to accept
+		receiver.OnConfirmation = func(*Manifest) bool {
+			time.Sleep(4 * sender.Timeout)
+			return true
+		}
+		recvErr <- receiver.Receive(context.Background(), conn)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := sender.Handshake(conn); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	compressed, err := NewCompressedStream(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer compressed.Close()
+
+	delivery, err := sender.Send(context.Background(), compressed)
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if err := <-recvErr; err != nil {
+		t.Fatalf("Receive failed: %v", err)
+	}
+	if !delivery.Confirmed {
+		t.Error("Receiver did not acknowledge the transfer")
+	}
+}
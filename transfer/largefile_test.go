@@ -0,0 +1,87 @@
+//go:build largefile
+
+package transfer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// largeFileSize returns TWOC1F_LARGE_SIZE in bytes, or def if it is not set
+func largeFileSize(tb testing.TB, def int64) int64 {
+	if s := os.Getenv("TWOC1F_LARGE_SIZE"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			tb.Fatalf("Invalid TWOC1F_LARGE_SIZE: %v", err)
+		}
+		return n
+	}
+	return def
+}
+
+// sparseFile creates a file of size bytes that only has data at both ends,
+// which catches offsets that wrap at 4 GB
+func sparseFile(tb testing.TB, size int64) string {
+	tb.Helper()
+	dir := tb.TempDir()
+	f, err := os.Create(filepath.Join(dir, "sparse.bin"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteAt([]byte("start"), 0); err != nil {
+		tb.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("end"), size-3); err != nil {
+		tb.Fatal(err)
+	}
+	return dir
+}
+
+// TestLargeSparseFile needs several GB of free disk space and takes minutes,
+// run it with: go test -tags largefile -run Large -timeout 30m ./transfer
+func TestLargeSparseFile(t *testing.T) {
+	size := largeFileSize(t, 5<<30)
+	srcDir := sparseFile(t, size)
+	destDir := t.TempDir()
+
+	sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+	if err != nil {
+		t.Fatalf("Failed to create sender: %v", err)
+	}
+	sender.Code = "123-456"
+	// The receiver verifies the checksum of the whole file
+	loopbackTransfer(t, sender, destDir, nil)
+
+	info, err := os.Stat(filepath.Join(destDir, filepath.Base(srcDir), "sparse.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != size {
+		t.Errorf("Received %d bytes, want %d", info.Size(), size)
+	}
+}
+
+// BenchmarkTransferLargeFile sends a single 50 GB file unless
+// TWOC1F_LARGE_SIZE is set, hashing is skipped to measure the copy path
+func BenchmarkTransferLargeFile(b *testing.B) {
+	srcDir := sparseFile(b, largeFileSize(b, 50<<30))
+	sender, err := NewSender(context.Background(), srcDir, false, true, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	sender.Code = "123-456"
+
+	b.SetBytes(sender.Manifest.TotalSize)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		dest := b.TempDir()
+		b.StartTimer()
+		loopbackTransfer(b, sender, dest, nil)
+	}
+}
@@ -0,0 +1,61 @@
+package transfer
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Defaults of Limits, high enough for any real folder
+const (
+	DefaultMaxFiles = 1_000_000
+	DefaultMaxDepth = 128
+)
+
+// Limits bounds what a manifest may ask the receiver to create, so a hostile
+// sender cannot exhaust its memory, inodes or disk. Manifests over a limit
+// are refused before anything is written.
+type Limits struct {
+	MaxFiles     int   // DefaultMaxFiles if zero, unlimited if negative
+	MaxDepth     int   // Folders a path may be nested in, DefaultMaxDepth if zero, unlimited if negative
+	MaxFileSize  int64 // Bytes, unlimited if zero
+	MaxTotalSize int64 // Bytes, unlimited if zero
+}
+
+// Check returns an error describing the first limit m exceeds
+func (l Limits) Check(m *Manifest) error {
+	maxFiles := l.MaxFiles
+	if maxFiles == 0 {
+		maxFiles = DefaultMaxFiles
+	}
+	maxDepth := l.MaxDepth
+	if maxDepth == 0 {
+		maxDepth = DefaultMaxDepth
+	}
+
+	if maxFiles > 0 && len(m.Files) > maxFiles {
+		return fmt.Errorf("%d files exceed the limit of %d", len(m.Files), maxFiles)
+	}
+	if l.MaxTotalSize > 0 && m.TotalSize > l.MaxTotalSize {
+		return fmt.Errorf("total size %d exceeds the limit of %d bytes", m.TotalSize, l.MaxTotalSize)
+	}
+	var total int64
+	for _, f := range m.Files {
+		if depth := strings.Count(f.Path, "/"); maxDepth > 0 && depth > maxDepth {
+			return fmt.Errorf("%s is nested %d folders deep, the limit is %d", f.Path, depth, maxDepth)
+		}
+		if l.MaxFileSize > 0 && f.Size > l.MaxFileSize {
+			return fmt.Errorf("%s has %d bytes, the limit is %d", f.Path, f.Size, l.MaxFileSize)
+		}
+		// The total the manifest states may be a lie, and sizes chosen to
+		// wrap around would make it look small
+		if f.Size < 0 || total > math.MaxInt64-f.Size {
+			return fmt.Errorf("%s has an invalid size of %d bytes", f.Path, f.Size)
+		}
+		total += f.Size
+		if l.MaxTotalSize > 0 && total > l.MaxTotalSize {
+			return fmt.Errorf("total size exceeds the limit of %d bytes", l.MaxTotalSize)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package transfer
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	deep := strings.Repeat("a/", DefaultMaxDepth+1) + "file"
+	manyFiles := &Manifest{Files: make([]FileEntry, 10)}
+	for i := range manyFiles.Files {
+		manyFiles.Files[i] = FileEntry{Path: "f", Size: 10}
+	}
+
+	cases := []struct {
+		name     string
+		limits   Limits
+		manifest *Manifest
+		ok       bool
+	}{
+		{"Defaults", Limits{}, manyFiles, true},
+		{"TooManyFiles", Limits{MaxFiles: 9}, manyFiles, false},
+		{"TooDeep", Limits{}, &Manifest{Files: []FileEntry{{Path: deep}}}, false},
+		{"DepthUnlimited", Limits{MaxDepth: -1}, &Manifest{Files: []FileEntry{{Path: deep}}}, true},
+		{"FileTooLarge", Limits{MaxFileSize: 9}, manyFiles, false},
+		{"TotalTooLarge", Limits{MaxTotalSize: 99}, manyFiles, false},
+		{"TotalFits", Limits{MaxTotalSize: 100}, manyFiles, true},
+		// The sizes matter, not the total the manifest claims
+		{"TotalUnderstated", Limits{MaxTotalSize: 99}, &Manifest{TotalSize: 1, Files: manyFiles.Files}, false},
+		{"TotalOverflows", Limits{MaxTotalSize: 99}, &Manifest{Files: []FileEntry{{Path: "a", Size: math.MaxInt64}, {Path: "b", Size: math.MaxInt64}}}, false},
+		{"TotalOverflowsUnlimited", Limits{}, &Manifest{Files: []FileEntry{{Path: "a", Size: math.MaxInt64}, {Path: "b", Size: 2}}}, false},
+		{"NegativeSize", Limits{}, &Manifest{Files: []FileEntry{{Path: "a", Size: 10}, {Path: "b", Size: -5}}}, false},
+	}
+	for _, c := range cases {
+		if err := c.limits.Check(c.manifest); (err == nil) != c.ok {
+			t.Errorf("%s: Check = %v, want ok %v", c.name, err, c.ok)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package transfer
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// localFS returns the files to send from path, a folder or a single file.
+// A single file is the only file in the root of the returned FS, so both
+// are sent alike.
+func localFS(path string, info fs.FileInfo) fs.FS {
+	if info.IsDir() {
+		return dirFS{dir: path, names: new(nameResolver)}
+	}
+	return fileFS{path: path, info: info}
+}
+
+// dirFS is like os.DirFS, but also finds files whose name on disk only
+// differs in Unicode normalization, such as those of a resumed session
+type dirFS struct {
+	dir   string
+	names *nameResolver
+}
+
+func (d dirFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	f, err := os.Open(d.names.resolve(filepath.Join(d.dir, filepath.FromSlash(name))))
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// fileFS holds a single file
+type fileFS struct {
+	path string
+	info fs.FileInfo
+}
+
+func (f fileFS) Open(name string) (fs.File, error) {
+	switch name {
+	case ".":
+		dir, err := os.Open(filepath.Dir(f.path))
+		if err != nil {
+			return nil, err
+		}
+		return &fileDir{File: dir, entry: fs.FileInfoToDirEntry(f.info)}, nil
+	case f.info.Name():
+		file, err := os.Open(f.path)
+		if err != nil {
+			return nil, err
+		}
+		return file, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// fileDir is the folder of a fileFS, which lists nothing but the file
+type fileDir struct {
+	*os.File
+	entry fs.DirEntry
+	read  bool
+}
+
+func (d *fileDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.read {
+		if n > 0 {
+			return nil, io.EOF
+		}
+		return nil, nil
+	}
+	d.read = true
+	return []fs.DirEntry{d.entry}, nil
+}
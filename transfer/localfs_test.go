@@ -0,0 +1,60 @@
+package transfer
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLocalFS(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("alpha"), 0644)
+	os.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte("beta"), 0644)
+
+	info, _ := os.Stat(dir)
+	if err := fstest.TestFS(localFS(dir, info), "a.txt", "sub/b.txt"); err != nil {
+		t.Error(err)
+	}
+
+	// A single file is alone in its folder, without the files next to it
+	file := filepath.Join(dir, "a.txt")
+	info, _ = os.Stat(file)
+	fsys := localFS(file, info)
+	if err := fstest.TestFS(fsys, "a.txt"); err != nil {
+		t.Error(err)
+	}
+	if _, err := fsys.Open("sub/b.txt"); err == nil {
+		t.Error("single file FS opened a file next to it")
+	}
+}
+
+// TestOpenFileWithoutSource covers senders made without NewSender, which
+// open FolderPath once to find out whether it is a folder or the file
+func TestOpenFileWithoutSource(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("alpha"), 0644)
+
+	for _, tc := range []struct{ folder, path string }{
+		{dir, "a.txt"},
+		{filepath.Join(dir, "a.txt"), "a.txt"},
+	} {
+		s := &Sender{FolderPath: tc.folder}
+		for i := 0; i < 2; i++ {
+			file, err := s.openFile(tc.path)
+			if err != nil {
+				t.Fatalf("openFile(%s) in %s: %v", tc.path, tc.folder, err)
+			}
+			data, _ := io.ReadAll(file)
+			file.Close()
+			if string(data) != "alpha" {
+				t.Errorf("openFile(%s) in %s read %q", tc.path, tc.folder, data)
+			}
+		}
+		if _, err := s.openFile("b.txt"); err == nil {
+			t.Errorf("openFile(b.txt) in %s opened a missing file", tc.folder)
+		}
+	}
+}
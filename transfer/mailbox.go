@@ -0,0 +1,190 @@
+package transfer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ebob10000/2c1f/words"
+)
+
+// Operations of a MailboxRequest
+const (
+	MailboxDeposit = "deposit" // Sender stores a transfer, then pushes it
+	MailboxClaim   = "claim"   // Receiver collects a transfer, then receives it
+)
+
+// DefaultMailboxTTL is how long a mailbox keeps a deposit nobody claimed
+const DefaultMailboxTTL = 7 * 24 * time.Hour
+
+// MailboxRequest opens a stream to a mailbox server. After a successful
+// MailboxReply the stream carries a normal transfer: for a deposit the
+// mailbox receives it, for a claim it sends the deposit.
+type MailboxRequest struct {
+	Op    string        `json:"op"`
+	Claim string        `json:"claim"`         // ID part of the claim code, see SplitClaimCode
+	TTL   time.Duration `json:"ttl,omitempty"` // Requested lifetime of a deposit, the mailbox's default if zero
+}
+
+// MailboxReply accepts or refuses a MailboxRequest
+type MailboxReply struct {
+	ExpiresAt time.Time `json:"expires_at,omitempty"` // When the deposit is deleted unless claimed
+	Error     string    `json:"error,omitempty"`
+}
+
+// WriteMailboxRequest sends req on a new mailbox stream and waits for the
+// reply, failing if the mailbox refused it
+func WriteMailboxRequest(stream io.ReadWriter, req MailboxRequest) (*MailboxReply, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, protocolError("failed to marshal mailbox request", err)
+	}
+	if err := WriteMessage(stream, &Message{Type: MsgMailbox, Payload: data}); err != nil {
+		return nil, fmt.Errorf("failed to send mailbox request: %w", err)
+	}
+
+	msg, err := ReadMessage(stream)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mailbox reply: %w", err)
+	}
+	if msg.Type != MsgMailboxReply {
+		return nil, protocolError("", fmt.Errorf("expected mailbox reply, got %d", msg.Type))
+	}
+	var reply MailboxReply
+	if err := json.Unmarshal(msg.Payload, &reply); err != nil {
+		return nil, protocolError("invalid mailbox reply", err)
+	}
+	if reply.Error != "" {
+		return nil, rejectedError("mailbox refused", errors.New(reply.Error))
+	}
+	return &reply, nil
+}
+
+// ReadMailboxRequest reads the request a client opened a mailbox stream with
+func ReadMailboxRequest(stream io.Reader) (*MailboxRequest, error) {
+	msg, err := ReadMessage(stream)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mailbox request: %w", err)
+	}
+	if msg.Type != MsgMailbox {
+		return nil, protocolError("", fmt.Errorf("expected mailbox request, got %d", msg.Type))
+	}
+	var req MailboxRequest
+	if err := json.Unmarshal(msg.Payload, &req); err != nil {
+		return nil, protocolError("invalid mailbox request", err)
+	}
+	return &req, nil
+}
+
+// WriteMailboxReply answers a MailboxRequest
+func WriteMailboxReply(stream io.Writer, reply MailboxReply) error {
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return protocolError("failed to marshal mailbox reply", err)
+	}
+	return WriteMessage(stream, &Message{Type: MsgMailboxReply, Payload: data})
+}
+
+// NewClaimCode returns a code such as 123-456-789-012-345-678 for a deposit.
+// The first half identifies it to the mailbox, the second half encrypts it
+// and is never sent.
+func NewClaimCode() (string, error) {
+	id, err := words.Generate()
+	if err != nil {
+		return "", err
+	}
+	secret, err := words.Generate()
+	if err != nil {
+		return "", err
+	}
+	return id + "-" + secret, nil
+}
+
+// SplitClaimCode returns the ID and the secret of a claim code
+func SplitClaimCode(code string) (id, secret string, err error) {
+	code = strings.TrimSpace(code)
+	if len(code) != 23 || code[11] != '-' || !words.Validate(code[:11]) || !words.Validate(code[12:]) {
+		return "", "", validationError("", fmt.Errorf("invalid claim code %q, expected ###-###-###-###-###-###", code))
+	}
+	return code[:11], code[12:], nil
+}
+
+// EncryptFolder writes an encrypted copy of the file or folder at src into
+// dir, with EncryptedExt appended to every file name, and returns the path
+// of the copy. A file is copied into a folder of its name, where receivers
+// save single files anyway. The mailbox only ever sees the copy.
+func EncryptFolder(src, dir string, key *EncryptionKey) (string, error) {
+	dst := filepath.Join(dir, filepath.Base(src))
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." && !d.IsDir() {
+			rel = d.Name()
+		}
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(dst, rel), 0700)
+		}
+		if !d.Type().IsRegular() || d.Name() == ".2c1f_manifest.json" {
+			return nil
+		}
+		target := filepath.Join(dst, rel) + EncryptedExt
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return err
+		}
+		return encryptFile(p, target, key)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt %s: %w", src, err)
+	}
+	return dst, nil
+}
+
+func encryptFile(src, dst string, key *EncryptionKey) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w, err := key.NewWriter(out)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, in); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// DecryptFolder decrypts every file with EncryptedExt in the folder at path
+// with passphrase and removes the encrypted files
+func DecryptFolder(path, passphrase string) error {
+	d := NewDecryptor(passphrase)
+	return filepath.WalkDir(path, func(p string, e fs.DirEntry, err error) error {
+		if err != nil || e.IsDir() || !strings.HasSuffix(p, EncryptedExt) {
+			return err
+		}
+		if err := d.DecryptFile(p, strings.TrimSuffix(p, EncryptedExt)); err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		return os.Remove(p)
+	})
+}
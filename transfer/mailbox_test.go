@@ -0,0 +1,143 @@
+package transfer
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestClaimCode(t *testing.T) {
+	code, err := NewClaimCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, secret, err := SplitClaimCode(" " + code + "\n")
+	if err != nil {
+		t.Fatalf("SplitClaimCode(%q) error = %v", code, err)
+	}
+	if id+"-"+secret != code || id == secret {
+		t.Errorf("SplitClaimCode(%q) = %q, %q", code, id, secret)
+	}
+
+	for _, bad := range []string{"", "123-456-789", "123-456-789_012-345-678", "123-456-789-012-345-67x", "../../../etc/passwd-12345"} {
+		if _, _, err := SplitClaimCode(bad); CategoryOf(err) != CategoryValidation {
+			t.Errorf("SplitClaimCode(%q) error = %v, want a validation error", bad, err)
+		}
+	}
+}
+
+func TestMailboxRequest(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	go func() {
+		req, err := ReadMailboxRequest(server)
+		if err != nil || req.Op != MailboxDeposit || req.Claim != "123-456-789" || req.TTL != time.Hour {
+			WriteMailboxReply(server, MailboxReply{Error: "unexpected request"})
+			return
+		}
+		WriteMailboxReply(server, MailboxReply{ExpiresAt: expires})
+
+		req, err = ReadMailboxRequest(server)
+		if err == nil {
+			WriteMailboxReply(server, MailboxReply{Error: "no such deposit " + req.Claim})
+		}
+	}()
+
+	reply, err := WriteMailboxRequest(client, MailboxRequest{Op: MailboxDeposit, Claim: "123-456-789", TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("deposit error = %v", err)
+	}
+	if !reply.ExpiresAt.Equal(expires) {
+		t.Errorf("ExpiresAt = %v, want %v", reply.ExpiresAt, expires)
+	}
+
+	_, err = WriteMailboxRequest(client, MailboxRequest{Op: MailboxClaim, Claim: "987-654-321"})
+	if CategoryOf(err) != CategoryRejected {
+		t.Errorf("refused claim error = %v, want a rejection", err)
+	}
+}
+
+func TestEncryptFolder(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "photos")
+	files := map[string]string{
+		"a.txt":     "first",
+		"sub/b.txt": "second",
+	}
+	for name, content := range files {
+		p := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	key, err := NewEncryptionKey("123-456-789")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := EncryptFolder(src, t.TempDir(), key)
+	if err != nil {
+		t.Fatalf("EncryptFolder() error = %v", err)
+	}
+	if filepath.Base(sealed) != "photos" {
+		t.Errorf("EncryptFolder() = %s, want a folder called photos", sealed)
+	}
+	for name, content := range files {
+		data, err := os.ReadFile(filepath.Join(sealed, name+EncryptedExt))
+		if err != nil {
+			t.Fatalf("%s not encrypted: %v", name, err)
+		}
+		if string(data) == content {
+			t.Errorf("%s stored in plaintext", name)
+		}
+	}
+
+	if err := DecryptFolder(sealed, "987-654-321"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("DecryptFolder() with the wrong secret error = %v", err)
+	}
+	if err := DecryptFolder(sealed, "123-456-789"); err != nil {
+		t.Fatalf("DecryptFolder() error = %v", err)
+	}
+	for name, content := range files {
+		data, err := os.ReadFile(filepath.Join(sealed, name))
+		if err != nil || string(data) != content {
+			t.Errorf("%s = %q, %v, want %q", name, data, err, content)
+		}
+		if _, err := os.Stat(filepath.Join(sealed, name+EncryptedExt)); !os.IsNotExist(err) {
+			t.Errorf("%s still encrypted next to the plaintext", name)
+		}
+	}
+}
+
+func TestEncryptFile(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(src, []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewEncryptionKey("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := EncryptFolder(src, t.TempDir(), key)
+	if err != nil {
+		t.Fatalf("EncryptFolder() error = %v", err)
+	}
+	// Receivers save single files in a folder of their name
+	if _, err := os.Stat(filepath.Join(sealed, "notes.txt"+EncryptedExt)); err != nil || filepath.Base(sealed) != "notes.txt" {
+		t.Fatalf("EncryptFolder() = %s, %v", sealed, err)
+	}
+	if err := DecryptFolder(sealed, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(sealed, "notes.txt")); err != nil || string(data) != "notes" {
+		t.Errorf("decrypted file = %q, %v", data, err)
+	}
+}
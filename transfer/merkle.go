@@ -0,0 +1,91 @@
+package transfer
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"lukechampine.com/blake3"
+)
+
+// MerkleRoot returns the root of a Merkle tree over the manifest's files,
+// sorted by path. Each leaf covers a file's path, size and checksum, so the
+// root identifies exactly which data was transferred, independent of the
+// folder name. It is empty if a file has no checksum, as with -skip-hash.
+func (m *Manifest) MerkleRoot() string {
+	files := make([]FileEntry, len(m.Files))
+	copy(files, m.Files)
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	level := make([][]byte, 0, len(files))
+	for _, f := range files {
+		if f.Checksum == "" {
+			return ""
+		}
+		level = append(level, merkleLeaf(f))
+	}
+	if len(level) == 0 {
+		sum := blake3.Sum256(nil)
+		return hex.EncodeToString(sum[:])
+	}
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				// An odd node moves up unchanged
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, merkleNode(level[i], level[i+1]))
+		}
+		level = next
+	}
+	return hex.EncodeToString(level[0])
+}
+
+// Leaves and nodes get a different first byte, so a node cannot pass for a
+// file
+func merkleLeaf(f FileEntry) []byte {
+	h := blake3.New(32, nil)
+	h.Write([]byte{0})
+	binary.Write(h, binary.BigEndian, uint32(len(f.Path)))
+	h.Write([]byte(f.Path))
+	binary.Write(h, binary.BigEndian, f.Size)
+	h.Write([]byte(f.Checksum))
+	return h.Sum(nil)
+}
+
+func merkleNode(left, right []byte) []byte {
+	h := blake3.New(32, nil)
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// VerifyRoot checks that the manifest's Merkle root matches its files. A
+// manifest without a root passes.
+func (m *Manifest) VerifyRoot() error {
+	if m.Root == "" {
+		return nil
+	}
+	if root := m.MerkleRoot(); root != m.Root {
+		return validationError("", fmt.Errorf("fingerprint mismatch: expected %s, got %s", Fingerprint(m.Root), Fingerprint(root)))
+	}
+	return nil
+}
+
+// Fingerprint shortens a Merkle root to a code people can compare, such as
+// 3f2a-91c0-7d4e-b815. It is empty if root is.
+func Fingerprint(root string) string {
+	if len(root) < 16 {
+		return root
+	}
+	var groups []string
+	for i := 0; i < 16; i += 4 {
+		groups = append(groups, root[i:i+4])
+	}
+	return strings.Join(groups, "-")
+}
@@ -0,0 +1,67 @@
+package transfer
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestMerkleRoot(t *testing.T) {
+	files := []FileEntry{
+		{Path: "a.txt", Size: 1, Checksum: "aa"},
+		{Path: "b/c.txt", Size: 2, Checksum: "bb"},
+		{Path: "d.txt", Size: 3, Checksum: "cc"},
+	}
+	m := &Manifest{FolderName: "one", Files: files}
+	root := m.MerkleRoot()
+	if len(root) != 64 {
+		t.Fatalf("MerkleRoot = %q, want 32 hex bytes", root)
+	}
+
+	reordered := &Manifest{FolderName: "two", Files: []FileEntry{files[2], files[0], files[1]}}
+	if got := reordered.MerkleRoot(); got != root {
+		t.Errorf("Root depends on file order or folder name: %s != %s", got, root)
+	}
+
+	changed := &Manifest{Files: []FileEntry{files[0], files[1], {Path: "d.txt", Size: 3, Checksum: "cd"}}}
+	if changed.MerkleRoot() == root {
+		t.Error("Root did not change with a checksum")
+	}
+	renamed := &Manifest{Files: []FileEntry{files[0], files[1], {Path: "e.txt", Size: 3, Checksum: "cc"}}}
+	if renamed.MerkleRoot() == root {
+		t.Error("Root did not change with a path")
+	}
+
+	unhashed := &Manifest{Files: []FileEntry{files[0], {Path: "x", Size: 1}}}
+	if got := unhashed.MerkleRoot(); got != "" {
+		t.Errorf("Root of files without checksums = %q, want empty", got)
+	}
+	if (&Manifest{}).MerkleRoot() == "" {
+		t.Error("Empty manifest has no root")
+	}
+}
+
+func TestVerifyRoot(t *testing.T) {
+	m := &Manifest{Files: []FileEntry{{Path: "a.txt", Size: 1, Checksum: "aa"}}}
+	if err := m.VerifyRoot(); err != nil {
+		t.Errorf("Manifest without a root failed: %v", err)
+	}
+	m.Root = m.MerkleRoot()
+	if err := m.VerifyRoot(); err != nil {
+		t.Errorf("Matching root failed: %v", err)
+	}
+	m.Files[0].Checksum = "ab"
+	err := m.VerifyRoot()
+	if CategoryOf(err) != CategoryValidation {
+		t.Errorf("Expected a validation error for a changed file, got %v", err)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	root := (&Manifest{}).MerkleRoot()
+	if !regexp.MustCompile(`^[0-9a-f]{4}(-[0-9a-f]{4}){3}$`).MatchString(Fingerprint(root)) {
+		t.Errorf("Fingerprint(%s) = %q", root, Fingerprint(root))
+	}
+	if Fingerprint("") != "" {
+		t.Error("Fingerprint of no root is not empty")
+	}
+}
@@ -0,0 +1,137 @@
+package transfer
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// sniffLen is how many bytes of a file MIMEType looks at, as many as
+// http.DetectContentType considers
+const sniffLen = 512
+
+// mediaTypes covers common extensions that not every system's MIME table
+// knows, so icons look the same everywhere
+var mediaTypes = map[string]string{
+	".jpg": "image/jpeg", ".jpeg": "image/jpeg", ".png": "image/png", ".gif": "image/gif",
+	".webp": "image/webp", ".heic": "image/heic", ".heif": "image/heif", ".avif": "image/avif",
+	".tif": "image/tiff", ".tiff": "image/tiff", ".bmp": "image/bmp", ".svg": "image/svg+xml",
+	".dng": "image/x-adobe-dng", ".cr2": "image/x-canon-cr2", ".nef": "image/x-nikon-nef", ".arw": "image/x-sony-arw",
+	".mp4": "video/mp4", ".m4v": "video/mp4", ".mov": "video/quicktime", ".mkv": "video/x-matroska",
+	".webm": "video/webm", ".avi": "video/x-msvideo", ".mts": "video/mp2t",
+	".mp3": "audio/mpeg", ".m4a": "audio/mp4", ".aac": "audio/aac", ".wav": "audio/wav",
+	".flac": "audio/flac", ".ogg": "audio/ogg", ".opus": "audio/opus",
+	".pdf": "application/pdf", ".doc": "application/msword", ".rtf": "application/rtf",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xls":  "application/vnd.ms-excel",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".ppt":  "application/vnd.ms-powerpoint",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".odt":  "application/vnd.oasis.opendocument.text", ".ods": "application/vnd.oasis.opendocument.spreadsheet",
+	".zip": "application/zip", ".gz": "application/gzip", ".tgz": "application/gzip", ".tar": "application/x-tar",
+	".7z": "application/x-7z-compressed", ".rar": "application/vnd.rar", ".xz": "application/x-xz",
+	".bz2": "application/x-bzip2", ".zst": "application/zstd",
+	".txt": "text/plain", ".md": "text/markdown", ".csv": "text/csv", ".json": "application/json",
+}
+
+// archiveTypes are the media types FileKind counts as archives
+var archiveTypes = map[string]bool{
+	"application/zip": true, "application/gzip": true, "application/x-gzip": true, "application/x-tar": true,
+	"application/x-7z-compressed": true, "application/vnd.rar": true, "application/x-rar-compressed": true,
+	"application/x-xz": true, "application/x-bzip2": true, "application/zstd": true,
+}
+
+// typeByExtension returns the media type of name by its extension, or an
+// empty string if the extension is unknown
+func typeByExtension(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	if ext == "" {
+		return ""
+	}
+	if t, ok := mediaTypes[ext]; ok {
+		return t
+	}
+	t, _, _ := strings.Cut(mime.TypeByExtension(ext), ";")
+	return strings.TrimSpace(t)
+}
+
+// MIMEType returns the media type of the file name, such as "image/jpeg",
+// by its extension. Files with an unknown extension are recognized by head,
+// their first bytes, if given, and are "application/octet-stream" otherwise.
+func MIMEType(name string, head []byte) string {
+	if t := typeByExtension(name); t != "" {
+		return t
+	}
+	if len(head) == 0 {
+		return "application/octet-stream"
+	}
+	t, _, _ := strings.Cut(http.DetectContentType(head), ";")
+	return t
+}
+
+// FileKind groups a media type for statistics such as "1,204 photos, 32
+// videos": "image", "video", "audio", "document", "archive", "text" or
+// "other"
+func FileKind(mimeType string) string {
+	major, _, _ := strings.Cut(mimeType, "/")
+	switch {
+	case major == "image" || major == "video" || major == "audio" || major == "text":
+		return major
+	case archiveTypes[mimeType]:
+		return "archive"
+	case mimeType == "application/pdf" || mimeType == "application/msword" || mimeType == "application/rtf" ||
+		strings.HasPrefix(mimeType, "application/vnd.openxmlformats-officedocument.") ||
+		strings.HasPrefix(mimeType, "application/vnd.oasis.opendocument.") ||
+		strings.HasPrefix(mimeType, "application/vnd.ms-"):
+		return "document"
+	}
+	return "other"
+}
+
+// CountKinds returns how many of types there are of each FileKind
+func CountKinds(types []string) map[string]int {
+	kinds := make(map[string]int)
+	for _, t := range types {
+		kinds[FileKind(t)]++
+	}
+	return kinds
+}
+
+// ManifestTypes returns the media type of each file of m by its extension.
+// Receivers use it, as they cannot look into the files before accepting.
+func ManifestTypes(m *Manifest) []string {
+	types := make([]string, len(m.Files))
+	for i, f := range m.Files {
+		types[i] = MIMEType(f.Path, nil)
+	}
+	return types
+}
+
+// FileTypes returns the media type of each file of the manifest. Files with
+// an unknown extension are recognized by their first bytes.
+func (s *Sender) FileTypes() []string {
+	types := make([]string, len(s.Manifest.Files))
+	for i, f := range s.Manifest.Files {
+		if t := typeByExtension(f.Path); t != "" {
+			types[i] = t
+			continue
+		}
+		types[i] = MIMEType(f.Path, s.head(f.Path))
+	}
+	return types
+}
+
+// head returns the first bytes of the file at the manifest path p, nil if
+// it cannot be read
+func (s *Sender) head(p string) []byte {
+	file, err := s.openFile(p)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	buf := make([]byte, sniffLen)
+	n, _ := io.ReadFull(file, buf)
+	return buf[:n]
+}
@@ -0,0 +1,71 @@
+package transfer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMIMEType(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	cases := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{"photos/IMG_0001.JPG", nil, "image/jpeg"},
+		{"clip.mov", nil, "video/quicktime"},
+		{"report.pdf", png, "application/pdf"}, // The extension wins
+		{"scan", png, "image/png"},
+		{"notes", []byte("plain words"), "text/plain"},
+		{"blob", nil, "application/octet-stream"},
+	}
+	for _, c := range cases {
+		if got := MIMEType(c.name, c.head); got != c.want {
+			t.Errorf("MIMEType(%q) = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestCountKinds(t *testing.T) {
+	kinds := CountKinds([]string{"image/jpeg", "image/png", "video/mp4", "application/zip", "application/pdf",
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document", "application/octet-stream"})
+	want := map[string]int{"image": 2, "video": 1, "archive": 1, "document": 2, "other": 1}
+	if len(kinds) != len(want) {
+		t.Fatalf("CountKinds() = %v, want %v", kinds, want)
+	}
+	for kind, n := range want {
+		if kinds[kind] != n {
+			t.Errorf("CountKinds()[%s] = %d, want %d", kind, kinds[kind], n)
+		}
+	}
+}
+
+func TestSenderFileTypes(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"a.jpg":  []byte("not really a jpeg"),
+		"export": []byte("GIF89a\x01\x00\x01\x00"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sender, err := NewSender(context.Background(), dir, false, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Receivers only have the names
+	sent, received := sender.FileTypes(), ManifestTypes(sender.Manifest)
+	for i, f := range sender.Manifest.Files {
+		want := map[string][2]string{
+			"a.jpg":  {"image/jpeg", "image/jpeg"},
+			"export": {"image/gif", "application/octet-stream"},
+		}[f.Path]
+		if sent[i] != want[0] || received[i] != want[1] {
+			t.Errorf("type of %s = %q sending, %q receiving, want %q", f.Path, sent[i], received[i], want)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+//go:build darwin
+
+package transfer
+
+import "golang.org/x/sys/unix"
+
+// IsNetworkMount reports whether path is on a network file system such as
+// NFS or SMB, see the Linux version
+func IsNetworkMount(path string) bool {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return false
+	}
+	switch unix.ByteSliceToString(st.Fstypename[:]) {
+	case "nfs", "smbfs", "afpfs", "webdav", "cifs":
+		return true
+	}
+	return false
+}
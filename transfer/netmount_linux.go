@@ -0,0 +1,27 @@
+//go:build linux
+
+package transfer
+
+import "golang.org/x/sys/unix"
+
+// Magic numbers of network file systems golang.org/x/sys does not name
+const (
+	cifsMagic = 0xff534d42
+	smb2Magic = 0xfe534d42
+)
+
+// IsNetworkMount reports whether path is on a network file system such as
+// NFS or SMB. FUSE mounts such as sshfs cannot be told apart from local
+// ones and are not.
+func IsNetworkMount(path string) bool {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return false
+	}
+	switch uint32(st.Type) {
+	case unix.NFS_SUPER_MAGIC, unix.SMB_SUPER_MAGIC, cifsMagic, smb2Magic,
+		unix.V9FS_MAGIC, unix.CEPH_SUPER_MAGIC, unix.AFS_SUPER_MAGIC:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !windows
+
+package transfer
+
+// IsNetworkMount reports false, network mounts are not detected here
+func IsNetworkMount(path string) bool {
+	return false
+}
@@ -0,0 +1,24 @@
+//go:build windows
+
+package transfer
+
+import (
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+)
+
+// IsNetworkMount reports whether path is on a network share, by a UNC path
+// or a mapped drive
+func IsNetworkMount(path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	root := filepath.VolumeName(abs) + `\`
+	name, err := windows.UTF16PtrFromString(root)
+	if err != nil {
+		return false
+	}
+	return windows.GetDriveType(name) == windows.DRIVE_REMOTE
+}
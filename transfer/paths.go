@@ -0,0 +1,73 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// validatePath returns an error unless path is baseDir or inside it. Both
+// are resolved through their symlinks as far as they exist, so a symlink in
+// the destination cannot lead a file out of it. The receiver checks paths
+// before creating their folders and again before opening the file.
+func validatePath(path, baseDir string) error {
+	cleanPath := filepath.Clean(path)
+	cleanBase := filepath.Clean(baseDir)
+	if !within(cleanPath, cleanBase) {
+		return errors.New("path traversal detected")
+	}
+
+	resolvedBase, err := resolveExisting(cleanBase)
+	if err != nil {
+		return fmt.Errorf("failed to resolve base directory: %w", err)
+	}
+	resolvedPath, err := resolveExisting(cleanPath)
+	if err != nil {
+		return fmt.Errorf("failed to validate path: %w", err)
+	}
+	if !within(resolvedPath, resolvedBase) {
+		return errors.New("symlink attack detected: resolved path outside base directory")
+	}
+	return nil
+}
+
+// resolveExisting resolves the symlinks of the longest part of path that
+// exists and appends the rest, which cannot contain any. A dangling symlink
+// is an error, since creating the file would create its target.
+func resolveExisting(path string) (string, error) {
+	existing, rest := path, ""
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return path, nil
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+
+	resolved, err := filepath.EvalSymlinks(existing)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("dangling symlink %s", existing)
+	}
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(resolved, rest), nil
+}
+
+// within reports whether the clean path is base or inside it
+func within(path, base string) bool {
+	if path == base {
+		return true
+	}
+	if !strings.HasSuffix(base, string(os.PathSeparator)) {
+		base += string(os.PathSeparator)
+	}
+	return strings.HasPrefix(path, base)
+}
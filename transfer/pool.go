@@ -0,0 +1,115 @@
+package transfer
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// copyBufferSize is the buffer size used to copy file data
+const copyBufferSize = 256 * 1024
+
+// maxPooledMessage keeps the occasional huge manifest out of the pool
+const maxPooledMessage = 64 * 1024
+
+var (
+	chunkPool   = sync.Pool{New: func() interface{} { b := make([]byte, copyBufferSize); return &b }}
+	blockPool   = sync.Pool{New: func() interface{} { b := make([]byte, BlockSize); return &b }}
+	messagePool = sync.Pool{New: func() interface{} { b := make([]byte, 0, 512); return &b }}
+)
+
+// getBlock returns a buffer of size bytes, pooled if size is BlockSize.
+// Return it with putBlock.
+func getBlock(size int64) *[]byte {
+	if size == BlockSize {
+		return blockPool.Get().(*[]byte)
+	}
+	b := make([]byte, size)
+	return &b
+}
+
+func putBlock(b *[]byte) {
+	if len(*b) == BlockSize {
+		blockPool.Put(b)
+	}
+}
+
+// getMessage returns a buffer for reading messages, see growMessage
+func getMessage() *[]byte {
+	return messagePool.Get().(*[]byte)
+}
+
+// growMessage returns the buffer resized to n bytes
+func growMessage(b *[]byte, n int) []byte {
+	if cap(*b) < n {
+		*b = make([]byte, n)
+	}
+	*b = (*b)[:n]
+	return *b
+}
+
+func putMessage(b *[]byte) {
+	if cap(*b) <= maxPooledMessage {
+		messagePool.Put(b)
+	}
+}
+
+// copyChunks copies src to dst with io.CopyBuffer and a pooled buffer.
+// onChunk is called with the total copied after each chunk. Read errors
+// include cancelling ctx and are reported apart from write errors, so
+// callers can tell a failing disk from a failing network. The copy is slowed
+// down to the limit of SetThrottle.
+func copyChunks(ctx context.Context, dst io.Writer, src io.Reader, onChunk func(copied int64)) (copied int64, readErr, writeErr error) {
+	buf := chunkPool.Get().(*[]byte)
+	defer chunkPool.Put(buf)
+
+	r := &chunkReader{ctx: ctx, r: src}
+	w := &chunkWriter{w: dst, onChunk: onChunk}
+	copied, err := io.CopyBuffer(w, r, *buf)
+	if err != nil {
+		if r.err != nil {
+			return copied, r.err, nil
+		}
+		return copied, nil, err
+	}
+	return copied, nil, nil
+}
+
+type chunkReader struct {
+	ctx context.Context
+	r   io.Reader
+	err error
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		c.err = cancelledError(err)
+		return 0, c.err
+	}
+	n, err := c.r.Read(p)
+	if err != nil && err != io.EOF {
+		c.err = err
+	}
+	if n > 0 {
+		if werr := waitThrottle(c.ctx, n); werr != nil {
+			c.err = werr
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+type chunkWriter struct {
+	w       io.Writer
+	copied  int64
+	onChunk func(copied int64)
+}
+
+func (c *chunkWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.copied += int64(n)
+	if n > 0 && c.onChunk != nil {
+		c.onChunk(c.copied)
+	}
+	return n, err
+}
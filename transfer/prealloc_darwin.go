@@ -0,0 +1,25 @@
+//go:build darwin
+
+package transfer
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// preallocate reserves disk space for file up to size without changing its
+// length, see the Linux version
+func preallocate(file *os.File, size int64) error {
+	info, err := file.Stat()
+	if err != nil || size <= info.Size() {
+		return err
+	}
+	store := &unix.Fstore_t{Flags: unix.F_ALLOCATEALL, Posmode: unix.F_PEOFPOSMODE, Length: size - info.Size()}
+	err = unix.FcntlFstore(file.Fd(), unix.F_PREALLOCATE, store)
+	if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EINVAL) {
+		return nil
+	}
+	return err
+}
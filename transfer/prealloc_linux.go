@@ -0,0 +1,25 @@
+//go:build linux
+
+package transfer
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// preallocate reserves disk space for file up to size without changing its
+// length, so its data is not fragmented and a full disk fails at once.
+// File systems that cannot do it are left alone.
+func preallocate(file *os.File, size int64) error {
+	info, err := file.Stat()
+	if err != nil || size <= info.Size() {
+		return err
+	}
+	err = unix.Fallocate(int(file.Fd()), unix.FALLOC_FL_KEEP_SIZE, info.Size(), size-info.Size())
+	if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.ENOSYS) {
+		return nil
+	}
+	return err
+}
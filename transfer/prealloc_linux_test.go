@@ -0,0 +1,37 @@
+//go:build linux
+
+package transfer
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestPreallocate(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "file.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	file.Write([]byte("start"))
+
+	if err := preallocate(file, 4<<20); err != nil {
+		t.Fatalf("preallocate() error = %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Resuming goes by the length, which must not change
+	if info.Size() != 5 {
+		t.Errorf("size after preallocate() = %d, want 5", info.Size())
+	}
+	if blocks := info.Sys().(*syscall.Stat_t).Blocks; blocks*512 < 4<<20 {
+		t.Errorf("%d bytes allocated, want 4 MB", blocks*512)
+	}
+	if err := preallocate(file, 1); err != nil {
+		t.Errorf("preallocate() of less than the file error = %v", err)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !windows
+
+package transfer
+
+import "os"
+
+// preallocate does nothing, there is no portable way to reserve space
+// without changing the length of file
+func preallocate(file *os.File, size int64) error {
+	return nil
+}
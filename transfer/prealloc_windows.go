@@ -0,0 +1,22 @@
+//go:build windows
+
+package transfer
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// preallocate reserves disk space for file up to size without changing its
+// length, see the Linux version. The allocation is dropped if the file is
+// closed before it is written that far.
+func preallocate(file *os.File, size int64) error {
+	info, err := file.Stat()
+	if err != nil || size <= info.Size() {
+		return err
+	}
+	allocation := struct{ AllocationSize int64 }{size}
+	return windows.SetFileInformationByHandle(windows.Handle(file.Fd()), windows.FileAllocationInfo, (*byte)(unsafe.Pointer(&allocation)), uint32(unsafe.Sizeof(allocation)))
+}
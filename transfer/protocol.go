@@ -3,16 +3,22 @@ package transfer
 import (
 	"bufio"
 	"compress/gzip"
+	"context"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/ebob10000/2c1f/paths"
+	"golang.org/x/time/rate"
 	"lukechampine.com/blake3"
 )
 
@@ -28,6 +34,18 @@ const (
 	MsgError
 	MsgHandshake
 	MsgHandshakeAck
+	MsgReceipt
+	MsgChallenge
+	MsgChallengeResponse
+	MsgWait          // Scheduled sender holds the transfer, see WaitMsg
+	MsgCompleteAck   // Receiver verified and saved all files, last message of a transfer
+	MsgPing          // Keeps the connection alive while one side is busy, see keepalive
+	MsgPong          // Answer to MsgPing
+	MsgProgressAck   // Receiver wrote file data to disk, see ProgressAckMsg
+	MsgMailbox       // Opens a stream to a mailbox server, see MailboxRequest
+	MsgMailboxReply  // Answer to MsgMailbox, see MailboxReply
+	MsgCodeChallenge // Sender's proof that it knows the code, see CodeChallengeMsg
+	MsgCodeResponse  // Receiver's proof that it knows the code, see ChallengeResponseMsg
 )
 
 type Message struct {
@@ -36,17 +54,24 @@ type Message struct {
 }
 
 type HandshakeMsg struct {
-	Code string `json:"code"`
+	Share string `json:"share,omitempty"` // Label of the share wanted from a Catalog
+	Nonce []byte `json:"nonce,omitempty"` // Receiver's nonce for the code proofs, see CodeChallengeMsg
 }
 
 type HandshakeAckMsg struct {
-	Compress bool `json:"compress"`
+	Compress    bool   `json:"compress"`
+	Proof       []byte `json:"proof,omitempty"`        // Sender's password proof when a password is set
+	Keepalive   bool   `json:"keepalive,omitempty"`    // Sender accepts MsgPing while waiting for the resume message
+	DataStream  bool   `json:"data_stream,omitempty"`  // Sender accepts file data on a separate stream
+	ProgressAck bool   `json:"progress_ack,omitempty"` // Sender reads MsgProgressAck while sending files
+	TimeoutMs   int64  `json:"timeout_ms,omitempty"`   // Sender's stream timeout, which the keepalive has to beat
 }
 
 type Manifest struct {
 	FolderName string      `json:"folder_name"`
 	TotalSize  int64       `json:"total_size"`
 	Files      []FileEntry `json:"files"`
+	Root       string      `json:"root,omitempty"` // Merkle root over the files, see MerkleRoot
 }
 
 type FileEntry struct {
@@ -59,50 +84,129 @@ type FileEntry struct {
 }
 
 const BlockSize = 16 * 1024 * 1024
+
+// MaxBlockSize bounds the block size a manifest may ask the receiver to
+// read at once when verifying existing data
+const MaxBlockSize = 4 * BlockSize
 const LegacyBlockSize = 1024 * 1024
 const MaxMessageSize = 100 << 20
+
+// StreamTimeout and MaxRetries are the defaults used when no override is configured
 const StreamTimeout = 60 * time.Second
 const MaxRetries = 5
 const RetryBaseDelay = 2 * time.Second
 
 type ResumeMsg struct {
-	Files map[string]int64 `json:"files"` // Path -> Offset
+	Files       map[string]int64 `json:"files"`                  // Path -> Offset
+	Skip        []string         `json:"skip,omitempty"`         // Paths the receiver does not want
+	DataStream  bool             `json:"data_stream,omitempty"`  // Receiver opened a data stream for the files
+	DataToken   []byte           `json:"data_token,omitempty"`   // Token the data stream starts with, see Receiver.DataStream
+	ProgressAck bool             `json:"progress_ack,omitempty"` // Receiver sends MsgProgressAck while receiving
+	SegmentSize int64            `json:"segment_size,omitempty"` // Receiver wants files in segments of this size
+	Blocks      map[string][]int `json:"blocks,omitempty"`       // Path -> Indexes of blocks after the offset the receiver has, which are not sent
+}
+
+// ProgressAckMsg reports that the receiver wrote Path up to Offset to disk.
+// It is sent on the control stream at most every ProgressAckInterval and
+// once a file is complete, so the sender's progress reflects what arrived.
+type ProgressAckMsg struct {
+	Path     string `json:"path"`
+	Offset   int64  `json:"offset"`
+	Complete bool   `json:"complete,omitempty"` // Path was saved, the last ack of it
+	Verified bool   `json:"verified,omitempty"` // Path matched its checksum
 }
 
+// ProgressAckInterval is how often the receiver acknowledges progress
+const ProgressAckInterval = time.Second
+
 // FileStartMsg indicates the beginning of a file transfer
 type FileStartMsg struct {
 	Path   string `json:"path"`
 	Size   int64  `json:"size"`
 	Offset int64  `json:"offset,omitempty"`
+	Length int64  `json:"length,omitempty"` // Bytes of a segment, the rest of the file if zero
+}
+
+// FileEndMsg follows the data of a file. Files without a checksum in the
+// manifest carry the CRC32C of each CRCFrameSize frame of the data sent, so
+// corruption is still detected. Older senders send no payload.
+type FileEndMsg struct {
+	FrameCRCs []uint32 `json:"frame_crcs,omitempty"`
+	Checksum  string   `json:"checksum,omitempty"` // BLAKE3 of the data of a segment
 }
 
+// Segments split large files for receivers that ask for them with
+// ResumeMsg.SegmentSize. Each is sent with its own FileStartMsg and
+// FileEndMsg, checked on its own and acknowledged once synced to disk, so a
+// broken connection only loses the segment in flight.
+const (
+	DefaultSegmentSize = 64 << 20
+	MinSegmentSize     = 1 << 20
+)
+
 // CompressedStream wraps a stream with gzip compression
 type CompressedStream struct {
 	r *gzip.Reader
-	w *gzip.Writer
+	w compressWriter
 	c io.Closer
+
+	wire    *wireCounter
+	logical atomic.Int64 // Bytes written and read before compression
+	busy    atomic.Int64 // Nanoseconds spent in the gzip reader and writer
 }
 
+// NewCompressedStream compresses at DefaultCompressLevel
 func NewCompressedStream(s io.ReadWriteCloser) (*CompressedStream, error) {
-	w := gzip.NewWriter(s)
-	if err := w.Flush(); err != nil {
+	return NewCompressedStreamLevel(s, 0)
+}
+
+// NewCompressedStreamLevel compresses what is written at the given gzip
+// level, see CheckCompressLevel. The other side does not need to know it.
+func NewCompressedStreamLevel(s io.ReadWriteCloser, level int) (*CompressedStream, error) {
+	wire := &wireCounter{rw: s}
+	w, err := newCompressWriter(wire, level)
+	if err != nil {
 		return nil, err
 	}
+	if err := w.Flush(); err != nil {
+		return nil, networkError("failed to write compression header", err)
+	}
 
-	r, err := gzip.NewReader(s)
+	r, err := gzip.NewReader(wire)
 	if err != nil {
-		return nil, err
+		if errors.Is(err, gzip.ErrHeader) {
+			return nil, protocolError("invalid compression header", err)
+		}
+		return nil, networkError("failed to read compression header", err)
 	}
 
-	return &CompressedStream{r: r, w: w, c: s}, nil
+	return &CompressedStream{r: r, w: w, c: s, wire: wire}, nil
 }
 
 func (cs *CompressedStream) Read(p []byte) (int, error) {
-	return cs.r.Read(p)
+	start := time.Now()
+	n, err := cs.r.Read(p)
+	cs.busy.Add(int64(time.Since(start)))
+	cs.logical.Add(int64(n))
+	return n, err
 }
 
 func (cs *CompressedStream) Write(p []byte) (int, error) {
-	return cs.w.Write(p)
+	start := time.Now()
+	n, err := cs.w.Write(p)
+	cs.busy.Add(int64(time.Since(start)))
+	cs.logical.Add(int64(n))
+	return n, err
+}
+
+// Stats returns how much data went through the stream in both directions
+// and how long compressing it took
+func (cs *CompressedStream) Stats() CompressionStats {
+	return CompressionStats{
+		Logical: cs.logical.Load(),
+		Wire:    cs.wire.bytes.Load(),
+		CPUTime: time.Duration(max(cs.busy.Load()-cs.wire.busy.Load(), 0)),
+	}
 }
 
 func (cs *CompressedStream) SetReadDeadline(t time.Time) error {
@@ -134,6 +238,8 @@ func (cs *CompressedStream) Close() error {
 }
 
 func (cs *CompressedStream) Flush() error {
+	start := time.Now()
+	defer func() { cs.busy.Add(int64(time.Since(start))) }()
 	return cs.w.Flush()
 }
 
@@ -195,13 +301,19 @@ func (b *BufferedDeadlineWriter) Flush() error {
 
 type ManifestProgressFunc func(path string, size int64)
 
-func BuildManifest(path string, cache bool, skipHash bool, onProgress ManifestProgressFunc) (*Manifest, error) {
+func BuildManifest(ctx context.Context, path string, cache bool, skipHash bool, onProgress ManifestProgressFunc) (*Manifest, error) {
+	return buildManifest(ctx, path, cache, skipHash, nil, onProgress)
+}
+
+// buildManifest is BuildManifest reading the files no faster than limiter
+// allows, if not nil
+func buildManifest(ctx context.Context, path string, cache bool, skipHash bool, limiter *rate.Limiter, onProgress ManifestProgressFunc) (*Manifest, error) {
 	info, err := os.Stat(path)
 	if err != nil {
 		return nil, fmt.Errorf("cannot access path: %w", err)
 	}
 
-	manifestFile := filepath.Join(path, ".2c1f_manifest.json")
+	manifestFile := manifestCachePath(path)
 	if cache && info.IsDir() && !skipHash {
 		if data, err := os.ReadFile(manifestFile); err == nil {
 			var cachedManifest Manifest
@@ -211,159 +323,147 @@ func BuildManifest(path string, cache bool, skipHash bool, onProgress ManifestPr
 		}
 	}
 
-	manifest := &Manifest{
-		FolderName: filepath.Base(path),
-		Files:      []FileEntry{},
+	manifest, err := buildManifestFS(ctx, localFS(path, info), filepath.Base(path), skipHash, limiter, onProgress)
+	if err != nil {
+		return nil, err
 	}
 
-	if !info.IsDir() {
-		var hash string
-		var blockHashes []string
-
-		if onProgress != nil {
-			onProgress(filepath.Base(path), info.Size())
-		}
-
-		if !skipHash {
-			hash, blockHashes, err = calculateHashAndBlocks(path)
-			if err != nil {
-				return nil, fmt.Errorf("failed to calculate hash: %w", err)
+	if cache && info.IsDir() && !skipHash {
+		data, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to marshal manifest cache: %v\n", err)
+		} else {
+			if err := os.WriteFile(manifestFile, data, 0600); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to write manifest cache: %v\n", err)
 			}
 		}
-		manifest.Files = append(manifest.Files, FileEntry{
-			Path:        filepath.Base(path),
-			Size:        info.Size(),
-			Mode:        info.Mode(),
-			Checksum:    hash,
-			BlockHashes: blockHashes,
-			BlockSize:   BlockSize,
-		})
-		manifest.TotalSize = info.Size()
-		return manifest, nil
-	}
-
-	var filesToHash []string
-	err = filepath.Walk(path, func(walkPath string, info os.FileInfo, err error) error {
+	}
+
+	return manifest, nil
+}
+
+// manifestCachePath returns where the manifest of the folder at path is
+// cached. Older versions kept it in the folder as .2c1f_manifest.json,
+// which is still never sent.
+func manifestCachePath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	sum := blake3.Sum256([]byte(path))
+	return paths.Cache(filepath.Join("manifests", hex.EncodeToString(sum[:16])+".json"))
+}
+
+// BuildManifestFS builds the manifest of the files in fsys, sent as a folder
+// called name. Files are hashed in parallel.
+func BuildManifestFS(ctx context.Context, fsys fs.FS, name string, skipHash bool, onProgress ManifestProgressFunc) (*Manifest, error) {
+	return buildManifestFS(ctx, fsys, name, skipHash, nil, onProgress)
+}
+
+// buildManifestFS is BuildManifestFS reading the files no faster than
+// limiter allows, if not nil
+func buildManifestFS(ctx context.Context, fsys fs.FS, name string, skipHash bool, limiter *rate.Limiter, onProgress ManifestProgressFunc) (*Manifest, error) {
+	var files []string
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		if info.IsDir() {
-			return nil
+		if err := ctx.Err(); err != nil {
+			return cancelledError(err)
 		}
-		if filepath.Base(walkPath) == ".2c1f_manifest.json" {
-			return nil
+		if !d.IsDir() && d.Name() != ".2c1f_manifest.json" {
+			files = append(files, p)
 		}
-		filesToHash = append(filesToHash, walkPath)
 		return nil
 	})
 	if err != nil {
+		if CategoryOf(err) == CategoryCancelled {
+			return nil, err
+		}
 		return nil, fmt.Errorf("failed to walk folder: %w", err)
 	}
 
-	// Process files in parallel
-	numWorkers := runtime.NumCPU()
-	jobChan := make(chan string, len(filesToHash))
-	resultChan := make(chan FileEntry, len(filesToHash))
-	errChan := make(chan error, 1)
+	entries := make([]FileEntry, len(files))
+	jobs := make(chan int)
+	errs := make(chan error, len(files))
 	var wg sync.WaitGroup
-
-	for i := 0; i < numWorkers; i++ {
+	for worker := range min(runtime.NumCPU(), max(len(files), 1)) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for walkPath := range jobChan {
-				select {
-				case <-errChan:
+			for {
+				if hashTurn(ctx, worker) != nil {
 					return
-				default:
 				}
-
-				info, err := os.Stat(walkPath)
-				if err != nil {
-					select {
-					case errChan <- err:
-					default:
-					}
+				i, ok := <-jobs
+				if !ok {
 					return
 				}
-
-				relPath, err := filepath.Rel(path, walkPath)
+				entry, err := manifestEntry(ctx, fsys, files[i], skipHash, limiter, onProgress)
 				if err != nil {
-					select {
-					case errChan <- err:
-					default:
-					}
-					return
-				}
-
-				if onProgress != nil {
-					onProgress(relPath, info.Size())
-				}
-
-				var hash string
-				var blockHashes []string
-				if !skipHash {
-					hash, blockHashes, err = calculateHashAndBlocks(walkPath)
-					if err != nil {
-						select {
-						case errChan <- err:
-						default:
-						}
-						return
-					}
-				}
-
-				resultChan <- FileEntry{
-					Path:        filepath.ToSlash(relPath),
-					Size:        info.Size(),
-					Mode:        info.Mode(),
-					Checksum:    hash,
-					BlockHashes: blockHashes,
-					BlockSize:   BlockSize,
+					errs <- err
+					continue
 				}
+				entries[i] = entry
 			}
 		}()
 	}
-
-	for _, f := range filesToHash {
-		jobChan <- f
+	for i := range files {
+		if ctx.Err() != nil || len(errs) > 0 {
+			break
+		}
+		jobs <- i
 	}
-	close(jobChan)
-
-	// Wait for workers
+	close(jobs)
 	wg.Wait()
-	close(resultChan)
 
-	// Check for errors
+	if err := ctx.Err(); err != nil {
+		return nil, cancelledError(err)
+	}
 	select {
-	case err := <-errChan:
+	case err := <-errs:
 		return nil, err
 	default:
 	}
 
-	for entry := range resultChan {
-		manifest.Files = append(manifest.Files, entry)
+	manifest := &Manifest{FolderName: name, Files: entries}
+	for _, entry := range entries {
 		manifest.TotalSize += entry.Size
 	}
+	return manifest, nil
+}
 
-	if cache && info.IsDir() && !skipHash {
-		data, err := json.MarshalIndent(manifest, "", "  ")
+func manifestEntry(ctx context.Context, fsys fs.FS, name string, skipHash bool, limiter *rate.Limiter, onProgress ManifestProgressFunc) (FileEntry, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return FileEntry{}, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return FileEntry{}, err
+	}
+	if onProgress != nil {
+		onProgress(name, info.Size())
+	}
+
+	entry := FileEntry{Path: name, Size: info.Size(), Mode: info.Mode(), BlockSize: BlockSize}
+	if !skipHash {
+		var r io.Reader = file
+		if limiter != nil {
+			r = &limitedReader{ctx: ctx, r: file, limiter: limiter}
+		}
+		entry.Checksum, entry.BlockHashes, err = hashBlocks(ctx, r)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to marshal manifest cache: %v\n", err)
-		} else {
-			if err := os.WriteFile(manifestFile, data, 0600); err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: failed to write manifest cache: %v\n", err)
-			}
+			return FileEntry{}, fmt.Errorf("failed to hash %s: %w", name, err)
 		}
 	}
-
-	return manifest, nil
+	return entry, nil
 }
 
 func WriteMessage(w io.Writer, msg *Message) error {
 	data, err := json.Marshal(msg)
 	if err != nil {
-		return err
+		return protocolError("failed to encode message", err)
 	}
 
 	length := uint32(len(data))
@@ -375,23 +475,26 @@ func WriteMessage(w io.Writer, msg *Message) error {
 	}
 
 	if _, err := w.Write(lengthBytes); err != nil {
-		return err
+		return networkError("", err)
 	}
 	if _, err := w.Write(data); err != nil {
-		return err
+		return networkError("", err)
 	}
 
 	if f, ok := w.(interface{ Flush() error }); ok {
-		return f.Flush()
+		return networkError("", f.Flush())
 	}
 
 	return nil
 }
 
 func ReadMessage(r io.Reader) (*Message, error) {
-	lengthBytes := make([]byte, 4)
+	// The buffer is only used for decoding, the payload is copied out of it
+	buf := getMessage()
+	defer putMessage(buf)
+	lengthBytes := growMessage(buf, 4)
 	if _, err := io.ReadFull(r, lengthBytes); err != nil {
-		return nil, err
+		return nil, networkError("", err)
 	}
 
 	length := uint32(lengthBytes[0])<<24 |
@@ -400,17 +503,17 @@ func ReadMessage(r io.Reader) (*Message, error) {
 		uint32(lengthBytes[3])
 
 	if length > MaxMessageSize {
-		return nil, fmt.Errorf("message too large: %d > %d", length, MaxMessageSize)
+		return nil, protocolError("", fmt.Errorf("message too large: %d > %d", length, MaxMessageSize))
 	}
 
-	data := make([]byte, length)
+	data := growMessage(buf, int(length))
 	if _, err := io.ReadFull(r, data); err != nil {
-		return nil, err
+		return nil, networkError("", err)
 	}
 
 	var msg Message
 	if err := json.Unmarshal(data, &msg); err != nil {
-		return nil, err
+		return nil, protocolError("malformed message", err)
 	}
 
 	return &msg, nil
@@ -426,15 +529,37 @@ func SendManifest(w io.Writer, manifest *Manifest) error {
 
 func ParseManifest(msg *Message) (*Manifest, error) {
 	if msg.Type != MsgManifest {
-		return nil, fmt.Errorf("expected manifest message, got %d", msg.Type)
+		return nil, protocolError("", fmt.Errorf("expected manifest message, got %d", msg.Type))
 	}
 	var manifest Manifest
 	if err := json.Unmarshal(msg.Payload, &manifest); err != nil {
-		return nil, err
+		return nil, protocolError("invalid manifest", err)
+	}
+	if err := manifest.check(); err != nil {
+		return nil, protocolError("invalid manifest", err)
 	}
 	return &manifest, nil
 }
 
+// check rejects values a hostile sender could use to crash the receiver
+func (m *Manifest) check() error {
+	if m.TotalSize < 0 {
+		return fmt.Errorf("negative total size %d", m.TotalSize)
+	}
+	for _, f := range m.Files {
+		if f.Path == "" {
+			return errors.New("empty file path")
+		}
+		if f.Size < 0 {
+			return fmt.Errorf("negative size for %s", f.Path)
+		}
+		if f.BlockSize < 0 || f.BlockSize > MaxBlockSize {
+			return fmt.Errorf("invalid block size %d for %s", f.BlockSize, f.Path)
+		}
+	}
+	return nil
+}
+
 type ProgressReader struct {
 	Reader     io.Reader
 	Total      int64
@@ -471,26 +596,27 @@ func (pw *ProgressWriter) Write(p []byte) (int, error) {
 	return n, err
 }
 
-func calculateHashAndBlocks(path string) (string, []string, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return "", nil, err
-	}
-	defer file.Close()
-
+// hashBlocks returns the checksum of what file reads and of each block of it
+func hashBlocks(ctx context.Context, file io.Reader) (string, []string, error) {
 	hash := blake3.New(32, nil)
 	var blockHashes []string
 
-	buffer := make([]byte, BlockSize)
+	buf := getBlock(BlockSize)
+	defer putBlock(buf)
+	buffer := *buf
 	for {
-		n, err := file.Read(buffer)
+		if err := ctx.Err(); err != nil {
+			return "", nil, cancelledError(err)
+		}
+		// Filled completely, as remote files return whatever arrived
+		n, err := io.ReadFull(file, buffer)
 		if n > 0 {
 			hash.Write(buffer[:n])
 
 			blockSum := blake3.Sum256(buffer[:n])
 			blockHashes = append(blockHashes, hex.EncodeToString(blockSum[:]))
 		}
-		if err == io.EOF {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
 			break
 		}
 		if err != nil {
@@ -507,6 +633,48 @@ func SetStreamDeadline(r io.Reader, d time.Duration) {
 	}
 }
 
+// clearStreamDeadline removes the read deadline SetStreamDeadline set
+func clearStreamDeadline(r io.Reader) {
+	if c, ok := r.(interface{ SetReadDeadline(time.Time) error }); ok {
+		c.SetReadDeadline(time.Time{})
+	}
+}
+
+// watchContext interrupts blocked I/O on stream once ctx is cancelled,
+// after calling onCancel if not nil. The returned stop function must be
+// called when the operation finishes. It waits for onCancel if ctx was
+// cancelled by then.
+func watchContext(ctx context.Context, stream interface{}, onCancel func()) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+		case <-done:
+			if ctx.Err() == nil {
+				return
+			}
+		}
+		if onCancel != nil {
+			onCancel()
+		}
+		if d, ok := stream.(interface{ SetDeadline(time.Time) error }); ok {
+			d.SetDeadline(time.Now())
+		}
+		if c, ok := stream.(io.Closer); ok {
+			c.Close()
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+	}
+}
+
 type TimeoutReader struct {
 	R       io.Reader
 	Timeout time.Duration
@@ -531,62 +699,7 @@ func (t *TimeoutWriter) Write(p []byte) (n int, err error) {
 	return t.W.Write(p)
 }
 
+// IsRetryableError reports whether err is a network failure that may succeed on reconnect
 func IsRetryableError(err error) bool {
-	if err == nil {
-		return false
-	}
-	errStr := err.Error()
-	retryablePatterns := []string{
-		"stream reset",
-		"connection reset",
-		"broken pipe",
-		"use of closed network connection",
-		"i/o timeout",
-		"temporary failure",
-		"connection refused",
-		"no route to host",
-		"network is unreachable",
-	}
-	for _, pattern := range retryablePatterns {
-		if containsIgnoreCase(errStr, pattern) {
-			return true
-		}
-	}
-	return false
-}
-
-func containsIgnoreCase(s, substr string) bool {
-	sLower := make([]byte, len(s))
-	substrLower := make([]byte, len(substr))
-	for i := 0; i < len(s); i++ {
-		c := s[i]
-		if c >= 'A' && c <= 'Z' {
-			c += 32
-		}
-		sLower[i] = c
-	}
-	for i := 0; i < len(substr); i++ {
-		c := substr[i]
-		if c >= 'A' && c <= 'Z' {
-			c += 32
-		}
-		substrLower[i] = c
-	}
-	return len(sLower) >= len(substrLower) && (len(substrLower) == 0 || findSubstring(sLower, substrLower))
-}
-
-func findSubstring(s, substr []byte) bool {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		match := true
-		for j := 0; j < len(substr); j++ {
-			if s[i+j] != substr[j] {
-				match = false
-				break
-			}
-		}
-		if match {
-			return true
-		}
-	}
-	return false
+	return CategoryOf(err) == CategoryNetwork
 }
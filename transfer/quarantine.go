@@ -0,0 +1,38 @@
+package transfer
+
+import (
+	"path"
+	"strings"
+)
+
+// executableExts are the extensions of programs, installers and scripts
+// that macOS runs on a double click, and of the archives and disk images
+// they come in. Archive Utility passes the quarantine on to what it
+// extracts, so a program in a .zip is only checked if the .zip is marked.
+var executableExts = map[string]bool{
+	".app": true, ".command": true, ".pkg": true, ".mpkg": true,
+	".sh": true, ".tool": true, ".jar": true, ".scpt": true, ".terminal": true,
+	".workflow": true, ".prefpane": true, ".kext": true, ".dylib": true,
+	// Disk images
+	".dmg": true, ".iso": true, ".img": true, ".cdr": true, ".sparseimage": true,
+	".sparsebundle": true,
+	// Archives, .tar.gz and the like by their last extension
+	".zip": true, ".xip": true, ".tar": true, ".tgz": true, ".gz": true,
+	".bz2": true, ".tbz": true, ".xz": true, ".txz": true, ".7z": true,
+	".rar": true, ".cpio": true,
+}
+
+// IsExecutable reports whether entry is a program, installer or script, or
+// an archive or disk image that may hold one, either by its extension, by being inside an app bundle or by having an
+// executable bit set on the sender
+func IsExecutable(entry FileEntry) bool {
+	if entry.Mode.IsRegular() && entry.Mode.Perm()&0111 != 0 {
+		return true
+	}
+	for _, part := range strings.Split(entry.Path, "/") {
+		if executableExts[strings.ToLower(path.Ext(part))] {
+			return true
+		}
+	}
+	return false
+}
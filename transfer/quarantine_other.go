@@ -0,0 +1,8 @@
+//go:build !darwin
+
+package transfer
+
+// quarantine does nothing, only macOS has Gatekeeper
+func quarantine(path string) error {
+	return nil
+}
@@ -0,0 +1,26 @@
+package transfer
+
+import "testing"
+
+func TestIsExecutable(t *testing.T) {
+	cases := []struct {
+		entry FileEntry
+		want  bool
+	}{
+		{FileEntry{Path: "notes.txt", Mode: 0644}, false},
+		{FileEntry{Path: "bin/tool", Mode: 0755}, true},
+		{FileEntry{Path: "Setup.DMG", Mode: 0644}, true},
+		{FileEntry{Path: "Tool.app/Contents/Info.plist", Mode: 0644}, true},
+		{FileEntry{Path: "photos/app.png", Mode: 0644}, false},
+		{FileEntry{Path: "Tool.zip", Mode: 0644}, true},
+		{FileEntry{Path: "Xcode.xip", Mode: 0644}, true},
+		{FileEntry{Path: "src/tool-1.0.tar.gz", Mode: 0644}, true},
+		{FileEntry{Path: "backup.7z", Mode: 0644}, true},
+		{FileEntry{Path: "installer.iso", Mode: 0644}, true},
+	}
+	for _, c := range cases {
+		if got := IsExecutable(c.entry); got != c.want {
+			t.Errorf("IsExecutable(%s, %v) = %v, want %v", c.entry.Path, c.entry.Mode, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package transfer
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"lukechampine.com/blake3"
+)
+
+// Receipt is the receiver's signed proof that all files of a manifest arrived and verified
+type Receipt struct {
+	ManifestHash string    `json:"manifestHash"`
+	Root         string    `json:"root,omitempty"` // Merkle root of the files, see Manifest.MerkleRoot
+	PeerID       string    `json:"peerId"`         // Receiver's libp2p peer ID, also identifies the signing key
+	Timestamp    time.Time `json:"timestamp"`
+	Signature    []byte    `json:"signature"`
+}
+
+// HashManifestData returns the canonical identifier of an encoded manifest
+func HashManifestData(data []byte) string {
+	sum := blake3.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// HashManifest encodes the manifest the same way it is sent on the wire and hashes it
+func HashManifest(m *Manifest) (string, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return HashManifestData(data), nil
+}
+
+// SignReceipt creates a receipt for manifestHash and the Merkle root of its
+// files signed with the receiver's libp2p key. root may be empty.
+func SignReceipt(key crypto.PrivKey, manifestHash, root string) (*Receipt, error) {
+	id, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive peer ID: %w", err)
+	}
+
+	r := &Receipt{
+		ManifestHash: manifestHash,
+		Root:         root,
+		PeerID:       id.String(),
+		Timestamp:    time.Now().UTC(),
+	}
+	sig, err := key.Sign(r.signedData())
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign receipt: %w", err)
+	}
+	r.Signature = sig
+	return r, nil
+}
+
+// Verify checks that the receipt covers manifestHash and was signed by the key behind PeerID
+func (r *Receipt) Verify(manifestHash string) error {
+	if r.ManifestHash != manifestHash {
+		return errors.New("receipt is for a different manifest")
+	}
+
+	id, err := peer.Decode(r.PeerID)
+	if err != nil {
+		return fmt.Errorf("invalid peer ID in receipt: %w", err)
+	}
+	pub, err := id.ExtractPublicKey()
+	if err != nil {
+		return fmt.Errorf("cannot extract public key from peer ID: %w", err)
+	}
+
+	ok, err := pub.Verify(r.signedData(), r.Signature)
+	if err != nil {
+		return fmt.Errorf("failed to verify receipt signature: %w", err)
+	}
+	if !ok {
+		return errors.New("invalid receipt signature")
+	}
+	return nil
+}
+
+func (r *Receipt) signedData() []byte {
+	data := fmt.Sprintf("2c1f-receipt\n%s\n%s\n%s", r.ManifestHash, r.PeerID, r.Timestamp.UTC().Format(time.RFC3339Nano))
+	// Receipts from before the root existed stay valid
+	if r.Root != "" {
+		data += "\n" + r.Root
+	}
+	return []byte(data)
+}
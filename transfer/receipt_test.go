@@ -0,0 +1,182 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+)
+
+func TestReceiptVerify(t *testing.T) {
+	key, _, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receipt, err := SignReceipt(key, "deadbeef", "")
+	if err != nil {
+		t.Fatalf("SignReceipt failed: %v", err)
+	}
+	if err := receipt.Verify("deadbeef"); err != nil {
+		t.Errorf("Valid receipt failed verification: %v", err)
+	}
+	if err := receipt.Verify("other"); err == nil {
+		t.Error("Expected verification to fail for a different manifest")
+	}
+
+	tampered := *receipt
+	tampered.ManifestHash = "other"
+	if err := tampered.Verify("other"); err == nil {
+		t.Error("Expected verification to fail for a tampered receipt")
+	}
+
+	rooted, err := SignReceipt(key, "deadbeef", "cafe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rooted.Verify("deadbeef"); err != nil {
+		t.Errorf("Receipt with a root failed verification: %v", err)
+	}
+	rooted.Root = "beef"
+	if err := rooted.Verify("deadbeef"); err == nil {
+		t.Error("Expected verification to fail for a tampered root")
+	}
+
+	otherKey, _, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := SignReceipt(otherKey, "deadbeef", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged.PeerID = receipt.PeerID
+	if err := forged.Verify("deadbeef"); err == nil {
+		t.Error("Expected verification to fail for a receipt signed by another key")
+	}
+}
+
+func TestTransferReceipt(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "file.txt"), []byte("Hello World"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	destDir := t.TempDir()
+
+	key, _, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	recvErr := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			recvErr <- err
+			return
+		}
+		defer conn.Close()
+
+		receiver := NewReceiver(destDir)
+		receiver.Code = "123-456"
+		receiver.Identity = key
+		recvErr <- receiver.Receive(context.Background(), conn)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+	if err != nil {
+		t.Fatalf("Failed to create sender: %v", err)
+	}
+	sender.Code = "123-456"
+	sender.Compress = true
+
+	if err := sender.Handshake(conn); err != nil {
+		t.Fatalf("Sender handshake failed: %v", err)
+	}
+	compressed, err := NewCompressedStream(conn)
+	if err != nil {
+		t.Fatalf("Failed to create compressed stream: %v", err)
+	}
+	defer compressed.Close()
+
+	var dataStream io.ReadWriter = compressed
+	delivery, err := sender.Send(context.Background(), dataStream)
+	if err != nil {
+		t.Fatalf("Sender failed: %v", err)
+	}
+	if err := <-recvErr; err != nil {
+		t.Fatalf("Receiver failed: %v", err)
+	}
+
+	if delivery.Receipt == nil {
+		t.Fatal("Expected sender to record a verified receipt")
+	}
+	if !delivery.Confirmed {
+		t.Error("Expected the acknowledgement after the receipt to be read")
+	}
+	hash, err := HashManifest(sender.Manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Receipt.ManifestHash != hash {
+		t.Errorf("Receipt manifest hash = %s, want %s", delivery.Receipt.ManifestHash, hash)
+	}
+	if sender.Manifest.Root == "" || delivery.Receipt.Root != sender.Manifest.Root {
+		t.Errorf("Receipt root = %q, want %q", delivery.Receipt.Root, sender.Manifest.Root)
+	}
+}
+
+func TestCompleteAck(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resume, _ := json.Marshal(ResumeMsg{})
+	for _, tc := range []struct {
+		name  string
+		reply []MessageType
+		want  bool
+	}{
+		{"Acknowledged", []MessageType{MsgCompleteAck}, true},
+		{"OlderReceiver", nil, false},
+		{"OlderReceiverWithReceipt", []MessageType{MsgReceipt}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var in bytes.Buffer
+			WriteMessage(&in, &Message{Type: MsgResume, Payload: resume})
+			for _, typ := range tc.reply {
+				WriteMessage(&in, &Message{Type: typ, Payload: []byte("{}")})
+			}
+			delivery, err := sender.Send(context.Background(), fuzzStream{&in})
+			if err != nil {
+				t.Fatalf("Send failed: %v", err)
+			}
+			if delivery.Confirmed != tc.want {
+				t.Errorf("Confirmed = %v, want %v", delivery.Confirmed, tc.want)
+			}
+		})
+	}
+}
@@ -2,37 +2,195 @@ package transfer
 
 import (
 	"bufio"
+	"context"
+	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/ebob10000/2c1f/storage"
+	"github.com/libp2p/go-libp2p/core/crypto"
 	"lukechampine.com/blake3"
 )
 
+// ErrDrained ends a transfer stopped through Receiver.Draining
+var ErrDrained = errors.New("receiver is shutting down")
+
 type Receiver struct {
-	DestPath       string
-	Code           string
-	Manifest       *Manifest
-	FastResume     bool
-	OnStartFile    func(filename string, index, total int)
-	OnProgress     func(filename string, received, total int64)
+	DestPath string
+	Code     string
+	Password string // Optional, must match the sender's password
+	Share    string // Label of the share to receive from a sender with a Catalog
+	// SegmentSize asks the sender for files in segments of this size, at
+	// least MinSegmentSize, see DefaultSegmentSize. Not segmented if zero,
+	// with Storage or with Encryption.
+	SegmentSize int64
+	Manifest    *Manifest
+	FastResume  bool
+	// Paranoid checks files already in the destination block by block only.
+	// Otherwise a file whose full checksum matches the manifest's is taken
+	// as complete and verified after one pass over it.
+	Paranoid bool
+	// JournalInterval is how many bytes of a file are received between
+	// syncs of it and its progress journal, DefaultJournalInterval if zero,
+	// no journal if negative
+	JournalInterval int64
+	// DirectIO writes files without the page cache where supported, for
+	// disks faster than the cache. Not used with Encryption.
+	DirectIO bool
+	// NoPreallocate writes files as they arrive instead of reserving their
+	// size on disk first, for file systems where that is slow
+	NoPreallocate bool
+	// Sync is when files are synced to disk. Segments are synced each
+	// before they are acknowledged regardless.
+	Sync       SyncPolicy
+	Encryption *EncryptionKey // Encrypts files at rest when set, disables resuming
+	Timeout    time.Duration  // Stream inactivity timeout, StreamTimeout if zero
+	Identity   crypto.PrivKey // Signs the delivery receipt, no receipt is sent if nil
+	Receipt    *Receipt       // Receipt sent to the sender after a successful transfer
+	Verified   bool           // The files matched the manifest's Merkle root after the transfer
+	// Compression tells how well compression did in the last transfer,
+	// when the sender compressed it
+	Compression CompressionStats
+	Storage     storage.Backend // Stores files there instead of in DestPath when set, which is then only shown. Disables resuming.
+	// BlockStore takes the blocks of files it has from there instead of
+	// the sender and keeps those of files received, when set. Not used
+	// for segments, Storage or Encryption.
+	BlockStore *BlockStore
+	// Audit records the options agreed on and each file with its checksum
+	// when set
+	Audit *AuditLog
+	// Scan checks each file saved on disk before it is reported complete,
+	// such as with a virus scanner, and rejects it with an error. Rejected
+	// files are moved to RejectedDir and the transfer goes on when that is
+	// set, otherwise they are removed and the transfer fails. Not used with
+	// Storage or Encryption.
+	Scan        func(path string) error
+	RejectedDir string
+	// Quarantine marks received programs, installers and archives, see
+	// IsExecutable, for Gatekeeper on macOS like browser downloads. Not
+	// used with Storage or Encryption.
+	Quarantine  bool
+	OnStartFile func(filename string, index, total int)
+	OnProgress  func(filename string, received, total int64)
+	// OnFileComplete is called when a file of this transfer was saved, or
+	// with the error it failed with. verified tells whether its checksum was
+	// checked. LocalPath returns where it was saved.
+	OnFileComplete func(filename string, verified bool, err error)
 	OnConfirmation func(m *Manifest) bool
+	OnWait         func(until time.Time) // Sender scheduled the transfer for later
+	// DataStream opens a separate stream for file data, so control messages
+	// such as a cancel are not queued behind it. The stream has to pass
+	// token on to the sender's DataStream, which tells it apart from those
+	// of other transfers with the same peer. Optional, files arrive on the
+	// main stream if nil or the sender does not support it.
+	DataStream func(ctx context.Context, token []byte) (io.ReadWriteCloser, error)
+	// Renamed maps manifest paths that are saved under a different name on
+	// this system, such as reserved names on Windows, to the local path
+	Renamed map[string]string
+	// Skip lists manifest paths to leave out, such as files deselected in
+	// OnConfirmation. The sender does not send them.
+	Skip map[string]bool
+	// FolderName saves the transfer under this name in DestPath instead of
+	// the manifest's. It may be set in OnConfirmation.
+	FolderName string
+	// RenameExisting saves the transfer under a free name such as
+	// "Photos (2)" when its folder exists with other files in it, instead
+	// of mixing them. A folder with files of the transfer is resumed.
+	RenameExisting bool
+	// Checksums writes a checksum file of the received files next to their
+	// folder when set to ChecksumSHA256 or ChecksumBLAKE3, such as
+	// Photos.SHA256SUMS
+	Checksums string
+	// Limits refuses manifests with more files, deeper paths or more data
+	// than wanted, with defaults against hostile senders
+	Limits Limits
+	// Draining ends the transfer with ErrDrained once it is closed, after
+	// the file being received is complete. A receiver shutting down stops
+	// at a clean point with it, the sender resumes the rest later.
+	Draining <-chan struct{}
+
+	names     *nameResolver
+	entries   map[string]*FileEntry // Manifest files by path
+	sums      map[string]string     // Checksums of the files received, for Checksums
+	saved     map[string]string     // Local paths of the files received
+	fileIndex int                   // Files started on this stream
+	segmented bool                  // Asked the sender for segments
+	claimed   map[string][]int      // Blocks taken from BlockStore by path
+	identical map[string]bool       // Files that were complete already, by their checksum
+	segment   *segmentState         // File whose next segment is expected
+	controlMu sync.Mutex
+	control   io.Writer // Control stream while files arrive on a data stream
+	acks      io.Writer // Where progress is acknowledged, nil if the sender does not read it
+	lastAck   time.Time
+	done      atomic.Int64 // Bytes of the selected files on disk
+	tally     tally        // Files of the current transfer, for Summary
 }
 
 func NewReceiver(destPath string) *Receiver {
 	return &Receiver{
 		DestPath: destPath,
+		Timeout:  StreamTimeout,
+	}
+}
+
+// draining reports whether Draining is closed
+func (r *Receiver) draining() bool {
+	select {
+	case <-r.Draining:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r *Receiver) timeout() time.Duration {
+	if r.Timeout <= 0 {
+		return StreamTimeout
+	}
+	return r.Timeout
+}
+
+// Receive performs the handshake and receives all files into DestPath.
+// Cancelling ctx aborts the transfer promptly; partially received files are
+// kept so a later attempt can resume them.
+func (r *Receiver) Receive(ctx context.Context, stream io.ReadWriteCloser) error {
+	stop := watchContext(ctx, stream, r.notifyCancel)
+	defer stop()
+
+	err := r.receive(ctx, stream)
+	if err != nil && ctx.Err() != nil {
+		return cancelledError(ctx.Err())
 	}
+	return err
 }
 
-func (r *Receiver) Receive(stream io.ReadWriteCloser) error {
-	SetStreamDeadline(stream, StreamTimeout)
-	if err := WriteMessage(stream, &Message{Type: MsgHandshake, Payload: []byte(r.Code)}); err != nil {
+func (r *Receiver) receive(ctx context.Context, stream io.ReadWriteCloser) error {
+	r.setControl(nil)
+	r.acks = nil
+	r.tally.reset()
+	defer r.tally.end()
+	SetStreamDeadline(stream, r.timeout())
+	codeNonce, err := newNonce()
+	if err != nil {
+		return fmt.Errorf("failed to generate handshake: %w", err)
+	}
+	handshake, err := json.Marshal(HandshakeMsg{Share: r.Share, Nonce: codeNonce})
+	if err != nil {
+		return protocolError("failed to marshal handshake", err)
+	}
+	if err := WriteMessage(stream, &Message{Type: MsgHandshake, Payload: handshake}); err != nil {
 		return fmt.Errorf("failed to send handshake: %w", err)
 	}
 
@@ -40,18 +198,52 @@ func (r *Receiver) Receive(stream io.ReadWriteCloser) error {
 	if err != nil {
 		return fmt.Errorf("failed to read handshake response: %w", err)
 	}
+	if msg.Type == MsgError {
+		return rejectedError("handshake rejected", errors.New(string(msg.Payload)))
+	}
+	if msg.Type != MsgCodeChallenge {
+		return validationError("", errors.New("sender did not prove it knows the code"))
+	}
+	if err := r.answerCode(stream, msg, codeNonce); err != nil {
+		return err
+	}
+	if msg, err = ReadMessage(stream); err != nil {
+		return fmt.Errorf("failed to read handshake response: %w", err)
+	}
+
+	var key, nonce []byte
+	if msg.Type == MsgChallenge {
+		if key, nonce, err = r.answerChallenge(stream, msg); err != nil {
+			return err
+		}
+		msg, err = ReadMessage(stream)
+		if err != nil {
+			return fmt.Errorf("failed to read handshake response: %w", err)
+		}
+	}
 
 	if msg.Type == MsgError {
-		return fmt.Errorf("handshake rejected: %s", string(msg.Payload))
+		return rejectedError("handshake rejected", errors.New(string(msg.Payload)))
 	}
 
 	if msg.Type != MsgHandshakeAck {
-		return fmt.Errorf("expected handshake ack, got %d", msg.Type)
+		return protocolError("", fmt.Errorf("expected handshake ack, got %d", msg.Type))
 	}
 
 	var ack HandshakeAckMsg
 	if err := json.Unmarshal(msg.Payload, &ack); err != nil {
-		return fmt.Errorf("invalid handshake ack: %w", err)
+		return protocolError("invalid handshake ack", err)
+	}
+
+	// With a password the sender must prove it knows it too, otherwise the
+	// other end could be someone who only guessed the code
+	if r.Password != "" {
+		if nonce == nil {
+			return validationError("", errors.New("sender did not ask for the password"))
+		}
+		if !validProof(ack.Proof, key, nonce, roleSender) {
+			return validationError("", errors.New("sender failed to prove the password"))
+		}
 	}
 
 	var dataStream io.ReadWriter = stream
@@ -64,77 +256,254 @@ func (r *Receiver) Receive(stream io.ReadWriteCloser) error {
 		dataStream = compressed
 	}
 
-	SetStreamDeadline(stream, StreamTimeout)
+	SetStreamDeadline(stream, r.timeout())
 	msg, err = ReadMessage(dataStream)
+	for err == nil && msg.Type == MsgWait {
+		var wait WaitMsg
+		if err := json.Unmarshal(msg.Payload, &wait); err != nil {
+			return protocolError("invalid wait message", err)
+		}
+		if r.OnWait != nil {
+			r.OnWait(wait.Until)
+		}
+		SetStreamDeadline(stream, r.timeout())
+		msg, err = ReadMessage(dataStream)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to read manifest: %w", err)
 	}
 
 	if msg.Type == MsgError {
-		return fmt.Errorf("handshake rejected: %s", string(msg.Payload))
+		return rejectedError("handshake rejected", errors.New(string(msg.Payload)))
 	}
 
 	manifest, err := ParseManifest(msg)
 	if err != nil {
 		return err
 	}
+	if err := r.Limits.Check(manifest); err != nil {
+		WriteMessage(dataStream, &Message{Type: MsgError, Payload: []byte("Transfer rejected by receiver: " + err.Error())})
+		return validationError("manifest exceeds limits", err)
+	}
 	r.Manifest = manifest
+	r.entries = make(map[string]*FileEntry, len(manifest.Files))
+	r.sums = make(map[string]string)
+	r.saved = make(map[string]string)
+	for i := range manifest.Files {
+		r.entries[manifest.Files[i].Path] = &manifest.Files[i]
+	}
+	manifestHash := HashManifestData(msg.Payload)
+
+	// Asking the user and checking existing files can take longer than the
+	// sender's timeout
+	stopPing := func() {}
+	if ack.Keepalive {
+		stopPing = keepalive(dataStream, pingTimeout(r.timeout(), ack.TimeoutMs))
+	}
+	defer stopPing()
 
 	if r.OnConfirmation != nil {
 		if !r.OnConfirmation(manifest) {
+			stopPing()
 			WriteMessage(dataStream, &Message{Type: MsgError, Payload: []byte("Transfer rejected by receiver")})
-			return fmt.Errorf("transfer rejected by user")
+			return rejectedError("", errors.New("transfer rejected by user"))
 		}
 	}
 
-	destFolder := filepath.Join(r.DestPath, manifest.FolderName)
-	cleanDestPath := filepath.Clean(r.DestPath)
-	cleanDestFolder := filepath.Clean(destFolder)
+	if r.FolderName != "" && !validFolderName(r.FolderName) {
+		stopPing()
+		WriteMessage(dataStream, &Message{Type: MsgError, Payload: []byte("Transfer rejected by receiver")})
+		return validationError("", fmt.Errorf("invalid folder name: %s", r.FolderName))
+	}
+	var skipped []string
+	for path := range r.Skip {
+		if r.entries[path] != nil {
+			delete(r.entries, path)
+			skipped = append(skipped, path)
+		}
+	}
+	sort.Strings(skipped)
+
+	r.names = new(nameResolver)
+	if r.RenameExisting && r.Storage == nil {
+		r.pickFreeName()
+	}
+	destFolder := r.LocalFolder()
+	r.Renamed = make(map[string]string)
+	if name := localName(manifest.FolderName); r.Storage == nil && name != filepath.FromSlash(manifest.FolderName) {
+		r.Renamed[manifest.FolderName] = filepath.ToSlash(name)
+	}
 
 	// Validate destination folder is within allowed path
-	if !strings.HasPrefix(cleanDestFolder+string(os.PathSeparator), cleanDestPath+string(os.PathSeparator)) {
-		return fmt.Errorf("invalid folder name: %s", manifest.FolderName)
+	if r.Storage == nil {
+		if err := validatePath(destFolder, r.DestPath); err != nil {
+			return validationError("invalid folder name: "+manifest.FolderName, err)
+		}
+	}
+
+	// Two files under one name would overwrite each other
+	if a, b, ok := collidingNames(manifest.Files, r.Skip); r.Storage == nil && ok {
+		return validationError("", fmt.Errorf("%s and %s would be saved under the same name on this system", a, b))
 	}
 
 	resumeOffsets := make(map[string]int64)
 	var existingSize int64
+	notReceived := len(skipped)
+	r.segmented = r.SegmentSize > 0 && r.Storage == nil && r.Encryption == nil
+	r.claimed = make(map[string][]int)
+	var claimedHashes []string
+	r.identical = make(map[string]bool)
 
 	for _, file := range manifest.Files {
-		localPath := filepath.Join(destFolder, filepath.FromSlash(file.Path))
+		if r.Skip[file.Path] {
+			continue
+		}
+		// Storage takes the sender's names as they are, and files are
+		// always received from the start
+		if r.Storage != nil {
+			if _, err := r.objectPath(file.Path); err != nil {
+				return validationError("invalid file path in manifest: "+file.Path, err)
+			}
+			continue
+		}
+		name := localName(file.Path)
+		if name != filepath.FromSlash(file.Path) {
+			r.Renamed[file.Path] = filepath.ToSlash(name)
+		}
+		localPath := r.names.resolve(filepath.Join(destFolder, name))
 
 		// Validate path before checking if file exists
 		if err := validatePath(localPath, destFolder); err != nil {
-			return fmt.Errorf("invalid file path in manifest: %s: %w", file.Path, err)
+			return validationError("invalid file path in manifest: "+file.Path, err)
+		}
+
+		// Encrypted files cannot be checked against the manifest's block
+		// hashes, so they are always received from the start
+		if r.Encryption != nil {
+			continue
 		}
 
-		offset, _ := r.verifyLocalFile(localPath, file)
+		var offset int64
+		if r.matchesChecksum(localPath, file) {
+			r.identical[file.Path] = true
+			offset = file.Size
+		} else {
+			offset, _ = r.verifyLocalFile(localPath, file)
+		}
+		if offset == file.Size && offset > 0 {
+			removeJournal(longPath(localPath))
+		}
 		if offset > 0 {
 			resumeOffsets[file.Path] = offset
 			existingSize += offset
 		}
+		if offset == file.Size && offset > 0 {
+			notReceived++
+		}
+		if r.BlockStore != nil && !r.segmented && offset < file.Size {
+			if claimed := r.BlockStore.Claim(&file, offset); len(claimed) > 0 {
+				r.claimed[file.Path] = claimed
+				for _, i := range claimed {
+					claimedHashes = append(claimedHashes, file.BlockHashes[i])
+				}
+			}
+		}
+	}
+	if len(claimedHashes) > 0 {
+		// Blocks that cannot be kept from trimming are received instead
+		if release, err := r.BlockStore.keep(claimedHashes); err == nil {
+			defer release()
+		} else {
+			clear(r.claimed)
+		}
+	}
+
+	if r.Storage == nil {
+		// Checked again, the user may have taken a while to confirm
+		if err := validatePath(destFolder, r.DestPath); err != nil {
+			return validationError("invalid folder name: "+manifest.FolderName, err)
+		}
+		if err := os.MkdirAll(longPath(destFolder), 0755); err != nil {
+			return fmt.Errorf("failed to create destination folder: %w", err)
+		}
 	}
 
-	if err := os.MkdirAll(destFolder, 0755); err != nil {
-		return fmt.Errorf("failed to create destination folder: %w", err)
+	r.done.Store(existingSize)
+
+	resumeMsg := ResumeMsg{Files: resumeOffsets, Skip: skipped, ProgressAck: ack.ProgressAck}
+	if len(r.claimed) > 0 {
+		resumeMsg.Blocks = r.claimed
+	}
+	if r.segmented {
+		resumeMsg.SegmentSize = max(r.SegmentSize, MinSegmentSize)
+	}
+	var data io.ReadWriteCloser
+	if ack.DataStream && r.DataStream != nil {
+		token := make([]byte, DataTokenSize)
+		if _, err = rand.Read(token); err == nil {
+			data, err = r.DataStream(ctx, token)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to open data stream, receiving on the main stream: %v\n", err)
+			data = nil
+		} else {
+			defer data.Close()
+			stopData := watchContext(ctx, data, nil)
+			defer stopData()
+			resumeMsg.DataStream = true
+			resumeMsg.DataToken = token
+		}
 	}
 
-	resumeMsg := ResumeMsg{Files: resumeOffsets}
 	resumeData, err := json.Marshal(resumeMsg)
 	if err != nil {
 		return err
 	}
+	stopPing()
 	if err := WriteMessage(dataStream, &Message{Type: MsgResume, Payload: resumeData}); err != nil {
 		return fmt.Errorf("failed to send resume message: %w", err)
 	}
+	r.tally.begin(existingSize)
+	r.tally.skipped.Store(int64(notReceived))
+	r.Audit.Record(AuditEvent{Event: AuditHandshake, Size: manifest.TotalSize, Offset: existingSize, Checksum: manifestHash, Options: map[string]interface{}{
+		"folder":      manifest.FolderName,
+		"files":       len(r.entries),
+		"skipped":     len(skipped),
+		"compress":    ack.Compress,
+		"password":    nonce != nil,
+		"dataStream":  resumeMsg.DataStream,
+		"progressAck": resumeMsg.ProgressAck,
+		"segmentSize": resumeMsg.SegmentSize,
+		"blocks":      len(r.claimed),
+		"encrypted":   r.Encryption != nil,
+	}})
+
+	var files io.Reader = dataStream
+	if data != nil {
+		// The sender sets up compression of the data stream only after the
+		// resume message, so this waits for it
+		compressed, err := wrapDataStream(data, ack.Compress, 0, r.timeout())
+		if err != nil {
+			return err
+		}
+		defer compressed.Close()
+		files = compressed
+		r.setControl(dataStream)
+	}
+	defer func() { r.Compression = compressionOf(dataStream, files) }()
+	if ack.ProgressAck {
+		r.acks = dataStream
+	}
 
 	bufferedStream := &BufferedDeadlineReader{
-		Reader:     bufio.NewReaderSize(dataStream, 1024*1024),
-		Underlying: dataStream,
+		Reader:     bufio.NewReaderSize(files, 1024*1024),
+		Underlying: files,
 	}
 
-	fileCount := 0
+	r.fileIndex = 0
+	r.segment = nil
 	for {
-		SetStreamDeadline(stream, StreamTimeout)
+		SetStreamDeadline(files, r.timeout())
 		msg, err := ReadMessage(bufferedStream)
 		if err != nil {
 			return fmt.Errorf("failed to read message: %w", err)
@@ -142,24 +511,144 @@ func (r *Receiver) Receive(stream io.ReadWriteCloser) error {
 
 		switch msg.Type {
 		case MsgFileStart:
-			fileCount++
-			if err := r.receiveFile(bufferedStream, msg, destFolder, fileCount, len(manifest.Files)); err != nil {
+			if err := r.receiveFile(ctx, bufferedStream, msg, destFolder); err != nil {
 				return err
 			}
+			if r.draining() {
+				r.notifyCancel()
+				return cancelledError(ErrDrained)
+			}
 
 		case MsgComplete:
+			r.setControl(nil)
+			r.acks = nil
+			// The receipt vouches for every file of the manifest. Each file
+			// matched its checksum as it arrived, so a matching root covers
+			// the whole transfer.
+			if len(skipped) == 0 {
+				if err := manifest.VerifyRoot(); err != nil {
+					WriteMessage(dataStream, &Message{Type: MsgError, Payload: []byte("Fingerprint mismatch")})
+					return err
+				}
+				r.Verified = manifest.Root != ""
+				r.sendReceipt(dataStream, manifestHash)
+			}
+			// Every file was verified as it arrived
+			if err := WriteMessage(dataStream, &Message{Type: MsgCompleteAck}); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to acknowledge completion: %v\n", err)
+			}
+			if r.Checksums != "" {
+				if err := r.writeChecksums(destFolder); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: failed to write checksum file: %v\n", err)
+				}
+			}
 			return nil
 
 		case MsgError:
-			return fmt.Errorf("sender error: %s", string(msg.Payload))
+			return protocolError("sender error", errors.New(string(msg.Payload)))
+
+		case MsgPong:
+			// Answers to pings sent before the resume message
 
 		default:
-			return fmt.Errorf("unexpected message type: %d", msg.Type)
+			return protocolError("", fmt.Errorf("unexpected message type: %d", msg.Type))
 		}
 	}
 }
 
+// answerChallenge proves knowledge of the password to the sender
+func (r *Receiver) answerChallenge(stream io.Writer, msg *Message) (key, nonce []byte, err error) {
+	if r.Password == "" {
+		WriteMessage(stream, &Message{Type: MsgError, Payload: []byte("password required")})
+		return nil, nil, rejectedError("", errors.New("sender requires a password"))
+	}
+
+	var challenge ChallengeMsg
+	if err := json.Unmarshal(msg.Payload, &challenge); err != nil {
+		return nil, nil, protocolError("invalid challenge", err)
+	}
+	if len(challenge.Nonce) != nonceSize {
+		return nil, nil, protocolError("", errors.New("invalid challenge nonce"))
+	}
+
+	key = passwordKey(r.Code, r.Password)
+	data, err := json.Marshal(ChallengeResponseMsg{Proof: passwordProof(key, challenge.Nonce, roleReceiver)})
+	if err != nil {
+		return nil, nil, protocolError("failed to marshal challenge response", err)
+	}
+	if err := WriteMessage(stream, &Message{Type: MsgChallengeResponse, Payload: data}); err != nil {
+		return nil, nil, fmt.Errorf("failed to send challenge response: %w", err)
+	}
+	return key, challenge.Nonce, nil
+}
+
+// answerCode checks the sender's proof in msg that it knows the code, for
+// nonce and its own, and then proves the same. An impostor is refused
+// before it learns anything about the code.
+func (r *Receiver) answerCode(stream io.Writer, msg *Message, nonce []byte) error {
+	var challenge CodeChallengeMsg
+	if err := json.Unmarshal(msg.Payload, &challenge); err != nil {
+		return protocolError("invalid code challenge", err)
+	}
+	if len(challenge.Nonce) != nonceSize || len(challenge.Salt) != nonceSize {
+		return protocolError("", errors.New("invalid code challenge nonce"))
+	}
+
+	key := codeKey(r.Code, challenge.Salt)
+	if !validCodeProof(challenge.Proof, key, nonce, challenge.Nonce, roleSender) {
+		WriteMessage(stream, &Message{Type: MsgError, Payload: []byte("invalid connection code")})
+		return validationError("", errors.New("sender does not know the code"))
+	}
+	data, err := json.Marshal(ChallengeResponseMsg{Proof: codeProof(key, nonce, challenge.Nonce, roleReceiver)})
+	if err != nil {
+		return protocolError("failed to marshal code response", err)
+	}
+	if err := WriteMessage(stream, &Message{Type: MsgCodeResponse, Payload: data}); err != nil {
+		return fmt.Errorf("failed to send code response: %w", err)
+	}
+	return nil
+}
+
+// Received returns how many bytes of the transfer are on disk, including
+// what was there before it resumed
+func (r *Receiver) Received() int64 {
+	return r.done.Load()
+}
+
+// Root returns the Merkle root of the received files, empty unless it was
+// verified
+func (r *Receiver) Root() string {
+	if !r.Verified {
+		return ""
+	}
+	return r.Manifest.Root
+}
+
+// sendReceipt signs and sends proof of delivery. Older senders simply close
+// the stream, so a failed write only means no receipt is recorded.
+func (r *Receiver) sendReceipt(stream io.Writer, manifestHash string) {
+	if r.Identity == nil {
+		return
+	}
+
+	receipt, err := SignReceipt(r.Identity, manifestHash, r.Manifest.Root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to create receipt: %v\n", err)
+		return
+	}
+	data, err := json.Marshal(receipt)
+	if err != nil {
+		return
+	}
+	if err := WriteMessage(stream, &Message{Type: MsgReceipt, Payload: data}); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to send receipt: %v\n", err)
+		return
+	}
+	r.Receipt = receipt
+}
+
 func (r *Receiver) verifyLocalFile(path string, entry FileEntry) (int64, error) {
+	path = longPath(path)
 	info, err := os.Stat(path)
 	if err != nil {
 		return 0, err
@@ -172,10 +661,18 @@ func (r *Receiver) verifyLocalFile(path string, entry FileEntry) (int64, error)
 		return info.Size(), nil
 	}
 
+	// Data up to the journal's offset was synced, what follows may be
+	// garbage after a crash
+	journaled, hasJournal := readJournal(path, entry)
+	journaled = min(journaled, info.Size())
+
 	if len(entry.BlockHashes) == 0 {
 		if info.Size() > entry.Size {
 			return 0, nil
 		}
+		if hasJournal {
+			return journaled, nil
+		}
 		return info.Size(), nil
 	}
 
@@ -190,7 +687,9 @@ func (r *Receiver) verifyLocalFile(path string, entry FileEntry) (int64, error)
 	}
 	defer f.Close()
 
-	buf := make([]byte, blockSize)
+	pooled := getBlock(blockSize)
+	defer putBlock(pooled)
+	buf := *pooled
 	var validatedOffset int64
 
 	for _, expectedHash := range entry.BlockHashes {
@@ -219,25 +718,111 @@ func (r *Receiver) verifyLocalFile(path string, entry FileEntry) (int64, error)
 		}
 	}
 
+	// A block is only checked once complete, the journal vouches for the
+	// synced part of the one after the verified ones
+	if hasJournal && journaled > validatedOffset && journaled < validatedOffset+blockSize {
+		return journaled, nil
+	}
 	return validatedOffset, nil
 }
 
-func (r *Receiver) receiveFile(stream io.Reader, startMsg *Message, destFolder string, current, total int) error {
+// matchesChecksum reports whether the file at path has the full size and
+// checksum of entry, so it need not be checked block by block
+func (r *Receiver) matchesChecksum(path string, entry FileEntry) bool {
+	if r.Paranoid || r.FastResume || entry.Checksum == "" || entry.Size == 0 {
+		return false
+	}
+	path = longPath(path)
+	if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() || info.Size() != entry.Size {
+		return false
+	}
+	return hasChecksum(path, entry.Checksum)
+}
+
+// hasChecksum reports whether the BLAKE3 checksum of the file at path is
+// checksum
+func hasChecksum(path, checksum string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	hasher := blake3.New(32, nil)
+	if _, err := io.Copy(hasher, f); err != nil {
+		return false
+	}
+	return hex.EncodeToString(hasher.Sum(nil)) == checksum
+}
+
+// segmentState carries the hashes of a file over to its next segment
+type segmentState struct {
+	path     string
+	end      int64 // Where the next segment starts
+	hasher   hash.Hash
+	sum      hash.Hash
+	verified bool      // Every segment so far matched its checksum
+	started  time.Time // When the first segment started
+	offset   int64     // Where the first segment started
+}
+
+func (r *Receiver) receiveFile(ctx context.Context, stream io.Reader, startMsg *Message, destFolder string) (err error) {
 	var fileStart FileStartMsg
 	if err := json.Unmarshal(startMsg.Payload, &fileStart); err != nil {
-		return err
+		return protocolError("invalid file start message", err)
 	}
 
-	var entry *FileEntry
-	for i := range r.Manifest.Files {
-		if r.Manifest.Files[i].Path == fileStart.Path {
-			entry = &r.Manifest.Files[i]
-			break
+	entry := r.entries[fileStart.Path]
+	// Only files announced in the manifest are written, with its size
+	if entry == nil {
+		return protocolError("", fmt.Errorf("file not in manifest: %s", fileStart.Path))
+	}
+	if fileStart.Size != entry.Size || fileStart.Offset < 0 || fileStart.Offset > fileStart.Size {
+		return protocolError("", fmt.Errorf("invalid file start for %s: offset %d, size %d", fileStart.Path, fileStart.Offset, fileStart.Size))
+	}
+	length := fileStart.Size - fileStart.Offset
+	if fileStart.Length != 0 {
+		if !r.segmented || fileStart.Length < 0 || fileStart.Length > length {
+			return protocolError("", fmt.Errorf("invalid segment of %s: offset %d, length %d", fileStart.Path, fileStart.Offset, fileStart.Length))
+		}
+		length = fileStart.Length
+	}
+	last := fileStart.Offset+length == fileStart.Size
+
+	// The next segment of a file continues it, with the hashes so far
+	prev := r.segment
+	r.segment = nil
+	if prev != nil && (prev.path != fileStart.Path || prev.end != fileStart.Offset) {
+		prev = nil
+	}
+	started, resumed := time.Now(), fileStart.Offset
+	if prev != nil {
+		started, resumed = prev.started, prev.offset
+	} else {
+		r.fileIndex++
+		if r.OnStartFile != nil {
+			r.OnStartFile(fileStart.Path, r.fileIndex, len(r.entries))
 		}
 	}
 
-	if r.OnStartFile != nil {
-		r.OnStartFile(fileStart.Path, current, total)
+	var verified bool
+	var checksum string // Of the file received, if verified against the manifest's
+	var rejected error  // Of a file the scan rejected and the transfer goes on without
+	if fileStart.Offset < fileStart.Size {
+		defer func() {
+			if err == nil && !last {
+				return
+			}
+			failed := err
+			if failed == nil {
+				failed = rejected
+			}
+			r.tally.fileDone(failed)
+			if r.OnFileComplete != nil {
+				r.OnFileComplete(fileStart.Path, verified, failed)
+			}
+			r.Audit.Record(AuditEvent{Event: AuditFile, Path: fileStart.Path, Size: fileStart.Size, Offset: resumed, Checksum: checksum,
+				Verified: verified, Seconds: time.Since(started).Seconds(), Error: AuditError(failed)})
+		}()
 	}
 
 	if fileStart.Offset == fileStart.Size {
@@ -247,39 +832,387 @@ func (r *Receiver) receiveFile(stream io.Reader, startMsg *Message, destFolder s
 			return fmt.Errorf("failed to read end message: %w", err)
 		}
 		if endMsg.Type != MsgFileEnd {
-			return fmt.Errorf("expected file end message, got %d", endMsg.Type)
+			return protocolError("", fmt.Errorf("expected file end message, got %d", endMsg.Type))
+		}
+		if r.identical[fileStart.Path] {
+			if r.OnFileComplete != nil {
+				r.OnFileComplete(fileStart.Path, true, nil)
+			}
+			r.Audit.Record(AuditEvent{Event: AuditFile, Path: fileStart.Path, Size: fileStart.Size, Offset: fileStart.Size,
+				Checksum: entry.Checksum, Verified: true})
+		} else if fileStart.Size == 0 {
+			r.tally.fileDone(nil)
 		}
 		return nil
 	}
 
-	filePath := filepath.Join(destFolder, filepath.FromSlash(fileStart.Path))
+	var hasher hash.Hash = blake3.New(32, nil)
+	// The checksum file's hash, unless that is the one verified anyway
+	var sum hash.Hash
+	if r.Checksums == ChecksumSHA256 {
+		sum = newChecksum(r.Checksums)
+	}
+	if prev != nil {
+		hasher, sum = prev.hasher, prev.sum
+	}
+	var out io.Writer
+	var file *os.File
+	var direct *directWriter
+	var object io.WriteCloser
+	var progress *journal
+	if r.Storage != nil {
+		if fileStart.Offset > 0 {
+			return protocolError("", errors.New("cannot resume a file in storage"))
+		}
+		name, err := r.objectPath(fileStart.Path)
+		if err != nil {
+			return validationError("invalid file path in manifest: "+fileStart.Path, err)
+		}
+		if r.Encryption != nil {
+			name += EncryptedExt
+		}
+		object, err = r.Storage.Open(name)
+		if err != nil {
+			return fmt.Errorf("failed to store %s: %w", fileStart.Path, err)
+		}
+		// Only verified files are kept, see the end of this function
+		defer func() {
+			if object != nil {
+				storage.Abort(object)
+			}
+		}()
+		out = object
+	} else {
+		// The data before a segment was hashed with the one before it
+		var existing io.Writer
+		if prev == nil {
+			existing = hasher
+			if sum != nil {
+				existing = io.MultiWriter(hasher, sum)
+			}
+		}
+		file, err = r.openLocalFile(destFolder, &fileStart, existing)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if prev == nil && r.Encryption == nil && !r.NoPreallocate {
+			if err := preallocate(file, fileStart.Size); err != nil {
+				return fmt.Errorf("failed to allocate space for %s: %w", fileStart.Path, err)
+			}
+		}
+		out = file
+		if r.DirectIO && r.Encryption == nil {
+			if d, err := newDirectWriter(file, fileStart.Offset); err == nil {
+				direct = d
+				defer direct.Close()
+				out = direct
+			}
+		}
+		if r.Encryption == nil && r.journalInterval() > 0 {
+			progress = newJournal(file, entry, fileStart.Offset, r.journalInterval())
+		}
+	}
+	var encrypted io.WriteCloser
+	if r.Encryption != nil {
+		encrypted, err = r.Encryption.NewWriter(out)
+		if err != nil {
+			return fmt.Errorf("failed to initialize encryption: %w", err)
+		}
+		defer encrypted.Close()
+		out = encrypted
+	}
+	writers := []io.Writer{out, hasher}
+	if sum != nil {
+		writers = append(writers, sum)
+	}
+	var crcs *frameCRC
+	var segment hash.Hash
+	if fileStart.Length != 0 {
+		segment = blake3.New(32, nil)
+		writers = append(writers, segment)
+	} else if entry.Checksum == "" {
+		crcs = new(frameCRC)
+		writers = append(writers, crcs)
+	}
+	multiWriter := io.MultiWriter(writers...)
+
+	remaining := length
+	timeoutStream := &TimeoutReader{R: stream, Timeout: r.timeout()}
+	var src io.Reader = io.LimitReader(timeoutStream, remaining)
+	if claimed := r.claimed[fileStart.Path]; len(claimed) > 0 && fileStart.Length == 0 {
+		if !validClaims(entry, fileStart.Offset, claimed) {
+			return protocolError("", fmt.Errorf("%s resumed at %d before the blocks claimed", fileStart.Path, fileStart.Offset))
+		}
+		blocks := newClaimReader(io.LimitReader(timeoutStream, remaining-claimedBytes(entry, claimed)), r.BlockStore, entry, fileStart.Offset, claimed)
+		defer blocks.Close()
+		src = io.LimitReader(blocks, remaining)
+	}
+	var counted int64
+	copied, readErr, writeErr := copyChunks(ctx, multiWriter, src, func(copied int64) {
+		r.done.Add(copied - counted)
+		counted = copied
+		if r.OnProgress != nil {
+			r.OnProgress(fileStart.Path, fileStart.Offset+copied, fileStart.Size)
+		}
+		r.ackProgress(ProgressAckMsg{Path: fileStart.Path, Offset: fileStart.Offset + copied}, false)
+		// Segments are only recorded once they were checked, and only what
+		// was written is recorded
+		if segment == nil && direct == nil {
+			progress.update(fileStart.Offset + copied)
+		} else if segment == nil {
+			progress.update(direct.pos)
+		}
+	})
+	if direct != nil {
+		if err := direct.Flush(); err != nil && writeErr == nil {
+			writeErr = err
+		}
+	}
+	if writeErr != nil {
+		return fmt.Errorf("failed to write file data: %w", writeErr)
+	}
+	if readErr != nil {
+		// What arrived is kept for resuming, cancelled or not
+		if segment == nil {
+			progress.flush(fileStart.Offset + copied)
+		}
+		if CategoryOf(readErr) == CategoryCancelled {
+			return readErr
+		}
+		return networkError("failed to read file data", readErr)
+	}
+	remaining -= copied
 
-	// Validate path to prevent directory traversal and symlink attacks
-	if err := validatePath(filePath, destFolder); err != nil {
-		return fmt.Errorf("invalid file path (directory traversal detected): %s: %w", fileStart.Path, err)
+	if remaining != 0 {
+		return networkError("", fmt.Errorf("read %d of %d bytes: %w", length-remaining, length, io.ErrUnexpectedEOF))
 	}
 
-	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
-		return fmt.Errorf("failed to create directory for %s: %w", filePath, err)
+	if encrypted != nil {
+		if err := encrypted.Close(); err != nil {
+			return fmt.Errorf("failed to write file data: %w", err)
+		}
 	}
 
-	hasher := blake3.New(32, nil)
+	endMsg, err := ReadMessage(stream)
+	if err != nil {
+		return fmt.Errorf("failed to read end message: %w", err)
+	}
+	if endMsg.Type != MsgFileEnd {
+		return protocolError("", fmt.Errorf("expected file end message, got %d", endMsg.Type))
+	}
 
-	if fileStart.Offset > 0 {
-		f, err := os.Open(filePath)
+	segmentVerified := prev == nil || prev.verified
+	if segment != nil {
+		ok, err := checkSegment(file, &fileStart, endMsg, segment)
 		if err != nil {
-			return fmt.Errorf("failed to open existing file for hashing: %w", err)
+			return err
+		}
+		segmentVerified = segmentVerified && ok
+	}
+	if !last {
+		// Acknowledged once on disk, so a retry resumes after it
+		if progress != nil {
+			progress.flush(fileStart.Offset + length)
+		} else if err := file.Sync(); err != nil {
+			return fmt.Errorf("failed to write file data: %w", err)
+		}
+		r.segment = &segmentState{path: fileStart.Path, end: fileStart.Offset + length, hasher: hasher, sum: sum, verified: segmentVerified, started: started, offset: resumed}
+		r.ackProgress(ProgressAckMsg{Path: fileStart.Path, Offset: fileStart.Offset + length}, true)
+		return nil
+	}
+
+	// Verify checksum if available
+	if entry != nil {
+		if entry.Checksum == "" {
+			if fileStart.Length != 0 {
+				verified = segmentVerified
+			} else if verified, err = checkFrames(file, &fileStart, endMsg, crcs, encrypted != nil); err != nil {
+				return err
+			}
+			if !verified {
+				// Warn if checksum is missing - this could indicate an integrity issue
+				fmt.Fprintf(os.Stderr, "Warning: no checksum available for %s, cannot verify integrity\n", fileStart.Path)
+			}
+		} else {
+			actualHash := hex.EncodeToString(hasher.Sum(nil))
+			if actualHash != entry.Checksum {
+				return validationError("", fmt.Errorf("checksum mismatch for %s: expected %s, got %s", fileStart.Path, entry.Checksum, actualHash))
+			}
+			verified = true
+			checksum = actualHash
+		}
+	}
+
+	if r.Scan != nil && file != nil && encrypted == nil {
+		if rejected, err = r.scan(file, fileStart.Path); err != nil || rejected != nil {
+			progress.remove()
+			verified = false
+			if err == nil {
+				r.ackProgress(ProgressAckMsg{Path: fileStart.Path, Offset: fileStart.Size, Complete: true}, true)
+			}
+			return err
+		}
+	}
+	if r.Quarantine && file != nil && encrypted == nil && IsExecutable(*entry) {
+		if err := quarantine(file.Name()); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to quarantine %s: %v\n", fileStart.Path, err)
+		}
+	}
+	if checksum != "" && r.BlockStore != nil && file != nil && encrypted == nil && len(entry.BlockHashes) > 0 {
+		if err := r.BlockStore.PutFile(file.Name(), entry); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to store blocks of %s: %v\n", fileStart.Path, err)
+		}
+	}
+
+	if object != nil {
+		err := object.Close()
+		object = nil
+		if err != nil {
+			return fmt.Errorf("failed to store %s: %w", fileStart.Path, err)
+		}
+	}
+	if r.Sync == SyncFile && file != nil {
+		if err := file.Sync(); err != nil {
+			return fmt.Errorf("failed to write file data: %w", err)
+		}
+	}
+
+	progress.remove()
+	if r.Checksums != "" {
+		if sum == nil {
+			sum = hasher
+		}
+		r.sums[fileStart.Path] = hex.EncodeToString(sum.Sum(nil))
+	}
+	if file != nil {
+		r.saved[fileStart.Path] = file.Name()
+	}
+	r.ackProgress(ProgressAckMsg{Path: fileStart.Path, Offset: fileStart.Size, Complete: true, Verified: verified}, true)
+	return nil
+}
+
+// scan runs Scan on the received file of path. A file it rejects is moved
+// to RejectedDir and returned as rejected, or removed and returned as err
+// without one.
+func (r *Receiver) scan(file *os.File, path string) (rejected, err error) {
+	local := file.Name()
+	scanErr := r.Scan(local)
+	if scanErr == nil {
+		r.Audit.Record(AuditEvent{Event: AuditScan, Path: path})
+		return nil, nil
+	}
+	file.Close()
+	if r.RejectedDir == "" {
+		os.Remove(local)
+		r.Audit.Record(AuditEvent{Event: AuditScan, Path: path, Error: scanErr.Error(), Options: map[string]interface{}{"removed": true}})
+		return nil, rejectedError("", fmt.Errorf("%s: %w", path, scanErr))
+	}
+	folder := r.LocalFolder()
+	rel, relErr := filepath.Rel(folder, local)
+	if relErr != nil {
+		rel = filepath.Base(local)
+	}
+	dest := filepath.Join(r.RejectedDir, time.Now().Format("20060102-150405"), filepath.Base(folder), rel)
+	moveErr := os.MkdirAll(filepath.Dir(dest), 0700)
+	if moveErr == nil {
+		moveErr = moveFile(local, dest)
+	}
+	if moveErr != nil {
+		os.Remove(local)
+		dest = ""
+	}
+	r.Audit.Record(AuditEvent{Event: AuditScan, Path: path, Error: scanErr.Error(), Options: map[string]interface{}{"removed": dest == "", "movedTo": dest}})
+	if dest == "" {
+		return fmt.Errorf("%s: %w, removed", path, scanErr), nil
+	}
+	return fmt.Errorf("%s: %w, moved to %s", path, scanErr, dest), nil
+}
+
+// moveFile renames src to dst, copying it and removing src if they are on
+// different filesystems
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || !crossDevice(err) {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	in.Close()
+	return os.Remove(src)
+}
+
+// journalInterval is how often the progress journal is written, -1 if
+// there is none
+func (r *Receiver) journalInterval() int64 {
+	if r.Sync == SyncNever {
+		return -1
+	}
+	if r.JournalInterval == 0 {
+		return DefaultJournalInterval
+	}
+	return r.JournalInterval
+}
+
+// openLocalFile opens the file of start in destFolder for writing at its
+// offset, adding the data already there to hasher
+func (r *Receiver) openLocalFile(destFolder string, start *FileStartMsg, hasher io.Writer) (*os.File, error) {
+	filePath := r.names.resolve(filepath.Join(destFolder, localName(start.Path)))
+	if r.Encryption != nil {
+		if start.Offset > 0 {
+			return nil, protocolError("", errors.New("cannot resume an encrypted file"))
+		}
+		filePath += EncryptedExt
+	}
+
+	// Validate path to prevent directory traversal and symlink attacks
+	if err := validatePath(filepath.Dir(filePath), destFolder); err != nil {
+		return nil, validationError("invalid file path (directory traversal detected): "+start.Path, err)
+	}
+	if err := os.MkdirAll(longPath(filepath.Dir(filePath)), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory for %s: %w", filePath, err)
+	}
+	// Checked again now that its folders exist, including the file itself
+	// in case it is a symlink
+	if err := validatePath(filePath, destFolder); err != nil {
+		return nil, validationError("invalid file path (directory traversal detected): "+start.Path, err)
+	}
+
+	if start.Offset > 0 && hasher != nil {
+		f, err := os.Open(longPath(filePath))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open existing file for hashing: %w", err)
 		}
 		// Read only up to offset
-		if _, err := io.CopyN(hasher, f, fileStart.Offset); err != nil {
+		if _, err := io.CopyN(hasher, f, start.Offset); err != nil {
 			f.Close()
-			return fmt.Errorf("failed to hash existing content: %w", err)
+			return nil, fmt.Errorf("failed to hash existing content: %w", err)
 		}
 		f.Close()
 	}
 
 	flags := os.O_CREATE | os.O_WRONLY
-	if fileStart.Offset > 0 {
+	if start.Offset > 0 {
 		flags |= os.O_APPEND
 	} else {
 		flags |= os.O_TRUNC
@@ -288,168 +1221,222 @@ func (r *Receiver) receiveFile(stream io.Reader, startMsg *Message, destFolder s
 	// Create file with restrictive permissions (owner read/write only)
 	// On Windows, the permission bits are ignored, but on Unix this prevents
 	// other users from reading the received files
-	file, err := os.OpenFile(filePath, flags, 0600)
+	file, err := os.OpenFile(longPath(filePath), flags, 0600)
 	if err != nil {
-		return fmt.Errorf("failed to open file %s: %w", filePath, err)
+		return nil, fmt.Errorf("failed to open file %s: %w", filePath, err)
 	}
-	defer file.Close()
 
-	if fileStart.Offset > 0 {
+	if start.Offset > 0 {
 		pos, err := file.Seek(0, io.SeekEnd)
 		if err != nil {
-			return err
+			file.Close()
+			return nil, err
 		}
-		if pos != fileStart.Offset {
-			if err := file.Truncate(fileStart.Offset); err != nil {
-				return err
+		if pos != start.Offset {
+			if err := file.Truncate(start.Offset); err != nil {
+				file.Close()
+				return nil, err
 			}
 		}
 	}
 
-	remaining := fileStart.Size - fileStart.Offset
-	currentPos := fileStart.Offset
-
-	multiWriter := io.MultiWriter(file, hasher)
-
-	timeoutStream := &TimeoutReader{R: stream, Timeout: StreamTimeout}
-
-	buf := make([]byte, 256*1024)
-
-	for remaining > 0 {
-		toRead := int64(len(buf))
-		if toRead > remaining {
-			toRead = remaining
-		}
-
-		n, readErr := timeoutStream.Read(buf[:toRead])
-		if n > 0 {
-			written := 0
-			for written < n {
-				wn, writeErr := multiWriter.Write(buf[written:n])
-				if writeErr != nil {
-					return fmt.Errorf("failed to write file data: %w", writeErr)
-				}
-				if wn == 0 {
-					return fmt.Errorf("failed to write file data: zero bytes written")
-				}
-				written += wn
-			}
+	return file, nil
+}
 
-			currentPos += int64(n)
-			remaining -= int64(n)
+// objectPath returns the path of a manifest file in r.Storage. The sender
+// chooses the names, so they must not climb out of the destination.
+func (r *Receiver) objectPath(p string) (string, error) {
+	name := r.folderName() + "/" + p
+	if !fs.ValidPath(name) {
+		return "", errors.New("path traversal detected")
+	}
+	return name, nil
+}
 
-			if r.OnProgress != nil {
-				r.OnProgress(fileStart.Path, currentPos, fileStart.Size)
-			}
-		}
+// ackProgress sends ack to the sender, at most every ProgressAckInterval
+// unless forced. A failed write breaks the connection, which reading the
+// files then reports.
+func (r *Receiver) ackProgress(ack ProgressAckMsg, force bool) {
+	if r.acks == nil || !force && time.Since(r.lastAck) < ProgressAckInterval {
+		return
+	}
+	r.lastAck = time.Now()
+	data, err := json.Marshal(ack)
+	if err != nil {
+		return
+	}
+	r.controlMu.Lock()
+	defer r.controlMu.Unlock()
+	WriteMessage(r.acks, &Message{Type: MsgProgressAck, Payload: data})
+}
 
-		if readErr != nil {
-			if readErr == io.EOF {
-				break
-			}
-			return fmt.Errorf("failed to read file data: %w", readErr)
+// checkFrames compares the frame checksums in the file end message with the
+// data received. On a mismatch a local file is cut back to the last good
+// frame, so a retry resumes from there. Reports whether checksums were sent.
+func checkFrames(file *os.File, start *FileStartMsg, end *Message, crcs *frameCRC, encrypted bool) (bool, error) {
+	if len(end.Payload) == 0 {
+		return false, nil
+	}
+	var endMsg FileEndMsg
+	if err := json.Unmarshal(end.Payload, &endMsg); err != nil {
+		return false, protocolError("invalid file end message", err)
+	}
+	if endMsg.FrameCRCs == nil {
+		return false, nil
+	}
+	bad := firstBadFrame(crcs.Sums(), endMsg.FrameCRCs)
+	if bad < 0 {
+		return true, nil
+	}
+	good := start.Offset + int64(bad)*CRCFrameSize
+	if file != nil && !encrypted {
+		if err := file.Truncate(good); err != nil {
+			return false, fmt.Errorf("failed to discard corrupted data: %w", err)
 		}
 	}
+	return false, networkError("", fmt.Errorf("data of %s corrupted in transit after byte %d", start.Path, good))
+}
 
-	if remaining != 0 {
-		return fmt.Errorf("unexpected EOF: read %d of %d bytes", fileStart.Size-fileStart.Offset-remaining, fileStart.Size-fileStart.Offset)
+// checkSegment compares the checksum in the file end message of a segment
+// with the data received. On a mismatch a local file is cut back to where
+// the segment started. Reports whether a checksum was sent.
+func checkSegment(file *os.File, start *FileStartMsg, end *Message, segment hash.Hash) (bool, error) {
+	var endMsg FileEndMsg
+	if len(end.Payload) > 0 {
+		if err := json.Unmarshal(end.Payload, &endMsg); err != nil {
+			return false, protocolError("invalid file end message", err)
+		}
 	}
-
-	endMsg, err := ReadMessage(stream)
-	if err != nil {
-		return fmt.Errorf("failed to read end message: %w", err)
+	if endMsg.Checksum == "" {
+		return false, nil
 	}
-	if endMsg.Type != MsgFileEnd {
-		return fmt.Errorf("expected file end message, got %d", endMsg.Type)
+	if endMsg.Checksum == hex.EncodeToString(segment.Sum(nil)) {
+		return true, nil
 	}
-
-	// Verify checksum if available
-	if entry != nil {
-		if entry.Checksum == "" {
-			// Warn if checksum is missing - this could indicate an integrity issue
-			fmt.Fprintf(os.Stderr, "Warning: no checksum available for %s, cannot verify integrity\n", fileStart.Path)
-		} else {
-			actualHash := hex.EncodeToString(hasher.Sum(nil))
-			if actualHash != entry.Checksum {
-				return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", fileStart.Path, entry.Checksum, actualHash)
-			}
+	if file != nil {
+		if err := file.Truncate(start.Offset); err != nil {
+			return false, fmt.Errorf("failed to discard corrupted data: %w", err)
 		}
 	}
-
-	return nil
+	return false, networkError("", fmt.Errorf("data of %s corrupted in transit in the segment at byte %d", start.Path, start.Offset))
 }
 
-// validatePath checks if a file path is safe and within the allowed base directory
-// It protects against both path traversal and symlink attacks
-func validatePath(path, baseDir string) error {
-	// Clean both paths to normalize them
-	cleanPath := filepath.Clean(path)
-	cleanBase := filepath.Clean(baseDir)
-
-	// Ensure base ends with separator for proper prefix checking
-	if !strings.HasSuffix(cleanBase, string(os.PathSeparator)) {
-		cleanBase += string(os.PathSeparator)
+// LocalFolder returns the folder the transfer is saved in, once the manifest
+// was received. An existing folder whose name only differs in Unicode
+// normalization is reused. With Storage, it is DestPath and the folder
+// name joined with a slash.
+func (r *Receiver) LocalFolder() string {
+	if r.Manifest == nil {
+		return r.DestPath
 	}
-
-	// First check: simple prefix check
-	// Either path equals base (without separator) OR path starts with base (with separator)
-	pathWithSep := cleanPath
-	if !strings.HasSuffix(pathWithSep, string(os.PathSeparator)) {
-		pathWithSep += string(os.PathSeparator)
+	if r.Storage != nil {
+		return strings.TrimSuffix(r.DestPath, "/") + "/" + r.folderName()
 	}
+	return ResolveName(filepath.Join(r.DestPath, localName(r.folderName())))
+}
 
-	if !strings.HasPrefix(pathWithSep, cleanBase) && cleanPath != filepath.Clean(baseDir) {
-		return errors.New("path traversal detected")
-	}
+// LocalPath returns where the file filename of this transfer was saved,
+// empty if it was not received or went to Storage
+func (r *Receiver) LocalPath(filename string) string {
+	return r.saved[filename]
+}
 
-	// If file/directory exists, resolve symlinks and check again
-	resolvedPath, err := filepath.EvalSymlinks(path)
-	if err != nil {
-		// If file doesn't exist yet, check parent directory
-		if os.IsNotExist(err) {
-			parentDir := filepath.Dir(path)
-			if parentDir != path && parentDir != "." && parentDir != baseDir {
-				// Recursively check parent
-				return validatePath(parentDir, baseDir)
-			}
-			// Parent is base dir or at root - rely on simple check
-			return nil
+// pickFreeName sets FolderName to the first of the folder name, "name (2)",
+// "name (3)" and so on that is free for the transfer
+func (r *Receiver) pickFreeName() {
+	name := r.folderName()
+	for i := 1; i < 1000; i++ {
+		candidate := name
+		if i > 1 {
+			candidate = fmt.Sprintf("%s (%d)", name, i)
 		}
-		// Other errors (permission denied, etc.) - be permissive if file doesn't exist
-		if os.IsPermission(err) {
-			return nil
+		if r.freeFolder(ResolveName(filepath.Join(r.DestPath, localName(candidate)))) {
+			if i > 1 {
+				r.FolderName = candidate
+			}
+			return
 		}
-		return fmt.Errorf("failed to validate path: %w", err)
 	}
+}
 
-	// Resolve base directory symlinks too
-	resolvedBase, err := filepath.EvalSymlinks(baseDir)
+// freeFolder reports whether the transfer can be saved in folder: it does
+// not exist, is empty, or holds files of the transfer to resume. A folder
+// with the same name is only taken for the transfer if every manifest file
+// in it matches, so an unrelated folder is never written into.
+func (r *Receiver) freeFolder(folder string) bool {
+	entries, err := os.ReadDir(longPath(folder))
 	if err != nil {
+		return os.IsNotExist(err)
+	}
+	if len(entries) == 0 {
+		return true
+	}
+	found := false
+	for path, entry := range r.entries {
+		name := localName(path)
+		if r.Encryption != nil {
+			name += EncryptedExt
+		}
+		localPath := longPath(ResolveName(filepath.Join(folder, name)))
+		info, err := os.Lstat(localPath)
 		if os.IsNotExist(err) {
-			// Base directory doesn't exist yet, use cleaned version
-			resolvedBase = filepath.Clean(baseDir)
-		} else if !os.IsPermission(err) {
-			return fmt.Errorf("failed to resolve base directory: %w", err)
-		} else {
-			resolvedBase = filepath.Clean(baseDir)
+			continue
 		}
+		if err != nil || !info.Mode().IsRegular() || !r.matchesEntry(localPath, info.Size(), entry) {
+			return false
+		}
+		found = true
 	}
+	return found
+}
 
-	// Ensure resolved base has separator
-	if !strings.HasSuffix(resolvedBase, string(os.PathSeparator)) {
-		resolvedBase += string(os.PathSeparator)
+// matchesEntry reports whether the file at path of the given size looks
+// like a copy of entry from an earlier attempt: the whole file with the
+// manifest's checksum, or a partial one whose first block matches the
+// manifest's hash. The checksum is a leaf of the manifest's Merkle root, so
+// a file matching it matches the root too.
+func (r *Receiver) matchesEntry(path string, size int64, entry *FileEntry) bool {
+	// Encrypted files cannot be compared without the key they were
+	// written with, and files without a checksum not at all, so another
+	// file of the same size is never taken for them
+	if r.Encryption != nil {
+		return false
 	}
-
-	// Add separator to resolved path for checking
-	resolvedPathWithSep := resolvedPath
-	if !strings.HasSuffix(resolvedPathWithSep, string(os.PathSeparator)) {
-		resolvedPathWithSep += string(os.PathSeparator)
+	if size == entry.Size {
+		return entry.Checksum != "" && hasChecksum(path, entry.Checksum)
+	}
+	blockSize := entry.BlockSize
+	if blockSize == 0 {
+		blockSize = LegacyBlockSize
+	}
+	if size > entry.Size || size < blockSize || len(entry.BlockHashes) == 0 {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
 	}
+	defer f.Close()
+	pooled := getBlock(blockSize)
+	defer putBlock(pooled)
+	buf := *pooled
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return false
+	}
+	sum := blake3.Sum256(buf)
+	return hex.EncodeToString(sum[:]) == entry.BlockHashes[0]
+}
 
-	// Check resolved paths
-	if !strings.HasPrefix(resolvedPathWithSep, resolvedBase) && resolvedPath != filepath.Clean(baseDir) {
-		return errors.New("symlink attack detected: resolved path outside base directory")
+// folderName returns the name of the folder the transfer is saved in
+func (r *Receiver) folderName() string {
+	if r.FolderName != "" {
+		return r.FolderName
 	}
+	return r.Manifest.FolderName
+}
 
-	return nil
+// validFolderName reports whether name is a single path element that can
+// replace the manifest's folder name
+func validFolderName(name string) bool {
+	return name != "." && name != ".." && !strings.ContainsAny(name, `/\`) && filepath.Base(name) == name
 }
@@ -1,10 +1,16 @@
 package transfer
 
 import (
+	"context"
+	"encoding/hex"
+	"errors"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
+
+	"lukechampine.com/blake3"
 )
 
 func TestValidatePath(t *testing.T) {
@@ -94,6 +100,66 @@ func TestValidatePath_SymlinkAttack(t *testing.T) {
 	}
 }
 
+func TestValidatePath_DanglingSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping symlink test on Windows (requires admin privileges)")
+	}
+
+	tmpDir := t.TempDir()
+	baseDir := filepath.Join(tmpDir, "base")
+	os.MkdirAll(baseDir, 0755)
+
+	// Creating the file would create its target outside the base
+	link := filepath.Join(baseDir, "file.txt")
+	if err := os.Symlink(filepath.Join(tmpDir, "outside.txt"), link); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := validatePath(link, baseDir); err == nil {
+		t.Error("validatePath() should have rejected a dangling symlink")
+	}
+
+	// A symlinked base is fine as long as the path stays in its target
+	linkedBase := filepath.Join(tmpDir, "linked")
+	if err := os.Symlink(baseDir, linkedBase); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := validatePath(filepath.Join(linkedBase, "sub", "new.txt"), linkedBase); err != nil {
+		t.Errorf("validatePath() rejected a path in a symlinked base: %v", err)
+	}
+}
+
+// TestReceiveThroughSymlink checks that a symlink in the destination folder
+// does not lead received files out of it
+func TestReceiveThroughSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping symlink test on Windows (requires admin privileges)")
+	}
+
+	srcDir := filepath.Join(t.TempDir(), "photos")
+	os.MkdirAll(filepath.Join(srcDir, "sub"), 0755)
+	os.WriteFile(filepath.Join(srcDir, "sub", "a.txt"), []byte("alpha"), 0644)
+	sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.Code = "123-456"
+
+	destDir := t.TempDir()
+	outside := t.TempDir()
+	os.MkdirAll(filepath.Join(destDir, "photos"), 0755)
+	if err := os.Symlink(outside, filepath.Join(destDir, "photos", "sub")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	_, recvErr := splitTransfer(t, context.Background(), sender, destDir, nil)
+	if CategoryOf(recvErr) != CategoryValidation {
+		t.Errorf("receive error = %v, want validation", recvErr)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "a.txt")); err == nil {
+		t.Error("file was written through the symlink")
+	}
+}
+
 func TestValidatePath_NonExistentPath(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "receiver-test-*")
 	if err != nil {
@@ -164,3 +230,199 @@ func TestValidatePath_EdgeCases(t *testing.T) {
 		})
 	}
 }
+
+func TestObjectPath(t *testing.T) {
+	r := &Receiver{Manifest: &Manifest{FolderName: "photos"}}
+	cases := map[string]bool{
+		"a.jpg":        true,
+		"2024/b.jpg":   true,
+		"../a.jpg":     false,
+		"sub/../../x":  false,
+		"/etc/passwd":  false,
+		"sub//a.jpg":   false,
+		"./a.jpg":      false,
+		`sub\..\a.jpg`: true, // Only slashes separate object names
+	}
+	for p, valid := range cases {
+		name, err := r.objectPath(p)
+		if valid && (err != nil || name != "photos/"+p) {
+			t.Errorf("objectPath(%q) = %q, %v", p, name, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("objectPath(%q) = %q, want an error", p, name)
+		}
+	}
+
+	r.Manifest.FolderName = ".."
+	if _, err := r.objectPath("a.jpg"); err == nil {
+		t.Error("objectPath accepted a folder name climbing out of the destination")
+	}
+}
+
+func TestPickFreeName(t *testing.T) {
+	dest := t.TempDir()
+	sent := []byte("0123456789")
+	first := blake3.Sum256(sent[:4])
+	whole := blake3.Sum256([]byte("abc"))
+	r := &Receiver{DestPath: dest, Manifest: &Manifest{FolderName: "photos"}}
+	r.entries = map[string]*FileEntry{
+		"a.jpg": {Path: "a.jpg", Size: 10, BlockSize: 4, BlockHashes: []string{hex.EncodeToString(first[:])}},
+		"b.jpg": {Path: "b.jpg", Size: 3, Checksum: hex.EncodeToString(whole[:])},
+	}
+
+	pick := func() string {
+		r.FolderName = ""
+		r.pickFreeName()
+		return r.folderName()
+	}
+	if got := pick(); got != "photos" {
+		t.Errorf("without a folder picked %q", got)
+	}
+	os.Mkdir(filepath.Join(dest, "photos"), 0755)
+	if got := pick(); got != "photos" {
+		t.Errorf("with an empty folder picked %q", got)
+	}
+
+	// Unrelated files are not mixed in, a folder with a partial file is
+	// resumed
+	os.WriteFile(filepath.Join(dest, "photos", "other.jpg"), []byte("x"), 0644)
+	if got := pick(); got != "photos (2)" {
+		t.Errorf("with an unrelated folder picked %q", got)
+	}
+	os.Mkdir(filepath.Join(dest, "photos (2)"), 0755)
+	os.WriteFile(filepath.Join(dest, "photos (2)", "a.jpg"), sent[:6], 0644)
+	if got := pick(); got != "photos (2)" {
+		t.Errorf("with a partial transfer in photos (2) picked %q", got)
+	}
+	os.WriteFile(filepath.Join(dest, "photos (2)", "b.jpg"), []byte("abc"), 0644)
+	if got := pick(); got != "photos (2)" {
+		t.Errorf("with a partial and a complete file in photos (2) picked %q", got)
+	}
+
+	// Every file of the manifest in the folder has to match, by checksum
+	// or by the hash of its first block
+	os.WriteFile(filepath.Join(dest, "photos (2)", "b.jpg"), []byte("ab"), 0644)
+	if got := pick(); got != "photos (3)" {
+		t.Errorf("with a shorter b.jpg in photos (2) picked %q", got)
+	}
+	os.WriteFile(filepath.Join(dest, "photos (2)", "b.jpg"), []byte("xyz"), 0644)
+	if got := pick(); got != "photos (3)" {
+		t.Errorf("with a different b.jpg of the same size in photos (2) picked %q", got)
+	}
+	r.entries["b.jpg"].Checksum = ""
+	os.WriteFile(filepath.Join(dest, "photos (2)", "b.jpg"), []byte("abc"), 0644)
+	if got := pick(); got != "photos (3)" {
+		t.Errorf("with a b.jpg that cannot be checked in photos (2) picked %q", got)
+	}
+	r.entries["b.jpg"].Checksum = hex.EncodeToString(whole[:])
+	os.WriteFile(filepath.Join(dest, "photos (2)", "b.jpg"), []byte("abc"), 0644)
+	os.WriteFile(filepath.Join(dest, "photos (2)", "a.jpg"), []byte("abcdef"), 0644)
+	if got := pick(); got != "photos (3)" {
+		t.Errorf("with a different a.jpg in photos (2) picked %q", got)
+	}
+	os.WriteFile(filepath.Join(dest, "photos (2)", "a.jpg"), []byte("larger than the file sent"), 0644)
+	if got := pick(); got != "photos (3)" {
+		t.Errorf("with a larger a.jpg in photos (2) picked %q", got)
+	}
+}
+
+func TestReceiverScan(t *testing.T) {
+	srcDir := t.TempDir()
+	os.WriteFile(filepath.Join(srcDir, "clean.txt"), []byte("nothing to see"), 0644)
+	os.WriteFile(filepath.Join(srcDir, "eicar.txt"), []byte("EICAR test signature"), 0644)
+	scan := func(path string) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if strings.Contains(string(data), "EICAR") {
+			return errors.New("infected")
+		}
+		return nil
+	}
+
+	for _, keep := range []bool{true, false} {
+		sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sender.Code = "123-456"
+		destDir, rejectedDir := t.TempDir(), t.TempDir()
+		var failed []string
+		sendErr, recvErr := splitTransfer(t, context.Background(), sender, destDir, func(r *Receiver) {
+			r.Scan = scan
+			if keep {
+				r.RejectedDir = rejectedDir
+			}
+			r.OnFileComplete = func(filename string, verified bool, err error) {
+				if err != nil {
+					failed = append(failed, filename)
+				}
+			}
+		})
+		folder := filepath.Join(destDir, filepath.Base(srcDir))
+		if _, err := os.Stat(filepath.Join(folder, "eicar.txt")); !os.IsNotExist(err) {
+			t.Errorf("keep=%v: rejected file left in the destination: %v", keep, err)
+		}
+		if len(failed) != 1 || failed[0] != "eicar.txt" {
+			t.Errorf("keep=%v: files reported failed %v, want eicar.txt", keep, failed)
+		}
+		moved, _ := filepath.Glob(filepath.Join(rejectedDir, "*", filepath.Base(srcDir), "eicar.txt"))
+		if keep {
+			if sendErr != nil || recvErr != nil {
+				t.Fatalf("Send error %v, receive error %v", sendErr, recvErr)
+			}
+			if _, err := os.Stat(filepath.Join(folder, "clean.txt")); err != nil {
+				t.Errorf("clean file missing: %v", err)
+			}
+			if len(moved) != 1 {
+				t.Errorf("rejected file not moved, found %v", moved)
+			}
+		} else {
+			if CategoryOf(recvErr) != CategoryRejected {
+				t.Errorf("receive error %v, want a rejection", recvErr)
+			}
+			if len(moved) != 0 {
+				t.Errorf("rejected file kept in %v", moved)
+			}
+		}
+	}
+}
+
+func TestReceiverIdenticalFiles(t *testing.T) {
+	srcDir := t.TempDir()
+	os.WriteFile(filepath.Join(srcDir, "same.txt"), []byte("already there"), 0644)
+	os.WriteFile(filepath.Join(srcDir, "changed.txt"), []byte("new content"), 0644)
+	destDir := t.TempDir()
+	folder := filepath.Join(destDir, filepath.Base(srcDir))
+	os.MkdirAll(folder, 0755)
+	os.WriteFile(filepath.Join(folder, "same.txt"), []byte("already there"), 0600)
+
+	for _, paranoid := range []bool{false, true} {
+		os.WriteFile(filepath.Join(folder, "changed.txt"), []byte("old content"), 0600)
+		sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sender.Code = "123-456"
+		verified := make(map[string]bool)
+		sendErr, recvErr := splitTransfer(t, context.Background(), sender, destDir, func(r *Receiver) {
+			r.Paranoid = paranoid
+			r.OnFileComplete = func(filename string, ok bool, err error) {
+				verified[filename] = ok && err == nil
+			}
+		})
+		if sendErr != nil || recvErr != nil {
+			t.Fatalf("Send error %v, receive error %v", sendErr, recvErr)
+		}
+		if !verified["changed.txt"] {
+			t.Errorf("paranoid=%v: changed file not received and verified", paranoid)
+		}
+		if verified["same.txt"] == paranoid {
+			t.Errorf("paranoid=%v: identical file reported verified %v", paranoid, verified["same.txt"])
+		}
+		if data, _ := os.ReadFile(filepath.Join(folder, "changed.txt")); string(data) != "new content" {
+			t.Errorf("paranoid=%v: changed file has %q", paranoid, data)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package transfer
+
+import (
+	"errors"
+	"syscall"
+)
+
+// crossDevice reports whether err is of a rename across filesystems
+func crossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
@@ -0,0 +1,14 @@
+//go:build windows
+
+package transfer
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// crossDevice reports whether err is of a rename across volumes
+func crossDevice(err error) bool {
+	return errors.Is(err, windows.ERROR_NOT_SAME_DEVICE)
+}
@@ -0,0 +1,59 @@
+package transfer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// WaitInterval is how often a scheduled sender repeats MsgWait so the
+// receiver's inactivity timeout does not expire
+const WaitInterval = 15 * time.Second
+
+// WaitMsg tells the receiver that the sender holds the transfer until Until
+type WaitMsg struct {
+	Until time.Time `json:"until"`
+}
+
+// ParseStartTime parses a scheduled start. "23:00" means the next time the
+// clock shows 23:00 after now, RFC 3339 timestamps are taken as is.
+func ParseStartTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	clock, err := time.ParseInLocation("15:04", s, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid start time %q, use HH:MM or RFC 3339", s)
+	}
+	t := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !t.After(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// waitForStart holds a connected receiver until StartAt, repeating MsgWait
+// every WaitInterval
+func (s *Sender) waitForStart(ctx context.Context, stream io.ReadWriter) error {
+	data, err := json.Marshal(WaitMsg{Until: s.StartAt})
+	if err != nil {
+		return protocolError("failed to marshal wait message", err)
+	}
+	for {
+		remaining := time.Until(s.StartAt)
+		if remaining <= 0 {
+			return nil
+		}
+		SetStreamDeadline(stream, s.timeout())
+		if err := WriteMessage(stream, &Message{Type: MsgWait, Payload: data}); err != nil {
+			return fmt.Errorf("failed to send wait message: %w", err)
+		}
+		select {
+		case <-time.After(min(remaining, WaitInterval)):
+		case <-ctx.Done():
+			return cancelledError(ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package transfer
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseStartTime(t *testing.T) {
+	now := time.Date(2024, 5, 10, 21, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"23:00", time.Date(2024, 5, 10, 23, 0, 0, 0, time.UTC)},
+		{"06:15", time.Date(2024, 5, 11, 6, 15, 0, 0, time.UTC)},
+		{"21:30", time.Date(2024, 5, 11, 21, 30, 0, 0, time.UTC)},
+		{"2024-06-01T02:00:00Z", time.Date(2024, 6, 1, 2, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := ParseStartTime(tt.in, now)
+		if err != nil {
+			t.Errorf("ParseStartTime(%q) error: %v", tt.in, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseStartTime(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "25:00", "tonight"} {
+		if _, err := ParseStartTime(in, now); err == nil {
+			t.Errorf("ParseStartTime(%q) should fail", in)
+		}
+	}
+}
+
+func TestScheduledTransferWaits(t *testing.T) {
+	srcDir := t.TempDir()
+	srcPath := filepath.Join(srcDir, "later.txt")
+	if err := os.WriteFile(srcPath, []byte("off-peak"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	destDir := t.TempDir()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	startAt := time.Now().Add(300 * time.Millisecond)
+	var waitedUntil time.Time
+	var manifestAt time.Time
+	errChan := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			errChan <- err
+			return
+		}
+		defer conn.Close()
+
+		receiver := NewReceiver(destDir)
+		receiver.Code = "123-456"
+		receiver.OnWait = func(until time.Time) { waitedUntil = until }
+		receiver.OnConfirmation = func(m *Manifest) bool {
+			manifestAt = time.Now()
+			return true
+		}
+		errChan <- receiver.Receive(context.Background(), conn)
+	}()
+
+	go func() {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Errorf("Failed to connect: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		sender, err := NewSender(context.Background(), srcPath, false, false, nil)
+		if err != nil {
+			t.Errorf("Failed to create sender: %v", err)
+			return
+		}
+		sender.Code = "123-456"
+		sender.StartAt = startAt
+		if err := sender.Handshake(conn); err != nil {
+			t.Errorf("Sender handshake failed: %v", err)
+			return
+		}
+		if _, err := sender.Send(context.Background(), conn); err != nil {
+			t.Errorf("Sender failed: %v", err)
+		}
+	}()
+
+	if err := <-errChan; err != nil {
+		t.Fatalf("Receiver failed: %v", err)
+	}
+	if !waitedUntil.Equal(startAt) {
+		t.Errorf("OnWait got %v, want %v", waitedUntil, startAt)
+	}
+	if manifestAt.Before(startAt) {
+		t.Errorf("Manifest arrived at %v, before the scheduled start %v", manifestAt, startAt)
+	}
+}
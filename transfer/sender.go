@@ -2,68 +2,414 @@ package transfer
 
 import (
 	"bufio"
+	"context"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"io/fs"
 	"os"
-	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"golang.org/x/time/rate"
+	"lukechampine.com/blake3"
 )
 
 const ChunkSize = 64 * 1024
 
+// Reasons a sender stops accepting receivers, see Sender.Closed
+var (
+	ErrExpired       = errors.New("code expired")
+	ErrDownloadLimit = errors.New("download limit reached")
+	ErrWithdrawn     = errors.New("transfer cancelled")
+)
+
+// ErrTooManyHandshakes refuses a stream while DefaultMaxHandshakes or
+// Sender.MaxHandshakes others are still in the handshake
+var ErrTooManyHandshakes = errors.New("too many pending handshakes")
+
+// DefaultHandshakeTimeout is how long a receiver has to complete the
+// handshake once it opened a stream
+const DefaultHandshakeTimeout = 10 * time.Second
+
+// DefaultMaxHandshakes is how many streams may be in the handshake at once
+const DefaultMaxHandshakes = 8
+
+// HandshakeStats counts the streams that reached Sender.Handshake
+type HandshakeStats struct {
+	Pending  int   // In the handshake now
+	Accepted int64 // Completed the handshake
+	Refused  int64 // Over the limit of pending handshakes
+	TimedOut int64 // Did not complete the handshake in time
+	Failed   int64 // Sent a wrong code or password, or broke the protocol
+}
+
 type Sender struct {
-	FolderPath  string
-	Code        string
-	Compress    bool
-	Manifest    *Manifest
+	FolderPath    string
+	Source        fs.FS // Files to send, those at FolderPath if nil
+	Code          string
+	Password      string // Optional, the receiver must prove it knows it during the handshake
+	Compress      bool
+	CompressLevel int // gzip level from 1 to 9, DefaultCompressLevel if zero
+	Manifest      *Manifest
+	Timeout       time.Duration // Stream inactivity timeout, StreamTimeout if zero
+	StartAt       time.Time     // Receivers are held until this time, sending starts immediately if zero
+	ExpiresAt     time.Time     // Handshakes are refused from this time on, never if zero
+	MaxDownloads  int           // Handshakes are refused after this many completed transfers, unlimited if zero
+	MaxHandshakes int           // Streams in the handshake at once, more are refused, DefaultMaxHandshakes if zero
+	// DirectIO reads files on disk without the page cache where supported,
+	// for disks faster than the cache. Zero-copy sending is not used then.
+	DirectIO bool
+	// SourceLimit is how many bytes per second files are read at, apart
+	// from SetThrottle, unlimited if zero. See SourceLimit for network
+	// mounts. Zero-copy sending is not used then.
+	SourceLimit int64
+	// HandshakeTimeout bounds the handshake, so streams that never complete
+	// it do not hold a slot. DefaultHandshakeTimeout if zero.
+	HandshakeTimeout time.Duration
+	// DataStream returns the stream the receiver opened for file data with
+	// token, see Receiver.DataStream. Files are sent on the main stream if
+	// nil.
+	DataStream  func(ctx context.Context, token []byte) (io.ReadWriteCloser, error)
 	OnStartFile func(filename string, index, total int)
 	OnProgress  func(filename string, sent, total int64)
+	// OnFileComplete is called when the receiver saved a file, or with the
+	// error sending it failed with. verified tells whether the receiver
+	// checked its checksum, older receivers only confirm it was sent. May
+	// be called from another goroutine than Send.
+	OnFileComplete func(filename string, verified bool, err error)
+	// Audit records the options agreed on and each file with its checksum
+	// when set
+	Audit *AuditLog
+
+	original  map[string]string // Paths on disk before NFC normalization
+	withdrawn atomic.Bool       // See Withdraw
+	codeKeys  codeKeys          // Key of Code for the handshakes
+
+	mu          sync.Mutex
+	readLimiter *rate.Limiter  // Of SourceLimit
+	downloads   int            // Completed transfers
+	handshake   HandshakeStats // Streams that reached Handshake
+	rootOnce    sync.Once      // Sets Manifest.Root before the first transfer
 }
 
-func NewSender(folderPath string, cacheManifest bool, skipHash bool, onProgress ManifestProgressFunc) (*Sender, error) {
-	manifest, err := BuildManifest(folderPath, cacheManifest, skipHash, onProgress)
+func NewSender(ctx context.Context, folderPath string, cacheManifest bool, skipHash bool, onProgress ManifestProgressFunc) (*Sender, error) {
+	return NewSenderLimited(ctx, folderPath, cacheManifest, skipHash, 0, onProgress)
+}
+
+// NewSenderLimited is NewSender for a Sender with sourceLimit as its
+// SourceLimit, which also applies to hashing the files
+func NewSenderLimited(ctx context.Context, folderPath string, cacheManifest bool, skipHash bool, sourceLimit int64, onProgress ManifestProgressFunc) (*Sender, error) {
+	s := &Sender{FolderPath: folderPath, Timeout: StreamTimeout, SourceLimit: sourceLimit}
+	manifest, err := buildManifest(ctx, folderPath, cacheManifest, skipHash, s.hashLimiter(), onProgress)
 	if err != nil {
 		return nil, err
 	}
+	s.Manifest = manifest
+	s.original = normalizeManifest(manifest)
+	return s, nil
+}
+
+// NewSenderFS returns a sender of the files in fsys, such as a remote source
+// or files in memory, sent as a folder called name
+func NewSenderFS(ctx context.Context, fsys fs.FS, name string, skipHash bool, onProgress ManifestProgressFunc) (*Sender, error) {
+	return NewSenderFSLimited(ctx, fsys, name, skipHash, 0, onProgress)
+}
 
-	return &Sender{
-		FolderPath: folderPath,
-		Manifest:   manifest,
-		Compress:   false,
-	}, nil
+// NewSenderFSLimited is NewSenderFS with a SourceLimit, see
+// NewSenderLimited
+func NewSenderFSLimited(ctx context.Context, fsys fs.FS, name string, skipHash bool, sourceLimit int64, onProgress ManifestProgressFunc) (*Sender, error) {
+	s := &Sender{FolderPath: name, Source: fsys, Timeout: StreamTimeout, SourceLimit: sourceLimit}
+	manifest, err := buildManifestFS(ctx, fsys, name, skipHash, s.hashLimiter(), onProgress)
+	if err != nil {
+		return nil, err
+	}
+	s.Manifest = manifest
+	s.original = normalizeManifest(manifest)
+	return s, nil
 }
 
+// PreserveNames sends paths byte for byte as they are on disk instead of
+// normalized to NFC. Must be called before sending.
+func (s *Sender) PreserveNames() {
+	if name, ok := s.original[s.Manifest.FolderName]; ok {
+		s.Manifest.FolderName = name
+	}
+	for i := range s.Manifest.Files {
+		if p, ok := s.original[s.Manifest.Files[i].Path]; ok {
+			s.Manifest.Files[i].Path = p
+		}
+	}
+	s.original = nil
+}
+
+func (s *Sender) timeout() time.Duration {
+	if s.Timeout <= 0 {
+		return StreamTimeout
+	}
+	return s.Timeout
+}
+
+// Downloads returns the number of completed transfers
+func (s *Sender) Downloads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.downloads
+}
+
+// Withdraw refuses receivers from now on with ErrWithdrawn, for a send
+// that was cancelled while its code may still be found
+func (s *Sender) Withdraw() {
+	s.withdrawn.Store(true)
+}
+
+// Closed returns ErrWithdrawn, ErrExpired or ErrDownloadLimit once the
+// sender no longer accepts receivers, nil while it does
+func (s *Sender) Closed() error {
+	if s.withdrawn.Load() {
+		return ErrWithdrawn
+	}
+	if !s.ExpiresAt.IsZero() && !time.Now().Before(s.ExpiresAt) {
+		return ErrExpired
+	}
+	if s.MaxDownloads > 0 && s.Downloads() >= s.MaxDownloads {
+		return ErrDownloadLimit
+	}
+	return nil
+}
+
+// HandshakeStats returns the counts of streams that reached Handshake
+func (s *Sender) HandshakeStats() HandshakeStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.handshake
+}
+
+// beginHandshake takes a slot for a stream in the handshake, false if none
+// is free
+func (s *Sender) beginHandshake() bool {
+	limit := s.MaxHandshakes
+	if limit <= 0 {
+		limit = DefaultMaxHandshakes
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.handshake.Pending >= limit {
+		s.handshake.Refused++
+		return false
+	}
+	s.handshake.Pending++
+	return true
+}
+
+// endHandshake frees the slot of a stream and counts how its handshake
+// ended
+func (s *Sender) endHandshake(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handshake.Pending--
+	var netErr interface{ Timeout() bool }
+	switch {
+	case err == nil:
+		s.handshake.Accepted++
+	case errors.Is(err, os.ErrDeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		s.handshake.TimedOut++
+	default:
+		s.handshake.Failed++
+	}
+}
+
+func (s *Sender) handshakeTimeout() time.Duration {
+	if s.HandshakeTimeout <= 0 {
+		return DefaultHandshakeTimeout
+	}
+	return s.HandshakeTimeout
+}
+
+// StreamOptions are the options of a Sender that may differ between the
+// receivers it serves at once, such as with MaxDownloads
+type StreamOptions struct {
+	Compress bool // Compress the transfer, the caller compresses the stream passed to Send
+	// DataStream returns the data stream of this receiver, see
+	// Sender.DataStream
+	DataStream func(ctx context.Context, token []byte) (io.ReadWriteCloser, error)
+}
+
+// options returns the StreamOptions of the Sender's fields
+func (s *Sender) options() StreamOptions {
+	return StreamOptions{Compress: s.Compress, DataStream: s.DataStream}
+}
+
+// Handshake checks the code and password the receiver sent on stream. At
+// most MaxHandshakes streams are in it at once and each has
+// HandshakeTimeout, so peers cannot hold streams open without a code.
+// Callers should reset the stream if it fails. Once it succeeded, the
+// stream has no deadline until Send.
 func (s *Sender) Handshake(stream io.ReadWriter) error {
-	SetStreamDeadline(stream, StreamTimeout)
+	return s.HandshakeWith(stream, s.options())
+}
+
+// HandshakeWith is Handshake with opts for this receiver instead of the
+// Sender's fields. Pass the same opts to SendWith.
+func (s *Sender) HandshakeWith(stream io.ReadWriter, opts StreamOptions) (err error) {
+	if !s.beginHandshake() {
+		return rejectedError("", ErrTooManyHandshakes)
+	}
+	defer func() {
+		s.endHandshake(err)
+		refuseHandshake(stream, err)
+	}()
+
+	handshake, err := readHandshake(stream, s.handshakeTimeout(), &s.codeKeys, s.Code)
+	if err != nil {
+		return err
+	}
+	if handshake.Share != "" {
+		errMsg := "this sender offers no shares"
+		WriteMessage(stream, &Message{Type: MsgError, Payload: []byte(errMsg)})
+		return validationError("", errors.New(errMsg))
+	}
+	if err := s.accept(stream, opts); err != nil {
+		return err
+	}
+	// The caller may ask its user to accept the receiver, which can take
+	// longer than the handshake may. SendWith sets its own deadlines.
+	clearStreamDeadline(stream)
+	return nil
+}
+
+// readHandshake reads the receiver's handshake and checks that it knows
+// code, with the key of code in keys. If it does not, the error is a
+// *handshakeRefusal the caller passes to refuseHandshake once it freed the
+// slot of the stream.
+func readHandshake(stream io.ReadWriter, timeout time.Duration, keys *codeKeys, code string) (*HandshakeMsg, error) {
+	SetStreamDeadline(stream, timeout)
 	msg, err := ReadMessage(stream)
 	if err != nil {
-		return fmt.Errorf("failed to read handshake: %w", err)
+		return nil, fmt.Errorf("failed to read handshake: %w", err)
 	}
+	arrived := time.Now()
 	if msg.Type != MsgHandshake {
-		return fmt.Errorf("expected handshake, got %d", msg.Type)
+		return nil, refuse(arrived, protocolError("", fmt.Errorf("expected handshake, got %d", msg.Type)))
+	}
+	if code == "" {
+		return nil, refuse(arrived, validationError("", errors.New("no connection code set")))
 	}
 
+	// The code never goes on the wire, receivers prove it for a nonce
 	var handshake HandshakeMsg
 	if err := json.Unmarshal(msg.Payload, &handshake); err != nil {
-		if string(msg.Payload) != s.Code {
-			errMsg := "invalid connection code"
-			WriteMessage(stream, &Message{Type: MsgError, Payload: []byte(errMsg)})
-			return errors.New(errMsg)
+		return nil, refuse(arrived, protocolError("invalid handshake", err))
+	}
+	valid, err := challengeCode(stream, timeout, keys, code, handshake.Nonce)
+	if err != nil {
+		if CategoryOf(err) == CategoryProtocol {
+			return nil, refuse(arrived, err)
 		}
-	} else {
-		if handshake.Code != s.Code {
-			errMsg := "invalid connection code"
-			WriteMessage(stream, &Message{Type: MsgError, Payload: []byte(errMsg)})
-			return errors.New(errMsg)
+		return nil, err
+	}
+	if !valid {
+		return nil, refuse(arrived, validationError("", errors.New("invalid connection code")))
+	}
+	return &handshake, nil
+}
+
+// refuseDelay is how long after its handshake arrived a receiver that did
+// not prove the code is refused
+var refuseDelay = 2 * time.Second
+
+// handshakeRefusal is the error of a receiver that did not prove the code
+type handshakeRefusal struct {
+	arrived time.Time // When its handshake arrived
+	err     error
+}
+
+func refuse(arrived time.Time, err error) error {
+	return &handshakeRefusal{arrived: arrived, err: err}
+}
+
+func (r *handshakeRefusal) Error() string { return r.err.Error() }
+func (r *handshakeRefusal) Unwrap() error { return r.err }
+
+// refuseHandshake refuses the receiver on stream if err is a
+// handshakeRefusal. Whatever went wrong, it only learns that the handshake
+// failed, and always refuseDelay after the handshake arrived, so scanning
+// for codes learns nothing from the answer or its timing and is slow. The
+// delay must not hold a MaxHandshakes slot, or a few scanners would keep
+// out receivers with the code.
+func refuseHandshake(stream io.Writer, err error) {
+	var r *handshakeRefusal
+	if !errors.As(err, &r) {
+		return
+	}
+	time.Sleep(time.Until(r.arrived.Add(refuseDelay)))
+	WriteMessage(stream, &Message{Type: MsgError, Payload: []byte("handshake failed")})
+}
+
+// challengeCode proves to a receiver that sent receiverNonce that this
+// side knows code, with its key in keys, and returns whether the receiver proved it in turn
+func challengeCode(stream io.ReadWriter, timeout time.Duration, keys *codeKeys, code string, receiverNonce []byte) (bool, error) {
+	if len(receiverNonce) != nonceSize {
+		return false, protocolError("", errors.New("invalid handshake nonce"))
+	}
+	nonce, err := newNonce()
+	if err != nil {
+		return false, fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	salt, key, err := keys.get(code)
+	if err != nil {
+		return false, fmt.Errorf("failed to derive the code key: %w", err)
+	}
+	data, err := json.Marshal(CodeChallengeMsg{Salt: salt, Nonce: nonce, Proof: codeProof(key, receiverNonce, nonce, roleSender)})
+	if err != nil {
+		return false, protocolError("failed to marshal code challenge", err)
+	}
+	if err := WriteMessage(stream, &Message{Type: MsgCodeChallenge, Payload: data}); err != nil {
+		return false, fmt.Errorf("failed to send code challenge: %w", err)
+	}
+
+	SetStreamDeadline(stream, timeout)
+	msg, err := ReadMessage(stream)
+	if err != nil {
+		return false, fmt.Errorf("failed to read code response: %w", err)
+	}
+	if msg.Type == MsgError {
+		return false, validationError("code challenge declined", errors.New(string(msg.Payload)))
+	}
+	if msg.Type != MsgCodeResponse {
+		return false, protocolError("", fmt.Errorf("expected code response, got %d", msg.Type))
+	}
+	var resp ChallengeResponseMsg
+	if err := json.Unmarshal(msg.Payload, &resp); err != nil {
+		return false, protocolError("invalid code response", err)
+	}
+	return validCodeProof(resp.Proof, key, receiverNonce, nonce, roleReceiver), nil
+}
+
+// accept completes the handshake of a receiver that proved the code
+func (s *Sender) accept(stream io.ReadWriter, opts StreamOptions) error {
+	// Checked after the code, so only receivers that know it learn why
+	if err := s.Closed(); err != nil {
+		WriteMessage(stream, &Message{Type: MsgError, Payload: []byte(err.Error())})
+		return rejectedError("", err)
+	}
+
+	ack := HandshakeAckMsg{Compress: opts.Compress, Keepalive: true, DataStream: opts.DataStream != nil, ProgressAck: true, TimeoutMs: s.timeout().Milliseconds()}
+	if s.Password != "" {
+		proof, err := s.challenge(stream)
+		if err != nil {
+			return err
 		}
+		ack.Proof = proof
 	}
 
-	ack := HandshakeAckMsg{Compress: s.Compress}
 	ackData, err := json.Marshal(ack)
 	if err != nil {
-		return fmt.Errorf("failed to marshal handshake ack: %w", err)
+		return protocolError("failed to marshal handshake ack", err)
 	}
 	if err := WriteMessage(stream, &Message{Type: MsgHandshakeAck, Payload: ackData}); err != nil {
 		return fmt.Errorf("failed to send handshake ack: %w", err)
@@ -72,51 +418,265 @@ func (s *Sender) Handshake(stream io.ReadWriter) error {
 	return nil
 }
 
-func (s *Sender) Send(stream io.ReadWriter) error {
+// challenge verifies that the receiver knows the password and returns the
+// sender's own proof so the receiver can verify the sender in turn
+func (s *Sender) challenge(stream io.ReadWriter) ([]byte, error) {
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	data, err := json.Marshal(ChallengeMsg{Nonce: nonce})
+	if err != nil {
+		return nil, protocolError("failed to marshal challenge", err)
+	}
+	if err := WriteMessage(stream, &Message{Type: MsgChallenge, Payload: data}); err != nil {
+		return nil, fmt.Errorf("failed to send challenge: %w", err)
+	}
+
+	SetStreamDeadline(stream, s.handshakeTimeout())
+	msg, err := ReadMessage(stream)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read challenge response: %w", err)
+	}
+	if msg.Type == MsgError {
+		return nil, rejectedError("password challenge declined", errors.New(string(msg.Payload)))
+	}
+	if msg.Type != MsgChallengeResponse {
+		return nil, protocolError("", fmt.Errorf("expected challenge response, got %d", msg.Type))
+	}
+
+	var resp ChallengeResponseMsg
+	if err := json.Unmarshal(msg.Payload, &resp); err != nil {
+		return nil, protocolError("invalid challenge response", err)
+	}
+
+	key := passwordKey(s.Code, s.Password)
+	if !validProof(resp.Proof, key, nonce, roleReceiver) {
+		errMsg := "incorrect password"
+		WriteMessage(stream, &Message{Type: MsgError, Payload: []byte(errMsg)})
+		return nil, validationError("", errors.New(errMsg))
+	}
+
+	return passwordProof(key, nonce, roleSender), nil
+}
+
+// Delivery tells how one transfer of a Sender went, or how far it got. A
+// Sender may send to several receivers at once, each gets its own.
+type Delivery struct {
+	Receipt   *Receipt // Verified receipt, nil if none was sent
+	Confirmed bool     // Receiver confirmed the transfer, older receivers do not
+	Skipped   []string // Manifest paths the receiver left out
+	// Compression tells how well compression did, when the stream passed to
+	// Send or the data stream was compressed
+	Compression CompressionStats
+
+	path    string
+	root    string
+	acked   bool  // OnProgress reports what the receiver acknowledged instead of what was sent
+	segment int64 // Size of the segments the receiver asked for, whole files if zero
+	done    atomic.Int64
+	tally   tally
+}
+
+// Send streams the manifest and all files to the receiver. Cancelling ctx
+// aborts the transfer promptly and closes the stream. The Delivery is
+// returned even if the transfer failed.
+func (s *Sender) Send(ctx context.Context, stream io.ReadWriter) (*Delivery, error) {
+	return s.SendWith(ctx, stream, s.options())
+}
+
+// SendWith is Send with the opts passed to HandshakeWith for this receiver
+func (s *Sender) SendWith(ctx context.Context, stream io.ReadWriter, opts StreamOptions) (*Delivery, error) {
+	stop := watchContext(ctx, stream, nil)
+	defer stop()
+
+	d := &Delivery{path: s.FolderPath}
+	err := s.send(ctx, stream, opts, d)
+	d.tally.end()
+	if err != nil && ctx.Err() != nil {
+		return d, cancelledError(ctx.Err())
+	}
+	if err == nil {
+		s.mu.Lock()
+		s.downloads++
+		s.mu.Unlock()
+	}
+	return d, err
+}
+
+func (s *Sender) send(ctx context.Context, stream io.ReadWriter, opts StreamOptions, d *Delivery) error {
+	if err := s.waitForStart(ctx, stream); err != nil {
+		return err
+	}
+	// Computed this late because PreserveNames may change the paths
+	s.rootOnce.Do(func() { s.Manifest.Root = s.Manifest.MerkleRoot() })
+	d.root = s.Manifest.Root
+	manifestHash, err := HashManifest(s.Manifest)
+	if err != nil {
+		return protocolError("failed to encode manifest", err)
+	}
 	if err := SendManifest(stream, s.Manifest); err != nil {
 		return fmt.Errorf("failed to send manifest: %w", err)
 	}
 
-	SetStreamDeadline(stream, StreamTimeout)
+	// The receiver pings while it checks existing files or asks its user
+	SetStreamDeadline(stream, s.timeout())
 	msg, err := ReadMessage(stream)
+	for err == nil && msg.Type == MsgPing {
+		if err = WriteMessage(stream, &Message{Type: MsgPong}); err != nil {
+			break
+		}
+		SetStreamDeadline(stream, s.timeout())
+		msg, err = ReadMessage(stream)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to receive resume message: %w", err)
 	}
 
+	if msg.Type == MsgError {
+		return rejectedError("transfer rejected by receiver", errors.New(string(msg.Payload)))
+	}
+
 	if msg.Type != MsgResume {
-		return fmt.Errorf("expected resume message, got %d", msg.Type)
+		return protocolError("", fmt.Errorf("expected resume message, got %d", msg.Type))
 	}
 
 	var resumeMsg ResumeMsg
 	if err := json.Unmarshal(msg.Payload, &resumeMsg); err != nil {
-		return fmt.Errorf("invalid resume message: %w", err)
+		return protocolError("invalid resume message", err)
+	}
+
+	// With a data stream the control stream stays free for the receiver to
+	// cancel, which aborts sending at once
+	var files io.ReadWriter = stream
+	var control *controlReader
+	var cancel context.CancelCauseFunc
+	ctx, cancel = context.WithCancelCause(ctx)
+	defer cancel(nil)
+	if resumeMsg.DataStream {
+		if opts.DataStream == nil {
+			return protocolError("", errors.New("receiver sent files to a data stream that was not offered"))
+		}
+		if len(resumeMsg.DataToken) != DataTokenSize {
+			return protocolError("", errors.New("receiver opened a data stream without a token"))
+		}
+		acceptCtx, cancelAccept := context.WithTimeout(ctx, s.timeout())
+		data, err := opts.DataStream(acceptCtx, resumeMsg.DataToken)
+		cancelAccept()
+		if err != nil {
+			return networkError("failed to accept data stream", err)
+		}
+		data, err = wrapDataStream(data, opts.Compress, s.CompressLevel, s.timeout())
+		if err != nil {
+			return err
+		}
+		defer data.Close()
+
+		stopData := watchContext(ctx, data, nil)
+		defer stopData()
+		files = data
+	}
+	defer func() { d.Compression = compressionOf(stream, files) }()
+
+	// Receivers that acknowledge progress do so on the control stream, which
+	// is then read while sending
+	d.acked = resumeMsg.ProgressAck
+	if resumeMsg.SegmentSize > 0 {
+		d.segment = max(resumeMsg.SegmentSize, MinSegmentSize)
+	}
+	if resumeMsg.DataStream || resumeMsg.ProgressAck {
+		control = readControl(stream, cancel, s.ackHandler(d, resumeMsg.Files))
+		defer control.stop()
 	}
 
 	bufferedStream := &BufferedDeadlineWriter{
-		Writer:     bufio.NewWriterSize(stream, 1024*1024),
-		Underlying: stream,
+		Writer:     bufio.NewWriterSize(files, 1024*1024),
+		Underlying: files,
 	}
 	defer bufferedStream.Flush()
 
-	for i, file := range s.Manifest.Files {
+	skip := make(map[string]bool, len(resumeMsg.Skip))
+	for _, path := range resumeMsg.Skip {
+		skip[path] = true
+	}
+	var wanted []FileEntry
+	for _, file := range s.Manifest.Files {
+		if skip[file.Path] {
+			d.Skipped = append(d.Skipped, file.Path)
+			continue
+		}
+		wanted = append(wanted, file)
+	}
+
+	var resumed int64
+	skipped := len(d.Skipped)
+	for _, file := range wanted {
+		offset := min(max(resumeMsg.Files[file.Path], 0), file.Size)
+		resumed += offset
+		if offset == file.Size && file.Size > 0 {
+			skipped++
+		}
+	}
+	d.done.Store(resumed)
+	d.tally.begin(resumed)
+	d.tally.skipped.Store(int64(skipped))
+	s.Audit.Record(AuditEvent{Event: AuditHandshake, Size: s.Manifest.TotalSize, Offset: resumed, Checksum: manifestHash, Options: map[string]interface{}{
+		"folder":      s.Manifest.FolderName,
+		"files":       len(wanted),
+		"skipped":     len(d.Skipped),
+		"compress":    opts.Compress,
+		"password":    s.Password != "",
+		"dataStream":  resumeMsg.DataStream,
+		"progressAck": resumeMsg.ProgressAck,
+		"segmentSize": d.segment,
+		"blocks":      len(resumeMsg.Blocks),
+	}})
+
+	for i, file := range wanted {
 		offset := resumeMsg.Files[file.Path]
 
 		if offset >= file.Size {
 			offset = file.Size
 		}
+		// Blocks the receiver has from its BlockStore are left out, segments
+		// are sent whole
+		var claimed []int
+		if d.segment == 0 && offset < file.Size {
+			claimed = resumeMsg.Blocks[file.Path]
+			if !validClaims(&file, max(offset, 0), claimed) {
+				return protocolError("", fmt.Errorf("invalid blocks claimed of %s", file.Path))
+			}
+		}
 
 		if s.OnStartFile != nil {
-			s.OnStartFile(file.Path, i+1, len(s.Manifest.Files))
+			s.OnStartFile(file.Path, i+1, len(wanted))
 		}
 
-		if err := s.sendFile(bufferedStream, file, offset); err != nil {
+		if err := s.sendFile(ctx, d, bufferedStream, file, offset, claimed); err != nil {
+			s.fileComplete(d, &file, offset, false, err)
+			if resumeMsg.DataStream {
+				// A cancel may arrive just after the data stream was closed
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Second):
+				}
+				if cause := context.Cause(ctx); CategoryOf(cause) == CategoryRejected {
+					return cause
+				}
+			}
 			return fmt.Errorf("failed to send %s: %w", file.Path, err)
 		}
+		if !d.acked && offset < file.Size {
+			s.fileComplete(d, &file, offset, false, nil)
+		}
+		if file.Size == 0 {
+			d.tally.fileDone(nil)
+		}
 	}
 
 	bufferedStream.Flush()
 
-	if err := WriteMessage(stream, &Message{Type: MsgComplete}); err != nil {
+	if err := WriteMessage(files, &Message{Type: MsgComplete}); err != nil {
 		return fmt.Errorf("failed to send completion: %w", err)
 	}
 
@@ -124,98 +684,285 @@ func (s *Sender) Send(stream io.ReadWriter) error {
 		s.SetReadDeadline(time.Now().Add(10 * time.Second))
 	}
 
-	buf := make([]byte, 1)
-	if _, readErr := stream.Read(buf); readErr != nil && readErr != io.EOF {
-		// This is just a courtesy wait for receiver acknowledgment
-		// Log the warning but don't fail the transfer since data was already sent
-		fmt.Fprintf(os.Stderr, "Warning: receiver may not have acknowledged file completion: %v\n", readErr)
+	// Wait for the optional receipt and the acknowledgement. Older receivers
+	// just close the stream, so the transfer is then only unconfirmed.
+	// Failures are only logged since all data was already sent.
+	next := func() (*Message, error) { return ReadMessage(stream) }
+	if control != nil {
+		next = control.next
 	}
+	for {
+		msg, readErr := next()
+		if readErr != nil {
+			if !errors.Is(readErr, io.EOF) {
+				fmt.Fprintf(os.Stderr, "Warning: receiver may not have acknowledged file completion: %v\n", readErr)
+			}
+			return nil
+		}
+		switch msg.Type {
+		case MsgReceipt:
+			d.Receipt = verifyReceipt(msg.Payload, manifestHash, s.Manifest.Root)
+		case MsgCompleteAck:
+			d.Confirmed = true
+			return nil
+		case MsgError:
+			// The receiver stopped before the last files, or failed to
+			// verify them
+			return rejectedError("", errors.New(string(msg.Payload)))
+		}
+	}
+}
 
-	return nil
+// ackHandler reports acknowledged progress to OnProgress, and saved files
+// to OnFileComplete. resumed are the offsets the receiver resumed files at.
+func (s *Sender) ackHandler(d *Delivery, resumed map[string]int64) func(ProgressAckMsg) {
+	entries := make(map[string]*FileEntry, len(s.Manifest.Files))
+	for i := range s.Manifest.Files {
+		entries[s.Manifest.Files[i].Path] = &s.Manifest.Files[i]
+	}
+	return func(ack ProgressAckMsg) {
+		entry, ok := entries[ack.Path]
+		if !ok || ack.Offset < 0 || ack.Offset > entry.Size {
+			return
+		}
+		if s.OnProgress != nil {
+			s.OnProgress(ack.Path, ack.Offset, entry.Size)
+		}
+		if ack.Complete {
+			s.fileComplete(d, entry, min(max(resumed[ack.Path], 0), entry.Size), ack.Verified, nil)
+		}
+	}
 }
 
-func (s *Sender) sendFile(stream io.Writer, entry FileEntry, offset int64) error {
-	startMsg := FileStartMsg{Path: entry.Path, Size: entry.Size, Offset: offset}
-	startData, err := json.Marshal(startMsg)
-	if err != nil {
-		return fmt.Errorf("failed to marshal file start message: %w", err)
+// fileComplete reports a file of d sent, saved or failed to OnFileComplete
+// and Audit
+func (s *Sender) fileComplete(d *Delivery, entry *FileEntry, offset int64, verified bool, err error) {
+	if err != nil || offset < entry.Size {
+		d.tally.fileDone(err)
 	}
-	if err := WriteMessage(stream, &Message{Type: MsgFileStart, Payload: startData}); err != nil {
-		return err
+	if s.OnFileComplete != nil {
+		s.OnFileComplete(entry.Path, verified, err)
 	}
+	s.Audit.Record(AuditEvent{Event: AuditFile, Path: entry.Path, Size: entry.Size, Offset: offset, Checksum: entry.Checksum, Verified: verified, Error: AuditError(err)})
+}
 
-	if offset == entry.Size {
-		return WriteMessage(stream, &Message{Type: MsgFileEnd})
+// Sent returns how many bytes of the transfer were sent, including what
+// the receiver already had when it resumed
+func (d *Delivery) Sent() int64 {
+	return d.done.Load()
+}
+
+// Root returns the Merkle root of the files of the transfer, empty if the
+// receiver left some out
+func (d *Delivery) Root() string {
+	if len(d.Skipped) > 0 {
+		return ""
 	}
+	return d.root
+}
 
-	var filePath string
-	info, err := os.Stat(s.FolderPath)
-	if err == nil && !info.IsDir() {
-		filePath = s.FolderPath
-	} else {
-		filePath = filepath.Join(s.FolderPath, filepath.FromSlash(entry.Path))
+func verifyReceipt(payload []byte, manifestHash, root string) *Receipt {
+	var receipt Receipt
+	if err := json.Unmarshal(payload, &receipt); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: invalid receipt from receiver: %v\n", err)
+		return nil
+	}
+	if err := receipt.Verify(manifestHash); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: rejecting receipt: %v\n", err)
+		return nil
+	}
+	if receipt.Root != root {
+		fmt.Fprintln(os.Stderr, "Warning: rejecting receipt: it is for different files")
+		return nil
+	}
+	return &receipt
+}
+
+func (s *Sender) sendFile(ctx context.Context, d *Delivery, stream io.Writer, entry FileEntry, offset int64, claimed []int) error {
+	if offset == entry.Size {
+		if err := writeFileStart(stream, FileStartMsg{Path: entry.Path, Size: entry.Size, Offset: offset}); err != nil {
+			return err
+		}
+		return WriteMessage(stream, &Message{Type: MsgFileEnd})
 	}
 
-	file, err := os.Open(filePath)
+	file, err := s.openFile(entry.Path)
 	if err != nil {
 		return err
 	}
+	if osFile, ok := file.(*os.File); ok && s.DirectIO {
+		if direct, err := newDirectFile(osFile); err == nil {
+			file = direct
+		}
+	}
 	defer file.Close()
 
 	if offset > 0 {
-		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		if seeker, ok := file.(io.Seeker); ok {
+			_, err = seeker.Seek(offset, io.SeekStart)
+		} else {
+			_, err = io.CopyN(io.Discard, file, offset)
+		}
+		if err != nil {
 			return err
 		}
 	}
 
-	remaining := entry.Size - offset
-	currentPos := offset
+	if d.segment == 0 {
+		return s.sendRange(ctx, d, stream, file, entry, offset, 0, claimed)
+	}
+	for offset < entry.Size {
+		length := min(d.segment, entry.Size-offset)
+		if err := s.sendRange(ctx, d, stream, file, entry, offset, length, nil); err != nil {
+			return err
+		}
+		offset += length
+	}
+	return nil
+}
 
-	buf := make([]byte, 256*1024)
+func writeFileStart(stream io.Writer, start FileStartMsg) error {
+	data, err := json.Marshal(start)
+	if err != nil {
+		return protocolError("failed to marshal file start message", err)
+	}
+	return WriteMessage(stream, &Message{Type: MsgFileStart, Payload: data})
+}
 
-	timeoutStream := &TimeoutWriter{W: stream, Timeout: StreamTimeout}
+// sendRange sends the data of entry from offset, where file is positioned.
+// A length sends a segment of that many bytes with its checksum, zero the
+// rest of the file without the blocks claimed.
+func (s *Sender) sendRange(ctx context.Context, d *Delivery, stream io.Writer, file fs.File, entry FileEntry, offset, length int64, claimed []int) error {
+	if err := writeFileStart(stream, FileStartMsg{Path: entry.Path, Size: entry.Size, Offset: offset, Length: length}); err != nil {
+		return err
+	}
 
-	for remaining > 0 {
-		toRead := int64(len(buf))
-		if toRead > remaining {
-			toRead = remaining
+	remaining := entry.Size - offset
+	if length > 0 {
+		remaining = length
+	}
+	var skip *skipReader
+	if len(claimed) > 0 {
+		skip = &skipReader{file: file, entry: &entry, claimed: claimed, pos: offset}
+		remaining -= claimedBytes(&entry, claimed)
+	}
+	sending := remaining
+	var counted int64
+	onChunk := func(copied int64) {
+		if skip != nil {
+			copied += skip.skipped
+		}
+		d.done.Add(copied - counted)
+		counted = copied
+		if s.OnProgress != nil && !d.acked {
+			s.OnProgress(entry.Path, offset+copied, entry.Size)
 		}
+	}
+	// Without a checksum the receiver cannot verify the file, so the data
+	// gets frame checksums, which needs to see the data. Segments have a
+	// checksum of their own.
+	var crcs *frameCRC
+	var segment hash.Hash
+	if length > 0 {
+		segment = blake3.New(32, nil)
+	} else if entry.Checksum == "" {
+		crcs = new(frameCRC)
+	}
 
-		n, readErr := file.Read(buf[:toRead])
-		if n > 0 {
-			written := 0
-			for written < n {
-				wn, writeErr := timeoutStream.Write(buf[written:n])
-				if writeErr != nil {
-					return fmt.Errorf("failed to copy file data: %w", writeErr)
-				}
-				if wn == 0 {
-					return fmt.Errorf("failed to copy file data: zero bytes written")
-				}
-				written += wn
-			}
+	var copied int64
+	var readErr, writeErr error
+	osFile, isOS := file.(*os.File)
+	if conn := zeroCopyConn(stream); conn != nil && crcs == nil && segment == nil && skip == nil && isOS && !s.DirectIO && s.SourceLimit <= 0 {
+		copied, readErr, writeErr = copyZero(ctx, stream, conn, osFile, remaining, s.timeout(), onChunk)
+	} else {
+		var src io.Reader = io.LimitReader(file, remaining)
+		if skip != nil {
+			src = io.LimitReader(skip, remaining)
+		}
+		if s.SourceLimit > 0 {
+			src = &limitedReader{ctx: ctx, r: src, limiter: s.sourceLimiter()}
+		}
+		if crcs != nil {
+			src = io.TeeReader(src, crcs)
+		}
+		if segment != nil {
+			src = io.TeeReader(src, segment)
+		}
+		timeoutStream := &TimeoutWriter{W: stream, Timeout: s.timeout()}
+		copied, readErr, writeErr = copyChunks(ctx, timeoutStream, src, onChunk)
+	}
+	if writeErr != nil {
+		return networkError("failed to copy file data", writeErr)
+	}
+	if readErr != nil {
+		if CategoryOf(readErr) == CategoryCancelled {
+			return readErr
+		}
+		return fmt.Errorf("failed to read file data: %w", readErr)
+	}
+	remaining -= copied
 
-			currentPos += int64(n)
-			remaining -= int64(n)
+	if remaining != 0 {
+		return validationError("", fmt.Errorf("incomplete transfer: sent %d of %d bytes", sending-remaining, sending))
+	}
+	if skip != nil && skip.skipped < entry.Size-offset-sending {
+		// Claimed blocks at the end of the file were never reached
+		skip.skipped = entry.Size - offset - sending
+		onChunk(copied)
+	}
 
-			if s.OnProgress != nil {
-				s.OnProgress(entry.Path, currentPos, entry.Size)
-			}
+	var endData []byte
+	if crcs != nil || segment != nil {
+		var end FileEndMsg
+		if crcs != nil {
+			end.FrameCRCs = crcs.Sums()
 		}
-
-		if readErr != nil {
-			if readErr == io.EOF {
-				break
-			}
-			return fmt.Errorf("failed to read file data: %w", readErr)
+		if segment != nil {
+			end.Checksum = hex.EncodeToString(segment.Sum(nil))
+		}
+		var err error
+		if endData, err = json.Marshal(end); err != nil {
+			return protocolError("failed to marshal file end message", err)
 		}
 	}
+	return WriteMessage(stream, &Message{Type: MsgFileEnd, Payload: endData})
+}
 
-	if remaining != 0 {
-		return fmt.Errorf("incomplete transfer: sent %d of %d bytes", entry.Size-offset-remaining, entry.Size-offset)
+// openFile opens the file at the manifest path p
+func (s *Sender) openFile(p string) (fs.File, error) {
+	if name, ok := s.original[p]; ok {
+		p = name
+	}
+	s.mu.Lock()
+	source := s.Source
+	s.mu.Unlock()
+	if source != nil {
+		return source.Open(p)
 	}
 
-	return WriteMessage(stream, &Message{Type: MsgFileEnd})
+	// Senders made without NewSender, such as of a resumed session. The
+	// handle tells what FolderPath is, so it cannot be swapped for another
+	// file between the check and the open.
+	file, err := os.Open(s.FolderPath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	s.mu.Lock()
+	if s.Source == nil {
+		s.Source = localFS(s.FolderPath, info)
+	}
+	source = s.Source
+	s.mu.Unlock()
+	if !info.IsDir() && p == info.Name() {
+		return file, nil
+	}
+	file.Close()
+	return source.Open(p)
 }
 
 func FormatBytes(bytes int64) string {
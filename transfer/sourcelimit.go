@@ -0,0 +1,70 @@
+package transfer
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// DefaultNetworkSourceLimit is how fast files on a network mount such as
+// SMB or NFS are read when no limit is set, so a send leaves the share
+// usable for others
+const DefaultNetworkSourceLimit = 40 << 20
+
+// SourceLimit returns the read limit in bytes per second for sending the
+// files at path, given one in MB/s: DefaultNetworkSourceLimit if zero and
+// path is on a network mount, none if zero otherwise or negative
+func SourceLimit(path string, mbPerSecond int) int64 {
+	switch {
+	case mbPerSecond > 0:
+		return int64(mbPerSecond) << 20
+	case mbPerSecond == 0 && IsNetworkMount(path):
+		return DefaultNetworkSourceLimit
+	}
+	return 0
+}
+
+// sourceLimiter returns the limiter of SourceLimit, shared by all receivers
+// so they read no faster together
+func (s *Sender) sourceLimiter() *rate.Limiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.readLimiter == nil || s.readLimiter.Limit() != rate.Limit(s.SourceLimit) {
+		s.readLimiter = rate.NewLimiter(rate.Limit(s.SourceLimit), copyBufferSize)
+	}
+	return s.readLimiter
+}
+
+// hashLimiter returns the limiter of SourceLimit for hashing, nil if there
+// is no limit
+func (s *Sender) hashLimiter() *rate.Limiter {
+	if s.SourceLimit <= 0 {
+		return nil
+	}
+	return s.sourceLimiter()
+}
+
+// limitedReader reads r no faster than limiter allows. Unlike SetThrottle
+// it only slows down reading the files, not the network.
+type limitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > l.limiter.Burst() {
+		p = p[:l.limiter.Burst()]
+	}
+	n, err := l.r.Read(p)
+	if n > 0 {
+		if werr := l.limiter.WaitN(l.ctx, n); werr != nil {
+			if ctxErr := l.ctx.Err(); ctxErr != nil {
+				return n, cancelledError(ctxErr)
+			}
+			return n, werr
+		}
+	}
+	return n, err
+}
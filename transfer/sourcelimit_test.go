@@ -0,0 +1,63 @@
+package transfer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSourceLimit(t *testing.T) {
+	dir := t.TempDir()
+	if IsNetworkMount(dir) {
+		t.Skip("temporary folder is on a network mount")
+	}
+	if got := SourceLimit(dir, 0); got != 0 {
+		t.Errorf("SourceLimit of a local folder = %d, want none", got)
+	}
+	if got := SourceLimit(dir, 5); got != 5<<20 {
+		t.Errorf("SourceLimit(5 MB/s) = %d", got)
+	}
+	if got := SourceLimit(dir, -1); got != 0 {
+		t.Errorf("SourceLimit(-1) = %d, want none", got)
+	}
+}
+
+func TestSenderSourceLimit(t *testing.T) {
+	srcDir := t.TempDir()
+	os.WriteFile(filepath.Join(srcDir, "data.bin"), make([]byte, 2<<20), 0644)
+	sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.Code = "123-456"
+	sender.SourceLimit = 4 << 20
+
+	// The first copyBufferSize bytes pass at once, the rest at 4 MiB/s
+	start := time.Now()
+	sendErr, recvErr := splitTransfer(t, context.Background(), sender, t.TempDir(), nil)
+	if sendErr != nil || recvErr != nil {
+		t.Fatalf("Send error %v, receive error %v", sendErr, recvErr)
+	}
+	if elapsed := time.Since(start); elapsed < 350*time.Millisecond {
+		t.Errorf("sent 2 MiB in %v, want about 440ms", elapsed)
+	}
+}
+
+func TestHashSourceLimit(t *testing.T) {
+	srcDir := t.TempDir()
+	os.WriteFile(filepath.Join(srcDir, "data.bin"), make([]byte, 2<<20), 0644)
+
+	start := time.Now()
+	sender, err := NewSenderLimited(context.Background(), srcDir, false, false, 4<<20, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 350*time.Millisecond {
+		t.Errorf("hashed 2 MiB in %v, want about 440ms", elapsed)
+	}
+	if sender.SourceLimit != 4<<20 {
+		t.Errorf("SourceLimit = %d, want %d", sender.SourceLimit, 4<<20)
+	}
+}
@@ -0,0 +1,99 @@
+package transfer
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Summary tells how a transfer went, for people and scripts
+type Summary struct {
+	Direction string `json:"direction"` // "send" or "receive"
+	Path      string `json:"path"`      // Folder sent, or where it was saved
+	Files     int    `json:"files"`     // Files transferred
+	Skipped   int    `json:"skipped"`   // Files left out by the receiver or complete there already
+	Failed    int    `json:"failed"`    // Files that failed or were rejected
+	Bytes     int64  `json:"bytes"`     // File data moved, before compression
+	Resumed   int64  `json:"resumed"`   // File data the receiver had already
+	// Elapsed is the time from agreeing on what to send to the end of the
+	// transfer, zero if it did not get that far
+	Elapsed  time.Duration `json:"elapsed"`
+	Speed    int64         `json:"speed"`    // Average bytes moved per second
+	Verified bool          `json:"verified"` // All files matched the manifest's Merkle root
+	// Compression tells how well compression did, nil if it was off
+	Compression *CompressionStats `json:"compression,omitempty"`
+	Error       string            `json:"error,omitempty"` // Set by the caller for a transfer that failed
+}
+
+// tally counts the files of a transfer as they end, for its Summary
+type tally struct {
+	started time.Time
+	elapsed time.Duration
+	resumed int64
+	files   atomic.Int64
+	skipped atomic.Int64
+	failed  atomic.Int64
+}
+
+// reset starts counting a new transfer
+func (t *tally) reset() {
+	t.started, t.elapsed, t.resumed = time.Time{}, 0, 0
+	t.files.Store(0)
+	t.skipped.Store(0)
+	t.failed.Store(0)
+}
+
+// begin marks the start of the file data, resumed bytes of which the
+// receiver had already
+func (t *tally) begin(resumed int64) {
+	t.started = time.Now()
+	t.resumed = resumed
+}
+
+// end marks the end of the transfer
+func (t *tally) end() {
+	if !t.started.IsZero() {
+		t.elapsed = time.Since(t.started)
+	}
+}
+
+// fileDone counts a file that ended with err
+func (t *tally) fileDone(err error) {
+	if err != nil {
+		t.failed.Add(1)
+	} else {
+		t.files.Add(1)
+	}
+}
+
+// summary returns what was counted, with done bytes of the files on the
+// receiver's side
+func (t *tally) summary(direction, path string, done int64, verified bool, compression CompressionStats) Summary {
+	s := Summary{
+		Direction: direction,
+		Path:      path,
+		Files:     int(t.files.Load()),
+		Skipped:   int(t.skipped.Load()),
+		Failed:    int(t.failed.Load()),
+		Bytes:     max(done-t.resumed, 0),
+		Resumed:   t.resumed,
+		Elapsed:   t.elapsed,
+		Verified:  verified,
+	}
+	if t.elapsed > 0 {
+		s.Speed = int64(float64(s.Bytes) / t.elapsed.Seconds())
+	}
+	if compression.Wire > 0 {
+		s.Compression = &compression
+	}
+	return s
+}
+
+// Summary describes the transfer, or how far it got
+func (d *Delivery) Summary() Summary {
+	return d.tally.summary("send", d.path, d.Sent(), d.Confirmed && len(d.Skipped) == 0, d.Compression)
+}
+
+// Summary describes the last transfer, or how far it got
+func (r *Receiver) Summary() Summary {
+	return r.tally.summary("receive", r.LocalFolder(), r.Received(), r.Verified, r.Compression)
+}
@@ -0,0 +1,51 @@
+package transfer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSummary(t *testing.T) {
+	srcDir := t.TempDir()
+	os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("first file"), 0644)
+	os.WriteFile(filepath.Join(srcDir, "b.bin"), compressibleData(256*1024), 0644)
+	os.WriteFile(filepath.Join(srcDir, "empty"), nil, 0644)
+	sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.Code = "123-456"
+	total := sender.Manifest.TotalSize
+
+	destDir := t.TempDir()
+	tests := []struct {
+		name           string
+		files, skipped int
+		bytes, resumed int64
+	}{
+		{"fresh", 3, 0, total, 0},
+		{"complete already", 1, 2, 0, total},
+	}
+	for _, tt := range tests {
+		var receiver *Receiver
+		delivery, sendErr, recvErr := splitSend(t, context.Background(), sender, destDir, func(r *Receiver) {
+			receiver = r
+		})
+		if sendErr != nil || recvErr != nil {
+			t.Fatalf("%s: send error %v, receive error %v", tt.name, sendErr, recvErr)
+		}
+		for _, s := range []Summary{delivery.Summary(), receiver.Summary()} {
+			if s.Files != tt.files || s.Skipped != tt.skipped || s.Failed != 0 || s.Bytes != tt.bytes || s.Resumed != tt.resumed {
+				t.Errorf("%s: got %+v, want %d files, %d skipped, %d bytes and %d resumed", tt.name, s, tt.files, tt.skipped, tt.bytes, tt.resumed)
+			}
+			if !s.Verified || s.Elapsed <= 0 || s.Compression != nil {
+				t.Errorf("%s: got %+v, want it verified and timed", tt.name, s)
+			}
+		}
+		if s := receiver.Summary(); s.Direction != "receive" || s.Path != filepath.Join(destDir, filepath.Base(srcDir)) {
+			t.Errorf("%s: got %s to %s", tt.name, s.Direction, s.Path)
+		}
+	}
+}
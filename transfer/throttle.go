@@ -0,0 +1,74 @@
+package transfer
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// throttle slows down all transfers and manifests of the process, see SetThrottle
+var throttle = struct {
+	mu      sync.Mutex
+	limiter *rate.Limiter
+	workers int           // Files hashed at once, one per CPU if zero
+	changed chan struct{} // Closed and replaced when the throttle changes
+}{
+	limiter: rate.NewLimiter(rate.Inf, copyBufferSize),
+	changed: make(chan struct{}),
+}
+
+// SetThrottle limits the file data of all transfers to bytesPerSecond and
+// hashing to hashWorkers files at once, such as while the GUI is in the
+// background. Zero lifts a limit. Running transfers and manifests adapt at
+// once.
+func SetThrottle(bytesPerSecond int64, hashWorkers int) {
+	throttle.mu.Lock()
+	defer throttle.mu.Unlock()
+	if bytesPerSecond > 0 {
+		throttle.limiter.SetLimit(rate.Limit(bytesPerSecond))
+	} else {
+		throttle.limiter.SetLimit(rate.Inf)
+	}
+	throttle.workers = max(hashWorkers, 0)
+	close(throttle.changed)
+	throttle.changed = make(chan struct{})
+}
+
+// throttled reports whether file data is limited, which rules out zero copy
+func throttled() bool {
+	return throttle.limiter.Limit() != rate.Inf
+}
+
+// waitThrottle blocks until n more bytes of file data may be copied
+func waitThrottle(ctx context.Context, n int) error {
+	for n > 0 {
+		chunk := min(n, copyBufferSize)
+		if err := throttle.limiter.WaitN(ctx, chunk); err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return cancelledError(ctxErr)
+			}
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+// hashTurn blocks worker of BuildManifestFS while the throttle allows fewer
+// workers, so lowering it takes effect between files
+func hashTurn(ctx context.Context, worker int) error {
+	for {
+		throttle.mu.Lock()
+		limit, changed := throttle.workers, throttle.changed
+		throttle.mu.Unlock()
+		if limit == 0 || worker < limit {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return cancelledError(ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestThrottleRate(t *testing.T) {
+	SetThrottle(4<<20, 0)
+	defer SetThrottle(0, 0)
+
+	// The first copyBufferSize bytes pass at once, the rest at 4 MiB/s
+	data := make([]byte, 2<<20)
+	start := time.Now()
+	copied, readErr, writeErr := copyChunks(context.Background(), io.Discard, bytes.NewReader(data), nil)
+	if readErr != nil || writeErr != nil || copied != int64(len(data)) {
+		t.Fatalf("copyChunks() = %d, %v, %v", copied, readErr, writeErr)
+	}
+	if elapsed := time.Since(start); elapsed < 350*time.Millisecond {
+		t.Errorf("copied 2 MiB in %v, want about 440ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, readErr, _ := copyChunks(ctx, io.Discard, bytes.NewReader(data), nil); CategoryOf(readErr) != CategoryCancelled {
+		t.Errorf("cancelled copy error = %v", readErr)
+	}
+}
+
+func TestThrottleHashWorkers(t *testing.T) {
+	SetThrottle(0, 1)
+	defer SetThrottle(0, 0)
+
+	if err := hashTurn(context.Background(), 0); err != nil {
+		t.Fatalf("first worker blocked: %v", err)
+	}
+	done := make(chan error)
+	go func() { done <- hashTurn(context.Background(), 1) }()
+	select {
+	case err := <-done:
+		t.Fatalf("second worker not held back: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	SetThrottle(0, 0)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("second worker still held back after the throttle was lifted")
+	}
+
+	if throttled() {
+		t.Error("throttled() after lifting the limit")
+	}
+}
@@ -1,11 +1,17 @@
 package transfer
 
 import (
+	"bytes"
+	"context"
 	"io"
+	"io/fs"
 	"net"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 func TestTransfer(t *testing.T) {
@@ -50,7 +56,7 @@ func TestTransfer(t *testing.T) {
 
 		receiver := NewReceiver(destDir)
 		receiver.Code = "123-456" // Set a code for handshake
-		errChan <- receiver.Receive(conn)
+		errChan <- receiver.Receive(context.Background(), conn)
 	}()
 
 	// Run Sender
@@ -62,7 +68,7 @@ func TestTransfer(t *testing.T) {
 		}
 		defer conn.Close()
 
-		sender, err := NewSender(srcDir, false, false, nil)
+		sender, err := NewSender(context.Background(), srcDir, false, false, nil)
 		if err != nil {
 			t.Errorf("Failed to create sender: %v", err)
 			return
@@ -87,7 +93,7 @@ func TestTransfer(t *testing.T) {
 			dataStream = compressed
 		}
 
-		if err := sender.Send(dataStream); err != nil {
+		if _, err := sender.Send(context.Background(), dataStream); err != nil {
 			t.Errorf("Sender failed: %v", err)
 			return
 		}
@@ -149,7 +155,7 @@ func TestTransferSingleFile(t *testing.T) {
 
 		receiver := NewReceiver(destDir)
 		receiver.Code = "123-456"
-		errChan <- receiver.Receive(conn)
+		errChan <- receiver.Receive(context.Background(), conn)
 	}()
 
 	// Run Sender
@@ -161,7 +167,7 @@ func TestTransferSingleFile(t *testing.T) {
 		}
 		defer conn.Close()
 
-		sender, err := NewSender(srcPath, false, false, nil) // Pass file path directly
+		sender, err := NewSender(context.Background(), srcPath, false, false, nil) // Pass file path directly
 		if err != nil {
 			t.Errorf("Failed to create sender: %v", err)
 			return
@@ -185,7 +191,7 @@ func TestTransferSingleFile(t *testing.T) {
 			dataStream = compressed
 		}
 
-		if err := sender.Send(dataStream); err != nil {
+		if _, err := sender.Send(context.Background(), dataStream); err != nil {
 			t.Errorf("Sender failed: %v", err)
 			return
 		}
@@ -204,4 +210,431 @@ func TestTransferSingleFile(t *testing.T) {
 	if string(data) != content {
 		t.Errorf("Content mismatch: got %q, want %q", string(data), content)
 	}
-}
\ No newline at end of file
+}
+func TestBuildManifestCancelled(t *testing.T) {
+	srcDir := t.TempDir()
+	for i := 0; i < 10; i++ {
+		path := filepath.Join(srcDir, "file"+string(rune('a'+i))+".txt")
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := BuildManifest(ctx, srcDir, false, false, nil)
+	if CategoryOf(err) != CategoryCancelled {
+		t.Fatalf("BuildManifest() error = %v, want cancelled", err)
+	}
+}
+
+func TestReceiveCancelled(t *testing.T) {
+	// The sender side never answers, so the receiver blocks until cancelled
+	client, server := net.Pipe()
+	defer server.Close()
+	go io.Copy(io.Discard, server)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errChan := make(chan error, 1)
+	go func() {
+		receiver := NewReceiver(t.TempDir())
+		receiver.Code = "123-456"
+		errChan <- receiver.Receive(ctx, client)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-errChan:
+		if CategoryOf(err) != CategoryCancelled {
+			t.Errorf("Receive() error = %v, want cancelled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Receive() did not return after cancellation")
+	}
+}
+
+func TestTransferEncryptedAtRest(t *testing.T) {
+	srcDir := t.TempDir()
+	content := "sensitive data"
+	srcPath := filepath.Join(srcDir, "secret.txt")
+	if err := os.WriteFile(srcPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	destDir := t.TempDir()
+
+	key, err := NewEncryptionKey("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	errChan := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			errChan <- err
+			return
+		}
+		defer conn.Close()
+
+		receiver := NewReceiver(destDir)
+		receiver.Code = "123-456"
+		receiver.Encryption = key
+		errChan <- receiver.Receive(context.Background(), conn)
+	}()
+
+	go func() {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Errorf("Failed to connect: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		sender, err := NewSender(context.Background(), srcPath, false, false, nil)
+		if err != nil {
+			t.Errorf("Failed to create sender: %v", err)
+			return
+		}
+		sender.Code = "123-456"
+		if err := sender.Handshake(conn); err != nil {
+			t.Errorf("Sender handshake failed: %v", err)
+			return
+		}
+		if _, err := sender.Send(context.Background(), conn); err != nil {
+			t.Errorf("Sender failed: %v", err)
+		}
+	}()
+
+	if err := <-errChan; err != nil {
+		t.Fatalf("Receiver failed: %v", err)
+	}
+
+	plainPath := filepath.Join(destDir, "secret.txt", "secret.txt")
+	if _, err := os.Stat(plainPath); !os.IsNotExist(err) {
+		t.Fatalf("Plaintext file should not exist, stat error: %v", err)
+	}
+
+	encPath := plainPath + EncryptedExt
+	if err := NewDecryptor("correct horse").DecryptFile(encPath, plainPath); err != nil {
+		t.Fatalf("DecryptFile failed: %v", err)
+	}
+	data, err := os.ReadFile(plainPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != content {
+		t.Errorf("Content mismatch: got %q, want %q", string(data), content)
+	}
+}
+
+func TestTransferSelectedFiles(t *testing.T) {
+	srcDir := t.TempDir()
+	os.MkdirAll(filepath.Join(srcDir, "sub"), 0755)
+	os.WriteFile(filepath.Join(srcDir, "keep.txt"), []byte("keep"), 0644)
+	os.WriteFile(filepath.Join(srcDir, "skip.txt"), []byte("skip"), 0644)
+	os.WriteFile(filepath.Join(srcDir, "sub", "skip.bin"), []byte("skip"), 0644)
+
+	sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.Code = "123-456"
+	var mu sync.Mutex
+	var sent []string
+	sender.OnFileComplete = func(name string, verified bool, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			t.Errorf("Sender OnFileComplete(%s) error = %v", name, err)
+		}
+		sent = append(sent, name)
+	}
+
+	destDir := t.TempDir()
+	var started []string
+	completed := make(map[string]bool)
+	var receiver *Receiver
+	delivery, sendErr, recvErr := splitSend(t, context.Background(), sender, destDir, func(r *Receiver) {
+		receiver = r
+		r.OnFileComplete = func(name string, verified bool, err error) {
+			if err != nil {
+				t.Errorf("Receiver OnFileComplete(%s) error = %v", name, err)
+			}
+			completed[name] = verified
+		}
+		r.OnConfirmation = func(m *Manifest) bool {
+			r.Skip = map[string]bool{"skip.txt": true, "sub/skip.bin": true}
+			r.FolderName = "renamed"
+			return true
+		}
+		r.OnStartFile = func(name string, index, total int) {
+			started = append(started, name)
+			if total != 1 {
+				t.Errorf("OnStartFile total = %d, want 1", total)
+			}
+		}
+	})
+	if sendErr != nil || recvErr != nil {
+		t.Fatalf("Send error %v, receive error %v", sendErr, recvErr)
+	}
+
+	if len(started) != 1 || started[0] != "keep.txt" {
+		t.Errorf("Received %v, want only keep.txt", started)
+	}
+	if got, _ := os.ReadFile(filepath.Join(destDir, "renamed", "keep.txt")); string(got) != "keep" {
+		t.Errorf("keep.txt = %q, want it in the renamed folder", got)
+	}
+	if len(completed) != 1 || !completed["keep.txt"] {
+		t.Errorf("Receiver OnFileComplete got %v, want keep.txt verified", completed)
+	}
+	if got := receiver.LocalPath("keep.txt"); got != filepath.Join(destDir, "renamed", "keep.txt") {
+		t.Errorf("LocalPath(keep.txt) = %s", got)
+	}
+	mu.Lock()
+	if len(sent) != 1 || sent[0] != "keep.txt" {
+		t.Errorf("Sender OnFileComplete got %v, want keep.txt", sent)
+	}
+	mu.Unlock()
+	for _, skipped := range []string{"skip.txt", "sub/skip.bin"} {
+		if _, err := os.Stat(filepath.Join(destDir, "renamed", skipped)); !os.IsNotExist(err) {
+			t.Errorf("Deselected file %s was written", skipped)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(destDir, filepath.Base(srcDir))); !os.IsNotExist(err) {
+		t.Error("Transfer was saved under the manifest's folder name")
+	}
+	if len(delivery.Skipped) != 2 {
+		t.Errorf("Delivery.Skipped = %v, want the 2 deselected files", delivery.Skipped)
+	}
+	// Only the selected file counts as done
+	if delivery.Sent() != 4 || receiver.Received() != 4 {
+		t.Errorf("Sent %d and received %d bytes, want 4", delivery.Sent(), receiver.Received())
+	}
+	if receiver.Root() != "" {
+		t.Error("A partial transfer has no verified root")
+	}
+}
+
+func TestTransferInvalidFolderName(t *testing.T) {
+	srcDir := t.TempDir()
+	os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0644)
+	sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.Code = "123-456"
+
+	for _, name := range []string{"..", "a/b", `a\b`} {
+		_, recvErr := splitTransfer(t, context.Background(), sender, t.TempDir(), func(r *Receiver) {
+			r.FolderName = name
+		})
+		if CategoryOf(recvErr) != CategoryValidation {
+			t.Errorf("FolderName %q: receive error %v, want a validation error", name, recvErr)
+		}
+	}
+}
+
+// memStorage keeps files in memory once their writer is closed
+type memStorage struct {
+	mu      sync.Mutex
+	files   map[string]string
+	aborted int
+}
+
+type memFile struct {
+	bytes.Buffer
+	s    *memStorage
+	path string
+}
+
+func (s *memStorage) Open(path string) (io.WriteCloser, error) {
+	return &memFile{s: s, path: path}, nil
+}
+
+func (f *memFile) Close() error {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	f.s.files[f.path] = f.String()
+	return nil
+}
+
+func (f *memFile) Abort() error {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	f.s.aborted++
+	return nil
+}
+
+func TestTransferToStorage(t *testing.T) {
+	srcDir := t.TempDir()
+	os.MkdirAll(filepath.Join(srcDir, "sub"), 0755)
+	os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("alpha"), 0644)
+	os.WriteFile(filepath.Join(srcDir, "sub", "CON.txt"), []byte("beta"), 0644)
+
+	sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.Code = "123-456"
+
+	store := &memStorage{files: make(map[string]string)}
+	var receiver *Receiver
+	sendErr, recvErr := splitTransfer(t, context.Background(), sender, "mem://bucket/in/", func(r *Receiver) {
+		receiver = r
+		r.Storage = store
+	})
+	if sendErr != nil || recvErr != nil {
+		t.Fatalf("Send error %v, receive error %v", sendErr, recvErr)
+	}
+
+	folder := filepath.Base(srcDir)
+	// Names that are reserved on Windows are kept in storage
+	want := map[string]string{folder + "/a.txt": "alpha", folder + "/sub/CON.txt": "beta"}
+	if len(store.files) != len(want) || store.aborted != 0 {
+		t.Errorf("stored %v with %d aborted, want %v", store.files, store.aborted, want)
+	}
+	for name, data := range want {
+		if store.files[name] != data {
+			t.Errorf("%s = %q, want %q", name, store.files[name], data)
+		}
+	}
+	if got := receiver.LocalFolder(); got != "mem://bucket/in/"+folder {
+		t.Errorf("LocalFolder() = %s", got)
+	}
+	if len(receiver.Renamed) != 0 || !receiver.Verified {
+		t.Errorf("Renamed = %v, Verified = %v, want nothing renamed and the root verified", receiver.Renamed, receiver.Verified)
+	}
+}
+
+// shortReads returns files that read a little at a time, as remote sources do
+type shortReads struct{ fs.FS }
+
+func (s shortReads) Open(name string) (fs.File, error) {
+	f, err := s.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := f.Stat(); err != nil || info.IsDir() {
+		return f, err
+	}
+	return shortFile{f}, nil
+}
+
+type shortFile struct{ fs.File }
+
+func (f shortFile) Read(p []byte) (int, error) {
+	return f.File.Read(p[:min(len(p), 1000)])
+}
+
+func TestBuildManifestFS(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), BlockSize/10+100)
+	srcDir := t.TempDir()
+	os.MkdirAll(filepath.Join(srcDir, "sub"), 0755)
+	os.WriteFile(filepath.Join(srcDir, "big.bin"), data, 0644)
+	os.WriteFile(filepath.Join(srcDir, "sub", "a.txt"), []byte("alpha"), 0644)
+	local, err := BuildManifest(context.Background(), srcDir, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := shortReads{fstest.MapFS{
+		"big.bin":   {Data: data, Mode: 0644},
+		"sub/a.txt": {Data: []byte("alpha"), Mode: 0644},
+	}}
+	manifest, err := BuildManifestFS(context.Background(), fsys, "mem", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.FolderName != "mem" || manifest.TotalSize != local.TotalSize || manifest.MerkleRoot() == "" {
+		t.Errorf("manifest = %+v", manifest)
+	}
+	// Both hash the same blocks although the files read in small pieces
+	local.FolderName = "mem"
+	if manifest.MerkleRoot() != local.MerkleRoot() {
+		t.Error("manifest of the files in memory differs from the one on disk")
+	}
+}
+
+func TestTransferFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt":        {Data: []byte("alpha")},
+		"sub/café.txt": {Data: []byte("beta")},
+	}
+	sender, err := NewSenderFS(context.Background(), shortReads{fsys}, "mem", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.Code = "123-456"
+
+	destDir := t.TempDir()
+	sendErr, recvErr := splitTransfer(t, context.Background(), sender, destDir, nil)
+	if sendErr != nil || recvErr != nil {
+		t.Fatalf("Send error %v, receive error %v", sendErr, recvErr)
+	}
+	for name, file := range fsys {
+		got, err := os.ReadFile(filepath.Join(destDir, "mem", filepath.FromSlash(name)))
+		if err != nil || !bytes.Equal(got, file.Data) {
+			t.Errorf("%s = %q, %v, want %q", name, got, err, file.Data)
+		}
+	}
+}
+
+func TestTransferSegmented(t *testing.T) {
+	for _, split := range []bool{false, true} {
+		srcDir := t.TempDir()
+		data := compressibleData(2*MinSegmentSize + MinSegmentSize/2)
+		os.WriteFile(filepath.Join(srcDir, "big.bin"), data, 0644)
+		os.WriteFile(filepath.Join(srcDir, "small.txt"), []byte("small"), 0644)
+		sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sender.Code = "123-456"
+
+		var mu sync.Mutex
+		starts := make(map[string]int)
+		verified := make(map[string]bool)
+		destDir := t.TempDir()
+		sendErr, recvErr := splitTransfer(t, context.Background(), sender, destDir, func(r *Receiver) {
+			if !split {
+				r.DataStream = nil
+			}
+			r.SegmentSize = MinSegmentSize
+			r.OnStartFile = func(filename string, current, total int) {
+				mu.Lock()
+				starts[filename]++
+				mu.Unlock()
+			}
+			r.OnFileComplete = func(filename string, ok bool, err error) {
+				mu.Lock()
+				verified[filename] = ok && err == nil
+				mu.Unlock()
+			}
+		})
+		if sendErr != nil || recvErr != nil {
+			t.Fatalf("Split %v: send error %v, receive error %v", split, sendErr, recvErr)
+		}
+
+		got, err := os.ReadFile(filepath.Join(destDir, filepath.Base(srcDir), "big.bin"))
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("Split %v: big.bin differs from the original, %v", split, err)
+		}
+		mu.Lock()
+		if starts["big.bin"] != 1 || starts["small.txt"] != 1 {
+			t.Errorf("Split %v: OnStartFile calls = %v, want one per file", split, starts)
+		}
+		if !verified["big.bin"] || !verified["small.txt"] {
+			t.Errorf("Split %v: verified = %v, want every file", split, verified)
+		}
+		mu.Unlock()
+	}
+}
@@ -0,0 +1,81 @@
+package transfer
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// normalizeManifest converts the paths of m to Unicode NFC, the form used by
+// Linux and Windows. macOS file systems store NFD, so without this the same
+// name would not match on the other side. Returns the original paths of the
+// entries that changed.
+func normalizeManifest(m *Manifest) map[string]string {
+	original := make(map[string]string)
+	if name := norm.NFC.String(m.FolderName); name != m.FolderName {
+		original[name] = m.FolderName
+		m.FolderName = name
+	}
+	for i := range m.Files {
+		f := &m.Files[i]
+		if p := norm.NFC.String(f.Path); p != f.Path {
+			original[p] = f.Path
+			f.Path = p
+		}
+	}
+	return original
+}
+
+// nameResolver finds existing files whose name only differs from the one
+// asked for in Unicode normalization. Directory listings are cached, so it
+// only finds files that existed before the first lookup in a directory.
+type nameResolver struct {
+	mu   sync.Mutex
+	dirs map[string]map[string]string // Directory to NFC name to name on disk
+}
+
+// ResolveName returns path, or the existing file that matches it after
+// Unicode normalization
+func ResolveName(path string) string {
+	return new(nameResolver).resolve(path)
+}
+
+func (n *nameResolver) resolve(path string) string {
+	if _, err := os.Lstat(longPath(path)); err == nil || !os.IsNotExist(err) {
+		return path
+	}
+	dir := filepath.Dir(path)
+	if dir == path {
+		return path
+	}
+	dir = n.resolve(dir)
+
+	// Names like plain ASCII have no other form to look for
+	base := filepath.Base(path)
+	if !norm.NFC.IsNormalString(base) || !norm.NFD.IsNormalString(base) {
+		if name, ok := n.list(dir)[norm.NFC.String(base)]; ok {
+			return filepath.Join(dir, name)
+		}
+	}
+	return filepath.Join(dir, base)
+}
+
+func (n *nameResolver) list(dir string) map[string]string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if names, ok := n.dirs[dir]; ok {
+		return names
+	}
+	if n.dirs == nil {
+		n.dirs = make(map[string]map[string]string)
+	}
+	names := make(map[string]string)
+	entries, _ := os.ReadDir(longPath(dir))
+	for _, e := range entries {
+		names[norm.NFC.String(e.Name())] = e.Name()
+	}
+	n.dirs[dir] = names
+	return names
+}
@@ -0,0 +1,65 @@
+package transfer
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+func TestSenderNormalizesNames(t *testing.T) {
+	nfd := norm.NFD.String("café.txt")
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, nfd), []byte("latte"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sender.Manifest.Files[0].Path; got != "café.txt" || !norm.NFC.IsNormalString(got) {
+		t.Errorf("Manifest path %q is not NFC", got)
+	}
+	// A resumed session's sender only has the manifest to go by
+	resumed := &Sender{FolderPath: srcDir, Manifest: sender.Manifest}
+	for _, s := range []*Sender{sender, resumed} {
+		file, err := s.openFile(sender.Manifest.Files[0].Path)
+		if err != nil {
+			t.Fatalf("Normalized path does not resolve to the file on disk: %v", err)
+		}
+		data, _ := io.ReadAll(file)
+		file.Close()
+		if string(data) != "latte" {
+			t.Errorf("read %q, want latte", data)
+		}
+	}
+
+	sender.PreserveNames()
+	if got := sender.Manifest.Files[0].Path; got != nfd {
+		t.Errorf("PreserveNames left %q, want the NFD name", got)
+	}
+}
+
+func TestResolveName(t *testing.T) {
+	dir := t.TempDir()
+	nfdDir := filepath.Join(dir, norm.NFD.String("réunion"))
+	if err := os.MkdirAll(nfdDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	nfdFile := filepath.Join(nfdDir, norm.NFD.String("ñ.txt"))
+	if err := os.WriteFile(nfdFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := ResolveName(filepath.Join(dir, "réunion", "ñ.txt")); got != nfdFile {
+		t.Errorf("ResolveName = %q, want %q", got, nfdFile)
+	}
+	missing := filepath.Join(dir, "missing.txt")
+	if got := ResolveName(missing); got != missing {
+		t.Errorf("ResolveName of a missing file = %q", got)
+	}
+}
@@ -0,0 +1,180 @@
+package transfer
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"lukechampine.com/blake3"
+)
+
+// VerifyStatus describes how a file compares to its manifest entry
+type VerifyStatus string
+
+const (
+	VerifyOK       VerifyStatus = "ok"
+	VerifyMissing  VerifyStatus = "missing"
+	VerifySize     VerifyStatus = "size mismatch"
+	VerifyCorrupt  VerifyStatus = "corrupt"
+	VerifyUnhashed VerifyStatus = "no checksum" // Manifest was built with hashing skipped
+	VerifyExtra    VerifyStatus = "not in manifest"
+)
+
+// VerifyResult is the outcome of checking one file
+type VerifyResult struct {
+	Path     string
+	Status   VerifyStatus
+	BadBlock int // Index of the first corrupt block, -1 if unknown
+}
+
+// SaveManifest writes a standalone manifest file
+func SaveManifest(m *Manifest, path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// LoadManifest reads a manifest written by SaveManifest
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// VerifyManifest checks the files at path against m without transferring
+// anything. path is the folder the manifest was built from, or the file for
+// single file manifests. Files under the folder that are not in the manifest
+// are reported as VerifyExtra.
+func VerifyManifest(ctx context.Context, path string, m *Manifest, onProgress ManifestProgressFunc) ([]VerifyResult, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot access path: %w", err)
+	}
+	root := path
+	if !info.IsDir() {
+		root = filepath.Dir(path)
+	}
+
+	var results []VerifyResult
+	known := make(map[string]bool, len(m.Files))
+	for _, entry := range m.Files {
+		if err := ctx.Err(); err != nil {
+			return nil, cancelledError(err)
+		}
+
+		localPath := filepath.Join(root, filepath.FromSlash(entry.Path))
+		if err := validatePath(localPath, root); err != nil {
+			return nil, validationError("invalid file path in manifest: "+entry.Path, err)
+		}
+		known[filepath.Clean(localPath)] = true
+
+		if onProgress != nil {
+			onProgress(entry.Path, entry.Size)
+		}
+		result, err := verifyFile(ctx, localPath, entry)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	if !info.IsDir() {
+		return results, nil
+	}
+
+	err = filepath.Walk(root, func(walkPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || known[filepath.Clean(walkPath)] || filepath.Base(walkPath) == ".2c1f_manifest.json" {
+			return nil
+		}
+		relPath, err := filepath.Rel(root, walkPath)
+		if err != nil {
+			return err
+		}
+		results = append(results, VerifyResult{Path: filepath.ToSlash(relPath), Status: VerifyExtra, BadBlock: -1})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk folder: %w", err)
+	}
+	return results, nil
+}
+
+func verifyFile(ctx context.Context, path string, entry FileEntry) (VerifyResult, error) {
+	result := VerifyResult{Path: entry.Path, Status: VerifyOK, BadBlock: -1}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		result.Status = VerifyMissing
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	if info.Size() != entry.Size {
+		result.Status = VerifySize
+		return result, nil
+	}
+	if entry.Checksum == "" {
+		result.Status = VerifyUnhashed
+		return result, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return result, err
+	}
+	defer f.Close()
+
+	blockSize := entry.BlockSize
+	if blockSize == 0 {
+		blockSize = LegacyBlockSize
+	}
+
+	hasher := blake3.New(32, nil)
+	pooled := getBlock(blockSize)
+	defer putBlock(pooled)
+	buf := *pooled
+	for block := 0; ; block++ {
+		if err := ctx.Err(); err != nil {
+			return result, cancelledError(err)
+		}
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			hasher.Write(buf[:n])
+			if result.BadBlock < 0 && block < len(entry.BlockHashes) {
+				sum := blake3.Sum256(buf[:n])
+				if hex.EncodeToString(sum[:]) != entry.BlockHashes[block] {
+					result.BadBlock = block
+				}
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if hex.EncodeToString(hasher.Sum(nil)) != entry.Checksum {
+		result.Status = VerifyCorrupt
+	} else {
+		result.BadBlock = -1
+	}
+	return result, nil
+}
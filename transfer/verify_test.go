@@ -0,0 +1,103 @@
+package transfer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyManifest(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.txt":     "alpha",
+		"sub/b.txt": "bravo",
+		"big.bin":   string(make([]byte, 3*BlockSize+10)),
+		"gone.txt":  "soon deleted",
+	}
+	for path, content := range files {
+		full := filepath.Join(dir, path)
+		os.MkdirAll(filepath.Dir(full), 0755)
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := BuildManifest(context.Background(), dir, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+	if err := SaveManifest(m, manifestPath); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadManifest(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := VerifyManifest(context.Background(), dir, loaded, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.Status != VerifyOK {
+			t.Errorf("%s: status %q before changes, want ok", r.Path, r.Status)
+		}
+	}
+
+	// Corrupt the third block of big.bin without changing its size
+	f, err := os.OpenFile(filepath.Join(dir, "big.bin"), os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte{1}, 2*BlockSize+5)
+	f.Close()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("alpha!"), 0644)
+	os.Remove(filepath.Join(dir, "gone.txt"))
+	os.WriteFile(filepath.Join(dir, "new.txt"), []byte("new"), 0644)
+
+	results, err = VerifyManifest(context.Background(), dir, loaded, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]VerifyResult)
+	for _, r := range results {
+		got[r.Path] = r
+	}
+
+	want := map[string]VerifyStatus{
+		"a.txt":     VerifySize,
+		"sub/b.txt": VerifyOK,
+		"big.bin":   VerifyCorrupt,
+		"gone.txt":  VerifyMissing,
+		"new.txt":   VerifyExtra,
+	}
+	for path, status := range want {
+		if got[path].Status != status {
+			t.Errorf("%s: status %q, want %q", path, got[path].Status, status)
+		}
+	}
+	if got["big.bin"].BadBlock != 2 {
+		t.Errorf("big.bin: bad block %d, want 2", got["big.bin"].BadBlock)
+	}
+}
+
+func TestVerifyManifestSingleFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "single.txt")
+	if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := BuildManifest(context.Background(), path, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := VerifyManifest(context.Background(), path, m, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != VerifyOK {
+		t.Errorf("results = %+v, want single ok", results)
+	}
+}
@@ -0,0 +1,142 @@
+package transfer
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// MaxWindowsPath is the length above which Windows needs the \\?\ prefix
+const MaxWindowsPath = 260
+
+// windowsNames makes the receiver save names that are invalid on Windows
+// under an escaped name. Tests enable it on other systems.
+var windowsNames = runtime.GOOS == "windows"
+
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// WindowsNameIssue describes why a single path component cannot be created
+// on Windows, or returns "" if it can
+func WindowsNameIssue(name string) string {
+	base, _, _ := strings.Cut(name, ".")
+	switch {
+	case reservedNames[strings.ToUpper(strings.TrimRight(base, " "))]:
+		return "reserved device name"
+	case strings.HasSuffix(name, ".") || strings.HasSuffix(name, " "):
+		return "ends with a dot or space"
+	case strings.ContainsFunc(name, invalidWindowsRune):
+		return "contains a character Windows does not allow"
+	}
+	return ""
+}
+
+func invalidWindowsRune(r rune) bool {
+	return r < 32 || strings.ContainsRune(`<>:"\|?*`, r)
+}
+
+// windowsName escapes a path component that is invalid on Windows. Reserved
+// names get an underscore after the base name, so CON.txt becomes CON_.txt.
+func windowsName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if invalidWindowsRune(r) {
+			return '_'
+		}
+		return r
+	}, name)
+
+	trimmed := strings.TrimRight(name, ". ")
+	name = trimmed + strings.Repeat("_", len(name)-len(trimmed))
+
+	base, ext, hasExt := strings.Cut(name, ".")
+	if reservedNames[strings.ToUpper(strings.TrimRight(base, " "))] {
+		name = base + "_"
+		if hasExt {
+			name += "." + ext
+		}
+	}
+	return name
+}
+
+// localName converts a slash separated manifest path to the relative path
+// the file is saved under on this system
+func localName(p string) string {
+	if !windowsNames {
+		return filepath.FromSlash(p)
+	}
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		if part != "" && part != "." && part != ".." {
+			parts[i] = windowsName(part)
+		}
+	}
+	return filepath.FromSlash(strings.Join(parts, "/"))
+}
+
+// collidingNames returns two files of files, not counting those in skip,
+// that localName saves under the same name. Escaping maps several names to
+// one, such as a:b and a_b, and Windows does not tell names apart by case.
+func collidingNames(files []FileEntry, skip map[string]bool) (string, string, bool) {
+	if !windowsNames {
+		return "", "", false
+	}
+	seen := make(map[string]string)
+	for _, f := range files {
+		if skip[f.Path] {
+			continue
+		}
+		key := strings.ToLower(localName(f.Path))
+		if other, ok := seen[key]; ok && other != f.Path {
+			return other, f.Path, true
+		}
+		seen[key] = f.Path
+	}
+	return "", "", false
+}
+
+// longPath adds the \\?\ prefix Windows needs to open paths longer than
+// MaxWindowsPath. Directories are limited to 248 characters, so the prefix
+// is added from there on. Other systems get p unchanged.
+func longPath(p string) string {
+	if runtime.GOOS != "windows" || len(p) < MaxWindowsPath-12 || strings.HasPrefix(p, `\\?\`) {
+		return p
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return p
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
+
+// PortabilityWarnings lists the files of m that Windows receivers save
+// under a different name or only with long path support
+func PortabilityWarnings(m *Manifest) []string {
+	var warnings []string
+	check := func(p string) {
+		for _, part := range strings.Split(p, "/") {
+			if issue := WindowsNameIssue(part); issue != "" {
+				warnings = append(warnings, fmt.Sprintf("%s: %q %s, Windows receivers save it as %q", p, part, issue, windowsName(part)))
+				return
+			}
+		}
+	}
+
+	check(m.FolderName)
+	for _, f := range m.Files {
+		check(f.Path)
+		if full := path.Join(m.FolderName, f.Path); len(full) >= MaxWindowsPath {
+			warnings = append(warnings, fmt.Sprintf("%s: path is %d characters long, some Windows programs cannot open it", f.Path, len(full)))
+		}
+	}
+	return warnings
+}
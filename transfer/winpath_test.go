@@ -0,0 +1,128 @@
+package transfer
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWindowsName(t *testing.T) {
+	tests := map[string]string{
+		"file.txt":    "file.txt",
+		"CON":         "CON_",
+		"con.txt":     "con_.txt",
+		"nul.tar.gz":  "nul_.tar.gz",
+		"LPT1":        "LPT1_",
+		"COM10":       "COM10",
+		"console.log": "console.log",
+		"name.":       "name_",
+		"name. .":     "name___",
+		"a:b?.txt":    "a_b_.txt",
+		"tab\there":   "tab_here",
+	}
+	for name, want := range tests {
+		if got := windowsName(name); got != want {
+			t.Errorf("windowsName(%q) = %q, want %q", name, got, want)
+		}
+		if WindowsNameIssue(want) != "" {
+			t.Errorf("Escaped name %q is still invalid: %s", want, WindowsNameIssue(want))
+		}
+	}
+}
+
+func TestCollidingNames(t *testing.T) {
+	windowsNames = true
+	defer func() { windowsNames = false }()
+
+	files := []FileEntry{{Path: "a:b.txt"}, {Path: "sub/CON_"}, {Path: "a_b.txt"}}
+	if a, b, ok := collidingNames(files, nil); !ok || a != "a:b.txt" || b != "a_b.txt" {
+		t.Errorf("collidingNames() = %q, %q, %t, want a:b.txt and a_b.txt", a, b, ok)
+	}
+	if _, _, ok := collidingNames(files, map[string]bool{"a_b.txt": true}); ok {
+		t.Error("collidingNames() counted a skipped file")
+	}
+	files = []FileEntry{{Path: "sub/CON"}, {Path: "Sub/con_"}}
+	if _, _, ok := collidingNames(files, nil); !ok {
+		t.Error("collidingNames() missed names that only differ in case")
+	}
+	if _, _, ok := collidingNames([]FileEntry{{Path: "x.txt"}, {Path: "y.txt"}}, nil); ok {
+		t.Error("collidingNames() reported distinct names")
+	}
+}
+
+func TestPortabilityWarnings(t *testing.T) {
+	long := strings.Repeat("d", 100) + "/" + strings.Repeat("e", 100) + "/" + strings.Repeat("f", 100)
+	m := &Manifest{
+		FolderName: "share",
+		Files: []FileEntry{
+			{Path: "ok.txt"},
+			{Path: "sub/AUX.txt"},
+			{Path: "trailing. "},
+			{Path: long},
+		},
+	}
+	if got := PortabilityWarnings(m); len(got) != 3 {
+		t.Errorf("Expected 3 warnings, got %d: %v", len(got), got)
+	}
+}
+
+func TestReceiveEscapesWindowsNames(t *testing.T) {
+	windowsNames = true
+	defer func() { windowsNames = false }()
+
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "CON.txt"), []byte("device"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	destDir := t.TempDir()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	receiver := NewReceiver(destDir)
+	receiver.Code = "123-456"
+	errChan := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			errChan <- err
+			return
+		}
+		defer conn.Close()
+		errChan <- receiver.Receive(context.Background(), conn)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	sender, err := NewSender(context.Background(), srcDir, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.Code = "123-456"
+	if err := sender.Handshake(conn); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if _, err := sender.Send(context.Background(), conn); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if err := <-errChan; err != nil {
+		t.Fatalf("Receive failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(receiver.LocalFolder(), "CON_.txt"))
+	if err != nil || string(data) != "device" {
+		t.Fatalf("Escaped file not received: %v", err)
+	}
+	if got := receiver.Renamed["CON.txt"]; got != "CON_.txt" {
+		t.Errorf("Renamed[CON.txt] = %q, want CON_.txt", got)
+	}
+}
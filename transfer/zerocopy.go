@@ -0,0 +1,98 @@
+package transfer
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// zeroCopyChunk bounds each kernel side copy, so progress is reported and
+// cancellation is noticed regularly
+const zeroCopyChunk = 8 << 20
+
+// zeroCopy can be turned off to compare against the copy loop
+var zeroCopy = true
+
+// tlsConn is a TLS connection, also one wrapping *tls.Conn such as the LAN
+// fallback's p2p.LANConn
+type tlsConn interface {
+	net.Conn
+	ConnectionState() tls.ConnectionState
+}
+
+// zeroCopyConn returns the connection under stream if file data can skip the
+// copy loop, or nil. Plain TCP and Unix connections get it from the kernel
+// with sendfile or splice. TLS connections have to encrypt it, but read it
+// straight into their records instead of through the buffer of stream.
+// Compressed streams need to see the data, and so does SetThrottle.
+func zeroCopyConn(stream io.Writer) net.Conn {
+	if !zeroCopy || throttled() {
+		return nil
+	}
+	if b, ok := stream.(*BufferedDeadlineWriter); ok {
+		stream = b.Underlying
+	}
+	switch c := stream.(type) {
+	case *net.TCPConn:
+		return c
+	case *net.UnixConn:
+		return c
+	case tlsConn:
+		return c
+	}
+	return nil
+}
+
+// copyZero sends n bytes of file to conn, see zeroCopyConn. Data buffered in
+// stream is flushed first. Errors are reported like copyChunks, but the
+// kernel does not tell read and write failures apart, so both are write
+// errors.
+func copyZero(ctx context.Context, stream io.Writer, conn net.Conn, file *os.File, n int64, timeout time.Duration, onChunk func(copied int64)) (copied int64, readErr, writeErr error) {
+	if f, ok := stream.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	// TCP and Unix connections read from the file in the kernel, others
+	// through a buffer of the pool
+	rf, kernel := conn.(io.ReaderFrom)
+	var buf *[]byte
+	if !kernel {
+		buf = chunkPool.Get().(*[]byte)
+		defer chunkPool.Put(buf)
+	}
+	for copied < n {
+		if err := ctx.Err(); err != nil {
+			return copied, cancelledError(err), nil
+		}
+		chunk := n - copied
+		if chunk > zeroCopyChunk {
+			chunk = zeroCopyChunk
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(timeout))
+		var written int64
+		var err error
+		if kernel {
+			written, err = rf.ReadFrom(io.LimitReader(file, chunk))
+		} else {
+			written, err = io.CopyBuffer(conn, io.LimitReader(file, chunk), *buf)
+		}
+		copied += written
+		if written > 0 && onChunk != nil {
+			onChunk(copied)
+		}
+		if err != nil {
+			return copied, nil, err
+		}
+		if written < chunk {
+			// The file is shorter than the manifest says
+			break
+		}
+	}
+	return copied, nil, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+
+	"github.com/ebob10000/2c1f/events"
+	"github.com/ebob10000/2c1f/transfer"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// transferWatcher passes events on and reports when the running transfer ends
+type transferWatcher struct {
+	events.Emitter
+	onEnd func()
+}
+
+func (w transferWatcher) Emit(name string, data ...interface{}) {
+	w.Emitter.Emit(name, data...)
+	if name == "transfer_complete" || name == "error" {
+		w.onEnd()
+	}
+}
+
+// backgroundHashWorkers is how many files are hashed at once in background mode
+const backgroundHashWorkers = 1
+
+// MinimizeToTray hides the window. A running transfer continues in the background.
+func (a *App) MinimizeToTray() {
+	a.SetBackgroundMode(true)
+	runtime.WindowHide(a.ctx)
+}
+
+// RestoreFromTray shows the window again and stops a pending background exit
+func (a *App) RestoreFromTray() {
+	a.nodeMu.Lock()
+	a.quitWhenIdle = false
+	a.nodeMu.Unlock()
+
+	a.SetBackgroundMode(false)
+	runtime.WindowShow(a.ctx)
+	runtime.WindowUnminimise(a.ctx)
+}
+
+// SetBackgroundMode gives transfers a lower priority while the window is
+// in the background or the user asks for it: BackgroundRateLimit caps their
+// speed and fewer files are hashed at once. Off lifts the throttle.
+func (a *App) SetBackgroundMode(on bool) {
+	a.nodeMu.Lock()
+	a.background = on
+	a.nodeMu.Unlock()
+	a.applyThrottle()
+}
+
+// applyThrottle throttles transfers as background mode and the settings ask
+func (a *App) applyThrottle() {
+	a.nodeMu.Lock()
+	on := a.background
+	limit := a.settings.BackgroundRateLimit
+	a.nodeMu.Unlock()
+
+	if !on {
+		transfer.SetThrottle(0, 0)
+		return
+	}
+	transfer.SetThrottle(int64(limit)*1024, backgroundHashWorkers)
+}
+
+// beforeClose keeps the app running without a window while a transfer is
+// active in background mode. The app exits once the transfer ends.
+func (a *App) beforeClose(ctx context.Context) bool {
+	a.nodeMu.Lock()
+	keep := a.settings.BackgroundMode && a.transferActive
+	if keep {
+		a.quitWhenIdle = true
+	}
+	a.nodeMu.Unlock()
+
+	if keep {
+		a.MinimizeToTray()
+	}
+	return keep
+}
+
+// transferEnded marks the transfer as finished and exits if the window was
+// closed in background mode
+func (a *App) transferEnded() {
+	a.nodeMu.Lock()
+	a.transferActive = false
+	quit := a.quitWhenIdle
+	a.nodeMu.Unlock()
+
+	if quit {
+		runtime.Quit(a.ctx)
+	}
+}
@@ -4,15 +4,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
 	"strings"
 )
 
 // GitHubRelease represents a GitHub release
 type GitHubRelease struct {
-	TagName string  `json:"tag_name"`
-	Name    string  `json:"name"`
-	Assets  []Asset `json:"assets"`
+	TagName    string  `json:"tag_name"`
+	Name       string  `json:"name"`
+	Body       string  `json:"body"` // Release notes in Markdown
+	Prerelease bool    `json:"prerelease"`
+	Draft      bool    `json:"draft"`
+	Assets     []Asset `json:"assets"`
 }
 
 // Asset represents a release asset (downloadable file)
@@ -21,42 +23,73 @@ type Asset struct {
 	BrowserDownloadURL string `json:"browser_download_url"`
 	Size               int64  `json:"size"`
 	Checksum           string `json:"-"` // Populated separately from checksums file
+	SignatureURL       string `json:"-"` // Detached minisign signature, empty if the release has none
 }
 
 // FetchLatestRelease fetches the latest release from GitHub
 func FetchLatestRelease(repo string) (*GitHubRelease, error) {
 	url := fmt.Sprintf("https://api.github.com/repos/%s/releases/latest", repo)
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	var release GitHubRelease
+	if err := fetchJSON(url, &release); err != nil {
+		return nil, err
+	}
+
+	return &release, nil
+}
+
+// FetchReleases fetches the most recent releases from GitHub, including pre-releases
+func FetchReleases(repo string) ([]GitHubRelease, error) {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/releases?per_page=30", repo)
+
+	var releases []GitHubRelease
+	if err := fetchJSON(url, &releases); err != nil {
+		return nil, err
+	}
+
+	return releases, nil
+}
+
+// FetchRelease fetches the release for a specific version on the given channel
+func FetchRelease(repo, version, channel string) (*GitHubRelease, error) {
+	if channel != ChannelBeta {
+		return FetchLatestRelease(repo)
 	}
 
-	// Set User-Agent to avoid GitHub API rate limiting issues
-	req.Header.Set("User-Agent", "2c1f-updater")
+	releases, err := FetchReleases(repo)
+	if err != nil {
+		return nil, err
+	}
+	for i := range releases {
+		if strings.TrimPrefix(releases[i].TagName, "v") == version {
+			return &releases[i], nil
+		}
+	}
+	return nil, fmt.Errorf("release %s not found", version)
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+func fetchJSON(url string, v interface{}) error {
+	// httpGet sets a User-Agent to avoid GitHub API rate limiting issues
+	resp, err := httpGet(url)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch release: %w", err)
+		return fmt.Errorf("failed to fetch release: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == 403 {
-		return nil, fmt.Errorf("GitHub API rate limit exceeded")
+		return fmt.Errorf("GitHub API rate limit exceeded")
 	}
 
 	if resp.StatusCode != 200 {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("GitHub API returned status %d: %s", resp.StatusCode, string(body))
+		return fmt.Errorf("GitHub API returned status %d: %s", resp.StatusCode, string(body))
 	}
 
-	var release GitHubRelease
-	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
-		return nil, fmt.Errorf("failed to parse release JSON: %w", err)
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse release JSON: %w", err)
 	}
 
-	return &release, nil
+	return nil
 }
 
 // GetAssetForPlatform finds the correct asset for the given OS and architecture
@@ -93,6 +126,13 @@ func GetAssetForPlatform(release *GitHubRelease, goos, goarch string) (*Asset, e
 		return nil, fmt.Errorf("no matching asset found for %s/%s (looking for pattern: %s)", goos, goarch, pattern)
 	}
 
+	for i := range release.Assets {
+		if release.Assets[i].Name == matchedAsset.Name+SignatureExt {
+			matchedAsset.SignatureURL = release.Assets[i].BrowserDownloadURL
+			break
+		}
+	}
+
 	// Try to fetch checksums and populate checksum field
 	checksums, err := FetchChecksums(release)
 	if err == nil && checksums != nil {
@@ -129,7 +169,7 @@ func FetchChecksums(release *GitHubRelease) (map[string]string, error) {
 	}
 
 	// Download checksums file
-	resp, err := http.Get(checksumAsset.BrowserDownloadURL)
+	resp, err := httpGet(checksumAsset.BrowserDownloadURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to download checksums file: %w", err)
 	}
@@ -0,0 +1,54 @@
+package updater
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Network settings for GitHub API requests and downloads, configured once at startup
+var (
+	Proxy           = ""               // Explicit proxy URL; HTTPS_PROXY/HTTP_PROXY/NO_PROXY are honored if empty
+	Timeout         = 30 * time.Second // How long to wait for a response or for more data before giving up
+	DownloadRetries = 4                // Extra attempts after an interrupted download
+	RetryDelay      = 2 * time.Second  // Base delay between download attempts, doubled each time
+)
+
+// httpClient returns a client using the configured proxy and timeouts. Body
+// reads are not bounded by the client so large downloads are not cut off.
+func httpClient() (*http.Client, error) {
+	proxy := http.ProxyFromEnvironment
+	if Proxy != "" {
+		proxyURL, err := url.Parse(Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           (&net.Dialer{Timeout: Timeout, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   Timeout,
+		ResponseHeaderTimeout: Timeout,
+		IdleConnTimeout:       90 * time.Second,
+		ForceAttemptHTTP2:     true,
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// httpGet performs a GET with the configured client and a User-Agent GitHub accepts
+func httpGet(rawURL string) (*http.Response, error) {
+	client, err := httpClient()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", "2c1f-updater")
+	return client.Do(req)
+}
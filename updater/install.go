@@ -0,0 +1,118 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// InstallKind describes how the running binary was installed
+type InstallKind int
+
+const (
+	InstallPortable  InstallKind = iota // A bare executable that can be replaced in place
+	InstallAppBundle                    // Inside a macOS .app bundle
+	InstallElevated                     // Under Program Files, replacing it needs UAC elevation
+	InstallManaged                      // Owned by a package manager, which must deliver updates
+)
+
+// bundleExeDir is where a macOS .app bundle keeps its executable
+const bundleExeDir = ".app/Contents/MacOS/"
+
+// Installation is where and how the running binary is installed
+type Installation struct {
+	Kind       InstallKind
+	ExePath    string // The file to replace, e.g. the AppImage rather than its mounted binary
+	BundlePath string // Path of the .app for InstallAppBundle
+	Manager    string // Package manager name for InstallManaged
+}
+
+// DetectInstallation inspects exePath to determine how updates can be installed
+func DetectInstallation(exePath string) *Installation {
+	if resolved, err := filepath.EvalSymlinks(exePath); err == nil {
+		exePath = resolved
+	}
+	return detectInstallation(exePath, runtime.GOOS, os.Getenv)
+}
+
+func detectInstallation(exePath, goos string, getenv func(string) string) *Installation {
+	inst := &Installation{Kind: InstallPortable, ExePath: exePath}
+
+	switch goos {
+	case "darwin":
+		for _, prefix := range []string{"/opt/homebrew/", "/usr/local/Cellar/", "/usr/local/Caskroom/", "/nix/store/"} {
+			if strings.HasPrefix(exePath, prefix) {
+				inst.Kind, inst.Manager = InstallManaged, managerFor(prefix)
+				return inst
+			}
+		}
+		if i := strings.Index(exePath, bundleExeDir); i >= 0 {
+			inst.Kind = InstallAppBundle
+			inst.BundlePath = exePath[:i+len(".app")]
+		}
+
+	case "windows":
+		lower := strings.ToLower(exePath)
+		switch {
+		case strings.Contains(lower, `\scoop\apps\`):
+			inst.Kind, inst.Manager = InstallManaged, "Scoop"
+			return inst
+		case strings.Contains(lower, `\winget\packages\`):
+			inst.Kind, inst.Manager = InstallManaged, "WinGet"
+			return inst
+		}
+		for _, env := range []string{"ProgramFiles", "ProgramFiles(x86)", "ProgramW6432"} {
+			dir := strings.ToLower(strings.TrimRight(getenv(env), `\`))
+			if dir != "" && strings.HasPrefix(lower, dir+`\`) {
+				inst.Kind = InstallElevated
+				return inst
+			}
+		}
+
+	case "linux":
+		switch {
+		case getenv("FLATPAK_ID") != "":
+			inst.Kind, inst.Manager = InstallManaged, "Flatpak"
+			return inst
+		case getenv("SNAP") != "":
+			inst.Kind, inst.Manager = InstallManaged, "Snap"
+			return inst
+		case getenv("APPIMAGE") != "":
+			// The binary runs from a read-only mount, the AppImage file itself is replaced
+			inst.ExePath = getenv("APPIMAGE")
+			return inst
+		}
+		if strings.HasPrefix(exePath, "/usr/local/") {
+			return inst
+		}
+		for _, prefix := range []string{"/usr/", "/bin/", "/sbin/", "/nix/store/"} {
+			if strings.HasPrefix(exePath, prefix) {
+				inst.Kind, inst.Manager = InstallManaged, managerFor(prefix)
+				return inst
+			}
+		}
+	}
+
+	return inst
+}
+
+func managerFor(prefix string) string {
+	switch prefix {
+	case "/opt/homebrew/", "/usr/local/Cellar/", "/usr/local/Caskroom/":
+		return "Homebrew"
+	case "/nix/store/":
+		return "Nix"
+	default:
+		return "your package manager"
+	}
+}
+
+// CanSelfUpdate reports why the updater cannot replace this installation, or nil if it can
+func (inst *Installation) CanSelfUpdate() error {
+	if inst.Kind == InstallManaged {
+		return fmt.Errorf("2c1f is managed by %s, please update it from there", inst.Manager)
+	}
+	return nil
+}
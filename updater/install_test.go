@@ -0,0 +1,67 @@
+package updater
+
+import "testing"
+
+func TestDetectInstallation(t *testing.T) {
+	env := map[string]string{
+		"ProgramFiles":      `C:\Program Files`,
+		"ProgramFiles(x86)": `C:\Program Files (x86)`,
+	}
+	getenv := func(key string) string { return env[key] }
+
+	tests := []struct {
+		name    string
+		exePath string
+		goos    string
+		kind    InstallKind
+		bundle  string
+	}{
+		{"mac bundle", "/Applications/2c1f.app/Contents/MacOS/2c1f", "darwin", InstallAppBundle, "/Applications/2c1f.app"},
+		{"mac homebrew", "/opt/homebrew/Cellar/2c1f/2.3.0/bin/2c1f", "darwin", InstallManaged, ""},
+		{"mac bare", "/Users/me/Downloads/2c1f-darwin-arm64", "darwin", InstallPortable, ""},
+		{"windows program files", `C:\Program Files\2c1f\2c1f.exe`, "windows", InstallElevated, ""},
+		{"windows program files x86", `c:\program files (x86)\2c1f\2c1f.exe`, "windows", InstallElevated, ""},
+		{"windows scoop", `C:\Users\me\scoop\apps\2c1f\current\2c1f.exe`, "windows", InstallManaged, ""},
+		{"windows per-user", `C:\Users\me\AppData\Local\Programs\2c1f\2c1f.exe`, "windows", InstallPortable, ""},
+		{"linux package", "/usr/bin/2c1f", "linux", InstallManaged, ""},
+		{"linux local", "/usr/local/bin/2c1f", "linux", InstallPortable, ""},
+		{"linux home", "/home/me/bin/2c1f", "linux", InstallPortable, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inst := detectInstallation(tt.exePath, tt.goos, getenv)
+			if inst.Kind != tt.kind {
+				t.Errorf("Kind = %d, want %d", inst.Kind, tt.kind)
+			}
+			if inst.BundlePath != tt.bundle {
+				t.Errorf("BundlePath = %q, want %q", inst.BundlePath, tt.bundle)
+			}
+			if (inst.CanSelfUpdate() == nil) != (tt.kind != InstallManaged) {
+				t.Errorf("CanSelfUpdate() = %v for kind %d", inst.CanSelfUpdate(), inst.Kind)
+			}
+		})
+	}
+}
+
+func TestDetectInstallation_LinuxSandboxes(t *testing.T) {
+	inst := detectInstallation("/tmp/.mount_2c1fXYZ/2c1f", "linux", func(key string) string {
+		if key == "APPIMAGE" {
+			return "/home/me/Apps/2c1f.AppImage"
+		}
+		return ""
+	})
+	if inst.Kind != InstallPortable || inst.ExePath != "/home/me/Apps/2c1f.AppImage" {
+		t.Errorf("AppImage detected as %+v", inst)
+	}
+
+	inst = detectInstallation("/app/bin/2c1f", "linux", func(key string) string {
+		if key == "FLATPAK_ID" {
+			return "io.github.ebob10000.2c1f"
+		}
+		return ""
+	})
+	if inst.Kind != InstallManaged || inst.Manager != "Flatpak" {
+		t.Errorf("Flatpak detected as %+v", inst)
+	}
+}
@@ -0,0 +1,145 @@
+package updater
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/ebob10000/2c1f/paths"
+)
+
+const (
+	// CrashThreshold is how many unconfirmed startups of a new version trigger a rollback prompt
+	CrashThreshold = 2
+	// StableAfter is how long a new version must run before its startup counts as successful
+	StableAfter = 30 * time.Second
+)
+
+// UpdateState records the last installed update so a broken version can be rolled back
+type UpdateState struct {
+	PreviousVersion string    `json:"previousVersion"`
+	NewVersion      string    `json:"newVersion"`
+	BackupPath      string    `json:"backupPath"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+	FailedStartups  int       `json:"failedStartups"` // Startups that did not reach StableAfter
+	Confirmed       bool      `json:"confirmed"`      // The new version has started successfully
+}
+
+// GetStatePath returns the path to the update state file
+func GetStatePath() string {
+	return paths.Config("update.json", ".2c1f-update.json")
+}
+
+// BackupPath returns where the previous binary is kept, e.g. 2c1f.old next to 2c1f.exe.
+// A macOS app bundle keeps it next to the bundle, as any file added inside
+// breaks the bundle's code signature.
+func BackupPath(currentPath string) string {
+	if i := strings.Index(currentPath, bundleExeDir); i >= 0 {
+		return currentPath[:i] + ".old"
+	}
+	return strings.TrimSuffix(currentPath, ".exe") + ".old"
+}
+
+// LoadState reads the update state, returning nil if no update was recorded
+func LoadState() *UpdateState {
+	data, err := os.ReadFile(GetStatePath())
+	if err != nil {
+		return nil
+	}
+	var state UpdateState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil
+	}
+	return &state
+}
+
+func saveState(state *UpdateState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(GetStatePath(), data, 0600)
+}
+
+// RecordUpdate remembers an update that is about to be installed over currentPath
+func RecordUpdate(previousVersion, newVersion, currentPath string) error {
+	return saveState(&UpdateState{
+		PreviousVersion: previousVersion,
+		NewVersion:      newVersion,
+		BackupPath:      BackupPath(currentPath),
+		UpdatedAt:       time.Now(),
+	})
+}
+
+// CheckStartup counts a startup of currentVersion and reports whether it has
+// failed often enough since the update that a rollback should be offered.
+// Call ConfirmStartup once the application has run for StableAfter or exits cleanly.
+func CheckStartup(currentVersion string) (*UpdateState, bool) {
+	state := LoadState()
+	if state == nil || state.Confirmed || state.NewVersion != currentVersion {
+		return state, false
+	}
+
+	needsRollback := state.FailedStartups >= CrashThreshold
+	state.FailedStartups++
+	saveState(state)
+
+	if _, err := os.Stat(state.BackupPath); err != nil {
+		return state, false
+	}
+	return state, needsRollback
+}
+
+// ConfirmStartup marks the installed update as working
+func ConfirmStartup(currentVersion string) {
+	state := LoadState()
+	if state == nil || state.Confirmed || state.NewVersion != currentVersion {
+		return
+	}
+	state.Confirmed = true
+	state.FailedStartups = 0
+	saveState(state)
+}
+
+// Rollback restores the binary kept by the last update over currentPath.
+// The running executable is renamed aside, which works on all platforms.
+func Rollback(currentPath string) (*UpdateState, error) {
+	state := LoadState()
+	backup := BackupPath(currentPath)
+	if state != nil && state.BackupPath != "" {
+		backup = state.BackupPath
+	}
+
+	if _, err := os.Stat(backup); err != nil {
+		return nil, errors.New("no previous version available to roll back to")
+	}
+
+	failedPath := currentPath + ".failed"
+	os.Remove(failedPath)
+	if err := os.Rename(currentPath, failedPath); err != nil {
+		return nil, fmt.Errorf("failed to move current version aside: %w", err)
+	}
+	if err := os.Rename(backup, currentPath); err != nil {
+		os.Rename(failedPath, currentPath)
+		return nil, fmt.Errorf("failed to restore previous version: %w", err)
+	}
+	// Fails on Windows while the failed version is still running; the next rollback removes it
+	os.Remove(failedPath)
+
+	os.Remove(GetStatePath())
+	return state, nil
+}
+
+// Restart launches the executable at path and exits the current process
+func Restart(path string) error {
+	cmd := exec.Command(path)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to restart: %w", err)
+	}
+	os.Exit(0)
+	return nil
+}
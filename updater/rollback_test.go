@@ -0,0 +1,98 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckStartup_DetectsRepeatedCrashes(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	exe := filepath.Join(t.TempDir(), "2c1f")
+	if err := os.WriteFile(BackupPath(exe), []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RecordUpdate("2.2.0", "2.3.0", exe); err != nil {
+		t.Fatalf("RecordUpdate failed: %v", err)
+	}
+
+	for i := 0; i < CrashThreshold; i++ {
+		if _, needsRollback := CheckStartup("2.3.0"); needsRollback {
+			t.Fatalf("Startup %d should not offer rollback yet", i+1)
+		}
+	}
+	state, needsRollback := CheckStartup("2.3.0")
+	if !needsRollback {
+		t.Fatal("Expected rollback to be offered after repeated failed startups")
+	}
+	if state.PreviousVersion != "2.2.0" {
+		t.Errorf("PreviousVersion = %q, want 2.2.0", state.PreviousVersion)
+	}
+
+	ConfirmStartup("2.3.0")
+	if _, needsRollback := CheckStartup("2.3.0"); needsRollback {
+		t.Error("Confirmed version should not offer rollback")
+	}
+}
+
+func TestCheckStartup_OtherVersion(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	exe := filepath.Join(t.TempDir(), "2c1f")
+	os.WriteFile(BackupPath(exe), []byte("old"), 0755)
+	RecordUpdate("2.2.0", "2.3.0", exe)
+
+	for i := 0; i <= CrashThreshold; i++ {
+		if _, needsRollback := CheckStartup("2.2.0"); needsRollback {
+			t.Fatal("Startups of a different version must not count as crashes")
+		}
+	}
+}
+
+func TestRollback(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	exe := filepath.Join(t.TempDir(), "2c1f")
+	if err := os.WriteFile(exe, []byte("new"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(BackupPath(exe), []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	RecordUpdate("2.2.0", "2.3.0", exe)
+
+	state, err := Rollback(exe)
+	if err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if state == nil || state.PreviousVersion != "2.2.0" {
+		t.Errorf("Unexpected state: %+v", state)
+	}
+
+	data, err := os.ReadFile(exe)
+	if err != nil || string(data) != "old" {
+		t.Errorf("Expected previous binary to be restored, got %q (%v)", data, err)
+	}
+	if _, err := os.Stat(BackupPath(exe)); !os.IsNotExist(err) {
+		t.Error("Backup should have been moved into place")
+	}
+	if LoadState() != nil {
+		t.Error("Update state should be cleared after rollback")
+	}
+
+	if _, err := Rollback(exe); err == nil {
+		t.Error("Expected second rollback to fail without a backup")
+	}
+}
+
+func TestBackupPath(t *testing.T) {
+	if got := BackupPath(filepath.Join("bin", "2c1f.exe")); got != filepath.Join("bin", "2c1f.old") {
+		t.Errorf("BackupPath = %q", got)
+	}
+	if got := BackupPath(filepath.Join("bin", "2c1f")); got != filepath.Join("bin", "2c1f.old") {
+		t.Errorf("BackupPath = %q", got)
+	}
+	// Outside the bundle, whose signature covers everything in it
+	if got := BackupPath("/Applications/2c1f.app/Contents/MacOS/2c1f"); got != "/Applications/2c1f.old" {
+		t.Errorf("BackupPath = %q, want it next to the app bundle", got)
+	}
+}
@@ -0,0 +1,189 @@
+package updater
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// PublicKey is the minisign public key that release binaries are signed with.
+// Release builds embed it with:
+//
+//	-ldflags "-X github.com/ebob10000/2c1f/updater.PublicKey=RW..."
+//
+// Builds without a key cannot verify updates and refuse them unless unsigned updates are allowed.
+var PublicKey = ""
+
+// SignatureExt is appended to an asset name to find its detached signature
+const SignatureExt = ".minisig"
+
+// ErrUnsigned is returned when an update has no signature or no key is available to check it
+var ErrUnsigned = errors.New("update is not signed")
+
+const (
+	sigAlgEd         = "Ed" // Signature over the raw file
+	sigAlgEdPrehash  = "ED" // Signature over the BLAKE2b-512 hash of the file
+	trustedCommentID = "trusted comment: "
+)
+
+type publicKey struct {
+	keyID [8]byte
+	key   ed25519.PublicKey
+}
+
+type signature struct {
+	algorithm       string
+	keyID           [8]byte
+	sig             []byte
+	trustedComment  string
+	globalSignature []byte
+}
+
+// VerifySignature checks a minisign signature of the file at path against publicKey
+func VerifySignature(path string, sigData []byte, publicKey string) error {
+	if publicKey == "" {
+		return fmt.Errorf("%w: no public key embedded in this build", ErrUnsigned)
+	}
+	pk, err := parsePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+	sig, err := parseSignature(sigData)
+	if err != nil {
+		return err
+	}
+	if sig.keyID != pk.keyID {
+		return fmt.Errorf("signature was made with a different key (%X)", sig.keyID)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open update: %w", err)
+	}
+	defer f.Close()
+
+	var message []byte
+	if sig.algorithm == sigAlgEdPrehash {
+		h, _ := blake2b.New512(nil)
+		if _, err := io.Copy(h, f); err != nil {
+			return fmt.Errorf("failed to hash update: %w", err)
+		}
+		message = h.Sum(nil)
+	} else {
+		message, err = io.ReadAll(f)
+		if err != nil {
+			return fmt.Errorf("failed to read update: %w", err)
+		}
+	}
+
+	if !ed25519.Verify(pk.key, message, sig.sig) {
+		return errors.New("invalid update signature")
+	}
+
+	// The global signature binds the trusted comment to the file signature
+	global := append(append([]byte{}, sig.sig...), sig.trustedComment...)
+	if !ed25519.Verify(pk.key, global, sig.globalSignature) {
+		return errors.New("invalid trusted comment signature")
+	}
+
+	return nil
+}
+
+// FetchSignature downloads the detached signature for an asset
+func FetchSignature(asset *Asset) ([]byte, error) {
+	if asset.SignatureURL == "" {
+		return nil, fmt.Errorf("%w: no %s asset for %s", ErrUnsigned, SignatureExt, asset.Name)
+	}
+
+	resp, err := httpGet(asset.SignatureURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download signature: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("signature download failed with status: %d", resp.StatusCode)
+	}
+
+	// Signature files are a few hundred bytes
+	return io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+}
+
+// parsePublicKey accepts either the contents of a minisign .pub file or just its base64 line
+func parsePublicKey(s string) (*publicKey, error) {
+	lines := nonEmptyLines(s)
+	if len(lines) == 0 {
+		return nil, errors.New("empty public key")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(lines[len(lines)-1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key encoding: %w", err)
+	}
+	if len(raw) != 2+8+ed25519.PublicKeySize || string(raw[:2]) != sigAlgEd {
+		return nil, errors.New("invalid public key format")
+	}
+
+	pk := &publicKey{key: ed25519.PublicKey(raw[10:])}
+	copy(pk.keyID[:], raw[2:10])
+	return pk, nil
+}
+
+// parseSignature parses a minisign signature file:
+//
+//	untrusted comment: <text>
+//	base64(<alg><key id><signature>)
+//	trusted comment: <text>
+//	base64(<global signature>)
+func parseSignature(data []byte) (*signature, error) {
+	lines := nonEmptyLines(string(data))
+	if len(lines) < 4 || !strings.HasPrefix(lines[2], trustedCommentID) {
+		return nil, errors.New("invalid signature file format")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	if len(raw) != 2+8+ed25519.SignatureSize {
+		return nil, errors.New("invalid signature length")
+	}
+	algorithm := string(raw[:2])
+	if algorithm != sigAlgEd && algorithm != sigAlgEdPrehash {
+		return nil, fmt.Errorf("unsupported signature algorithm %q", algorithm)
+	}
+
+	global, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil {
+		return nil, fmt.Errorf("invalid global signature encoding: %w", err)
+	}
+	if len(global) != ed25519.SignatureSize {
+		return nil, errors.New("invalid global signature length")
+	}
+
+	sig := &signature{
+		algorithm:       algorithm,
+		sig:             raw[10:],
+		trustedComment:  strings.TrimPrefix(lines[2], trustedCommentID),
+		globalSignature: global,
+	}
+	copy(sig.keyID[:], raw[2:10])
+	return sig, nil
+}
+
+func nonEmptyLines(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,184 @@
+package updater
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// testSigner produces minisign-compatible keys and signatures
+type testSigner struct {
+	keyID [8]byte
+	pub   ed25519.PublicKey
+	priv  ed25519.PrivateKey
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testSigner{pub: pub, priv: priv}
+	copy(s.keyID[:], "testkey1")
+	return s
+}
+
+func (s *testSigner) publicKey() string {
+	raw := append([]byte(sigAlgEd), s.keyID[:]...)
+	raw = append(raw, s.pub...)
+	return "untrusted comment: minisign public key\n" + base64.StdEncoding.EncodeToString(raw) + "\n"
+}
+
+func (s *testSigner) sign(data []byte, prehash bool) []byte {
+	alg := sigAlgEd
+	message := data
+	if prehash {
+		alg = sigAlgEdPrehash
+		sum := blake2b.Sum512(data)
+		message = sum[:]
+	}
+	sig := ed25519.Sign(s.priv, message)
+	comment := "timestamp:1700000000\tfile:2c1f-linux-amd64"
+	global := ed25519.Sign(s.priv, append(append([]byte{}, sig...), comment...))
+
+	raw := append([]byte(alg), s.keyID[:]...)
+	raw = append(raw, sig...)
+	return []byte("untrusted comment: signature from minisign secret key\n" +
+		base64.StdEncoding.EncodeToString(raw) + "\n" +
+		trustedCommentID + comment + "\n" +
+		base64.StdEncoding.EncodeToString(global) + "\n")
+}
+
+func TestVerifySignature(t *testing.T) {
+	signer := newTestSigner(t)
+	content := []byte("update binary")
+	path := filepath.Join(t.TempDir(), "update.bin")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, prehash := range []bool{false, true} {
+		if err := VerifySignature(path, signer.sign(content, prehash), signer.publicKey()); err != nil {
+			t.Errorf("VerifySignature(prehash=%v) failed: %v", prehash, err)
+		}
+	}
+
+	if err := VerifySignature(path, signer.sign([]byte("tampered"), true), signer.publicKey()); err == nil {
+		t.Error("Expected signature of different content to fail")
+	}
+
+	other := newTestSigner(t)
+	if err := VerifySignature(path, other.sign(content, true), signer.publicKey()); err == nil {
+		t.Error("Expected signature from a different key to fail")
+	}
+
+	if err := VerifySignature(path, signer.sign(content, true), ""); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("Expected ErrUnsigned without a public key, got %v", err)
+	}
+}
+
+func TestDownloadUpdate_Signature(t *testing.T) {
+	signer := newTestSigner(t)
+	content := []byte("signed update content")
+	sig := signer.sign(content, true)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/update.minisig" {
+			w.Write(sig)
+			return
+		}
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	originalKey := PublicKey
+	PublicKey = signer.publicKey()
+	defer func() { PublicKey = originalKey }()
+
+	t.Run("ValidSignature", func(t *testing.T) {
+		asset := &Asset{
+			Name:               "update",
+			BrowserDownloadURL: server.URL + "/update",
+			SignatureURL:       server.URL + "/update.minisig",
+			Size:               int64(len(content)),
+		}
+		tmpFile, err := DownloadUpdate(asset, false, nil)
+		if err != nil {
+			t.Fatalf("DownloadUpdate failed: %v", err)
+		}
+		os.Remove(tmpFile)
+	})
+
+	t.Run("UnsignedRefused", func(t *testing.T) {
+		asset := &Asset{
+			Name:               "update",
+			BrowserDownloadURL: server.URL + "/update",
+			Size:               int64(len(content)),
+		}
+		tmpFile, err := DownloadUpdate(asset, false, nil)
+		if !errors.Is(err, ErrUnsigned) {
+			os.Remove(tmpFile)
+			t.Fatalf("Expected ErrUnsigned, got %v", err)
+		}
+	})
+
+	t.Run("UnsignedAllowed", func(t *testing.T) {
+		asset := &Asset{
+			Name:               "update",
+			BrowserDownloadURL: server.URL + "/update",
+			Size:               int64(len(content)),
+		}
+		tmpFile, err := DownloadUpdate(asset, true, nil)
+		if err != nil {
+			t.Fatalf("DownloadUpdate failed: %v", err)
+		}
+		os.Remove(tmpFile)
+	})
+
+	t.Run("NoKeyRefused", func(t *testing.T) {
+		asset := &Asset{
+			Name:               "update",
+			BrowserDownloadURL: server.URL + "/update",
+			SignatureURL:       server.URL + "/update.minisig",
+			Size:               int64(len(content)),
+		}
+		PublicKey = ""
+		defer func() { PublicKey = signer.publicKey() }()
+
+		tmpFile, err := DownloadUpdate(asset, false, nil)
+		if !errors.Is(err, ErrUnsigned) {
+			os.Remove(tmpFile)
+			t.Fatalf("Expected ErrUnsigned without a key, got %v", err)
+		}
+		tmpFile, err = DownloadUpdate(asset, true, nil)
+		if err != nil {
+			t.Fatalf("DownloadUpdate without a key and with unsigned updates allowed failed: %v", err)
+		}
+		os.Remove(tmpFile)
+	})
+
+	t.Run("BadSignatureRefusedEvenIfInsecure", func(t *testing.T) {
+		asset := &Asset{
+			Name:               "update",
+			BrowserDownloadURL: server.URL + "/update",
+			SignatureURL:       server.URL + "/update.minisig",
+			Size:               int64(len(content)),
+		}
+		PublicKey = newTestSigner(t).publicKey()
+		defer func() { PublicKey = signer.publicKey() }()
+
+		tmpFile, err := DownloadUpdate(asset, true, nil)
+		if err == nil {
+			os.Remove(tmpFile)
+			t.Fatal("Expected signature from an unknown key to be refused")
+		}
+	})
+}
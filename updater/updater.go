@@ -1,17 +1,24 @@
 package updater
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/ebob10000/2c1f/paths"
 )
 
 // UpdateInfo contains information about an available update
@@ -20,13 +27,47 @@ type UpdateInfo struct {
 	URL      string `json:"url"`
 	Size     int64  `json:"size"`
 	Checksum string `json:"checksum"`
+	Signed   bool   `json:"signed"` // Whether the release provides a signature for this platform
+
+	CanInstall  bool   `json:"canInstall"`  // False if the installation is managed externally
+	InstallHint string `json:"installHint"` // Why the update can't be installed by the app
+
+	Notes     string         `json:"notes"`     // Release notes of this version
+	Changelog []ReleaseNotes `json:"changelog"` // Notes of every version since the running one, newest first
 }
 
-// CheckForUpdates checks if a newer version is available on GitHub
-func CheckForUpdates(repo, currentVersion string) (*UpdateInfo, error) {
-	release, err := FetchLatestRelease(repo)
-	if err != nil {
-		return nil, err
+// ReleaseNotes is the changelog entry of a single release
+type ReleaseNotes struct {
+	Version    string `json:"version"`
+	Name       string `json:"name"`
+	Notes      string `json:"notes"`
+	Prerelease bool   `json:"prerelease"`
+}
+
+// Update channels
+const (
+	ChannelStable = "stable" // Only full releases
+	ChannelBeta   = "beta"   // Full releases and pre-releases
+)
+
+// CheckForUpdates checks if a newer version is available on GitHub for the given channel
+func CheckForUpdates(repo, currentVersion, channel string) (*UpdateInfo, error) {
+	var release *GitHubRelease
+	if channel == ChannelBeta {
+		releases, err := FetchReleases(repo)
+		if err != nil {
+			return nil, err
+		}
+		release = selectRelease(releases, channel)
+		if release == nil {
+			return nil, nil // No releases published
+		}
+	} else {
+		latest, err := FetchLatestRelease(repo)
+		if err != nil {
+			return nil, err
+		}
+		release = latest
 	}
 
 	// Compare versions
@@ -41,34 +82,191 @@ func CheckForUpdates(repo, currentVersion string) (*UpdateInfo, error) {
 		return nil, err
 	}
 
+	// The changelog is informational, fall back to this release's notes if it can't be fetched
+	changelog, err := GetChangelogSince(repo, currentVersion, channel)
+	if err != nil || len(changelog) == 0 {
+		changelog = []ReleaseNotes{releaseNotes(release)}
+	}
+
+	canInstall, installHint := true, ""
+	if exePath, err := os.Executable(); err == nil {
+		if err := DetectInstallation(exePath).CanSelfUpdate(); err != nil {
+			canInstall, installHint = false, err.Error()
+		}
+	}
+
 	return &UpdateInfo{
-		Version:  latestVersion,
-		URL:      asset.BrowserDownloadURL,
-		Size:     asset.Size,
-		Checksum: asset.Checksum,
+		Version:     latestVersion,
+		URL:         asset.BrowserDownloadURL,
+		Size:        asset.Size,
+		Checksum:    asset.Checksum,
+		Signed:      asset.SignatureURL != "",
+		CanInstall:  canInstall,
+		InstallHint: installHint,
+		Notes:       release.Body,
+		Changelog:   changelog,
 	}, nil
 }
 
+// GetChangelogSince returns the notes of every release newer than currentVersion,
+// newest first. Pre-releases are only included on the beta channel.
+func GetChangelogSince(repo, currentVersion, channel string) ([]ReleaseNotes, error) {
+	releases, err := FetchReleases(repo)
+	if err != nil {
+		return nil, err
+	}
+	return collectChangelog(releases, currentVersion, channel), nil
+}
+
+func collectChangelog(releases []GitHubRelease, currentVersion, channel string) []ReleaseNotes {
+	var notes []ReleaseNotes
+	for i := range releases {
+		r := &releases[i]
+		version := strings.TrimPrefix(r.TagName, "v")
+		if r.Draft || !isNewerVersion(currentVersion, version) {
+			continue
+		}
+		if channel != ChannelBeta && (r.Prerelease || isPrerelease(version)) {
+			continue
+		}
+		notes = append(notes, releaseNotes(r))
+	}
+
+	sort.SliceStable(notes, func(i, j int) bool {
+		return compareVersions(notes[i].Version, notes[j].Version) > 0
+	})
+	return notes
+}
+
+func releaseNotes(r *GitHubRelease) ReleaseNotes {
+	version := strings.TrimPrefix(r.TagName, "v")
+	return ReleaseNotes{
+		Version:    version,
+		Name:       r.Name,
+		Notes:      r.Body,
+		Prerelease: r.Prerelease || isPrerelease(version),
+	}
+}
+
+// selectRelease returns the newest release allowed on the channel, or nil if there is none
+func selectRelease(releases []GitHubRelease, channel string) *GitHubRelease {
+	var best *GitHubRelease
+	for i := range releases {
+		r := &releases[i]
+		if r.Draft {
+			continue
+		}
+		version := strings.TrimPrefix(r.TagName, "v")
+		if channel != ChannelBeta && (r.Prerelease || isPrerelease(version)) {
+			continue
+		}
+		if best == nil || compareVersions(version, strings.TrimPrefix(best.TagName, "v")) > 0 {
+			best = r
+		}
+	}
+	return best
+}
+
 // isNewerVersion compares two semantic version strings
 // Returns true if latest > current
 func isNewerVersion(current, latest string) bool {
-	currentParts := parseVersion(current)
-	latestParts := parseVersion(latest)
+	return compareVersions(latest, current) > 0
+}
+
+// compareVersions compares two semantic versions including pre-release tags.
+// Returns -1, 0 or 1 as a is older than, equal to or newer than b.
+func compareVersions(a, b string) int {
+	aParts := parseVersion(a)
+	bParts := parseVersion(b)
 
 	for i := 0; i < 3; i++ {
-		if latestParts[i] > currentParts[i] {
-			return true
+		if aParts[i] > bParts[i] {
+			return 1
 		}
-		if latestParts[i] < currentParts[i] {
-			return false
+		if aParts[i] < bParts[i] {
+			return -1
 		}
 	}
 
-	return false // versions are equal
+	return comparePrerelease(prereleaseOf(a), prereleaseOf(b))
 }
 
-// parseVersion parses a version string like "2.2.0" into [major, minor, patch]
+// comparePrerelease orders pre-release tags per semver: a release without a
+// tag is newer than any pre-release, numeric identifiers compare numerically
+// and sort before alphanumeric ones, and a longer tag wins when all shared
+// identifiers are equal (1.0.0-beta < 1.0.0-beta.1)
+func comparePrerelease(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+
+	aIDs := strings.Split(a, ".")
+	bIDs := strings.Split(b, ".")
+	for i := 0; i < len(aIDs) && i < len(bIDs); i++ {
+		aNum, aErr := strconv.Atoi(aIDs[i])
+		bNum, bErr := strconv.Atoi(bIDs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if aNum != bNum {
+				if aNum > bNum {
+					return 1
+				}
+				return -1
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(aIDs[i], bIDs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+
+	switch {
+	case len(aIDs) > len(bIDs):
+		return 1
+	case len(aIDs) < len(bIDs):
+		return -1
+	}
+	return 0
+}
+
+// isPrerelease reports whether the version carries a pre-release tag like "-beta.1"
+func isPrerelease(version string) bool {
+	return prereleaseOf(version) != ""
+}
+
+// prereleaseOf returns the pre-release part of a version ("beta.1" for "2.3.0-beta.1")
+func prereleaseOf(version string) string {
+	version = stripBuildMetadata(version)
+	if i := strings.Index(version, "-"); i >= 0 {
+		return version[i+1:]
+	}
+	return ""
+}
+
+func stripBuildMetadata(version string) string {
+	if i := strings.Index(version, "+"); i >= 0 {
+		return version[:i]
+	}
+	return version
+}
+
+// parseVersion parses a version string like "2.2.0" into [major, minor, patch].
+// Pre-release and build suffixes are ignored.
 func parseVersion(version string) [3]int {
+	version = stripBuildMetadata(version)
+	if i := strings.Index(version, "-"); i >= 0 {
+		version = version[:i]
+	}
+
 	parts := strings.Split(version, ".")
 	var result [3]int
 
@@ -82,67 +280,60 @@ func parseVersion(version string) [3]int {
 	return result
 }
 
-// DownloadUpdate downloads the update to a temporary file
+// DownloadUpdate downloads the update to a temporary file and verifies its signature.
+// Unsigned updates are refused with ErrUnsigned unless allowUnsigned is set. A
+// download that failed for good is deleted, while one that was interrupted is
+// kept and resumed by the next call for the asset, also after a restart.
 // progressCallback is called periodically with (downloaded, total) bytes
-func DownloadUpdate(asset *Asset, progressCallback func(int64, int64)) (string, error) {
-	// Create secure temp file with random name
-	tmpDir := os.TempDir()
-	out, err := os.CreateTemp(tmpDir, "2c1f-update-*"+filepath.Ext(asset.Name))
+func DownloadUpdate(asset *Asset, allowUnsigned bool, progressCallback func(int64, int64)) (string, error) {
+	partFile := partialPath(asset)
+	if err := os.MkdirAll(filepath.Dir(partFile), 0700); err != nil {
+		return "", fmt.Errorf("failed to create download folder: %w", err)
+	}
+	out, err := os.OpenFile(partFile, os.O_RDWR|os.O_CREATE, 0600)
 	if err != nil {
 		return "", fmt.Errorf("failed to create temp file: %w", err)
 	}
-	tmpFile := out.Name()
 	defer out.Close() // Safe cleanup if early return
 
-	// Download file
-	resp, err := http.Get(asset.BrowserDownloadURL)
-	if err != nil {
-		os.Remove(tmpFile)
-		return "", fmt.Errorf("failed to download update: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		os.Remove(tmpFile)
-		return "", fmt.Errorf("download failed with status: %d", resp.StatusCode)
-	}
-
-	// Hash while downloading
+	// Hash while downloading, starting with what an earlier attempt left
 	hasher := sha256.New()
-	multiWriter := io.MultiWriter(out, hasher)
-
-	// Copy with progress tracking
-	var downloaded int64
 	total := asset.Size
-	buf := make([]byte, 32*1024) // 32KB buffer
-
-	for {
-		n, err := resp.Body.Read(buf)
-		if n > 0 {
-			_, writeErr := multiWriter.Write(buf[:n])
-			if writeErr != nil {
-				os.Remove(tmpFile)
-				return "", fmt.Errorf("failed to write file: %w", writeErr)
-			}
+	downloaded, err := resumePartial(out, hasher, total)
+	if err != nil {
+		out.Close()
+		os.Remove(partFile)
+		return "", err
+	}
 
-			downloaded += int64(n)
+	// Download, resuming from the bytes already written after interruptions
+	for attempt := 0; downloaded < total || total <= 0; attempt++ {
+		n, err := downloadFrom(asset.BrowserDownloadURL, downloaded, out, hasher, func(received int64) {
 			if progressCallback != nil {
-				progressCallback(downloaded, total)
+				progressCallback(received, total)
 			}
+		})
+		downloaded = n
+		if err == nil {
+			break
 		}
 
-		if err == io.EOF {
-			break
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			out.Close()
+			os.Remove(partFile)
+			return "", err
 		}
-		if err != nil {
-			os.Remove(tmpFile)
-			return "", fmt.Errorf("failed to read response: %w", err)
+		if attempt >= DownloadRetries {
+			return "", err
 		}
+		time.Sleep(RetryDelay << attempt)
 	}
+	tmpFile := strings.TrimSuffix(partFile, partialExt)
 
 	// Verify size
 	if downloaded != total {
-		os.Remove(tmpFile)
+		os.Remove(partFile)
 		return "", fmt.Errorf("download incomplete: got %d bytes, expected %d", downloaded, total)
 	}
 
@@ -150,34 +341,220 @@ func DownloadUpdate(asset *Asset, progressCallback func(int64, int64)) (string,
 	if asset.Checksum != "" {
 		actualHash := hex.EncodeToString(hasher.Sum(nil))
 		if actualHash != asset.Checksum {
-			os.Remove(tmpFile)
+			os.Remove(partFile)
 			return "", fmt.Errorf("checksum mismatch: expected %s, got %s", asset.Checksum, actualHash)
 		}
 	}
 
 	// Ensure file is flushed to disk
 	if err := out.Close(); err != nil {
-		os.Remove(tmpFile)
+		os.Remove(partFile)
 		return "", fmt.Errorf("failed to close file: %w", err)
 	}
+	if err := os.Rename(partFile, tmpFile); err != nil {
+		os.Remove(partFile)
+		return "", fmt.Errorf("failed to move download: %w", err)
+	}
+
+	if err := verifyDownload(asset, tmpFile); err != nil {
+		if !allowUnsigned || !errors.Is(err, ErrUnsigned) {
+			os.Remove(tmpFile)
+			return "", err
+		}
+	}
 
 	return tmpFile, nil
 }
 
-// ReplaceAndRestart replaces the current executable with the update and restarts
+// partialExt marks a download that is not complete yet
+const partialExt = ".part"
+
+// partialPath returns where the download of asset is kept until it is
+// complete. The name depends on the URL, size and checksum, so a download
+// only resumes the same file.
+func partialPath(asset *Asset) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\n%d\n%s", asset.BrowserDownloadURL, asset.Size, asset.Checksum)))
+	dir := paths.CacheDir()
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "updates", "2c1f-update-"+hex.EncodeToString(sum[:8])+filepath.Ext(asset.Name)+partialExt)
+}
+
+// resumePartial hashes what an earlier download left in out and returns its
+// size, where the download goes on. More than total bytes cannot be the
+// asset, so it starts over then.
+func resumePartial(out *os.File, hasher hash.Hash, total int64) (int64, error) {
+	info, err := out.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read partial download: %w", err)
+	}
+	if total > 0 && info.Size() > total {
+		if err := out.Truncate(0); err != nil {
+			return 0, fmt.Errorf("failed to truncate file: %w", err)
+		}
+		return 0, nil
+	}
+	n, err := io.Copy(hasher, out)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read partial download: %w", err)
+	}
+	return n, nil
+}
+
+// restart empties out for a download from the start
+func restart(out *os.File, hasher hash.Hash) error {
+	if _, err := out.Seek(0, io.SeekStart); err != nil {
+		return &permanentError{fmt.Errorf("failed to rewind file: %w", err)}
+	}
+	if err := out.Truncate(0); err != nil {
+		return &permanentError{fmt.Errorf("failed to truncate file: %w", err)}
+	}
+	hasher.Reset()
+	return nil
+}
+
+// permanentError marks download failures that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// downloadFrom fetches rawURL starting at offset and appends to out, restarting
+// from zero if the server ignores the range request. It returns the number of
+// bytes in out afterwards. onProgress is called with that count as data arrives.
+func downloadFrom(rawURL string, offset int64, out *os.File, hasher hash.Hash, onProgress func(int64)) (int64, error) {
+	client, err := httpClient()
+	if err != nil {
+		return offset, &permanentError{err}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return offset, &permanentError{fmt.Errorf("failed to create request: %w", err)}
+	}
+	req.Header.Set("User-Agent", "2c1f-updater")
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return offset, fmt.Errorf("failed to download update: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		// Resuming, append to what we have, unless the server sent another
+		// range
+		if cr := resp.Header.Get("Content-Range"); cr != "" && !strings.HasPrefix(cr, fmt.Sprintf("bytes %d-", offset)) {
+			if err := restart(out, hasher); err != nil {
+				return offset, err
+			}
+			return 0, fmt.Errorf("server sent range %q instead of the one asked for", cr)
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The file on the server is not what was downloaded so far, start
+		// over
+		if err := restart(out, hasher); err != nil {
+			return offset, err
+		}
+		return 0, fmt.Errorf("server refused to resume at %d bytes", offset)
+	case resp.StatusCode == http.StatusOK:
+		if offset > 0 {
+			// Server doesn't support ranges, start over
+			if err := restart(out, hasher); err != nil {
+				return offset, err
+			}
+			offset = 0
+		}
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout:
+		return offset, fmt.Errorf("download failed with status: %d", resp.StatusCode)
+	default:
+		return offset, &permanentError{fmt.Errorf("download failed with status: %d", resp.StatusCode)}
+	}
+
+	// Abort the request if no data arrives for Timeout
+	stall := time.AfterFunc(Timeout, cancel)
+	defer stall.Stop()
+
+	multiWriter := io.MultiWriter(out, hasher)
+	buf := make([]byte, 32*1024) // 32KB buffer
+
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			stall.Reset(Timeout)
+			if _, writeErr := multiWriter.Write(buf[:n]); writeErr != nil {
+				return offset, &permanentError{fmt.Errorf("failed to write file: %w", writeErr)}
+			}
+			offset += int64(n)
+			onProgress(offset)
+		}
+
+		if err == io.EOF {
+			return offset, nil
+		}
+		if err != nil {
+			return offset, fmt.Errorf("failed to read response: %w", err)
+		}
+	}
+}
+
+// verifyDownload checks the detached signature of a downloaded asset against PublicKey
+func verifyDownload(asset *Asset, path string) error {
+	if PublicKey == "" {
+		return fmt.Errorf("%w: no public key embedded in this build", ErrUnsigned)
+	}
+	sig, err := FetchSignature(asset)
+	if err != nil {
+		return err
+	}
+	if err := VerifySignature(path, sig, PublicKey); err != nil {
+		return fmt.Errorf("signature verification failed: %w", err)
+	}
+	return nil
+}
+
+// ReplaceAndRestart replaces the current executable with the update and restarts.
+// The previous executable is kept at BackupPath for Rollback. Package-managed
+// installations are refused, Program Files installs are replaced with UAC
+// elevation and macOS app bundles are relaunched through the bundle.
 func ReplaceAndRestart(updatePath, currentPath string) error {
+	inst := DetectInstallation(currentPath)
+	if err := inst.CanSelfUpdate(); err != nil {
+		return err
+	}
+
 	switch runtime.GOOS {
 	case "windows":
-		return replaceAndRestartWindows(updatePath, currentPath)
+		return replaceAndRestartWindows(updatePath, inst.ExePath, inst.Kind == InstallElevated)
 	case "darwin", "linux":
-		return replaceAndRestartUnix(updatePath, currentPath)
+		restart := fmt.Sprintf(`nohup "%s" > /dev/null 2>&1 &`, inst.ExePath)
+		if inst.Kind == InstallAppBundle {
+			restart = fmt.Sprintf(`open -n "%s"`, inst.BundlePath)
+		}
+		return replaceAndRestartUnix(updatePath, inst.ExePath, restart)
 	default:
 		return fmt.Errorf("unsupported platform: %s", runtime.GOOS)
 	}
 }
 
-// replaceAndRestartWindows uses a batch script to replace the executable on Windows
-func replaceAndRestartWindows(updatePath, currentPath string) error {
+// replaceAndRestartWindows uses a batch script to replace the executable on Windows.
+// When elevated is set the script runs through a UAC prompt and relaunches the
+// app via explorer so it does not inherit administrator rights.
+func replaceAndRestartWindows(updatePath, currentPath string, elevated bool) error {
 	// Create secure temp script with random name
 	scriptFile, err := os.CreateTemp(os.TempDir(), "2c1f-update-*.bat")
 	if err != nil {
@@ -185,12 +562,19 @@ func replaceAndRestartWindows(updatePath, currentPath string) error {
 	}
 	scriptPath := scriptFile.Name()
 
+	start := fmt.Sprintf(`start "" "%s"`, currentPath)
+	if elevated {
+		start = fmt.Sprintf(`explorer.exe "%s"`, currentPath)
+	}
+
+	// Keep the previous version for rollback
 	script := fmt.Sprintf(`@echo off
 timeout /t 2 /nobreak > nul
 move /y "%s" "%s"
-start "" "%s"
+move /y "%s" "%s"
+%s
 del "%%~f0"
-`, updatePath, currentPath, currentPath)
+`, currentPath, BackupPath(currentPath), updatePath, currentPath, start)
 
 	if _, err := scriptFile.WriteString(script); err != nil {
 		scriptFile.Close()
@@ -201,6 +585,10 @@ del "%%~f0"
 
 	// Launch script in detached process
 	cmd := exec.Command("cmd.exe", "/C", scriptPath)
+	if elevated {
+		cmd = exec.Command("powershell.exe", "-NoProfile", "-WindowStyle", "Hidden", "-Command",
+			fmt.Sprintf(`Start-Process -Verb RunAs -WindowStyle Hidden cmd.exe -ArgumentList '/C "%s"'`, scriptPath))
+	}
 	cmd.SysProcAttr = getSysProcAttr()
 
 	if err := cmd.Start(); err != nil {
@@ -214,7 +602,8 @@ del "%%~f0"
 }
 
 // replaceAndRestartUnix uses a shell script to replace the executable on macOS/Linux
-func replaceAndRestartUnix(updatePath, currentPath string) error {
+// and then runs restart to launch the new version
+func replaceAndRestartUnix(updatePath, currentPath, restart string) error {
 	// Create secure temp script with random name
 	scriptFile, err := os.CreateTemp(os.TempDir(), "2c1f-update-*.sh")
 	if err != nil {
@@ -222,13 +611,15 @@ func replaceAndRestartUnix(updatePath, currentPath string) error {
 	}
 	scriptPath := scriptFile.Name()
 
+	// Keep the previous version for rollback
 	script := fmt.Sprintf(`#!/bin/bash
 sleep 2
 mv -f "%s" "%s"
+mv -f "%s" "%s"
 chmod +x "%s"
-nohup "%s" > /dev/null 2>&1 &
+%s
 rm -f "$0"
-`, updatePath, currentPath, currentPath, currentPath)
+`, currentPath, BackupPath(currentPath), updatePath, currentPath, currentPath, restart)
 
 	if _, err := scriptFile.WriteString(script); err != nil {
 		scriptFile.Close()
@@ -1,13 +1,19 @@
 package updater
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/ebob10000/2c1f/paths"
 )
 
 func TestParseVersion(t *testing.T) {
@@ -20,6 +26,8 @@ func TestParseVersion(t *testing.T) {
 		{"10.20.30", [3]int{10, 20, 30}},
 		{"1.2", [3]int{1, 2, 0}},
 		{"1", [3]int{1, 0, 0}},
+		{"2.3.0-beta.1", [3]int{2, 3, 0}},
+		{"2.3.0+build.5", [3]int{2, 3, 0}},
 		{"invalid", [3]int{0, 0, 0}},
 	}
 
@@ -45,6 +53,16 @@ func TestIsNewerVersion(t *testing.T) {
 		{"2.0.0", "1.0.0", false},
 		{"1.0.0", "1.0.0", false},
 		{"1.2.3", "1.2.4", true},
+		{"2.2.0", "2.3.0-beta.1", true},
+		{"2.3.0-beta.1", "2.3.0", true},
+		{"2.3.0", "2.3.0-beta.1", false},
+		{"2.3.0-beta.1", "2.3.0-beta.2", true},
+		{"2.3.0-beta.2", "2.3.0-beta.10", true},
+		{"2.3.0-alpha", "2.3.0-beta", true},
+		{"2.3.0-beta", "2.3.0-beta.1", true},
+		{"2.3.0-beta.1", "2.3.0-beta", false},
+		{"2.3.0-1", "2.3.0-alpha", true},
+		{"2.3.0-rc.1", "2.3.0-rc.1", false},
 	}
 
 	for _, tt := range tests {
@@ -78,7 +96,7 @@ func TestDownloadUpdate_ChecksumVerification(t *testing.T) {
 			Checksum:           correctChecksum,
 		}
 
-		tmpFile, err := DownloadUpdate(asset, nil)
+		tmpFile, err := DownloadUpdate(asset, true, nil)
 		if err != nil {
 			t.Fatalf("DownloadUpdate failed: %v", err)
 		}
@@ -99,7 +117,7 @@ func TestDownloadUpdate_ChecksumVerification(t *testing.T) {
 			Checksum:           incorrectChecksum,
 		}
 
-		tmpFile, err := DownloadUpdate(asset, nil)
+		tmpFile, err := DownloadUpdate(asset, true, nil)
 		if err == nil {
 			os.Remove(tmpFile)
 			t.Fatalf("DownloadUpdate should have failed with checksum mismatch")
@@ -123,7 +141,7 @@ func TestDownloadUpdate_ChecksumVerification(t *testing.T) {
 			Checksum:           "",
 		}
 
-		tmpFile, err := DownloadUpdate(asset, nil)
+		tmpFile, err := DownloadUpdate(asset, true, nil)
 		if err != nil {
 			t.Fatalf("DownloadUpdate failed: %v", err)
 		}
@@ -146,7 +164,7 @@ func TestDownloadUpdate_SecureTempFile(t *testing.T) {
 		Size:               int64(len(content)),
 	}
 
-	tmpFile, err := DownloadUpdate(asset, nil)
+	tmpFile, err := DownloadUpdate(asset, true, nil)
 	if err != nil {
 		t.Fatalf("DownloadUpdate failed: %v", err)
 	}
@@ -184,7 +202,7 @@ func TestDownloadUpdate_SizeVerification(t *testing.T) {
 		Size:               int64(len(content) + 100), // Wrong size
 	}
 
-	tmpFile, err := DownloadUpdate(asset, nil)
+	tmpFile, err := DownloadUpdate(asset, true, nil)
 	if err == nil {
 		os.Remove(tmpFile)
 		t.Fatalf("DownloadUpdate should have failed with size mismatch")
@@ -198,3 +216,207 @@ func TestDownloadUpdate_SizeVerification(t *testing.T) {
 		}
 	}
 }
+
+func TestSelectRelease(t *testing.T) {
+	releases := []GitHubRelease{
+		{TagName: "v2.2.0"},
+		{TagName: "v2.3.0-beta.2", Prerelease: true},
+		{TagName: "v2.3.0-beta.10", Prerelease: true},
+		{TagName: "v2.4.0", Draft: true},
+		{TagName: "v2.1.0"},
+	}
+
+	if r := selectRelease(releases, ChannelStable); r == nil || r.TagName != "v2.2.0" {
+		t.Errorf("stable channel selected %v, want v2.2.0", r)
+	}
+	if r := selectRelease(releases, ChannelBeta); r == nil || r.TagName != "v2.3.0-beta.10" {
+		t.Errorf("beta channel selected %v, want v2.3.0-beta.10", r)
+	}
+	if r := selectRelease(nil, ChannelBeta); r != nil {
+		t.Errorf("expected no release, got %v", r)
+	}
+}
+
+func TestDownloadUpdate_ResumesInterruptedDownload(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	hash := sha256.Sum256(content)
+
+	originalDelay := RetryDelay
+	RetryDelay = time.Millisecond
+	defer func() { RetryDelay = originalDelay }()
+
+	var requests int32
+	var resumedRange atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			// Send half the file, then drop the connection
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.WriteHeader(http.StatusOK)
+			w.Write(content[:len(content)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		resumedRange.Store(r.Header.Get("Range"))
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	asset := &Asset{
+		Name:               "test.bin",
+		BrowserDownloadURL: server.URL,
+		Size:               int64(len(content)),
+		Checksum:           hex.EncodeToString(hash[:]),
+	}
+
+	tmpFile, err := DownloadUpdate(asset, true, nil)
+	if err != nil {
+		t.Fatalf("DownloadUpdate failed: %v", err)
+	}
+	defer os.Remove(tmpFile)
+
+	if got, _ := resumedRange.Load().(string); got != "bytes="+strconv.Itoa(len(content)/2)+"-" {
+		t.Errorf("Expected resume from half way, got Range %q", got)
+	}
+}
+
+func TestDownloadUpdate_ResumesAfterRestart(t *testing.T) {
+	paths.SetBaseDir(t.TempDir())
+	defer paths.SetBaseDir("")
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	hash := sha256.Sum256(content)
+
+	originalDelay, originalRetries := RetryDelay, DownloadRetries
+	RetryDelay, DownloadRetries = time.Millisecond, 0
+	defer func() { RetryDelay, DownloadRetries = originalDelay, originalRetries }()
+
+	var requests int32
+	var resumedRange atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.WriteHeader(http.StatusOK)
+			w.Write(content[:len(content)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		resumedRange.Store(r.Header.Get("Range"))
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	asset := &Asset{
+		Name:               "test.bin",
+		BrowserDownloadURL: server.URL,
+		Size:               int64(len(content)),
+		Checksum:           hex.EncodeToString(hash[:]),
+	}
+
+	// Without retries the first call gives up, but keeps what arrived
+	if _, err := DownloadUpdate(asset, true, nil); err == nil {
+		t.Fatal("Expected the interrupted download to fail")
+	}
+	if info, err := os.Stat(partialPath(asset)); err != nil || info.Size() != int64(len(content)/2) {
+		t.Fatalf("Partial download not kept: %v", err)
+	}
+
+	tmpFile, err := DownloadUpdate(asset, true, nil)
+	if err != nil {
+		t.Fatalf("DownloadUpdate failed: %v", err)
+	}
+	defer os.Remove(tmpFile)
+	if got, _ := resumedRange.Load().(string); got != "bytes="+strconv.Itoa(len(content)/2)+"-" {
+		t.Errorf("Expected resume from half way, got Range %q", got)
+	}
+	if got, _ := os.ReadFile(tmpFile); !bytes.Equal(got, content) {
+		t.Error("Resumed download differs from the asset")
+	}
+	if _, err := os.Stat(partialPath(asset)); !os.IsNotExist(err) {
+		t.Error("Partial download left behind")
+	}
+}
+
+func TestDownloadUpdate_RangeNotSatisfiable(t *testing.T) {
+	paths.SetBaseDir(t.TempDir())
+	defer paths.SetBaseDir("")
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	hash := sha256.Sum256(content)
+
+	originalDelay := RetryDelay
+	RetryDelay = time.Millisecond
+	defer func() { RetryDelay = originalDelay }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	asset := &Asset{
+		Name:               "test.bin",
+		BrowserDownloadURL: server.URL,
+		Size:               int64(len(content)),
+		Checksum:           hex.EncodeToString(hash[:]),
+	}
+
+	// Left from a download of something else
+	os.MkdirAll(filepath.Dir(partialPath(asset)), 0700)
+	os.WriteFile(partialPath(asset), []byte("stale"), 0600)
+
+	tmpFile, err := DownloadUpdate(asset, true, nil)
+	if err != nil {
+		t.Fatalf("DownloadUpdate failed: %v", err)
+	}
+	defer os.Remove(tmpFile)
+	if got, _ := os.ReadFile(tmpFile); !bytes.Equal(got, content) {
+		t.Error("Download after 416 differs from the asset")
+	}
+}
+
+func TestDownloadUpdate_NoRetryOnClientError(t *testing.T) {
+	originalDelay := RetryDelay
+	RetryDelay = time.Millisecond
+	defer func() { RetryDelay = originalDelay }()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	asset := &Asset{Name: "test.bin", BrowserDownloadURL: server.URL, Size: 10}
+	if _, err := DownloadUpdate(asset, true, nil); err == nil {
+		t.Fatal("Expected download to fail")
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("Expected 1 request, got %d", n)
+	}
+}
+
+func TestCollectChangelog(t *testing.T) {
+	releases := []GitHubRelease{
+		{TagName: "v2.1.0", Body: "old"},
+		{TagName: "v2.4.0", Body: "four"},
+		{TagName: "v2.3.0", Body: "three"},
+		{TagName: "v2.4.0-beta.1", Body: "beta", Prerelease: true},
+		{TagName: "v2.5.0", Body: "draft", Draft: true},
+		{TagName: "v2.2.0", Body: "current"},
+	}
+
+	stable := collectChangelog(releases, "2.2.0", ChannelStable)
+	if len(stable) != 2 || stable[0].Version != "2.4.0" || stable[1].Version != "2.3.0" {
+		t.Errorf("stable changelog = %+v, want 2.4.0 and 2.3.0", stable)
+	}
+
+	beta := collectChangelog(releases, "2.2.0", ChannelBeta)
+	if len(beta) != 3 || beta[1].Version != "2.4.0-beta.1" || !beta[1].Prerelease {
+		t.Errorf("beta changelog = %+v, want 2.4.0, 2.4.0-beta.1 and 2.3.0", beta)
+	}
+
+	if latest := collectChangelog(releases, "2.4.0", ChannelStable); len(latest) != 0 {
+		t.Errorf("expected empty changelog when up to date, got %+v", latest)
+	}
+}